@@ -3,137 +3,194 @@ package cmd
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
+	"unicode/utf8"
 
-	"github.com/charmbracelet/glamour"
 	"github.com/spf13/cobra"
 	"github.com/trixsec-dev/trix/internal/agent"
 	"github.com/trixsec-dev/trix/internal/llm"
+	"github.com/trixsec-dev/trix/internal/ui"
+	"golang.org/x/term"
 )
 
-var (
-	llmModel    string
-	llmProvider string
-	ollamaURL   string
+// askOptions holds the flags of trix ask
+type askOptions struct {
+	llm         llmOptions
+	render      renderOptions
 	interactive bool
-	renderer    *glamour.TermRenderer
-)
+	quiet       bool
+	verbose     int
+	namespaces  []string
+}
 
-var askCmd = &cobra.Command{
-	Use:   "ask [question]",
-	Short: "Ask questions about your cluster's security",
-	Long: `Use AI to investigate security findings in your cluster.
+func newAskCmd() *cobra.Command {
+	o := &askOptions{}
+	cmd := &cobra.Command{
+		Use:   "ask [question]",
+		Short: "Ask questions about your cluster's security",
+		Long: `Use AI to investigate security findings in your cluster.
 
 Examples:
   trix ask "What are the critical vulnerabilities in my cluster?"
   trix ask "Why does my nginx deployment have so many CVEs?"
   trix ask "Which pods are most at risk?"
   trix ask "Explain CVE-2024-1234 and how to fix it"
+  trix ask -n payments "What should we fix first?"
 
 Providers:
   anthropic  - Requires ANTHROPIC_API_KEY
   openai     - Requires OPENAI_API_KEY
   mistral    - Requires MISTRAL_API_KEY (EU-based)
   ollama     - Local/remote Ollama (set OLLAMA_HOST or use --ollama-url)`,
-	Args: cobra.MinimumNArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		question := strings.Join(args, " ")
-
-		// Initialize markdown renderer
-		var err error
-		renderer, err = glamour.NewTermRenderer(
-			glamour.WithAutoStyle(),
-			glamour.WithWordWrap(100),
-		)
-		if err != nil {
-			renderer = nil // Fall back to plain text
-		}
+		Args: cobra.MinimumNArgs(1),
+		RunE: o.run,
+	}
+	addLLMFlags(cmd, &o.llm)
+	cmd.Flags().BoolVarP(&o.interactive, "interactive", "i", false, "Interactive mode for follow-up questions")
+	cmd.Flags().BoolVarP(&o.quiet, "quiet", "q", false, "Suppress progress output (spinner, tool call trace, token usage)")
+	cmd.Flags().StringSliceVarP(&o.namespaces, "namespace", "n", nil, "Restrict all tool calls to these namespaces (comma-separated)")
+	addRenderFlags(cmd, &o.render)
+	cmd.Flags().CountVarP(&o.verbose, "verbose", "v", "Show tool results on stderr (-vv also shows the model's intermediate reasoning)")
+	return cmd
+}
 
-		// Create LLM client based on provider flag or auto-detect
-		client, err := createLLMClient()
-		if err != nil {
-			fmt.Printf("Error: %v\n", err)
-			return
-		}
+func (o *askOptions) run(cmd *cobra.Command, args []string) error {
+	question := strings.Join(args, " ")
 
-		// Create agent and ask
-		a := agent.New(client)
-		ctx := context.Background()
+	// Create LLM client based on provider flag or auto-detect
+	client, err := o.llm.createClient(o.llm.model)
+	if err != nil {
+		return err
+	}
 
-		if interactive {
-			// Interactive mode with follow-ups
-			conv := a.NewConversation()
-			scanner := bufio.NewScanner(os.Stdin)
+	// Progress spinner on stderr, only for interactive terminals
+	var spinner *ui.Spinner
+	if !o.quiet && term.IsTerminal(int(os.Stderr.Fd())) {
+		spinner = ui.NewSpinner(os.Stderr)
+	}
 
-			// First question from args
-			fmt.Println("Investigating...")
-			response, err := conv.Ask(ctx, question)
-			if err != nil {
-				fmt.Printf("Error: %v\n", err)
-				return
+	// Create agent and ask
+	opts := agent.Options{
+		TokenReporting: true,
+		Progress:       newProgressHandler(spinner, o.verbose),
+		Namespaces:     o.namespaces,
+	}
+	if !o.quiet {
+		opts.TraceWriter = spinner.Writer(os.Stdout)
+	}
+	a := agent.New(client, opts)
+	ctx := cmd.Context()
+
+	if o.interactive {
+		// Interactive mode with follow-ups
+		sess := newAskSession(a, os.Stdout, o.llm.createClient)
+		scanner := bufio.NewScanner(os.Stdin)
+
+		// First question from args
+		o.startInvestigating(spinner)
+		response, err := sess.Ask(ctx, question)
+		spinner.Stop()
+		if err != nil {
+			return err
+		}
+		fmt.Println()
+		o.render.printResponse(response)
+
+		// Read input in the background so Ctrl-C at the prompt ends the session
+		lines := make(chan string)
+		go func() {
+			defer close(lines)
+			for scanner.Scan() {
+				lines <- scanner.Text()
 			}
-			fmt.Println()
-			printResponse(response)
+		}()
 
-			// Follow-up loop
-			for {
-				fmt.Print("\n> ")
-				if !scanner.Scan() {
-					break
+		// Follow-up loop
+		for {
+			fmt.Print("\n> ")
+			var line string
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case l, ok := <-lines:
+				if !ok {
+					return nil
 				}
-				input := strings.TrimSpace(scanner.Text())
-				if input == "" || input == "exit" || input == "quit" {
+				line = l
+			}
+			input := strings.TrimSpace(line)
+			if input == "" || input == "exit" || input == "quit" {
+				break
+			}
+			if input == "clear" {
+				sess.Reset()
+				fmt.Println("Context cleared.")
+				continue
+			}
+			if handled, err := sess.handleCommand(input); handled {
+				if errors.Is(err, errExitSession) {
 					break
 				}
-				if input == "clear" {
-					conv = a.NewConversation()
-					fmt.Println("Context cleared.")
-					continue
-				}
-
-				fmt.Println("Investigating...")
-				response, err := conv.Ask(ctx, input)
 				if err != nil {
-					fmt.Printf("Error: %v\n", err)
-					continue
+					fmt.Fprintf(cmd.ErrOrStderr(), "Error: %v\n", err)
 				}
-				fmt.Println()
-				printResponse(response)
+				continue
+			}
+
+			o.startInvestigating(spinner)
+			response, err := sess.Ask(ctx, input)
+			spinner.Stop()
+			if ctx.Err() != nil {
+				return ctx.Err()
 			}
-		} else {
-			// Single question mode
-			fmt.Println("Investigating...")
-			response, err := a.Ask(ctx, question)
 			if err != nil {
-				fmt.Printf("Error: %v\n", err)
-				return
+				fmt.Fprintf(cmd.ErrOrStderr(), "Error: %v\n", err)
+				continue
 			}
 			fmt.Println()
-			printResponse(response)
+			o.render.printResponse(response)
+		}
+	} else {
+		// Single question mode
+		o.startInvestigating(spinner)
+		response, err := a.Ask(ctx, question)
+		spinner.Stop()
+		if err != nil {
+			return err
 		}
-	},
+		fmt.Println()
+		o.render.printResponse(response)
+	}
+	return nil
+}
+
+// llmOptions holds the provider selection flags
+type llmOptions struct {
+	model     string
+	provider  string
+	ollamaURL string
 }
 
-func init() {
-	rootCmd.AddCommand(askCmd)
-	askCmd.Flags().StringVar(&llmModel, "model", "", "LLM model to use")
-	askCmd.Flags().StringVar(&llmProvider, "provider", "", "LLM provider: anthropic, openai, ollama (auto-detects if not set)")
-	askCmd.Flags().StringVar(&ollamaURL, "ollama-url", "", "Ollama server URL (default: http://localhost:11434)")
-	askCmd.Flags().BoolVarP(&interactive, "interactive", "i", false, "Interactive mode for follow-up questions")
+// addLLMFlags registers the provider selection flags used by createClient
+func addLLMFlags(cmd *cobra.Command, o *llmOptions) {
+	cmd.Flags().StringVar(&o.model, "model", "", "LLM model to use")
+	cmd.Flags().StringVar(&o.provider, "provider", "", "LLM provider: anthropic, openai, mistral, ollama (auto-detects if not set)")
+	cmd.Flags().StringVar(&o.ollamaURL, "ollama-url", "", "Ollama server URL (default: http://localhost:11434)")
 }
 
-// createLLMClient creates an LLM client based on --provider flag or auto-detects from env vars
-func createLLMClient() (llm.Client, error) {
-	provider := llmProvider
+// createClient creates an LLM client based on --provider flag or auto-detects from env vars
+func (o *llmOptions) createClient(model string) (llm.Client, error) {
+	provider := o.provider
 
 	// Auto-detect provider if not specified
 	if provider == "" {
 		hasAnthropic := os.Getenv("ANTHROPIC_API_KEY") != ""
 		hasOpenAI := os.Getenv("OPENAI_API_KEY") != ""
 		hasMistral := os.Getenv("MISTRAL_API_KEY") != ""
-		hasOllama := os.Getenv("OLLAMA_HOST") != "" || ollamaURL != ""
+		hasOllama := os.Getenv("OLLAMA_HOST") != "" || o.ollamaURL != ""
 
 		// Count how many providers are available
 		count := 0
@@ -164,27 +221,120 @@ func createLLMClient() (llm.Client, error) {
 
 	switch provider {
 	case "anthropic":
-		return llm.NewAnthropicClient(llmModel)
+		return llm.NewAnthropicClient(model)
 	case "openai":
-		return llm.NewOpenAIClient(llmModel)
+		return llm.NewOpenAIClient(model)
 	case "mistral":
-		return llm.NewMistralClient(llmModel)
+		return llm.NewMistralClient(model)
 	case "ollama":
-		return llm.NewOllamaClient(ollamaURL, llmModel)
+		return llm.NewOllamaClient(o.ollamaURL, model)
 	default:
 		return nil, fmt.Errorf("unknown provider: %s (use 'anthropic', 'openai', 'mistral', or 'ollama')", provider)
 	}
 }
 
-// printResponse renders markdown response to terminal
-func printResponse(response string) {
-	if renderer != nil {
-		out, err := renderer.Render(response)
-		if err == nil {
-			fmt.Print(out)
-			return
+// complete runs a single tool-less LLM call, with a spinner on stderr while
+// waiting. Used by commands that gather their own context.
+func complete(ctx context.Context, client llm.Client, status, instructions, prompt string) (string, error) {
+	var spinner *ui.Spinner
+	if term.IsTerminal(int(os.Stderr.Fd())) {
+		spinner = ui.NewSpinner(os.Stderr)
+	}
+	spinner.Start(status)
+	defer spinner.Stop()
+	return agent.New(client, agent.Options{}).Complete(ctx, instructions, prompt)
+}
+
+// startInvestigating announces a new question and starts the spinner
+func (o *askOptions) startInvestigating(spinner *ui.Spinner) {
+	if !o.quiet {
+		fmt.Println("Investigating...")
+	}
+	spinner.Start("waiting for model")
+}
+
+// Limits for tool output shown with --verbose
+const (
+	verboseMaxLines = 20
+	verboseMaxBytes = 2000
+)
+
+// newProgressHandler turns agent events into verbose output on stderr and
+// spinner status. The tool call trace itself comes from the agent's TraceWriter.
+func newProgressHandler(spinner *ui.Spinner, verbose int) agent.ProgressFunc {
+	muted := ui.NewRenderer(os.Stderr).NewStyle().Foreground(ui.ColorMuted)
+
+	return func(e agent.Event) {
+		switch e.Kind {
+		case agent.EventLLMStart:
+			spinner.Update(progressStatus("waiting for model", e))
+		case agent.EventLLMEnd:
+			// Final answer: clear the spinner before token usage is printed
+			if e.Err != nil || (e.Response != nil && len(e.Response.ToolCalls) == 0) {
+				spinner.Stop()
+				return
+			}
+			// -vv: show what the model said alongside its tool calls
+			if verbose >= 2 && e.Response != nil && strings.TrimSpace(e.Response.Content) != "" {
+				spinner.Println(os.Stderr, muted.Render(indentBlock(e.Response.Content, "  │ ")))
+			}
+		case agent.EventToolStart:
+			spinner.Update(progressStatus("running "+e.Description, e))
+		case agent.EventToolEnd:
+			if verbose >= 1 {
+				spinner.Println(os.Stderr, muted.Render(indentBlock(truncateOutput(e.Result), "      ")))
+			}
+		}
+	}
+}
+
+// truncateOutput shortens tool output for display
+func truncateOutput(s string) string {
+	s = strings.TrimRight(s, "\n")
+	if s == "" {
+		return "(empty)"
+	}
+	total := strings.Count(s, "\n") + 1
+	lines := strings.Split(s, "\n")
+	truncated := false
+	if len(lines) > verboseMaxLines {
+		lines = lines[:verboseMaxLines]
+		truncated = true
+	}
+	out := strings.Join(lines, "\n")
+	if len(out) > verboseMaxBytes {
+		// Cut at a rune boundary so multi-byte characters stay valid UTF-8
+		cut := verboseMaxBytes
+		for cut > 0 && !utf8.RuneStart(out[cut]) {
+			cut--
 		}
+		out = out[:cut]
+		truncated = true
+	}
+	if truncated {
+		out += fmt.Sprintf("\n... (%d lines, %d bytes total)", total, len(s))
+	}
+	return out
+}
+
+// indentBlock prefixes every line of s
+func indentBlock(s, prefix string) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	for i, l := range lines {
+		lines[i] = prefix + l
+	}
+	return strings.Join(lines, "\n")
+}
+
+// progressStatus appends the running totals to a spinner message
+func progressStatus(phase string, e agent.Event) string {
+	if e.ToolCalls == 0 && e.InputTokens == 0 {
+		return phase
+	}
+	calls := "tool calls"
+	if e.ToolCalls == 1 {
+		calls = "tool call"
 	}
-	// Fallback to plain text
-	fmt.Println(response)
+	return fmt.Sprintf("%s · %d %s, %s tokens so far", phase, e.ToolCalls, calls,
+		ui.FormatTokens(e.InputTokens+e.OutputTokens))
 }
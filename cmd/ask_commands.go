@@ -0,0 +1,221 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/trixsec-dev/trix/internal/agent"
+	"github.com/trixsec-dev/trix/internal/llm"
+)
+
+// askSession holds the state of an interactive `trix ask -i` session
+type askSession struct {
+	agent *agent.Agent
+	conv  *agent.Conversation
+	out   io.Writer
+
+	// newClient creates a client for the same provider with another model
+	newClient func(model string) (llm.Client, error)
+
+	// Session-wide usage, kept across "clear" and model switches
+	inputTokens  int
+	outputTokens int
+	cost         float64
+	costKnown    bool
+}
+
+func newAskSession(a *agent.Agent, out io.Writer, newClient func(model string) (llm.Client, error)) *askSession {
+	return &askSession{
+		agent:     a,
+		conv:      a.NewConversation(),
+		out:       out,
+		newClient: newClient,
+		costKnown: true,
+	}
+}
+
+// Ask sends a question in the current conversation and records token usage
+func (s *askSession) Ask(ctx context.Context, question string) (string, error) {
+	in, out := s.conv.TotalInputTokens, s.conv.TotalOutputTokens
+	response, err := s.conv.Ask(ctx, question)
+	s.recordUsage(s.conv.TotalInputTokens-in, s.conv.TotalOutputTokens-out)
+	return response, err
+}
+
+// recordUsage adds token usage, priced at the current model's rate
+func (s *askSession) recordUsage(in, out int) {
+	s.inputTokens += in
+	s.outputTokens += out
+	cost, ok := llm.EstimateCost(s.agent.Client(), in, out)
+	s.cost += cost
+	s.costKnown = s.costKnown && ok
+}
+
+// Reset starts a fresh conversation
+func (s *askSession) Reset() {
+	s.conv = s.agent.NewConversation()
+}
+
+const slashHelp = `Commands:
+  /tools [enable|disable <name>]  List tools, or toggle one for this session
+  /tokens                         Show token usage and estimated cost
+  /history                        Show the questions and answers so far
+  /save <file>                    Save the conversation (.json for JSON, otherwise markdown)
+  /model [name]                   Show the current model, or switch to another one
+  /clear                          Reset conversation context
+  /exit                           Exit (also: exit, quit)
+  /help                           Show this help`
+
+// errExitSession is returned by handleCommand when the user asked to quit
+var errExitSession = errors.New("exit")
+
+// handleCommand runs a slash-command. It returns false if input is not a
+// command, in which case it should be sent to the LLM.
+func (s *askSession) handleCommand(input string) (bool, error) {
+	if !strings.HasPrefix(input, "/") {
+		return false, nil
+	}
+
+	fields := strings.Fields(input)
+	name, args := strings.ToLower(fields[0]), fields[1:]
+
+	switch name {
+	case "/tools":
+		return true, s.cmdTools(args)
+	case "/tokens":
+		s.cmdTokens()
+	case "/history":
+		s.cmdHistory()
+	case "/save":
+		return true, s.cmdSave(args)
+	case "/model":
+		return true, s.cmdModel(args)
+	case "/clear":
+		s.Reset()
+		_, _ = fmt.Fprintln(s.out, "Context cleared.")
+	case "/exit", "/quit":
+		return true, errExitSession
+	case "/help":
+		_, _ = fmt.Fprintln(s.out, slashHelp)
+	default:
+		_, _ = fmt.Fprintf(s.out, "Unknown command: %s\n\n%s\n", name, slashHelp)
+	}
+	return true, nil
+}
+
+func (s *askSession) cmdTools(args []string) error {
+	registry := s.agent.Registry()
+
+	if len(args) > 0 {
+		if len(args) != 2 || (args[0] != "enable" && args[0] != "disable") {
+			return fmt.Errorf("usage: /tools [enable|disable <name>]")
+		}
+		if err := registry.SetEnabled(args[1], args[0] == "enable"); err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(s.out, "Tool %s %sd.\n", args[1], args[0])
+		return nil
+	}
+
+	for _, t := range registry.List() {
+		status := "enabled"
+		if !t.Enabled {
+			status = "disabled"
+		}
+		_, _ = fmt.Fprintf(s.out, "  %-20s %s\n", t.Name, status)
+	}
+	return nil
+}
+
+func (s *askSession) cmdTokens() {
+	_, _ = fmt.Fprintf(s.out, "Session: %d in, %d out (%d total)\n",
+		s.inputTokens, s.outputTokens, s.inputTokens+s.outputTokens)
+	_, _ = fmt.Fprintf(s.out, "Current context: %d in, %d out\n",
+		s.conv.TotalInputTokens, s.conv.TotalOutputTokens)
+	if s.costKnown {
+		_, _ = fmt.Fprintf(s.out, "Estimated cost: $%.4f\n", s.cost)
+	} else {
+		_, _ = fmt.Fprintf(s.out, "Estimated cost: unknown (no pricing for model %s)\n", s.agent.Client().Model())
+	}
+}
+
+func (s *askSession) cmdHistory() {
+	history := s.conv.History()
+	if len(history) == 0 {
+		_, _ = fmt.Fprintln(s.out, "No conversation yet.")
+		return
+	}
+	for _, m := range history {
+		label := "You"
+		if m.Role == llm.RoleAssistant {
+			label = "trix"
+		}
+		_, _ = fmt.Fprintf(s.out, "[%s] %s\n\n", label, strings.TrimSpace(m.Content))
+	}
+}
+
+func (s *askSession) cmdSave(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: /save <file>")
+	}
+	path := args[0]
+
+	var data []byte
+	history := s.conv.History()
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		type turn struct {
+			Role    string `json:"role"`
+			Content string `json:"content"`
+		}
+		turns := make([]turn, 0, len(history))
+		for _, m := range history {
+			turns = append(turns, turn{Role: string(m.Role), Content: m.Content})
+		}
+		var err error
+		data, err = json.MarshalIndent(turns, "", "  ")
+		if err != nil {
+			return err
+		}
+	} else {
+		var b strings.Builder
+		for _, m := range history {
+			if m.Role == llm.RoleUser {
+				b.WriteString("## Question\n\n")
+			} else {
+				b.WriteString("## Answer\n\n")
+			}
+			b.WriteString(strings.TrimSpace(m.Content) + "\n\n")
+		}
+		data = []byte(b.String())
+	}
+
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("failed to save conversation: %w", err)
+	}
+	_, _ = fmt.Fprintf(s.out, "Saved %d messages to %s\n", len(history), path)
+	return nil
+}
+
+func (s *askSession) cmdModel(args []string) error {
+	if len(args) == 0 {
+		_, _ = fmt.Fprintf(s.out, "Model: %s\n", s.agent.Client().Model())
+		return nil
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("usage: /model [name]")
+	}
+
+	client, err := s.newClient(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to switch model: %w", err)
+	}
+	s.agent.SetClient(client)
+	_, _ = fmt.Fprintf(s.out, "Switched to %s (history kept).\n", client.Model())
+	return nil
+}
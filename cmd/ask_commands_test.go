@@ -0,0 +1,248 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/trixsec-dev/trix/internal/agent"
+	"github.com/trixsec-dev/trix/internal/llm"
+)
+
+// scriptedClient answers every question with the next scripted answer
+// and records the messages it was sent
+type scriptedClient struct {
+	model    string
+	answers  []string
+	calls    int
+	messages [][]llm.Message
+}
+
+func (c *scriptedClient) Chat(ctx context.Context, messages []llm.Message, tools []llm.Tool) (*llm.Response, error) {
+	c.messages = append(c.messages, messages)
+	if c.calls >= len(c.answers) {
+		return nil, errors.New("no more answers")
+	}
+	c.calls++
+	return &llm.Response{
+		Content: c.answers[c.calls-1],
+		Usage:   llm.Usage{InputTokens: 1_000_000, OutputTokens: 100_000},
+	}, nil
+}
+
+func (c *scriptedClient) Model() string { return c.model }
+
+// testSession returns a session on a scripted client and its output
+func testSession(t *testing.T, model string, answers ...string) (*askSession, *strings.Builder) {
+	t.Helper()
+	var out strings.Builder
+	client := &scriptedClient{model: model, answers: answers}
+	newClient := func(model string) (llm.Client, error) {
+		if model == "broken" {
+			return nil, errors.New("no such model")
+		}
+		return &scriptedClient{model: model, answers: []string{"from " + model}}, nil
+	}
+	return newAskSession(agent.New(client, agent.Options{}), &out, newClient), &out
+}
+
+// slash feeds input to handleCommand and returns what it printed
+func slash(t *testing.T, s *askSession, out *strings.Builder, input string) (string, error) {
+	t.Helper()
+	out.Reset()
+	handled, err := s.handleCommand(input)
+	if !handled {
+		t.Fatalf("%q was not handled as a command", input)
+	}
+	return out.String(), err
+}
+
+func TestHandleCommandNotACommand(t *testing.T) {
+	s, out := testSession(t, "gpt-4o")
+	for _, input := range []string{"what is exposed?", "tools", " /tools"} {
+		if handled, err := s.handleCommand(input); handled || err != nil {
+			t.Errorf("handleCommand(%q) = %v, %v; want it sent to the model", input, handled, err)
+		}
+	}
+	if out.Len() != 0 {
+		t.Errorf("non-commands printed %q", out.String())
+	}
+}
+
+func TestHandleCommandHelp(t *testing.T) {
+	s, out := testSession(t, "gpt-4o")
+	got, err := slash(t, s, out, "/frobnicate now")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(got, "Unknown command: /frobnicate\n") || !strings.Contains(got, slashHelp) {
+		t.Errorf("unknown command output = %q", got)
+	}
+	if got, _ := slash(t, s, out, "/HELP"); got != slashHelp+"\n" {
+		t.Errorf("/HELP output = %q", got)
+	}
+	if _, err := slash(t, s, out, "/exit"); !errors.Is(err, errExitSession) {
+		t.Errorf("/exit err = %v", err)
+	}
+	if _, err := slash(t, s, out, "/quit"); !errors.Is(err, errExitSession) {
+		t.Errorf("/quit err = %v", err)
+	}
+}
+
+func TestHandleCommandTools(t *testing.T) {
+	s, out := testSession(t, "gpt-4o")
+
+	got, err := slash(t, s, out, "/tools")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(got, "  kubectl_logs         enabled\n") {
+		t.Errorf("/tools output lacks kubectl_logs: %q", got)
+	}
+
+	if got, err := slash(t, s, out, "/tools disable kubectl_logs"); err != nil || got != "Tool kubectl_logs disabled.\n" {
+		t.Errorf("/tools disable = %q, %v", got, err)
+	}
+	if got, _ := slash(t, s, out, "/tools"); !strings.Contains(got, "  kubectl_logs         disabled\n") {
+		t.Errorf("/tools after disable = %q", got)
+	}
+	for _, tool := range s.agent.Registry().Tools() {
+		if tool.Name == "kubectl_logs" {
+			t.Error("disabled tool is still offered to the model")
+		}
+	}
+	if _, err := slash(t, s, out, "/tools enable kubectl_logs"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, input := range []string{"/tools disable", "/tools remove kubectl_logs", "/tools disable a b"} {
+		if _, err := slash(t, s, out, input); err == nil || !strings.Contains(err.Error(), "usage: /tools") {
+			t.Errorf("%s err = %v, want usage", input, err)
+		}
+	}
+	if _, err := slash(t, s, out, "/tools disable no_such_tool"); err == nil || !strings.Contains(err.Error(), "unknown tool") {
+		t.Errorf("unknown tool err = %v", err)
+	}
+}
+
+func TestHandleCommandTokens(t *testing.T) {
+	s, out := testSession(t, "gpt-4o", "first", "second")
+	ctx := context.Background()
+	if _, err := s.Ask(ctx, "one"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := slash(t, s, out, "/clear"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Ask(ctx, "two"); err != nil {
+		t.Fatal(err)
+	}
+
+	// gpt-4o: $2.50 per million input, $10 per million output tokens
+	got, _ := slash(t, s, out, "/tokens")
+	want := "Session: 2000000 in, 200000 out (2200000 total)\n" +
+		"Current context: 1000000 in, 100000 out\n" +
+		"Estimated cost: $7.0000\n"
+	if got != want {
+		t.Errorf("/tokens = %q, want %q", got, want)
+	}
+
+	s, out = testSession(t, "in-house-model", "answer")
+	if _, err := s.Ask(ctx, "one"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := slash(t, s, out, "/tokens"); !strings.Contains(got, "Estimated cost: unknown (no pricing for model in-house-model)") {
+		t.Errorf("/tokens for an unpriced model = %q", got)
+	}
+}
+
+func TestHandleCommandHistoryAndSave(t *testing.T) {
+	s, out := testSession(t, "gpt-4o", "Patch openssl.", "Yes, it is exposed.")
+	if got, _ := slash(t, s, out, "/history"); got != "No conversation yet.\n" {
+		t.Errorf("empty /history = %q", got)
+	}
+
+	ctx := context.Background()
+	for _, q := range []string{"What first?", "Is api exposed?"} {
+		if _, err := s.Ask(ctx, q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, _ := slash(t, s, out, "/history")
+	want := "[You] What first?\n\n[trix] Patch openssl.\n\n[You] Is api exposed?\n\n[trix] Yes, it is exposed.\n\n"
+	if got != want {
+		t.Errorf("/history = %q, want %q", got, want)
+	}
+
+	dir := t.TempDir()
+	md := filepath.Join(dir, "session.md")
+	if got, err := slash(t, s, out, "/save "+md); err != nil || got != "Saved 4 messages to "+md+"\n" {
+		t.Fatalf("/save = %q, %v", got, err)
+	}
+	data, err := os.ReadFile(md)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "## Question\n\nWhat first?\n\n## Answer\n\nPatch openssl.\n\n") {
+		t.Errorf("markdown = %q", data)
+	}
+
+	js := filepath.Join(dir, "session.JSON")
+	if _, err := slash(t, s, out, "/save "+js); err != nil {
+		t.Fatal(err)
+	}
+	data, err = os.ReadFile(js)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var turns []struct{ Role, Content string }
+	if err := json.Unmarshal(data, &turns); err != nil {
+		t.Fatalf("saved JSON: %v", err)
+	}
+	if len(turns) != 4 || turns[0].Role != "user" || turns[3].Content != "Yes, it is exposed." {
+		t.Errorf("turns = %+v", turns)
+	}
+
+	if _, err := slash(t, s, out, "/save"); err == nil || !strings.Contains(err.Error(), "usage: /save") {
+		t.Errorf("/save without a file err = %v", err)
+	}
+	if _, err := slash(t, s, out, "/save "+filepath.Join(dir, "missing", "x.md")); err == nil {
+		t.Error("/save into a missing directory succeeded")
+	}
+}
+
+func TestHandleCommandModel(t *testing.T) {
+	s, out := testSession(t, "gpt-4o", "first")
+	ctx := context.Background()
+	if _, err := s.Ask(ctx, "one"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := slash(t, s, out, "/model"); got != "Model: gpt-4o\n" {
+		t.Errorf("/model = %q", got)
+	}
+	if got, err := slash(t, s, out, "/model gpt-4.1"); err != nil || got != "Switched to gpt-4.1 (history kept).\n" {
+		t.Errorf("/model gpt-4.1 = %q, %v", got, err)
+	}
+	if _, err := slash(t, s, out, "/model broken"); err == nil || !strings.Contains(err.Error(), "failed to switch model") {
+		t.Errorf("/model broken err = %v", err)
+	}
+	if s.agent.Client().Model() != "gpt-4.1" {
+		t.Errorf("model = %s after a failed switch, want gpt-4.1", s.agent.Client().Model())
+	}
+	if _, err := slash(t, s, out, "/model a b"); err == nil {
+		t.Error("/model with two names succeeded")
+	}
+
+	// The new client continues the same conversation
+	if got, err := s.Ask(ctx, "two"); err != nil || got != "from gpt-4.1" {
+		t.Fatalf("Ask after switch = %q, %v", got, err)
+	}
+	if n := len(s.conv.History()); n != 4 {
+		t.Errorf("history has %d messages after the switch, want 4", n)
+	}
+}
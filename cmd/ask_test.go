@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/trixsec-dev/trix/internal/agent"
+)
+
+func TestProgressStatus(t *testing.T) {
+	tests := []struct {
+		phase string
+		e     agent.Event
+		want  string
+	}{
+		{"waiting for model", agent.Event{}, "waiting for model"},
+		{"running kubectl get pods -n prod", agent.Event{ToolCalls: 1, InputTokens: 900, OutputTokens: 50},
+			"running kubectl get pods -n prod · 1 tool call, 950 tokens so far"},
+		{"waiting for model", agent.Event{ToolCalls: 3, InputTokens: 12000, OutputTokens: 400},
+			"waiting for model · 3 tool calls, 12.4k tokens so far"},
+		{"waiting for model", agent.Event{InputTokens: 10}, "waiting for model · 0 tool calls, 10 tokens so far"},
+	}
+	for _, tt := range tests {
+		if got := progressStatus(tt.phase, tt.e); got != tt.want {
+			t.Errorf("progressStatus(%q, %+v) = %q, want %q", tt.phase, tt.e, got, tt.want)
+		}
+	}
+}
+
+func TestTruncateOutput(t *testing.T) {
+	if got := truncateOutput("\n"); got != "(empty)" {
+		t.Errorf("empty output = %q", got)
+	}
+	if got := truncateOutput("a\nb\n"); got != "a\nb" {
+		t.Errorf("short output = %q", got)
+	}
+
+	long := strings.Repeat("line\n", verboseMaxLines+5)
+	got := truncateOutput(long)
+	if lines := strings.Split(got, "\n"); len(lines) != verboseMaxLines+1 {
+		t.Errorf("got %d lines, want %d plus the note", len(lines), verboseMaxLines)
+	}
+	if !strings.HasSuffix(got, "... (25 lines, 124 bytes total)") {
+		t.Errorf("note = %q", got[strings.LastIndex(got, "\n")+1:])
+	}
+
+	wide := strings.Repeat("x", verboseMaxBytes*2)
+	if got := truncateOutput(wide); !strings.HasPrefix(got, wide[:verboseMaxBytes]+"\n... (1 lines") {
+		t.Errorf("wide output not cut at %d bytes", verboseMaxBytes)
+	}
+
+	// Box-drawing characters are 3 bytes; the cut falls inside one
+	box := "x" + strings.Repeat("─", verboseMaxBytes)
+	got = truncateOutput(box)
+	if !utf8.ValidString(got) {
+		t.Errorf("multi-byte output cut mid-rune: %q", got[len(got)-40:])
+	}
+	if want := box[:verboseMaxBytes-1] + "\n... (1 lines"; !strings.HasPrefix(got, want) {
+		t.Errorf("multi-byte output not cut at the last rune boundary before %d bytes", verboseMaxBytes)
+	}
+}
+
+func TestIndentBlock(t *testing.T) {
+	if got := indentBlock("a\nb\n", "  │ "); got != "  │ a\n  │ b" {
+		t.Errorf("indentBlock = %q", got)
+	}
+}
@@ -0,0 +1,290 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/trixsec-dev/trix/internal/llm"
+	"github.com/trixsec-dev/trix/internal/tools/exposure"
+	"github.com/trixsec-dev/trix/internal/tools/kubectl"
+	"github.com/trixsec-dev/trix/internal/tools/trivy"
+	"github.com/trixsec-dev/trix/internal/ui"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const explainPrompt = `You are a Kubernetes security engineer explaining one CVE to a team that runs the affected workloads.
+All the context you get has already been collected from the cluster; you cannot run tools.
+
+Write a short markdown answer with these sections:
+1. What it is - the vulnerability in plain language, two or three sentences
+2. Where it is - which images and workloads are affected
+3. Fix plan - a prioritized list: externally exposed workloads first, then nodePort, internal, and unexposed ones.
+   For each step give the package and the exact fixed version, or say that no fix is available yet and suggest a mitigation.
+
+Be concise. Do not invent versions, images, or workloads that are not in the context.
+NEVER use emojis. NEVER end with a question.`
+
+// explainOptions holds the flags of trix explain
+type explainOptions struct {
+	llm       llmOptions
+	render    renderOptions
+	namespace string
+	noLLM     bool
+	output    string
+}
+
+func newExplainCmd() *cobra.Command {
+	o := &explainOptions{}
+	cmd := &cobra.Command{
+		Use:   "explain <CVE-ID>",
+		Short: "Explain a CVE and where it affects your cluster",
+		Long: `Gather everything trix knows about a CVE: affected images and workloads,
+installed and fixed versions, and the exposure level of each affected workload.
+
+With an LLM provider configured, the gathered context is turned into a short
+plain-language explanation and fix plan using a single model call (no tool
+loop). Without one, or with --no-llm, the context is printed as is.
+
+Examples:
+  trix explain CVE-2024-45337
+  trix explain CVE-2024-45337 -n payments
+  trix explain CVE-2024-45337 -o json`,
+		Args: cobra.ExactArgs(1),
+		RunE: o.run,
+	}
+	cmd.Flags().StringVarP(&o.namespace, "namespace", "n", "", "Only look in this namespace (default: all namespaces)")
+	cmd.Flags().BoolVar(&o.noLLM, "no-llm", false, "Print the gathered context without an LLM explanation")
+	cmd.Flags().StringVarP(&o.output, "output", "o", "", "Output format (json); implies --no-llm")
+	addLLMFlags(cmd, &o.llm)
+	addRenderFlags(cmd, &o.render)
+	return cmd
+}
+
+func (o *explainOptions) run(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	k8sClient, err := kubectl.NewClient()
+	if err != nil {
+		return fmt.Errorf("failed to create k8s client: %w", err)
+	}
+	scanners := newVulnScanners(trivy.NewClient(k8sClient))
+
+	cve, err := explainCVE(ctx, scanners, k8sClient.Clientset(), k8sClient.DynamicClient(), args[0], o.namespace)
+	if err != nil {
+		return err
+	}
+	newClient := func() (llm.Client, error) { return o.llm.createClient(o.llm.model) }
+	return writeExplanation(ctx, os.Stdout, cve, o.output, o.noLLM, newClient, &o.render)
+}
+
+// CVEContext is everything trix knows about one CVE in the cluster
+type CVEContext struct {
+	ID       string         `json:"id"`
+	Title    string         `json:"title"`
+	Severity trivy.Severity `json:"severity"`
+	Score    float64        `json:"score,omitempty"`
+
+	// One entry per affected workload and container, most exposed first
+	Affected []AffectedWorkload `json:"affected"`
+}
+
+// AffectedWorkload is a workload container running a vulnerable package
+type AffectedWorkload struct {
+	Namespace        string `json:"namespace,omitempty"`
+	Kind             string `json:"kind"`
+	Name             string `json:"name"`
+	Container        string `json:"container,omitempty"`
+	Image            string `json:"image,omitempty"`
+	Package          string `json:"package"`
+	InstalledVersion string `json:"installedVersion"`
+	FixedVersion     string `json:"fixedVersion,omitempty"`
+
+	Exposure      exposure.ExposureLevel `json:"exposure,omitempty"`
+	ExposureError string                 `json:"exposureError,omitempty"`
+}
+
+// gatherCVE collects the vulnerability findings for one CVE ID
+func gatherCVE(findings []trivy.Finding, id string) (*CVEContext, error) {
+	cve := &CVEContext{ID: strings.ToUpper(id), Severity: trivy.SeverityUnknown}
+
+	for _, f := range findings {
+		if f.Type != trivy.FindingTypeVulnerability || !strings.EqualFold(f.ID, id) {
+			continue
+		}
+		if cve.Title == "" {
+			cve.Title = f.Title
+		}
+		if f.Severity.Rank() < cve.Severity.Rank() {
+			cve.Severity = f.Severity
+		}
+		if f.Score > cve.Score {
+			cve.Score = f.Score
+		}
+
+		affected := AffectedWorkload{
+			Namespace: f.Namespace,
+			Kind:      f.ResourceKind,
+			Name:      f.ResourceName,
+			Container: f.ContainerName,
+			Image:     imageRef(f),
+		}
+		if v, ok := f.RawData.(trivy.Vulnerability); ok {
+			affected.Package = v.PkgName
+			affected.InstalledVersion = v.InstalledVersion
+			affected.FixedVersion = v.FixedVersion
+		}
+		cve.Affected = append(cve.Affected, affected)
+	}
+
+	if len(cve.Affected) == 0 {
+		return nil, fmt.Errorf("%s not found in any vulnerability report", cve.ID)
+	}
+	return cve, nil
+}
+
+// explainCVE collects the vulnerability findings and gathers the context of one CVE
+func explainCVE(ctx context.Context, scanners []trivy.Scanner, clientset kubernetes.Interface, dynamicClient dynamic.Interface, id, namespace string) (*CVEContext, error) {
+	findings, err := collectFindings(ctx, scanners, namespace, nil)
+	if err != nil {
+		return nil, err
+	}
+	cve, err := gatherCVE(findings, id)
+	if err != nil {
+		return nil, err
+	}
+	cve.checkExposure(ctx, clientset, dynamicClient)
+	return cve, nil
+}
+
+// writeExplanation prints the CVE context as JSON, as plain text, or as an
+// LLM explanation rendered with render. Without a usable LLM the context is
+// the report.
+func writeExplanation(ctx context.Context, w io.Writer, cve *CVEContext, output string, noLLM bool, newClient func() (llm.Client, error), render *renderOptions) error {
+	if output == "json" {
+		jsonData, err := json.MarshalIndent(cve, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		_, _ = fmt.Fprintln(w, string(jsonData))
+		return nil
+	}
+
+	report := cve.String()
+	box := ui.Box(cve.ID, report, 100)
+	if noLLM {
+		_, _ = fmt.Fprintln(w, box)
+		return nil
+	}
+
+	client, err := newClient()
+	if err != nil {
+		_, _ = fmt.Fprintln(w, box)
+		_, _ = fmt.Fprintf(w, "\nNo LLM configured (%v); showing collected context only.\n", err)
+		return nil
+	}
+
+	response, err := complete(ctx, client, "explaining "+cve.ID, explainPrompt, report)
+	if err != nil {
+		_, _ = fmt.Fprintln(w, box)
+		return err
+	}
+	render.fprintResponse(w, response)
+	return nil
+}
+
+// checkExposure sets the exposure level of each affected workload and sorts
+// the list so the most exposed workloads come first
+func (c *CVEContext) checkExposure(ctx context.Context, clientset kubernetes.Interface, dynamicClient dynamic.Interface) {
+	levels := make(map[string]*exposure.Result)
+	errs := make(map[string]string)
+
+	for i := range c.Affected {
+		a := &c.Affected[i]
+		key := a.Kind + "/" + a.Namespace + "/" + a.Name
+		if _, done := levels[key]; !done {
+			result, err := analyzeExposure(ctx, clientset, dynamicClient, a.Kind, a.Name, a.Namespace)
+			levels[key] = result
+			if err != nil {
+				errs[key] = err.Error()
+			}
+		}
+		if result := levels[key]; result != nil {
+			a.Exposure = result.Level
+		}
+		a.ExposureError = errs[key]
+	}
+
+	sort.SliceStable(c.Affected, func(i, j int) bool {
+		return c.Affected[i].Exposure.Rank() < c.Affected[j].Exposure.Rank()
+	})
+}
+
+// String renders the CVE context as plain text. The same text is shown
+// without an LLM and sent to the LLM as context.
+func (c *CVEContext) String() string {
+	var b strings.Builder
+
+	b.WriteString(fmt.Sprintf("CVE:      %s\n", c.ID))
+	b.WriteString(fmt.Sprintf("Title:    %s\n", c.Title))
+	b.WriteString(fmt.Sprintf("Severity: %s", c.Severity))
+	if c.Score > 0 {
+		b.WriteString(fmt.Sprintf(" (CVSS %.1f)", c.Score))
+	}
+	b.WriteString("\n")
+
+	// Fixes, deduplicated per package version
+	b.WriteString("\nFix\n")
+	seen := make(map[string]bool)
+	for _, a := range c.Affected {
+		key := a.Package + "@" + a.InstalledVersion
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if a.FixedVersion != "" {
+			b.WriteString(fmt.Sprintf("  %s %s -> %s\n", a.Package, a.InstalledVersion, a.FixedVersion))
+		} else {
+			b.WriteString(fmt.Sprintf("  %s %s -> no fixed version available\n", a.Package, a.InstalledVersion))
+		}
+	}
+
+	b.WriteString(fmt.Sprintf("\nAffected workloads (%d)\n", len(c.Affected)))
+	for _, a := range c.Affected {
+		exposed := string(a.Exposure)
+		if exposed == "" {
+			exposed = "unknown"
+		}
+		name := a.Name
+		if a.Namespace != "" {
+			name = a.Namespace + "/" + a.Name
+		}
+		line := fmt.Sprintf("  %-16s %s %s", exposed, a.Kind, name)
+		if a.Container != "" {
+			line += fmt.Sprintf(" [%s]", a.Container)
+		}
+		if a.Image != "" {
+			line += " " + a.Image
+		}
+		b.WriteString(line + "\n")
+	}
+
+	return b.String()
+}
+
+// imageRef returns repository:tag for a finding, or "" if unknown
+func imageRef(f trivy.Finding) string {
+	if f.ImageRepository == "" {
+		return ""
+	}
+	if f.ImageTag == "" {
+		return f.ImageRepository
+	}
+	return f.ImageRepository + ":" + f.ImageTag
+}
@@ -0,0 +1,219 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/trixsec-dev/trix/internal/llm"
+	"github.com/trixsec-dev/trix/internal/tools/exposure"
+	"github.com/trixsec-dev/trix/internal/tools/trivy"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// explainFixture is one CVE on four workloads with different exposure
+func explainFixture() ([]trivy.Finding, []runtime.Object) {
+	findings := []trivy.Finding{
+		cveFinding("CVE-2024-45337", trivy.SeverityHigh, "batch", "Pod", "report", "golang.org/x/crypto", "0.30.0", "0.31.0"),
+		cveFinding("CVE-2024-45337", trivy.SeverityCritical, "shop", "Deployment", "web", "golang.org/x/crypto", "0.30.0", "0.31.0"),
+		cveFinding("CVE-2024-45337", trivy.SeverityHigh, "payments", "Deployment", "api", "golang.org/x/crypto", "0.29.0", "0.31.0"),
+		cveFinding("CVE-2024-45337", trivy.SeverityHigh, "", "Node", "node-1", "golang.org/x/crypto", "0.29.0", ""),
+		cveFinding("CVE-2024-0001", trivy.SeverityLow, "shop", "Deployment", "web", "zlib", "1.2.11", "1.2.12"),
+		// Same ID from another scanner is not a vulnerability finding
+		{ID: "CVE-2024-45337", Type: trivy.FindingTypeCompliance, Severity: trivy.SeverityLow, Namespace: "shop",
+			ResourceKind: "Deployment", ResourceName: "other"},
+	}
+	findings[1].Score = 9.1
+	findings[2].Score = 7.5
+	findings[0].Title = "golang.org/x/crypto: misuse of ServerConfig.PublicKeyCallback"
+
+	objects := exposedDeployment("payments", "api")
+	objects = append(objects, exposedDeployment("shop", "web")...)
+	// web is behind a NodePort, not a LoadBalancer
+	svc := objects[len(objects)-1].(*corev1.Service)
+	svc.Spec.Type = corev1.ServiceTypeNodePort
+	objects = append(objects, &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "report", Namespace: "batch", Labels: map[string]string{"job": "report"}},
+	})
+	return findings, objects
+}
+
+func TestGatherCVE(t *testing.T) {
+	findings, _ := explainFixture()
+	cve, err := gatherCVE(findings, "cve-2024-45337")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cve.ID != "CVE-2024-45337" || cve.Severity != trivy.SeverityCritical || cve.Score != 9.1 {
+		t.Errorf("cve = %s %s %.1f, want the highest severity and score", cve.ID, cve.Severity, cve.Score)
+	}
+	if cve.Title != "golang.org/x/crypto: misuse of ServerConfig.PublicKeyCallback" {
+		t.Errorf("title = %q", cve.Title)
+	}
+	if len(cve.Affected) != 4 {
+		t.Fatalf("affected = %+v, want the 4 vulnerability findings", cve.Affected)
+	}
+	api := cve.Affected[2]
+	want := AffectedWorkload{
+		Namespace: "payments", Kind: "Deployment", Name: "api", Container: "app", Image: "ghcr.io/acme/api:1.0",
+		Package: "golang.org/x/crypto", InstalledVersion: "0.29.0", FixedVersion: "0.31.0",
+	}
+	if api != want {
+		t.Errorf("affected api = %+v, want %+v", api, want)
+	}
+
+	if _, err := gatherCVE(findings, "CVE-1999-0001"); err == nil || err.Error() != "CVE-1999-0001 not found in any vulnerability report" {
+		t.Errorf("unknown CVE err = %v", err)
+	}
+}
+
+func TestExplainCVE(t *testing.T) {
+	findings, objects := explainFixture()
+	clientset, dyn := fakeCluster(objects...)
+	scanners := []trivy.Scanner{fakeScanner{findings: findings}}
+
+	cve, err := explainCVE(context.Background(), scanners, clientset, dyn, "CVE-2024-45337", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Most exposed first; workloads the analyzer can't resolve come last
+	var order []string
+	for _, a := range cve.Affected {
+		order = append(order, a.Name+"="+string(a.Exposure))
+	}
+	want := "api=external web=nodePort report=none node-1="
+	if got := strings.Join(order, " "); got != want {
+		t.Errorf("affected = %s, want %s", got, want)
+	}
+	if e := cve.Affected[3].ExposureError; e != "exposure not applicable to Node resources" {
+		t.Errorf("node exposure error = %q", e)
+	}
+
+	cve, err = explainCVE(context.Background(), scanners, clientset, dyn, "CVE-2024-45337", "shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cve.Affected) != 1 || cve.Affected[0].Exposure != exposure.ExposureLevelNodePort {
+		t.Errorf("-n shop affected = %+v", cve.Affected)
+	}
+	if _, err := explainCVE(context.Background(), scanners, clientset, dyn, "CVE-2024-45337", "kube-system"); err == nil {
+		t.Error("CVE found in a namespace without it")
+	}
+}
+
+func TestCVEContextString(t *testing.T) {
+	findings, objects := explainFixture()
+	clientset, dyn := fakeCluster(objects...)
+	cve, err := explainCVE(context.Background(), []trivy.Scanner{fakeScanner{findings: findings}}, clientset, dyn, "CVE-2024-45337", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `CVE:      CVE-2024-45337
+Title:    golang.org/x/crypto: misuse of ServerConfig.PublicKeyCallback
+Severity: CRITICAL (CVSS 9.1)
+
+Fix
+  golang.org/x/crypto 0.29.0 -> 0.31.0
+  golang.org/x/crypto 0.30.0 -> 0.31.0
+
+Affected workloads (4)
+  external         Deployment payments/api [app] ghcr.io/acme/api:1.0
+  nodePort         Deployment shop/web [app] ghcr.io/acme/web:1.0
+  none             Pod batch/report [app] ghcr.io/acme/report:1.0
+  unknown          Node node-1 [app] ghcr.io/acme/node-1:1.0
+`
+	if got := cve.String(); got != want {
+		t.Errorf("String() =\n%s\nwant\n%s", got, want)
+	}
+
+	unfixed := &CVEContext{ID: "CVE-1", Severity: trivy.SeverityLow, Affected: []AffectedWorkload{
+		{Kind: "Pod", Name: "p", Package: "zlib", InstalledVersion: "1.2.11"},
+	}}
+	if got := unfixed.String(); !strings.Contains(got, "Severity: LOW\n") || !strings.Contains(got, "  zlib 1.2.11 -> no fixed version available\n") {
+		t.Errorf("unfixed String() =\n%s", got)
+	}
+}
+
+func TestWriteExplanationWithoutLLM(t *testing.T) {
+	findings, _ := explainFixture()
+	cve, err := gatherCVE(findings, "CVE-2024-45337")
+	if err != nil {
+		t.Fatal(err)
+	}
+	noClient := func() (llm.Client, error) {
+		t.Error("LLM client requested without an LLM")
+		return nil, errors.New("unexpected")
+	}
+
+	var out strings.Builder
+	if err := writeExplanation(context.Background(), &out, cve, "json", false, noClient, nil); err != nil {
+		t.Fatal(err)
+	}
+	var decoded CVEContext
+	if err := json.Unmarshal([]byte(out.String()), &decoded); err != nil {
+		t.Fatalf("JSON output: %v\n%s", err, out.String())
+	}
+	if decoded.ID != "CVE-2024-45337" || len(decoded.Affected) != 4 || decoded.Affected[0].FixedVersion != "0.31.0" {
+		t.Errorf("decoded = %+v", decoded)
+	}
+
+	out.Reset()
+	if err := writeExplanation(context.Background(), &out, cve, "", true, noClient, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "golang.org/x/crypto 0.29.0 -> 0.31.0") {
+		t.Errorf("--no-llm output:\n%s", out.String())
+	}
+
+	out.Reset()
+	noProvider := func() (llm.Client, error) { return nil, errors.New("no provider configured") }
+	if err := writeExplanation(context.Background(), &out, cve, "", false, noProvider, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); !strings.Contains(got, "Affected workloads (4)") ||
+		!strings.HasSuffix(got, "\nNo LLM configured (no provider configured); showing collected context only.\n") {
+		t.Errorf("fallback output:\n%s", got)
+	}
+}
+
+// The explanation is one bounded call with the gathered context, not a tool loop
+func TestWriteExplanationPrompt(t *testing.T) {
+	findings, _ := explainFixture()
+	cve, err := gatherCVE(findings, "CVE-2024-45337")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &scriptedClient{model: "gpt-4o", answers: []string{"Upgrade golang.org/x/crypto to 0.31.0."}}
+
+	var out strings.Builder
+	if err := writeExplanation(context.Background(), &out, cve, "", false, func() (llm.Client, error) { return client, nil }, nil); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "Upgrade golang.org/x/crypto to 0.31.0.\n" {
+		t.Errorf("output = %q", out.String())
+	}
+	if len(client.messages) != 1 {
+		t.Fatalf("model called %d times, want 1", len(client.messages))
+	}
+	msgs := client.messages[0]
+	if len(msgs) != 2 || msgs[0].Role != llm.RoleSystem || msgs[0].Content != explainPrompt ||
+		msgs[1].Role != llm.RoleUser || msgs[1].Content != cve.String() {
+		t.Errorf("messages = %+v", msgs)
+	}
+
+	out.Reset()
+	broken := &scriptedClient{model: "gpt-4o"}
+	if err := writeExplanation(context.Background(), &out, cve, "", false, func() (llm.Client, error) { return broken, nil }, nil); err == nil {
+		t.Error("LLM failure not reported")
+	}
+	if !strings.Contains(out.String(), "Affected workloads (4)") {
+		t.Errorf("context not shown after an LLM failure:\n%s", out.String())
+	}
+}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/trixsec-dev/trix/internal/tools/exposure"
+	"github.com/trixsec-dev/trix/internal/tools/trivy"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// newScanners returns every scanner that contributes to the unified findings view
+func newScanners(trivyClient *trivy.Client) []trivy.Scanner {
+	return []trivy.Scanner{
+		// Namespaced scanners
+		trivy.NewTrivyVulnScanner(trivyClient),
+		trivy.NewTrivyComplianceScanner(trivyClient),
+		trivy.NewTrivySecretScanner(trivyClient),
+		trivy.NewTrivyRbacScanner(trivyClient),
+		trivy.NewTrivyInfraScanner(trivyClient),
+		// Cluster-scoped scanners
+		trivy.NewClusterVulnScanner(trivyClient),
+		trivy.NewClusterComplianceScanner(trivyClient),
+		trivy.NewClusterRbacScanner(trivyClient),
+		trivy.NewClusterInfraScanner(trivyClient),
+		// Benchmark scanner (CIS/NSA)
+		trivy.NewBenchmarkScanner(trivyClient),
+	}
+}
+
+// newVulnScanners returns only the scanners that report CVEs
+func newVulnScanners(trivyClient *trivy.Client) []trivy.Scanner {
+	return []trivy.Scanner{
+		trivy.NewTrivyVulnScanner(trivyClient),
+		trivy.NewClusterVulnScanner(trivyClient),
+	}
+}
+
+// collectFindings runs the scanners and returns the combined findings.
+// A failing scanner is skipped so one missing CRD doesn't hide the rest;
+// it is an error only when every scanner fails, e.g. with no cluster access.
+// When ctx is cancelled it returns the findings so far with ctx's error.
+// A non-nil progress is called with a nil error as each scanner starts, and
+// again with the error when that scanner fails.
+func collectFindings(ctx context.Context, scanners []trivy.Scanner, ns string, progress func(scanner string, err error)) ([]trivy.Finding, error) {
+	var allFindings []trivy.Finding
+	var errs []error
+	for _, scanner := range scanners {
+		if err := ctx.Err(); err != nil {
+			return allFindings, err
+		}
+		if progress != nil {
+			progress(scanner.Name(), nil)
+		}
+		findings, err := scanner.Scan(ctx, ns)
+		if err != nil {
+			if ctx.Err() != nil {
+				return allFindings, ctx.Err()
+			}
+			if progress != nil {
+				progress(scanner.Name(), err)
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", scanner.Name(), err))
+			continue
+		}
+		allFindings = append(allFindings, findings...)
+	}
+	if len(scanners) > 0 && len(errs) == len(scanners) {
+		return nil, fmt.Errorf("all scanners failed: %w", errors.Join(errs...))
+	}
+	return allFindings, nil
+}
+
+// Workload kinds the exposure analyzer can resolve
+var exposureKinds = map[string]bool{
+	"Deployment": true, "ReplicaSet": true, "DaemonSet": true, "StatefulSet": true, "Pod": true,
+}
+
+// analyzeExposure runs the exposure analyzer for the resource a finding is on
+func analyzeExposure(ctx context.Context, clientset kubernetes.Interface, dynamicClient dynamic.Interface, kind, name, namespace string) (*exposure.Result, error) {
+	if namespace == "" || !exposureKinds[kind] {
+		return nil, fmt.Errorf("exposure not applicable to %s resources", kind)
+	}
+
+	workload, err := exposure.ResolveWorkload(ctx, clientset, kind, name, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workload: %w", err)
+	}
+	result, err := exposure.NewDefaultAnalyzer(clientset, dynamicClient).Analyze(ctx, workload)
+	if err != nil {
+		return nil, fmt.Errorf("exposure analysis failed: %w", err)
+	}
+	return result, nil
+}
+
+// resourceKey returns namespace/name, or just name for cluster-scoped resources
+func resourceKey(f trivy.Finding) string {
+	if f.Namespace == "" {
+		return f.ResourceName
+	}
+	return f.Namespace + "/" + f.ResourceName
+}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/trixsec-dev/trix/internal/tools/trivy"
+)
+
+// blockingScanner waits for ctx to be cancelled, closing started first
+type blockingScanner struct {
+	started chan struct{}
+}
+
+func (s blockingScanner) Name() string { return "blocking" }
+
+func (s blockingScanner) Scan(ctx context.Context, namespace string) ([]trivy.Finding, error) {
+	close(s.started)
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestCollectFindings(t *testing.T) {
+	ok := fakeScanner{findings: []trivy.Finding{{ID: "CVE-1"}, {ID: "CVE-2"}}}
+	broken := fakeScanner{err: errors.New("the server could not find the requested resource")}
+
+	var events []string
+	progress := func(scanner string, err error) {
+		if err != nil {
+			scanner += " failed"
+		}
+		events = append(events, scanner)
+	}
+	findings, err := collectFindings(context.Background(), []trivy.Scanner{broken, ok}, "", progress)
+	if err != nil || len(findings) != 2 {
+		t.Errorf("one scanner failing: %d findings, %v", len(findings), err)
+	}
+	if want := []string{"fake", "fake failed", "fake"}; !reflect.DeepEqual(events, want) {
+		t.Errorf("progress = %q, want %q", events, want)
+	}
+
+	_, err = collectFindings(context.Background(), []trivy.Scanner{broken, broken}, "", nil)
+	if err == nil || !strings.HasPrefix(err.Error(), "all scanners failed: fake: the server could not find") {
+		t.Errorf("every scanner failing: err = %v", err)
+	}
+}
+
+// A cancelled scan stops promptly and keeps what earlier scanners found
+func TestCollectFindingsCancelled(t *testing.T) {
+	first := fakeScanner{findings: []trivy.Finding{{ID: "CVE-1"}}}
+	slow := blockingScanner{started: make(chan struct{})}
+	last := fakeScanner{findings: []trivy.Finding{{ID: "SECRET-1"}}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-slow.started
+		cancel()
+	}()
+
+	done := make(chan struct{})
+	var findings []trivy.Finding
+	var err error
+	go func() {
+		defer close(done)
+		findings, err = collectFindings(ctx, []trivy.Scanner{first, slow, last}, "", nil)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("collectFindings did not return after cancellation")
+	}
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if len(findings) != 1 || findings[0].ID != "CVE-1" {
+		t.Errorf("findings = %+v, want only those before the cancelled scanner", findings)
+	}
+
+	// Already cancelled: nothing runs
+	unstarted := blockingScanner{started: make(chan struct{})}
+	if _, err := collectFindings(ctx, []trivy.Scanner{unstarted}, "", nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled before the first scanner: err = %v", err)
+	}
+	select {
+	case <-unstarted.started:
+		t.Error("scanner run after cancellation")
+	default:
+	}
+}
@@ -0,0 +1,280 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/trixsec-dev/trix/internal/llm"
+	"github.com/trixsec-dev/trix/internal/tools/exposure"
+	"github.com/trixsec-dev/trix/internal/tools/kubectl"
+	"github.com/trixsec-dev/trix/internal/tools/trivy"
+	"github.com/trixsec-dev/trix/internal/ui"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Limit for related findings listed in text output and sent to the LLM
+const maxRelatedFindings = 15
+
+const investigatePrompt = `You are a Kubernetes security engineer writing a remediation note for one finding.
+All the context you get has already been collected from the cluster; you cannot run tools.
+
+Write a short markdown report with these sections:
+1. Summary - what the issue is, in one or two sentences a non-expert understands
+2. Risk - how urgent it is, taking the exposure level into account (external > nodePort > internal > none)
+3. Fix - concrete steps: the version to upgrade to, the image to rebuild, or the manifest change to make
+4. Related issues - only if other findings on the same resource are fixed by the same change
+
+Be concise and specific. Do not invent versions or resources that are not in the context.
+NEVER use emojis. NEVER end with a question.`
+
+// investigateOptions holds the flags of trix investigate
+type investigateOptions struct {
+	llm       llmOptions
+	render    renderOptions
+	namespace string
+	resource  string
+	noLLM     bool
+	output    string
+}
+
+func newInvestigateCmd() *cobra.Command {
+	o := &investigateOptions{}
+	cmd := &cobra.Command{
+		Use:   "investigate <finding-id>",
+		Short: "Run a guided investigation of a single finding",
+		Long: `Investigate a finding by ID (as shown by 'trix query findings').
+
+trix looks up the finding, checks whether the affected workload is exposed,
+collects other findings on the same resource, and looks up the fixed version.
+If an LLM provider is configured the collected context is turned into a
+remediation write-up; otherwise (or with --no-llm) the context is printed as is.
+
+Examples:
+  trix investigate CVE-2024-45337
+  trix investigate CVE-2024-45337 -n payments --resource api-7d9f8c
+  trix investigate KSV014 --no-llm -o json`,
+		Args: cobra.ExactArgs(1),
+		RunE: o.run,
+	}
+	cmd.Flags().StringVarP(&o.namespace, "namespace", "n", "", "Only look for the finding in this namespace (default: all namespaces)")
+	cmd.Flags().StringVar(&o.resource, "resource", "", "Resource name, when the finding affects several resources")
+	cmd.Flags().BoolVar(&o.noLLM, "no-llm", false, "Print the collected context without an LLM write-up")
+	cmd.Flags().StringVarP(&o.output, "output", "o", "", "Output format (json); implies --no-llm")
+	addLLMFlags(cmd, &o.llm)
+	addRenderFlags(cmd, &o.render)
+	return cmd
+}
+
+func (o *investigateOptions) run(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	k8sClient, err := kubectl.NewClient()
+	if err != nil {
+		return fmt.Errorf("failed to create k8s client: %w", err)
+	}
+	scanners := newScanners(trivy.NewClient(k8sClient))
+
+	inv, err := investigate(ctx, scanners, k8sClient.Clientset(), k8sClient.DynamicClient(),
+		args[0], o.namespace, o.resource)
+	if err != nil {
+		return err
+	}
+	newClient := func() (llm.Client, error) { return o.llm.createClient(o.llm.model) }
+	return writeInvestigation(ctx, os.Stdout, inv, o.output, o.noLLM, newClient, &o.render)
+}
+
+// Investigation is the context collected for a single finding
+type Investigation struct {
+	Finding trivy.Finding `json:"finding"`
+
+	// Vulnerability details, when the finding is a CVE
+	Package          string `json:"package,omitempty"`
+	InstalledVersion string `json:"installedVersion,omitempty"`
+	FixedVersion     string `json:"fixedVersion,omitempty"`
+
+	Exposure      *exposure.Result `json:"exposure,omitempty"`
+	ExposureError string           `json:"exposureError,omitempty"`
+
+	// Other findings on the same resource, most severe first
+	Related []trivy.Finding `json:"related"`
+
+	// Other resources with the same finding ID (namespace/name)
+	AlsoAffects []string `json:"alsoAffects,omitempty"`
+}
+
+// buildInvestigation picks the finding to investigate and gathers related
+// findings. If the ID matches several resources and resource is empty, the
+// most severe match is used and the others are listed in AlsoAffects.
+func buildInvestigation(findings []trivy.Finding, id, resource string) (*Investigation, error) {
+	var matches []trivy.Finding
+	for _, f := range findings {
+		if !strings.EqualFold(f.ID, id) {
+			continue
+		}
+		if resource != "" && !strings.EqualFold(f.ResourceName, resource) {
+			continue
+		}
+		matches = append(matches, f)
+	}
+	if len(matches) == 0 {
+		if resource != "" {
+			return nil, fmt.Errorf("finding %s not found on resource %s", id, resource)
+		}
+		return nil, fmt.Errorf("finding %s not found (list IDs with 'trix query findings -A')", id)
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Severity.Rank() < matches[j].Severity.Rank()
+	})
+	target := matches[0]
+
+	inv := &Investigation{Finding: target, Related: []trivy.Finding{}}
+	if v, ok := target.RawData.(trivy.Vulnerability); ok {
+		inv.Package = v.PkgName
+		inv.InstalledVersion = v.InstalledVersion
+		inv.FixedVersion = v.FixedVersion
+	}
+
+	seen := map[string]bool{resourceKey(target): true}
+	for _, m := range matches[1:] {
+		if key := resourceKey(m); !seen[key] {
+			seen[key] = true
+			inv.AlsoAffects = append(inv.AlsoAffects, key)
+		}
+	}
+
+	for _, f := range findings {
+		if f.ID == target.ID || resourceKey(f) != resourceKey(target) {
+			continue
+		}
+		f.RawData = nil
+		inv.Related = append(inv.Related, f)
+	}
+	sort.SliceStable(inv.Related, func(i, j int) bool {
+		return inv.Related[i].Severity.Rank() < inv.Related[j].Severity.Rank()
+	})
+
+	inv.Finding.RawData = nil
+	return inv, nil
+}
+
+// investigate collects the findings and builds the investigation of one of them
+func investigate(ctx context.Context, scanners []trivy.Scanner, clientset kubernetes.Interface, dynamicClient dynamic.Interface, id, namespace, resource string) (*Investigation, error) {
+	findings, err := collectFindings(ctx, scanners, namespace, nil)
+	if err != nil {
+		return nil, err
+	}
+	inv, err := buildInvestigation(findings, id, resource)
+	if err != nil {
+		return nil, err
+	}
+	inv.checkExposure(ctx, clientset, dynamicClient)
+	return inv, nil
+}
+
+// writeInvestigation prints the investigation as JSON, as the collected
+// context, or as an LLM write-up. Without a usable LLM the context is the report.
+func writeInvestigation(ctx context.Context, w io.Writer, inv *Investigation, output string, noLLM bool, newClient func() (llm.Client, error), render *renderOptions) error {
+	if output == "json" {
+		jsonData, err := json.MarshalIndent(inv, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		_, _ = fmt.Fprintln(w, string(jsonData))
+		return nil
+	}
+
+	report := inv.String()
+	box := ui.Box("Investigation: "+inv.Finding.ID, report, 100)
+	if noLLM {
+		_, _ = fmt.Fprintln(w, box)
+		return nil
+	}
+
+	client, err := newClient()
+	if err != nil {
+		// No provider configured: the collected context is the report
+		_, _ = fmt.Fprintln(w, box)
+		_, _ = fmt.Fprintf(w, "\nNo LLM configured (%v); showing collected context only.\n", err)
+		return nil
+	}
+
+	response, err := complete(ctx, client, "writing remediation report", investigatePrompt, report)
+	if err != nil {
+		_, _ = fmt.Fprintln(w, box)
+		return err
+	}
+	render.fprintResponse(w, response)
+	return nil
+}
+
+// checkExposure runs the exposure analyzer for the affected workload
+func (inv *Investigation) checkExposure(ctx context.Context, clientset kubernetes.Interface, dynamicClient dynamic.Interface) {
+	f := inv.Finding
+	result, err := analyzeExposure(ctx, clientset, dynamicClient, f.ResourceKind, f.ResourceName, f.Namespace)
+	if err != nil {
+		inv.ExposureError = err.Error()
+		return
+	}
+	inv.Exposure = result
+}
+
+// String renders the investigation as plain text. The same text is shown
+// without an LLM and sent to the LLM as context.
+func (inv *Investigation) String() string {
+	var b strings.Builder
+	f := inv.Finding
+
+	b.WriteString(fmt.Sprintf("Finding:   %s (%s, %s)\n", f.ID, f.Severity, f.Type))
+	b.WriteString(fmt.Sprintf("Title:     %s\n", f.Title))
+	b.WriteString(fmt.Sprintf("Resource:  %s %s\n", f.ResourceKind, resourceKey(f)))
+	if f.ContainerName != "" {
+		b.WriteString(fmt.Sprintf("Container: %s\n", f.ContainerName))
+	}
+	if image := imageRef(f); image != "" {
+		b.WriteString(fmt.Sprintf("Image:     %s\n", image))
+	}
+	if f.Description != "" {
+		b.WriteString("\n" + f.Description + "\n")
+	}
+
+	b.WriteString("\nFix\n")
+	switch {
+	case inv.Package != "" && inv.FixedVersion != "":
+		b.WriteString(fmt.Sprintf("  Upgrade %s from %s to %s\n", inv.Package, inv.InstalledVersion, inv.FixedVersion))
+	case inv.Package != "":
+		b.WriteString(fmt.Sprintf("  No fixed version of %s is available yet (installed: %s)\n", inv.Package, inv.InstalledVersion))
+	case f.Remediation != "":
+		b.WriteString("  " + f.Remediation + "\n")
+	default:
+		b.WriteString("  No remediation provided by the scanner\n")
+	}
+
+	b.WriteString("\nExposure\n")
+	if inv.Exposure != nil {
+		b.WriteString(fmt.Sprintf("  Level: %s\n  %s\n", inv.Exposure.Level, inv.Exposure.Summary))
+	} else {
+		b.WriteString(fmt.Sprintf("  Unknown: %s\n", inv.ExposureError))
+	}
+
+	b.WriteString(fmt.Sprintf("\nOther findings on this resource (%d)\n", len(inv.Related)))
+	for i, r := range inv.Related {
+		if i >= maxRelatedFindings {
+			b.WriteString(fmt.Sprintf("  ... and %d more\n", len(inv.Related)-maxRelatedFindings))
+			break
+		}
+		b.WriteString(fmt.Sprintf("  %-8s %-16s %s\n", r.Severity, r.ID, r.Title))
+	}
+
+	if len(inv.AlsoAffects) > 0 {
+		b.WriteString(fmt.Sprintf("\nAlso found on: %s\n", strings.Join(inv.AlsoAffects, ", ")))
+	}
+	return b.String()
+}
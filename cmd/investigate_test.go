@@ -0,0 +1,314 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/trixsec-dev/trix/internal/llm"
+	"github.com/trixsec-dev/trix/internal/tools/exposure"
+	"github.com/trixsec-dev/trix/internal/tools/trivy"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+// fakeScanner returns fixed findings, or fails
+type fakeScanner struct {
+	findings []trivy.Finding
+	err      error
+}
+
+func (s fakeScanner) Name() string { return "fake" }
+
+func (s fakeScanner) Scan(ctx context.Context, namespace string) ([]trivy.Finding, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	var found []trivy.Finding
+	for _, f := range s.findings {
+		if namespace == "" || f.Namespace == namespace {
+			found = append(found, f)
+		}
+	}
+	return found, nil
+}
+
+// fakeCluster returns fake clients serving the given objects. The dynamic
+// client knows the Gateway API kinds the exposure analyzer lists.
+func fakeCluster(objects ...runtime.Object) (*k8sfake.Clientset, *dynamicfake.FakeDynamicClient) {
+	listKinds := map[schema.GroupVersionResource]string{
+		{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "httproutes"}:      "HTTPRouteList",
+		{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "grpcroutes"}:      "GRPCRouteList",
+		{Group: "gateway.networking.k8s.io", Version: "v1alpha2", Resource: "udproutes"}: "UDPRouteList",
+		{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "gateways"}:        "GatewayList",
+	}
+	return k8sfake.NewSimpleClientset(objects...),
+		dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds)
+}
+
+// exposedDeployment is a Deployment behind a LoadBalancer Service
+func exposedDeployment(namespace, name string) []runtime.Object {
+	labels := map[string]string{"app": name}
+	return []runtime.Object{
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:       appsv1.DeploymentSpec{Selector: &metav1.LabelSelector{MatchLabels: labels}},
+		},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: name + "-lb", Namespace: namespace},
+			Spec: corev1.ServiceSpec{
+				Type:     corev1.ServiceTypeLoadBalancer,
+				Selector: labels,
+				Ports:    []corev1.ServicePort{{Port: 443}},
+			},
+		},
+	}
+}
+
+func cveFinding(id string, sev trivy.Severity, ns, kind, name, pkg, installed, fixed string) trivy.Finding {
+	return trivy.Finding{
+		ID: id, Type: trivy.FindingTypeVulnerability, Severity: sev,
+		Namespace: ns, ResourceKind: kind, ResourceName: name,
+		ContainerName: "app", ImageRepository: "ghcr.io/acme/" + name, ImageTag: "1.0",
+		Title: pkg + ": " + id,
+		RawData: trivy.Vulnerability{
+			VulnerabilityID: id, PkgName: pkg, InstalledVersion: installed, FixedVersion: fixed,
+		},
+	}
+}
+
+func investigationFindings() []trivy.Finding {
+	return []trivy.Finding{
+		cveFinding("CVE-2024-0001", trivy.SeverityHigh, "shop", "Deployment", "web", "openssl", "3.0.1", "3.0.8"),
+		cveFinding("CVE-2024-0001", trivy.SeverityCritical, "payments", "Deployment", "api", "openssl", "3.0.1", "3.0.8"),
+		cveFinding("CVE-2024-0002", trivy.SeverityLow, "payments", "Deployment", "api", "zlib", "1.2.11", ""),
+		cveFinding("CVE-2024-0003", trivy.SeverityCritical, "payments", "Deployment", "api", "curl", "7.1", "7.2"),
+		{ID: "KSV014", Type: trivy.FindingTypeCompliance, Severity: trivy.SeverityMedium, Namespace: "payments",
+			ResourceKind: "Deployment", ResourceName: "api", Title: "Root file system is not read-only",
+			Remediation: "Set readOnlyRootFilesystem to true"},
+		cveFinding("CVE-2024-0004", trivy.SeverityHigh, "payments", "Deployment", "worker", "glibc", "2.31", "2.32"),
+	}
+}
+
+func TestBuildInvestigation(t *testing.T) {
+	inv, err := buildInvestigation(investigationFindings(), "cve-2024-0001", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The most severe match is investigated; the other resource is listed
+	if key := resourceKey(inv.Finding); key != "payments/api" {
+		t.Errorf("investigated %s, want payments/api", key)
+	}
+	if inv.Package != "openssl" || inv.InstalledVersion != "3.0.1" || inv.FixedVersion != "3.0.8" {
+		t.Errorf("fix = %s %s -> %s", inv.Package, inv.InstalledVersion, inv.FixedVersion)
+	}
+	if !reflect.DeepEqual(inv.AlsoAffects, []string{"shop/web"}) {
+		t.Errorf("AlsoAffects = %v", inv.AlsoAffects)
+	}
+
+	// Related findings are on the same resource, most severe first, without raw data
+	var related []string
+	for _, r := range inv.Related {
+		related = append(related, r.ID)
+		if r.RawData != nil {
+			t.Errorf("%s keeps its raw data", r.ID)
+		}
+	}
+	if want := []string{"CVE-2024-0003", "KSV014", "CVE-2024-0002"}; !reflect.DeepEqual(related, want) {
+		t.Errorf("related = %v, want %v", related, want)
+	}
+	if inv.Finding.RawData != nil {
+		t.Error("investigated finding keeps its raw data")
+	}
+
+	// A resource picks one of several matches
+	inv, err = buildInvestigation(investigationFindings(), "CVE-2024-0001", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resourceKey(inv.Finding) != "shop/web" || len(inv.AlsoAffects) != 0 || len(inv.Related) != 0 {
+		t.Errorf("--resource web investigated %s, also %v, related %v", resourceKey(inv.Finding), inv.AlsoAffects, inv.Related)
+	}
+}
+
+func TestBuildInvestigationNotFound(t *testing.T) {
+	if _, err := buildInvestigation(investigationFindings(), "CVE-1999-0001", ""); err == nil ||
+		err.Error() != "finding CVE-1999-0001 not found (list IDs with 'trix query findings -A')" {
+		t.Errorf("unknown ID err = %v", err)
+	}
+	if _, err := buildInvestigation(investigationFindings(), "CVE-2024-0001", "worker"); err == nil ||
+		err.Error() != "finding CVE-2024-0001 not found on resource worker" {
+		t.Errorf("wrong resource err = %v", err)
+	}
+}
+
+func TestInvestigate(t *testing.T) {
+	scanners := []trivy.Scanner{fakeScanner{err: errors.New("no CRD")}, fakeScanner{findings: investigationFindings()}}
+	clientset, dyn := fakeCluster(exposedDeployment("payments", "api")...)
+
+	inv, err := investigate(context.Background(), scanners, clientset, dyn, "CVE-2024-0001", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inv.Exposure == nil || inv.Exposure.Level != exposure.ExposureLevelExternal {
+		t.Fatalf("exposure = %+v, %q; want external", inv.Exposure, inv.ExposureError)
+	}
+
+	// The namespace limits the search
+	inv, err = investigate(context.Background(), scanners, clientset, dyn, "CVE-2024-0001", "shop", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resourceKey(inv.Finding) != "shop/web" {
+		t.Errorf("-n shop investigated %s", resourceKey(inv.Finding))
+	}
+	// The workload is not in the cluster
+	if inv.Exposure != nil || !strings.HasPrefix(inv.ExposureError, "failed to get workload") {
+		t.Errorf("missing workload exposure = %+v, %q", inv.Exposure, inv.ExposureError)
+	}
+
+	failing := []trivy.Scanner{fakeScanner{err: errors.New("forbidden")}}
+	if _, err := investigate(context.Background(), failing, clientset, dyn, "CVE-2024-0001", "", ""); err == nil ||
+		!strings.HasPrefix(err.Error(), "all scanners failed") {
+		t.Errorf("failing scanners err = %v", err)
+	}
+}
+
+func TestInvestigationString(t *testing.T) {
+	clientset, dyn := fakeCluster(exposedDeployment("payments", "api")...)
+	inv, err := investigate(context.Background(), []trivy.Scanner{fakeScanner{findings: investigationFindings()}},
+		clientset, dyn, "CVE-2024-0001", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := inv.String()
+	for _, want := range []string{
+		"Finding:   CVE-2024-0001 (CRITICAL, vulnerability)\n",
+		"Resource:  Deployment payments/api\n",
+		"Container: app\n",
+		"Image:     ghcr.io/acme/api:1.0\n",
+		"\nFix\n  Upgrade openssl from 3.0.1 to 3.0.8\n",
+		"\nExposure\n  Level: external\n  EXTERNALLY EXPOSED",
+		"\nOther findings on this resource (3)\n  CRITICAL CVE-2024-0003    curl: CVE-2024-0003\n",
+		"\nAlso found on: shop/web\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("report lacks %q:\n%s", want, got)
+		}
+	}
+
+	// Fix wording for unfixed CVEs and misconfigurations
+	unfixed, _ := buildInvestigation(investigationFindings(), "CVE-2024-0002", "")
+	unfixed.ExposureError = "exposure not applicable"
+	if got := unfixed.String(); !strings.Contains(got, "No fixed version of zlib is available yet (installed: 1.2.11)") ||
+		!strings.Contains(got, "  Unknown: exposure not applicable\n") {
+		t.Errorf("unfixed report:\n%s", got)
+	}
+	misconfig, _ := buildInvestigation(investigationFindings(), "KSV014", "")
+	if got := misconfig.String(); !strings.Contains(got, "\nFix\n  Set readOnlyRootFilesystem to true\n") {
+		t.Errorf("misconfiguration report:\n%s", got)
+	}
+
+	// Long lists of related findings are cut
+	findings := []trivy.Finding{cveFinding("CVE-1", trivy.SeverityHigh, "ns", "Pod", "p", "a", "1", "2")}
+	for i := 0; i < maxRelatedFindings+5; i++ {
+		findings = append(findings, cveFinding(fmt.Sprintf("CVE-X-%d", i), trivy.SeverityLow, "ns", "Pod", "p", "b", "1", "2"))
+	}
+	long, _ := buildInvestigation(findings, "CVE-1", "")
+	if got := long.String(); !strings.Contains(got, "  ... and 5 more\n") || strings.Contains(got, fmt.Sprintf("CVE-X-%d ", maxRelatedFindings)) {
+		t.Errorf("related findings not cut at %d:\n%s", maxRelatedFindings, got)
+	}
+}
+
+func TestWriteInvestigationWithoutLLM(t *testing.T) {
+	inv, err := buildInvestigation(investigationFindings(), "CVE-2024-0001", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	noClient := func() (llm.Client, error) {
+		t.Error("LLM client requested without an LLM")
+		return nil, errors.New("unexpected")
+	}
+
+	var out strings.Builder
+	if err := writeInvestigation(context.Background(), &out, inv, "", true, noClient, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Investigation: CVE-2024-0001", "Upgrade openssl from 3.0.1 to 3.0.8", "Also found on: shop/web"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("--no-llm output lacks %q:\n%s", want, out.String())
+		}
+	}
+
+	// JSON implies no LLM
+	out.Reset()
+	if err := writeInvestigation(context.Background(), &out, inv, "json", false, noClient, nil); err != nil {
+		t.Fatal(err)
+	}
+	var decoded Investigation
+	if err := json.Unmarshal([]byte(out.String()), &decoded); err != nil {
+		t.Fatalf("JSON output: %v\n%s", err, out.String())
+	}
+	if decoded.Finding.ID != "CVE-2024-0001" || decoded.FixedVersion != "3.0.8" || len(decoded.Related) != 3 {
+		t.Errorf("decoded = %+v", decoded)
+	}
+
+	// No provider configured: the context is the report
+	out.Reset()
+	noProvider := func() (llm.Client, error) { return nil, errors.New("no provider configured") }
+	if err := writeInvestigation(context.Background(), &out, inv, "", false, noProvider, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); !strings.Contains(got, "Upgrade openssl from 3.0.1 to 3.0.8") ||
+		!strings.HasSuffix(got, "\nNo LLM configured (no provider configured); showing collected context only.\n") {
+		t.Errorf("fallback output:\n%s", got)
+	}
+}
+
+func TestWriteInvestigationWithLLM(t *testing.T) {
+	inv, err := buildInvestigation(investigationFindings(), "CVE-2024-0001", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &scriptedClient{model: "gpt-4o", answers: []string{"Upgrade openssl to 3.0.8 and redeploy."}}
+	newClient := func() (llm.Client, error) { return client, nil }
+
+	var out strings.Builder
+	if err := writeInvestigation(context.Background(), &out, inv, "", false, newClient, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); got != "Upgrade openssl to 3.0.8 and redeploy.\n" {
+		t.Errorf("output = %q, want only the write-up", got)
+	}
+
+	// The model gets the same context the non-LLM path prints
+	if len(client.messages) != 1 {
+		t.Fatalf("model called %d times, want 1", len(client.messages))
+	}
+	msgs := client.messages[0]
+	if len(msgs) != 2 || msgs[0].Content != investigatePrompt || msgs[1].Content != inv.String() {
+		t.Errorf("messages = %+v", msgs)
+	}
+
+	// A failing model still shows the context
+	out.Reset()
+	broken := &scriptedClient{model: "gpt-4o"}
+	err = writeInvestigation(context.Background(), &out, inv, "", false, func() (llm.Client, error) { return broken, nil }, nil)
+	if err == nil || !strings.Contains(err.Error(), "no more answers") {
+		t.Errorf("LLM failure err = %v", err)
+	}
+	if !strings.Contains(out.String(), "Upgrade openssl from 3.0.1 to 3.0.8") {
+		t.Errorf("context not shown after an LLM failure:\n%s", out.String())
+	}
+}
@@ -1,30 +1,43 @@
 package cmd
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
 
 	"github.com/spf13/cobra"
+	"github.com/trixsec-dev/trix/internal/counts"
 	"github.com/trixsec-dev/trix/internal/tools/kubectl"
 	"github.com/trixsec-dev/trix/internal/tools/trivy"
 	"github.com/trixsec-dev/trix/internal/ui"
 )
 
-var (
+// queryOptions holds the persistent flags shared by all query subcommands
+type queryOptions struct {
 	namespace     string
-	showDetails   bool
 	allNamespaces bool
 	output        string
-	packageFilter string
-	showFull      bool
-)
+}
 
-var queryCmd = &cobra.Command{
-	Use:   "query",
-	Short: "Query Kubernetes security resources",
-	Long:  `Query vulnerability reports, compliance data, and security posture from your cluster.`,
+func newQueryCmd() *cobra.Command {
+	o := &queryOptions{}
+	cmd := &cobra.Command{
+		Use:   "query",
+		Short: "Query Kubernetes security resources",
+		Long:  `Query vulnerability reports, compliance data, and security posture from your cluster.`,
+	}
+	cmd.AddCommand(newQueryVulnsCmd(o))
+	cmd.AddCommand(newQueryComplianceCmd(o))
+	cmd.AddCommand(newQueryFindingsCmd(o))
+	cmd.AddCommand(newQuerySbomCmd(o))
+	cmd.AddCommand(newQuerySummaryCmd(o))
+	cmd.AddCommand(newQueryNetworkCmd(o))
+	cmd.AddCommand(newQueryTrendsCmd(o))
+
+	cmd.PersistentFlags().StringVarP(&o.namespace, "namespace", "n", "default", "Kubernetes namespace")
+	cmd.PersistentFlags().BoolVarP(&o.allNamespaces, "all-namespaces", "A", false, "Query across all namespaces")
+	cmd.PersistentFlags().StringVarP(&o.output, "output", "o", "", "Output format (json)")
+	return cmd
 }
 
 // VulnReport represents a vulnerability report with parsed data
@@ -49,362 +62,381 @@ type ComplianceReport struct {
 	Checks    []trivy.ComplianceCheck `json:"checks,omitempty"`
 }
 
-var queryVulnsCmd = &cobra.Command{
-	Use:   "vulns",
-	Short: "List vulnerability reports from Trivy Operator",
-	Run: func(cmd *cobra.Command, args []string) {
-		k8sClient, err := kubectl.NewClient()
-		if err != nil {
-			fmt.Printf("Error creating K8s client: %v\n", err)
-			return
-		}
-		trivyClient := trivy.NewClient(k8sClient)
+// queryVulnsOptions holds the flags of trix query vulns
+type queryVulnsOptions struct {
+	*queryOptions
+	details bool
+}
 
-		ctx := context.Background()
+func newQueryVulnsCmd(q *queryOptions) *cobra.Command {
+	o := &queryVulnsOptions{queryOptions: q}
+	cmd := &cobra.Command{
+		Use:   "vulns",
+		Short: "List vulnerability reports from Trivy Operator",
+		RunE:  o.run,
+	}
+	cmd.Flags().BoolVarP(&o.details, "details", "d", false, "Show detailed CVE information")
+	return cmd
+}
 
-		currentCtx, err := k8sClient.GetCurrentContext()
-		if err != nil {
-			fmt.Printf("Error getting context: %v\n", err)
-		}
+func (o *queryVulnsOptions) run(cmd *cobra.Command, args []string) error {
+	k8sClient, err := kubectl.NewClient()
+	if err != nil {
+		return fmt.Errorf("failed to create k8s client: %w", err)
+	}
+	trivyClient := trivy.NewClient(k8sClient)
 
-		// Only show context info in text mode
-		if output != "json" {
-			fmt.Printf("Using context: %s\n", currentCtx)
-		}
+	ctx := cmd.Context()
 
-		// Determine namespace based on flag
-		ns := namespace
-		if allNamespaces {
-			ns = "" // Empty string = all namespaces in k8s API
-			if output != "json" {
-				fmt.Printf("Namespace: all\n\n")
-			}
-		} else {
-			if output != "json" {
-				fmt.Printf("Namespace: %s\n\n", ns)
-			}
-		}
+	currentCtx, err := k8sClient.GetCurrentContext()
+	if err != nil {
+		fmt.Fprintf(cmd.ErrOrStderr(), "Warning: failed to get context: %v\n", err)
+	}
 
-		reports, err := trivyClient.ListVulnerabilityReports(ctx, ns)
-		if err != nil {
-			fmt.Printf("Error listing vulnerability reports: %v\n", err)
-			return
+	// Only show context info in text mode
+	if o.output != "json" {
+		fmt.Printf("Using context: %s\n", currentCtx)
+	}
+
+	// Determine namespace based on flag
+	ns := o.namespace
+	if o.allNamespaces {
+		ns = "" // Empty string = all namespaces in k8s API
+		if o.output != "json" {
+			fmt.Printf("Namespace: all\n\n")
+		}
+	} else {
+		if o.output != "json" {
+			fmt.Printf("Namespace: %s\n\n", ns)
 		}
+	}
+
+	reports, err := trivyClient.ListVulnerabilityReports(ctx, ns)
+	if err != nil {
+		return fmt.Errorf("failed to list vulnerability reports: %w", err)
+	}
 
-		// Collect all reports for JSON output
-		var vulnReports []VulnReport
+	// Collect all reports for JSON output
+	var vulnReports []VulnReport
 
-		if output != "json" {
-			fmt.Printf("Found %d vulnerability reports:\n", len(reports))
+	if o.output != "json" {
+		fmt.Printf("Found %d vulnerability reports:\n", len(reports))
+	}
+
+	for i, report := range reports {
+		// Extract metadata
+		metadata, ok := report["metadata"].(map[string]interface{})
+		if !ok {
+			continue
 		}
+		name, _ := metadata["name"].(string)
+		ns, _ := metadata["namespace"].(string)
 
-		for i, report := range reports {
-			// Extract metadata
-			metadata, ok := report["metadata"].(map[string]interface{})
-			if !ok {
-				continue
-			}
-			name, _ := metadata["name"].(string)
-			ns, _ := metadata["namespace"].(string)
-
-			// Extract report data
-			reportData, ok := report["report"].(map[string]interface{})
-			if !ok {
-				if output != "json" {
-					fmt.Printf("%d. %s (no report data)\n", i+1, name)
-				}
-				continue
+		// Extract report data
+		reportData, ok := report["report"].(map[string]interface{})
+		if !ok {
+			if o.output != "json" {
+				fmt.Printf("%d. %s (no report data)\n", i+1, name)
 			}
+			continue
+		}
 
-			// Extract summary from report
-			summary, ok := reportData["summary"].(map[string]interface{})
-			if !ok {
-				if output != "json" {
-					fmt.Printf("%d. %s (no summary)\n", i+1, name)
-				}
-				continue
+		// Extract summary from report
+		summary, ok := reportData["summary"].(map[string]interface{})
+		if !ok {
+			if o.output != "json" {
+				fmt.Printf("%d. %s (no summary)\n", i+1, name)
 			}
+			continue
+		}
 
-			// Convert to int
-			critical, _ := summary["criticalCount"].(int64)
-			high, _ := summary["highCount"].(int64)
-			medium, _ := summary["mediumCount"].(int64)
-			low, _ := summary["lowCount"].(int64)
-
-			vulnReport := VulnReport{
-				Name:      name,
-				Namespace: ns,
-				Critical:  critical,
-				High:      high,
-				Medium:    medium,
-				Low:       low,
-			}
+		// Convert to int
+		critical, _ := summary["criticalCount"].(int64)
+		high, _ := summary["highCount"].(int64)
+		medium, _ := summary["mediumCount"].(int64)
+		low, _ := summary["lowCount"].(int64)
 
-			// Parse vulnerabilities if requested or JSON output
-			if showDetails || output == "json" {
-				vulns, err := trivyClient.ParseVulnerabilities(report)
-				if err != nil && output != "json" {
-					fmt.Printf("Error parsing vulnerabilities: %v\n", err)
-					continue
-				}
-				vulnReport.Vulnerabilities = vulns
-			}
+		vulnReport := VulnReport{
+			Name:      name,
+			Namespace: ns,
+			Critical:  critical,
+			High:      high,
+			Medium:    medium,
+			Low:       low,
+		}
 
-			vulnReports = append(vulnReports, vulnReport)
+		// Parse vulnerabilities if requested or JSON output
+		if o.details || o.output == "json" {
+			vulns, err := trivyClient.ParseVulnerabilities(report)
+			if err != nil && o.output != "json" {
+				fmt.Fprintf(cmd.ErrOrStderr(), "Warning: failed to parse vulnerabilities of %s: %v\n", name, err)
+				continue
+			}
+			vulnReport.Vulnerabilities = vulns
+		}
 
-			// Text output
-			if output != "json" {
-				fmt.Printf("%d. %s Critical: %d High: %d Medium: %d Low: %d\n", i+1, name, critical, high, medium, low)
+		vulnReports = append(vulnReports, vulnReport)
 
-				if showDetails && len(vulnReport.Vulnerabilities) > 0 {
-					fmt.Printf("   Parsed %d vulnerabilities (Showing first 3):\n", len(vulnReport.Vulnerabilities))
-					for i, v := range vulnReport.Vulnerabilities {
-						if i >= 3 {
-							break
-						}
-						fmt.Printf("   %+v\n", v)
+		// Text output
+		if o.output != "json" {
+			fmt.Printf("%d. %s Critical: %d High: %d Medium: %d Low: %d\n", i+1, name, critical, high, medium, low)
+
+			if o.details && len(vulnReport.Vulnerabilities) > 0 {
+				fmt.Printf("   Parsed %d vulnerabilities (Showing first 3):\n", len(vulnReport.Vulnerabilities))
+				for i, v := range vulnReport.Vulnerabilities {
+					if i >= 3 {
+						break
 					}
+					fmt.Printf("   %+v\n", v)
 				}
 			}
 		}
+	}
 
-		// JSON output
-		if output == "json" {
-			jsonData, err := json.MarshalIndent(vulnReports, "", "  ")
-			if err != nil {
-				fmt.Printf("Error marshaling JSON: %v\n", err)
-				return
-			}
-			fmt.Println(string(jsonData))
+	// JSON output
+	if o.output == "json" {
+		jsonData, err := json.MarshalIndent(vulnReports, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON: %w", err)
 		}
-	},
+		fmt.Println(string(jsonData))
+	}
+	return nil
 }
 
-var queryComplianceCmd = &cobra.Command{
-	Use:   "compliance",
-	Short: "List compliance reports from Trivy Operator",
-	Run: func(cmd *cobra.Command, args []string) {
-		k8sClient, err := kubectl.NewClient()
-		if err != nil {
-			fmt.Printf("Error creating K8s client: %v\n", err)
-			return
-		}
-		trivyClient := trivy.NewClient(k8sClient)
+// queryComplianceOptions holds the flags of trix query compliance
+type queryComplianceOptions struct {
+	*queryOptions
+	details bool
+}
 
-		ctx := context.Background()
+func newQueryComplianceCmd(q *queryOptions) *cobra.Command {
+	o := &queryComplianceOptions{queryOptions: q}
+	cmd := &cobra.Command{
+		Use:   "compliance",
+		Short: "List compliance reports from Trivy Operator",
+		RunE:  o.run,
+	}
+	cmd.Flags().BoolVarP(&o.details, "details", "d", false, "Show parsed checks")
+	return cmd
+}
 
-		currentCtx, err := k8sClient.GetCurrentContext()
-		if err != nil {
-			fmt.Printf("Error getting context: %v\n", err)
-		}
+func (o *queryComplianceOptions) run(cmd *cobra.Command, args []string) error {
+	k8sClient, err := kubectl.NewClient()
+	if err != nil {
+		return fmt.Errorf("failed to create k8s client: %w", err)
+	}
+	trivyClient := trivy.NewClient(k8sClient)
 
-		// Only show context info in text mode
-		if output != "json" {
-			fmt.Printf("Using context: %s\n", currentCtx)
-		}
+	ctx := cmd.Context()
 
-		// Determine namespace based on flag
-		ns := namespace
-		if allNamespaces {
-			ns = "" // Empty string = all namespaces in k8s API
-			if output != "json" {
-				fmt.Printf("Namespace: all\n\n")
-			}
-		} else {
-			if output != "json" {
-				fmt.Printf("Namespace: %s\n\n", ns)
-			}
-		}
+	currentCtx, err := k8sClient.GetCurrentContext()
+	if err != nil {
+		fmt.Fprintf(cmd.ErrOrStderr(), "Warning: failed to get context: %v\n", err)
+	}
 
-		reports, err := trivyClient.ListConfigAuditReports(ctx, ns)
-		if err != nil {
-			fmt.Printf("Error listing compliance reports: %v\n", err)
-			return
+	// Only show context info in text mode
+	if o.output != "json" {
+		fmt.Printf("Using context: %s\n", currentCtx)
+	}
+
+	// Determine namespace based on flag
+	ns := o.namespace
+	if o.allNamespaces {
+		ns = "" // Empty string = all namespaces in k8s API
+		if o.output != "json" {
+			fmt.Printf("Namespace: all\n\n")
+		}
+	} else {
+		if o.output != "json" {
+			fmt.Printf("Namespace: %s\n\n", ns)
 		}
+	}
+
+	reports, err := trivyClient.ListConfigAuditReports(ctx, ns)
+	if err != nil {
+		return fmt.Errorf("failed to list compliance reports: %w", err)
+	}
 
-		// Collect all reports for JSON output
-		var complianceReports []ComplianceReport
+	// Collect all reports for JSON output
+	var complianceReports []ComplianceReport
 
-		if output != "json" {
-			fmt.Printf("Found %d compliance reports:\n", len(reports))
+	if o.output != "json" {
+		fmt.Printf("Found %d compliance reports:\n", len(reports))
+	}
+
+	for i, report := range reports {
+		// Extract metadata
+		metadata, ok := report["metadata"].(map[string]interface{})
+		if !ok {
+			continue
 		}
+		name, _ := metadata["name"].(string)
+		ns, _ := metadata["namespace"].(string)
 
-		for i, report := range reports {
-			// Extract metadata
-			metadata, ok := report["metadata"].(map[string]interface{})
-			if !ok {
-				continue
-			}
-			name, _ := metadata["name"].(string)
-			ns, _ := metadata["namespace"].(string)
-
-			// Extract report data
-			reportData, ok := report["report"].(map[string]interface{})
-			if !ok {
-				if output != "json" {
-					fmt.Printf("%d. %s (no report data)\n", i+1, name)
-				}
-				continue
+		// Extract report data
+		reportData, ok := report["report"].(map[string]interface{})
+		if !ok {
+			if o.output != "json" {
+				fmt.Printf("%d. %s (no report data)\n", i+1, name)
 			}
+			continue
+		}
 
-			// Extract summary from report
-			summary, ok := reportData["summary"].(map[string]interface{})
-			if !ok {
-				if output != "json" {
-					fmt.Printf("%d. %s (no summary)\n", i+1, name)
-				}
-				continue
+		// Extract summary from report
+		summary, ok := reportData["summary"].(map[string]interface{})
+		if !ok {
+			if o.output != "json" {
+				fmt.Printf("%d. %s (no summary)\n", i+1, name)
 			}
+			continue
+		}
 
-			// Convert to int
-			critical, _ := summary["criticalCount"].(int64)
-			high, _ := summary["highCount"].(int64)
-			medium, _ := summary["mediumCount"].(int64)
-			low, _ := summary["lowCount"].(int64)
-
-			complianceReport := ComplianceReport{
-				Name:      name,
-				Namespace: ns,
-				Critical:  critical,
-				High:      high,
-				Medium:    medium,
-				Low:       low,
-			}
+		// Convert to int
+		critical, _ := summary["criticalCount"].(int64)
+		high, _ := summary["highCount"].(int64)
+		medium, _ := summary["mediumCount"].(int64)
+		low, _ := summary["lowCount"].(int64)
 
-			// Parse checks if requested or JSON output
-			if showDetails || output == "json" {
-				checks, err := trivyClient.ParseComplianceChecks(report)
-				if err != nil && output != "json" {
-					fmt.Printf("Error parsing compliance checks: %v\n", err)
-					continue
-				}
-				complianceReport.Checks = checks
-			}
+		complianceReport := ComplianceReport{
+			Name:      name,
+			Namespace: ns,
+			Critical:  critical,
+			High:      high,
+			Medium:    medium,
+			Low:       low,
+		}
 
-			complianceReports = append(complianceReports, complianceReport)
+		// Parse checks if requested or JSON output
+		if o.details || o.output == "json" {
+			checks, err := trivyClient.ParseComplianceChecks(report)
+			if err != nil && o.output != "json" {
+				fmt.Fprintf(cmd.ErrOrStderr(), "Warning: failed to parse compliance checks of %s: %v\n", name, err)
+				continue
+			}
+			complianceReport.Checks = checks
+		}
 
-			// Text output
-			if output != "json" {
-				fmt.Printf("%d. %s Critical: %d High: %d Medium: %d Low: %d\n", i+1, name, critical, high, medium, low)
+		complianceReports = append(complianceReports, complianceReport)
 
-				if showDetails && len(complianceReport.Checks) > 0 {
-					fmt.Printf("   Parsed %d checks (Showing first 3):\n", len(complianceReport.Checks))
-					for i, c := range complianceReport.Checks {
-						if i >= 3 {
-							break
-						}
-						fmt.Printf("   %+v\n", c)
+		// Text output
+		if o.output != "json" {
+			fmt.Printf("%d. %s Critical: %d High: %d Medium: %d Low: %d\n", i+1, name, critical, high, medium, low)
+
+			if o.details && len(complianceReport.Checks) > 0 {
+				fmt.Printf("   Parsed %d checks (Showing first 3):\n", len(complianceReport.Checks))
+				for i, c := range complianceReport.Checks {
+					if i >= 3 {
+						break
 					}
+					fmt.Printf("   %+v\n", c)
 				}
 			}
 		}
+	}
 
-		// JSON output
-		if output == "json" {
-			jsonData, err := json.MarshalIndent(complianceReports, "", "  ")
-			if err != nil {
-				fmt.Printf("Error marshaling JSON: %v\n", err)
-				return
-			}
-			fmt.Println(string(jsonData))
+	// JSON output
+	if o.output == "json" {
+		jsonData, err := json.MarshalIndent(complianceReports, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON: %w", err)
 		}
-	},
+		fmt.Println(string(jsonData))
+	}
+	return nil
 }
 
-var queryFindingsCmd = &cobra.Command{
-	Use:   "findings",
-	Short: "Query all security findings (unified view)",
-	Run: func(cmd *cobra.Command, args []string) {
-		k8sClient, err := kubectl.NewClient()
-		if err != nil {
-			fmt.Printf("Error creating k8s client: %v\n", err)
-			return
-		}
-		trivyClient := trivy.NewClient(k8sClient)
-
-		ctx := context.Background()
-
-		// Determine namespace
-		ns := namespace
-		if allNamespaces {
-			ns = ""
-		}
-
-		// Create all scanners - they all implement the Scanner interface
-		scanners := []trivy.Scanner{
-			// Namespaced scanners
-			trivy.NewTrivyVulnScanner(trivyClient),
-			trivy.NewTrivyComplianceScanner(trivyClient),
-			trivy.NewTrivySecretScanner(trivyClient),
-			trivy.NewTrivyRbacScanner(trivyClient),
-			trivy.NewTrivyInfraScanner(trivyClient),
-			// Cluster-scoped scanners
-			trivy.NewClusterVulnScanner(trivyClient),
-			trivy.NewClusterComplianceScanner(trivyClient),
-			trivy.NewClusterRbacScanner(trivyClient),
-			trivy.NewClusterInfraScanner(trivyClient),
-			// Benchmark scanner (CIS/NSA)
-			trivy.NewBenchmarkScanner(trivyClient),
-		}
-
-		var allFindings []trivy.Finding
-
-		// Run each scanner
-		for _, scanner := range scanners {
-			if output != "json" {
-				fmt.Printf("Running %s scanner..\n", scanner.Name())
-			}
+// queryFindingsOptions holds the flags of trix query findings
+type queryFindingsOptions struct {
+	*queryOptions
+	full bool
+}
 
-			findings, err := scanner.Scan(ctx, ns)
-			if err != nil {
-				fmt.Printf("Error in %s: %v\n", scanner.Name(), err)
-				continue
-			}
+func newQueryFindingsCmd(q *queryOptions) *cobra.Command {
+	o := &queryFindingsOptions{queryOptions: q}
+	cmd := &cobra.Command{
+		Use:   "findings",
+		Short: "Query all security findings (unified view)",
+		RunE:  o.run,
+	}
+	cmd.Flags().BoolVar(&o.full, "full", false, "Include full RawData in JSON output")
+	return cmd
+}
+
+func (o *queryFindingsOptions) run(cmd *cobra.Command, args []string) error {
+	k8sClient, err := kubectl.NewClient()
+	if err != nil {
+		return fmt.Errorf("failed to create k8s client: %w", err)
+	}
+	trivyClient := trivy.NewClient(k8sClient)
+
+	ctx := cmd.Context()
 
-			allFindings = append(allFindings, findings...)
+	// Determine namespace
+	ns := o.namespace
+	if o.allNamespaces {
+		ns = ""
+	}
+
+	// Run every scanner, stopping early on Ctrl-C
+	progress := func(scanner string, err error) {
+		if err != nil {
+			fmt.Fprintf(cmd.ErrOrStderr(), "Warning: %s scanner failed: %v\n", scanner, err)
+		} else if o.output != "json" {
+			fmt.Printf("Running %s scanner..\n", scanner)
 		}
+	}
+	allFindings, err := collectFindings(ctx, newScanners(trivyClient), ns, progress)
 
-		// Output results
-		if output == "json" {
-			// Strip RawData by default to reduce output size (use --full to include)
-			outputFindings := allFindings
-			if !showFull {
-				outputFindings = make([]trivy.Finding, len(allFindings))
-				for i, f := range allFindings {
-					outputFindings[i] = f
-					outputFindings[i].RawData = nil
-				}
-			}
-			jsonData, err := json.MarshalIndent(outputFindings, "", "  ")
-			if err != nil {
-				fmt.Printf("Error marshaling JSON: %v\n", err)
-				return
-			}
-			fmt.Println(string(jsonData))
-		} else {
-			// Build table output
-			table := ui.NewTable("Severity", "Type", "Title", "Resource")
+	// When interrupted, print what was gathered so far
+	interrupted := ctx.Err()
+	if err != nil && interrupted == nil {
+		return err
+	}
 
-			// Limit to first 50 for readability
-			limit := 50
-			if len(allFindings) < limit {
-				limit = len(allFindings)
+	// Output results
+	if o.output == "json" {
+		// Strip RawData by default to reduce output size (use --full to include)
+		outputFindings := allFindings
+		if !o.full {
+			outputFindings = make([]trivy.Finding, len(allFindings))
+			for i, f := range allFindings {
+				outputFindings[i] = f
+				outputFindings[i].RawData = nil
 			}
+		}
+		jsonData, err := json.MarshalIndent(outputFindings, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		fmt.Println(string(jsonData))
+	} else {
+		// Build table output
+		table := ui.NewTable("Severity", "Type", "Title", "Resource")
 
-			for _, f := range allFindings[:limit] {
-				// Truncate title if too long
-				title := f.Title
-				if len(title) > 40 {
-					title = title[:37] + "..."
-				}
-				table.AddRow(string(f.Severity), string(f.Type), title, f.ResourceName)
-			}
+		// Limit to first 50 for readability
+		limit := 50
+		if len(allFindings) < limit {
+			limit = len(allFindings)
+		}
 
-			// Render in a box
-			header := fmt.Sprintf("Findings (%d of %d)", limit, len(allFindings))
-			fmt.Println(ui.Box(header, table.Render(), 100))
+		for _, f := range allFindings[:limit] {
+			// Truncate title if too long
+			title := f.Title
+			if len(title) > 40 {
+				title = title[:37] + "..."
+			}
+			table.AddRow(string(f.Severity), string(f.Type), title, f.ResourceName)
 		}
-	},
+
+		// Render in a box
+		header := fmt.Sprintf("Findings (%d of %d)", limit, len(allFindings))
+		fmt.Println(ui.Box(header, table.Render(), 100))
+	}
+	if interrupted != nil {
+		fmt.Fprintln(cmd.ErrOrStderr(), "Warning: partial results (interrupted)")
+	}
+	return interrupted
 }
 
 // Summary represents aggregated findings data
@@ -421,300 +453,288 @@ type ResourceCount struct {
 	Count    int    `json:"count"`
 }
 
-var querySummaryCmd = &cobra.Command{
-	Use:   "summary",
-	Short: "Show aggregated security findings summary",
-	Run: func(cmd *cobra.Command, args []string) {
-		k8sClient, err := kubectl.NewClient()
-		if err != nil {
-			fmt.Printf("Error creating k8s client: %v\n", err)
-			return
-		}
-		trivyClient := trivy.NewClient(k8sClient)
-
-		ctx := context.Background()
-
-		ns := namespace
-		if allNamespaces {
-			ns = ""
-		}
+// querySummaryOptions holds the flags of trix query summary
+type querySummaryOptions struct {
+	*queryOptions
+	namespacedOnly bool
+}
 
-		// Create all scanners
-		scanners := []trivy.Scanner{
-			trivy.NewTrivyVulnScanner(trivyClient),
-			trivy.NewTrivyComplianceScanner(trivyClient),
-			trivy.NewTrivySecretScanner(trivyClient),
-			trivy.NewTrivyRbacScanner(trivyClient),
-			trivy.NewTrivyInfraScanner(trivyClient),
-			trivy.NewClusterVulnScanner(trivyClient),
-			trivy.NewClusterComplianceScanner(trivyClient),
-			trivy.NewClusterRbacScanner(trivyClient),
-			trivy.NewClusterInfraScanner(trivyClient),
-			trivy.NewBenchmarkScanner(trivyClient),
-		}
+func newQuerySummaryCmd(q *queryOptions) *cobra.Command {
+	o := &querySummaryOptions{queryOptions: q}
+	cmd := &cobra.Command{
+		Use:   "summary",
+		Short: "Show aggregated security findings summary",
+		RunE:  o.run,
+	}
+	cmd.Flags().BoolVar(&o.namespacedOnly, "namespaced-only", false, "Leave out cluster-scoped findings")
+	return cmd
+}
 
-		var allFindings []trivy.Finding
+func (o *querySummaryOptions) run(cmd *cobra.Command, args []string) error {
+	k8sClient, err := kubectl.NewClient()
+	if err != nil {
+		return fmt.Errorf("failed to create k8s client: %w", err)
+	}
+	trivyClient := trivy.NewClient(k8sClient)
 
-		// Run each scanner
-		for _, scanner := range scanners {
-			findings, err := scanner.Scan(ctx, ns)
-			if err != nil {
-				continue
-			}
-			allFindings = append(allFindings, findings...)
-		}
+	ctx := cmd.Context()
 
-		// Aggregate by severity
-		bySeverity := make(map[string]int)
-		for _, f := range allFindings {
-			bySeverity[string(f.Severity)]++
-		}
+	ns := o.namespace
+	if o.allNamespaces {
+		ns = ""
+	}
 
-		// Aggregate by type
-		byType := make(map[string]int)
-		for _, f := range allFindings {
-			byType[string(f.Type)]++
-		}
+	allFindings, err := collectFindings(ctx, newScanners(trivyClient), ns, nil)
+	if err != nil {
+		return err
+	}
 
-		// Count by resource (for top affected)
-		// Exclude benchmark findings - they're framework-level, not resource-level
-		resourceCounts := make(map[string]int)
+	// Cluster-scoped findings have no namespace
+	if o.namespacedOnly {
+		namespaced := allFindings[:0]
 		for _, f := range allFindings {
-			if f.Type == trivy.FindingTypeBenchmark {
-				continue // Skip benchmarks - not actual K8s resources
-			}
-			key := f.ResourceName
 			if f.Namespace != "" {
-				key = f.Namespace + "/" + f.ResourceName
+				namespaced = append(namespaced, f)
 			}
-			resourceCounts[key]++
 		}
+		allFindings = namespaced
+	}
 
-		// Sort and get top 10
-		topResources := getTopResources(resourceCounts, 10)
+	// Aggregate by severity
+	bySeverity := make(map[string]int)
+	for _, f := range allFindings {
+		bySeverity[string(f.Severity)]++
+	}
 
-		summary := Summary{
-			BySeverity:    bySeverity,
-			ByType:        byType,
-			TopResources:  topResources,
-			TotalFindings: len(allFindings),
+	// Aggregate by type
+	byType := make(map[string]int)
+	for _, f := range allFindings {
+		byType[string(f.Type)]++
+	}
+
+	// Count by resource (for top affected)
+	// Exclude benchmark findings - they're framework-level, not resource-level
+	resourceCounts := make(map[string]int)
+	for _, f := range allFindings {
+		if f.Type == trivy.FindingTypeBenchmark {
+			continue // Skip benchmarks - not actual K8s resources
+		}
+		key := f.ResourceName
+		if f.Namespace != "" {
+			key = f.Namespace + "/" + f.ResourceName
 		}
+		resourceCounts[key]++
+	}
 
-		if output == "json" {
-			jsonData, err := json.MarshalIndent(summary, "", "  ")
-			if err != nil {
-				fmt.Printf("Error marshaling JSON: %v\n", err)
-				return
-			}
-			fmt.Println(string(jsonData))
-			return
+	// Sort and get top 10
+	topResources := getTopResources(resourceCounts, 10)
+
+	summary := Summary{
+		BySeverity:    bySeverity,
+		ByType:        byType,
+		TopResources:  topResources,
+		TotalFindings: len(allFindings),
+	}
+
+	if o.output == "json" {
+		jsonData, err := json.MarshalIndent(summary, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON: %w", err)
 		}
+		fmt.Println(string(jsonData))
+		return nil
+	}
 
-		// Build styled output using ui package
-		var content strings.Builder
+	// Build styled output using ui package
+	var content strings.Builder
 
-		// Total count
-		content.WriteString(fmt.Sprintf("Total Findings: %s\n\n", ui.Info.Render(fmt.Sprintf("%d", len(allFindings)))))
+	// Total count
+	content.WriteString(fmt.Sprintf("Total Findings: %s\n\n", ui.Info.Render(fmt.Sprintf("%d", len(allFindings)))))
 
-		// By Severity section
-		content.WriteString(ui.Section("By Severity") + "\n")
-		for _, sev := range []string{"CRITICAL", "HIGH", "MEDIUM", "LOW", "UNKNOWN"} {
-			if count, ok := bySeverity[sev]; ok {
-				content.WriteString(ui.SeverityLine(sev, count) + "\n")
-			}
+	// By Severity section
+	content.WriteString(ui.Section("By Severity") + "\n")
+	for _, sev := range []string{"CRITICAL", "HIGH", "MEDIUM", "LOW", "UNKNOWN"} {
+		if count, ok := bySeverity[sev]; ok {
+			content.WriteString(ui.SeverityLine(sev, count) + "\n")
 		}
+	}
 
-		// By Type section
-		content.WriteString("\n" + ui.Section("By Type") + "\n")
-		for _, typ := range []string{"vulnerability", "compliance", "rbac", "secret", "infra", "benchmark"} {
-			if count, ok := byType[typ]; ok {
-				content.WriteString(ui.TypeLine(typ, count) + "\n")
-			}
+	// By Type section
+	content.WriteString("\n" + ui.Section("By Type") + "\n")
+	for _, typ := range []string{"vulnerability", "compliance", "rbac", "secret", "infra", "benchmark"} {
+		if count, ok := byType[typ]; ok {
+			content.WriteString(ui.TypeLine(typ, count) + "\n")
 		}
+	}
 
-		// Top Resources section
-		if len(topResources) > 0 {
-			content.WriteString("\n" + ui.Section("Top Affected Resources") + "\n")
-			for _, rc := range topResources {
-				content.WriteString(ui.ResourceLine(rc.Resource, rc.Count, 40) + "\n")
-			}
+	// Top Resources section
+	if len(topResources) > 0 {
+		content.WriteString("\n" + ui.Section("Top Affected Resources") + "\n")
+		for _, rc := range topResources {
+			content.WriteString(ui.ResourceLine(rc.Resource, rc.Count, 40) + "\n")
 		}
+	}
 
-		// Wrap in a box and print
-		fmt.Println(ui.Box("Security Findings Summary", content.String(), 60))
-	},
+	// Wrap in a box and print
+	fmt.Println(ui.Box("Security Findings Summary", content.String(), 60))
+	return nil
 }
 
 // getTopResources returns the top N resources by finding count
-func getTopResources(counts map[string]int, n int) []ResourceCount {
+func getTopResources(resourceCounts map[string]int, n int) []ResourceCount {
 	var result []ResourceCount
-	for resource, count := range counts {
-		result = append(result, ResourceCount{Resource: resource, Count: count})
+	for _, e := range counts.Top(resourceCounts, n) {
+		result = append(result, ResourceCount{Resource: e.Name, Count: e.Count})
 	}
+	return result
+}
 
-	// Simple bubble sort for top N (good enough for this use case)
-	for i := 0; i < len(result); i++ {
-		for j := i + 1; j < len(result); j++ {
-			if result[j].Count > result[i].Count {
-				result[i], result[j] = result[j], result[i]
-			}
-		}
+func newQueryNetworkCmd(o *queryOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "network",
+		Short: "Analyze NetworkPolicy coverage",
+		RunE:  o.runNetwork,
 	}
+}
 
-	if len(result) > n {
-		result = result[:n]
+func (o *queryOptions) runNetwork(cmd *cobra.Command, args []string) error {
+	k8sClient, err := kubectl.NewClient()
+	if err != nil {
+		return fmt.Errorf("failed to create k8s client: %w", err)
 	}
-	return result
-}
 
-var queryNetworkCmd = &cobra.Command{
-	Use:   "network",
-	Short: "Analyze NetworkPolicy coverage",
-	Run: func(cmd *cobra.Command, args []string) {
-		k8sClient, err := kubectl.NewClient()
-		if err != nil {
-			fmt.Printf("Error creating k8s client: %v\n", err)
-			return
-		}
+	ctx := cmd.Context()
 
-		ctx := context.Background()
+	ns := o.namespace
+	if o.allNamespaces {
+		ns = ""
+	}
 
-		ns := namespace
-		if allNamespaces {
-			ns = ""
-		}
+	coverage, err := k8sClient.AnalyzeCoverage(ctx, ns)
+	if err != nil {
+		return fmt.Errorf("failed to analyze coverage: %w", err)
+	}
 
-		coverage, err := k8sClient.AnalyzeCoverage(ctx, ns)
-		if err != nil {
-			fmt.Printf("Error analyzing coverage: %v\n", err)
-			return
-		}
+	if o.output == "json" {
+		jsonData, _ := json.MarshalIndent(coverage, "", "  ")
+		fmt.Println(string(jsonData))
+		return nil
+	}
 
-		if output == "json" {
-			jsonData, _ := json.MarshalIndent(coverage, "", "  ")
-			fmt.Println(string(jsonData))
-			return
+	// Text output
+	for _, c := range coverage {
+		fmt.Printf("Namespace: %s\n", c.Namespace)
+		fmt.Printf("  Policies: %d (%s)\n", len(c.Policies), strings.Join(c.Policies, ", "))
+		fmt.Printf("  Pods: %d/%d covered\n", c.CoveredPods, c.TotalPods)
+		if len(c.UncoveredPods) > 0 {
+			fmt.Printf("  ⚠️  Uncovered pods: %s\n", strings.Join(c.UncoveredPods, ", "))
 		}
+	}
+	return nil
+}
 
-		// Text output
-		for _, c := range coverage {
-			fmt.Printf("Namespace: %s\n", c.Namespace)
-			fmt.Printf("  Policies: %d (%s)\n", len(c.Policies), strings.Join(c.Policies, ", "))
-			fmt.Printf("  Pods: %d/%d covered\n", c.CoveredPods, c.TotalPods)
-			if len(c.UncoveredPods) > 0 {
-				fmt.Printf("  ⚠️  Uncovered pods: %s\n", strings.Join(c.UncoveredPods, ", "))
-			}
-		}
-	},
+// querySbomOptions holds the flags of trix query sbom
+type querySbomOptions struct {
+	*queryOptions
+	packageName string
+	details     bool
 }
 
-var querySbomCmd = &cobra.Command{
-	Use:   "sbom",
-	Short: "List software components from SBOM reports",
-	Run: func(cmd *cobra.Command, args []string) {
-		k8sClient, err := kubectl.NewClient()
-		if err != nil {
-			fmt.Printf("Error creating K8s client: %v\n", err)
-			return
-		}
-		trivyClient := trivy.NewClient(k8sClient)
+func newQuerySbomCmd(q *queryOptions) *cobra.Command {
+	o := &querySbomOptions{queryOptions: q}
+	cmd := &cobra.Command{
+		Use:   "sbom",
+		Short: "List software components from SBOM reports",
+		RunE:  o.run,
+	}
+	cmd.Flags().StringVar(&o.packageName, "package", "", "Filter by package name")
+	cmd.Flags().BoolVarP(&o.details, "details", "d", false, "Show all components")
+	return cmd
+}
 
-		ctx := context.Background()
+func (o *querySbomOptions) run(cmd *cobra.Command, args []string) error {
+	k8sClient, err := kubectl.NewClient()
+	if err != nil {
+		return fmt.Errorf("failed to create k8s client: %w", err)
+	}
+	trivyClient := trivy.NewClient(k8sClient)
 
-		ns := namespace
-		if allNamespaces {
-			ns = ""
-		}
+	ctx := cmd.Context()
 
-		reports, err := trivyClient.ListSbomReports(ctx, ns)
-		if err != nil {
-			fmt.Printf("Error listing SBOM reports: %v\n", err)
-			return
-		}
+	ns := o.namespace
+	if o.allNamespaces {
+		ns = ""
+	}
 
-		// Also get cluster-scoped SBOMs
-		clusterReports, err := trivyClient.ListClusterSbomReports(ctx)
-		if err == nil {
-			reports = append(reports, clusterReports...)
-		}
+	reports, err := trivyClient.ListSbomReports(ctx, ns)
+	if err != nil {
+		return fmt.Errorf("failed to list SBOM reports: %w", err)
+	}
 
-		if output == "json" {
-			var sboms []trivy.SBOMReport
-			for _, report := range reports {
-				sbom, err := trivyClient.ParseSBOMReport(report)
-				if err != nil {
-					continue
-				}
-				// Apply package filter to JSON output too
-				if packageFilter != "" {
-					var filtered []trivy.SBOMComponent
-					for _, comp := range sbom.Components {
-						if strings.Contains(strings.ToLower(comp.Name), strings.ToLower(packageFilter)) {
-							filtered = append(filtered, comp)
-						}
-					}
-					if len(filtered) == 0 {
-						continue // Skip images with no matches
-					}
-					sbom.Components = filtered
-				}
-				sboms = append(sboms, *sbom)
-			}
-			jsonData, _ := json.MarshalIndent(sboms, "", "  ")
-			fmt.Println(string(jsonData))
-			return
-		}
+	// Also get cluster-scoped SBOMs
+	clusterReports, err := trivyClient.ListClusterSbomReports(ctx)
+	if err == nil {
+		reports = append(reports, clusterReports...)
+	}
 
-		// Text output
-		totalComponents := 0
+	if o.output == "json" {
+		var sboms []trivy.SBOMReport
 		for _, report := range reports {
 			sbom, err := trivyClient.ParseSBOMReport(report)
 			if err != nil {
 				continue
 			}
-
-			// Filter by package name if specified
-			if packageFilter != "" {
+			// Apply package filter to JSON output too
+			if o.packageName != "" {
+				var filtered []trivy.SBOMComponent
 				for _, comp := range sbom.Components {
-					if strings.Contains(strings.ToLower(comp.Name), strings.ToLower(packageFilter)) {
-						fmt.Printf("%s: %s %s (%s)\n", sbom.Image, comp.Name, comp.Version, comp.Type)
-						totalComponents++
+					if strings.Contains(strings.ToLower(comp.Name), strings.ToLower(o.packageName)) {
+						filtered = append(filtered, comp)
 					}
 				}
-			} else {
-				fmt.Printf("\n%s (%d components)\n", sbom.Image, len(sbom.Components))
-				totalComponents += len(sbom.Components)
-				if showDetails {
-					for _, comp := range sbom.Components {
-						fmt.Printf("  - %s %s (%s)\n", comp.Name, comp.Version, comp.Type)
-					}
+				if len(filtered) == 0 {
+					continue // Skip images with no matches
 				}
+				sbom.Components = filtered
 			}
+			sboms = append(sboms, *sbom)
 		}
+		jsonData, _ := json.MarshalIndent(sboms, "", "  ")
+		fmt.Println(string(jsonData))
+		return nil
+	}
 
-		if packageFilter == "" {
-			fmt.Printf("\nTotal: %d images, %d components\n", len(reports), totalComponents)
+	// Text output
+	totalComponents := 0
+	for _, report := range reports {
+		sbom, err := trivyClient.ParseSBOMReport(report)
+		if err != nil {
+			continue
+		}
+
+		// Filter by package name if specified
+		if o.packageName != "" {
+			for _, comp := range sbom.Components {
+				if strings.Contains(strings.ToLower(comp.Name), strings.ToLower(o.packageName)) {
+					fmt.Printf("%s: %s %s (%s)\n", sbom.Image, comp.Name, comp.Version, comp.Type)
+					totalComponents++
+				}
+			}
 		} else {
-			fmt.Printf("\nFound %d matches for '%s'\n", totalComponents, packageFilter)
+			fmt.Printf("\n%s (%d components)\n", sbom.Image, len(sbom.Components))
+			totalComponents += len(sbom.Components)
+			if o.details {
+				for _, comp := range sbom.Components {
+					fmt.Printf("  - %s %s (%s)\n", comp.Name, comp.Version, comp.Type)
+				}
+			}
 		}
-	},
-}
+	}
 
-func init() {
-	rootCmd.AddCommand(queryCmd)
-	queryCmd.AddCommand(queryVulnsCmd)
-	queryCmd.AddCommand(queryComplianceCmd)
-	queryCmd.AddCommand(queryFindingsCmd)
-	queryCmd.AddCommand(querySbomCmd)
-	queryCmd.AddCommand(querySummaryCmd)
-	queryCmd.AddCommand(queryNetworkCmd)
-
-	// Global flag for all query subcommands
-	queryCmd.PersistentFlags().StringVarP(&namespace, "namespace", "n", "default", "Kubernetes namespace")
-	queryCmd.PersistentFlags().BoolVarP(&allNamespaces, "all-namespaces", "A", false, "Query across all namespaces")
-	queryCmd.PersistentFlags().StringVarP(&output, "output", "o", "", "Output format (json)")
-	querySbomCmd.Flags().StringVar(&packageFilter, "package", "", "Filter by package name")
-	querySbomCmd.Flags().BoolVarP(&showDetails, "details", "d", false, "Show all components")
-	queryVulnsCmd.Flags().BoolVarP(&showDetails, "details", "d", false, "Show detailed CVE information")
-	queryFindingsCmd.Flags().BoolVar(&showFull, "full", false, "Include full RawData in JSON output")
+	if o.packageName == "" {
+		fmt.Printf("\nTotal: %d images, %d components\n", len(reports), totalComponents)
+	} else {
+		fmt.Printf("\nFound %d matches for '%s'\n", totalComponents, o.packageName)
+	}
+	return nil
 }
@@ -0,0 +1,195 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+// stubCluster serves empty lists for every request and records the paths.
+// KUBECONFIG points at it for the rest of the test.
+func stubCluster(t *testing.T) func() []string {
+	t.Helper()
+	var mu sync.Mutex
+	var paths []string
+	serveCluster(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"apiVersion":"v1","kind":"List","items":[]}`)
+	})
+
+	return func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		got := paths
+		paths = nil
+		return got
+	}
+}
+
+// serveCluster serves the API with handler and points KUBECONFIG at it
+// for the rest of the test
+func serveCluster(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	kubeconfig := filepath.Join(t.TempDir(), "config")
+	data := `apiVersion: v1
+kind: Config
+clusters:
+- name: stub
+  cluster:
+    server: ` + srv.URL + `
+contexts:
+- name: stub
+  context:
+    cluster: stub
+    user: stub
+current-context: stub
+users:
+- name: stub
+  user:
+    token: test
+`
+	if err := os.WriteFile(kubeconfig, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("KUBECONFIG", kubeconfig)
+}
+
+// runQuiet runs a fresh command tree with output discarded and returns it
+func runQuiet(t *testing.T, args ...string) *cobra.Command {
+	t.Helper()
+	stdout := os.Stdout
+	devnull, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = devnull
+	defer func() {
+		os.Stdout = stdout
+		_ = devnull.Close()
+	}()
+	root := newRootCmd()
+	root.SetOut(io.Discard)
+	root.SetErr(io.Discard)
+	if err := execute(context.Background(), root, args); err != nil {
+		t.Fatalf("trix %s: %v", strings.Join(args, " "), err)
+	}
+	return root
+}
+
+func TestQuerySubcommandsDoNotShareFlags(t *testing.T) {
+	requests := stubCluster(t)
+
+	runQuiet(t, "query", "vulns", "--namespace", "team-a", "--all-namespaces", "--details", "--output", "json")
+	for _, p := range requests() {
+		if strings.Contains(p, "/namespaces/") {
+			t.Errorf("query vulns -A requested %s, want a cluster-wide list", p)
+		}
+	}
+
+	// The second command sees its own defaults, not the first run's flags
+	root := runQuiet(t, "query", "compliance", "--output", "json")
+	paths := requests()
+	if len(paths) == 0 {
+		t.Fatal("query compliance made no requests")
+	}
+	for _, p := range paths {
+		if !strings.Contains(p, "/namespaces/default/") {
+			t.Errorf("query compliance requested %s, want the default namespace", p)
+		}
+	}
+	compliance, _, err := root.Find([]string{"query", "compliance"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if details, _ := compliance.Flags().GetBool("details"); details {
+		t.Error("query compliance ran with --details set")
+	}
+}
+
+// query findings -o json leaves out rawData unless --full is set
+func TestQueryFindingsFull(t *testing.T) {
+	serveCluster(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/vulnerabilityreports") {
+			_, _ = io.WriteString(w, vulnReportList)
+			return
+		}
+		_, _ = io.WriteString(w, `{"apiVersion":"v1","kind":"List","items":[]}`)
+	})
+
+	for _, full := range []bool{false, true} {
+		args := []string{"query", "findings", "-A", "-o", "json"}
+		if full {
+			args = append(args, "--full")
+		}
+		out, err := runCommand(t, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var findings []map[string]interface{}
+		if err := json.Unmarshal([]byte(out), &findings); err != nil || len(findings) != 1 {
+			t.Fatalf("--full=%v: %d findings, %v:\n%s", full, len(findings), err, out)
+		}
+		raw, ok := findings[0]["rawData"].(map[string]interface{})
+		if ok != full {
+			t.Errorf("--full=%v: rawData = %v", full, findings[0]["rawData"])
+		}
+		if full && (raw["vulnerabilityID"] != "CVE-2024-0001" || raw["fixedVersion"] != "3.0.8") {
+			t.Errorf("rawData = %v", raw)
+		}
+	}
+}
+
+// query summary --namespaced-only leaves out cluster-scoped findings
+func TestQuerySummaryNamespacedOnly(t *testing.T) {
+	serveCluster(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/namespaces/payments/vulnerabilityreports"):
+			_, _ = io.WriteString(w, vulnReportList)
+		case strings.HasSuffix(r.URL.Path, "/clusterrbacassessmentreports"):
+			_, _ = io.WriteString(w, `{"apiVersion":"aquasecurity.github.io/v1alpha1","kind":"ClusterRbacAssessmentReportList","items":[{
+				"metadata":{"name":"clusterrole-admin"},
+				"report":{"checks":[{"checkID":"KSV046","title":"Manage all resources","severity":"CRITICAL","success":false}]}
+			}]}`)
+		default:
+			_, _ = io.WriteString(w, `{"apiVersion":"v1","kind":"List","items":[]}`)
+		}
+	})
+
+	for _, tt := range []struct {
+		namespacedOnly bool
+		want           int
+	}{{false, 2}, {true, 1}} {
+		args := []string{"query", "summary", "-n", "payments", "-o", "json"}
+		if tt.namespacedOnly {
+			args = append(args, "--namespaced-only")
+		}
+		out, err := runCommand(t, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var summary Summary
+		if err := json.Unmarshal([]byte(out), &summary); err != nil {
+			t.Fatalf("%v:\n%s", err, out)
+		}
+		if summary.TotalFindings != tt.want {
+			t.Errorf("--namespaced-only=%v: %d findings, want %d", tt.namespacedOnly, summary.TotalFindings, tt.want)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/trixsec-dev/trix/internal/server"
+	"github.com/trixsec-dev/trix/internal/ui"
+)
+
+// queryTrendsOptions holds the flags of trix query trends
+type queryTrendsOptions struct {
+	*queryOptions
+	serverURL string
+	token     string
+	window    string
+	bucket    string
+}
+
+func newQueryTrendsCmd(q *queryOptions) *cobra.Command {
+	o := &queryTrendsOptions{queryOptions: q}
+	cmd := &cobra.Command{
+		Use:   "trends",
+		Short: "Show vulnerability trends from a trix server",
+		Long: `Fetch open vulnerability counts over time from a running trix serve
+	instance (GET /api/v1/trends) and render them as a table with a sparkline.
+
+	The server URL and API token default to TRIX_SERVER_URL and TRIX_API_TOKEN.
+
+	Examples:
+	  trix query trends --server-url http://trix.trix-system:8080
+	  trix query trends --window 7d --bucket 6h
+	  trix query trends -o json`,
+		Args: cobra.NoArgs,
+		RunE: o.run,
+	}
+	cmd.Flags().StringVar(&o.serverURL, "server-url", "", "trix server URL (default: $TRIX_SERVER_URL)")
+	cmd.Flags().StringVar(&o.token, "token", "", "API bearer token (default: $TRIX_API_TOKEN)")
+	cmd.Flags().StringVar(&o.window, "window", "30d", "How far back to look, e.g. 30d or 12h")
+	cmd.Flags().StringVar(&o.bucket, "bucket", "1d", "One point per bucket, e.g. 1d or 1h")
+	return cmd
+}
+
+func (o *queryTrendsOptions) run(cmd *cobra.Command, args []string) error {
+	if o.serverURL == "" {
+		o.serverURL = os.Getenv("TRIX_SERVER_URL")
+	}
+	if o.token == "" {
+		o.token = os.Getenv("TRIX_API_TOKEN")
+	}
+	if o.serverURL == "" {
+		return fmt.Errorf("--server-url (or TRIX_SERVER_URL) is required")
+	}
+
+	trends, err := fetchTrends(cmd.Context(), o.serverURL, o.token, o.window, o.bucket)
+	if err != nil {
+		return err
+	}
+
+	if o.output == "json" {
+		jsonData, err := json.MarshalIndent(trends, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		fmt.Println(string(jsonData))
+		return nil
+	}
+
+	if len(trends.Points) == 0 {
+		fmt.Printf("No snapshots in the last %s\n", trends.Window)
+		return nil
+	}
+
+	var critical, open []int
+	table := ui.NewTable("TIME", "OPEN", "CRITICAL", "HIGH", "MEDIUM", "LOW", "FIXED")
+	for _, p := range trends.Points {
+		critical = append(critical, p.BySeverity["CRITICAL"])
+		open = append(open, p.TotalOpen)
+		table.AddRow(
+			p.Time.Local().Format("2006-01-02 15:04"),
+			fmt.Sprintf("%d", p.TotalOpen),
+			fmt.Sprintf("%d", p.BySeverity["CRITICAL"]),
+			fmt.Sprintf("%d", p.BySeverity["HIGH"]),
+			fmt.Sprintf("%d", p.BySeverity["MEDIUM"]),
+			fmt.Sprintf("%d", p.BySeverity["LOW"]),
+			fmt.Sprintf("%d", p.TotalFixed),
+		)
+	}
+
+	fmt.Printf("Window %s, one point per %s\n\n", trends.Window, trends.Bucket)
+	fmt.Printf("  Open critical  %s\n", sparkline(critical))
+	fmt.Printf("  Open total     %s\n\n", sparkline(open))
+	fmt.Print(table.Render())
+	return nil
+}
+
+// fetchTrends calls GET /api/v1/trends on a trix server
+func fetchTrends(ctx context.Context, serverURL, token, window, bucket string) (*server.APITrends, error) {
+	q := url.Values{}
+	if window != "" {
+		q.Set("window", window)
+	}
+	if bucket != "" {
+		q.Set("bucket", bucket)
+	}
+	endpoint := strings.TrimSuffix(serverURL, "/") + "/api/v1/trends?" + q.Encode()
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach trix server: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr server.APIError
+		if json.NewDecoder(resp.Body).Decode(&apiErr) == nil && apiErr.Error != "" {
+			return nil, fmt.Errorf("server returned %d: %s", resp.StatusCode, apiErr.Error)
+		}
+		return nil, fmt.Errorf("server returned %d", resp.StatusCode)
+	}
+
+	var trends server.APITrends
+	if err := json.NewDecoder(resp.Body).Decode(&trends); err != nil {
+		return nil, fmt.Errorf("invalid response from trix server: %w", err)
+	}
+	return &trends, nil
+}
+
+// sparkline renders values as a row of block characters scaled to the maximum
+func sparkline(values []int) string {
+	const ticks = "▁▂▃▄▅▆▇█"
+	blocks := []rune(ticks)
+
+	maxValue := 0
+	for _, v := range values {
+		maxValue = max(maxValue, v)
+	}
+
+	var b strings.Builder
+	for _, v := range values {
+		i := 0
+		if maxValue > 0 {
+			i = v * (len(blocks) - 1) / maxValue
+		}
+		b.WriteRune(blocks[i])
+	}
+	return b.String()
+}
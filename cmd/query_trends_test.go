@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/trixsec-dev/trix/internal/server"
+)
+
+func TestSparkline(t *testing.T) {
+	tests := []struct {
+		values []int
+		want   string
+	}{
+		{[]int{0, 1, 2, 3, 4, 5, 6, 7}, "▁▂▃▄▅▆▇█"},
+		{[]int{10, 5, 0}, "█▄▁"},
+		{[]int{0, 0}, "▁▁"}, // No division by zero
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := sparkline(tt.values); got != tt.want {
+			t.Errorf("sparkline(%v) = %q, want %q", tt.values, got, tt.want)
+		}
+	}
+}
+
+func TestFetchTrends(t *testing.T) {
+	var gotAuth, gotQuery string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/trends" {
+			http.NotFound(w, r)
+			return
+		}
+		gotAuth, gotQuery = r.Header.Get("Authorization"), r.URL.RawQuery
+		if r.URL.Query().Get("bucket") == "1s" {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(server.APIError{Error: "window/bucket yields more than 1000 points"})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(server.APITrends{Window: "168h0m0s", Bucket: "6h0m0s",
+			Points: []server.TrendPoint{{TotalOpen: 4, BySeverity: map[string]int{"CRITICAL": 1}}}})
+	}))
+	defer srv.Close()
+
+	trends, err := fetchTrends(context.Background(), srv.URL+"/", "s3cret", "7d", "6h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotAuth != "Bearer s3cret" || gotQuery != "bucket=6h&window=7d" {
+		t.Errorf("request auth %q, query %q", gotAuth, gotQuery)
+	}
+	if trends.Window != "168h0m0s" || len(trends.Points) != 1 || trends.Points[0].BySeverity["CRITICAL"] != 1 {
+		t.Errorf("trends = %+v", trends)
+	}
+
+	// Server defaults when no window or bucket is given
+	if _, err := fetchTrends(context.Background(), srv.URL, "", "", ""); err != nil || gotQuery != "" || gotAuth != "" {
+		t.Errorf("default request: query %q, auth %q, err %v", gotQuery, gotAuth, err)
+	}
+
+	if _, err := fetchTrends(context.Background(), srv.URL, "", "365d", "1s"); err == nil ||
+		err.Error() != "server returned 400: window/bucket yields more than 1000 points" {
+		t.Errorf("API error = %v", err)
+	}
+	if _, err := fetchTrends(context.Background(), srv.URL+"/missing", "", "", ""); err == nil ||
+		!strings.HasPrefix(err.Error(), "server returned 404") {
+		t.Errorf("404 error = %v", err)
+	}
+}
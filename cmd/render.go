@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/charmbracelet/glamour"
+	"github.com/spf13/cobra"
+	"github.com/trixsec-dev/trix/internal/ui"
+	"golang.org/x/term"
+)
+
+// renderOptions holds the flags that control how LLM answers are printed.
+// A nil *renderOptions prints plain markdown.
+type renderOptions struct {
+	plain bool
+
+	// renderer is created on first use; nil means print plain text
+	renderer     *glamour.TermRenderer
+	rendererOnce sync.Once
+}
+
+// Word wrap bounds for rendered markdown
+const (
+	defaultWrapWidth = 100
+	minWrapWidth     = 40
+	maxWrapWidth     = 120
+)
+
+// addRenderFlags registers flags that control how LLM answers are printed
+func addRenderFlags(cmd *cobra.Command, o *renderOptions) {
+	cmd.Flags().BoolVar(&o.plain, "plain", false, "Print answers as plain markdown without terminal styling")
+}
+
+// useMarkdownRenderer reports whether answers should be styled with glamour.
+// Styling is only applied on a terminal; pipes and files get plain markdown
+// so no ANSI escapes leak into them.
+func useMarkdownRenderer(plain, isTTY bool) bool {
+	return !plain && isTTY
+}
+
+// wrapWidth returns the word wrap for a terminal of the given width
+// (0 if unknown), leaving a small margin and staying readable on wide screens
+func wrapWidth(termWidth int) int {
+	if termWidth <= 0 {
+		return defaultWrapWidth
+	}
+	width := termWidth - 2
+	if width < minWrapWidth {
+		return minWrapWidth
+	}
+	if width > maxWrapWidth {
+		return maxWrapWidth
+	}
+	return width
+}
+
+// getRenderer returns the markdown renderer, or nil for plain output.
+// The decision is made once; a failed glamour setup is not retried.
+func (o *renderOptions) getRenderer() *glamour.TermRenderer {
+	if o == nil {
+		return nil
+	}
+	o.rendererOnce.Do(func() {
+		fd := int(os.Stdout.Fd())
+		termWidth := 0
+		if w, _, err := term.GetSize(fd); err == nil {
+			termWidth = w
+		}
+		o.renderer = newRenderer(o.plain, ui.ColorDisabled(), term.IsTerminal(fd), termWidth)
+	})
+	return o.renderer
+}
+
+// newRenderer creates a glamour renderer wrapped to the terminal width, or
+// returns nil for plain output or when glamour fails to initialize
+func newRenderer(plain, noColor, isTTY bool, termWidth int) *glamour.TermRenderer {
+	if !useMarkdownRenderer(plain, isTTY) {
+		return nil
+	}
+
+	style := glamour.WithAutoStyle()
+	if noColor {
+		style = glamour.WithStandardStyle("notty")
+	}
+	r, err := glamour.NewTermRenderer(style, glamour.WithWordWrap(wrapWidth(termWidth)))
+	if err != nil {
+		return nil // Fall back to plain text
+	}
+	return r
+}
+
+// printResponse renders markdown response to terminal
+func (o *renderOptions) printResponse(response string) {
+	o.fprintResponse(os.Stdout, response)
+}
+
+// fprintResponse renders markdown response to w
+func (o *renderOptions) fprintResponse(w io.Writer, response string) {
+	if r := o.getRenderer(); r != nil {
+		out, err := r.Render(response)
+		if err == nil {
+			_, _ = fmt.Fprint(w, out)
+			return
+		}
+	}
+	// Fallback to plain text
+	_, _ = fmt.Fprintln(w, response)
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestUseMarkdownRenderer(t *testing.T) {
+	tests := []struct {
+		name  string
+		plain bool
+		isTTY bool
+		want  bool
+	}{
+		{"terminal", false, true, true},
+		{"pipe", false, false, false},
+		{"--plain on a terminal", true, true, false},
+		{"--plain into a pipe", true, false, false},
+	}
+	for _, tt := range tests {
+		if got := useMarkdownRenderer(tt.plain, tt.isTTY); got != tt.want {
+			t.Errorf("%s: useMarkdownRenderer = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWrapWidth(t *testing.T) {
+	tests := []struct {
+		termWidth int
+		want      int
+	}{
+		{0, defaultWrapWidth}, // Unknown width
+		{-1, defaultWrapWidth},
+		{20, minWrapWidth},
+		{42, 40},
+		{80, 78},
+		{122, 120},
+		{300, maxWrapWidth},
+	}
+	for _, tt := range tests {
+		if got := wrapWidth(tt.termWidth); got != tt.want {
+			t.Errorf("wrapWidth(%d) = %d, want %d", tt.termWidth, got, tt.want)
+		}
+	}
+}
+
+func TestNewRenderer(t *testing.T) {
+	// noColor gives a stable style without ANSI colors
+	if newRenderer(false, true, false, 80) != nil {
+		t.Error("renderer created for a pipe")
+	}
+	if newRenderer(true, true, true, 80) != nil {
+		t.Error("renderer created despite --plain")
+	}
+
+	r := newRenderer(false, true, true, 50)
+	if r == nil {
+		t.Fatal("no renderer on a terminal")
+	}
+	out, err := r.Render(strings.Repeat("remediate the exposed workload ", 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimRight(out, "\n"), "\n")
+	if len(lines) < 3 {
+		t.Errorf("long paragraph not wrapped: %q", out)
+	}
+	for _, line := range lines {
+		if n := utf8.RuneCountInString(strings.TrimRight(line, " ")); n > wrapWidth(50) {
+			t.Errorf("line of %d columns exceeds the wrap width %d: %q", n, wrapWidth(50), line)
+		}
+	}
+}
+
+// Under go test stdout is not a terminal, so answers print as plain markdown
+// and the decision is not revisited
+func TestGetRendererPipe(t *testing.T) {
+	o := &renderOptions{}
+	if o.getRenderer() != nil {
+		t.Fatal("renderer created for a non-terminal stdout")
+	}
+	if o.getRenderer() != nil {
+		t.Error("renderer decision changed between calls")
+	}
+
+	for _, o := range []*renderOptions{o, nil} {
+		var out strings.Builder
+		o.fprintResponse(&out, "# Fix\n\n**Upgrade** openssl")
+		if out.String() != "# Fix\n\n**Upgrade** openssl\n" {
+			t.Errorf("plain response = %q", out.String())
+		}
+		if strings.Contains(out.String(), "\x1b[") {
+			t.Error("ANSI escapes in plain output")
+		}
+	}
+}
@@ -1,22 +1,74 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/spf13/cobra"
+	"github.com/trixsec-dev/trix/internal/ui"
 )
 
-var rootCmd = &cobra.Command{
-	Use:   "trix",
-	Short: "Kubernetes security scanner",
-	Long: `trix scans your Kubernetes clusters for vulnerabilities
+// newRootCmd builds the trix command tree. Flag values live in the options
+// of each command, so every tree starts from the defaults.
+func newRootCmd() *cobra.Command {
+	var noColor bool
+	cmd := &cobra.Command{
+		Use:   "trix",
+		Short: "Kubernetes security scanner",
+		Long: `trix scans your Kubernetes clusters for vulnerabilities
 and compliance issues using Trivy and custom CIS checks.`,
+		// Execute prints errors; usage is only shown for flag and argument errors
+		SilenceErrors: true,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			// Flags and args parsed fine, so a later error is not a usage error
+			cmd.SilenceUsage = true
+			if noColor {
+				ui.DisableColor()
+			}
+		},
+	}
+	cmd.PersistentFlags().BoolVar(&noColor, "no-color", false, "Disable colored output")
+
+	cmd.AddCommand(
+		newAskCmd(),
+		newExplainCmd(),
+		newInvestigateCmd(),
+		newQueryCmd(),
+		newScanCmd(),
+		newServeCmd(),
+		newStatusCmd(),
+		newTriageCmd(),
+		newVersionCmd(),
+	)
+	return cmd
 }
 
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Fprintln(os.Stderr, err)
+	// Ctrl-C cancels cmd.Context(); commands stop and print what they have.
+	// serve handles its own signals for a graceful shutdown.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop() // A second Ctrl-C exits immediately
+	}()
+
+	if err := execute(ctx, newRootCmd(), os.Args[1:]); err != nil {
+		if ctx.Err() != nil && errors.Is(err, context.Canceled) {
+			fmt.Fprintln(os.Stderr, "Interrupted")
+			os.Exit(130)
+		}
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 }
+
+// execute runs the command tree root with args
+func execute(ctx context.Context, root *cobra.Command, args []string) error {
+	root.SetArgs(args)
+	return root.ExecuteContext(ctx)
+}
@@ -0,0 +1,262 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// forbiddenCluster answers every request with 403, like a cluster the
+// kubeconfig user has no access to
+func forbiddenCluster(t *testing.T) {
+	t.Helper()
+	serveCluster(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = io.WriteString(w, `{"apiVersion":"v1","kind":"Status","status":"Failure","message":"access denied","reason":"Forbidden","code":403}`)
+	})
+}
+
+// missingKubeconfig points KUBECONFIG at a file that doesn't exist
+func missingKubeconfig(t *testing.T) {
+	t.Helper()
+	t.Setenv("KUBECONFIG", filepath.Join(t.TempDir(), "missing"))
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+}
+
+// runCommand runs execute and returns what it printed, cobra's output last
+func runCommand(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	root := newRootCmd()
+	root.SetOut(&out)
+	root.SetErr(&out)
+	var err error
+	stdout := captureStdout(t, func() { err = execute(context.Background(), root, args) })
+	return stdout + out.String(), err
+}
+
+func TestCommandErrors(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"query", "vulns"}, "failed to list vulnerability reports: "},
+		{[]string{"query", "compliance"}, "failed to list compliance reports: "},
+		{[]string{"query", "findings"}, "all scanners failed: "},
+		{[]string{"query", "summary"}, "all scanners failed: "},
+		{[]string{"query", "network"}, "failed to analyze coverage: "},
+		{[]string{"query", "sbom"}, "failed to list SBOM reports: "},
+		{[]string{"status"}, "trivy operator is not available"},
+	}
+	for _, tt := range tests {
+		name := strings.Join(tt.args, " ")
+		t.Run(name, func(t *testing.T) {
+			forbiddenCluster(t)
+			out, err := runCommand(t, tt.args...)
+			if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+				t.Errorf("trix %s: err = %v, want %q", name, err, tt.want)
+			}
+			if strings.Contains(out, "Usage:") {
+				t.Errorf("trix %s printed usage for a runtime error:\n%s", name, out)
+			}
+		})
+
+		t.Run(name+" without kubeconfig", func(t *testing.T) {
+			missingKubeconfig(t)
+			if _, err := runCommand(t, tt.args...); err == nil || !strings.HasPrefix(err.Error(), "failed to create k8s client: ") {
+				t.Errorf("trix %s: err = %v", name, err)
+			}
+		})
+	}
+}
+
+// Flag and argument errors still show usage
+func TestCommandUsageErrors(t *testing.T) {
+	out, err := runCommand(t, "query", "findings", "--no-such-flag")
+	if err == nil || !strings.Contains(err.Error(), "unknown flag: --no-such-flag") {
+		t.Errorf("err = %v", err)
+	}
+	if !strings.Contains(out, "Usage:") {
+		t.Errorf("no usage for a flag error:\n%s", out)
+	}
+}
+
+// scan carries on past failed deletions and reports them at the end
+func TestScanDeleteFailures(t *testing.T) {
+	serveCluster(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = io.WriteString(w, `{"apiVersion":"v1","kind":"Status","status":"Failure","code":500}`)
+			return
+		}
+		_, _ = io.WriteString(w, `{"apiVersion":"v1","kind":"List","items":[{"apiVersion":"v1","kind":"Report","metadata":{"name":"r"}}]}`)
+	})
+
+	out, err := runCommand(t, "scan", "vulns", "--yes")
+	if err == nil || !strings.HasPrefix(err.Error(), "2 deletions failed: failed to delete vulnerabilityreports: ") {
+		t.Errorf("err = %v", err)
+	}
+	if !strings.Contains(out, "Deleted 0 reports.") {
+		t.Errorf("output:\n%s", out)
+	}
+}
+
+// TestExecuteExitCode runs Execute in a child process, as main does.
+func TestExecuteExitCode(t *testing.T) {
+	if args := os.Getenv("TRIX_TEST_EXECUTE"); args != "" {
+		os.Args = append([]string{"trix"}, strings.Fields(args)...)
+		Execute()
+		os.Exit(0)
+	}
+
+	run := func(args string) (int, string) {
+		t.Helper()
+		cmd := exec.Command(os.Args[0], "-test.run=^TestExecuteExitCode$")
+		cmd.Env = append(os.Environ(), "TRIX_TEST_EXECUTE="+args)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		err := cmd.Run()
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode(), stderr.String()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return 0, stderr.String()
+	}
+
+	missingKubeconfig(t)
+	if code, stderr := run("query findings"); code != 1 || !strings.HasPrefix(stderr, "Error: failed to create k8s client: ") {
+		t.Errorf("invalid kubeconfig: exit %d, stderr %q", code, stderr)
+	}
+
+	forbiddenCluster(t)
+	if code, stderr := run("query findings"); code != 1 || !strings.Contains(stderr, "\nError: all scanners failed: ") {
+		t.Errorf("forbidden: exit %d, stderr %q", code, stderr)
+	}
+
+	stubCluster(t)
+	if code, stderr := run("query findings"); code != 0 || strings.Contains(stderr, "Error:") {
+		t.Errorf("empty cluster: exit %d, stderr %q", code, stderr)
+	}
+}
+
+// vulnReportList is one VulnerabilityReport with a CRITICAL openssl CVE
+const vulnReportList = `{"apiVersion":"aquasecurity.github.io/v1alpha1","kind":"VulnerabilityReportList","items":[{
+	"apiVersion":"aquasecurity.github.io/v1alpha1","kind":"VulnerabilityReport",
+	"metadata":{"name":"deployment-api-app","namespace":"payments","labels":{"trivy-operator.resource.kind":"Deployment","trivy-operator.resource.name":"api","trivy-operator.container.name":"app"}},
+	"report":{"artifact":{"repository":"example/api","tag":"1.0"},"vulnerabilities":[{"vulnerabilityID":"CVE-2024-0001","resource":"openssl","installedVersion":"3.0.1","fixedVersion":"3.0.8","severity":"CRITICAL","title":"openssl flaw"}]}
+}]}`
+
+// hangingCluster serves vulnReportList for vulnerability reports and never
+// answers anything else, like an overloaded API server. The returned
+// channel receives each request left hanging.
+func hangingCluster(t *testing.T) <-chan string {
+	t.Helper()
+	hanging := make(chan string, 100)
+	done := make(chan struct{})
+	serveCluster(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/vulnerabilityreports") {
+			_, _ = io.WriteString(w, vulnReportList)
+			return
+		}
+		hanging <- r.URL.Path
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	})
+	t.Cleanup(func() { close(done) }) // Before the server closes
+	return hanging
+}
+
+// An interrupted query prints the findings gathered so far
+func TestQueryFindingsInterrupted(t *testing.T) {
+	hanging := hangingCluster(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-hanging
+		cancel()
+	}()
+
+	var errOut bytes.Buffer
+	root := newRootCmd()
+	root.SetErr(&errOut)
+	var err error
+	started := time.Now()
+	out := captureStdout(t, func() { err = execute(ctx, root, []string{"query", "findings", "-A", "-o", "json"}) })
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(started); elapsed > 10*time.Second {
+		t.Errorf("took %v to stop", elapsed)
+	}
+	var findings []struct {
+		ID string `json:"id"`
+	}
+	if jsonErr := json.Unmarshal([]byte(out), &findings); jsonErr != nil || len(findings) != 1 || findings[0].ID != "CVE-2024-0001" {
+		t.Errorf("partial output = %s (%v), want the vulnerability found before the interrupt", out, jsonErr)
+	}
+	if !strings.Contains(errOut.String(), "Warning: partial results (interrupted)") {
+		t.Errorf("stderr = %q", errOut.String())
+	}
+	if strings.Contains(errOut.String(), "scanner failed") {
+		t.Errorf("cancelled scanner reported as failed: %q", errOut.String())
+	}
+}
+
+// Ctrl-C cancels the running command, which exits 130
+func TestExecuteInterrupted(t *testing.T) {
+	hanging := hangingCluster(t)
+	cmd := exec.Command(os.Args[0], "-test.run=^TestExecuteExitCode$")
+	cmd.Env = append(os.Environ(), "TRIX_TEST_EXECUTE=query findings -A")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-hanging:
+	case <-time.After(10 * time.Second):
+		_ = cmd.Process.Kill()
+		t.Fatalf("no request reached the cluster; stderr:\n%s", stderr.String())
+	}
+	if err := cmd.Process.Signal(os.Interrupt); err != nil {
+		t.Fatal(err)
+	}
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	var err error
+	select {
+	case err = <-exited:
+	case <-time.After(10 * time.Second):
+		_ = cmd.Process.Kill()
+		t.Fatal("still running 10s after Ctrl-C")
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 130 {
+		t.Errorf("exit = %v, want 130", err)
+	}
+	if !strings.HasSuffix(stderr.String(), "Warning: partial results (interrupted)\nInterrupted\n") {
+		t.Errorf("stderr = %q", stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "Findings (1 of 1)") {
+		t.Errorf("partial findings not printed:\n%s", stdout.String())
+	}
+}
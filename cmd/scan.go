@@ -3,6 +3,7 @@ package cmd
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -12,104 +13,66 @@ import (
 	"github.com/trixsec-dev/trix/internal/tools/trivy"
 )
 
-var (
-	scanYes           bool
-	scanAllNamespaces bool
-	scanNamespace     string
-)
-
-var scanCmd = &cobra.Command{
-	Use:   "scan",
-	Short: "Trigger Trivy rescans by deleting reports",
-	Long: `Trigger Trivy Operator to rescan resources by deleting existing reports.
-When a report is deleted, Trivy Operator automatically rescans the resource.`,
-}
-
-var scanVulnsCmd = &cobra.Command{
-	Use:   "vulns",
-	Short: "Trigger vulnerability rescan",
-	Run: func(cmd *cobra.Command, args []string) {
-		runScan("vulns")
-	},
-}
-
-var scanComplianceCmd = &cobra.Command{
-	Use:   "compliance",
-	Short: "Trigger compliance rescan",
-	Run: func(cmd *cobra.Command, args []string) {
-		runScan("compliance")
-	},
+// scanOptions holds the persistent flags of trix scan
+type scanOptions struct {
+	yes           bool
+	allNamespaces bool
+	namespace     string
 }
 
-var scanSecretsCmd = &cobra.Command{
-	Use:   "secrets",
-	Short: "Trigger secrets rescan",
-	Run: func(cmd *cobra.Command, args []string) {
-		runScan("secrets")
-	},
-}
-
-var scanRbacCmd = &cobra.Command{
-	Use:   "rbac",
-	Short: "Trigger RBAC rescan",
-	Run: func(cmd *cobra.Command, args []string) {
-		runScan("rbac")
-	},
-}
-
-var scanInfraCmd = &cobra.Command{
-	Use:   "infra",
-	Short: "Trigger infrastructure rescan",
-	Run: func(cmd *cobra.Command, args []string) {
-		runScan("infra")
-	},
-}
-
-var scanSbomCmd = &cobra.Command{
-	Use:   "sbom",
-	Short: "Trigger SBOM rescan",
-	Run: func(cmd *cobra.Command, args []string) {
-		runScan("sbom")
-	},
-}
+func newScanCmd() *cobra.Command {
+	o := &scanOptions{}
+	cmd := &cobra.Command{
+		Use:   "scan",
+		Short: "Trigger Trivy rescans by deleting reports",
+		Long: `Trigger Trivy Operator to rescan resources by deleting existing reports.
+When a report is deleted, Trivy Operator automatically rescans the resource.`,
+	}
 
-var scanBenchmarkCmd = &cobra.Command{
-	Use:   "benchmark",
-	Short: "Trigger benchmark rescan (CIS/NSA)",
-	Run: func(cmd *cobra.Command, args []string) {
-		runScan("benchmark")
-	},
-}
+	subcommands := []struct{ use, short string }{
+		{"vulns", "Trigger vulnerability rescan"},
+		{"compliance", "Trigger compliance rescan"},
+		{"secrets", "Trigger secrets rescan"},
+		{"rbac", "Trigger RBAC rescan"},
+		{"infra", "Trigger infrastructure rescan"},
+		{"sbom", "Trigger SBOM rescan"},
+		{"benchmark", "Trigger benchmark rescan (CIS/NSA)"},
+		{"all", "Trigger rescan of all report types"},
+	}
+	for _, sub := range subcommands {
+		scanType := sub.use
+		cmd.AddCommand(&cobra.Command{
+			Use:   sub.use,
+			Short: sub.short,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				return o.run(cmd.Context(), scanType)
+			},
+		})
+	}
 
-var scanAllCmd = &cobra.Command{
-	Use:   "all",
-	Short: "Trigger rescan of all report types",
-	Run: func(cmd *cobra.Command, args []string) {
-		runScan("all")
-	},
+	cmd.PersistentFlags().BoolVarP(&o.yes, "yes", "y", false, "Skip confirmation prompt")
+	cmd.PersistentFlags().BoolVarP(&o.allNamespaces, "all-namespaces", "A", false, "Scan across all namespaces")
+	cmd.PersistentFlags().StringVarP(&o.namespace, "namespace", "n", "default", "Kubernetes namespace")
+	return cmd
 }
 
-func runScan(scanType string) {
+func (o *scanOptions) run(ctx context.Context, scanType string) error {
 	k8sClient, err := kubectl.NewClient()
 	if err != nil {
-		fmt.Printf("Error creating k8s client: %v\n", err)
-		return
+		return fmt.Errorf("failed to create k8s client: %w", err)
 	}
 	trivyClient := trivy.NewClient(k8sClient)
 
-	ctx := context.Background()
-
 	// Determine namespace
-	ns := scanNamespace
-	if scanAllNamespaces {
+	ns := o.namespace
+	if o.allNamespaces {
 		ns = ""
 	}
 
 	// Count reports first
 	counts, err := trivyClient.CountAllReports(ctx, ns)
 	if err != nil {
-		fmt.Printf("Error counting reports: %v\n", err)
-		return
+		return fmt.Errorf("failed to count reports: %w", err)
 	}
 
 	// Calculate what will be deleted based on scan type
@@ -145,30 +108,39 @@ func runScan(scanType string) {
 
 	if toDelete == 0 {
 		fmt.Printf("No %s found to delete.\n", description)
-		return
+		return nil
 	}
 
 	// Show what will be deleted
-	nsDisplay := scanNamespace
-	if scanAllNamespaces {
+	nsDisplay := o.namespace
+	if o.allNamespaces {
 		nsDisplay = "all namespaces"
 	}
 	fmt.Printf("This will delete %d %s in %s and trigger Trivy rescans.\n", toDelete, description, nsDisplay)
 
 	// Confirm unless --yes flag
-	if !scanYes {
+	if !o.yes {
 		fmt.Print("Continue? [y/N]: ")
 		reader := bufio.NewReader(os.Stdin)
 		response, _ := reader.ReadString('\n')
 		response = strings.TrimSpace(strings.ToLower(response))
 		if response != "y" && response != "yes" {
 			fmt.Println("Aborted.")
-			return
+			return nil
 		}
 	}
 
-	// Perform the deletion
+	// Perform the deletion, carrying on past failures so one missing CRD
+	// doesn't stop the rest
 	var deleted int
+	var errs []error
+	deleteWithCount := func(count int, err error) int {
+		if err != nil {
+			errs = append(errs, err)
+			return 0
+		}
+		return count
+	}
 
 	switch scanType {
 	case "vulns":
@@ -204,29 +176,8 @@ func runScan(scanType string) {
 	}
 
 	fmt.Printf("Deleted %d reports. Trivy Operator will rescan automatically.\n", deleted)
-}
-
-func deleteWithCount(count int, err error) int {
-	if err != nil {
-		fmt.Printf("Warning: %v\n", err)
-		return 0
+	if len(errs) > 0 {
+		return fmt.Errorf("%d deletions failed: %w", len(errs), errors.Join(errs...))
 	}
-	return count
-}
-
-func init() {
-	rootCmd.AddCommand(scanCmd)
-	scanCmd.AddCommand(scanVulnsCmd)
-	scanCmd.AddCommand(scanComplianceCmd)
-	scanCmd.AddCommand(scanSecretsCmd)
-	scanCmd.AddCommand(scanRbacCmd)
-	scanCmd.AddCommand(scanInfraCmd)
-	scanCmd.AddCommand(scanSbomCmd)
-	scanCmd.AddCommand(scanBenchmarkCmd)
-	scanCmd.AddCommand(scanAllCmd)
-
-	// Flags for scan command
-	scanCmd.PersistentFlags().BoolVarP(&scanYes, "yes", "y", false, "Skip confirmation prompt")
-	scanCmd.PersistentFlags().BoolVarP(&scanAllNamespaces, "all-namespaces", "A", false, "Scan across all namespaces")
-	scanCmd.PersistentFlags().StringVarP(&scanNamespace, "namespace", "n", "default", "Kubernetes namespace")
+	return nil
 }
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/trixsec-dev/trix/internal/server"
+)
+
+func TestRunMigrationsMemory(t *testing.T) {
+	t.Setenv(server.ConfigFileEnv, "")
+	t.Setenv("TRIX_DATABASE_URL", "memory://")
+	cfg, err := server.LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var logs bytes.Buffer
+	if err := runMigrations(cfg, slog.New(slog.NewTextHandler(&logs, nil))); err != nil {
+		t.Fatalf("--migrate-only on memory:// = %v", err)
+	}
+	if !strings.Contains(logs.String(), "nothing to migrate") {
+		t.Errorf("logs = %s", logs.String())
+	}
+}
+
+// --migrate-only fails, rather than serving, when the database is unusable
+func TestRunMigrationsInvalidURL(t *testing.T) {
+	t.Setenv(server.ConfigFileEnv, "")
+	t.Setenv("TRIX_DATABASE_URL", "mysql://trix@db")
+	cfg, err := server.LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := runMigrations(cfg, slog.New(slog.DiscardHandler)); err == nil || !strings.Contains(err.Error(), "database name is required") {
+		t.Errorf("runMigrations err = %v", err)
+	}
+}
+
+// captureStdout returns what fn writes to os.Stdout
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	f, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = f
+	defer func() { os.Stdout = stdout }()
+	fn()
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestValidateTemplates(t *testing.T) {
+	t.Setenv(server.ConfigFileEnv, "")
+	t.Setenv("TRIX_TEMPLATE_DIR", "")
+	if err := validateTemplates(); err == nil || err.Error() != "TRIX_TEMPLATE_DIR is not set" {
+		t.Errorf("without TRIX_TEMPLATE_DIR: err = %v", err)
+	}
+
+	t.Setenv("TRIX_TEMPLATE_DIR", filepath.Join("..", "internal", "server", "testdata", "templates"))
+	var err error
+	out := captureStdout(t, func() { err = validateTemplates() })
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"== slack.tmpl\n*sample-cluster*: 3 new", "== webhook.tmpl\n{", "== email.tmpl\nSubject: [SAMPLE-CLUSTER] 3 new vulnerabilities", "Templates OK\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "webhook.tmpl"), []byte(`{"new": {{.NewCount}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TRIX_TEMPLATE_DIR", dir)
+	if err := validateTemplates(); err == nil || !strings.Contains(err.Error(), "webhook.tmpl") {
+		t.Errorf("broken template: err = %v", err)
+	}
+}
+
+func TestServePrintConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trix.yaml")
+	if err := os.WriteFile(path, []byte("database:\n  url: memory://\nserver:\n  api_token: s3cr3t\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(server.ConfigFileEnv, path)
+	t.Setenv("TRIX_DATABASE_URL", "")
+	t.Setenv("TRIX_API_TOKEN", "")
+	t.Setenv("TRIX_POLL_INTERVAL", "15m")
+
+	out, err := runCommand(t, "serve", "--print-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"url: memory://\n", "interval: 15m # TRIX_POLL_INTERVAL\n", "api_token: REDACTED\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "s3cr3t") {
+		t.Errorf("output contains the API token:\n%s", out)
+	}
+}
@@ -1,7 +1,6 @@
 package cmd
 
 import (
-	"context"
 	"fmt"
 
 	"github.com/spf13/cobra"
@@ -9,36 +8,35 @@ import (
 	"github.com/trixsec-dev/trix/internal/tools/trivy"
 )
 
-var statusCmd = &cobra.Command{
-	Use:   "status",
-	Short: "Check status of security tools in the cluster",
-	Long:  `Verify that Trivy Operator and other security tools are installed and working.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		k8sClient, err := kubectl.NewClient()
-		if err != nil {
-			fmt.Printf("Error creating k8s client: %v\n", err)
-			return
-		}
-		trivyClient := trivy.NewClient(k8sClient)
+func newStatusCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Check status of security tools in the cluster",
+		Long:  `Verify that Trivy Operator and other security tools are installed and working.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			k8sClient, err := kubectl.NewClient()
+			if err != nil {
+				return fmt.Errorf("failed to create k8s client: %w", err)
+			}
+			trivyClient := trivy.NewClient(k8sClient)
 
-		ctx := context.Background()
-		fmt.Println("Checking security tooling status..")
+			ctx := cmd.Context()
+			fmt.Println("Checking security tooling status..")
 
-		// Check Trivy Operator
-		trivyOk, trivyVersion := trivyClient.CheckTrivyOperator(ctx)
-		if trivyOk {
-			fmt.Printf("✅ Trivy Operator: installed (version: %s)\n", trivyVersion)
+			// Check Trivy Operator
+			trivyOk, trivyVersion := trivyClient.CheckTrivyOperator(ctx)
+			if trivyOk {
+				fmt.Printf("✅ Trivy Operator: installed (version: %s)\n", trivyVersion)
 
-			// Simple version check (works for 0.x.y format)
-			if trivyVersion != "unknown" && trivyVersion < trivy.MinTrivyOperatorVersion {
-				fmt.Printf("   ⚠️  Warning: version %s is below minimum %s\n", trivyVersion, trivy.MinTrivyOperatorVersion)
+				// Simple version check (works for 0.x.y format)
+				if trivyVersion != "unknown" && trivyVersion < trivy.MinTrivyOperatorVersion {
+					fmt.Printf("   ⚠️  Warning: version %s is below minimum %s\n", trivyVersion, trivy.MinTrivyOperatorVersion)
+				}
+			} else {
+				fmt.Printf("❌ Trivy Operator: not found or not working\n")
+				return fmt.Errorf("trivy operator is not available")
 			}
-		} else {
-			fmt.Printf("❌ Trivy Operator: not found or not working\n")
-		}
-	},
-}
-
-func init() {
-	rootCmd.AddCommand(statusCmd)
+			return nil
+		},
+	}
 }
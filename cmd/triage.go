@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/trixsec-dev/trix/internal/llm"
+	"github.com/trixsec-dev/trix/internal/tools/exposure"
+	"github.com/trixsec-dev/trix/internal/tools/kubectl"
+	"github.com/trixsec-dev/trix/internal/tools/trivy"
+	"github.com/trixsec-dev/trix/internal/triage"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const triagePrompt = `You are a Kubernetes security engineer presenting a remediation plan to the team that owns the cluster.
+The plan below was ranked deterministically (severity x exposure x fixability); do not reorder it.
+
+Write a short markdown introduction (at most two paragraphs) that explains what to do first and why,
+then one sentence per action saying what the change is and what it protects against.
+Do not invent versions, images, or workloads that are not in the plan.
+NEVER use emojis. NEVER end with a question.`
+
+// TriagePlan is the output of trix triage
+type TriagePlan struct {
+	BySeverity map[string]int  `json:"bySeverity"` // CRITICAL and HIGH findings considered
+	Workloads  int             `json:"workloads"`  // Distinct resources affected
+	Total      int             `json:"totalActions"`
+	Actions    []triage.Action `json:"actions"`
+	Narrative  string          `json:"narrative,omitempty"`
+}
+
+// triageOptions holds the flags of trix triage
+type triageOptions struct {
+	llm       llmOptions
+	namespace string
+	top       int
+	format    string
+	useLLM    bool
+}
+
+func newTriageCmd() *cobra.Command {
+	o := &triageOptions{}
+	cmd := &cobra.Command{
+		Use:   "triage",
+		Short: "Produce a prioritized remediation plan",
+		Long: `Rank CRITICAL and HIGH findings into a remediation plan.
+
+Findings are grouped into actions (upgrade a package in an image, change a
+configuration, remove a secret) and scored by severity x exposure x
+fixability, summed over everything an action resolves. The ranking is
+deterministic and needs no LLM; --llm additionally asks the model to write
+a narrative for the plan.
+
+Examples:
+  trix triage
+  trix triage -n payments --top 5
+  trix triage --format json > plan.json
+  trix triage --llm`,
+		Args: cobra.NoArgs,
+		RunE: o.run,
+	}
+	cmd.Flags().StringVarP(&o.namespace, "namespace", "n", "", "Only triage this namespace (default: all namespaces)")
+	cmd.Flags().IntVar(&o.top, "top", 10, "Number of actions to show (0 = all)")
+	cmd.Flags().StringVar(&o.format, "format", "markdown", "Output format: markdown or json")
+	cmd.Flags().BoolVar(&o.useLLM, "llm", false, "Ask the LLM to write a narrative for the plan")
+	addLLMFlags(cmd, &o.llm)
+	return cmd
+}
+
+func (o *triageOptions) run(cmd *cobra.Command, args []string) error {
+	if o.format != "markdown" && o.format != "json" {
+		return fmt.Errorf("unknown format %q (use markdown or json)", o.format)
+	}
+	ctx := cmd.Context()
+
+	k8sClient, err := kubectl.NewClient()
+	if err != nil {
+		return fmt.Errorf("failed to create k8s client: %w", err)
+	}
+	scanners := newScanners(trivy.NewClient(k8sClient))
+
+	plan, err := buildTriagePlan(ctx, scanners, k8sClient.Clientset(), k8sClient.DynamicClient(), o.namespace, o.top)
+	if err != nil {
+		return err
+	}
+	var newClient func() (llm.Client, error)
+	if o.useLLM {
+		newClient = func() (llm.Client, error) { return o.llm.createClient(o.llm.model) }
+	}
+	return writeTriagePlan(ctx, os.Stdout, plan, o.format, newClient)
+}
+
+// buildTriagePlan ranks the CRITICAL and HIGH findings into a plan of the top actions
+func buildTriagePlan(ctx context.Context, scanners []trivy.Scanner, clientset kubernetes.Interface, dynamicClient dynamic.Interface, namespace string, top int) (*TriagePlan, error) {
+	collected, err := collectFindings(ctx, scanners, namespace, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []trivy.Finding
+	workloads := make(map[string]bool)
+	for _, f := range collected {
+		if f.Severity.Rank() <= trivy.SeverityHigh.Rank() {
+			findings = append(findings, f)
+			workloads[triage.WorkloadKey(f.Namespace, f.ResourceKind, f.ResourceName)] = true
+		}
+	}
+
+	exposures := workloadExposures(ctx, clientset, dynamicClient, findings)
+	all := triage.Rank(findings, exposures, 0)
+
+	plan := &TriagePlan{
+		BySeverity: make(map[string]int),
+		Workloads:  len(workloads),
+		Total:      len(all),
+		Actions:    all,
+	}
+	if top > 0 && len(all) > top {
+		plan.Actions = all[:top]
+	}
+	for _, f := range findings {
+		plan.BySeverity[string(f.Severity)]++
+	}
+	return plan, nil
+}
+
+// writeTriagePlan prints the plan as markdown or JSON. With newClient set the
+// model first writes a narrative for it.
+func writeTriagePlan(ctx context.Context, w io.Writer, plan *TriagePlan, format string, newClient func() (llm.Client, error)) error {
+	if newClient != nil && len(plan.Actions) > 0 {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		plan.Narrative, err = complete(ctx, client, "writing remediation plan", triagePrompt, plan.Markdown())
+		if err != nil {
+			return err
+		}
+	}
+
+	if format == "json" {
+		jsonData, err := json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		_, _ = fmt.Fprintln(w, string(jsonData))
+		return nil
+	}
+	if plan.Narrative != "" {
+		_, _ = fmt.Fprintln(w, strings.TrimSpace(plan.Narrative))
+		_, _ = fmt.Fprintln(w)
+	}
+	_, _ = fmt.Fprint(w, plan.Markdown())
+	return nil
+}
+
+// workloadExposures analyzes each distinct workload once, keyed by triage.WorkloadKey.
+// Workloads that can't be analyzed are left out and rank as unknown exposure.
+func workloadExposures(ctx context.Context, clientset kubernetes.Interface, dynamicClient dynamic.Interface, findings []trivy.Finding) map[string]exposure.ExposureLevel {
+	exposures := make(map[string]exposure.ExposureLevel)
+	seen := make(map[string]bool)
+	for _, f := range findings {
+		key := triage.WorkloadKey(f.Namespace, f.ResourceKind, f.ResourceName)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if result, err := analyzeExposure(ctx, clientset, dynamicClient, f.ResourceKind, f.ResourceName, f.Namespace); err == nil {
+			exposures[key] = result.Level
+		}
+	}
+	return exposures
+}
+
+// Markdown renders the deterministic part of the plan
+func (p TriagePlan) Markdown() string {
+	var b strings.Builder
+
+	b.WriteString("# Remediation plan\n\n")
+	b.WriteString(fmt.Sprintf("%d CRITICAL and %d HIGH findings on %d resources. Showing the top %d of %d actions.\n",
+		p.BySeverity[string(trivy.SeverityCritical)], p.BySeverity[string(trivy.SeverityHigh)], p.Workloads, len(p.Actions), p.Total))
+
+	for i, a := range p.Actions {
+		b.WriteString(fmt.Sprintf("\n## %d. %s\n\n", i+1, a.Title))
+		b.WriteString(fmt.Sprintf("- Severity: %s, exposure: %s, score: %.1f\n", a.Severity, a.Exposure, a.Score))
+
+		switch {
+		case a.Kind == triage.ActionUpgrade && a.Fixable:
+			b.WriteString(fmt.Sprintf("- Fix: upgrade `%s` from `%s` to `%s` and rebuild `%s`\n",
+				a.Package, a.InstalledVersion, a.FixedVersion, a.Image))
+		case a.Kind == triage.ActionUpgrade:
+			b.WriteString(fmt.Sprintf("- Fix: no fixed version of `%s` yet; consider a different base image or mitigating controls\n", a.Package))
+		case a.Remediation != "":
+			b.WriteString(fmt.Sprintf("- Fix: %s\n", a.Remediation))
+		}
+
+		b.WriteString(fmt.Sprintf("- Resolves (%d): %s\n", len(a.Findings), joinLimited(a.Findings, 10)))
+		b.WriteString(fmt.Sprintf("- Blast radius: %d workload(s): %s\n", len(a.Workloads), joinLimited(a.Workloads, 5)))
+	}
+	return b.String()
+}
+
+// joinLimited joins up to n items and notes how many were left out
+func joinLimited(items []string, n int) string {
+	if len(items) <= n {
+		return strings.Join(items, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(items[:n], ", "), len(items)-n)
+}
@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/trixsec-dev/trix/internal/llm"
+	"github.com/trixsec-dev/trix/internal/tools/exposure"
+	"github.com/trixsec-dev/trix/internal/tools/trivy"
+)
+
+func triagePlanFixture(t *testing.T, top int) *TriagePlan {
+	t.Helper()
+	findings, objects := explainFixture()
+	findings = append(findings,
+		cveFinding("CVE-2024-0005", trivy.SeverityMedium, "payments", "Deployment", "api", "libxml2", "2.9", "2.10"),
+		trivy.Finding{ID: "KSV014", Type: trivy.FindingTypeCompliance, Severity: trivy.SeverityHigh, Namespace: "payments",
+			ResourceKind: "Deployment", ResourceName: "api", Title: "Root file system is not read-only",
+			Remediation: "Set readOnlyRootFilesystem to true"},
+	)
+	clientset, dyn := fakeCluster(objects...)
+	plan, err := buildTriagePlan(context.Background(), []trivy.Scanner{fakeScanner{findings: findings}}, clientset, dyn, "", top)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return plan
+}
+
+func TestBuildTriagePlan(t *testing.T) {
+	plan := triagePlanFixture(t, 0)
+
+	// MEDIUM and LOW findings are left out
+	if plan.BySeverity["CRITICAL"] != 1 || plan.BySeverity["HIGH"] != 4 || plan.BySeverity["MEDIUM"] != 0 {
+		t.Errorf("BySeverity = %v", plan.BySeverity)
+	}
+	if plan.Workloads != 4 {
+		t.Errorf("Workloads = %d, want 4", plan.Workloads)
+	}
+	var titles []string
+	for _, a := range plan.Actions {
+		titles = append(titles, a.Title)
+	}
+	want := []string{
+		"Upgrade golang.org/x/crypto to 0.31.0 in ghcr.io/acme/web:1.0",        // CRITICAL x nodePort = 20
+		"KSV014: Root file system is not read-only",                            // HIGH x external = 15, ties sort by title
+		"Upgrade golang.org/x/crypto to 0.31.0 in ghcr.io/acme/api:1.0",        // HIGH x external = 15
+		"Upgrade golang.org/x/crypto to 0.31.0 in ghcr.io/acme/report:1.0",     // HIGH x none = 2.5
+		"No fix yet for golang.org/x/crypto 0.29.0 in ghcr.io/acme/node-1:1.0", // HIGH x unknown x unfixable = 1.5
+	}
+	if strings.Join(titles, "\n") != strings.Join(want, "\n") {
+		t.Errorf("actions =\n%s\nwant\n%s", strings.Join(titles, "\n"), strings.Join(want, "\n"))
+	}
+	if plan.Total != 5 {
+		t.Errorf("Total = %d, want 5", plan.Total)
+	}
+	if plan.Actions[0].Exposure != exposure.ExposureLevelNodePort || plan.Actions[4].Exposure != "unknown" {
+		t.Errorf("exposures = %s, %s", plan.Actions[0].Exposure, plan.Actions[4].Exposure)
+	}
+
+	top := triagePlanFixture(t, 2)
+	if len(top.Actions) != 2 || top.Total != 5 || top.Actions[1].Title != want[1] {
+		t.Errorf("--top 2 plan = %d of %d actions", len(top.Actions), top.Total)
+	}
+}
+
+func TestTriagePlanMarkdown(t *testing.T) {
+	plan := triagePlanFixture(t, 3)
+	got := plan.Markdown()
+
+	for _, want := range []string{
+		"# Remediation plan\n\n1 CRITICAL and 4 HIGH findings on 4 resources. Showing the top 3 of 5 actions.\n",
+		"\n## 2. KSV014: Root file system is not read-only\n\n" +
+			"- Severity: HIGH, exposure: external, score: 15.0\n" +
+			"- Fix: Set readOnlyRootFilesystem to true\n" +
+			"- Resolves (1): KSV014\n" +
+			"- Blast radius: 1 workload(s): payments/Deployment/api\n",
+		"\n## 1. Upgrade golang.org/x/crypto to 0.31.0 in ghcr.io/acme/web:1.0\n\n" +
+			"- Severity: CRITICAL, exposure: nodePort, score: 20.0\n",
+		"- Fix: upgrade `golang.org/x/crypto` from `0.30.0` to `0.31.0` and rebuild `ghcr.io/acme/web:1.0`\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("markdown lacks %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "## 4.") {
+		t.Errorf("markdown shows more than the top 3:\n%s", got)
+	}
+
+	unfixed := triagePlanFixture(t, 0).Markdown()
+	if !strings.Contains(unfixed, "- Fix: no fixed version of `golang.org/x/crypto` yet; consider a different base image or mitigating controls\n") {
+		t.Errorf("unfixed action:\n%s", unfixed)
+	}
+}
+
+func TestJoinLimited(t *testing.T) {
+	if got := joinLimited([]string{"a", "b"}, 2); got != "a, b" {
+		t.Errorf("joinLimited = %q", got)
+	}
+	if got := joinLimited([]string{"a", "b", "c", "d"}, 2); got != "a, b and 2 more" {
+		t.Errorf("joinLimited = %q", got)
+	}
+}
+
+func TestWriteTriagePlan(t *testing.T) {
+	plan := triagePlanFixture(t, 2)
+
+	var out strings.Builder
+	if err := writeTriagePlan(context.Background(), &out, plan, "markdown", nil); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != plan.Markdown() {
+		t.Errorf("markdown output = %q", out.String())
+	}
+
+	out.Reset()
+	if err := writeTriagePlan(context.Background(), &out, plan, "json", nil); err != nil {
+		t.Fatal(err)
+	}
+	var decoded TriagePlan
+	if err := json.Unmarshal([]byte(out.String()), &decoded); err != nil {
+		t.Fatalf("JSON output: %v\n%s", err, out.String())
+	}
+	if decoded.Total != 5 || len(decoded.Actions) != 2 || decoded.Narrative != "" || decoded.BySeverity["HIGH"] != 4 {
+		t.Errorf("decoded = %+v", decoded)
+	}
+}
+
+func TestWriteTriagePlanWithLLM(t *testing.T) {
+	plan := triagePlanFixture(t, 2)
+	client := &scriptedClient{model: "gpt-4o", answers: []string{"\nUpgrade golang.org/x/crypto in web first.\n"}}
+	newClient := func() (llm.Client, error) { return client, nil }
+
+	var out strings.Builder
+	if err := writeTriagePlan(context.Background(), &out, plan, "markdown", newClient); err != nil {
+		t.Fatal(err)
+	}
+	if want := "Upgrade golang.org/x/crypto in web first.\n\n" + plan.Markdown(); out.String() != want {
+		t.Errorf("output = %q, want %q", out.String(), want)
+	}
+	// The model sees the ranked plan and must not reorder it
+	if len(client.messages) != 1 || client.messages[0][0].Content != triagePrompt || client.messages[0][1].Content != plan.Markdown() {
+		t.Errorf("messages = %+v", client.messages)
+	}
+
+	out.Reset()
+	if err := writeTriagePlan(context.Background(), &out, plan, "json", newClient); err == nil {
+		t.Error("second narrative succeeded with no scripted answers left")
+	}
+
+	// Nothing to narrate: the model is not called
+	empty := &TriagePlan{BySeverity: map[string]int{}}
+	noClient := func() (llm.Client, error) {
+		t.Error("LLM client requested for an empty plan")
+		return nil, errors.New("unexpected")
+	}
+	out.Reset()
+	if err := writeTriagePlan(context.Background(), &out, empty, "markdown", noClient); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "Showing the top 0 of 0 actions.") {
+		t.Errorf("empty plan output = %q", out.String())
+	}
+
+	noProvider := func() (llm.Client, error) { return nil, errors.New("no provider configured") }
+	if err := writeTriagePlan(context.Background(), &out, plan, "markdown", noProvider); err == nil ||
+		err.Error() != "no provider configured" {
+		t.Errorf("--llm without a provider err = %v", err)
+	}
+}
@@ -3,6 +3,8 @@ package agent
 import (
 	"context"
 	"fmt"
+	"io"
+	"strings"
 
 	"github.com/trixsec-dev/trix/internal/llm"
 	"github.com/trixsec-dev/trix/internal/tools"
@@ -74,107 +76,212 @@ func (a *Agent) NewConversation() *Conversation {
 	return &Conversation{
 		agent: a,
 		messages: []llm.Message{
-			{Role: llm.RoleSystem, Content: systemPrompt},
+			{Role: llm.RoleSystem, Content: a.systemPrompt()},
 		},
 	}
 }
 
+// History returns the user questions and final assistant answers so far,
+// without the system prompt or intermediate tool calls.
+func (c *Conversation) History() []llm.Message {
+	var history []llm.Message
+	for _, m := range c.messages {
+		switch {
+		case m.Role == llm.RoleUser:
+			history = append(history, m)
+		case m.Role == llm.RoleAssistant && len(m.ToolCalls) == 0:
+			history = append(history, m)
+		}
+	}
+	return history
+}
+
 // Ask adds a question and returns
 func (c *Conversation) Ask(ctx context.Context, question string) (string, error) {
 	c.messages = append(c.messages, llm.Message{Role: llm.RoleUser, Content: question})
 
-	for i := 0; i < 10; i++ {
-		response, err := c.agent.client.Chat(ctx, c.messages, c.agent.registry.Tools())
-		if err != nil {
-			return "", fmt.Errorf("LLM error: %w", err)
-		}
-
-		// Track token usage
-		c.TotalInputTokens += response.Usage.InputTokens
-		c.TotalOutputTokens += response.Usage.OutputTokens
+	messages, response, usage, err := c.agent.run(ctx, c.messages)
+	c.messages = messages
+	c.TotalInputTokens += usage.InputTokens
+	c.TotalOutputTokens += usage.OutputTokens
+	if err != nil {
+		return "", err
+	}
 
-		if len(response.ToolCalls) == 0 {
-			// Add final assistant response to history
-			c.messages = append(c.messages, llm.Message{
-				Role:    llm.RoleAssistant,
-				Content: response.Content,
-			})
-			// Show token usage
-			fmt.Printf("  [tokens: %d in, %d out | total: %d in, %d out]\n",
-				response.Usage.InputTokens, response.Usage.OutputTokens,
-				c.TotalInputTokens, c.TotalOutputTokens)
-			// Warn if context is getting large
-			if response.Usage.InputTokens > warnTokenThreshold {
-				fmt.Printf("  [warning: context is large, consider using 'clear' to reset]\n")
-			}
-			return response.Content, nil
-		}
+	// Add final assistant response to history
+	c.messages = append(c.messages, llm.Message{
+		Role:    llm.RoleAssistant,
+		Content: response.Content,
+	})
+	// Show token usage
+	if c.agent.opts.TokenReporting {
+		c.agent.tracef("  [tokens: %d in, %d out | total: %d in, %d out]\n",
+			response.Usage.InputTokens, response.Usage.OutputTokens,
+			c.TotalInputTokens, c.TotalOutputTokens)
+	}
+	// Warn if context is getting large
+	if response.Usage.InputTokens > warnTokenThreshold {
+		c.agent.tracef("  [warning: context is large, consider using 'clear' to reset]\n")
+	}
+	return response.Content, nil
+}
 
-		c.messages = append(c.messages, llm.Message{
-			Role:      llm.RoleAssistant,
-			Content:   response.Content,
-			ToolCalls: response.ToolCalls,
-		})
-		for _, tc := range response.ToolCalls {
-			paramInfo := formatToolParams(tc.Name, tc.Parameters)
-			fmt.Printf("  → %s\n", paramInfo)
+// Options controls how the agent reports what it is doing.
+// The zero value is silent, which is what library callers usually want.
+type Options struct {
+	// TraceWriter receives the tool call trace ("→ kubectl get pods"),
+	// token usage, and warnings. Nil discards them.
+	TraceWriter io.Writer
 
-			result, err := c.agent.registry.Execute(ctx, tc.Name, tc.Parameters)
-			if err != nil {
-				result = fmt.Sprintf("Error: %v", err)
-			}
+	// TokenReporting writes token usage to TraceWriter after each answer.
+	TokenReporting bool
 
-			if len(result) > maxToolOutputBytes {
-				result = result[:maxToolOutputBytes] + "\n... (truncated)"
-			}
+	// Progress is invoked before and after each LLM call and tool execution.
+	Progress ProgressFunc
 
-			c.messages = append(c.messages, llm.Message{
-				Role:       llm.RoleTool,
-				Content:    result,
-				ToolCallID: tc.ID,
-			})
-		}
-	}
-	return "", fmt.Errorf("agent loop exceeded maximum iterations")
+	// Namespaces restricts every tool call to these namespaces (empty = all).
+	Namespaces []string
 }
 
 // Agent handles the conversation loop with the LLM
 type Agent struct {
 	client   llm.Client
 	registry *tools.Registry
+	opts     Options
 }
 
 // New creates a new agent
-func New(client llm.Client) *Agent {
+func New(client llm.Client, opts Options) *Agent {
+	registry := tools.NewRegistry()
+	registry.RestrictNamespaces(opts.Namespaces...)
 	return &Agent{
 		client:   client,
-		registry: tools.NewRegistry(),
+		registry: registry,
+		opts:     opts,
 	}
 }
 
+// systemPrompt returns the base prompt plus the namespace scope, if any
+func (a *Agent) systemPrompt() string {
+	scope := a.registry.Namespaces()
+	if len(scope) == 0 {
+		return systemPrompt
+	}
+	return systemPrompt + fmt.Sprintf(`
+
+SCOPE: This session is restricted to namespace(s) %s. Every tool call is limited to them and cluster-scoped resources are unavailable. Do not query other namespaces; answer only about workloads in scope.`,
+		strings.Join(scope, ", "))
+}
+
+// Registry returns the agent's tool registry
+func (a *Agent) Registry() *tools.Registry {
+	return a.registry
+}
+
+// Client returns the LLM client currently in use
+func (a *Agent) Client() llm.Client {
+	return a.client
+}
+
+// SetClient switches the LLM client. Existing conversations keep their
+// history and continue with the new client.
+func (a *Agent) SetClient(client llm.Client) {
+	a.client = client
+}
+
+// tracef writes to the trace writer, if one is configured
+func (a *Agent) tracef(format string, args ...interface{}) {
+	if a.opts.TraceWriter == nil {
+		return
+	}
+	_, _ = fmt.Fprintf(a.opts.TraceWriter, format, args...)
+}
+
 // Ask processes a user question and returns the response
 func (a *Agent) Ask(ctx context.Context, question string) (string, error) {
 	messages := []llm.Message{
-		{Role: llm.RoleSystem, Content: systemPrompt},
+		{Role: llm.RoleSystem, Content: a.systemPrompt()},
 		{Role: llm.RoleUser, Content: question},
 	}
 
-	var totalIn, totalOut int
+	_, response, usage, err := a.run(ctx, messages)
+	if err != nil {
+		return "", err
+	}
+
+	if a.opts.TokenReporting {
+		a.tracef("  [tokens: %d in, %d out]\n", usage.InputTokens, usage.OutputTokens)
+	}
+	return response.Content, nil
+}
+
+// Complete sends a single prompt without tools and returns the answer.
+// It is meant for commands that gather the context themselves and only need
+// the model to write it up.
+func (a *Agent) Complete(ctx context.Context, instructions, prompt string) (string, error) {
+	messages := []llm.Message{
+		{Role: llm.RoleSystem, Content: instructions},
+		{Role: llm.RoleUser, Content: prompt},
+	}
+
+	emit := func(e Event) {
+		if a.opts.Progress != nil {
+			a.opts.Progress(e)
+		}
+	}
+
+	emit(Event{Kind: EventLLMStart})
+	response, err := a.client.Chat(ctx, messages, nil)
+	if err != nil {
+		emit(Event{Kind: EventLLMEnd, Err: err})
+		return "", fmt.Errorf("LLM error: %w", err)
+	}
+	emit(Event{
+		Kind:         EventLLMEnd,
+		Response:     response,
+		InputTokens:  response.Usage.InputTokens,
+		OutputTokens: response.Usage.OutputTokens,
+	})
+
+	if a.opts.TokenReporting {
+		a.tracef("  [tokens: %d in, %d out]\n", response.Usage.InputTokens, response.Usage.OutputTokens)
+	}
+	return response.Content, nil
+}
+
+// run executes the agent loop until the LLM answers without tool calls.
+// It returns the message history (including tool calls and results, but not
+// the final answer), the final response, and the usage summed over all calls.
+func (a *Agent) run(ctx context.Context, messages []llm.Message) ([]llm.Message, *llm.Response, llm.Usage, error) {
+	var usage llm.Usage
+	toolCalls := 0
+
+	emit := func(e Event) {
+		if a.opts.Progress == nil {
+			return
+		}
+		e.ToolCalls = toolCalls
+		e.InputTokens = usage.InputTokens
+		e.OutputTokens = usage.OutputTokens
+		a.opts.Progress(e)
+	}
 
 	// Agent loop - keep going until we get a text response
 	for i := 0; i < 10; i++ { // Max 10 iterations to prevent infinite loops
+		emit(Event{Kind: EventLLMStart})
 		response, err := a.client.Chat(ctx, messages, a.registry.Tools())
 		if err != nil {
-			return "", fmt.Errorf("LLM error: %w", err)
+			emit(Event{Kind: EventLLMEnd, Err: err})
+			return messages, nil, usage, fmt.Errorf("LLM error: %w", err)
 		}
 
-		totalIn += response.Usage.InputTokens
-		totalOut += response.Usage.OutputTokens
+		usage.InputTokens += response.Usage.InputTokens
+		usage.OutputTokens += response.Usage.OutputTokens
+		emit(Event{Kind: EventLLMEnd, Response: response})
 
 		// If no tool calls, we're done
 		if len(response.ToolCalls) == 0 {
-			fmt.Printf("  [tokens: %d in, %d out]\n", totalIn, totalOut)
-			return response.Content, nil
+			return messages, response, usage, nil
 		}
 
 		// Add assistant message with tool calls
@@ -186,9 +293,9 @@ func (a *Agent) Ask(ctx context.Context, question string) (string, error) {
 
 		// Execute each tool and add results
 		for _, tc := range response.ToolCalls {
-			// Show tool name with key parameters
-			paramInfo := formatToolParams(tc.Name, tc.Parameters)
-			fmt.Printf("  → %s\n", paramInfo)
+			desc := formatToolParams(tc.Name, tc.Parameters)
+			emit(Event{Kind: EventToolStart, Tool: tc.Name, Description: desc, Params: tc.Parameters})
+			a.tracef("  → %s\n", desc)
 
 			result, err := a.registry.Execute(ctx, tc.Name, tc.Parameters)
 			if err != nil {
@@ -199,6 +306,9 @@ func (a *Agent) Ask(ctx context.Context, question string) (string, error) {
 			if len(result) > maxToolOutputBytes {
 				result = result[:maxToolOutputBytes] + "\n... (truncated)"
 			}
+			toolCalls++
+
+			emit(Event{Kind: EventToolEnd, Tool: tc.Name, Description: desc, Params: tc.Parameters, Result: result, Err: err})
 
 			messages = append(messages, llm.Message{
 				Role:       llm.RoleTool,
@@ -206,8 +316,14 @@ func (a *Agent) Ask(ctx context.Context, question string) (string, error) {
 				ToolCallID: tc.ID,
 			})
 		}
+
+		// Don't go back to the model once cancelled; history stays complete
+		// since every tool call above has its (error) result
+		if err := ctx.Err(); err != nil {
+			return messages, nil, usage, err
+		}
 	}
-	return "", fmt.Errorf("agent loop exceeded maximum iterations")
+	return messages, nil, usage, fmt.Errorf("agent loop exceeded maximum iterations")
 }
 
 // formatToolParams creates a readable description of a tool call
@@ -257,6 +373,9 @@ func formatToolParams(name string, params map[string]interface{}) string {
 		return "trix query summary -A"
 	case "trix_finding_detail":
 		id, _ := params["id"].(string)
+		if full, _ := params["full"].(bool); full {
+			return fmt.Sprintf("trix finding detail %s --full", id)
+		}
 		return fmt.Sprintf("trix finding detail %s", id)
 	case "trix_sbom_summary":
 		return "trix sbom summary"
@@ -0,0 +1,445 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/trixsec-dev/trix/internal/llm"
+)
+
+// fakeClient answers Chat with scripted responses, in order, and records
+// the messages of each call.
+type fakeClient struct {
+	mu        sync.Mutex
+	model     string
+	responses []*llm.Response
+	err       error // Returned once the responses run out
+	calls     [][]llm.Message
+}
+
+func (c *fakeClient) Chat(ctx context.Context, messages []llm.Message, tools []llm.Tool) (*llm.Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls = append(c.calls, append([]llm.Message(nil), messages...))
+	if len(c.responses) == 0 {
+		if c.err != nil {
+			return nil, c.err
+		}
+		return nil, errors.New("fake client: no more responses")
+	}
+	resp := c.responses[0]
+	c.responses = c.responses[1:]
+	return resp, nil
+}
+
+func (c *fakeClient) Model() string {
+	if c.model == "" {
+		return "fake"
+	}
+	return c.model
+}
+
+// toolCall is a model response asking for one or more tool calls
+func toolCall(in, out int, calls ...llm.ToolCall) *llm.Response {
+	return &llm.Response{ToolCalls: calls, Usage: llm.Usage{InputTokens: in, OutputTokens: out}}
+}
+
+// answer is a final model response
+func answer(content string, in, out int) *llm.Response {
+	return &llm.Response{Content: content, Usage: llm.Usage{InputTokens: in, OutputTokens: out}}
+}
+
+// recordEvents returns a ProgressFunc collecting events
+func recordEvents() (ProgressFunc, func() []Event) {
+	var events []Event
+	return func(e Event) { events = append(events, e) }, func() []Event { return events }
+}
+
+func eventKinds(events []Event) []EventKind {
+	kinds := make([]EventKind, len(events))
+	for i, e := range events {
+		kinds[i] = e.Kind
+	}
+	return kinds
+}
+
+func TestProgressEvents(t *testing.T) {
+	client := &fakeClient{responses: []*llm.Response{
+		toolCall(100, 10,
+			llm.ToolCall{ID: "1", Name: "kubectl_list", Parameters: map[string]interface{}{"resource": "pods", "namespace": "prod"}},
+			llm.ToolCall{ID: "2", Name: "no_such_tool", Parameters: map[string]interface{}{}},
+		),
+		answer("all good", 200, 20),
+	}}
+	progress, events := recordEvents()
+	a := New(client, Options{Progress: progress})
+	// Keep the test away from a real cluster
+	if err := a.Registry().SetEnabled("kubectl_list", false); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := a.Ask(context.Background(), "what runs in prod?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "all good" {
+		t.Errorf("answer = %q", got)
+	}
+
+	want := []EventKind{EventLLMStart, EventLLMEnd, EventToolStart, EventToolEnd, EventToolStart, EventToolEnd, EventLLMStart, EventLLMEnd}
+	all := events()
+	if !reflect.DeepEqual(eventKinds(all), want) {
+		t.Fatalf("event kinds = %v, want %v", eventKinds(all), want)
+	}
+
+	start := all[2]
+	if start.Tool != "kubectl_list" || start.Description != "kubectl get pods -n prod" || start.Params["namespace"] != "prod" {
+		t.Errorf("tool start = %+v", start)
+	}
+	if start.ToolCalls != 0 || start.InputTokens != 100 || start.OutputTokens != 10 {
+		t.Errorf("tool start counters = %d calls, %d/%d tokens, want 0, 100/10", start.ToolCalls, start.InputTokens, start.OutputTokens)
+	}
+	end := all[3]
+	if end.Err == nil || !strings.HasPrefix(end.Result, "Error: ") || end.ToolCalls != 1 {
+		t.Errorf("tool end = %+v, want the disabled tool error after 1 call", end)
+	}
+	if e := all[5]; e.Tool != "no_such_tool" || e.Err == nil || e.ToolCalls != 2 {
+		t.Errorf("unknown tool end = %+v", e)
+	}
+
+	second := all[6]
+	if second.ToolCalls != 2 || second.InputTokens != 100 {
+		t.Errorf("second LLM start = %+v, want 2 calls and 100 input tokens so far", second)
+	}
+	last := all[7]
+	if last.Response == nil || last.Response.Content != "all good" || last.InputTokens != 300 || last.OutputTokens != 30 {
+		t.Errorf("final LLM end = %+v", last)
+	}
+
+	// The tool results went back to the model
+	if len(client.calls) != 2 {
+		t.Fatalf("model called %d times, want 2", len(client.calls))
+	}
+	msgs := client.calls[1]
+	tail := msgs[len(msgs)-2:]
+	if tail[0].Role != llm.RoleTool || tail[0].ToolCallID != "1" || tail[1].ToolCallID != "2" {
+		t.Errorf("tool results = %+v", tail)
+	}
+}
+
+func TestProgressLLMError(t *testing.T) {
+	client := &fakeClient{err: errors.New("overloaded")}
+	progress, events := recordEvents()
+	a := New(client, Options{Progress: progress})
+
+	if _, err := a.Ask(context.Background(), "hi"); err == nil || !strings.Contains(err.Error(), "overloaded") {
+		t.Fatalf("err = %v, want the client error", err)
+	}
+	all := events()
+	if !reflect.DeepEqual(eventKinds(all), []EventKind{EventLLMStart, EventLLMEnd}) {
+		t.Fatalf("event kinds = %v", eventKinds(all))
+	}
+	if all[1].Err == nil || all[1].Response != nil {
+		t.Errorf("LLM end = %+v, want the error and no response", all[1])
+	}
+}
+
+func TestCompleteProgress(t *testing.T) {
+	client := &fakeClient{responses: []*llm.Response{answer("write-up", 50, 5)}}
+	progress, events := recordEvents()
+	a := New(client, Options{Progress: progress})
+
+	got, err := a.Complete(context.Background(), "instructions", "prompt")
+	if err != nil || got != "write-up" {
+		t.Fatalf("Complete = %q, %v", got, err)
+	}
+	all := events()
+	if !reflect.DeepEqual(eventKinds(all), []EventKind{EventLLMStart, EventLLMEnd}) {
+		t.Fatalf("event kinds = %v", eventKinds(all))
+	}
+	if all[1].InputTokens != 50 || all[1].OutputTokens != 5 {
+		t.Errorf("LLM end tokens = %d/%d, want 50/5", all[1].InputTokens, all[1].OutputTokens)
+	}
+	if msgs := client.calls[0]; len(msgs) != 2 || msgs[0].Content != "instructions" || msgs[1].Content != "prompt" {
+		t.Errorf("messages = %+v", msgs)
+	}
+}
+
+// Without a Progress hook the loop runs the same
+func TestProgressOptional(t *testing.T) {
+	client := &fakeClient{responses: []*llm.Response{
+		toolCall(1, 1, llm.ToolCall{ID: "1", Name: "no_such_tool"}),
+		answer("done", 1, 1),
+	}}
+	if got, err := New(client, Options{}).Ask(context.Background(), "hi"); err != nil || got != "done" {
+		t.Errorf("Ask = %q, %v", got, err)
+	}
+}
+
+// The loop stops going back to the model after too many rounds of tool calls
+func TestMaxIterations(t *testing.T) {
+	client := &fakeClient{}
+	for i := 0; i < 20; i++ {
+		client.responses = append(client.responses, toolCall(1, 1, llm.ToolCall{ID: "x", Name: "no_such_tool"}))
+	}
+	_, err := New(client, Options{}).Ask(context.Background(), "loop")
+	if err == nil || !strings.Contains(err.Error(), "maximum iterations") {
+		t.Errorf("err = %v, want maximum iterations", err)
+	}
+	if len(client.calls) != 10 {
+		t.Errorf("model called %d times, want 10", len(client.calls))
+	}
+}
+
+func TestFormatToolParams(t *testing.T) {
+	tests := []struct {
+		name   string
+		params map[string]interface{}
+		want   string
+	}{
+		{"kubectl_list", map[string]interface{}{"resource": "pods", "all_namespaces": true, "namespace": "x"}, "kubectl get pods -A"},
+		{"kubectl_list", map[string]interface{}{"resource": "svc", "namespace": "prod", "selector": "app=web"}, "kubectl get svc -n prod -l app=web"},
+		{"kubectl_get", map[string]interface{}{"resource": "pod", "name": "api", "namespace": "prod"}, "kubectl get pod/api -n prod -o yaml"},
+		{"kubectl_get", map[string]interface{}{"resource": "node", "name": "n1"}, "kubectl get node/n1 -o yaml"},
+		{"kubectl_get", map[string]interface{}{"resource": "pods"}, "kubectl get pods"},
+		{"kubectl_logs", map[string]interface{}{"pod": "api-1", "namespace": "prod"}, "kubectl logs api-1 -n prod"},
+		{"trix_findings", map[string]interface{}{"severity": "CRITICAL", "type": "vulnerability"}, "trix query findings --severity=CRITICAL --type=vulnerability"},
+		{"trix_findings", map[string]interface{}{"type": "secret"}, "trix query findings --type=secret"},
+		{"trix_findings", nil, "trix query findings -A"},
+		{"trix_finding_detail", map[string]interface{}{"id": "abc"}, "trix finding detail abc"},
+		{"trix_finding_detail", map[string]interface{}{"id": "abc", "full": true}, "trix finding detail abc --full"},
+		{"trix_sbom_search", map[string]interface{}{"package": "log4j"}, "trix sbom search --package=log4j"},
+		{"check_exposure", map[string]interface{}{"name": "web", "namespace": "prod"}, "check exposure prod/web (Deployment)"},
+		{"check_exposure", map[string]interface{}{"name": "db", "namespace": "prod", "kind": "StatefulSet"}, "check exposure prod/db (StatefulSet)"},
+		{"something_new", nil, "Calling something_new..."},
+	}
+	for _, tt := range tests {
+		if got := formatToolParams(tt.name, tt.params); got != tt.want {
+			t.Errorf("formatToolParams(%s, %v) = %q, want %q", tt.name, tt.params, got, tt.want)
+		}
+	}
+}
+
+// traceScript is a conversation with one tool call and a large final answer
+func traceScript() *fakeClient {
+	return &fakeClient{responses: []*llm.Response{
+		toolCall(100, 10, llm.ToolCall{ID: "1", Name: "no_such_tool", Parameters: map[string]interface{}{}}),
+		answer("done", warnTokenThreshold+1, 20),
+	}}
+}
+
+func TestTraceWriter(t *testing.T) {
+	var out strings.Builder
+	a := New(traceScript(), Options{TraceWriter: &out, TokenReporting: true})
+	c := a.NewConversation()
+	if _, err := c.Ask(context.Background(), "hi"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "  → Calling no_such_tool...\n" +
+		"  [tokens: 50001 in, 20 out | total: 50101 in, 30 out]\n" +
+		"  [warning: context is large, consider using 'clear' to reset]\n"
+	if out.String() != want {
+		t.Errorf("trace = %q, want %q", out.String(), want)
+	}
+	if c.TotalInputTokens != 50101 || c.TotalOutputTokens != 30 {
+		t.Errorf("totals = %d/%d, want 50101/30", c.TotalInputTokens, c.TotalOutputTokens)
+	}
+
+	out.Reset()
+	if _, err := New(traceScript(), Options{TraceWriter: &out, TokenReporting: true}).Ask(context.Background(), "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if want := "  → Calling no_such_tool...\n  [tokens: 50101 in, 30 out]\n"; out.String() != want {
+		t.Errorf("one-shot trace = %q, want %q", out.String(), want)
+	}
+}
+
+func TestTraceWithoutTokenReporting(t *testing.T) {
+	var out strings.Builder
+	if _, err := New(traceScript(), Options{TraceWriter: &out}).Ask(context.Background(), "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "  → Calling no_such_tool...\n" {
+		t.Errorf("trace = %q, want only the tool call", out.String())
+	}
+}
+
+// A library caller that passes no writer gets no output at all
+func TestSilentByDefault(t *testing.T) {
+	stdout := captureStdout(t, func() {
+		for _, opts := range []Options{{}, {TraceWriter: io.Discard, TokenReporting: true}, {TokenReporting: true}} {
+			a := New(traceScript(), opts)
+			if _, err := a.NewConversation().Ask(context.Background(), "hi"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := New(traceScript(), opts).Ask(context.Background(), "hi"); err != nil {
+				t.Fatal(err)
+			}
+			client := &fakeClient{responses: []*llm.Response{answer("x", 1, 1)}}
+			if _, err := New(client, opts).Complete(context.Background(), "i", "p"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+	if stdout != "" {
+		t.Errorf("agent wrote to stdout: %q", stdout)
+	}
+}
+
+func TestNamespaceScope(t *testing.T) {
+	client := &fakeClient{responses: []*llm.Response{
+		toolCall(10, 1, llm.ToolCall{ID: "1", Name: "check_exposure", Parameters: map[string]interface{}{"namespace": "kube-system", "name": "api"}}),
+		answer("done", 10, 1),
+	}}
+	a := New(client, Options{Namespaces: []string{"payments"}})
+	if _, err := a.Ask(context.Background(), "what is exposed?"); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := client.calls[1]
+	if system := msgs[0].Content; !strings.HasSuffix(system, "SCOPE: This session is restricted to namespace(s) payments. "+
+		"Every tool call is limited to them and cluster-scoped resources are unavailable. "+
+		"Do not query other namespaces; answer only about workloads in scope.") {
+		t.Errorf("system prompt lacks the scope: %q", system[len(system)-200:])
+	}
+	// The violation goes back to the model as the tool result
+	result := msgs[len(msgs)-1]
+	if result.Role != llm.RoleTool || result.Content != `Error: namespace "kube-system" is not allowed: this session is restricted to namespace(s) payments` {
+		t.Errorf("tool result = %+v", result)
+	}
+
+	// Unscoped agents keep the base prompt
+	if got := New(client, Options{}).NewConversation().messages[0].Content; got != systemPrompt {
+		t.Errorf("unscoped system prompt has a suffix: %q", strings.TrimPrefix(got, systemPrompt))
+	}
+}
+
+// captureStdout returns what f writes to os.Stdout
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = orig }()
+
+	done := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		done <- string(data)
+	}()
+	f()
+	_ = w.Close()
+	os.Stdout = orig
+	return <-done
+}
+
+// blockingClient's Chat waits until its context is cancelled
+type blockingClient struct{}
+
+func (blockingClient) Chat(ctx context.Context, messages []llm.Message, tools []llm.Tool) (*llm.Response, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (blockingClient) Model() string { return "blocking" }
+
+// askWithin runs Ask, failing the test if it takes longer than 5 seconds
+func askWithin(t *testing.T, ctx context.Context, a *Agent) error {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() {
+		_, err := a.Ask(ctx, "what is vulnerable?")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("Ask still running 5s after cancellation")
+		return nil
+	}
+}
+
+// Once cancelled, the agent finishes the tool round but doesn't go back to
+// the model
+func TestCancelBetweenTools(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := &fakeClient{responses: []*llm.Response{
+		toolCall(10, 1, llm.ToolCall{ID: "1", Name: "no_such_tool"}, llm.ToolCall{ID: "2", Name: "no_such_tool"}),
+		answer("done", 10, 1),
+	}}
+	var tools int
+	a := New(client, Options{Progress: func(e Event) {
+		if e.Kind == EventToolEnd {
+			tools++
+			cancel()
+		}
+	}})
+
+	if err := askWithin(t, ctx, a); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if len(client.calls) != 1 {
+		t.Errorf("model called %d times, want once", len(client.calls))
+	}
+	if tools != 2 {
+		t.Errorf("%d tool calls answered, want both", tools)
+	}
+}
+
+// Cancelling kills a running tool command
+func TestCancelRunningTool(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "kubectl"), []byte("#!/bin/sh\nexec sleep 60\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := &fakeClient{responses: []*llm.Response{
+		toolCall(10, 1, llm.ToolCall{ID: "1", Name: "kubectl_logs", Parameters: map[string]interface{}{"pod": "api-0", "namespace": "payments"}}),
+	}}
+	var result string
+	a := New(client, Options{Progress: func(e Event) {
+		switch e.Kind {
+		case EventToolStart:
+			time.AfterFunc(100*time.Millisecond, cancel)
+		case EventToolEnd:
+			result = e.Result
+		}
+	}})
+
+	if err := askWithin(t, ctx, a); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if !strings.HasPrefix(result, "Error: command failed: signal: killed") {
+		t.Errorf("tool result = %q", result)
+	}
+}
+
+func TestCancelLLMCall(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	a := New(blockingClient{}, Options{Progress: func(e Event) {
+		if e.Kind == EventLLMStart {
+			time.AfterFunc(50*time.Millisecond, cancel)
+		}
+	}})
+	if err := askWithin(t, ctx, a); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
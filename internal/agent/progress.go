@@ -0,0 +1,38 @@
+package agent
+
+import "github.com/trixsec-dev/trix/internal/llm"
+
+// EventKind identifies which step of the agent loop an Event describes
+type EventKind int
+
+const (
+	EventLLMStart  EventKind = iota // About to send the conversation to the model
+	EventLLMEnd                     // Model responded (Response is set)
+	EventToolStart                  // About to execute a tool call
+	EventToolEnd                    // Tool call finished (Result/Err are set)
+)
+
+// Event reports progress from inside the agent loop.
+// Counters are cumulative for the current question.
+type Event struct {
+	Kind EventKind
+
+	// Tool events
+	Tool        string                 // Tool name
+	Description string                 // Readable form of the call, e.g. "kubectl get pods -n prod"
+	Params      map[string]interface{} // Parameters sent by the model
+	Result      string                 // Tool output (EventToolEnd, after truncation)
+
+	// LLM events
+	Response *llm.Response // Model response (EventLLMEnd)
+
+	Err error // LLM or tool error, if any
+
+	ToolCalls    int // Tool calls executed so far
+	InputTokens  int // Input tokens used so far
+	OutputTokens int // Output tokens used so far
+}
+
+// ProgressFunc receives agent events. It is called synchronously from the
+// agent loop, so implementations should return quickly.
+type ProgressFunc func(Event)
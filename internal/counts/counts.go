@@ -0,0 +1,31 @@
+// Package counts ranks tallies such as findings per resource or images per
+// package.
+package counts
+
+import "sort"
+
+// Entry is one name and its count
+type Entry struct {
+	Name  string
+	Count int
+}
+
+// Top returns the n entries of m with the highest counts, highest first.
+// Equal counts are ordered by name so output is stable between runs. n <= 0
+// returns every entry.
+func Top(m map[string]int, n int) []Entry {
+	entries := make([]Entry, 0, len(m))
+	for name, count := range m {
+		entries = append(entries, Entry{Name: name, Count: count})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Count != entries[j].Count {
+			return entries[i].Count > entries[j].Count
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	if n > 0 && len(entries) > n {
+		entries = entries[:n]
+	}
+	return entries
+}
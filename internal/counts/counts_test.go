@@ -0,0 +1,125 @@
+package counts
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestTop(t *testing.T) {
+	tests := []struct {
+		name string
+		m    map[string]int
+		n    int
+		want []Entry
+	}{
+		{
+			name: "highest first",
+			m:    map[string]int{"a": 1, "b": 3, "c": 2},
+			n:    2,
+			want: []Entry{{"b", 3}, {"c", 2}},
+		},
+		{
+			name: "ties ordered by name",
+			m:    map[string]int{"delta": 2, "alpha": 2, "charlie": 5, "bravo": 2},
+			n:    3,
+			want: []Entry{{"charlie", 5}, {"alpha", 2}, {"bravo", 2}},
+		},
+		{
+			name: "n larger than map",
+			m:    map[string]int{"x": 1, "y": 1},
+			n:    10,
+			want: []Entry{{"x", 1}, {"y", 1}},
+		},
+		{
+			name: "n zero returns all",
+			m:    map[string]int{"x": 1, "y": 2},
+			n:    0,
+			want: []Entry{{"y", 2}, {"x", 1}},
+		},
+		{
+			name: "n negative returns all",
+			m:    map[string]int{"x": 1},
+			n:    -1,
+			want: []Entry{{"x", 1}},
+		},
+		{
+			name: "empty map",
+			m:    map[string]int{},
+			n:    5,
+			want: []Entry{},
+		},
+		{
+			name: "nil map",
+			m:    nil,
+			n:    5,
+			want: []Entry{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Top(tt.m, tt.n); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Top() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Map iteration order is random, so repeated calls must still agree
+func TestTopStable(t *testing.T) {
+	m := randomCounts(2000, 10)
+	want := Top(m, 100)
+	for i := 0; i < 20; i++ {
+		if got := Top(m, 100); !reflect.DeepEqual(got, want) {
+			t.Fatalf("run %d differs from the first", i)
+		}
+	}
+	if got := bubbleTop(m, 100); !reflect.DeepEqual(got, want) {
+		t.Fatal("Top differs from the bubble sort it replaced")
+	}
+}
+
+// randomCounts returns n names with counts in [0, maxCount), so many tie
+func randomCounts(n, maxCount int) map[string]int {
+	r := rand.New(rand.NewSource(1))
+	m := make(map[string]int, n)
+	for i := 0; i < n; i++ {
+		m[fmt.Sprintf("pkg-%06d", i)] = r.Intn(maxCount)
+	}
+	return m
+}
+
+// bubbleTop is the hand-rolled sort Top replaced, kept as a baseline
+func bubbleTop(m map[string]int, n int) []Entry {
+	entries := make([]Entry, 0, len(m))
+	for name, count := range m {
+		entries = append(entries, Entry{Name: name, Count: count})
+	}
+	for i := 0; i < len(entries); i++ {
+		for j := i + 1; j < len(entries); j++ {
+			if entries[j].Count > entries[i].Count ||
+				(entries[j].Count == entries[i].Count && entries[j].Name < entries[i].Name) {
+				entries[i], entries[j] = entries[j], entries[i]
+			}
+		}
+	}
+	if n > 0 && len(entries) > n {
+		entries = entries[:n]
+	}
+	return entries
+}
+
+func BenchmarkTop(b *testing.B) {
+	m := randomCounts(50000, 1000)
+	b.Run("sort.Slice", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			Top(m, 20)
+		}
+	})
+	b.Run("bubble", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			bubbleTop(m, 20)
+		}
+	})
+}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 
 	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/trixsec-dev/trix/internal/proxy"
 )
 
 // AnthropicClient implements the client interface for Claude
@@ -20,12 +22,21 @@ func NewAnthropicClient(model string) (*AnthropicClient, error) {
 	if model == "" {
 		model = "claude-sonnet-4-20250514"
 	}
+	httpClient, err := proxy.Client()
+	if err != nil {
+		return nil, err
+	}
 	return &AnthropicClient{
 		model:  model,
-		client: anthropic.NewClient(),
+		client: anthropic.NewClient(option.WithHTTPClient(httpClient)),
 	}, nil
 }
 
+// Model returns the model name used for requests.
+func (c *AnthropicClient) Model() string {
+	return c.model
+}
+
 // Chat sends messages to Claude and returns the response.
 func (c *AnthropicClient) Chat(ctx context.Context, messages []Message, tools []Tool) (*Response, error) {
 	anthropicMessages := c.convertMessages(messages)
@@ -50,4 +50,5 @@ type Response struct {
 // Client is the interface all LLM providers implement
 type Client interface {
 	Chat(ctx context.Context, messages []Message, tools []Tool) (*Response, error)
+	Model() string
 }
@@ -8,6 +8,8 @@ import (
 	"io"
 	"net/http"
 	"os"
+
+	"github.com/trixsec-dev/trix/internal/proxy"
 )
 
 const mistralAPIURL = "https://api.mistral.ai/v1/chat/completions"
@@ -31,10 +33,15 @@ func NewMistralClient(model string) (*MistralClient, error) {
 		model = "mistral-large-latest"
 	}
 
+	httpClient, err := proxy.Client()
+	if err != nil {
+		return nil, err
+	}
+
 	return &MistralClient{
 		apiKey: apiKey,
 		model:  model,
-		client: &http.Client{},
+		client: httpClient,
 	}, nil
 }
 
@@ -106,6 +113,11 @@ type mistralError struct {
 	Code    string `json:"code"`
 }
 
+// Model returns the model name used for requests.
+func (c *MistralClient) Model() string {
+	return c.model
+}
+
 // Chat sends messages to Mistral and returns the response.
 func (c *MistralClient) Chat(ctx context.Context, messages []Message, tools []Tool) (*Response, error) {
 	req := mistralRequest{
@@ -9,6 +9,8 @@ import (
 	"net/http"
 	"os"
 	"time"
+
+	"github.com/trixsec-dev/trix/internal/proxy"
 )
 
 // OllamaClient implements the Client interface for Ollama.
@@ -30,15 +32,23 @@ func NewOllamaClient(baseURL, model string) (*OllamaClient, error) {
 	if model == "" {
 		model = "llama3.2"
 	}
+	httpClient, err := proxy.Client()
+	if err != nil {
+		return nil, err
+	}
+	httpClient.Timeout = 5 * time.Minute // LLMs can be slow
 	return &OllamaClient{
 		baseURL: baseURL,
 		model:   model,
-		client: &http.Client{
-			Timeout: 5 * time.Minute, // LLMs can be slow
-		},
+		client:  httpClient,
 	}, nil
 }
 
+// Model returns the model name used for requests.
+func (c *OllamaClient) Model() string {
+	return c.model
+}
+
 // Chat sends messages to Ollama and returns the response.
 func (c *OllamaClient) Chat(ctx context.Context, messages []Message, tools []Tool) (*Response, error) {
 	ollamaMessages := c.convertMessages(messages)
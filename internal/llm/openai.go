@@ -6,6 +6,8 @@ import (
 	"fmt"
 
 	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"github.com/trixsec-dev/trix/internal/proxy"
 )
 
 // OpenAIClient implements the Client interface for OpenAI's Chat API.
@@ -20,12 +22,21 @@ func NewOpenAIClient(model string) (*OpenAIClient, error) {
 	if model == "" {
 		model = "gpt-4o"
 	}
+	httpClient, err := proxy.Client()
+	if err != nil {
+		return nil, err
+	}
 	return &OpenAIClient{
 		model:  model,
-		client: openai.NewClient(),
+		client: openai.NewClient(option.WithHTTPClient(httpClient)),
 	}, nil
 }
 
+// Model returns the model name used for requests.
+func (c *OpenAIClient) Model() string {
+	return c.model
+}
+
 // Chat sends messages to OpenAI and returns the response.
 func (c *OpenAIClient) Chat(ctx context.Context, messages []Message, tools []Tool) (*Response, error) {
 	openaiMessages := convertMessages(messages)
@@ -0,0 +1,51 @@
+package llm
+
+import "strings"
+
+// price is the list price in USD per million tokens
+type price struct {
+	input  float64
+	output float64
+}
+
+// Known list prices, matched by model name prefix (longest prefix wins).
+// These are estimates for display only and will drift from provider pricing.
+var modelPrices = map[string]price{
+	"claude-opus-4":     {15, 75},
+	"claude-sonnet-4":   {3, 15},
+	"claude-3-7-sonnet": {3, 15},
+	"claude-3-5-sonnet": {3, 15},
+	"claude-3-5-haiku":  {0.8, 4},
+	"claude-haiku-4":    {1, 5},
+	"gpt-4o-mini":       {0.15, 0.6},
+	"gpt-4o":            {2.5, 10},
+	"gpt-4.1-nano":      {0.1, 0.4},
+	"gpt-4.1-mini":      {0.4, 1.6},
+	"gpt-4.1":           {2, 8},
+	"mistral-large":     {2, 6},
+	"mistral-medium":    {0.4, 2},
+	"mistral-small":     {0.2, 0.6},
+}
+
+// EstimateCost returns the estimated cost in USD for the given token usage.
+// The second return value is false when the model's price is unknown.
+// Local Ollama models are always free.
+func EstimateCost(client Client, inputTokens, outputTokens int) (float64, bool) {
+	if _, ok := client.(*OllamaClient); ok {
+		return 0, true
+	}
+
+	model := client.Model()
+	best := ""
+	for prefix := range modelPrices {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best == "" {
+		return 0, false
+	}
+
+	p := modelPrices[best]
+	return float64(inputTokens)/1e6*p.input + float64(outputTokens)/1e6*p.output, true
+}
@@ -0,0 +1,33 @@
+package llm
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+type modelOnly string
+
+func (m modelOnly) Chat(context.Context, []Message, []Tool) (*Response, error) { return nil, nil }
+func (m modelOnly) Model() string                                              { return string(m) }
+
+func TestEstimateCost(t *testing.T) {
+	tests := []struct {
+		client Client
+		want   float64
+		known  bool
+	}{
+		{modelOnly("gpt-4o"), 2.5 + 10, true},
+		{modelOnly("gpt-4o-mini-2024-07-18"), 0.15 + 0.6, true}, // Longest prefix wins
+		{modelOnly("claude-sonnet-4-20250514"), 3 + 15, true},
+		{modelOnly("mistral-large-latest"), 2 + 6, true},
+		{modelOnly("llama3.2"), 0, false},
+		{&OllamaClient{model: "llama3.2"}, 0, true},
+	}
+	for _, tt := range tests {
+		got, known := EstimateCost(tt.client, 1_000_000, 1_000_000)
+		if known != tt.known || math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("EstimateCost(%s) = %v, %v; want %v, %v", tt.client.Model(), got, known, tt.want, tt.known)
+		}
+	}
+}
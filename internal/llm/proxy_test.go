@@ -0,0 +1,98 @@
+package llm
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/trixsec-dev/trix/internal/proxy/proxytest"
+)
+
+// Canned provider responses, by request path
+var proxyResponses = map[string]string{
+	"/v1/chat/completions": `{"id":"c1","object":"chat.completion","created":0,"model":"gpt-4o",
+		"choices":[{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":"ok"}}],
+		"usage":{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}}`,
+	"/v1/messages": `{"id":"m1","type":"message","role":"assistant","model":"claude",
+		"content":[{"type":"text","text":"ok"}],"stop_reason":"end_turn",
+		"usage":{"input_tokens":1,"output_tokens":1}}`,
+	"/api/chat": `{"model":"llama3.2","message":{"role":"assistant","content":"ok"}}`,
+}
+
+func TestProvidersUseProxy(t *testing.T) {
+	origin := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := proxyResponses[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, body)
+	})
+
+	tests := []struct {
+		name   string
+		env    map[string]string
+		client func() (Client, error)
+		want   proxytest.Request
+	}{
+		{"openai", map[string]string{"OPENAI_API_KEY": "k", "OPENAI_BASE_URL": "http://openai.test/v1/"},
+			func() (Client, error) { return NewOpenAIClient("") },
+			proxytest.Request{Method: http.MethodPost, Host: "openai.test"}},
+		{"anthropic", map[string]string{"ANTHROPIC_API_KEY": "k", "ANTHROPIC_BASE_URL": "http://anthropic.test/"},
+			func() (Client, error) { return NewAnthropicClient("") },
+			proxytest.Request{Method: http.MethodPost, Host: "anthropic.test"}},
+		{"ollama", nil,
+			func() (Client, error) { return NewOllamaClient("http://ollama.test:11434", "") },
+			proxytest.Request{Method: http.MethodPost, Host: "ollama.test:11434"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := proxytest.NewServer(origin, "")
+			defer p.Close()
+			t.Setenv("TRIX_HTTP_PROXY", p.URLWithAuth("trix", "secret"))
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			client, err := tt.client()
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := client.Chat(context.Background(), []Message{{Role: RoleUser, Content: "hi"}}, nil)
+			if err != nil {
+				t.Fatalf("Chat: %v", err)
+			}
+			if resp.Content != "ok" {
+				t.Errorf("content = %q", resp.Content)
+			}
+
+			tt.want.Auth = "Basic dHJpeDpzZWNyZXQ=" // trix:secret
+			if got := p.Requests(); !reflect.DeepEqual(got, []proxytest.Request{tt.want}) {
+				t.Errorf("proxy requests = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Mistral's endpoint is fixed, so only check that the tunnel is requested
+func TestMistralUsesProxy(t *testing.T) {
+	p := proxytest.NewServer(http.NotFoundHandler(), "")
+	defer p.Close()
+	t.Setenv("TRIX_HTTP_PROXY", p.URL)
+	t.Setenv("MISTRAL_API_KEY", "k")
+
+	client, err := NewMistralClient("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Chat(context.Background(), []Message{{Role: RoleUser, Content: "hi"}}, nil); err == nil {
+		t.Fatal("Chat succeeded although the proxy refuses tunnels")
+	}
+	want := []proxytest.Request{{Method: http.MethodConnect, Host: "api.mistral.ai:443"}}
+	if got := p.Requests(); !reflect.DeepEqual(got, want) {
+		t.Errorf("proxy requests = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,106 @@
+// Package proxytest provides a forward proxy for tests that records every
+// request it handles.
+package proxytest
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+)
+
+// Request is a request received by the proxy
+type Request struct {
+	Method string // CONNECT, or the method of a forwarded request
+	Host   string // Target host (host:port for CONNECT)
+	Auth   string // Proxy-Authorization header
+}
+
+// Server is a forward proxy. Plain HTTP requests are answered by its origin
+// handler; CONNECT tunnels are dialed to its upstream address whatever host
+// they name, so tests can use made-up hostnames.
+type Server struct {
+	*httptest.Server
+	origin   http.Handler
+	upstream string
+
+	mu       sync.Mutex
+	requests []Request
+	tunnels  []net.Conn
+}
+
+// NewServer starts a proxy answering forwarded requests with origin and
+// tunneling CONNECT requests to upstream (host:port). CONNECT is refused
+// when upstream is empty.
+func NewServer(origin http.Handler, upstream string) *Server {
+	s := &Server{origin: origin, upstream: upstream}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// URLWithAuth returns the proxy URL with basic auth credentials
+func (s *Server) URLWithAuth(user, password string) string {
+	u, _ := url.Parse(s.URL)
+	u.User = url.UserPassword(user, password)
+	return u.String()
+}
+
+// Requests returns the requests received so far
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// Close shuts down the proxy and any open tunnels
+func (s *Server) Close() {
+	s.Server.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.tunnels {
+		_ = conn.Close()
+	}
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{Method: r.Method, Host: r.Host, Auth: r.Header.Get("Proxy-Authorization")})
+	s.mu.Unlock()
+
+	if r.Method != http.MethodConnect {
+		if !r.URL.IsAbs() {
+			http.Error(w, "not a proxy request", http.StatusBadRequest)
+			return
+		}
+		s.origin.ServeHTTP(w, r)
+		return
+	}
+
+	if s.upstream == "" {
+		http.Error(w, "tunnels not allowed", http.StatusForbidden)
+		return
+	}
+	upstream, err := net.Dial("tcp", s.upstream)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	client, buf, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		_ = upstream.Close()
+		return
+	}
+	s.mu.Lock()
+	s.tunnels = append(s.tunnels, client, upstream)
+	s.mu.Unlock()
+
+	_, _ = io.WriteString(client, "HTTP/1.1 200 Connection established\r\n\r\n")
+	go func() {
+		_, _ = io.Copy(upstream, buf)
+		_ = upstream.Close()
+	}()
+	_, _ = io.Copy(client, upstream)
+	_ = client.Close()
+}
@@ -0,0 +1,323 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+	maxTrendPoints  = 10000
+)
+
+// APIVulnerability is a vulnerability as returned by /api/v1.
+type APIVulnerability struct {
+	ID              string     `json:"id"`
+	Kind            string     `json:"kind"` // vulnerability, secret or compliance
+	CVE             string     `json:"cve"`  // CVE, secret rule ID or config check ID
+	Title           string     `json:"title,omitempty"`
+	Workload        string     `json:"workload"`
+	Namespace       string     `json:"namespace"`
+	Severity        string     `json:"severity"`
+	State           string     `json:"state"`
+	Image           string     `json:"image"`
+	ContainerName   string     `json:"containerName,omitempty"`
+	ImageRepository string     `json:"imageRepository,omitempty"`
+	ImageTag        string     `json:"imageTag,omitempty"`
+	ImageDigest     string     `json:"imageDigest,omitempty"`
+	FixedVersion    string     `json:"fixedVersion,omitempty"`
+	Exposure        string     `json:"exposure,omitempty"` // external, nodePort, clusterInternal or none; with TRIX_EXPOSURE_ENRICH
+	FirstSeen       time.Time  `json:"firstSeen"`
+	LastSeen        time.Time  `json:"lastSeen"`
+	FixedAt         *time.Time `json:"fixedAt,omitempty"`
+}
+
+// APIVulnerabilityList is one page of GET /api/v1/vulnerabilities.
+type APIVulnerabilityList struct {
+	Items  []APIVulnerability `json:"items"`
+	Total  int                `json:"total"` // Matches across all pages
+	Limit  int                `json:"limit"`
+	Offset int                `json:"offset"`
+}
+
+// APIStats is the response of GET /api/v1/stats.
+type APIStats struct {
+	TotalOpen  int            `json:"totalOpen"`
+	TotalFixed int            `json:"totalFixed"`
+	BySeverity map[string]int `json:"bySeverity"` // Open vulnerabilities only
+	LastPoll   *time.Time     `json:"lastPoll"`   // Last successful poll, null before the first
+
+	DeliveriesPending int `json:"deliveriesPending"` // Failed notifications waiting for a retry
+	DeliveriesFailed  int `json:"deliveriesFailed"`  // Notifications given up after the maximum attempts
+
+	MTTRWindow string             `json:"mttrWindow"`
+	MTTR       map[string]APIMTTR `json:"mttr"` // By severity, for vulnerabilities fixed within mttrWindow
+}
+
+// APIMTTR is the mean time to remediate of one severity.
+type APIMTTR struct {
+	Count       int    `json:"count"`       // Vulnerabilities fixed within the window
+	MeanSeconds int64  `json:"meanSeconds"` // Mean time from first seen to fixed
+	Mean        string `json:"mean"`        // MeanSeconds for humans, e.g. "4d 6h"
+}
+
+// APITrends is the response of GET /api/v1/trends.
+type APITrends struct {
+	Window string       `json:"window"`
+	Bucket string       `json:"bucket"`
+	Points []TrendPoint `json:"points"` // Oldest first; buckets without snapshots are omitted
+}
+
+// APIError is the body of every non-2xx /api response.
+type APIError struct {
+	Error string `json:"error"`
+}
+
+// APIStatus is the body of POST /api/v1/poll.
+type APIStatus struct {
+	Status string `json:"status"`
+}
+
+// registerAPI adds the /api/v1 endpoints to mux.
+func (s *Server) registerAPI(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/vulnerabilities", s.handleListVulnerabilities)
+	mux.HandleFunc("GET /api/v1/vulnerabilities/{id}", s.handleGetVulnerability)
+	mux.HandleFunc("GET /api/v1/stats", s.handleStats)
+	mux.HandleFunc("GET /api/v1/trends", s.handleTrends)
+	mux.HandleFunc("POST /api/v1/poll", s.handleTriggerPoll)
+}
+
+// handleTriggerPoll asks the poll loop for a poll right away. The poll runs
+// in the background; a poll that is running or already requested is a
+// conflict.
+func (s *Server) handleTriggerPoll(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case s.config.APIToken == "":
+		// The read endpoints may be open, but this one changes state
+		writeJSONError(w, http.StatusForbidden, "triggering polls requires TRIX_API_TOKEN")
+		return
+	case s.stopping.Load():
+		writeJSONError(w, http.StatusServiceUnavailable, "shutting down")
+		return
+	case s.config.LeaderElection && !s.leading.Load():
+		writeJSONError(w, http.StatusServiceUnavailable, "standby replica, only the leader polls")
+		return
+	case s.polling.Load():
+		writeJSONError(w, http.StatusConflict, "a poll is already running")
+		return
+	}
+
+	select {
+	case s.pollNow <- struct{}{}:
+		s.logger.Info("api: poll triggered", "remote", r.RemoteAddr)
+		writeJSON(w, http.StatusAccepted, APIStatus{Status: "poll triggered"})
+	default:
+		writeJSONError(w, http.StatusConflict, "a poll is already requested")
+	}
+}
+
+func (s *Server) handleListVulnerabilities(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseVulnerabilityFilter(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	vulns, total, err := s.db.ListVulnerabilities(r.Context(), filter)
+	if err != nil {
+		s.logger.Error("api: failed to list vulnerabilities", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to list vulnerabilities")
+		return
+	}
+
+	list := APIVulnerabilityList{
+		Items:  make([]APIVulnerability, 0, len(vulns)),
+		Total:  total,
+		Limit:  filter.Limit,
+		Offset: filter.Offset,
+	}
+	for i := range vulns {
+		list.Items = append(list.Items, toAPIVulnerability(&vulns[i]))
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) handleGetVulnerability(w http.ResponseWriter, r *http.Request) {
+	v, err := s.db.GetVulnerability(r.Context(), r.PathValue("id"))
+	if err != nil {
+		s.logger.Error("api: failed to get vulnerability", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to get vulnerability")
+		return
+	}
+	if v == nil {
+		writeJSONError(w, http.StatusNotFound, "vulnerability not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, toAPIVulnerability(v))
+}
+
+// handleStats reports current counts and the MTTR over ?window= (default 30d).
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	window, err := durationParam(r, "window", 30*24*time.Hour)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	stats, err := s.db.GetStats(r.Context(), window)
+	if err != nil {
+		s.logger.Error("api: failed to get stats", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to get stats")
+		return
+	}
+	deliveries, err := s.db.GetDeliveryStats(r.Context(), s.config.DeliveryMaxAttempts)
+	if err != nil {
+		s.logger.Error("api: failed to get delivery stats", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to get stats")
+		return
+	}
+	mttr := make(map[string]APIMTTR, len(stats.MTTR))
+	for sev, m := range stats.MTTR {
+		mttr[sev] = APIMTTR{
+			Count:       m.Count,
+			MeanSeconds: int64(m.Mean / time.Second),
+			Mean:        formatDuration(m.Mean),
+		}
+	}
+	writeJSON(w, http.StatusOK, APIStats{
+		TotalOpen:         stats.TotalOpen,
+		TotalFixed:        stats.TotalFixed,
+		BySeverity:        stats.BySeverity,
+		LastPoll:          s.lastPoll.Load(),
+		DeliveriesPending: deliveries.Pending,
+		DeliveriesFailed:  deliveries.Failed,
+		MTTRWindow:        window.String(),
+		MTTR:              mttr,
+	})
+}
+
+// handleTrends aggregates snapshots over ?window= (default 30d) into one
+// point per ?bucket= (default 1d).
+func (s *Server) handleTrends(w http.ResponseWriter, r *http.Request) {
+	window, err := durationParam(r, "window", 30*24*time.Hour)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	bucket, err := durationParam(r, "bucket", 24*time.Hour)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if window/bucket > maxTrendPoints {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("window/bucket yields more than %d points", maxTrendPoints))
+		return
+	}
+
+	snapshots, err := s.db.GetSnapshots(r.Context(), time.Now().Add(-window))
+	if err != nil {
+		s.logger.Error("api: failed to get snapshots", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to get trends")
+		return
+	}
+	writeJSON(w, http.StatusOK, APITrends{
+		Window: window.String(),
+		Bucket: bucket.String(),
+		Points: Trend(snapshots, bucket),
+	})
+}
+
+// durationParam reads a positive duration such as 30d or 12h from the query.
+func durationParam(r *http.Request, name string, def time.Duration) (time.Duration, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	d, err := parseDays(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid %s %q (e.g. 30d, 12h)", name, v)
+	}
+	return d, nil
+}
+
+// parseVulnerabilityFilter reads filters and pagination from query parameters:
+// kind, state, severity, workload, namespace (prefix), cve, limit, offset.
+func parseVulnerabilityFilter(r *http.Request) (VulnerabilityFilter, error) {
+	q := r.URL.Query()
+	f := VulnerabilityFilter{
+		Severity:        strings.ToUpper(q.Get("severity")),
+		Workload:        q.Get("workload"),
+		NamespacePrefix: q.Get("namespace"),
+		CVE:             q.Get("cve"),
+		Limit:           defaultPageSize,
+	}
+
+	switch kind := strings.ToLower(q.Get("kind")); kind {
+	case "", KindVulnerability, KindSecret, KindCompliance:
+		f.Kind = kind
+	default:
+		return f, fmt.Errorf("invalid kind %q (use %s, %s or %s)", q.Get("kind"), KindVulnerability, KindSecret, KindCompliance)
+	}
+
+	switch state := VulnerabilityState(strings.ToUpper(q.Get("state"))); state {
+	case "", StateOpen, StateFixed:
+		f.State = state
+	default:
+		return f, fmt.Errorf("invalid state %q (use OPEN or FIXED)", q.Get("state"))
+	}
+
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageSize {
+			return f, fmt.Errorf("invalid limit %q (1-%d)", v, maxPageSize)
+		}
+		f.Limit = n
+	}
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return f, fmt.Errorf("invalid offset %q", v)
+		}
+		f.Offset = n
+	}
+	return f, nil
+}
+
+func toAPIVulnerability(v *VulnerabilityRecord) APIVulnerability {
+	namespace, _, _ := strings.Cut(v.Workload, "/")
+	return APIVulnerability{
+		ID:              v.ID,
+		Kind:            v.Kind,
+		CVE:             v.CVE,
+		Title:           v.Title,
+		Workload:        v.Workload,
+		Namespace:       namespace,
+		Severity:        v.Severity,
+		State:           string(v.State),
+		Image:           v.Image,
+		ContainerName:   v.ContainerName,
+		ImageRepository: v.ImageRepository,
+		ImageTag:        v.ImageTag,
+		ImageDigest:     v.ImageDigest,
+		FixedVersion:    v.FixedVersion,
+		Exposure:        v.Exposure,
+		FirstSeen:       v.FirstSeen,
+		LastSeen:        v.LastSeen,
+		FixedAt:         v.FixedAt,
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, APIError{Error: msg})
+}
@@ -0,0 +1,256 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// apiStore returns a store with three vulnerabilities, one of them fixed
+func apiStore(t *testing.T) *MemoryStore {
+	t.Helper()
+	ctx := context.Background()
+	db := NewMemoryStore()
+	records := []*VulnerabilityRecord{
+		{ID: "v1", CVE: "CVE-2024-0001", Workload: "team-a/deployment/api", Namespace: "team-a", Severity: "CRITICAL", Image: "openssl:3.0.1", FixedVersion: "3.0.2"},
+		{ID: "v2", CVE: "CVE-2024-0002", Workload: "team-a/deployment/web", Namespace: "team-a", Severity: "LOW", Image: "zlib:1.2"},
+		{ID: "v3", CVE: "CVE-2024-0003", Workload: "team-b/deployment/db", Namespace: "team-b", Severity: "HIGH", Image: "curl:8.0"},
+	}
+	for _, r := range records {
+		if _, err := db.UpsertVulnerability(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.MarkFixed(ctx, []string{"team-b"}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// apiGet serves one request and decodes the JSON body into out
+func apiGet(t *testing.T, h http.Handler, method, target string, out interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("%s %s: Content-Type = %q, want application/json", method, target, ct)
+	}
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: decode %q: %v", method, target, rec.Body.String(), err)
+		}
+	}
+	return rec
+}
+
+func TestAPIListVulnerabilities(t *testing.T) {
+	h := testServer(t, apiStore(t), map[string]string{"TRIX_API_TOKEN": "secret"}).handler()
+
+	tests := []struct {
+		query  string
+		ids    []string
+		total  int
+		limit  int
+		offset int
+	}{
+		{"", []string{"v1", "v3", "v2"}, 3, defaultPageSize, 0},
+		{"?state=open", []string{"v1", "v2"}, 2, defaultPageSize, 0},
+		{"?state=FIXED", []string{"v3"}, 1, defaultPageSize, 0},
+		{"?severity=critical", []string{"v1"}, 1, defaultPageSize, 0},
+		{"?namespace=team-", []string{"v1", "v3", "v2"}, 3, defaultPageSize, 0},
+		{"?namespace=team-b", []string{"v3"}, 1, defaultPageSize, 0},
+		{"?workload=team-a/deployment/web", []string{"v2"}, 1, defaultPageSize, 0},
+		{"?cve=cve-2024-0002", []string{"v2"}, 1, defaultPageSize, 0},
+		{"?kind=vulnerability", []string{"v1", "v3", "v2"}, 3, defaultPageSize, 0},
+		{"?kind=secret", []string{}, 0, defaultPageSize, 0},
+		{"?limit=1&offset=1", []string{"v3"}, 3, 1, 1},
+		{"?limit=2&offset=5", []string{}, 3, 2, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			var list APIVulnerabilityList
+			rec := apiGet(t, h, http.MethodGet, "/api/v1/vulnerabilities"+tt.query, &list)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+			}
+			ids := make([]string, 0, len(list.Items))
+			for _, v := range list.Items {
+				ids = append(ids, v.ID)
+			}
+			if strings.Join(ids, ",") != strings.Join(tt.ids, ",") {
+				t.Errorf("items = %v, want %v", ids, tt.ids)
+			}
+			if list.Total != tt.total || list.Limit != tt.limit || list.Offset != tt.offset {
+				t.Errorf("total/limit/offset = %d/%d/%d, want %d/%d/%d",
+					list.Total, list.Limit, list.Offset, tt.total, tt.limit, tt.offset)
+			}
+			// An empty page is [], not null
+			if !strings.Contains(rec.Body.String(), `"items":[`) {
+				t.Errorf("items missing from body %s", rec.Body)
+			}
+		})
+	}
+}
+
+func TestAPIListVulnerabilitiesInvalid(t *testing.T) {
+	h := testServer(t, apiStore(t), map[string]string{"TRIX_API_TOKEN": "secret"}).handler()
+	for query, want := range map[string]string{
+		"?state=closed":  "invalid state",
+		"?kind=license":  "invalid kind",
+		"?limit=0":       "invalid limit",
+		"?limit=1001":    "invalid limit",
+		"?limit=ten":     "invalid limit",
+		"?offset=-1":     "invalid offset",
+		"?offset=banana": "invalid offset",
+	} {
+		var body APIError
+		rec := apiGet(t, h, http.MethodGet, "/api/v1/vulnerabilities"+query, &body)
+		if rec.Code != http.StatusBadRequest || !strings.Contains(body.Error, want) {
+			t.Errorf("%s: got %d %q, want 400 containing %q", query, rec.Code, body.Error, want)
+		}
+	}
+}
+
+func TestAPIGetVulnerability(t *testing.T) {
+	h := testServer(t, apiStore(t), map[string]string{"TRIX_API_TOKEN": "secret"}).handler()
+
+	var v APIVulnerability
+	rec := apiGet(t, h, http.MethodGet, "/api/v1/vulnerabilities/v1", &v)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if v.ID != "v1" || v.CVE != "CVE-2024-0001" || v.Namespace != "team-a" || v.State != "OPEN" ||
+		v.Kind != KindVulnerability || v.FixedVersion != "3.0.2" || v.FixedAt != nil || v.FirstSeen.IsZero() {
+		t.Errorf("unexpected vulnerability %+v", v)
+	}
+
+	var fixed APIVulnerability
+	apiGet(t, h, http.MethodGet, "/api/v1/vulnerabilities/v3", &fixed)
+	if fixed.State != "FIXED" || fixed.FixedAt == nil {
+		t.Errorf("v3: state %s, fixedAt %v, want FIXED with fixedAt", fixed.State, fixed.FixedAt)
+	}
+
+	var body APIError
+	rec = apiGet(t, h, http.MethodGet, "/api/v1/vulnerabilities/missing", &body)
+	if rec.Code != http.StatusNotFound || body.Error != "vulnerability not found" {
+		t.Errorf("missing: got %d %q, want 404", rec.Code, body.Error)
+	}
+}
+
+func TestAPIStats(t *testing.T) {
+	s := testServer(t, apiStore(t), map[string]string{"TRIX_API_TOKEN": "secret"})
+	h := s.handler()
+
+	var stats APIStats
+	rec := apiGet(t, h, http.MethodGet, "/api/v1/stats", &stats)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if stats.TotalOpen != 2 || stats.TotalFixed != 1 || stats.BySeverity["CRITICAL"] != 1 || stats.BySeverity["LOW"] != 1 {
+		t.Errorf("unexpected counts %+v", stats)
+	}
+	if stats.LastPoll != nil || !strings.Contains(rec.Body.String(), `"lastPoll":null`) {
+		t.Errorf("lastPoll = %v before any poll, want null", stats.LastPoll)
+	}
+	if stats.MTTRWindow != (30 * 24 * time.Hour).String() {
+		t.Errorf("mttrWindow = %q, want the 30d default", stats.MTTRWindow)
+	}
+	if m := stats.MTTR["HIGH"]; m.Count != 1 {
+		t.Errorf("MTTR[HIGH] = %+v, want one fixed vulnerability", m)
+	}
+
+	s.recordPoll(nil)
+	apiGet(t, h, http.MethodGet, "/api/v1/stats?window=7d", &stats)
+	if stats.LastPoll == nil {
+		t.Error("lastPoll not set after a poll")
+	}
+	if stats.MTTRWindow != (7 * 24 * time.Hour).String() {
+		t.Errorf("mttrWindow = %q, want 7d", stats.MTTRWindow)
+	}
+
+	var body APIError
+	rec = apiGet(t, h, http.MethodGet, "/api/v1/stats?window=soon", &body)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(body.Error, "invalid window") {
+		t.Errorf("bad window: got %d %q, want 400", rec.Code, body.Error)
+	}
+}
+
+func TestAPITrends(t *testing.T) {
+	db := apiStore(t)
+	now := time.Now()
+	for _, s := range []*Snapshot{
+		{TakenAt: now.Add(-50 * time.Hour), TotalOpen: 5},
+		{TakenAt: now.Add(-time.Hour), TotalOpen: 2},
+		{TakenAt: now.Add(-60 * 24 * time.Hour), TotalOpen: 9}, // Outside the window
+	} {
+		if err := db.WriteSnapshot(context.Background(), s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := testServer(t, db, map[string]string{"TRIX_API_TOKEN": "secret"}).handler()
+
+	var trends APITrends
+	rec := apiGet(t, h, http.MethodGet, "/api/v1/trends", &trends)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if trends.Window != (30*24*time.Hour).String() || trends.Bucket != (24*time.Hour).String() {
+		t.Errorf("window/bucket = %s/%s, want the defaults", trends.Window, trends.Bucket)
+	}
+	if len(trends.Points) != 2 {
+		t.Errorf("points = %d, want 2", len(trends.Points))
+	}
+
+	for query, want := range map[string]string{
+		"?bucket=0h":             "invalid bucket",
+		"?window=-1d":            "invalid window",
+		"?window=365d&bucket=1s": "more than",
+	} {
+		var body APIError
+		rec := apiGet(t, h, http.MethodGet, "/api/v1/trends"+query, &body)
+		if rec.Code != http.StatusBadRequest || !strings.Contains(body.Error, want) {
+			t.Errorf("%s: got %d %q, want 400 containing %q", query, rec.Code, body.Error, want)
+		}
+	}
+}
+
+func TestAPITriggerPoll(t *testing.T) {
+	var status APIStatus
+	var body APIError
+
+	open := testServer(t, NewMemoryStore(), nil).handler()
+	rec := apiGet(t, open, http.MethodPost, "/api/v1/poll", &body)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("without TRIX_API_TOKEN: status = %d, want 403", rec.Code)
+	}
+
+	s := testServer(t, NewMemoryStore(), map[string]string{"TRIX_API_TOKEN": "secret"})
+	h := s.handler()
+	rec = apiGet(t, h, http.MethodPost, "/api/v1/poll", &status)
+	if rec.Code != http.StatusAccepted || status.Status != "poll triggered" {
+		t.Errorf("first trigger: got %d %q, want 202", rec.Code, status.Status)
+	}
+	rec = apiGet(t, h, http.MethodPost, "/api/v1/poll", &body)
+	if rec.Code != http.StatusConflict || body.Error != "a poll is already requested" {
+		t.Errorf("second trigger: got %d %q, want 409", rec.Code, body.Error)
+	}
+
+	<-s.pollNow
+	s.polling.Store(true)
+	rec = apiGet(t, h, http.MethodPost, "/api/v1/poll", &body)
+	if rec.Code != http.StatusConflict || body.Error != "a poll is already running" {
+		t.Errorf("while polling: got %d %q, want 409", rec.Code, body.Error)
+	}
+
+	s.stopping.Store(true)
+	rec = apiGet(t, h, http.MethodPost, "/api/v1/poll", &body)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("while stopping: status = %d, want 503", rec.Code)
+	}
+}
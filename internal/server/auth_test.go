@@ -0,0 +1,67 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireToken(t *testing.T) {
+	s := testServer(t, NewMemoryStore(), map[string]string{"TRIX_API_TOKEN": "secret"})
+	s.ready.Store(true)
+	h := s.handler()
+
+	tests := []struct {
+		name   string
+		path   string
+		header string
+		want   int
+	}{
+		{"api without token", "/api/v1/stats", "", http.StatusUnauthorized},
+		{"api with wrong token", "/api/v1/stats", "Bearer wrong", http.StatusUnauthorized},
+		{"api with token prefix", "/api/v1/stats", "Bearer secre", http.StatusUnauthorized},
+		{"api with other scheme", "/api/v1/stats", "Basic secret", http.StatusUnauthorized},
+		{"api with bare token", "/api/v1/stats", "secret", http.StatusUnauthorized},
+		{"api with token", "/api/v1/stats", "Bearer secret", http.StatusOK},
+		{"api item with token", "/api/v1/vulnerabilities/missing", "Bearer secret", http.StatusNotFound},
+		{"api item without token", "/api/v1/vulnerabilities/missing", "", http.StatusUnauthorized},
+		{"unknown api path without token", "/api/v2/anything", "", http.StatusUnauthorized},
+		{"healthz without token", "/healthz", "", http.StatusOK},
+		{"readyz without token", "/readyz", "", http.StatusOK},
+		{"healthz with wrong token", "/healthz", "Bearer wrong", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			if tt.want != http.StatusUnauthorized {
+				return
+			}
+			if got := rec.Header().Get("WWW-Authenticate"); got != `Bearer realm="trix"` {
+				t.Errorf("WWW-Authenticate = %q", got)
+			}
+			var body APIError
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Error != "unauthorized" {
+				t.Errorf("body = %s, want a JSON unauthorized error", rec.Body)
+			}
+		})
+	}
+}
+
+func TestRequireTokenDisabled(t *testing.T) {
+	h := testServer(t, NewMemoryStore(), nil).handler()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/stats", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d without TRIX_API_TOKEN, want 200", rec.Code)
+	}
+}
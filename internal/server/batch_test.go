@@ -0,0 +1,256 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// batchRequest is what a receiver saw of one batched request
+type batchRequest struct {
+	Batch struct {
+		Index int `json:"index"`
+		Total int `json:"total"`
+	} `json:"batch"`
+	Events []struct {
+		ID string `json:"ID"`
+	} `json:"events"`
+}
+
+func (r batchRequest) ids() string {
+	ids := make([]string, len(r.Events))
+	for i, e := range r.Events {
+		ids[i] = e.ID
+	}
+	return strings.Join(ids, ",")
+}
+
+// limitedReceiver rejects bodies over limit bytes with 413, like a proxy
+// in front of the receiver, and returns the batches it accepted and how
+// many requests it rejected
+func limitedReceiver(t *testing.T, limit int) (*httptest.Server, func() ([]batchRequest, int)) {
+	t.Helper()
+	var mu sync.Mutex
+	var accepted []batchRequest
+	var rejected int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		if len(body) > limit {
+			rejected++
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		var req batchRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			t.Errorf("decode %s: %v", body, err)
+		}
+		accepted = append(accepted, req)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() ([]batchRequest, int) {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]batchRequest(nil), accepted...), rejected
+	}
+}
+
+// batchEvents returns n CRITICAL NEW events e1..en; the events in big get
+// a title long enough to push their batch over a 2500 byte limit
+func batchEvents(n int, big ...int) []VulnerabilityEvent {
+	events := make([]VulnerabilityEvent, n)
+	for i := range events {
+		events[i] = VulnerabilityEvent{
+			ID:       fmt.Sprintf("e%d", i+1),
+			Type:     "NEW",
+			Kind:     KindVulnerability,
+			CVE:      fmt.Sprintf("CVE-2024-%04d", i+1),
+			Workload: "payments/deployment/api",
+			Severity: "CRITICAL",
+			Image:    "openssl:3.0.1",
+		}
+	}
+	for _, i := range big {
+		events[i-1].Title = strings.Repeat("x", 3000)
+	}
+	return events
+}
+
+func TestEventBatches(t *testing.T) {
+	tests := []struct {
+		events int
+		size   int
+		want   []int
+	}{
+		{0, 2, nil},
+		{1, 2, []int{1}},
+		{4, 2, []int{2, 2}},
+		{5, 2, []int{2, 2, 1}},
+		{3, 500, []int{3}},
+		{3, 1, []int{1, 1, 1}},
+	}
+	for _, tt := range tests {
+		batches := eventBatches(batchEvents(tt.events), tt.size)
+		var got []int
+		for _, b := range batches {
+			got = append(got, len(b))
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%d events in batches of %d: %v, want %v", tt.events, tt.size, got, tt.want)
+		}
+	}
+
+	// Appending to a batch must not overwrite the next one
+	batches := eventBatches(batchEvents(4), 2)
+	_ = append(batches[0], VulnerabilityEvent{ID: "appended"})
+	if batches[1][0].ID != "e3" {
+		t.Errorf("append to the first batch changed the second: %s", batches[1][0].ID)
+	}
+}
+
+func TestWebhookBatches(t *testing.T) {
+	receiver, accepted := limitedReceiver(t, 1<<20)
+	n := testNotifier(t, map[string]string{"TRIX_NOTIFY_WEBHOOK": receiver.URL, "TRIX_EVENT_BATCH_SIZE": "2"})
+
+	res := n.Deliver(context.Background(), channelWebhook, batchEvents(5))
+	if res.Err != nil || len(res.Delivered) != 5 || len(res.Failed) != 0 {
+		t.Fatalf("Deliver = %d delivered, %d failed, %v", len(res.Delivered), len(res.Failed), res.Err)
+	}
+	got, _ := accepted()
+	want := []string{"1/3 e1,e2", "2/3 e3,e4", "3/3 e5"}
+	if len(got) != len(want) {
+		t.Fatalf("%d requests, want %d", len(got), len(want))
+	}
+	for i, req := range got {
+		if s := fmt.Sprintf("%d/%d %s", req.Batch.Index, req.Batch.Total, req.ids()); s != want[i] {
+			t.Errorf("request %d = %s, want %s", i+1, s, want[i])
+		}
+	}
+}
+
+// A batch the receiver rejects is queued for retry on its own; the others
+// count as delivered
+func TestWebhookBatchRejected(t *testing.T) {
+	ctx := context.Background()
+	receiver, accepted := limitedReceiver(t, 2500)
+	db := NewMemoryStore()
+	s := testServer(t, db, map[string]string{"TRIX_NOTIFY_WEBHOOK": receiver.URL, "TRIX_EVENT_BATCH_SIZE": "2"})
+	s.notifier = NewNotifier(s.config, db, testLogger())
+	s.telemetry = &telemetry{tracer: noopTracer}
+	events := batchEvents(5, 3)
+
+	res := s.notifier.Deliver(ctx, channelWebhook, events)
+	if res.Err == nil || res.Err.Error() != "batch 2/3: status 413" {
+		t.Errorf("err = %v", res.Err)
+	}
+	if got := strings.Join(eventIDs(res.Delivered), ","); got != "e1,e2,e5" {
+		t.Errorf("delivered = %s", got)
+	}
+	if got := strings.Join(eventIDs(res.Failed), ","); got != "e3,e4" {
+		t.Errorf("failed = %s", got)
+	}
+	if got, rejected := accepted(); len(got) != 2 || rejected != 1 {
+		t.Errorf("receiver accepted %d and rejected %d requests", len(got), rejected)
+	}
+
+	s.notify(ctx, events)
+	makeDeliveriesDue(db)
+	due, err := db.DueDeliveries(ctx, time.Now(), s.config.DeliveryMaxAttempts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var queued []VulnerabilityEvent
+	for _, d := range due {
+		queued = append(queued, d.Event)
+		if d.Channel != channelWebhook || d.LastError != "batch 2/3: status 413" {
+			t.Errorf("queued %s on %s after %q", d.Event.ID, d.Channel, d.LastError)
+		}
+	}
+	if got := strings.Join(eventIDs(queued), ","); got != "e3,e4" {
+		t.Errorf("queued for retry = %s, want the rejected batch", got)
+	}
+}
+
+// Each SaaS batch that goes through is marked synced, even when another
+// batch fails
+func TestSaasBatchesPartialSync(t *testing.T) {
+	saasBackoff = time.Millisecond
+	t.Cleanup(func() { saasBackoff = time.Second })
+
+	ctx := context.Background()
+	receiver, accepted := limitedReceiver(t, 2500)
+	db := NewMemoryStore()
+	first := time.Now().Add(-time.Hour)
+	for i := 1; i <= 5; i++ {
+		id := fmt.Sprintf("e%d", i)
+		v := storeRecord(id, "payments", KindVulnerability, "CRITICAL")
+		if i == 3 {
+			v.Title = strings.Repeat("x", 3000)
+		}
+		mustUpsert(t, db, v)
+		// Oldest first, so the batches are e1,e2 / e3,e4 / e5
+		db.mu.Lock()
+		db.vulns[id].FirstSeen = first.Add(time.Duration(i) * time.Minute)
+		db.mu.Unlock()
+	}
+	s := testServer(t, db, map[string]string{"TRIX_SAAS_ENDPOINT": receiver.URL, "TRIX_EVENT_BATCH_SIZE": "2"})
+	s.notifier = NewNotifier(s.config, db, testLogger())
+
+	s.retrySaasSync(ctx)
+
+	got, rejected := accepted()
+	if len(got) != 2 || rejected != saasMaxRetries {
+		t.Errorf("receiver accepted %d and rejected %d requests, want 2 and %d", len(got), rejected, saasMaxRetries)
+	}
+	for _, req := range got {
+		if req.Batch.Total != 3 {
+			t.Errorf("batch %d of %d, want 3 batches", req.Batch.Index, req.Batch.Total)
+		}
+	}
+	unsynced, err := db.GetUnsyncedVulnerabilities(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := recordIDs(unsynced); strings.Join(ids, ",") != "e3,e4" {
+		t.Errorf("unsynced = %v, want the failed batch", ids)
+	}
+}
+
+func TestSaasResultBatches(t *testing.T) {
+	saasBackoff = time.Millisecond
+	t.Cleanup(func() { saasBackoff = time.Second })
+
+	receiver, _ := limitedReceiver(t, 2500)
+	n := testNotifier(t, map[string]string{"TRIX_SAAS_ENDPOINT": receiver.URL, "TRIX_EVENT_BATCH_SIZE": "2"})
+
+	res := n.SendSaas(context.Background(), batchEvents(5, 1, 5))
+	if strings.Join(res.SyncedIDs, ",") != "e3,e4" || strings.Join(res.FailedIDs, ",") != "e1,e2,e5" {
+		t.Errorf("synced %v, failed %v", res.SyncedIDs, res.FailedIDs)
+	}
+	if res.Err == nil || res.Err.Error() != fmt.Sprintf("batch 1/3 failed after %d retries: status 413", saasMaxRetries) {
+		t.Errorf("err = %v, want the first failed batch", res.Err)
+	}
+}
+
+func TestEventBatchSizeConfig(t *testing.T) {
+	if cfg := testConfig(t, nil); cfg.EventBatchSize != 500 {
+		t.Errorf("default batch size = %d", cfg.EventBatchSize)
+	}
+	if cfg := testConfig(t, map[string]string{"TRIX_EVENT_BATCH_SIZE": "50"}); cfg.EventBatchSize != 50 {
+		t.Errorf("batch size = %d", cfg.EventBatchSize)
+	}
+	for _, value := range []string{"0", "-1", "many"} {
+		t.Setenv("TRIX_EVENT_BATCH_SIZE", value)
+		if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "invalid TRIX_EVENT_BATCH_SIZE") {
+			t.Errorf("TRIX_EVENT_BATCH_SIZE=%s: err = %v", value, err)
+		}
+	}
+}
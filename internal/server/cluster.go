@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	clusterInfoRefresh = time.Hour        // How often cluster metadata is looked up again
+	clusterInfoTimeout = 10 * time.Second // Per lookup, so a slow API server doesn't hold up notifications
+)
+
+// clusterInfo builds the cluster block of SaaS and initialized payloads:
+// TRIX_CLUSTER_NAME, TRIX_CLUSTER_LABELS, the trix version and metadata from
+// the API server, which is cached for clusterInfoRefresh. Failed lookups
+// leave their fields out until the next refresh.
+type clusterInfo struct {
+	config    *Config
+	clientset kubernetes.Interface // nil = no lookups
+	logger    *slog.Logger
+
+	mu                sync.Mutex
+	fetched           time.Time
+	kubernetesVersion string
+	nodeCount         int // -1 = unknown
+}
+
+func newClusterInfo(config *Config, clientset kubernetes.Interface, logger *slog.Logger) *clusterInfo {
+	return &clusterInfo{config: config, clientset: clientset, logger: logger, nodeCount: -1}
+}
+
+// block returns the cluster object for a payload, refreshing the cached
+// metadata when it is older than clusterInfoRefresh.
+func (c *clusterInfo) block(ctx context.Context) map[string]interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.clientset != nil && time.Since(c.fetched) >= clusterInfoRefresh {
+		c.refresh(ctx)
+	}
+
+	block := map[string]interface{}{
+		"name":         c.config.ClusterName,
+		"trix_version": c.config.Version,
+	}
+	if len(c.config.ClusterLabels) > 0 {
+		block["labels"] = c.config.ClusterLabels
+	}
+	if c.kubernetesVersion != "" {
+		block["kubernetes_version"] = c.kubernetesVersion
+	}
+	if c.nodeCount >= 0 {
+		block["node_count"] = c.nodeCount
+	}
+	return block
+}
+
+// refresh looks up the Kubernetes version and node count. Each lookup that
+// fails is logged and its field cleared, rather than reporting stale data.
+func (c *clusterInfo) refresh(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, clusterInfoTimeout)
+	defer cancel()
+	c.fetched = time.Now()
+
+	if v, err := c.serverVersion(ctx); err != nil {
+		c.logger.Warn("failed to look up kubernetes version", "error", err)
+		c.kubernetesVersion = ""
+	} else {
+		c.kubernetesVersion = v
+	}
+
+	// ResourceVersion 0 is served from the API server's cache
+	nodes, err := c.clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{ResourceVersion: "0"})
+	if err != nil {
+		c.logger.Warn("failed to count nodes", "error", err)
+		c.nodeCount = -1
+	} else {
+		c.nodeCount = len(nodes.Items)
+	}
+}
+
+// serverVersion returns the API server's version, e.g. v1.31.2. Unlike
+// Discovery().ServerVersion, it honors ctx when the discovery client has a
+// REST client.
+func (c *clusterInfo) serverVersion(ctx context.Context) (string, error) {
+	rest := c.clientset.Discovery().RESTClient()
+	if rest == nil {
+		info, err := c.clientset.Discovery().ServerVersion()
+		if err != nil {
+			return "", err
+		}
+		return info.GitVersion, nil
+	}
+	raw, err := rest.Get().AbsPath("/version").Do(ctx).Raw()
+	if err != nil {
+		return "", err
+	}
+	var info version.Info
+	if err := json.Unmarshal(raw, &info); err != nil {
+		return "", fmt.Errorf("decode version: %w", err)
+	}
+	return info.GitVersion, nil
+}
+
+// parseClusterLabels parses comma-separated key=value pairs.
+func parseClusterLabels(s string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(entry, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("malformed entry %q (use key=value)", entry)
+		}
+		if _, dup := labels[key]; dup {
+			return nil, fmt.Errorf("label %s is set twice", key)
+		}
+		labels[key] = strings.TrimSpace(value)
+	}
+	if len(labels) == 0 {
+		return nil, nil
+	}
+	return labels, nil
+}
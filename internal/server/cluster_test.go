@@ -0,0 +1,223 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// fakeCluster returns a clientset of a v1.31.2 cluster with nodes nodes
+func fakeCluster(nodes int) *k8sfake.Clientset {
+	var objects []runtime.Object
+	for i := range nodes {
+		objects = append(objects, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("node-%d", i)}})
+	}
+	clientset := k8sfake.NewSimpleClientset(objects...)
+	clientset.Discovery().(*fakediscovery.FakeDiscovery).FakedServerVersion = &version.Info{GitVersion: "v1.31.2"}
+	return clientset
+}
+
+// failLookup makes verb on resource fail
+func failLookup(clientset *k8sfake.Clientset, verb, resource string) {
+	clientset.PrependReactor(verb, resource, func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("the server is currently unable to handle the request")
+	})
+}
+
+func blockJSON(t *testing.T, block map[string]interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestParseClusterLabels(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    map[string]string
+		wantErr string
+	}{
+		{"", nil, ""},
+		{" , ", nil, ""},
+		{"env=prod", map[string]string{"env": "prod"}, ""},
+		{"env=prod, region = eu-west-1 ,tenant=", map[string]string{"env": "prod", "region": "eu-west-1", "tenant": ""}, ""},
+		{"url=https://x?a=b", map[string]string{"url": "https://x?a=b"}, ""},
+		{"env", nil, `malformed entry "env" (use key=value)`},
+		{"=prod", nil, `malformed entry "=prod" (use key=value)`},
+		{"env=prod,env=dev", nil, "label env is set twice"},
+	}
+	for _, tt := range tests {
+		got, err := parseClusterLabels(tt.in)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("parseClusterLabels(%q) error = %v, want %q", tt.in, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("parseClusterLabels(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestClusterLabelsConfig(t *testing.T) {
+	if got := testConfig(t, nil).ClusterLabels; got != nil {
+		t.Errorf("default labels = %v", got)
+	}
+	cfg := testConfig(t, map[string]string{"TRIX_CLUSTER_LABELS": "env=prod,region=eu"})
+	if cfg.ClusterLabels["env"] != "prod" || cfg.ClusterLabels["region"] != "eu" {
+		t.Errorf("labels = %v", cfg.ClusterLabels)
+	}
+	t.Setenv("TRIX_CLUSTER_LABELS", "prod")
+	if _, err := LoadConfig(); err == nil || !strings.HasPrefix(err.Error(), "invalid TRIX_CLUSTER_LABELS: malformed entry") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestClusterInfoBlock(t *testing.T) {
+	cfg := testConfig(t, map[string]string{"TRIX_CLUSTER_NAME": "prod-eu", "TRIX_CLUSTER_LABELS": "env=prod,region=eu"})
+	cfg.Version = "1.4.0"
+
+	c := newClusterInfo(cfg, fakeCluster(3), testLogger())
+	want := `{"kubernetes_version":"v1.31.2","labels":{"env":"prod","region":"eu"},"name":"prod-eu","node_count":3,"trix_version":"1.4.0"}`
+	if got := blockJSON(t, c.block(context.Background())); got != want {
+		t.Errorf("block = %s\nwant %s", got, want)
+	}
+
+	// Without a clientset there is nothing to look up
+	c = newClusterInfo(testConfig(t, map[string]string{"TRIX_CLUSTER_NAME": "dev", "TRIX_CLUSTER_LABELS": ""}), nil, testLogger())
+	if got := blockJSON(t, c.block(context.Background())); got != `{"name":"dev","trix_version":""}` {
+		t.Errorf("block without lookups = %s", got)
+	}
+}
+
+func TestClusterInfoCache(t *testing.T) {
+	ctx := context.Background()
+	clientset := fakeCluster(2)
+	c := newClusterInfo(testConfig(t, nil), clientset, testLogger())
+	nodeCount := func() interface{} { return c.block(ctx)["node_count"] }
+
+	if n := nodeCount(); n != 2 {
+		t.Fatalf("node_count = %v", n)
+	}
+	if _, err := clientset.CoreV1().Nodes().Create(ctx, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-2"}}, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	lists := func() int {
+		n := 0
+		for _, a := range clientset.Actions() {
+			if a.GetVerb() == "list" && a.GetResource().Resource == "nodes" {
+				n++
+			}
+		}
+		return n
+	}
+	if n := nodeCount(); n != 2 || lists() != 1 {
+		t.Errorf("within the hour: node_count = %v after %d lookups, want the cached 2 after 1", n, lists())
+	}
+
+	c.mu.Lock()
+	c.fetched = time.Now().Add(-clusterInfoRefresh)
+	c.mu.Unlock()
+	if n := nodeCount(); n != 3 || lists() != 2 {
+		t.Errorf("after an hour: node_count = %v after %d lookups, want 3 after 2", n, lists())
+	}
+}
+
+// A failed lookup leaves out its field, keeping the rest of the block
+func TestClusterInfoPartial(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name string
+		verb string
+		res  string
+		want string
+	}{
+		{"nodes unavailable", "list", "nodes", `{"kubernetes_version":"v1.31.2","name":"prod-eu","trix_version":""}`},
+		{"version unavailable", "get", "version", `{"name":"prod-eu","node_count":2,"trix_version":""}`},
+		{"both unavailable", "*", "*", `{"name":"prod-eu","trix_version":""}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := fakeCluster(2)
+			logs := &syncBuffer{}
+			c := newClusterInfo(testConfig(t, map[string]string{"TRIX_CLUSTER_NAME": "prod-eu"}), clientset, testLogger())
+			c.logger = slog.New(slog.NewTextHandler(logs, nil))
+
+			// Known values are dropped rather than reported stale
+			_ = c.block(ctx)
+			failLookup(clientset, tt.verb, tt.res)
+			c.fetched = time.Time{}
+			if got := blockJSON(t, c.block(ctx)); got != tt.want {
+				t.Errorf("block = %s\nwant %s", got, tt.want)
+			}
+			if !strings.Contains(logs.String(), "level=WARN") {
+				t.Errorf("failed lookup not logged:\n%s", logs.String())
+			}
+		})
+	}
+}
+
+// SaaS payloads and the initialized summary carry the cluster block, and
+// failing lookups don't hold them up
+func TestClusterBlockPayloads(t *testing.T) {
+	ctx := context.Background()
+	srv, received := stubReceiver(t, http.StatusOK)
+	cfg := testConfig(t, map[string]string{
+		"TRIX_CLUSTER_NAME":   "prod-eu",
+		"TRIX_CLUSTER_LABELS": "env=prod",
+		"TRIX_SAAS_ENDPOINT":  srv.URL,
+		"TRIX_NOTIFY_WEBHOOK": srv.URL,
+	})
+	cfg.Version = "1.4.0"
+	clientset := fakeCluster(2)
+	failLookup(clientset, "list", "nodes")
+	n := NewNotifier(cfg, NewMemoryStore(), testLogger())
+	n.cluster = newClusterInfo(cfg, clientset, testLogger())
+
+	if res := n.SendSaas(ctx, testEvents()); res.Err != nil || len(res.SyncedIDs) != 1 {
+		t.Fatalf("SendSaas = %+v", res)
+	}
+	if err := n.sendWebhookSummary(ctx, testEvents()); err != nil {
+		t.Fatal(err)
+	}
+
+	reqs := received()
+	if len(reqs) != 2 {
+		t.Fatalf("%d requests, want 2", len(reqs))
+	}
+	want := `{"kubernetes_version":"v1.31.2","labels":{"env":"prod"},"name":"prod-eu","trix_version":"1.4.0"}`
+	for i, name := range []string{"saas", "initialized webhook"} {
+		var payload map[string]interface{}
+		if err := json.Unmarshal(reqs[i].body, &payload); err != nil {
+			t.Fatal(err)
+		}
+		block, _ := payload["cluster"].(map[string]interface{})
+		if got := blockJSON(t, block); got != want {
+			t.Errorf("%s cluster = %s\nwant %s", name, got, want)
+		}
+	}
+	var saas map[string]interface{}
+	if err := json.Unmarshal(reqs[0].body, &saas); err != nil {
+		t.Fatal(err)
+	}
+	if saas["cluster_name"] != "prod-eu" || saas["trix_version"] != "1.4.0" {
+		t.Errorf("saas top level = %v, %v, want the fields kept for compatibility", saas["cluster_name"], saas["trix_version"])
+	}
+}
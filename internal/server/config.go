@@ -1,28 +1,110 @@
 package server
 
 import (
+	"encoding/base64"
 	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/trixsec-dev/trix/internal/proxy"
 )
 
 // Config holds all server configuration parsed from environment variables.
 type Config struct {
 	// Database
-	DatabaseURL string
+	DatabaseURL       string
+	DBMaxOpenConns    int           // Connection pool size (0 = unlimited)
+	DBMaxIdleConns    int           // Connections kept open between queries (0 = none)
+	DBConnMaxLifetime time.Duration // Replace connections older than this (0 = never)
+	DBConnectAttempts int           // Pings at startup before giving up
+	DBConnectTimeout  time.Duration // Total time the startup pings may take
 
 	// Polling
-	PollInterval time.Duration
-	Namespaces   []string // Empty = all namespaces
+	PollInterval    time.Duration
+	PollConcurrency int           // Workers parsing and storing reports
+	PollJitter      time.Duration // Random offset of up to ± this added to each poll interval
+	Namespaces      []string      // Empty = all namespaces
+	TrackTypes      []string      // Finding kinds to reconcile (KindVulnerability, KindSecret, KindCompliance)
+	ExposureEnrich  bool          // Analyze each affected workload's network exposure once per poll
+
+	// Watch mode
+	Watch         bool          // Watch VulnerabilityReports instead of only polling
+	WatchResync   time.Duration // Full poll interval in watch mode
+	WatchDebounce time.Duration // Quiet period before watch events are notified
+
+	// Retention
+	RetentionFixed     time.Duration // Delete FIXED rows older than this (0 = keep forever)
+	RetentionSnapshots time.Duration // Delete trend snapshots older than this (0 = keep forever)
+
+	// Leader election (multiple replicas)
+	LeaderElection bool
+	LeaseName      string
+	LeaseNamespace string
 
 	// Cluster identity
-	ClusterName string // Human-readable cluster name for notifications
+	ClusterName   string            // Human-readable cluster name for notifications
+	ClusterLabels map[string]string // Sent in SaaS and initialized payloads, e.g. env=prod
 
 	// Notifications
 	SlackWebhook   string
+	SlackBotToken  string // Post with chat.postMessage instead of the webhook, enabling threads
+	SlackChannel   string // Channel for SlackBotToken
+	SlackLegacy    bool   // Legacy attachments instead of Block Kit
+	TeamsWebhook   string
 	GenericWebhook string
-	MinSeverity    string // CRITICAL, HIGH, MEDIUM, LOW
+	WebhookSecret  string        // HMAC key for X-Trix-Signature on generic webhook requests
+	WebhookHeaders http.Header   // Extra headers on generic webhook requests
+	WebhookTimeout time.Duration // Request timeout for the generic webhook
+	EventBatchSize int           // Events per generic webhook or SaaS request
+	HTTPProxy      *url.URL      // Proxy for outgoing requests (TRIX_HTTP_PROXY), nil = HTTP_PROXY/HTTPS_PROXY/NO_PROXY
+	ClientTLS      *ClientTLS    // CA and client certificate for outgoing requests, nil = system defaults
+	WebhookTLS     *ClientTLS    // Generic webhook override of ClientTLS, nil = ClientTLS
+	MinSeverity    string        // CRITICAL, HIGH, MEDIUM, LOW
+
+	NotifyDowngrades bool       // Report vulnerabilities rescored to a lower severity, not only higher
+	Templates        *Templates // Custom message templates from TRIX_TEMPLATE_DIR, nil = built-in
+
+	// Per-channel minimum severity; Slack, Teams, email and webhook default
+	// to MinSeverity, SaaS to everything
+	SlackMinSeverity   string
+	TeamsMinSeverity   string
+	EmailMinSeverity   string
+	WebhookMinSeverity string
+	SaasMinSeverity    string
+
+	// Notification retries
+	DeliveryMaxAttempts int // Give up on a failed notification after this many attempts
+
+	// Throttling (Slack, Teams, immediate email)
+	NotifyWorkloadInterval time.Duration // Minimum time between notifications for a workload (0 = off)
+	NotifyMaxWorkloads     int           // Workloads listed per notification; the rest are summarized (0 = no cap)
+
+	// Digest of events below each channel's minimum severity
+	DigestSchedule *DigestSchedule // nil = events below the threshold are dropped
+	Location       *time.Location  // TRIX_TZ, for digest schedules
+
+	// Email (SMTP)
+	SMTPHost               string
+	SMTPPort               int
+	SMTPTLS                string // starttls, tls (implicit) or none
+	SMTPUsername           string
+	SMTPPassword           string
+	SMTPInsecureSkipVerify bool // Disable certificate verification (testing only)
+	EmailFrom              string
+	EmailTo                []string
+	EmailDigest            string // "" (immediate) or daily
+	EmailDigestHour        int    // Hour (0-23, in Location) the daily digest is sent
+
+	// GitHub issues
+	GitHubRepo        string // owner/name
+	GitHubToken       string
+	GitHubAPIURL      string // https://api.github.com, or the GitHub Enterprise API
+	GitHubMinSeverity string // Issues are filed for new vulnerabilities at or above this
 
 	// SAAS integration
 	SaasEndpoint string // Trix SAAS API endpoint (e.g., https://trix.example.com)
@@ -35,29 +117,110 @@ type Config struct {
 	LogFormat string // json, text
 	LogLevel  string // debug, info, warn, error
 
-	// Health server
+	// OpenTelemetry
+	OTelEndpoint *url.URL // OTLP/HTTP receiver for traces and events (TRIX_OTEL_ENDPOINT), nil = disabled
+
+	// Shutdown
+	ShutdownGrace time.Duration // How long the in-flight poll and notifications may finish on SIGTERM
+
+	// HTTP server (health and API)
 	HealthAddr string
+	APIToken   string // Bearer token required on /api/* (empty = no auth)
+	TLSCert    string // Serve HTTPS when both cert and key are set
+	TLSKey     string
 }
 
-// LoadConfig reads configuration from environment variables.
+// LoadConfig reads the configuration from environment variables and the
+// YAML file named by TRIX_CONFIG. A non-empty environment variable
+// overrides the file, which overrides the defaults.
 func LoadConfig() (*Config, error) {
+	src, err := loadConfigSource(os.Getenv(ConfigFileEnv))
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := loadConfig(src)
+	if err != nil {
+		return nil, src.explain(err)
+	}
+	return cfg, nil
+}
+
+func loadConfig(src *configSource) (*Config, error) {
 	cfg := &Config{
 		// Defaults
-		PollInterval: 5 * time.Minute,
-		MinSeverity:  "CRITICAL",
-		LogFormat:    "json",
-		LogLevel:     "info",
-		HealthAddr:   ":8080",
+		DBMaxOpenConns:         10,
+		DBMaxIdleConns:         5,
+		DBConnMaxLifetime:      30 * time.Minute,
+		DBConnectAttempts:      10,
+		DBConnectTimeout:       2 * time.Minute,
+		PollInterval:           5 * time.Minute,
+		PollConcurrency:        8,
+		WatchResync:            time.Hour,
+		WatchDebounce:          30 * time.Second,
+		ShutdownGrace:          30 * time.Second,
+		RetentionFixed:         90 * 24 * time.Hour,
+		RetentionSnapshots:     365 * 24 * time.Hour,
+		MinSeverity:            "CRITICAL",
+		SMTPTLS:                "starttls",
+		EmailDigestHour:        8,
+		GitHubAPIURL:           "https://api.github.com",
+		GitHubMinSeverity:      "HIGH",
+		Location:               time.Local,
+		LogFormat:              "json",
+		LogLevel:               "info",
+		HealthAddr:             ":8080",
+		WebhookTimeout:         10 * time.Second,
+		EventBatchSize:         500,
+		DeliveryMaxAttempts:    10,
+		NotifyWorkloadInterval: time.Hour,
+		NotifyMaxWorkloads:     20,
+		TrackTypes:             []string{KindVulnerability},
 	}
 
 	// Required
-	cfg.DatabaseURL = os.Getenv("TRIX_DATABASE_URL")
+	cfg.DatabaseURL = src.get("TRIX_DATABASE_URL")
 	if cfg.DatabaseURL == "" {
 		return nil, fmt.Errorf("TRIX_DATABASE_URL is required")
 	}
 
+	// Optional: Database connection pool and startup retries
+	for _, p := range []struct {
+		env string
+		n   *int
+		min int
+	}{
+		{"TRIX_DB_MAX_OPEN_CONNS", &cfg.DBMaxOpenConns, 0},
+		{"TRIX_DB_MAX_IDLE_CONNS", &cfg.DBMaxIdleConns, 0},
+		{"TRIX_DB_CONNECT_ATTEMPTS", &cfg.DBConnectAttempts, 1},
+	} {
+		if v := src.get(p.env); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < p.min {
+				return nil, fmt.Errorf("invalid %s %q (must be at least %d)", p.env, v, p.min)
+			}
+			*p.n = n
+		}
+	}
+	if cfg.DBMaxOpenConns > 0 && cfg.DBMaxIdleConns > cfg.DBMaxOpenConns {
+		cfg.DBMaxIdleConns = cfg.DBMaxOpenConns
+	}
+	if v := src.get("TRIX_DB_CONN_MAX_LIFETIME"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid TRIX_DB_CONN_MAX_LIFETIME %q (e.g. 30m, 0 to disable)", v)
+		}
+		cfg.DBConnMaxLifetime = d
+	}
+	if v := src.get("TRIX_DB_CONNECT_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid TRIX_DB_CONNECT_TIMEOUT %q", v)
+		}
+		cfg.DBConnectTimeout = d
+	}
+
 	// Optional: Poll interval
-	if v := os.Getenv("TRIX_POLL_INTERVAL"); v != "" {
+	if v := src.get("TRIX_POLL_INTERVAL"); v != "" {
 		d, err := time.ParseDuration(v)
 		if err != nil {
 			return nil, fmt.Errorf("invalid TRIX_POLL_INTERVAL: %w", err)
@@ -65,46 +228,542 @@ func LoadConfig() (*Config, error) {
 		cfg.PollInterval = d
 	}
 
+	// Optional: Poll concurrency
+	if v := src.get("TRIX_POLL_CONCURRENCY"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid TRIX_POLL_CONCURRENCY %q (must be at least 1)", v)
+		}
+		cfg.PollConcurrency = n
+	}
+
+	// Optional: Watch mode
+	if v := src.get("TRIX_WATCH"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TRIX_WATCH: %w", err)
+		}
+		cfg.Watch = b
+	}
+	if v := src.get("TRIX_WATCH_RESYNC"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid TRIX_WATCH_RESYNC %q", v)
+		}
+		cfg.WatchResync = d
+	}
+	if v := src.get("TRIX_WATCH_DEBOUNCE"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid TRIX_WATCH_DEBOUNCE %q", v)
+		}
+		cfg.WatchDebounce = d
+	}
+
+	// Optional: Poll jitter, 10% of the interval by default
+	cfg.PollJitter = cfg.pollInterval() / 10
+	if v := src.get("TRIX_POLL_JITTER"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 || d >= cfg.pollInterval() {
+			return nil, fmt.Errorf("invalid TRIX_POLL_JITTER %q (must be below the poll interval, 0 to disable)", v)
+		}
+		cfg.PollJitter = d
+	}
+
+	// Optional: Retention of fixed vulnerabilities and trend snapshots
+	if v := src.get("TRIX_RETENTION_FIXED"); v != "" {
+		d, err := parseDays(v)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid TRIX_RETENTION_FIXED %q (e.g. 90d, 720h, 0 to disable)", v)
+		}
+		cfg.RetentionFixed = d
+	}
+	if v := src.get("TRIX_RETENTION_SNAPSHOTS"); v != "" {
+		d, err := parseDays(v)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid TRIX_RETENTION_SNAPSHOTS %q (e.g. 365d, 0 to disable)", v)
+		}
+		cfg.RetentionSnapshots = d
+	}
+
 	// Optional: Namespaces (comma-separated)
-	if v := os.Getenv("TRIX_NAMESPACES"); v != "" {
+	if v := src.get("TRIX_NAMESPACES"); v != "" {
 		cfg.Namespaces = strings.Split(v, ",")
 		for i := range cfg.Namespaces {
 			cfg.Namespaces[i] = strings.TrimSpace(cfg.Namespaces[i])
 		}
 	}
 
+	// Optional: finding kinds (comma-separated)
+	if v := src.get("TRIX_TRACK_TYPES"); v != "" {
+		kinds, err := parseTrackTypes(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TRIX_TRACK_TYPES: %w", err)
+		}
+		cfg.TrackTypes = kinds
+	}
+	if cfg.Watch && !cfg.tracks(KindVulnerability) {
+		return nil, fmt.Errorf("TRIX_WATCH requires %s in TRIX_TRACK_TYPES", KindVulnerability)
+	}
+
+	// Optional: exposure enrichment
+	if v := src.get("TRIX_EXPOSURE_ENRICH"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TRIX_EXPOSURE_ENRICH: %w", err)
+		}
+		cfg.ExposureEnrich = b
+	}
+
+	// Leader election
+	if v := src.get("TRIX_LEADER_ELECTION"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TRIX_LEADER_ELECTION: %w", err)
+		}
+		cfg.LeaderElection = b
+	}
+	cfg.LeaseName = src.get("TRIX_LEADER_LEASE_NAME")
+	if cfg.LeaseName == "" {
+		cfg.LeaseName = "trix-leader"
+	}
+	cfg.LeaseNamespace = src.get("TRIX_LEADER_LEASE_NAMESPACE")
+	if cfg.LeaseNamespace == "" {
+		cfg.LeaseNamespace = inClusterNamespace()
+	}
+	if cfg.LeaderElection && cfg.LeaseNamespace == "" {
+		return nil, fmt.Errorf("TRIX_LEADER_LEASE_NAMESPACE is required when running outside a cluster")
+	}
+
 	// Cluster identity
-	cfg.ClusterName = os.Getenv("TRIX_CLUSTER_NAME")
+	cfg.ClusterName = src.get("TRIX_CLUSTER_NAME")
+	labels, err := parseClusterLabels(src.get("TRIX_CLUSTER_LABELS"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid TRIX_CLUSTER_LABELS: %w", err)
+	}
+	cfg.ClusterLabels = labels
 
 	// Notifications
-	cfg.SlackWebhook = os.Getenv("TRIX_NOTIFY_SLACK")
-	cfg.GenericWebhook = os.Getenv("TRIX_NOTIFY_WEBHOOK")
+	cfg.SlackWebhook = src.get("TRIX_NOTIFY_SLACK")
+	cfg.SlackBotToken = src.get("TRIX_SLACK_BOT_TOKEN")
+	cfg.SlackChannel = src.get("TRIX_SLACK_CHANNEL")
+	if cfg.SlackBotToken != "" && cfg.SlackChannel == "" {
+		return nil, fmt.Errorf("TRIX_SLACK_CHANNEL is required when TRIX_SLACK_BOT_TOKEN is set")
+	}
+	if v := src.get("TRIX_SLACK_LEGACY"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TRIX_SLACK_LEGACY: %w", err)
+		}
+		cfg.SlackLegacy = b
+	}
+	if cfg.SlackLegacy && cfg.SlackBotToken != "" {
+		return nil, fmt.Errorf("TRIX_SLACK_LEGACY only applies to TRIX_NOTIFY_SLACK webhooks")
+	}
+	cfg.TeamsWebhook = src.get("TRIX_NOTIFY_TEAMS")
+	cfg.GenericWebhook = src.get("TRIX_NOTIFY_WEBHOOK")
+	cfg.WebhookSecret = src.get("TRIX_WEBHOOK_SECRET")
+	headers, err := parseWebhookHeaders(src.get("TRIX_WEBHOOK_HEADERS"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid TRIX_WEBHOOK_HEADERS: %w", err)
+	}
+	cfg.WebhookHeaders = headers
+	if v := src.get("TRIX_WEBHOOK_BASIC_AUTH"); v != "" {
+		userPass, err := secretValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TRIX_WEBHOOK_BASIC_AUTH: %w", err)
+		}
+		user, pass, ok := strings.Cut(userPass, ":")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("invalid TRIX_WEBHOOK_BASIC_AUTH (use user:password)")
+		}
+		cfg.WebhookHeaders.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(user+":"+pass)))
+	}
+	if v := src.get("TRIX_WEBHOOK_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid TRIX_WEBHOOK_TIMEOUT %q", v)
+		}
+		cfg.WebhookTimeout = d
+	}
+	if v := src.get("TRIX_EVENT_BATCH_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid TRIX_EVENT_BATCH_SIZE %q (must be at least 1)", v)
+		}
+		cfg.EventBatchSize = n
+	}
+
+	// Optional: proxy, CA and client certificates for outgoing requests
+	if cfg.HTTPProxy, err = proxy.Parse(src.get(proxy.EnvVar)); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", proxy.EnvVar, err)
+	}
+	if cfg.ClientTLS, err = loadClientTLS(src, "TRIX_TLS", cfg.HTTPProxy); err != nil {
+		return nil, err
+	}
+	if cfg.WebhookTLS, err = loadClientTLS(src, "TRIX_WEBHOOK_TLS", cfg.HTTPProxy); err != nil {
+		return nil, err
+	}
+
+	// Optional: Minimum severity, globally and per channel
+	if err := loadSeverities(cfg, src); err != nil {
+		return nil, err
+	}
+
+	if dir := src.get("TRIX_TEMPLATE_DIR"); dir != "" {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("invalid TRIX_TEMPLATE_DIR %q: not a directory", dir)
+		}
+		t, err := LoadTemplates(dir)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template in TRIX_TEMPLATE_DIR: %w", err)
+		}
+		cfg.Templates = t
+	}
 
-	if v := os.Getenv("TRIX_NOTIFY_SEVERITY"); v != "" {
-		cfg.MinSeverity = strings.ToUpper(v)
+	if v := src.get("TRIX_DELIVERY_MAX_ATTEMPTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid TRIX_DELIVERY_MAX_ATTEMPTS %q (must be at least 1)", v)
+		}
+		cfg.DeliveryMaxAttempts = n
+	}
+
+	// Optional: Throttling
+	if v := src.get("TRIX_NOTIFY_WORKLOAD_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid TRIX_NOTIFY_WORKLOAD_INTERVAL %q (e.g. 1h, 0 to disable)", v)
+		}
+		cfg.NotifyWorkloadInterval = d
+	}
+	if v := src.get("TRIX_NOTIFY_MAX_WORKLOADS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid TRIX_NOTIFY_MAX_WORKLOADS %q (0 to disable)", v)
+		}
+		cfg.NotifyMaxWorkloads = n
+	}
+
+	// Optional: Digest
+	if v := src.get("TRIX_DIGEST_SCHEDULE"); v != "" {
+		sched, err := ParseDigestSchedule(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TRIX_DIGEST_SCHEDULE: %w", err)
+		}
+		cfg.DigestSchedule = sched
+	}
+	if v := src.get("TRIX_TZ"); v != "" {
+		loc, err := time.LoadLocation(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TRIX_TZ %q: %w", v, err)
+		}
+		cfg.Location = loc
+	}
+
+	// Email
+	if err := loadEmailConfig(cfg, src); err != nil {
+		return nil, err
+	}
+
+	// GitHub issues
+	cfg.GitHubRepo = src.get("TRIX_NOTIFY_GITHUB_REPO")
+	if cfg.GitHubRepo != "" {
+		if owner, name, ok := strings.Cut(cfg.GitHubRepo, "/"); !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+			return nil, fmt.Errorf("invalid TRIX_NOTIFY_GITHUB_REPO %q (use owner/name)", cfg.GitHubRepo)
+		}
+		cfg.GitHubToken = src.get("TRIX_GITHUB_TOKEN")
+		if cfg.GitHubToken == "" {
+			return nil, fmt.Errorf("TRIX_GITHUB_TOKEN is required when TRIX_NOTIFY_GITHUB_REPO is set")
+		}
+	}
+	if v := src.get("TRIX_GITHUB_API_URL"); v != "" {
+		cfg.GitHubAPIURL = v
+	}
+	if v := src.get("TRIX_GITHUB_SEVERITY"); v != "" {
+		s, err := parseSeverity("TRIX_GITHUB_SEVERITY", v)
+		if err != nil {
+			return nil, err
+		}
+		cfg.GitHubMinSeverity = s
 	}
 
 	// SAAS integration
-	cfg.SaasEndpoint = os.Getenv("TRIX_SAAS_ENDPOINT")
-	cfg.SaasApiKey = os.Getenv("TRIX_SAAS_API_KEY")
+	cfg.SaasEndpoint = src.get("TRIX_SAAS_ENDPOINT")
+	cfg.SaasApiKey = src.get("TRIX_SAAS_API_KEY")
 
 	// Logging
-	if v := os.Getenv("TRIX_LOG_FORMAT"); v != "" {
+	if v := src.get("TRIX_LOG_FORMAT"); v != "" {
 		cfg.LogFormat = v
 	}
-	if v := os.Getenv("TRIX_LOG_LEVEL"); v != "" {
+	if v := src.get("TRIX_LOG_LEVEL"); v != "" {
 		cfg.LogLevel = v
 	}
 
+	// Optional: OpenTelemetry export
+	if v := src.get("TRIX_OTEL_ENDPOINT"); v != "" {
+		u, err := parseOTelEndpoint(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TRIX_OTEL_ENDPOINT: %w", err)
+		}
+		cfg.OTelEndpoint = u
+	}
+
+	if v := src.get("TRIX_SHUTDOWN_GRACE"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid TRIX_SHUTDOWN_GRACE %q", v)
+		}
+		cfg.ShutdownGrace = d
+	}
+
 	// Health
-	if v := os.Getenv("TRIX_HEALTH_ADDR"); v != "" {
+	if v := src.get("TRIX_HEALTH_ADDR"); v != "" {
 		cfg.HealthAddr = v
 	}
+	cfg.APIToken = src.get("TRIX_API_TOKEN")
+	cfg.TLSCert = src.get("TRIX_TLS_CERT")
+	cfg.TLSKey = src.get("TRIX_TLS_KEY")
+	if (cfg.TLSCert == "") != (cfg.TLSKey == "") {
+		return nil, fmt.Errorf("TRIX_TLS_CERT and TRIX_TLS_KEY must be set together")
+	}
 
 	return cfg, nil
 }
 
+// pollInterval is the time between full polls: TRIX_WATCH_RESYNC in watch
+// mode, otherwise TRIX_POLL_INTERVAL.
+func (c *Config) pollInterval() time.Duration {
+	if c.Watch {
+		return c.WatchResync
+	}
+	return c.PollInterval
+}
+
 // HasNotifications returns true if at least one notification target is configured.
 func (c *Config) HasNotifications() bool {
-	return c.SlackWebhook != "" || c.GenericWebhook != "" || c.SaasEndpoint != ""
+	return c.slackEnabled() || c.TeamsWebhook != "" || c.GenericWebhook != "" || c.SMTPHost != "" || c.GitHubRepo != "" || c.SaasEndpoint != ""
+}
+
+// loadClientTLS reads <prefix>_CA_FILE, <prefix>_CLIENT_CERT and
+// <prefix>_CLIENT_KEY, returning nil when none is set.
+func loadClientTLS(src *configSource, prefix string, proxyURL *url.URL) (*ClientTLS, error) {
+	caFile := src.get(prefix + "_CA_FILE")
+	certFile := src.get(prefix + "_CLIENT_CERT")
+	keyFile := src.get(prefix + "_CLIENT_KEY")
+	if caFile == "" && certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+	return newClientTLS(prefix, caFile, certFile, keyFile, proxyURL)
+}
+
+// loadEmailConfig reads the TRIX_SMTP_* and TRIX_EMAIL_* variables. Email is
+// disabled unless TRIX_SMTP_HOST is set.
+func loadEmailConfig(cfg *Config, src *configSource) error {
+	cfg.SMTPHost = src.get("TRIX_SMTP_HOST")
+	if cfg.SMTPHost == "" {
+		return nil
+	}
+
+	if v := src.get("TRIX_SMTP_TLS"); v != "" {
+		cfg.SMTPTLS = strings.ToLower(v)
+	}
+	switch cfg.SMTPTLS {
+	case "starttls":
+		cfg.SMTPPort = 587
+	case "tls":
+		cfg.SMTPPort = 465
+	case "none":
+		cfg.SMTPPort = 25
+	default:
+		return fmt.Errorf("invalid TRIX_SMTP_TLS %q (use starttls, tls or none)", cfg.SMTPTLS)
+	}
+	if v := src.get("TRIX_SMTP_PORT"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("invalid TRIX_SMTP_PORT %q", v)
+		}
+		cfg.SMTPPort = n
+	}
+	if v := src.get("TRIX_SMTP_INSECURE_SKIP_VERIFY"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid TRIX_SMTP_INSECURE_SKIP_VERIFY: %w", err)
+		}
+		cfg.SMTPInsecureSkipVerify = b
+	}
+	cfg.SMTPUsername = src.get("TRIX_SMTP_USERNAME")
+	cfg.SMTPPassword = src.get("TRIX_SMTP_PASSWORD")
+
+	cfg.EmailFrom = src.get("TRIX_EMAIL_FROM")
+	if cfg.EmailFrom == "" {
+		return fmt.Errorf("TRIX_EMAIL_FROM is required when TRIX_SMTP_HOST is set")
+	}
+	if _, err := mail.ParseAddress(cfg.EmailFrom); err != nil {
+		return fmt.Errorf("invalid TRIX_EMAIL_FROM %q: %w", cfg.EmailFrom, err)
+	}
+	for _, to := range strings.Split(src.get("TRIX_EMAIL_TO"), ",") {
+		if to = strings.TrimSpace(to); to == "" {
+			continue
+		}
+		if _, err := mail.ParseAddress(to); err != nil {
+			return fmt.Errorf("invalid TRIX_EMAIL_TO address %q: %w", to, err)
+		}
+		cfg.EmailTo = append(cfg.EmailTo, to)
+	}
+	if len(cfg.EmailTo) == 0 {
+		return fmt.Errorf("TRIX_EMAIL_TO is required when TRIX_SMTP_HOST is set")
+	}
+
+	switch v := strings.ToLower(src.get("TRIX_EMAIL_DIGEST")); v {
+	case "", "daily":
+		cfg.EmailDigest = v
+	default:
+		return fmt.Errorf("invalid TRIX_EMAIL_DIGEST %q (use daily, or leave empty to send immediately)", v)
+	}
+	if v := src.get("TRIX_EMAIL_DIGEST_HOUR"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > 23 {
+			return fmt.Errorf("invalid TRIX_EMAIL_DIGEST_HOUR %q (0-23)", v)
+		}
+		cfg.EmailDigestHour = n
+	}
+	return nil
+}
+
+// loadSeverities reads TRIX_NOTIFY_SEVERITY and the per-channel overrides.
+// Unset channel thresholds fall back to TRIX_NOTIFY_SEVERITY, except SaaS,
+// which receives everything unless TRIX_SAAS_SEVERITY is set.
+func loadSeverities(cfg *Config, src *configSource) error {
+	if v := src.get("TRIX_NOTIFY_SEVERITY"); v != "" {
+		s, err := parseSeverity("TRIX_NOTIFY_SEVERITY", v)
+		if err != nil {
+			return err
+		}
+		cfg.MinSeverity = s
+	}
+	if v := src.get("TRIX_NOTIFY_DOWNGRADES"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid TRIX_NOTIFY_DOWNGRADES: %w", err)
+		}
+		cfg.NotifyDowngrades = b
+	}
+
+	for _, o := range []struct {
+		env   string
+		field *string
+		def   string
+	}{
+		{"TRIX_SLACK_SEVERITY", &cfg.SlackMinSeverity, cfg.MinSeverity},
+		{"TRIX_TEAMS_SEVERITY", &cfg.TeamsMinSeverity, cfg.MinSeverity},
+		{"TRIX_EMAIL_SEVERITY", &cfg.EmailMinSeverity, cfg.MinSeverity},
+		{"TRIX_WEBHOOK_SEVERITY", &cfg.WebhookMinSeverity, cfg.MinSeverity},
+		{"TRIX_SAAS_SEVERITY", &cfg.SaasMinSeverity, ""},
+	} {
+		*o.field = o.def
+		if v := src.get(o.env); v != "" {
+			s, err := parseSeverity(o.env, v)
+			if err != nil {
+				return err
+			}
+			*o.field = s
+		}
+	}
+	return nil
+}
+
+// parseSeverity validates a Trivy severity name
+func parseSeverity(name, v string) (string, error) {
+	switch s := strings.ToUpper(strings.TrimSpace(v)); s {
+	case "CRITICAL", "HIGH", "MEDIUM", "LOW", "UNKNOWN":
+		return s, nil
+	default:
+		return "", fmt.Errorf("invalid %s %q (use CRITICAL, HIGH, MEDIUM, LOW or UNKNOWN)", name, v)
+	}
+}
+
+// channelSeverity returns the minimum severity for a notification channel.
+// An empty result means every event.
+func (c *Config) channelSeverity(channel string) string {
+	switch channel {
+	case channelSlack:
+		return c.SlackMinSeverity
+	case channelTeams:
+		return c.TeamsMinSeverity
+	case channelEmail:
+		return c.EmailMinSeverity
+	case channelWebhook:
+		return c.WebhookMinSeverity
+	case channelGitHub:
+		return c.GitHubMinSeverity
+	default:
+		return c.MinSeverity
+	}
+}
+
+// parseWebhookHeaders parses comma-separated Name=value pairs. A value
+// starting with @ is read from that file, so secrets can come from mounted
+// Secrets instead of the environment.
+func parseWebhookHeaders(s string) (http.Header, error) {
+	headers := http.Header{}
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if !ok || !validHeaderName(name) {
+			return nil, fmt.Errorf("malformed entry %q (use Name=value or Name=@/path/to/file)", entry)
+		}
+		value, err := secretValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("header %s: %w", name, err)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, fmt.Errorf("header %s: value must not contain line breaks", name)
+		}
+		headers.Add(name, value)
+	}
+	return headers, nil
+}
+
+// secretValue returns v, or the contents of the file it names if it starts
+// with @ (without a trailing newline).
+func secretValue(v string) (string, error) {
+	path, ok := strings.CutPrefix(v, "@")
+	if !ok {
+		return v, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// validHeaderName reports whether s is a non-empty HTTP token
+func validHeaderName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c > 127 || !strings.ContainsRune("!#$%&'*+-.^_`|~", c) && !('0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// parseDays parses a duration that may also be given in whole days ("90d").
+func parseDays(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
 }
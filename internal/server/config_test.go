@@ -0,0 +1,43 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetentionConfig(t *testing.T) {
+	if cfg := testConfig(t, nil); cfg.RetentionFixed != 90*24*time.Hour || cfg.RetentionSnapshots != 365*24*time.Hour {
+		t.Errorf("default retention = %v fixed, %v snapshots", cfg.RetentionFixed, cfg.RetentionSnapshots)
+	}
+
+	for value, want := range map[string]time.Duration{
+		"30d":  30 * 24 * time.Hour,
+		"720h": 720 * time.Hour,
+		"0":    0, // Disabled
+		"0d":   0,
+	} {
+		if got := testConfig(t, map[string]string{"TRIX_RETENTION_FIXED": value}).RetentionFixed; got != want {
+			t.Errorf("TRIX_RETENTION_FIXED=%s: %v, want %v", value, got, want)
+		}
+	}
+
+	for _, value := range []string{"-1d", "-5m", "ninety days", "90days", "d"} {
+		t.Setenv(ConfigFileEnv, "")
+		t.Setenv("TRIX_DATABASE_URL", "memory://")
+		t.Setenv("TRIX_RETENTION_FIXED", value)
+		if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "invalid TRIX_RETENTION_FIXED") {
+			t.Errorf("TRIX_RETENTION_FIXED=%s: err = %v", value, err)
+		}
+	}
+}
+
+func TestNamespacesConfig(t *testing.T) {
+	if got := testConfig(t, nil).Namespaces; got != nil {
+		t.Errorf("default namespaces = %v, want all", got)
+	}
+	got := testConfig(t, map[string]string{"TRIX_NAMESPACES": "payments, shop"}).Namespaces
+	if strings.Join(got, "|") != "payments|shop" {
+		t.Errorf("namespaces = %q", got)
+	}
+}
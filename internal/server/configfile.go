@@ -0,0 +1,392 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFileEnv names the YAML configuration file
+const ConfigFileEnv = "TRIX_CONFIG"
+
+// fileSuffix marks a key whose value is read from the named file, for
+// mounted secrets, e.g. notifications.slack.webhook_file
+const fileSuffix = "_file"
+
+// redaction is how --print-config hides a value
+type redaction int
+
+const (
+	redactNone     redaction = iota
+	redactSecret             // The whole value
+	redactPassword           // The password of a URL
+)
+
+// configKey maps a key of the configuration file to its environment variable.
+type configKey struct {
+	key    string // Dotted path in the file
+	env    string
+	redact redaction
+}
+
+// configKeys lists every setting the configuration file accepts, in the
+// order --print-config shows them. Lists may be given as YAML sequences or
+// comma-separated strings.
+var configKeys = []configKey{
+	{"database.url", "TRIX_DATABASE_URL", redactPassword},
+	{"database.max_open_conns", "TRIX_DB_MAX_OPEN_CONNS", redactNone},
+	{"database.max_idle_conns", "TRIX_DB_MAX_IDLE_CONNS", redactNone},
+	{"database.conn_max_lifetime", "TRIX_DB_CONN_MAX_LIFETIME", redactNone},
+	{"database.connect_attempts", "TRIX_DB_CONNECT_ATTEMPTS", redactNone},
+	{"database.connect_timeout", "TRIX_DB_CONNECT_TIMEOUT", redactNone},
+
+	{"poll.interval", "TRIX_POLL_INTERVAL", redactNone},
+	{"poll.concurrency", "TRIX_POLL_CONCURRENCY", redactNone},
+	{"poll.jitter", "TRIX_POLL_JITTER", redactNone},
+	{"poll.namespaces", "TRIX_NAMESPACES", redactNone},
+	{"poll.track_types", "TRIX_TRACK_TYPES", redactNone},
+	{"poll.exposure_enrich", "TRIX_EXPOSURE_ENRICH", redactNone},
+
+	{"watch.enabled", "TRIX_WATCH", redactNone},
+	{"watch.resync", "TRIX_WATCH_RESYNC", redactNone},
+	{"watch.debounce", "TRIX_WATCH_DEBOUNCE", redactNone},
+
+	{"retention.fixed", "TRIX_RETENTION_FIXED", redactNone},
+	{"retention.snapshots", "TRIX_RETENTION_SNAPSHOTS", redactNone},
+
+	{"leader_election.enabled", "TRIX_LEADER_ELECTION", redactNone},
+	{"leader_election.lease_name", "TRIX_LEADER_LEASE_NAME", redactNone},
+	{"leader_election.lease_namespace", "TRIX_LEADER_LEASE_NAMESPACE", redactNone},
+
+	{"cluster_name", "TRIX_CLUSTER_NAME", redactNone},
+	{"cluster_labels", "TRIX_CLUSTER_LABELS", redactNone},
+
+	{"notifications.severity", "TRIX_NOTIFY_SEVERITY", redactNone},
+	{"notifications.downgrades", "TRIX_NOTIFY_DOWNGRADES", redactNone},
+	{"notifications.digest_schedule", "TRIX_DIGEST_SCHEDULE", redactNone},
+	{"notifications.timezone", "TRIX_TZ", redactNone},
+	{"notifications.template_dir", "TRIX_TEMPLATE_DIR", redactNone},
+	{"notifications.delivery_max_attempts", "TRIX_DELIVERY_MAX_ATTEMPTS", redactNone},
+	{"notifications.workload_interval", "TRIX_NOTIFY_WORKLOAD_INTERVAL", redactNone},
+	{"notifications.max_workloads", "TRIX_NOTIFY_MAX_WORKLOADS", redactNone},
+	{"notifications.event_batch_size", "TRIX_EVENT_BATCH_SIZE", redactNone},
+
+	{"notifications.slack.webhook", "TRIX_NOTIFY_SLACK", redactSecret},
+	{"notifications.slack.bot_token", "TRIX_SLACK_BOT_TOKEN", redactSecret},
+	{"notifications.slack.channel", "TRIX_SLACK_CHANNEL", redactNone},
+	{"notifications.slack.legacy", "TRIX_SLACK_LEGACY", redactNone},
+	{"notifications.slack.severity", "TRIX_SLACK_SEVERITY", redactNone},
+
+	{"notifications.teams.webhook", "TRIX_NOTIFY_TEAMS", redactSecret},
+	{"notifications.teams.severity", "TRIX_TEAMS_SEVERITY", redactNone},
+
+	{"notifications.webhook.url", "TRIX_NOTIFY_WEBHOOK", redactPassword},
+	{"notifications.webhook.secret", "TRIX_WEBHOOK_SECRET", redactSecret},
+	{"notifications.webhook.headers", "TRIX_WEBHOOK_HEADERS", redactSecret},
+	{"notifications.webhook.basic_auth", "TRIX_WEBHOOK_BASIC_AUTH", redactSecret},
+	{"notifications.webhook.timeout", "TRIX_WEBHOOK_TIMEOUT", redactNone},
+	{"notifications.webhook.severity", "TRIX_WEBHOOK_SEVERITY", redactNone},
+	{"notifications.webhook.tls.ca_file", "TRIX_WEBHOOK_TLS_CA_FILE", redactNone},
+	{"notifications.webhook.tls.client_cert", "TRIX_WEBHOOK_TLS_CLIENT_CERT", redactNone},
+	{"notifications.webhook.tls.client_key", "TRIX_WEBHOOK_TLS_CLIENT_KEY", redactNone},
+
+	{"notifications.email.smtp_host", "TRIX_SMTP_HOST", redactNone},
+	{"notifications.email.smtp_port", "TRIX_SMTP_PORT", redactNone},
+	{"notifications.email.smtp_tls", "TRIX_SMTP_TLS", redactNone},
+	{"notifications.email.smtp_username", "TRIX_SMTP_USERNAME", redactNone},
+	{"notifications.email.smtp_password", "TRIX_SMTP_PASSWORD", redactSecret},
+	{"notifications.email.smtp_insecure_skip_verify", "TRIX_SMTP_INSECURE_SKIP_VERIFY", redactNone},
+	{"notifications.email.from", "TRIX_EMAIL_FROM", redactNone},
+	{"notifications.email.to", "TRIX_EMAIL_TO", redactNone},
+	{"notifications.email.digest", "TRIX_EMAIL_DIGEST", redactNone},
+	{"notifications.email.digest_hour", "TRIX_EMAIL_DIGEST_HOUR", redactNone},
+	{"notifications.email.severity", "TRIX_EMAIL_SEVERITY", redactNone},
+
+	{"notifications.github.repo", "TRIX_NOTIFY_GITHUB_REPO", redactNone},
+	{"notifications.github.token", "TRIX_GITHUB_TOKEN", redactSecret},
+	{"notifications.github.severity", "TRIX_GITHUB_SEVERITY", redactNone},
+	{"notifications.github.api_url", "TRIX_GITHUB_API_URL", redactNone},
+
+	{"notifications.saas.endpoint", "TRIX_SAAS_ENDPOINT", redactNone},
+	{"notifications.saas.api_key", "TRIX_SAAS_API_KEY", redactSecret},
+	{"notifications.saas.severity", "TRIX_SAAS_SEVERITY", redactNone},
+
+	{"outgoing.http_proxy", "TRIX_HTTP_PROXY", redactPassword},
+	{"outgoing.tls.ca_file", "TRIX_TLS_CA_FILE", redactNone},
+	{"outgoing.tls.client_cert", "TRIX_TLS_CLIENT_CERT", redactNone},
+	{"outgoing.tls.client_key", "TRIX_TLS_CLIENT_KEY", redactNone},
+
+	{"server.health_addr", "TRIX_HEALTH_ADDR", redactNone},
+	{"server.api_token", "TRIX_API_TOKEN", redactSecret},
+	{"server.tls_cert", "TRIX_TLS_CERT", redactNone},
+	{"server.tls_key", "TRIX_TLS_KEY", redactNone},
+	{"server.shutdown_grace", "TRIX_SHUTDOWN_GRACE", redactNone},
+
+	{"log.format", "TRIX_LOG_FORMAT", redactNone},
+	{"log.level", "TRIX_LOG_LEVEL", redactNone},
+	{"otel.endpoint", "TRIX_OTEL_ENDPOINT", redactNone},
+}
+
+// configSource resolves settings in order of precedence: a non-empty
+// environment variable, then the TRIX_CONFIG file, then the default.
+type configSource struct {
+	path string
+	file map[string]string // Env var -> value from the file
+	keys map[string]string // Env var -> key it was set by in the file
+}
+
+// loadConfigSource reads the configuration file at path, if any. Unknown
+// keys, values that aren't scalars or lists and unreadable *_file
+// references are errors naming the key.
+func loadConfigSource(path string) (*configSource, error) {
+	src := &configSource{path: path, file: make(map[string]string), keys: make(map[string]string)}
+	if path == "" {
+		return src, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", ConfigFileEnv, err)
+	}
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid %s %s: %w", ConfigFileEnv, path, err)
+	}
+
+	byKey := make(map[string]configKey, len(configKeys))
+	for _, k := range configKeys {
+		byKey[k.key] = k
+	}
+	values := make(map[string]interface{})
+	flattenConfig("", doc, byKey, values)
+
+	paths := make([]string, 0, len(values))
+	for p := range values {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		name, fromFile := p, false
+		if _, ok := byKey[p]; !ok {
+			name, fromFile = strings.CutSuffix(p, fileSuffix)
+		}
+		k, ok := byKey[name]
+		if !ok {
+			return nil, fmt.Errorf("%s: unknown key %q", path, p)
+		}
+		if prev, ok := src.keys[k.env]; ok {
+			return nil, fmt.Errorf("%s: %q and %q are both set", path, prev, p)
+		}
+
+		v, err := configValue(values[p])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", path, p, err)
+		}
+		if fromFile {
+			content, err := os.ReadFile(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s: %w", path, p, err)
+			}
+			v = strings.TrimRight(string(content), "\r\n")
+		}
+		src.file[k.env] = v
+		src.keys[k.env] = p
+	}
+	return src, nil
+}
+
+// flattenConfig collects the values of doc by dotted path. Known keys are
+// leaves even when their value is a mapping, such as webhook headers.
+func flattenConfig(prefix string, doc map[string]interface{}, known map[string]configKey, out map[string]interface{}) {
+	for name, v := range doc {
+		p := name
+		if prefix != "" {
+			p = prefix + "." + name
+		}
+		if m, ok := v.(map[string]interface{}); ok {
+			if _, leaf := known[p]; !leaf {
+				flattenConfig(p, m, known, out)
+				continue
+			}
+		}
+		out[p] = v
+	}
+}
+
+// configValue renders a file value the way the environment variable is
+// written: lists comma-separated, mappings as Name=value pairs.
+func configValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool, int, float64:
+		return fmt.Sprint(v), nil
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			s, err := configValue(item)
+			if err != nil {
+				return "", err
+			}
+			if strings.Contains(s, ",") {
+				return "", fmt.Errorf("list item %q contains a comma", s)
+			}
+			items = append(items, s)
+		}
+		return strings.Join(items, ","), nil
+	case map[string]interface{}:
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		pairs := make([]string, 0, len(v))
+		for _, name := range names {
+			s, err := configValue(v[name])
+			if err != nil {
+				return "", err
+			}
+			pairs = append(pairs, name+"="+s)
+		}
+		return strings.Join(pairs, ","), nil
+	default:
+		return "", fmt.Errorf("unsupported value %v", v)
+	}
+}
+
+// get returns the value of the setting with environment variable env.
+func (s *configSource) get(env string) string {
+	if v := os.Getenv(env); v != "" {
+		return v
+	}
+	return s.file[env]
+}
+
+// origin annotates a printed value: the variable when the environment set
+// it, the key when it was read from a *_file reference.
+func (s *configSource) origin(env string) string {
+	if os.Getenv(env) != "" {
+		return env
+	}
+	if key := s.keys[env]; strings.HasSuffix(key, fileSuffix) {
+		return key
+	}
+	return ""
+}
+
+var envNamePattern = regexp.MustCompile(`TRIX_[A-Z0-9_]+`)
+
+// explain adds the file keys behind the variables an error names, so a bad
+// value set in the file can be found there.
+func (s *configSource) explain(err error) error {
+	var keys []string
+	seen := make(map[string]bool)
+	for _, env := range envNamePattern.FindAllString(err.Error(), -1) {
+		if seen[env] || os.Getenv(env) != "" {
+			continue
+		}
+		seen[env] = true
+		if key, ok := s.keys[env]; ok {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return err
+	}
+	return fmt.Errorf("%w (set by %s in %s)", err, strings.Join(keys, ", "), s.path)
+}
+
+// LookupConfig returns the value of one setting, by environment variable,
+// from the environment or the TRIX_CONFIG file.
+func LookupConfig(env string) (string, error) {
+	src, err := loadConfigSource(os.Getenv(ConfigFileEnv))
+	if err != nil {
+		return "", err
+	}
+	return src.get(env), nil
+}
+
+// PrintConfig validates the configuration and writes the settings that are
+// set, as a configuration file with secrets redacted. Values set through the
+// environment or a *_file reference are annotated; unset settings use their
+// defaults.
+func PrintConfig(w io.Writer) error {
+	src, err := loadConfigSource(os.Getenv(ConfigFileEnv))
+	if err != nil {
+		return err
+	}
+	if _, err := loadConfig(src); err != nil {
+		return src.explain(err)
+	}
+
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	for _, k := range configKeys {
+		v := src.get(k.env)
+		if v == "" {
+			continue
+		}
+		parent := root
+		parts := strings.Split(k.key, ".")
+		for _, part := range parts[:len(parts)-1] {
+			parent = childMapping(parent, part)
+		}
+		parent.Content = append(parent.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: parts[len(parts)-1]},
+			&yaml.Node{Kind: yaml.ScalarNode, Value: redactValue(v, k.redact), LineComment: src.origin(k.env)},
+		)
+	}
+	if len(root.Content) == 0 {
+		_, err := fmt.Fprintln(w, "# Nothing set, every setting uses its default")
+		return err
+	}
+	if src.path != "" {
+		root.HeadComment = "Effective configuration, from " + src.path + " and the environment"
+	} else {
+		root.HeadComment = "Effective configuration, from the environment"
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(root); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// childMapping returns the mapping under key in parent, adding it if needed
+func childMapping(parent *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(parent.Content); i += 2 {
+		if parent.Content[i].Value == key {
+			return parent.Content[i+1]
+		}
+	}
+	child := &yaml.Node{Kind: yaml.MappingNode}
+	parent.Content = append(parent.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, child)
+	return child
+}
+
+func redactValue(v string, r redaction) string {
+	switch r {
+	case redactSecret:
+		return "REDACTED"
+	case redactPassword:
+		if u, err := url.Parse(v); err == nil && u.User != nil {
+			return u.Redacted()
+		}
+		if strings.Contains(v, "password=") {
+			// lib/pq keyword/value connection strings
+			return "REDACTED"
+		}
+		return v
+	default:
+		return v
+	}
+}
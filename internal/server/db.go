@@ -4,7 +4,8 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/lib/pq"
@@ -20,121 +21,158 @@ const (
 
 // VulnerabilityRecord represents a vulnerability in the database.
 type VulnerabilityRecord struct {
-	ID              string // hash(cve + workload + package + container)
-	CVE             string
+	ID              string // hash(cve + workload + package + container), see findingToRecord for other kinds
+	Kind            string // KindVulnerability, KindSecret or KindCompliance
+	CVE             string // CVE, secret rule ID or config check ID
+	Title           string // Secret rule or config check title; empty for vulnerabilities
 	Workload        string // namespace/kind/name
+	Namespace       string // Empty for cluster-scoped reports; written by the poller, not read back
 	Severity        string
-	Image           string // package:version (legacy, kept for compatibility)
+	Image           string // package:version (legacy, kept for compatibility); file path for secrets
 	ContainerName   string
 	ImageRepository string
 	ImageTag        string
 	ImageDigest     string
+	FixedVersion    string // Version that fixes the vulnerability; empty if none or another kind
+	Exposure        string // Network exposure of the workload (TRIX_EXPOSURE_ENRICH); empty if not analyzed
 	State           VulnerabilityState
 	FirstSeen       time.Time
 	LastSeen        time.Time
 	FixedAt         *time.Time
 }
 
-// DB wraps the PostgreSQL connection and provides vulnerability operations.
+// dialect selects the SQL flavor a DB speaks.
+type dialect int
+
+const (
+	dialectPostgres dialect = iota
+	dialectMySQL
+)
+
+// DB wraps a SQL connection (PostgreSQL or MySQL/MariaDB) and provides
+// vulnerability operations. Queries are written for PostgreSQL and rebound
+// for MySQL where the syntax differs only in placeholders.
 type DB struct {
-	conn *sql.DB
+	conn    *sql.DB
+	dialect dialect
+	maxIdle int // TRIX_DB_MAX_IDLE_CONNS, restored after Ping drops idle connections
+	logger  *slog.Logger
 }
 
-// NewDB creates a new database connection and ensures schema exists.
-func NewDB(ctx context.Context, databaseURL string) (*DB, error) {
-	conn, err := sql.Open("postgres", databaseURL)
+// Backoff between startup connection attempts, doubling up to the maximum.
+// Variables so tests can shorten them.
+var (
+	connectBackoff    = time.Second
+	connectMaxBackoff = 30 * time.Second
+)
+
+// NewDB creates a new database connection and applies pending migrations.
+// The database may come up after trix (e.g. in the same Helm release), so
+// it is pinged with backoff up to TRIX_DB_CONNECT_ATTEMPTS times within
+// TRIX_DB_CONNECT_TIMEOUT.
+// mysql:// URLs use MySQL/MariaDB; anything else is passed to the PostgreSQL driver.
+func NewDB(ctx context.Context, config *Config, logger *slog.Logger) (*DB, error) {
+	driver, dsn, d := "postgres", config.DatabaseURL, dialectPostgres
+	if strings.HasPrefix(config.DatabaseURL, "mysql://") {
+		var err error
+		dsn, err = mysqlDSN(config.DatabaseURL)
+		if err != nil {
+			return nil, err
+		}
+		driver, d = "mysql", dialectMySQL
+	}
+
+	conn, err := sql.Open(driver, dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	// Test connection
-	if err := conn.PingContext(ctx); err != nil {
+	conn.SetMaxOpenConns(config.DBMaxOpenConns)
+	conn.SetMaxIdleConns(config.DBMaxIdleConns)
+	conn.SetConnMaxLifetime(config.DBConnMaxLifetime)
+
+	if err := waitForDB(ctx, conn, config.DBConnectAttempts, config.DBConnectTimeout, logger); err != nil {
+		_ = conn.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	db := &DB{conn: conn}
+	db := &DB{conn: conn, dialect: d, maxIdle: config.DBMaxIdleConns, logger: logger}
 
-	// Ensure schema exists
 	if err := db.migrate(ctx); err != nil {
+		_ = conn.Close()
 		return nil, fmt.Errorf("failed to migrate database: %w", err)
 	}
 
 	return db, nil
 }
 
-// Close closes the database connection.
-func (db *DB) Close() error {
-	return db.conn.Close()
-}
-
-// migrate ensures the database schema exists.
-func (db *DB) migrate(ctx context.Context) error {
-	// Create base table if not exists
-	baseSchema := `
-	CREATE TABLE IF NOT EXISTS vulnerabilities (
-		id TEXT PRIMARY KEY,
-		cve TEXT NOT NULL,
-		workload TEXT NOT NULL,
-		severity TEXT NOT NULL,
-		image TEXT,
-		state TEXT NOT NULL DEFAULT 'OPEN',
-		first_seen TIMESTAMPTZ NOT NULL DEFAULT NOW(),
-		last_seen TIMESTAMPTZ NOT NULL DEFAULT NOW(),
-		fixed_at TIMESTAMPTZ
-	);
-
-	CREATE INDEX IF NOT EXISTS idx_vuln_state ON vulnerabilities(state);
-	CREATE INDEX IF NOT EXISTS idx_vuln_severity ON vulnerabilities(severity);
-	CREATE INDEX IF NOT EXISTS idx_vuln_cve ON vulnerabilities(cve);
-	CREATE INDEX IF NOT EXISTS idx_vuln_workload ON vulnerabilities(workload);
-	`
-
-	if _, err := db.conn.ExecContext(ctx, baseSchema); err != nil {
-		return err
-	}
-
-	// Migration: add saas_synced column if it doesn't exist (for existing databases)
-	if _, err := db.conn.ExecContext(ctx, `
-		ALTER TABLE vulnerabilities ADD COLUMN IF NOT EXISTS saas_synced BOOLEAN NOT NULL DEFAULT FALSE
-	`); err != nil {
-		log.Printf("migration warning: add saas_synced column: %v", err)
-	}
+// waitForDB pings conn until it answers, at most attempts times within
+// timeout.
+func waitForDB(ctx context.Context, conn *sql.DB, attempts int, timeout time.Duration, logger *slog.Logger) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	backoff := connectBackoff
+	var lastErr error
+	for attempt := 1; ; attempt++ {
+		err := conn.PingContext(ctx)
+		if err == nil {
+			if attempt > 1 {
+				logger.Info("database reachable", "attempts", attempt)
+			}
+			return nil
+		}
+		// A ping cut off by the timeout says less than the previous failure
+		if lastErr == nil || ctx.Err() == nil {
+			lastErr = err
+		}
+		if attempt >= attempts || ctx.Err() != nil {
+			return fmt.Errorf("giving up after %d attempts: %w", attempt, lastErr)
+		}
 
-	// Create index on saas_synced (after column exists)
-	if _, err := db.conn.ExecContext(ctx, `
-		CREATE INDEX IF NOT EXISTS idx_vuln_saas_synced ON vulnerabilities(saas_synced) WHERE NOT saas_synced
-	`); err != nil {
-		log.Printf("migration warning: create saas_synced index: %v", err)
+		logger.Warn("database not reachable, retrying", "attempt", attempt, "retry_in", backoff, "error", err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("giving up after %d attempts: %w", attempt, lastErr)
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, connectMaxBackoff)
 	}
+}
 
-	// Migration: add container/image tracking columns
-	if _, err := db.conn.ExecContext(ctx, `
-		ALTER TABLE vulnerabilities ADD COLUMN IF NOT EXISTS container_name TEXT;
-		ALTER TABLE vulnerabilities ADD COLUMN IF NOT EXISTS image_repository TEXT;
-		ALTER TABLE vulnerabilities ADD COLUMN IF NOT EXISTS image_tag TEXT;
-		ALTER TABLE vulnerabilities ADD COLUMN IF NOT EXISTS image_digest TEXT;
-	`); err != nil {
-		log.Printf("migration warning: add container tracking columns: %v", err)
+// Ping checks the database connection. When it fails, the idle connections
+// are closed and the ping is retried on a new one, so connections broken by
+// a database or pgbouncer restart are replaced rather than reused.
+func (db *DB) Ping(ctx context.Context) error {
+	err := db.conn.PingContext(ctx)
+	if err == nil || ctx.Err() != nil {
+		return err
 	}
-
-	// Create index on image_digest for tracking
-	if _, err := db.conn.ExecContext(ctx, `
-		CREATE INDEX IF NOT EXISTS idx_vuln_image_digest ON vulnerabilities(image_digest) WHERE image_digest IS NOT NULL
-	`); err != nil {
-		log.Printf("migration warning: create image_digest index: %v", err)
+	db.conn.SetMaxIdleConns(0)
+	db.conn.SetMaxIdleConns(db.maxIdle)
+	if err := db.conn.PingContext(ctx); err != nil {
+		return err
 	}
-
+	db.logger.Info("reconnected to database")
 	return nil
 }
 
-// MarkSaasSynced marks vulnerabilities as synced to SaaS.
+// Close closes the database connection.
+func (db *DB) Close() error {
+	return db.conn.Close()
+}
+
+// MarkSaasSynced marks vulnerabilities as synced to SaaS and records when.
 func (db *DB) MarkSaasSynced(ctx context.Context, ids []string) error {
 	if len(ids) == 0 {
 		return nil
 	}
+	if db.dialect == dialectMySQL {
+		return db.markSaasSyncedMySQL(ctx, ids)
+	}
 	_, err := db.conn.ExecContext(ctx,
-		"UPDATE vulnerabilities SET saas_synced = TRUE WHERE id = ANY($1)",
-		pq.Array(ids),
+		"UPDATE vulnerabilities SET saas_synced = TRUE, synced_at = $2 WHERE id = ANY($1)",
+		pq.Array(ids), time.Now(),
 	)
 	return err
 }
@@ -142,11 +180,11 @@ func (db *DB) MarkSaasSynced(ctx context.Context, ids []string) error {
 // GetUnsyncedVulnerabilities returns vulnerabilities that haven't been synced to SaaS.
 func (db *DB) GetUnsyncedVulnerabilities(ctx context.Context) ([]VulnerabilityRecord, error) {
 	rows, err := db.conn.QueryContext(ctx, `
-		SELECT id, cve, workload, severity, image,
+		SELECT id, kind, cve, COALESCE(title, ''), COALESCE(fixed_version, ''), COALESCE(exposure, ''), workload, severity, image,
 		       COALESCE(container_name, ''), COALESCE(image_repository, ''), COALESCE(image_tag, ''), COALESCE(image_digest, ''),
 		       state, first_seen, last_seen, fixed_at
 		FROM vulnerabilities
-		WHERE NOT saas_synced
+		WHERE saas_synced = FALSE
 		ORDER BY first_seen ASC
 		LIMIT 500
 	`)
@@ -158,7 +196,7 @@ func (db *DB) GetUnsyncedVulnerabilities(ctx context.Context) ([]VulnerabilityRe
 	var vulns []VulnerabilityRecord
 	for rows.Next() {
 		var v VulnerabilityRecord
-		if err := rows.Scan(&v.ID, &v.CVE, &v.Workload, &v.Severity, &v.Image,
+		if err := rows.Scan(&v.ID, &v.Kind, &v.CVE, &v.Title, &v.FixedVersion, &v.Exposure, &v.Workload, &v.Severity, &v.Image,
 			&v.ContainerName, &v.ImageRepository, &v.ImageTag, &v.ImageDigest,
 			&v.State, &v.FirstSeen, &v.LastSeen, &v.FixedAt); err != nil {
 			return nil, err
@@ -169,71 +207,108 @@ func (db *DB) GetUnsyncedVulnerabilities(ctx context.Context) ([]VulnerabilityRe
 	return vulns, rows.Err()
 }
 
-// UpsertVulnerability inserts or updates a vulnerability record.
-// Returns true if this is a new vulnerability.
-func (db *DB) UpsertVulnerability(ctx context.Context, v *VulnerabilityRecord) (isNew bool, err error) {
+// UpsertVulnerability inserts or updates a vulnerability record and reports
+// whether it is new or reopened, or had its severity changed.
+func (db *DB) UpsertVulnerability(ctx context.Context, v *VulnerabilityRecord) (VulnerabilityChange, error) {
 	// Check if exists
-	var existingState string
-	err = db.conn.QueryRowContext(ctx,
-		"SELECT state FROM vulnerabilities WHERE id = $1",
+	var existingState, existingSeverity, existingDigest string
+	var firstSeen time.Time
+	err := db.queryRow(ctx,
+		"SELECT state, severity, first_seen, COALESCE(image_digest, '') FROM vulnerabilities WHERE id = $1",
 		v.ID,
-	).Scan(&existingState)
+	).Scan(&existingState, &existingSeverity, &firstSeen, &existingDigest)
 
 	if err == sql.ErrNoRows {
 		// New vulnerability - insert
-		_, err = db.conn.ExecContext(ctx, `
-			INSERT INTO vulnerabilities (id, cve, workload, severity, image, container_name, image_repository, image_tag, image_digest, state, first_seen, last_seen)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $11)
-		`, v.ID, v.CVE, v.Workload, v.Severity, v.Image, v.ContainerName, v.ImageRepository, v.ImageTag, v.ImageDigest, StateOpen, time.Now())
-		return true, err
+		insert := `
+			INSERT INTO vulnerabilities (id, cve, workload, namespace, severity, image, container_name, image_repository, image_tag, image_digest, state, first_seen, last_seen, kind, title, fixed_version, exposure)
+			VALUES ($1, $2, $3, $12, $4, $5, $6, $7, $8, $9, $10, $11, $11, $13, $14, $15, $16)
+		`
+		// Another replica or poll worker may have inserted the row since the SELECT
+		if db.dialect == dialectMySQL {
+			insert += " ON DUPLICATE KEY UPDATE last_seen = VALUES(last_seen)"
+		} else {
+			insert += " ON CONFLICT (id) DO UPDATE SET last_seen = EXCLUDED.last_seen"
+		}
+		_, err = db.exec(ctx, insert, v.ID, v.CVE, v.Workload, v.Severity, v.Image, v.ContainerName, v.ImageRepository, v.ImageTag, v.ImageDigest, StateOpen, time.Now(), v.Namespace, recordKind(v), v.Title, v.FixedVersion, v.Exposure)
+		return VulnerabilityChange{New: true}, err
 	}
 
 	if err != nil {
-		return false, err
+		return VulnerabilityChange{}, err
 	}
 
 	// Existing vulnerability - update last_seen, reopen if was fixed
 	if existingState == string(StateFixed) {
 		// Reopened! Reset saas_synced so reopen event gets sent to SaaS
-		_, err = db.conn.ExecContext(ctx, `
+		_, err = db.exec(ctx, `
 			UPDATE vulnerabilities
 			SET state = $1, last_seen = $2, fixed_at = NULL, severity = $3, image = $4,
 			    container_name = $5, image_repository = $6, image_tag = $7, image_digest = $8,
-			    saas_synced = FALSE
+			    namespace = $10, title = $11, fixed_version = $12, exposure = $13, saas_synced = FALSE
 			WHERE id = $9
-		`, StateOpen, time.Now(), v.Severity, v.Image, v.ContainerName, v.ImageRepository, v.ImageTag, v.ImageDigest, v.ID)
-		return true, err // Treat reopen as "new" for notification purposes
+		`, StateOpen, time.Now(), v.Severity, v.Image, v.ContainerName, v.ImageRepository, v.ImageTag, v.ImageDigest, v.ID, v.Namespace, v.Title, v.FixedVersion, v.Exposure)
+		return VulnerabilityChange{New: true, FirstSeen: firstSeen}, err // Treat reopen as "new" for notification purposes
+	}
+
+	change := VulnerabilityChange{FirstSeen: firstSeen, OldImageDigest: imageChange(existingDigest, v.ImageDigest)}
+	if existingSeverity != v.Severity {
+		change.OldSeverity = existingSeverity
 	}
 
 	// Just update last_seen and image info
-	_, err = db.conn.ExecContext(ctx, `
+	_, err = db.exec(ctx, `
 		UPDATE vulnerabilities
-		SET last_seen = $1, severity = $2, image = $3, container_name = $4, image_repository = $5, image_tag = $6, image_digest = $7
+		SET last_seen = $1, severity = $2, image = $3, container_name = $4, image_repository = $5, image_tag = $6, image_digest = $7,
+		    namespace = $9, title = $10, fixed_version = $11, exposure = $12
 		WHERE id = $8
-	`, time.Now(), v.Severity, v.Image, v.ContainerName, v.ImageRepository, v.ImageTag, v.ImageDigest, v.ID)
-	return false, err
+	`, time.Now(), v.Severity, v.Image, v.ContainerName, v.ImageRepository, v.ImageTag, v.ImageDigest, v.ID, v.Namespace, v.Title, v.FixedVersion, v.Exposure)
+	return change, err
+}
+
+// imageChange returns old if the digest changed from old to current, or ""
+func imageChange(old, current string) string {
+	if old == "" || current == "" || old == current {
+		return ""
+	}
+	return old
 }
 
 // MarkFixed marks vulnerabilities as fixed if they weren't seen in the current scan.
-// Returns the list of vulnerabilities that were marked as fixed.
-func (db *DB) MarkFixed(ctx context.Context, currentIDs []string) ([]VulnerabilityRecord, error) {
-	if len(currentIDs) == 0 {
-		// No vulnerabilities in current scan - mark all as fixed
-		return db.markAllFixed(ctx)
+// Only rows in the given namespaces and of the given kinds are considered
+// (all rows if empty). Returns the list of vulnerabilities that were marked as fixed.
+func (db *DB) MarkFixed(ctx context.Context, namespaces, kinds, currentIDs []string) ([]VulnerabilityRecord, error) {
+	if db.dialect == dialectMySQL {
+		// No RETURNING in MySQL
+		return db.markFixedMySQL(ctx, namespaces, kinds, currentIDs)
 	}
 
 	// Build query to find OPEN vulnerabilities not in current scan
+	now := time.Now()
+	args := []interface{}{StateFixed, now, StateOpen}
+	where := "state = $3"
+	if len(currentIDs) > 0 {
+		args = append(args, pq.Array(currentIDs))
+		where += fmt.Sprintf(" AND id != ALL($%d)", len(args))
+	}
+	if len(namespaces) > 0 {
+		args = append(args, pq.Array(namespaces))
+		where += fmt.Sprintf(" AND namespace = ANY($%d)", len(args))
+	}
+	if len(kinds) > 0 {
+		args = append(args, pq.Array(kinds))
+		where += fmt.Sprintf(" AND kind = ANY($%d)", len(args))
+	}
 	query := `
 		UPDATE vulnerabilities
 		SET state = $1, fixed_at = $2
-		WHERE state = $3 AND id != ALL($4)
-		RETURNING id, cve, workload, severity, image,
+		WHERE ` + where + `
+		RETURNING id, kind, cve, COALESCE(title, ''), COALESCE(fixed_version, ''), COALESCE(exposure, ''), workload, severity, image,
 		          COALESCE(container_name, ''), COALESCE(image_repository, ''), COALESCE(image_tag, ''), COALESCE(image_digest, ''),
 		          first_seen
 	`
 
-	now := time.Now()
-	rows, err := db.conn.QueryContext(ctx, query, StateFixed, now, StateOpen, pq.Array(currentIDs))
+	rows, err := db.conn.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -242,7 +317,7 @@ func (db *DB) MarkFixed(ctx context.Context, currentIDs []string) ([]Vulnerabili
 	var fixed []VulnerabilityRecord
 	for rows.Next() {
 		var v VulnerabilityRecord
-		if err := rows.Scan(&v.ID, &v.CVE, &v.Workload, &v.Severity, &v.Image,
+		if err := rows.Scan(&v.ID, &v.Kind, &v.CVE, &v.Title, &v.FixedVersion, &v.Exposure, &v.Workload, &v.Severity, &v.Image,
 			&v.ContainerName, &v.ImageRepository, &v.ImageTag, &v.ImageDigest,
 			&v.FirstSeen); err != nil {
 			return nil, err
@@ -255,55 +330,27 @@ func (db *DB) MarkFixed(ctx context.Context, currentIDs []string) ([]Vulnerabili
 	return fixed, rows.Err()
 }
 
-func (db *DB) markAllFixed(ctx context.Context) ([]VulnerabilityRecord, error) {
-	query := `
-		UPDATE vulnerabilities
-		SET state = $1, fixed_at = $2
-		WHERE state = $3
-		RETURNING id, cve, workload, severity, image,
-		          COALESCE(container_name, ''), COALESCE(image_repository, ''), COALESCE(image_tag, ''), COALESCE(image_digest, ''),
-		          first_seen
-	`
-
-	now := time.Now()
-	rows, err := db.conn.QueryContext(ctx, query, StateFixed, now, StateOpen)
+// PruneFixed deletes FIXED vulnerabilities whose fixed_at is strictly before
+// cutoff and returns how many were deleted. Open vulnerabilities are never pruned.
+func (db *DB) PruneFixed(ctx context.Context, cutoff time.Time) (int64, error) {
+	res, err := db.exec(ctx,
+		"DELETE FROM vulnerabilities WHERE state = $1 AND fixed_at < $2",
+		StateFixed, cutoff,
+	)
 	if err != nil {
-		return nil, err
-	}
-	defer func() { _ = rows.Close() }()
-
-	var fixed []VulnerabilityRecord
-	for rows.Next() {
-		var v VulnerabilityRecord
-		if err := rows.Scan(&v.ID, &v.CVE, &v.Workload, &v.Severity, &v.Image,
-			&v.ContainerName, &v.ImageRepository, &v.ImageTag, &v.ImageDigest,
-			&v.FirstSeen); err != nil {
-			return nil, err
-		}
-		v.State = StateFixed
-		v.FixedAt = &now
-		fixed = append(fixed, v)
+		return 0, err
 	}
-
-	return fixed, rows.Err()
+	return res.RowsAffected()
 }
 
 // GetOpenVulnerabilities returns all open vulnerabilities.
 func (db *DB) GetOpenVulnerabilities(ctx context.Context) ([]VulnerabilityRecord, error) {
-	rows, err := db.conn.QueryContext(ctx, `
-		SELECT id, cve, workload, severity, image,
+	rows, err := db.query(ctx, `
+		SELECT id, kind, cve, COALESCE(title, ''), COALESCE(fixed_version, ''), COALESCE(exposure, ''), workload, severity, image,
 		       COALESCE(container_name, ''), COALESCE(image_repository, ''), COALESCE(image_tag, ''), COALESCE(image_digest, ''),
 		       state, first_seen, last_seen, fixed_at
 		FROM vulnerabilities WHERE state = $1
-		ORDER BY
-			CASE severity
-				WHEN 'CRITICAL' THEN 1
-				WHEN 'HIGH' THEN 2
-				WHEN 'MEDIUM' THEN 3
-				WHEN 'LOW' THEN 4
-				ELSE 5
-			END,
-			first_seen DESC
+		ORDER BY `+severityOrderSQL+`, first_seen DESC
 	`, StateOpen)
 	if err != nil {
 		return nil, err
@@ -313,7 +360,7 @@ func (db *DB) GetOpenVulnerabilities(ctx context.Context) ([]VulnerabilityRecord
 	var vulns []VulnerabilityRecord
 	for rows.Next() {
 		var v VulnerabilityRecord
-		if err := rows.Scan(&v.ID, &v.CVE, &v.Workload, &v.Severity, &v.Image,
+		if err := rows.Scan(&v.ID, &v.Kind, &v.CVE, &v.Title, &v.FixedVersion, &v.Exposure, &v.Workload, &v.Severity, &v.Image,
 			&v.ContainerName, &v.ImageRepository, &v.ImageTag, &v.ImageDigest,
 			&v.State, &v.FirstSeen, &v.LastSeen, &v.FixedAt); err != nil {
 			return nil, err
@@ -329,23 +376,31 @@ type Stats struct {
 	TotalOpen  int
 	TotalFixed int
 	BySeverity map[string]int
+	MTTR       map[string]MTTR // By severity, for vulnerabilities fixed within the window passed to GetStats
+}
+
+// MTTR is the mean time to remediate of Count fixed vulnerabilities.
+type MTTR struct {
+	Count int
+	Mean  time.Duration
 }
 
-// GetStats returns vulnerability statistics.
-func (db *DB) GetStats(ctx context.Context) (*Stats, error) {
+// GetStats returns vulnerability statistics. With mttrWindow > 0 it also
+// aggregates the time to fix of vulnerabilities fixed within that window.
+func (db *DB) GetStats(ctx context.Context, mttrWindow time.Duration) (*Stats, error) {
 	stats := &Stats{
 		BySeverity: make(map[string]int),
 	}
 
 	// Count by state
-	err := db.conn.QueryRowContext(ctx,
+	err := db.queryRow(ctx,
 		"SELECT COUNT(*) FROM vulnerabilities WHERE state = $1", StateOpen,
 	).Scan(&stats.TotalOpen)
 	if err != nil {
 		return nil, err
 	}
 
-	err = db.conn.QueryRowContext(ctx,
+	err = db.queryRow(ctx,
 		"SELECT COUNT(*) FROM vulnerabilities WHERE state = $1", StateFixed,
 	).Scan(&stats.TotalFixed)
 	if err != nil {
@@ -353,7 +408,7 @@ func (db *DB) GetStats(ctx context.Context) (*Stats, error) {
 	}
 
 	// Count by severity (open only)
-	rows, err := db.conn.QueryContext(ctx, `
+	rows, err := db.query(ctx, `
 		SELECT severity, COUNT(*) FROM vulnerabilities
 		WHERE state = $1 GROUP BY severity
 	`, StateOpen)
@@ -370,6 +425,89 @@ func (db *DB) GetStats(ctx context.Context) (*Stats, error) {
 		}
 		stats.BySeverity[sev] = count
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if mttrWindow > 0 {
+		if stats.MTTR, err = db.getMTTR(ctx, time.Now().Add(-mttrWindow)); err != nil {
+			return nil, err
+		}
+	}
+	return stats, nil
+}
+
+// getMTTR averages fixed_at - first_seen by severity for vulnerabilities
+// fixed at or after since.
+func (db *DB) getMTTR(ctx context.Context, since time.Time) (map[string]MTTR, error) {
+	seconds := "EXTRACT(EPOCH FROM (fixed_at - first_seen))"
+	if db.dialect == dialectMySQL {
+		seconds = "TIMESTAMPDIFF(MICROSECOND, first_seen, fixed_at) / 1000000"
+	}
+	rows, err := db.query(ctx, `
+		SELECT severity, COUNT(*), AVG(`+seconds+`) FROM vulnerabilities
+		WHERE state = $1 AND fixed_at >= $2 GROUP BY severity
+	`, StateFixed, since)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	mttr := make(map[string]MTTR)
+	for rows.Next() {
+		var sev string
+		var count int
+		var mean float64
+		if err := rows.Scan(&sev, &count, &mean); err != nil {
+			return nil, err
+		}
+		mttr[sev] = MTTR{Count: count, Mean: time.Duration(mean * float64(time.Second))}
+	}
+	return mttr, rows.Err()
+}
+
+// rebind converts PostgreSQL-style $N placeholders for the current dialect.
+// MySQL only has positional ?, so args are reordered (and repeated) to match.
+func (db *DB) rebind(query string, args []interface{}) (string, []interface{}) {
+	if db.dialect != dialectMySQL {
+		return query, args
+	}
+
+	var b strings.Builder
+	var bound []interface{}
+	for i := 0; i < len(query); i++ {
+		if query[i] != '$' {
+			b.WriteByte(query[i])
+			continue
+		}
+		j := i + 1
+		n := 0
+		for j < len(query) && query[j] >= '0' && query[j] <= '9' {
+			n = n*10 + int(query[j]-'0')
+			j++
+		}
+		if j == i+1 || n < 1 || n > len(args) {
+			b.WriteByte(query[i])
+			continue
+		}
+		b.WriteByte('?')
+		bound = append(bound, args[n-1])
+		i = j - 1
+	}
+	return b.String(), bound
+}
+
+func (db *DB) exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	query, args = db.rebind(query, args)
+	return db.conn.ExecContext(ctx, query, args...)
+}
+
+func (db *DB) query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	query, args = db.rebind(query, args)
+	return db.conn.QueryContext(ctx, query, args...)
+}
 
-	return stats, rows.Err()
+func (db *DB) queryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	query, args = db.rebind(query, args)
+	return db.conn.QueryRowContext(ctx, query, args...)
 }
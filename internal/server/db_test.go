@@ -0,0 +1,286 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// stubDriver connects by dialing the TCP address in the DSN. Its
+// connections fail Ping once stubRestarts has moved past the count they
+// were opened at, like connections cut by a database restart.
+type stubDriver struct{}
+
+var stubRestarts atomic.Int64
+
+type stubConn struct {
+	net.Conn
+	restarts int64
+}
+
+func (stubDriver) Open(addr string) (driver.Conn, error) {
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &stubConn{Conn: c, restarts: stubRestarts.Load()}, nil
+}
+
+func (c *stubConn) Ping(context.Context) error {
+	if c.restarts != stubRestarts.Load() {
+		return errors.New("server closed the connection unexpectedly")
+	}
+	return nil
+}
+
+func (c *stubConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c *stubConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func init() {
+	sql.Register("trix-stub", stubDriver{})
+}
+
+// fastBackoff shortens the startup backoff for the test
+func fastBackoff(t *testing.T) {
+	t.Helper()
+	backoff, maxBackoff := connectBackoff, connectMaxBackoff
+	connectBackoff, connectMaxBackoff = 10*time.Millisecond, 40*time.Millisecond
+	t.Cleanup(func() { connectBackoff, connectMaxBackoff = backoff, maxBackoff })
+}
+
+// freeAddr returns a local address nothing listens on
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	_ = l.Close()
+	return addr
+}
+
+// listenAfter starts accepting connections on addr after delay, like a
+// database starting next to trix
+func listenAfter(t *testing.T, addr string, delay time.Duration) {
+	t.Helper()
+	var (
+		mu    sync.Mutex
+		l     net.Listener
+		conns []net.Conn
+	)
+	timer := time.AfterFunc(delay, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		var err error
+		if l, err = net.Listen("tcp", addr); err != nil {
+			return
+		}
+		go func(l net.Listener) {
+			for {
+				c, err := l.Accept()
+				if err != nil {
+					return
+				}
+				mu.Lock()
+				conns = append(conns, c)
+				mu.Unlock()
+			}
+		}(l)
+	})
+	t.Cleanup(func() {
+		timer.Stop()
+		mu.Lock()
+		defer mu.Unlock()
+		if l != nil {
+			_ = l.Close()
+		}
+		for _, c := range conns {
+			_ = c.Close()
+		}
+	})
+}
+
+func stubDB(t *testing.T, addr string) *sql.DB {
+	t.Helper()
+	conn, err := sql.Open("trix-stub", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func TestWaitForDBRetries(t *testing.T) {
+	fastBackoff(t)
+	addr := freeAddr(t)
+	listenAfter(t, addr, 100*time.Millisecond)
+	logs := &syncBuffer{}
+
+	err := waitForDB(context.Background(), stubDB(t, addr), 100, 10*time.Second, slog.New(slog.NewTextHandler(logs, nil)))
+	if err != nil {
+		t.Fatalf("waitForDB = %v", err)
+	}
+	out := logs.String()
+	if !strings.Contains(out, `msg="database not reachable, retrying" attempt=1 retry_in=10ms`) ||
+		!strings.Contains(out, "retry_in=40ms") || strings.Contains(out, "retry_in=80ms") {
+		t.Errorf("retries did not back off up to the maximum:\n%s", out)
+	}
+	if !strings.Contains(out, `msg="database reachable" attempts=`) {
+		t.Errorf("logs lack the successful attempt:\n%s", out)
+	}
+}
+
+func TestWaitForDBFirstAttempt(t *testing.T) {
+	addr := freeAddr(t)
+	listenAfter(t, addr, 0)
+	logs := &syncBuffer{}
+	conn := stubDB(t, addr)
+
+	waitFor(t, "the listener", func() bool {
+		c, err := net.Dial("tcp", addr)
+		if err == nil {
+			_ = c.Close()
+		}
+		return err == nil
+	})
+	if err := waitForDB(context.Background(), conn, 1, time.Second, slog.New(slog.NewTextHandler(logs, nil))); err != nil {
+		t.Fatalf("waitForDB = %v", err)
+	}
+	if logs.String() != "" {
+		t.Errorf("logged on the first attempt:\n%s", logs.String())
+	}
+}
+
+func TestWaitForDBGivesUp(t *testing.T) {
+	fastBackoff(t)
+	conn := stubDB(t, freeAddr(t))
+
+	err := waitForDB(context.Background(), conn, 3, 10*time.Second, testLogger())
+	if err == nil || !strings.HasPrefix(err.Error(), "giving up after 3 attempts: ") || !strings.Contains(err.Error(), "connection refused") {
+		t.Errorf("attempts exhausted: err = %v", err)
+	}
+
+	// The timeout ends the retries early, reporting the last real failure
+	started := time.Now()
+	err = waitForDB(context.Background(), conn, 1000, 100*time.Millisecond, testLogger())
+	if err == nil || !strings.Contains(err.Error(), "connection refused") {
+		t.Errorf("timeout: err = %v, want the dial error", err)
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("timeout: gave up after %v", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := waitForDB(ctx, conn, 1000, 10*time.Second, testLogger()); err == nil || !strings.HasPrefix(err.Error(), "giving up after 1 attempts") {
+		t.Errorf("cancelled: err = %v", err)
+	}
+}
+
+// NewDB does not migrate a database it cannot reach
+func TestNewDBUnreachable(t *testing.T) {
+	fastBackoff(t)
+	cfg := testConfig(t, map[string]string{
+		"TRIX_DATABASE_URL":        "postgres://trix@" + freeAddr(t) + "/trix?sslmode=disable",
+		"TRIX_DB_CONNECT_ATTEMPTS": "2",
+	})
+	_, err := NewDB(context.Background(), cfg, testLogger())
+	if err == nil || !strings.HasPrefix(err.Error(), "failed to ping database: giving up after 2 attempts: ") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+// Ping replaces connections broken by a database restart
+func TestDBPingReconnects(t *testing.T) {
+	addr := freeAddr(t)
+	listenAfter(t, addr, 0)
+	logs := &syncBuffer{}
+	db := &DB{conn: stubDB(t, addr), maxIdle: 5, logger: slog.New(slog.NewTextHandler(logs, nil))}
+	ctx := context.Background()
+
+	waitFor(t, "the first ping", func() bool { return db.Ping(ctx) == nil })
+	if db.conn.Stats().Idle != 1 {
+		t.Fatalf("idle connections = %d, want the pinged one", db.conn.Stats().Idle)
+	}
+
+	stubRestarts.Add(1)
+	if err := db.Ping(ctx); err != nil {
+		t.Fatalf("Ping after a restart = %v", err)
+	}
+	if !strings.Contains(logs.String(), "reconnected to database") {
+		t.Errorf("logs:\n%s", logs.String())
+	}
+	// The broken connection was closed and the idle limit restored
+	if stats := db.conn.Stats(); stats.Idle != 1 || stats.MaxIdleClosed == 0 {
+		t.Errorf("stats = %d idle, %d closed", stats.Idle, stats.MaxIdleClosed)
+	}
+	if err := db.Ping(ctx); err != nil {
+		t.Errorf("Ping on the new connection = %v", err)
+	}
+}
+
+// A poll checks the database first and fails cleanly when it is down
+func TestPollDatabaseDown(t *testing.T) {
+	db := downStore{NewMemoryStore()}
+	s := pollingServer(t, db, fakeDynamic(
+		vulnReport("payments", "api", "sha256:aaa", fixtureVuln{"CVE-2024-0001", "CRITICAL", "openssl", "3.0.1", "3.0.8"}),
+	), nil)
+
+	s.poll(context.Background())
+	f := s.pollErr.Load()
+	if f == nil || !strings.HasPrefix(f.err, "database unreachable: ") {
+		t.Fatalf("poll error = %+v", f)
+	}
+	if s.lastPoll.Load() != nil || s.failedPolls.Load() != 1 {
+		t.Errorf("failed poll recorded as %v, %d failures", s.lastPoll.Load(), s.failedPolls.Load())
+	}
+	if _, total, _ := db.ListVulnerabilities(context.Background(), VulnerabilityFilter{}); total != 0 {
+		t.Errorf("poll stored %d vulnerabilities without a database", total)
+	}
+}
+
+func TestDBPoolConfig(t *testing.T) {
+	cfg := testConfig(t, nil)
+	if cfg.DBMaxOpenConns != 10 || cfg.DBMaxIdleConns != 5 || cfg.DBConnMaxLifetime != 30*time.Minute ||
+		cfg.DBConnectAttempts != 10 || cfg.DBConnectTimeout != 2*time.Minute {
+		t.Errorf("defaults = %d open, %d idle, %v lifetime, %d attempts in %v",
+			cfg.DBMaxOpenConns, cfg.DBMaxIdleConns, cfg.DBConnMaxLifetime, cfg.DBConnectAttempts, cfg.DBConnectTimeout)
+	}
+
+	cfg = testConfig(t, map[string]string{
+		"TRIX_DB_MAX_OPEN_CONNS":    "4",
+		"TRIX_DB_MAX_IDLE_CONNS":    "8",
+		"TRIX_DB_CONN_MAX_LIFETIME": "0",
+		"TRIX_DB_CONNECT_ATTEMPTS":  "1",
+		"TRIX_DB_CONNECT_TIMEOUT":   "10s",
+	})
+	if cfg.DBMaxOpenConns != 4 || cfg.DBMaxIdleConns != 4 || cfg.DBConnMaxLifetime != 0 ||
+		cfg.DBConnectAttempts != 1 || cfg.DBConnectTimeout != 10*time.Second {
+		t.Errorf("configured = %d open, %d idle (capped at open), %v lifetime, %d attempts in %v",
+			cfg.DBMaxOpenConns, cfg.DBMaxIdleConns, cfg.DBConnMaxLifetime, cfg.DBConnectAttempts, cfg.DBConnectTimeout)
+	}
+
+	for env, value := range map[string]string{
+		"TRIX_DB_MAX_OPEN_CONNS":    "-1",
+		"TRIX_DB_MAX_IDLE_CONNS":    "many",
+		"TRIX_DB_CONN_MAX_LIFETIME": "-1m",
+		"TRIX_DB_CONNECT_ATTEMPTS":  "0",
+		"TRIX_DB_CONNECT_TIMEOUT":   "0s",
+	} {
+		t.Run(env, func(t *testing.T) {
+			t.Setenv(env, value)
+			if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "invalid "+env) {
+				t.Errorf("%s=%s: err = %v", env, value, err)
+			}
+		})
+	}
+}
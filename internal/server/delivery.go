@@ -0,0 +1,504 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Notification channels tracked for redelivery. SaaS has its own tracking
+// through saas_synced.
+const (
+	channelSlack   = "slack"
+	channelTeams   = "teams"
+	channelEmail   = "email"
+	channelWebhook = "webhook"
+	channelGitHub  = "github"
+)
+
+const (
+	deliveryBaseBackoff = time.Minute
+	deliveryMaxBackoff  = 6 * time.Hour
+	deliveryRetention   = 30 * 24 * time.Hour // Keep finished retries this long
+)
+
+// DeliveryResult is the outcome of sending events to one channel.
+type DeliveryResult struct {
+	Channel   string
+	Delivered []VulnerabilityEvent
+	Failed    []VulnerabilityEvent
+	Err       error // Why Failed could not be delivered
+}
+
+// NotifyResult collects per-channel results of one Notify call.
+type NotifyResult struct {
+	Deliveries []DeliveryResult
+	Saas       *SaasResult
+}
+
+// Delivery is a notification that failed and is waiting to be retried, or
+// one that throttling suppressed.
+type Delivery struct {
+	ID            int64
+	Channel       string
+	Event         VulnerabilityEvent
+	Attempts      int
+	LastError     string
+	NextAttemptAt time.Time
+	DeliveredAt   *time.Time
+	Suppressed    string // Why it was never sent (see throttle.go), "" if it was
+	CreatedAt     time.Time
+}
+
+// DeliveryStats counts undelivered notifications.
+type DeliveryStats struct {
+	Pending int // Will be retried
+	Failed  int // Gave up after the maximum number of attempts
+}
+
+// deliveryBackoff returns the wait before the next attempt after attempts
+// failed ones: 1m, 2m, 4m, ... capped at 6h.
+func deliveryBackoff(attempts int) time.Duration {
+	if attempts < 1 {
+		return deliveryBaseBackoff
+	}
+	if attempts > 16 {
+		return deliveryMaxBackoff
+	}
+	return min(deliveryBaseBackoff<<(attempts-1), deliveryMaxBackoff)
+}
+
+// channels returns the configured channels tracked for redelivery.
+func (n *Notifier) channels() []string {
+	var channels []string
+	if n.config.slackEnabled() {
+		channels = append(channels, channelSlack)
+	}
+	if n.config.TeamsWebhook != "" {
+		channels = append(channels, channelTeams)
+	}
+	if n.config.SMTPHost != "" {
+		channels = append(channels, channelEmail)
+	}
+	if n.config.GenericWebhook != "" {
+		channels = append(channels, channelWebhook)
+	}
+	if n.config.GitHubRepo != "" {
+		channels = append(channels, channelGitHub)
+	}
+	return channels
+}
+
+// Deliver sends events to one channel without further filtering.
+func (n *Notifier) Deliver(ctx context.Context, channel string, events []VulnerabilityEvent) DeliveryResult {
+	ctx, span := n.startSpan(ctx, "trix.notify", channel, len(events))
+	result := n.deliver(ctx, channel, events)
+	span.SetAttributes(attribute.Int("trix.failed", len(result.Failed)))
+	endSpan(span, result.Err)
+	return result
+}
+
+func (n *Notifier) deliver(ctx context.Context, channel string, events []VulnerabilityEvent) DeliveryResult {
+	result := DeliveryResult{Channel: channel}
+
+	var err error
+	switch channel {
+	case channelSlack:
+		err = n.sendSlack(ctx, events)
+	case channelTeams:
+		err = n.sendTeams(ctx, events)
+	case channelEmail:
+		err = n.notifyEmail(ctx, events)
+	case channelWebhook:
+		// Batches are sent separately, so the ones that went through aren't retried
+		var failed []VulnerabilityEvent
+		failed, err = n.sendWebhook(ctx, events)
+		if err != nil {
+			return partialFailure(result, events, failed, err)
+		}
+	case channelGitHub:
+		// GitHub reports which issues failed, so the rest isn't retried
+		var failed []VulnerabilityEvent
+		failed, err = n.notifyGitHub(ctx, events)
+		if err != nil {
+			return partialFailure(result, events, failed, err)
+		}
+	default:
+		err = fmt.Errorf("unknown channel %q", channel)
+	}
+
+	if err != nil {
+		result.Failed = events
+		result.Err = err
+	} else {
+		result.Delivered = events
+	}
+	return result
+}
+
+// partialFailure fills in result for a send where only failed went wrong
+func partialFailure(result DeliveryResult, events, failed []VulnerabilityEvent, err error) DeliveryResult {
+	result.Failed = failed
+	result.Err = err
+	result.Delivered = excludeEvents(events, failed)
+	return result
+}
+
+// excludeEvents returns events not in drop, compared by ID and type
+func excludeEvents(events, drop []VulnerabilityEvent) []VulnerabilityEvent {
+	dropped := make(map[string]bool, len(drop))
+	for _, e := range drop {
+		dropped[e.Type+"/"+e.ID] = true
+	}
+	var kept []VulnerabilityEvent
+	for _, e := range events {
+		if !dropped[e.Type+"/"+e.ID] {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// handleDeliveries queues failed deliveries for retry.
+func (s *Server) handleDeliveries(ctx context.Context, results []DeliveryResult) {
+	for _, r := range results {
+		if len(r.Failed) == 0 {
+			continue
+		}
+		next := time.Now().Add(deliveryBackoff(1))
+		if err := s.db.QueueDeliveries(ctx, r.Channel, r.Failed, r.Err.Error(), next); err != nil {
+			s.logger.Error("failed to queue notifications for retry", "channel", r.Channel, "count", len(r.Failed), "error", err)
+			continue
+		}
+		s.logger.Warn("notifications queued for retry", "channel", r.Channel, "count", len(r.Failed), "next_attempt", next)
+	}
+}
+
+// retryDeliveries resends due notifications, one batch per channel.
+func (s *Server) retryDeliveries(ctx context.Context) {
+	due, err := s.db.DueDeliveries(ctx, time.Now(), s.config.DeliveryMaxAttempts)
+	if err != nil {
+		s.logger.Error("failed to get pending notifications", "error", err)
+		return
+	}
+	if len(due) == 0 {
+		return
+	}
+
+	byChannel := make(map[string][]Delivery)
+	var channels []string
+	for _, d := range due {
+		if _, ok := byChannel[d.Channel]; !ok {
+			channels = append(channels, d.Channel)
+		}
+		byChannel[d.Channel] = append(byChannel[d.Channel], d)
+	}
+
+	configured := make(map[string]bool)
+	for _, channel := range s.notifier.channels() {
+		configured[channel] = true
+	}
+
+	for _, channel := range channels {
+		deliveries := byChannel[channel]
+		if !configured[channel] {
+			// The channel was removed from the config; leave the rows to age out
+			continue
+		}
+
+		events := make([]VulnerabilityEvent, len(deliveries))
+		for i, d := range deliveries {
+			events[i] = d.Event
+		}
+		sortEvents(events)
+
+		s.logger.Info("retrying notifications", "channel", channel, "count", len(events))
+		result := s.notifier.Deliver(ctx, channel, events)
+
+		failed := make(map[string]bool, len(result.Failed))
+		for _, e := range result.Failed {
+			failed[e.Type+"/"+e.ID] = true
+		}
+		var delivered, retry []int64
+		var exhausted int
+		attempts := 0
+		for _, d := range deliveries {
+			if !failed[d.Event.Type+"/"+d.Event.ID] {
+				delivered = append(delivered, d.ID)
+				continue
+			}
+			retry = append(retry, d.ID)
+			attempts = max(attempts, d.Attempts+1)
+			if d.Attempts+1 >= s.config.DeliveryMaxAttempts {
+				exhausted++
+			}
+		}
+
+		if len(delivered) > 0 {
+			if err := s.db.MarkDelivered(ctx, delivered); err != nil {
+				s.logger.Error("failed to mark notifications delivered", "channel", channel, "error", err)
+			} else {
+				s.logger.Info("notifications redelivered", "channel", channel, "count", len(delivered))
+			}
+		}
+		if len(retry) > 0 {
+			next := time.Now().Add(deliveryBackoff(attempts))
+			if err := s.db.RecordDeliveryAttempt(ctx, retry, result.Err.Error(), next); err != nil {
+				s.logger.Error("failed to record notification attempt", "channel", channel, "error", err)
+			}
+			if exhausted > 0 {
+				s.logger.Error("giving up on notifications",
+					"channel", channel,
+					"count", exhausted,
+					"attempts", s.config.DeliveryMaxAttempts,
+					"error", result.Err,
+				)
+				s.telemetry.addDeliveriesAbandoned(ctx, channel, int64(exhausted))
+			}
+		}
+	}
+}
+
+// QueueDeliveries stores events a channel failed to deliver, counting the
+// failure as the first attempt.
+func (db *DB) QueueDeliveries(ctx context.Context, channel string, events []VulnerabilityEvent, lastError string, next time.Time) error {
+	return db.insertDeliveries(ctx, channel, events, Delivery{
+		Attempts:      1,
+		LastError:     lastError,
+		NextAttemptAt: next,
+		CreatedAt:     time.Now(),
+	})
+}
+
+// insertDeliveries stores a delivery like d for each event to channel. Rows
+// go in with one multi-row INSERT per mysqlBatchSize events, all in one
+// transaction, so either every event is stored or none is.
+func (db *DB) insertDeliveries(ctx context.Context, channel string, events []VulnerabilityEvent, d Delivery) error {
+	if len(events) == 0 {
+		return nil
+	}
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for start := 0; start < len(events); start += mysqlBatchSize {
+		end := min(start+mysqlBatchSize, len(events))
+		var rows []string
+		var args []interface{}
+		for _, e := range events[start:end] {
+			data, err := json.Marshal(e)
+			if err != nil {
+				return err
+			}
+			n := len(args)
+			rows = append(rows, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8, n+9))
+			args = append(args, e.ID, channel, string(data), d.Attempts, d.LastError, d.NextAttemptAt, d.DeliveredAt, d.CreatedAt, d.Suppressed)
+		}
+		query, args := db.rebind(`
+			INSERT INTO deliveries (event_id, channel, event, attempts, last_error, next_attempt_at, delivered_at, created_at, suppressed)
+			VALUES `+strings.Join(rows, ", "), args)
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DueDeliveries returns undelivered notifications whose next attempt is due
+// and that have fewer than maxAttempts attempts, oldest first.
+func (db *DB) DueDeliveries(ctx context.Context, now time.Time, maxAttempts int) ([]Delivery, error) {
+	rows, err := db.query(ctx, `
+		SELECT id, channel, event, attempts, last_error, next_attempt_at, created_at
+		FROM deliveries
+		WHERE delivered_at IS NULL AND next_attempt_at <= $1 AND attempts < $2
+		ORDER BY id
+	`, now, maxAttempts)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var deliveries []Delivery
+	for rows.Next() {
+		var d Delivery
+		var data []byte
+		if err := rows.Scan(&d.ID, &d.Channel, &data, &d.Attempts, &d.LastError, &d.NextAttemptAt, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &d.Event); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// MarkDelivered records a successful retry.
+func (db *DB) MarkDelivered(ctx context.Context, ids []int64) error {
+	now := time.Now()
+	for _, id := range ids {
+		if _, err := db.exec(ctx, "UPDATE deliveries SET delivered_at = $1 WHERE id = $2", now, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RecordDeliveryAttempt records another failed attempt.
+func (db *DB) RecordDeliveryAttempt(ctx context.Context, ids []int64, lastError string, next time.Time) error {
+	for _, id := range ids {
+		if _, err := db.exec(ctx, `
+			UPDATE deliveries SET attempts = attempts + 1, last_error = $1, next_attempt_at = $2
+			WHERE id = $3
+		`, lastError, next, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetDeliveryStats counts undelivered notifications.
+func (db *DB) GetDeliveryStats(ctx context.Context, maxAttempts int) (*DeliveryStats, error) {
+	var stats DeliveryStats
+	err := db.queryRow(ctx, `
+		SELECT COALESCE(SUM(CASE WHEN attempts < $1 THEN 1 ELSE 0 END), 0),
+		       COALESCE(SUM(CASE WHEN attempts >= $1 THEN 1 ELSE 0 END), 0)
+		FROM deliveries WHERE delivered_at IS NULL
+	`, maxAttempts).Scan(&stats.Pending, &stats.Failed)
+	if err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// PruneDeliveries deletes delivered and abandoned notifications created
+// strictly before cutoff.
+func (db *DB) PruneDeliveries(ctx context.Context, cutoff time.Time, maxAttempts int) (int64, error) {
+	res, err := db.exec(ctx, `
+		DELETE FROM deliveries
+		WHERE created_at < $1 AND (delivered_at IS NOT NULL OR attempts >= $2)
+	`, cutoff, maxAttempts)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// QueueDeliveries stores events a channel failed to deliver, counting the
+// failure as the first attempt.
+func (m *MemoryStore) QueueDeliveries(ctx context.Context, channel string, events []VulnerabilityEvent, lastError string, next time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for _, e := range events {
+		m.deliverySeq++
+		m.deliveries = append(m.deliveries, &Delivery{
+			ID:            m.deliverySeq,
+			Channel:       channel,
+			Event:         e,
+			Attempts:      1,
+			LastError:     lastError,
+			NextAttemptAt: next,
+			CreatedAt:     now,
+		})
+	}
+	return nil
+}
+
+// DueDeliveries returns undelivered notifications whose next attempt is due
+// and that have fewer than maxAttempts attempts, oldest first.
+func (m *MemoryStore) DueDeliveries(ctx context.Context, now time.Time, maxAttempts int) ([]Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var due []Delivery
+	for _, d := range m.deliveries {
+		if d.DeliveredAt == nil && !d.NextAttemptAt.After(now) && d.Attempts < maxAttempts {
+			due = append(due, *d)
+		}
+	}
+	return due, nil
+}
+
+// MarkDelivered records a successful retry.
+func (m *MemoryStore) MarkDelivered(ctx context.Context, ids []int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for _, d := range m.deliveriesByID(ids) {
+		d.DeliveredAt = &now
+	}
+	return nil
+}
+
+// RecordDeliveryAttempt records another failed attempt.
+func (m *MemoryStore) RecordDeliveryAttempt(ctx context.Context, ids []int64, lastError string, next time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, d := range m.deliveriesByID(ids) {
+		d.Attempts++
+		d.LastError = lastError
+		d.NextAttemptAt = next
+	}
+	return nil
+}
+
+// GetDeliveryStats counts undelivered notifications.
+func (m *MemoryStore) GetDeliveryStats(ctx context.Context, maxAttempts int) (*DeliveryStats, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var stats DeliveryStats
+	for _, d := range m.deliveries {
+		switch {
+		case d.DeliveredAt != nil:
+		case d.Attempts < maxAttempts:
+			stats.Pending++
+		default:
+			stats.Failed++
+		}
+	}
+	return &stats, nil
+}
+
+// PruneDeliveries deletes delivered and abandoned notifications created
+// strictly before cutoff.
+func (m *MemoryStore) PruneDeliveries(ctx context.Context, cutoff time.Time, maxAttempts int) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.deliveries[:0]
+	for _, d := range m.deliveries {
+		done := d.DeliveredAt != nil || d.Attempts >= maxAttempts
+		if !done || !d.CreatedAt.Before(cutoff) {
+			kept = append(kept, d)
+		}
+	}
+	pruned := int64(len(m.deliveries) - len(kept))
+	m.deliveries = kept
+	return pruned, nil
+}
+
+// deliveriesByID returns the deliveries with the given IDs. m.mu must be held.
+func (m *MemoryStore) deliveriesByID(ids []int64) []*Delivery {
+	want := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		want[id] = true
+	}
+	var found []*Delivery
+	for _, d := range m.deliveries {
+		if want[d.ID] {
+			found = append(found, d)
+		}
+	}
+	return found
+}
@@ -0,0 +1,263 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDeliveryBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, time.Minute},
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{5, 16 * time.Minute},
+		{9, 256 * time.Minute},
+		{10, 6 * time.Hour}, // Capped
+		{64, 6 * time.Hour}, // No overflow
+	}
+	for _, tt := range tests {
+		if got := deliveryBackoff(tt.attempts); got != tt.want {
+			t.Errorf("deliveryBackoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+// flakyReceiver fails the first failures requests with 503 and accepts
+// the rest, counting all of them
+func flakyReceiver(t *testing.T, failures int32) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+// makeDeliveriesDue moves every queued retry's next attempt into the past
+func makeDeliveriesDue(m *MemoryStore) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, d := range m.deliveries {
+		d.NextAttemptAt = time.Now().Add(-time.Second)
+	}
+}
+
+func deliveryStats(t *testing.T, s *Server) DeliveryStats {
+	t.Helper()
+	stats, err := s.db.GetDeliveryStats(context.Background(), s.config.DeliveryMaxAttempts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *stats
+}
+
+// A channel that fails twice is retried with backoff until it succeeds
+func TestRetryFailsTwiceThenSucceeds(t *testing.T) {
+	ctx := context.Background()
+	receiver, calls := flakyReceiver(t, 2)
+	store := NewMemoryStore()
+	s := pollingServer(t, store, fakeDynamic(), map[string]string{"TRIX_NOTIFY_WEBHOOK": receiver.URL})
+
+	s.notify(ctx, testEvents())
+	if got := deliveryStats(t, s); got.Pending != 1 {
+		t.Fatalf("stats after the failed send = %+v, want 1 pending", got)
+	}
+	due, err := store.DueDeliveries(ctx, time.Now(), s.config.DeliveryMaxAttempts)
+	if err != nil || len(due) != 0 {
+		t.Errorf("retry due right away: %v, %v", due, err)
+	}
+	due, err = store.DueDeliveries(ctx, time.Now().Add(deliveryBackoff(1)), s.config.DeliveryMaxAttempts)
+	if err != nil || len(due) != 1 || due[0].Attempts != 1 || due[0].Channel != channelWebhook || !strings.Contains(due[0].LastError, "503") {
+		t.Fatalf("due after the backoff = %+v, %v", due, err)
+	}
+
+	// Second failure: the next attempt backs off further
+	makeDeliveriesDue(store)
+	s.retryDeliveries(ctx)
+	due, _ = store.DueDeliveries(ctx, time.Now().Add(deliveryBackoff(1)), s.config.DeliveryMaxAttempts)
+	if len(due) != 0 {
+		t.Error("second retry due after the first backoff")
+	}
+	due, _ = store.DueDeliveries(ctx, time.Now().Add(deliveryBackoff(2)), s.config.DeliveryMaxAttempts)
+	if len(due) != 1 || due[0].Attempts != 2 {
+		t.Fatalf("due after the second failure = %+v", due)
+	}
+
+	makeDeliveriesDue(store)
+	s.retryDeliveries(ctx)
+	if n := calls.Load(); n != 3 {
+		t.Errorf("%d webhook requests, want 3", n)
+	}
+	if got := deliveryStats(t, s); got.Pending != 0 || got.Failed != 0 {
+		t.Errorf("stats after redelivery = %+v", got)
+	}
+
+	// Delivered notifications are not sent again
+	makeDeliveriesDue(store)
+	s.retryDeliveries(ctx)
+	if n := calls.Load(); n != 3 {
+		t.Errorf("%d webhook requests after redelivery, want 3", n)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	ctx := context.Background()
+	receiver, calls := flakyReceiver(t, 100)
+	store := NewMemoryStore()
+	s := pollingServer(t, store, fakeDynamic(), map[string]string{
+		"TRIX_NOTIFY_WEBHOOK":        receiver.URL,
+		"TRIX_DELIVERY_MAX_ATTEMPTS": "3",
+	})
+	var logs strings.Builder
+	s.logger = slog.New(slog.NewTextHandler(&logs, nil))
+	tel, reader := meteredTelemetry(t)
+	s.telemetry = tel
+
+	s.notify(ctx, testEvents())
+	for i := 0; i < 4; i++ {
+		makeDeliveriesDue(store)
+		s.retryDeliveries(ctx)
+	}
+
+	if n := calls.Load(); n != 3 {
+		t.Errorf("%d attempts, want 3", n)
+	}
+	if got := deliveryStats(t, s); got.Pending != 0 || got.Failed != 1 {
+		t.Errorf("stats = %+v, want 1 failed", got)
+	}
+	if !strings.Contains(logs.String(), `msg="giving up on notifications" channel=webhook count=1 attempts=3`) {
+		t.Errorf("give-up not logged:\n%s", logs.String())
+	}
+	if n := counterValue(t, reader, "trix.deliveries.abandoned"); n != 1 {
+		t.Errorf("trix.deliveries.abandoned = %d, want 1", n)
+	}
+	if h := s.healthStatus(ctx, "ok"); h.DeliveriesPending != 0 {
+		t.Errorf("health reports %d pending", h.DeliveriesPending)
+	}
+}
+
+// Retries for a channel that was removed from the config are left alone
+func TestRetryUnconfiguredChannel(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	if err := store.QueueDeliveries(ctx, channelTeams, testEvents(), "status 500", time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	s := pollingServer(t, store, fakeDynamic(), nil)
+	s.retryDeliveries(ctx)
+
+	due, err := store.DueDeliveries(ctx, time.Now(), s.config.DeliveryMaxAttempts)
+	if err != nil || len(due) != 1 || due[0].Attempts != 1 {
+		t.Errorf("due = %+v, %v, want the teams retry untouched", due, err)
+	}
+}
+
+// Batches larger than one INSERT are stored whole
+func testDeliveryBatches(t *testing.T, s Store) {
+	ctx := context.Background()
+	now := time.Now()
+	var workloads []string
+	for i := 0; i < mysqlBatchSize+1; i++ {
+		workloads = append(workloads, fmt.Sprintf("prod/deployment/w%d", i))
+	}
+	events := criticalEvents(workloads...)
+	if err := s.QueueDeliveries(ctx, channelSlack, events, "status 503", now.Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RecordSuppressed(ctx, channelTeams, events, suppressedOverflow); err != nil {
+		t.Fatal(err)
+	}
+
+	due, err := s.DueDeliveries(ctx, now, 3)
+	if err != nil || len(due) != len(events) {
+		t.Fatalf("%d due, %v; want %d", len(due), err, len(events))
+	}
+	last := due[len(due)-1]
+	if last.Channel != channelSlack || last.Attempts != 1 || last.Event.Workload != workloads[mysqlBatchSize] {
+		t.Errorf("last queued delivery = %+v", last)
+	}
+	if stats, err := s.GetDeliveryStats(ctx, 3); err != nil || stats.Pending != len(events) || stats.Failed != 0 {
+		t.Errorf("stats = %+v, %v; the suppressed events should count as delivered", stats, err)
+	}
+}
+
+func testDeliveries(t *testing.T, s Store) {
+	ctx := context.Background()
+	now := time.Now()
+	events := testEvents()
+	events = append(events, VulnerabilityEvent{ID: "v2", Type: "FIXED", CVE: "CVE-2024-0002", Workload: "team-a/deployment/api", Severity: "HIGH"})
+	if err := s.QueueDeliveries(ctx, channelSlack, events, "status 500", now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.QueueDeliveries(ctx, channelWebhook, events[:1], "timeout", now.Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	due, err := s.DueDeliveries(ctx, now, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 1 || due[0].Channel != channelWebhook || due[0].Attempts != 1 || due[0].LastError != "timeout" {
+		t.Fatalf("due now = %+v", due)
+	}
+	e := due[0].Event
+	if e.ID != "v1" || e.Type != "NEW" || e.CVE != "CVE-2024-0001" || e.Severity != "CRITICAL" || !e.FirstSeen.Equal(events[0].FirstSeen) {
+		t.Errorf("queued event round trip = %+v", e)
+	}
+
+	later, err := s.DueDeliveries(ctx, now.Add(2*time.Minute), 3)
+	if err != nil || len(later) != 3 {
+		t.Fatalf("due later = %d, %v", len(later), err)
+	}
+	var slack []int64
+	for _, d := range later {
+		if d.Channel == channelSlack {
+			slack = append(slack, d.ID)
+		}
+	}
+
+	if err := s.MarkDelivered(ctx, []int64{due[0].ID}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RecordDeliveryAttempt(ctx, slack, "status 502", now.Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RecordDeliveryAttempt(ctx, slack[:1], "status 503", now.Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	due, err = s.DueDeliveries(ctx, now, 3)
+	if err != nil || len(due) != 1 || due[0].Attempts != 2 || due[0].LastError != "status 502" {
+		t.Errorf("due after attempts = %+v, %v, want the slack retry with 2 attempts", due, err)
+	}
+
+	stats, err := s.GetDeliveryStats(ctx, 3)
+	if err != nil || stats.Pending != 1 || stats.Failed != 1 {
+		t.Errorf("stats = %+v, %v, want 1 pending and 1 failed", stats, err)
+	}
+
+	// Delivered and abandoned rows are pruned, pending ones kept
+	if n, err := s.PruneDeliveries(ctx, now.Add(-time.Hour), 3); err != nil || n != 0 {
+		t.Errorf("PruneDeliveries(an hour ago) = %d, %v", n, err)
+	}
+	if n, err := s.PruneDeliveries(ctx, now.Add(time.Hour), 3); err != nil || n != 2 {
+		t.Errorf("PruneDeliveries = %d, %v, want 2", n, err)
+	}
+	if stats, _ := s.GetDeliveryStats(ctx, 3); stats.Pending != 1 || stats.Failed != 0 {
+		t.Errorf("stats after pruning = %+v", stats)
+	}
+}
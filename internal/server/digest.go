@@ -0,0 +1,430 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+	"time"
+)
+
+// digestTopWorkloads is how many workloads a digest lists
+const digestTopWorkloads = 5
+
+// digestQueue is the digest_events channel holding events below a
+// notification channel's minimum severity. The email digest of
+// TRIX_EMAIL_DIGEST uses its own queue (emailDigestChannel).
+func digestQueue(channel string) string {
+	return "digest:" + channel
+}
+
+// DigestRun records what a digest reported, for the trend in the next one.
+type DigestRun struct {
+	SentAt time.Time `json:"sentAt"`
+	New    int       `json:"new"`
+	Fixed  int       `json:"fixed"`
+}
+
+// WorkloadCount is a workload and its number of new vulnerabilities.
+type WorkloadCount struct {
+	Workload string `json:"workload"`
+	Count    int    `json:"count"`
+}
+
+// DigestReport is the content of one digest message.
+type DigestReport struct {
+	New          map[string]int  `json:"new"` // New vulnerabilities by severity
+	NewTotal     int             `json:"newTotal"`
+	Fixed        int             `json:"fixed"`
+	TopWorkloads []WorkloadCount `json:"topWorkloads"` // Most new vulnerabilities first
+	Previous     *DigestRun      `json:"previous,omitempty"`
+}
+
+// digestChannels returns the channels that receive digests. GitHub files
+// issues per vulnerability and has no digest.
+func (n *Notifier) digestChannels() []string {
+	var channels []string
+	for _, channel := range n.channels() {
+		if channel != channelGitHub {
+			channels = append(channels, channel)
+		}
+	}
+	return channels
+}
+
+// queueDigest stores events below each digest channel's threshold for its
+// next digest. Digests count new and fixed vulnerabilities only, so
+// SEVERITY_CHANGED and IMAGE_CHANGED events are not queued.
+func (n *Notifier) queueDigest(ctx context.Context, events []VulnerabilityEvent) {
+	for _, channel := range n.digestChannels() {
+		minSeverity := n.config.channelSeverity(channel)
+		if minSeverity == "" {
+			continue
+		}
+		minLevel := severityLevel(minSeverity)
+		var below []VulnerabilityEvent
+		for _, e := range events {
+			if (e.Type == "NEW" || e.Type == "FIXED") && severityLevel(e.Severity) > minLevel {
+				below = append(below, e)
+			}
+		}
+		if len(below) == 0 {
+			continue
+		}
+		if err := n.store.QueueDigest(ctx, digestQueue(channel), below); err != nil {
+			n.logger.Error("failed to queue digest events", "channel", channel, "error", err)
+			continue
+		}
+		n.logger.Debug("queued events for digest", "channel", channel, "count", len(below))
+	}
+}
+
+// buildDigestReport summarizes queued events and compares them with the
+// previous digest, if any.
+func buildDigestReport(events []VulnerabilityEvent, previous *DigestRun) DigestReport {
+	newEvents := filterByType(events, "NEW")
+	report := DigestReport{
+		New:      countBySeverity(newEvents),
+		NewTotal: len(newEvents),
+		Fixed:    countByType(events, "FIXED"),
+		Previous: previous,
+	}
+
+	for workload, group := range groupByWorkload(newEvents) {
+		report.TopWorkloads = append(report.TopWorkloads, WorkloadCount{Workload: workload, Count: len(group)})
+	}
+	sort.Slice(report.TopWorkloads, func(i, j int) bool {
+		a, b := report.TopWorkloads[i], report.TopWorkloads[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Workload < b.Workload
+	})
+	if len(report.TopWorkloads) > digestTopWorkloads {
+		report.TopWorkloads = report.TopWorkloads[:digestTopWorkloads]
+	}
+	return report
+}
+
+// trend renders the change from the previous digest, e.g. "+4"
+func trend(current, previous int) string {
+	return fmt.Sprintf("%+d", current-previous)
+}
+
+// headline is the one-line summary of a digest
+func (r DigestReport) headline() string {
+	s := fmt.Sprintf("%d new", r.NewTotal)
+	if r.NewTotal > 0 {
+		s += " (" + severitySummary(r.New) + ")"
+	}
+	return s + fmt.Sprintf(", %d fixed", r.Fixed)
+}
+
+// trendLine compares the digest with the previous one, or "" for the first
+func (r DigestReport) trendLine() string {
+	if r.Previous == nil {
+		return ""
+	}
+	return fmt.Sprintf("vs previous digest (%s): %s new, %s fixed",
+		r.Previous.SentAt.Format("2006-01-02 15:04 MST"), trend(r.NewTotal, r.Previous.New), trend(r.Fixed, r.Previous.Fixed))
+}
+
+// SendDigests sends one digest per channel with the events queued below its
+// minimum severity since the last one. A channel's events stay queued
+// if sending fails and go out with its next digest.
+func (n *Notifier) SendDigests(ctx context.Context) error {
+	var errs []error
+	for _, channel := range n.digestChannels() {
+		err := n.traceSend(ctx, "trix.digest", channel, 0, func(ctx context.Context) error {
+			return n.sendDigest(ctx, channel)
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", channel, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (n *Notifier) sendDigest(ctx context.Context, channel string) error {
+	queue := digestQueue(channel)
+	events, lastID, err := n.store.PendingDigest(ctx, queue)
+	if err != nil {
+		return fmt.Errorf("load digest: %w", err)
+	}
+	if len(events) == 0 {
+		n.logger.Debug("digest skipped, nothing queued", "channel", channel)
+		return nil
+	}
+
+	previous, err := n.store.GetDigestRun(ctx, channel)
+	if err != nil {
+		n.logger.Warn("failed to load previous digest", "channel", channel, "error", err)
+	} else if previous != nil {
+		previous.SentAt = previous.SentAt.In(n.config.Location)
+	}
+	report := buildDigestReport(events, previous)
+
+	switch channel {
+	case channelSlack:
+		err = n.sendSlackDigest(ctx, report)
+	case channelTeams:
+		err = n.postJSON(ctx, n.config.TeamsWebhook, teamsDigestPayload(report))
+	case channelEmail:
+		text, htmlBody := emailDigestBody(report)
+		err = n.sendEmail(ctx, n.emailSubject("Digest: "+report.headline()), text, htmlBody)
+	case channelWebhook:
+		err = n.postWebhook(ctx, map[string]interface{}{
+			"timestamp": time.Now().UTC().Format(time.RFC3339),
+			"digest":    report,
+		})
+	default:
+		err = fmt.Errorf("unknown channel %q", channel)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := n.store.ClearDigest(ctx, queue, lastID); err != nil {
+		return fmt.Errorf("clear digest: %w", err)
+	}
+	run := &DigestRun{SentAt: time.Now(), New: report.NewTotal, Fixed: report.Fixed}
+	if err := n.store.SetDigestRun(ctx, channel, run); err != nil {
+		n.logger.Warn("failed to record digest", "channel", channel, "error", err)
+	}
+	n.logger.Info("digest sent", "channel", channel, "events", len(events))
+	return nil
+}
+
+func (n *Notifier) sendSlackDigest(ctx context.Context, r DigestReport) error {
+	var fields []map[string]interface{}
+	for _, s := range []string{"CRITICAL", "HIGH", "MEDIUM", "LOW"} {
+		if c := r.New[s]; c > 0 {
+			fields = append(fields, slackText(fmt.Sprintf("%s *%s*\n%d new", slackSeverityEmoji[s], strings.ToLower(s), c)))
+		}
+	}
+
+	blocks := []map[string]interface{}{
+		slackHeader(":newspaper: Vulnerability digest"),
+		{"type": "section", "text": slackText(fmt.Sprintf("*%d* new, *%d* fixed", r.NewTotal, r.Fixed))},
+	}
+	if len(fields) > 0 {
+		blocks = append(blocks, map[string]interface{}{"type": "section", "fields": fields})
+	}
+	if len(r.TopWorkloads) > 0 {
+		lines := []string{"*Top affected workloads*"}
+		for _, w := range r.TopWorkloads {
+			lines = append(lines, fmt.Sprintf("`%s`: %d new", w.Workload, w.Count))
+		}
+		blocks = append(blocks, map[string]interface{}{"type": "section", "text": slackText(strings.Join(lines, "\n"))})
+	}
+	if t := r.trendLine(); t != "" {
+		blocks = append(blocks, slackContext(t))
+	}
+
+	_, err := n.postSlack(ctx, "", "trix digest: "+r.headline(), n.slackFooter(blocks))
+	return err
+}
+
+// teamsDigestPayload builds the digest card
+func teamsDigestPayload(r DigestReport) map[string]interface{} {
+	lines := []string{r.headline()}
+	for _, w := range r.TopWorkloads {
+		lines = append(lines, fmt.Sprintf("**%s**: %d new", w.Workload, w.Count))
+	}
+	body := []map[string]interface{}{
+		teamsSection(teamsSeverityStyle(r.New), "Vulnerability digest", lines),
+	}
+	if t := r.trendLine(); t != "" {
+		body = append(body, map[string]interface{}{
+			"type": "TextBlock", "text": t, "isSubtle": true, "size": "Small", "wrap": true,
+		})
+	}
+	return teamsMessage(body)
+}
+
+// emailDigestBody renders severity counts, top workloads and the trend
+func emailDigestBody(r DigestReport) (text, htmlBody string) {
+	var t, h strings.Builder
+	fmt.Fprintf(&t, "Vulnerability digest\n\n%s\n\n", r.headline())
+	fmt.Fprintf(&h, "<h2>Vulnerability digest</h2>\n<p>%s</p>\n<table>\n", html.EscapeString(r.headline()))
+	for _, s := range []string{"CRITICAL", "HIGH", "MEDIUM", "LOW"} {
+		if c := r.New[s]; c > 0 {
+			fmt.Fprintf(&t, "  %-9s %d new\n", s, c)
+			fmt.Fprintf(&h, "<tr><td style=\"color:%s;font-weight:bold\">%s</td><td>%d new</td></tr>\n", emailSeverityColor(s), s, c)
+		}
+	}
+	h.WriteString("</table>\n")
+
+	if len(r.TopWorkloads) > 0 {
+		t.WriteString("\nTop affected workloads\n")
+		h.WriteString("<h3>Top affected workloads</h3>\n<ul>\n")
+		for _, w := range r.TopWorkloads {
+			fmt.Fprintf(&t, "  %s: %d new\n", w.Workload, w.Count)
+			fmt.Fprintf(&h, "<li><code>%s</code>: %d new</li>\n", html.EscapeString(w.Workload), w.Count)
+		}
+		h.WriteString("</ul>\n")
+	}
+	if line := r.trendLine(); line != "" {
+		fmt.Fprintf(&t, "\n%s\n", line)
+		fmt.Fprintf(&h, "<p><small>%s</small></p>\n", html.EscapeString(line))
+	}
+	return t.String(), emailHTML(h.String())
+}
+
+// GetDigestRun returns the last digest sent on channel, or nil.
+func (db *DB) GetDigestRun(ctx context.Context, channel string) (*DigestRun, error) {
+	var run DigestRun
+	err := db.queryRow(ctx,
+		"SELECT sent_at, new_count, fixed_count FROM digest_runs WHERE channel = $1",
+		channel,
+	).Scan(&run.SentAt, &run.New, &run.Fixed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// SetDigestRun records the digest just sent on channel.
+func (db *DB) SetDigestRun(ctx context.Context, channel string, run *DigestRun) error {
+	upsert := `
+		INSERT INTO digest_runs (channel, sent_at, new_count, fixed_count) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (channel) DO UPDATE SET sent_at = EXCLUDED.sent_at, new_count = EXCLUDED.new_count, fixed_count = EXCLUDED.fixed_count`
+	if db.dialect == dialectMySQL {
+		upsert = `
+		INSERT INTO digest_runs (channel, sent_at, new_count, fixed_count) VALUES ($1, $2, $3, $4)
+		ON DUPLICATE KEY UPDATE sent_at = VALUES(sent_at), new_count = VALUES(new_count), fixed_count = VALUES(fixed_count)`
+	}
+	_, err := db.exec(ctx, upsert, channel, run.SentAt, run.New, run.Fixed)
+	return err
+}
+
+// QueueDigest stores events for the next digest on channel.
+func (db *DB) QueueDigest(ctx context.Context, channel string, events []VulnerabilityEvent) error {
+	now := time.Now()
+	for _, e := range events {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if _, err := db.exec(ctx,
+			"INSERT INTO digest_events (channel, event, queued_at) VALUES ($1, $2, $3)",
+			channel, string(data), now,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PendingDigest returns the events queued for channel, oldest first, and the
+// id of the last one to pass to ClearDigest once they have been sent.
+func (db *DB) PendingDigest(ctx context.Context, channel string) ([]VulnerabilityEvent, int64, error) {
+	rows, err := db.query(ctx,
+		"SELECT id, event FROM digest_events WHERE channel = $1 ORDER BY id",
+		channel,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var events []VulnerabilityEvent
+	var lastID int64
+	for rows.Next() {
+		var data []byte
+		var e VulnerabilityEvent
+		if err := rows.Scan(&lastID, &data); err != nil {
+			return nil, 0, err
+		}
+		if err := json.Unmarshal(data, &e); err != nil {
+			return nil, 0, err
+		}
+		events = append(events, e)
+	}
+	return events, lastID, rows.Err()
+}
+
+// ClearDigest deletes the events queued for channel up to and including lastID.
+func (db *DB) ClearDigest(ctx context.Context, channel string, lastID int64) error {
+	_, err := db.exec(ctx, "DELETE FROM digest_events WHERE channel = $1 AND id <= $2", channel, lastID)
+	return err
+}
+
+// memoryDigestEvent is a queued digest event in the MemoryStore
+type memoryDigestEvent struct {
+	id      int64
+	channel string
+	event   VulnerabilityEvent
+}
+
+// QueueDigest stores events for the next digest on channel.
+func (m *MemoryStore) QueueDigest(ctx context.Context, channel string, events []VulnerabilityEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, e := range events {
+		m.digestSeq++
+		m.digest = append(m.digest, memoryDigestEvent{id: m.digestSeq, channel: channel, event: e})
+	}
+	return nil
+}
+
+// PendingDigest returns the events queued for channel, oldest first, and the
+// id of the last one to pass to ClearDigest once they have been sent.
+func (m *MemoryStore) PendingDigest(ctx context.Context, channel string) ([]VulnerabilityEvent, int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var events []VulnerabilityEvent
+	var lastID int64
+	for _, d := range m.digest {
+		if d.channel == channel {
+			events = append(events, d.event)
+			lastID = d.id
+		}
+	}
+	return events, lastID, nil
+}
+
+// ClearDigest deletes the events queued for channel up to and including lastID.
+func (m *MemoryStore) ClearDigest(ctx context.Context, channel string, lastID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.digest[:0]
+	for _, d := range m.digest {
+		if d.channel != channel || d.id > lastID {
+			kept = append(kept, d)
+		}
+	}
+	m.digest = kept
+	return nil
+}
+
+// GetDigestRun returns the last digest sent on channel, or nil.
+func (m *MemoryStore) GetDigestRun(ctx context.Context, channel string) (*DigestRun, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	run, ok := m.digestRuns[channel]
+	if !ok {
+		return nil, nil
+	}
+	return &run, nil
+}
+
+// SetDigestRun records the digest just sent on channel.
+func (m *MemoryStore) SetDigestRun(ctx context.Context, channel string, run *DigestRun) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.digestRuns[channel] = *run
+	return nil
+}
@@ -0,0 +1,261 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func digestEvent(id, typ, workload, severity string) VulnerabilityEvent {
+	return VulnerabilityEvent{
+		ID: id, Type: typ, Kind: KindVulnerability, CVE: "CVE-2024-" + id,
+		Workload: workload, Severity: severity, Image: "openssl:3.0.1",
+	}
+}
+
+func TestBuildDigestReport(t *testing.T) {
+	var events []VulnerabilityEvent
+	for i := 0; i < 7; i++ {
+		// w0 gets 7 new vulnerabilities, w1 6, ... w6 1
+		for j := 0; j <= i; j++ {
+			events = append(events, digestEvent(fmt.Sprintf("%d-%d", i, j), "NEW", fmt.Sprintf("ns/deployment/w%d", 6-i), "MEDIUM"))
+		}
+	}
+	events = append(events,
+		digestEvent("low", "NEW", "ns/deployment/w6", "LOW"),
+		digestEvent("f1", "FIXED", "ns/deployment/w0", "LOW"),
+		digestEvent("f2", "FIXED", "ns/deployment/w9", "MEDIUM"),
+	)
+
+	previous := &DigestRun{SentAt: time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC), New: 40, Fixed: 0}
+	r := buildDigestReport(events, previous)
+	if r.NewTotal != 29 || r.Fixed != 2 || !reflect.DeepEqual(r.New, map[string]int{"MEDIUM": 28, "LOW": 1}) {
+		t.Errorf("report = %d new %v, %d fixed", r.NewTotal, r.New, r.Fixed)
+	}
+	want := []WorkloadCount{
+		{"ns/deployment/w0", 7}, {"ns/deployment/w1", 6}, {"ns/deployment/w2", 5},
+		{"ns/deployment/w3", 4}, {"ns/deployment/w4", 3},
+	}
+	if !reflect.DeepEqual(r.TopWorkloads, want) {
+		t.Errorf("top workloads = %v", r.TopWorkloads)
+	}
+	if got := r.headline(); got != "29 new (28 medium, 1 low), 2 fixed" {
+		t.Errorf("headline = %q", got)
+	}
+	if got := r.trendLine(); got != "vs previous digest (2024-05-01 08:00 UTC): -11 new, +2 fixed" {
+		t.Errorf("trend = %q", got)
+	}
+
+	// Equal counts are ordered by workload; the first digest has no trend
+	r = buildDigestReport([]VulnerabilityEvent{
+		digestEvent("1", "NEW", "b", "LOW"), digestEvent("2", "NEW", "a", "LOW"),
+	}, nil)
+	if !reflect.DeepEqual(r.TopWorkloads, []WorkloadCount{{"a", 1}, {"b", 1}}) || r.trendLine() != "" {
+		t.Errorf("first digest = %+v, trend %q", r.TopWorkloads, r.trendLine())
+	}
+}
+
+// webhookDigest decodes the digest of a webhook request, or nil for a
+// normal notification
+func webhookDigest(t *testing.T, body []byte) *DigestReport {
+	t.Helper()
+	var payload struct {
+		Digest *DigestReport `json:"digest"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	return payload.Digest
+}
+
+// Events below the threshold accumulate over polls and restarts and go
+// out together with the next digest; CRITICAL ones are sent right away.
+func TestDigestAccumulates(t *testing.T) {
+	ctx := context.Background()
+	receiver, received := stubReceiver(t, http.StatusOK)
+	env := map[string]string{"TRIX_NOTIFY_WEBHOOK": receiver.URL, "TRIX_DIGEST_SCHEDULE": "daily@08:00"}
+	store := NewMemoryStore()
+	n := NewNotifier(testConfig(t, env), store, testLogger())
+
+	n.Notify(ctx, []VulnerabilityEvent{
+		digestEvent("c1", "NEW", "prod/deployment/api", "CRITICAL"),
+		digestEvent("h1", "NEW", "prod/deployment/api", "HIGH"),
+		digestEvent("s1", "SEVERITY_CHANGED", "prod/deployment/api", "HIGH"), // Not counted in digests
+	})
+	reqs := received()
+	if len(reqs) != 1 || webhookDigest(t, reqs[0].body) != nil || !strings.Contains(string(reqs[0].body), "CVE-2024-c1") ||
+		strings.Contains(string(reqs[0].body), "CVE-2024-h1") {
+		t.Fatalf("immediate notifications = %d", len(reqs))
+	}
+
+	// A restart keeps the queue
+	n = NewNotifier(testConfig(t, env), store, testLogger())
+	n.Notify(ctx, []VulnerabilityEvent{
+		digestEvent("m1", "NEW", "prod/deployment/web", "MEDIUM"),
+		digestEvent("l1", "NEW", "prod/deployment/api", "LOW"),
+		digestEvent("f1", "FIXED", "prod/deployment/db", "MEDIUM"),
+	})
+	if len(received()) != 1 {
+		t.Fatal("events below the threshold sent right away")
+	}
+	if pending, _, _ := store.PendingDigest(ctx, digestQueue(channelWebhook)); len(pending) != 4 {
+		t.Fatalf("%d events queued, want 4", len(pending))
+	}
+
+	if err := n.SendDigests(ctx); err != nil {
+		t.Fatal(err)
+	}
+	reqs = received()
+	if len(reqs) != 2 {
+		t.Fatalf("%d requests after the digest, want 2", len(reqs))
+	}
+	digest := webhookDigest(t, reqs[1].body)
+	if digest == nil || digest.NewTotal != 3 || digest.Fixed != 1 || digest.Previous != nil ||
+		!reflect.DeepEqual(digest.New, map[string]int{"HIGH": 1, "MEDIUM": 1, "LOW": 1}) ||
+		!reflect.DeepEqual(digest.TopWorkloads, []WorkloadCount{{"prod/deployment/api", 2}, {"prod/deployment/web", 1}}) {
+		t.Fatalf("digest = %+v", digest)
+	}
+
+	// Nothing queued: no digest
+	if err := n.SendDigests(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(received()) != 2 {
+		t.Error("empty digest sent")
+	}
+
+	// The next digest compares with this one
+	n.Notify(ctx, []VulnerabilityEvent{digestEvent("h2", "NEW", "prod/deployment/api", "HIGH")})
+	if err := n.SendDigests(ctx); err != nil {
+		t.Fatal(err)
+	}
+	reqs = received()
+	if len(reqs) != 3 {
+		t.Fatalf("%d requests, want 3", len(reqs))
+	}
+	if digest := webhookDigest(t, reqs[2].body); digest == nil || digest.Previous == nil ||
+		digest.Previous.New != 3 || digest.Previous.Fixed != 1 || digest.trendLine() == "" {
+		t.Errorf("second digest = %+v", digest)
+	}
+}
+
+func TestDigestKeptOnFailure(t *testing.T) {
+	ctx := context.Background()
+	receiver, received := stubReceiver(t, http.StatusBadGateway)
+	store := NewMemoryStore()
+	n := NewNotifier(testConfig(t, map[string]string{
+		"TRIX_NOTIFY_WEBHOOK": receiver.URL, "TRIX_DIGEST_SCHEDULE": "daily@08:00",
+	}), store, testLogger())
+
+	n.Notify(ctx, []VulnerabilityEvent{digestEvent("h1", "NEW", "prod/deployment/api", "HIGH")})
+	if err := n.SendDigests(ctx); err == nil || !strings.Contains(err.Error(), "webhook:") {
+		t.Fatalf("SendDigests err = %v", err)
+	}
+	if len(received()) != 1 {
+		t.Fatal("digest not attempted")
+	}
+	if pending, _, _ := store.PendingDigest(ctx, digestQueue(channelWebhook)); len(pending) != 1 {
+		t.Errorf("%d events queued after a failed digest, want 1", len(pending))
+	}
+	if run, _ := store.GetDigestRun(ctx, channelWebhook); run != nil {
+		t.Errorf("failed digest recorded: %+v", run)
+	}
+}
+
+// Without TRIX_DIGEST_SCHEDULE events below the threshold are dropped
+func TestDigestDisabled(t *testing.T) {
+	ctx := context.Background()
+	receiver, _ := stubReceiver(t, http.StatusOK)
+	store := NewMemoryStore()
+	n := NewNotifier(testConfig(t, map[string]string{"TRIX_NOTIFY_WEBHOOK": receiver.URL}), store, testLogger())
+
+	n.Notify(ctx, []VulnerabilityEvent{digestEvent("h1", "NEW", "prod/deployment/api", "HIGH")})
+	if pending, _, _ := store.PendingDigest(ctx, digestQueue(channelWebhook)); len(pending) != 0 {
+		t.Errorf("%d events queued without a digest schedule", len(pending))
+	}
+}
+
+func TestDigestPayloads(t *testing.T) {
+	r := buildDigestReport([]VulnerabilityEvent{
+		digestEvent("1", "NEW", "prod/deployment/api", "HIGH"),
+		digestEvent("2", "NEW", "prod/deployment/api", "MEDIUM"),
+		digestEvent("3", "FIXED", "prod/deployment/db", "LOW"),
+	}, &DigestRun{SentAt: time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC), New: 1, Fixed: 1})
+
+	text, htmlBody := emailDigestBody(r)
+	for _, want := range []string{
+		"2 new (1 high, 1 medium), 1 fixed",
+		"  HIGH      1 new\n",
+		"  prod/deployment/api: 2 new\n",
+		"vs previous digest (2024-05-01 08:00 UTC): +1 new, +0 fixed",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("email text lacks %q:\n%s", want, text)
+		}
+	}
+	if !strings.Contains(htmlBody, "<li><code>prod/deployment/api</code>: 2 new</li>") {
+		t.Errorf("email HTML:\n%s", htmlBody)
+	}
+
+	card, err := json.Marshal(teamsDigestPayload(r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Vulnerability digest", "**prod/deployment/api**: 2 new", "+1 new, +0 fixed"} {
+		if !strings.Contains(string(card), want) {
+			t.Errorf("Teams card lacks %q:\n%s", want, card)
+		}
+	}
+}
+
+func testDigestQueue(t *testing.T, s Store) {
+	ctx := context.Background()
+	queue := digestQueue(channelSlack)
+	if err := s.QueueDigest(ctx, queue, []VulnerabilityEvent{digestEvent("1", "NEW", "a", "LOW"), digestEvent("2", "FIXED", "b", "LOW")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.QueueDigest(ctx, digestQueue(channelTeams), []VulnerabilityEvent{digestEvent("3", "NEW", "a", "LOW")}); err != nil {
+		t.Fatal(err)
+	}
+
+	events, lastID, err := s.PendingDigest(ctx, queue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].ID != "1" || events[1].ID != "2" || events[1].Type != "FIXED" {
+		t.Fatalf("pending = %+v", events)
+	}
+
+	// Events queued while the digest was being sent go out with the next one
+	if err := s.QueueDigest(ctx, queue, []VulnerabilityEvent{digestEvent("4", "NEW", "c", "MEDIUM")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ClearDigest(ctx, queue, lastID); err != nil {
+		t.Fatal(err)
+	}
+	if events, _, err := s.PendingDigest(ctx, queue); err != nil || len(events) != 1 || events[0].ID != "4" {
+		t.Errorf("pending after clearing = %+v, %v", events, err)
+	}
+	if events, _, _ := s.PendingDigest(ctx, digestQueue(channelTeams)); len(events) != 1 {
+		t.Errorf("clearing one queue touched another: %+v", events)
+	}
+
+	if run, err := s.GetDigestRun(ctx, channelSlack); err != nil || run != nil {
+		t.Errorf("GetDigestRun before any digest = %+v, %v", run, err)
+	}
+	sent := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	for _, run := range []*DigestRun{{SentAt: sent.Add(-24 * time.Hour), New: 1}, {SentAt: sent, New: 5, Fixed: 2}} {
+		if err := s.SetDigestRun(ctx, channelSlack, run); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run, err := s.GetDigestRun(ctx, channelSlack)
+	if err != nil || run == nil || !run.SentAt.Equal(sent) || run.New != 5 || run.Fixed != 2 {
+		t.Errorf("GetDigestRun = %+v, %v", run, err)
+	}
+}
@@ -0,0 +1,377 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"html"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// emailDigestChannel is the digest_events channel used for email digests
+const emailDigestChannel = "email"
+
+// Colors for severities in HTML emails, matching the Slack accents
+var emailSeverityColors = map[string]string{
+	"CRITICAL": "#dc3545",
+	"HIGH":     "#fd7e14",
+	"MEDIUM":   "#ffc107",
+	"LOW":      "#6c757d",
+}
+
+// notifyEmail sends events right away, or queues them for the daily digest.
+func (n *Notifier) notifyEmail(ctx context.Context, events []VulnerabilityEvent) error {
+	if n.config.EmailDigest != "" {
+		if err := n.store.QueueDigest(ctx, emailDigestChannel, events); err != nil {
+			return fmt.Errorf("queue digest: %w", err)
+		}
+		n.logger.Debug("queued events for email digest", "count", len(events))
+		return nil
+	}
+
+	subject, text, htmlBody, err := n.emailEvents(events, "")
+	if err != nil {
+		return err
+	}
+	return n.sendEmail(ctx, subject, text, htmlBody)
+}
+
+// emailEvents renders events with email.tmpl if there is one, or the
+// built-in format. prefix goes in front of the subject line.
+func (n *Notifier) emailEvents(events []VulnerabilityEvent, prefix string) (subject, text, htmlBody string, err error) {
+	if t := n.config.Templates; t != nil && t.Email != nil {
+		subject, text, htmlBody, err = t.renderEmail(newTemplateData(n.config.ClusterName, events, time.Now()))
+		return prefix + subject, text, htmlBody, err
+	}
+	text, htmlBody = emailEventsBody(events)
+	return n.emailSubject(prefix + eventsSubject(events)), text, htmlBody, nil
+}
+
+// sendEmailSummary sends the initialization summary. It is never deferred
+// to the digest.
+func (n *Notifier) sendEmailSummary(ctx context.Context, events []VulnerabilityEvent) error {
+	text, htmlBody := emailSummaryBody(events)
+	return n.sendEmail(ctx, n.emailSubject(fmt.Sprintf("trix initialized: %d %s", len(events), wording(events).plural)), text, htmlBody)
+}
+
+// SendEmailDigest sends everything queued since the last digest as one
+// email. Events stay queued if sending fails and go out with the next one.
+func (n *Notifier) SendEmailDigest(ctx context.Context) error {
+	return n.traceSend(ctx, "trix.digest", channelEmail, 0, n.sendEmailDigest)
+}
+
+func (n *Notifier) sendEmailDigest(ctx context.Context) error {
+	events, lastID, err := n.store.PendingDigest(ctx, emailDigestChannel)
+	if err != nil {
+		return fmt.Errorf("load digest: %w", err)
+	}
+	if len(events) == 0 {
+		n.logger.Debug("email digest skipped, nothing queued")
+		return nil
+	}
+
+	subject, text, htmlBody, err := n.emailEvents(events, "Daily digest: ")
+	if err != nil {
+		return err
+	}
+	if err := n.sendEmail(ctx, subject, text, htmlBody); err != nil {
+		return err
+	}
+	if err := n.store.ClearDigest(ctx, emailDigestChannel, lastID); err != nil {
+		return fmt.Errorf("clear digest: %w", err)
+	}
+	n.logger.Info("email digest sent", "events", len(events))
+	return nil
+}
+
+// nextDigestAt returns the next time at hour:00 in now's location after now.
+func nextDigestAt(now time.Time, hour int) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+func (n *Notifier) emailSubject(s string) string {
+	if n.config.ClusterName != "" {
+		return fmt.Sprintf("[trix %s] %s", n.config.ClusterName, s)
+	}
+	return "[trix] " + s
+}
+
+// eventsSubject counts events by type, e.g. "2 new, 1 rescored, 3 fixed
+// vulnerabilities"
+func eventsSubject(events []VulnerabilityEvent) string {
+	var parts []string
+	for _, t := range []struct{ eventType, label string }{
+		{"NEW", "new"},
+		{"SEVERITY_CHANGED", "rescored"},
+		{"FIXED", "fixed"},
+	} {
+		if c := countByType(events, t.eventType); c > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", c, t.label))
+		}
+	}
+	if len(parts) == 0 {
+		parts = []string{"0 new"}
+	}
+	return strings.Join(parts, ", ") + " " + wording(events).plural
+}
+
+// emailEventsBody renders image changes, then new vulnerabilities grouped by
+// workload with their CVEs, followed by rescored ones and fixed counts per
+// workload.
+func emailEventsBody(events []VulnerabilityEvent) (text, htmlBody string) {
+	var t, h strings.Builder
+
+	if imageEvents := filterByType(events, "IMAGE_CHANGED"); len(imageEvents) > 0 {
+		fmt.Fprintf(&t, "Images changed (%d)\n\n", len(imageEvents))
+		fmt.Fprintf(&h, "<h2>Images changed (%d)</h2>\n<ul>\n", len(imageEvents))
+		for _, e := range imageEvents {
+			fmt.Fprintf(&t, "  %s\n", imageChangeText(e))
+			fmt.Fprintf(&h, "<li>%s</li>\n", html.EscapeString(imageChangeText(e)))
+		}
+		t.WriteString("\n")
+		h.WriteString("</ul>\n")
+	}
+
+	if newEvents := filterByType(events, "NEW"); len(newEvents) > 0 {
+		grouped := groupByWorkload(newEvents)
+		noun := wording(newEvents).plural
+		fmt.Fprintf(&t, "New %s (%d)\n", noun, len(newEvents))
+		fmt.Fprintf(&h, "<h2>New %s (%d)</h2>\n<ul>\n", noun, len(newEvents))
+		for _, workload := range sortedWorkloads(grouped) {
+			group := grouped[workload]
+			sort.SliceStable(group, func(i, j int) bool {
+				return severityLevel(group[i].Severity) < severityLevel(group[j].Severity)
+			})
+
+			summary := severitySummary(countBySeverity(group))
+			if exposure := group[0].Exposure; exposure != "" {
+				summary += ", exposure: " + exposure
+			}
+			fmt.Fprintf(&t, "\n  %s\n    %s\n", workload, summary)
+			fmt.Fprintf(&h, "<li><code>%s</code>: %s\n<ul>\n", html.EscapeString(workload), html.EscapeString(summary))
+			for _, e := range group {
+				detail := e.Image
+				if e.FixedVersion != "" {
+					if detail != "" {
+						detail += ", "
+					}
+					detail += "fix: " + e.FixedVersion
+				}
+				fmt.Fprintf(&t, "    - %s %s", e.Severity, findingText(e))
+				if detail != "" {
+					fmt.Fprintf(&t, " (%s)", detail)
+				}
+				t.WriteString("\n")
+				fmt.Fprintf(&h, "<li><span style=\"color:%s;font-weight:bold\">%s</span> %s <small>%s</small></li>\n",
+					emailSeverityColor(e.Severity), html.EscapeString(e.Severity), html.EscapeString(findingText(e)), html.EscapeString(detail))
+			}
+			h.WriteString("</ul></li>\n")
+		}
+		t.WriteString("\n")
+		h.WriteString("</ul>\n")
+	}
+
+	if changedEvents := filterByType(events, "SEVERITY_CHANGED"); len(changedEvents) > 0 {
+		grouped := groupByWorkload(changedEvents)
+		fmt.Fprintf(&t, "Severity changed (%d)\n", len(changedEvents))
+		fmt.Fprintf(&h, "<h2>Severity changed (%d)</h2>\n<ul>\n", len(changedEvents))
+		for _, workload := range sortedWorkloads(grouped) {
+			fmt.Fprintf(&t, "\n  %s\n", workload)
+			fmt.Fprintf(&h, "<li><code>%s</code>\n<ul>\n", html.EscapeString(workload))
+			for _, e := range grouped[workload] {
+				fmt.Fprintf(&t, "    - %s %s (was %s)\n", e.Severity, findingText(e), e.OldSeverity)
+				fmt.Fprintf(&h, "<li><span style=\"color:%s;font-weight:bold\">%s</span> %s <small>was %s</small></li>\n",
+					emailSeverityColor(e.Severity), html.EscapeString(e.Severity), html.EscapeString(findingText(e)), html.EscapeString(e.OldSeverity))
+			}
+			h.WriteString("</ul></li>\n")
+		}
+		t.WriteString("\n")
+		h.WriteString("</ul>\n")
+	}
+
+	if fixedEvents := filterByType(events, "FIXED"); len(fixedEvents) > 0 {
+		grouped := groupByWorkload(fixedEvents)
+		noun := wording(fixedEvents).plural
+		fmt.Fprintf(&t, "Fixed %s (%d)\n\n", noun, len(fixedEvents))
+		fmt.Fprintf(&h, "<h2 style=\"color:#36a64f\">Fixed %s (%d)</h2>\n<ul>\n", noun, len(fixedEvents))
+		for _, workload := range sortedWorkloads(grouped) {
+			group := grouped[workload]
+			fmt.Fprintf(&t, "  %s: %d %s\n", workload, len(group), wording(group).short)
+			fmt.Fprintf(&h, "<li><code>%s</code>: %d %s</li>\n", html.EscapeString(workload), len(group), wording(group).short)
+		}
+		h.WriteString("</ul>\n")
+	}
+
+	return t.String(), emailHTML(h.String())
+}
+
+// emailSummaryBody renders the initialization summary with severity counts.
+func emailSummaryBody(events []VulnerabilityEvent) (text, htmlBody string) {
+	counts := countBySeverity(events)
+
+	var t, h strings.Builder
+	noun := wording(events).plural
+	fmt.Fprintf(&t, "trix initialized\n\nFound %d %s\n\n", len(events), noun)
+	fmt.Fprintf(&h, "<h2>trix initialized</h2>\n<p>Found <b>%d</b> %s</p>\n<table>\n", len(events), noun)
+	for _, s := range []string{"CRITICAL", "HIGH", "MEDIUM", "LOW"} {
+		if c := counts[s]; c > 0 {
+			fmt.Fprintf(&t, "  %-9s %d\n", s, c)
+			fmt.Fprintf(&h, "<tr><td style=\"color:%s;font-weight:bold\">%s</td><td>%d</td></tr>\n", emailSeverityColor(s), s, c)
+		}
+	}
+	t.WriteString("\nMonitoring started\n")
+	h.WriteString("</table>\n<p><small>Monitoring started</small></p>\n")
+
+	return t.String(), emailHTML(h.String())
+}
+
+func emailSeverityColor(severity string) string {
+	if c, ok := emailSeverityColors[strings.ToUpper(severity)]; ok {
+		return c
+	}
+	return "#6c757d"
+}
+
+func emailHTML(body string) string {
+	return "<!DOCTYPE html>\n<html><body style=\"font-family:sans-serif\">\n" + body + "</body></html>\n"
+}
+
+// buildEmail assembles a multipart/alternative message with a plain-text and
+// an HTML part.
+func buildEmail(from string, to []string, subject, text, htmlBody string) ([]byte, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", text},
+		{"text/html; charset=utf-8", htmlBody},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", mw.Boundary())
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+// sendEmail delivers one message to all recipients over SMTP, using
+// STARTTLS, implicit TLS or plain text as configured.
+func (n *Notifier) sendEmail(ctx context.Context, subject, text, htmlBody string) error {
+	from, err := mail.ParseAddress(n.config.EmailFrom)
+	if err != nil {
+		return fmt.Errorf("invalid from address: %w", err)
+	}
+	msg, err := buildEmail(n.config.EmailFrom, n.config.EmailTo, subject, text, htmlBody)
+	if err != nil {
+		return fmt.Errorf("build message: %w", err)
+	}
+
+	host := n.config.SMTPHost
+	addr := net.JoinHostPort(host, strconv.Itoa(n.config.SMTPPort))
+	tlsConfig := &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: n.config.SMTPInsecureSkipVerify, //nolint:gosec // Explicit opt-in via TRIX_SMTP_INSECURE_SKIP_VERIFY
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	dialer := &net.Dialer{}
+	var conn net.Conn
+	if n.config.SMTPTLS == "tls" {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("smtp handshake: %w", err)
+	}
+	defer func() { _ = c.Close() }()
+
+	if n.config.SMTPTLS == "starttls" {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("server does not support STARTTLS (set TRIX_SMTP_TLS=none to send unencrypted)")
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("starttls: %w", err)
+		}
+	}
+
+	if n.config.SMTPUsername != "" {
+		if err := c.Auth(smtp.PlainAuth("", n.config.SMTPUsername, n.config.SMTPPassword, host)); err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+	}
+
+	if err := c.Mail(from.Address); err != nil {
+		return fmt.Errorf("mail from: %w", err)
+	}
+	for _, to := range n.config.EmailTo {
+		rcpt, err := mail.ParseAddress(to)
+		if err != nil {
+			return fmt.Errorf("invalid recipient %q: %w", to, err)
+		}
+		if err := c.Rcpt(rcpt.Address); err != nil {
+			return fmt.Errorf("rcpt to %s: %w", rcpt.Address, err)
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("data: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("write message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("send message: %w", err)
+	}
+
+	n.logger.Debug("email sent", "recipients", len(n.config.EmailTo))
+	return c.Quit()
+}
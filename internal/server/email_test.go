@@ -0,0 +1,389 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// smtpMessage is one message accepted by the stub SMTP server
+type smtpMessage struct {
+	from string
+	to   []string
+	auth string // Decoded AUTH PLAIN response, "" without AUTH
+	tls  bool   // Sent over TLS
+	data []byte
+}
+
+// smtpStub is a minimal SMTP server. It offers STARTTLS when starttls is
+// set, or speaks TLS from the start when implicitTLS is.
+type smtpStub struct {
+	ln          net.Listener
+	starttls    *tls.Config
+	implicitTLS bool
+
+	mu       sync.Mutex
+	messages []smtpMessage
+}
+
+func newSMTPStub(t *testing.T, starttls *tls.Config, implicitTLS *tls.Config) *smtpStub {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpStub{ln: ln, starttls: starttls}
+	if implicitTLS != nil {
+		s.ln = tls.NewListener(ln, implicitTLS)
+		s.implicitTLS = true
+	}
+	t.Cleanup(func() { _ = s.ln.Close() })
+	go func() {
+		for {
+			conn, err := s.ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+// env returns the TRIX_SMTP_* settings pointing at the stub
+func (s *smtpStub) env(mode string) map[string]string {
+	return map[string]string{
+		"TRIX_SMTP_HOST":  "127.0.0.1",
+		"TRIX_SMTP_PORT":  strconv.Itoa(s.ln.Addr().(*net.TCPAddr).Port),
+		"TRIX_SMTP_TLS":   mode,
+		"TRIX_EMAIL_FROM": "trix <trix@example.com>",
+		"TRIX_EMAIL_TO":   "sec@example.com, Ops Team <ops@example.com>",
+	}
+}
+
+func (s *smtpStub) received() []smtpMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]smtpMessage(nil), s.messages...)
+}
+
+func (s *smtpStub) serve(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	tp := textproto.NewConn(conn)
+	msg := smtpMessage{tls: s.implicitTLS}
+	reply := func(line string) { _ = tp.PrintfLine("%s", line) }
+
+	reply("220 stub ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			lines := []string{"250-stub"}
+			if s.starttls != nil && !msg.tls {
+				lines = append(lines, "250-STARTTLS")
+			}
+			lines = append(lines, "250-AUTH PLAIN", "250 8BITMIME")
+			for _, l := range lines {
+				reply(l)
+			}
+		case "STARTTLS":
+			reply("220 ready")
+			tlsConn := tls.Server(conn, s.starttls)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn = tlsConn
+			tp = textproto.NewConn(conn)
+			msg.tls = true
+		case "AUTH":
+			_, resp, _ := strings.Cut(arg, " ")
+			decoded, _ := base64.StdEncoding.DecodeString(resp)
+			msg.auth = string(decoded)
+			reply("235 ok")
+		case "MAIL":
+			msg.from = smtpPath(arg)
+			reply("250 ok")
+		case "RCPT":
+			msg.to = append(msg.to, smtpPath(arg))
+			reply("250 ok")
+		case "DATA":
+			reply("354 go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			msg.data = data
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		case "RSET", "NOOP":
+			reply("250 ok")
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+// smtpPath extracts the address from "FROM:<a@b> BODY=8BITMIME"
+func smtpPath(arg string) string {
+	_, rest, _ := strings.Cut(arg, "<")
+	addr, _, _ := strings.Cut(rest, ">")
+	return addr
+}
+
+// emailParts parses a multipart/alternative message into its headers and
+// decoded parts by content type.
+func emailParts(t *testing.T, data []byte) (mail.Header, map[string]string) {
+	t.Helper()
+	m, err := mail.ReadMessage(bufio.NewReader(strings.NewReader(string(data))))
+	if err != nil {
+		t.Fatalf("parse message: %v", err)
+	}
+	mediaType, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q, want multipart/alternative", m.Header.Get("Content-Type"))
+	}
+	parts := make(map[string]string)
+	var order []string
+	mr := multipart.NewReader(m.Body, params["boundary"])
+	for {
+		p, err := mr.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read part: %v", err)
+		}
+		if enc := p.Header.Get("Content-Transfer-Encoding"); enc != "quoted-printable" {
+			t.Errorf("part encoding = %q, want quoted-printable", enc)
+		}
+		body, err := io.ReadAll(quotedprintable.NewReader(p))
+		if err != nil {
+			t.Fatalf("decode part: %v", err)
+		}
+		ct := p.Header.Get("Content-Type")
+		parts[ct] = string(body)
+		order = append(order, ct)
+	}
+	want := []string{"text/plain; charset=utf-8", "text/html; charset=utf-8"}
+	if strings.Join(order, "|") != strings.Join(want, "|") {
+		t.Errorf("parts = %q, want %q", order, want)
+	}
+	return m.Header, parts
+}
+
+func TestEmailImmediate(t *testing.T) {
+	stub := newSMTPStub(t, nil, nil)
+	env := stub.env("none")
+	env["TRIX_SMTP_USERNAME"] = "trix"
+	env["TRIX_SMTP_PASSWORD"] = "hunter2"
+	env["TRIX_CLUSTER_NAME"] = "prod-eu"
+	n := testNotifier(t, env)
+
+	events := teamsEvents()
+	if res := n.Deliver(context.Background(), channelEmail, events); res.Err != nil {
+		t.Fatalf("Deliver: %v", res.Err)
+	}
+	msgs := stub.received()
+	if len(msgs) != 1 {
+		t.Fatalf("received %d messages, want 1", len(msgs))
+	}
+	m := msgs[0]
+	if m.from != "trix@example.com" {
+		t.Errorf("MAIL FROM = %q, want the bare address", m.from)
+	}
+	if strings.Join(m.to, ",") != "sec@example.com,ops@example.com" {
+		t.Errorf("RCPT TO = %v", m.to)
+	}
+	if m.auth != "\x00trix\x00hunter2" {
+		t.Errorf("AUTH PLAIN = %q", m.auth)
+	}
+
+	header, parts := emailParts(t, m.data)
+	if header.Get("From") != "trix <trix@example.com>" || header.Get("To") != "sec@example.com, Ops Team <ops@example.com>" {
+		t.Errorf("From/To = %q/%q", header.Get("From"), header.Get("To"))
+	}
+	if header.Get("MIME-Version") != "1.0" || header.Get("Date") == "" {
+		t.Errorf("missing MIME-Version or Date: %v", header)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[trix prod-eu] 3 new, 1 rescored, 2 fixed vulnerabilities"; subject != want {
+		t.Errorf("Subject = %q, want %q", subject, want)
+	}
+
+	text := parts["text/plain; charset=utf-8"]
+	for _, want := range []string{"New vulnerabilities (3)", "prod/deployment/api", "CRITICAL CVE-2024-0001 (openssl:3.0.1)", "Severity changed (1)", "Images changed (1)"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text part missing %q:\n%s", want, text)
+		}
+	}
+	htmlBody := parts["text/html; charset=utf-8"]
+	for _, want := range []string{"<!DOCTYPE html>", "<code>prod/deployment/api</code>", "color:#dc3545", "CVE-2024-0001"} {
+		if !strings.Contains(htmlBody, want) {
+			t.Errorf("html part missing %q:\n%s", want, htmlBody)
+		}
+	}
+}
+
+func TestEmailStartTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	cert := pki.issueValid(t, "smtp", false)
+	stub := newSMTPStub(t, &tls.Config{Certificates: []tls.Certificate{cert.pair}}, nil)
+
+	// Verification is on by default and the stub's CA is not trusted
+	n := testNotifier(t, stub.env("starttls"))
+	res := n.Deliver(context.Background(), channelEmail, teamsEvents())
+	if res.Err == nil || !strings.Contains(res.Err.Error(), "starttls") {
+		t.Fatalf("err = %v, want a starttls verification error", res.Err)
+	}
+	if len(stub.received()) != 0 {
+		t.Fatal("message sent over an unverified connection")
+	}
+
+	env := stub.env("starttls")
+	env["TRIX_SMTP_INSECURE_SKIP_VERIFY"] = "true"
+	n = testNotifier(t, env)
+	if res := n.Deliver(context.Background(), channelEmail, teamsEvents()); res.Err != nil {
+		t.Fatalf("Deliver with verification off: %v", res.Err)
+	}
+	if msgs := stub.received(); len(msgs) != 1 || !msgs[0].tls {
+		t.Fatalf("received %+v, want one message over TLS", msgs)
+	}
+}
+
+func TestEmailStartTLSNotOffered(t *testing.T) {
+	stub := newSMTPStub(t, nil, nil)
+	n := testNotifier(t, stub.env("starttls"))
+	res := n.Deliver(context.Background(), channelEmail, teamsEvents())
+	if res.Err == nil || !strings.Contains(res.Err.Error(), "does not support STARTTLS") {
+		t.Fatalf("err = %v, want STARTTLS to be required", res.Err)
+	}
+	if len(stub.received()) != 0 {
+		t.Fatal("message sent in plain text")
+	}
+}
+
+func TestEmailImplicitTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	cert := pki.issueValid(t, "smtps", false)
+	stub := newSMTPStub(t, nil, &tls.Config{Certificates: []tls.Certificate{cert.pair}})
+
+	env := stub.env("tls")
+	env["TRIX_SMTP_INSECURE_SKIP_VERIFY"] = "true"
+	n := testNotifier(t, env)
+	if res := n.Deliver(context.Background(), channelEmail, teamsEvents()); res.Err != nil {
+		t.Fatalf("Deliver: %v", res.Err)
+	}
+	if msgs := stub.received(); len(msgs) != 1 || !msgs[0].tls {
+		t.Fatalf("received %+v, want one message over TLS", msgs)
+	}
+}
+
+func TestEmailDigest(t *testing.T) {
+	stub := newSMTPStub(t, nil, nil)
+	env := stub.env("none")
+	env["TRIX_EMAIL_DIGEST"] = "daily"
+	n := testNotifier(t, env)
+	ctx := context.Background()
+
+	events := filterByType(teamsEvents(), "NEW")
+	for _, batch := range [][]VulnerabilityEvent{events[:1], events[1:]} {
+		if res := n.Deliver(ctx, channelEmail, batch); res.Err != nil {
+			t.Fatalf("Deliver: %v", res.Err)
+		}
+	}
+	if len(stub.received()) != 0 {
+		t.Fatal("digest mode sent an email right away")
+	}
+
+	if err := n.SendEmailDigest(ctx); err != nil {
+		t.Fatalf("SendEmailDigest: %v", err)
+	}
+	msgs := stub.received()
+	if len(msgs) != 1 {
+		t.Fatalf("received %d messages, want 1 digest", len(msgs))
+	}
+	header, parts := emailParts(t, msgs[0].data)
+	subject, _ := new(mime.WordDecoder).DecodeHeader(header.Get("Subject"))
+	if subject != "[trix] Daily digest: 3 new vulnerabilities" {
+		t.Errorf("Subject = %q", subject)
+	}
+	for _, e := range events {
+		if !strings.Contains(parts["text/plain; charset=utf-8"], e.CVE) {
+			t.Errorf("digest is missing %s", e.CVE)
+		}
+	}
+
+	// Everything was included, so the next digest has nothing to send
+	if pending, _, err := n.store.PendingDigest(ctx, emailDigestChannel); err != nil || len(pending) != 0 {
+		t.Fatalf("pending after digest = %d (err %v), want 0", len(pending), err)
+	}
+	if err := n.SendEmailDigest(ctx); err != nil {
+		t.Fatalf("empty SendEmailDigest: %v", err)
+	}
+	if len(stub.received()) != 1 {
+		t.Error("an empty digest was sent")
+	}
+}
+
+func TestEmailDigestKeptOnFailure(t *testing.T) {
+	stub := newSMTPStub(t, nil, nil)
+	env := stub.env("none")
+	env["TRIX_EMAIL_DIGEST"] = "daily"
+	n := testNotifier(t, env)
+	ctx := context.Background()
+
+	if res := n.Deliver(ctx, channelEmail, teamsEvents()[:2]); res.Err != nil {
+		t.Fatalf("Deliver: %v", res.Err)
+	}
+	_ = stub.ln.Close()
+	if err := n.SendEmailDigest(ctx); err == nil {
+		t.Fatal("SendEmailDigest succeeded without a server")
+	}
+	if pending, _, err := n.store.PendingDigest(ctx, emailDigestChannel); err != nil || len(pending) != 2 {
+		t.Errorf("pending after failure = %d (err %v), want 2", len(pending), err)
+	}
+}
+
+func TestNextDigestAt(t *testing.T) {
+	loc := time.FixedZone("test", 2*60*60)
+	tests := []struct {
+		now  time.Time
+		hour int
+		want time.Time
+	}{
+		{time.Date(2024, 5, 1, 6, 30, 0, 0, loc), 8, time.Date(2024, 5, 1, 8, 0, 0, 0, loc)},
+		{time.Date(2024, 5, 1, 8, 0, 0, 0, loc), 8, time.Date(2024, 5, 2, 8, 0, 0, 0, loc)},
+		{time.Date(2024, 5, 1, 23, 59, 0, 0, loc), 0, time.Date(2024, 5, 2, 0, 0, 0, 0, loc)},
+		{time.Date(2024, 12, 31, 9, 0, 0, 0, loc), 8, time.Date(2025, 1, 1, 8, 0, 0, 0, loc)},
+	}
+	for _, tt := range tests {
+		if got := nextDigestAt(tt.now, tt.hour); !got.Equal(tt.want) {
+			t.Errorf("nextDigestAt(%s, %d) = %s, want %s", tt.now, tt.hour, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/trixsec-dev/trix/internal/tools/exposure"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// exposureKinds are the workload kinds the exposure analyzer can resolve
+var exposureKinds = map[string]bool{
+	"Deployment": true, "ReplicaSet": true, "DaemonSet": true, "StatefulSet": true, "Pod": true,
+}
+
+// exposureCache analyzes each workload's network exposure at most once per
+// cycle. A cycle is a full poll or a watch flush; reset starts the next one,
+// so a Service or Ingress added in between is picked up on the next cycle.
+type exposureCache struct {
+	clientset kubernetes.Interface
+	analyzer  *exposure.Analyzer
+
+	mu      sync.Mutex
+	entries map[string]*exposureEntry // Workload -> level
+}
+
+type exposureEntry struct {
+	once  sync.Once
+	level string
+}
+
+func newExposureCache(clientset kubernetes.Interface, dynamicClient dynamic.Interface) *exposureCache {
+	return &exposureCache{
+		clientset: clientset,
+		analyzer:  exposure.NewDefaultAnalyzer(clientset, dynamicClient),
+		entries:   make(map[string]*exposureEntry),
+	}
+}
+
+// reset forgets all cached levels
+func (c *exposureCache) reset() {
+	c.mu.Lock()
+	c.entries = make(map[string]*exposureEntry)
+	c.mu.Unlock()
+}
+
+// level returns the exposure level of workload (namespace/kind/name), or ""
+// when it can't be analyzed. Concurrent callers for the same workload wait
+// for a single analysis.
+func (c *exposureCache) level(ctx context.Context, workload string) (string, error) {
+	c.mu.Lock()
+	e, ok := c.entries[workload]
+	if !ok {
+		e = &exposureEntry{}
+		c.entries[workload] = e
+	}
+	c.mu.Unlock()
+
+	var err error
+	e.once.Do(func() {
+		var level exposure.ExposureLevel
+		level, err = c.analyze(ctx, workload)
+		e.level = string(level)
+	})
+	return e.level, err
+}
+
+func (c *exposureCache) analyze(ctx context.Context, workload string) (exposure.ExposureLevel, error) {
+	parts := strings.SplitN(workload, "/", 3)
+	if len(parts) != 3 || parts[0] == "" || !exposureKinds[parts[1]] {
+		// Cluster-scoped reports and kinds like CronJob have no exposure
+		return "", nil
+	}
+	namespace, kind, name := parts[0], parts[1], parts[2]
+
+	w, err := exposure.ResolveWorkload(ctx, c.clientset, kind, name, namespace)
+	if err != nil {
+		return "", err
+	}
+	result, err := c.analyzer.Analyze(ctx, w)
+	if err != nil {
+		return "", err
+	}
+	return result.Level, nil
+}
+
+// enrichExposure sets the exposure level on records. Failures are logged
+// once per workload and leave the level empty.
+func (p *Poller) enrichExposure(ctx context.Context, records []*VulnerabilityRecord) {
+	if p.exposure == nil {
+		return
+	}
+	for _, record := range records {
+		level, err := p.exposure.level(ctx, record.Workload)
+		if err != nil {
+			p.logger.Warn("exposure analysis failed", "workload", record.Workload, "error", err)
+		}
+		record.Exposure = level
+	}
+}
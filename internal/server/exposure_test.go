@@ -0,0 +1,222 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+// exposedCluster returns a clientset with the deployment behind a Service of
+// serviceType, and a dynamic client without Gateway API routes
+func exposedCluster(namespace, deployment string, serviceType corev1.ServiceType) (*k8sfake.Clientset, *dynamicfake.FakeDynamicClient) {
+	labels := map[string]string{"app": deployment}
+	clientset := k8sfake.NewSimpleClientset(
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: deployment, Namespace: namespace},
+			Spec:       appsv1.DeploymentSpec{Selector: &metav1.LabelSelector{MatchLabels: labels}},
+		},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: deployment, Namespace: namespace},
+			Spec:       corev1.ServiceSpec{Type: serviceType, Selector: labels, Ports: []corev1.ServicePort{{Port: 443}}},
+		},
+	)
+	dyn := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "httproutes"}:      "HTTPRouteList",
+		{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "grpcroutes"}:      "GRPCRouteList",
+		{Group: "gateway.networking.k8s.io", Version: "v1alpha2", Resource: "udproutes"}: "UDPRouteList",
+		{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "gateways"}:        "GatewayList",
+	})
+	return clientset, dyn
+}
+
+// workloadLookups counts the Deployment reads, one per analysis
+func workloadLookups(clientset *k8sfake.Clientset) int {
+	n := 0
+	for _, a := range clientset.Actions() {
+		if a.GetVerb() == "get" && a.GetResource().Resource == "deployments" {
+			n++
+		}
+	}
+	return n
+}
+
+func TestExposureCache(t *testing.T) {
+	ctx := context.Background()
+	clientset, dyn := exposedCluster("payments", "api", corev1.ServiceTypeLoadBalancer)
+	cache := newExposureCache(clientset, dyn)
+
+	// Concurrent callers share one analysis
+	var wg sync.WaitGroup
+	levels := make([]string, 10)
+	for i := range levels {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			levels[i], _ = cache.level(ctx, "payments/Deployment/api")
+		}()
+	}
+	wg.Wait()
+	for _, level := range levels {
+		if level != "external" {
+			t.Errorf("levels = %v, want external", levels)
+			break
+		}
+	}
+	if n := workloadLookups(clientset); n != 1 {
+		t.Errorf("%d analyses, want 1 per cycle", n)
+	}
+
+	// The next cycle sees a changed Service
+	svc, err := clientset.CoreV1().Services("payments").Get(ctx, "api", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.Spec.Type = corev1.ServiceTypeClusterIP
+	if _, err := clientset.CoreV1().Services("payments").Update(ctx, svc, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if level, _ := cache.level(ctx, "payments/Deployment/api"); level != "external" {
+		t.Errorf("level within the cycle = %q, want the cached external", level)
+	}
+	cache.reset()
+	if level, err := cache.level(ctx, "payments/Deployment/api"); err != nil || level != "clusterInternal" {
+		t.Errorf("level after reset = %q, %v, want clusterInternal", level, err)
+	}
+	if n := workloadLookups(clientset); n != 2 {
+		t.Errorf("%d analyses after reset, want 2", n)
+	}
+}
+
+func TestExposureCacheUnanalyzable(t *testing.T) {
+	ctx := context.Background()
+	clientset, dyn := exposedCluster("payments", "api", corev1.ServiceTypeLoadBalancer)
+	cache := newExposureCache(clientset, dyn)
+
+	for _, workload := range []string{"/ClusterRole/admin", "payments/CronJob/report", "malformed"} {
+		if level, err := cache.level(ctx, workload); level != "" || err != nil {
+			t.Errorf("level(%s) = %q, %v, want none", workload, level, err)
+		}
+	}
+	if n := len(clientset.Actions()); n != 0 {
+		t.Errorf("%d API calls for workloads without exposure", n)
+	}
+
+	// A missing workload fails once per cycle; later callers get no level
+	if _, err := cache.level(ctx, "payments/Deployment/gone"); err == nil {
+		t.Error("no error for a missing Deployment")
+	}
+	if level, err := cache.level(ctx, "payments/Deployment/gone"); level != "" || err != nil {
+		t.Errorf("second lookup = %q, %v", level, err)
+	}
+	if n := workloadLookups(clientset); n != 1 {
+		t.Errorf("%d lookups of the missing Deployment, want 1", n)
+	}
+}
+
+func TestPollExposureEnrich(t *testing.T) {
+	ctx := context.Background()
+	clientset, dyn := exposedCluster("payments", "api", corev1.ServiceTypeNodePort)
+	db := NewMemoryStore()
+	p := testPoller(testConfig(t, map[string]string{"TRIX_EXPOSURE_ENRICH": "true"}), db, fakeDynamic(
+		vulnReport("payments", "api", "sha256:aaa",
+			fixtureVuln{"CVE-2024-0001", "CRITICAL", "openssl", "3.0.1", "3.0.8"},
+			fixtureVuln{"CVE-2024-0002", "HIGH", "zlib", "1.2.11", ""},
+		),
+		vulnReport("payments", "worker", "sha256:bbb", fixtureVuln{"CVE-2024-0001", "CRITICAL", "openssl", "3.0.1", "3.0.8"}),
+	))
+	p.exposure = newExposureCache(clientset, dyn)
+
+	events, err := p.Poll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("events = %v", eventKeys(events))
+	}
+	for _, e := range events {
+		want := "nodePort"
+		if e.Workload == "payments/Deployment/worker" {
+			want = "" // Not found, analyzed once and left empty
+		}
+		if e.Exposure != want {
+			t.Errorf("%s in %s exposure = %q, want %q", e.CVE, e.Workload, e.Exposure, want)
+		}
+		if wantFix := map[string]string{"CVE-2024-0001": "3.0.8", "CVE-2024-0002": ""}[e.CVE]; e.FixedVersion != wantFix {
+			t.Errorf("%s fixed version = %q, want %q", e.CVE, e.FixedVersion, wantFix)
+		}
+	}
+	if n := workloadLookups(clientset); n != 2 {
+		t.Errorf("%d analyses, want one per workload", n)
+	}
+
+	for _, e := range events {
+		if v := mustGet(t, db, e.ID); v.Exposure != e.Exposure {
+			t.Errorf("stored exposure of %s = %q, want %q", e.ID, v.Exposure, e.Exposure)
+		}
+	}
+
+	// Every poll is a new cycle
+	if _, err := p.Poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := workloadLookups(clientset); n != 4 {
+		t.Errorf("%d analyses after the second poll, want 4", n)
+	}
+}
+
+func TestExposureEnrichDisabled(t *testing.T) {
+	p := testPoller(testConfig(t, nil), NewMemoryStore(), fakeDynamic(
+		vulnReport("payments", "api", "sha256:aaa", fixtureVuln{"CVE-2024-0001", "CRITICAL", "openssl", "3.0.1", "3.0.8"}),
+	))
+	if p.config.ExposureEnrich {
+		t.Fatal("exposure enrichment on by default")
+	}
+	events, err := p.Poll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Exposure != "" || events[0].FixedVersion != "3.0.8" {
+		t.Errorf("events = %+v", events)
+	}
+}
+
+// The webhook and email carry the fixed version and exposure
+func TestFixAndExposurePayloads(t *testing.T) {
+	receiver, received := stubReceiver(t, http.StatusOK)
+	n := testNotifier(t, map[string]string{"TRIX_NOTIFY_WEBHOOK": receiver.URL})
+	event := testEvents()[0]
+	event.FixedVersion, event.Exposure = "3.0.8", "external"
+	n.Notify(context.Background(), []VulnerabilityEvent{event})
+
+	reqs := received()
+	if len(reqs) != 1 {
+		t.Fatalf("%d webhook requests", len(reqs))
+	}
+	var payload struct {
+		Events []VulnerabilityEvent `json:"events"`
+	}
+	if err := json.Unmarshal(reqs[0].body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if len(payload.Events) != 1 || payload.Events[0].FixedVersion != "3.0.8" || payload.Events[0].Exposure != "external" {
+		t.Errorf("webhook events = %+v", payload.Events)
+	}
+
+	text, _ := emailEventsBody([]VulnerabilityEvent{event})
+	for _, want := range []string{"1 critical, exposure: external", "(openssl:3.0.1, fix: 3.0.8)"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("email lacks %q:\n%s", want, text)
+		}
+	}
+}
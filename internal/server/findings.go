@@ -0,0 +1,122 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/trixsec-dev/trix/internal/tools/trivy"
+)
+
+// Finding kinds tracked by the server. Records and events share one table
+// and one event stream; the kind decides which report produced them and how
+// they are worded in notifications.
+const (
+	KindVulnerability = string(trivy.FindingTypeVulnerability) // VulnerabilityReports, CVE is the CVE
+	KindSecret        = string(trivy.FindingTypeSecret)        // ExposedSecretReports, CVE is the rule ID
+	KindCompliance    = string(trivy.FindingTypeCompliance)    // ConfigAuditReports, CVE is the check ID
+)
+
+// kindWording is how notifications name findings of one kind
+type kindWording struct {
+	plural string // "3 new vulnerabilities"
+	title  string // Teams section titles
+	short  string // "2 CVEs" in fixed counts
+}
+
+var kindWordings = map[string]kindWording{
+	KindVulnerability: {"vulnerabilities", "Vulnerabilities", "CVEs"},
+	KindSecret:        {"exposed secrets", "Exposed Secrets", "secrets"},
+	KindCompliance:    {"misconfigurations", "Misconfigurations", "checks"},
+	"":                {"findings", "Findings", "findings"},
+}
+
+// parseTrackTypes parses a comma-separated list of finding kinds.
+func parseTrackTypes(v string) ([]string, error) {
+	var kinds []string
+	seen := make(map[string]bool)
+	for _, kind := range strings.Split(v, ",") {
+		kind = strings.ToLower(strings.TrimSpace(kind))
+		switch kind {
+		case "":
+			continue
+		case KindVulnerability, KindSecret, KindCompliance:
+		default:
+			return nil, fmt.Errorf("unknown type %q (use %s, %s or %s)", kind, KindVulnerability, KindSecret, KindCompliance)
+		}
+		if !seen[kind] {
+			seen[kind] = true
+			kinds = append(kinds, kind)
+		}
+	}
+	if len(kinds) == 0 {
+		return nil, fmt.Errorf("no types given")
+	}
+	return kinds, nil
+}
+
+// tracks reports whether the poller reconciles findings of kind
+func (c *Config) tracks(kind string) bool {
+	for _, k := range c.TrackTypes {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// kindOf returns the kind events share, or "" when they mix kinds.
+// Events stored before kinds existed have none and are vulnerabilities.
+func kindOf(events []VulnerabilityEvent) string {
+	kind := ""
+	for i, e := range events {
+		if i == 0 {
+			kind = e.kind()
+		} else if e.kind() != kind {
+			return ""
+		}
+	}
+	if kind == "" {
+		return KindVulnerability
+	}
+	return kind
+}
+
+// recordKind returns the kind of v, defaulting to KindVulnerability
+func recordKind(v *VulnerabilityRecord) string {
+	if v.Kind == "" {
+		return KindVulnerability
+	}
+	return v.Kind
+}
+
+func (e VulnerabilityEvent) kind() string {
+	if e.Kind == "" {
+		return KindVulnerability
+	}
+	return e.Kind
+}
+
+// wording names events in notifications, e.g. "vulnerabilities", or
+// "findings" when they mix kinds
+func wording(events []VulnerabilityEvent) kindWording {
+	return kindWordings[kindOf(events)]
+}
+
+// findingText names the finding of e in plain text: the CVE, the secret
+// rule's title, or the config check with its title.
+func findingText(e VulnerabilityEvent) string {
+	switch e.kind() {
+	case KindSecret:
+		if e.Title != "" {
+			return fmt.Sprintf("%s (%s)", e.Title, e.CVE)
+		}
+		return e.CVE
+	case KindCompliance:
+		if e.Title != "" {
+			return e.CVE + ": " + e.Title
+		}
+		return e.CVE
+	default:
+		return e.CVE
+	}
+}
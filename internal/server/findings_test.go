@@ -0,0 +1,343 @@
+package server
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// trivyReport builds a report of kind for a deployment's container
+func trivyReport(kind, name, namespace, deployment string, report map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "aquasecurity.github.io/v1alpha1",
+		"kind":       kind,
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": namespace,
+			"labels": map[string]interface{}{
+				"trivy-operator.resource.kind":  "Deployment",
+				"trivy-operator.resource.name":  deployment,
+				"trivy-operator.container.name": "app",
+			},
+		},
+		"report": report,
+	}}
+}
+
+// secretReport builds an ExposedSecretReport with one secret per rule ID
+func secretReport(namespace, deployment string, ruleIDs ...string) *unstructured.Unstructured {
+	var secrets []interface{}
+	for _, id := range ruleIDs {
+		secrets = append(secrets, map[string]interface{}{
+			"ruleID":   id,
+			"title":    "AWS Access Key ID",
+			"severity": "CRITICAL",
+			"target":   "/app/config.env",
+			"match":    "AWS_ACCESS_KEY_ID=*****",
+		})
+	}
+	return trivyReport("ExposedSecretReport", "replicaset-"+deployment+"-app", namespace, deployment, map[string]interface{}{
+		"artifact": map[string]interface{}{"repository": "example/" + deployment, "tag": "latest"},
+		"secrets":  secrets,
+	})
+}
+
+// configAuditReport builds a ConfigAuditReport with failed checks, and a
+// passed one that is never a finding
+func configAuditReport(namespace, deployment string, failed ...string) *unstructured.Unstructured {
+	checks := []interface{}{map[string]interface{}{
+		"checkID": "KSV001", "title": "Process can elevate its own privileges", "severity": "MEDIUM", "success": true,
+	}}
+	for _, id := range failed {
+		checks = append(checks, map[string]interface{}{
+			"checkID": id, "title": "Root file system is not read-only", "severity": "HIGH", "success": false,
+		})
+	}
+	return trivyReport("ConfigAuditReport", "replicaset-"+deployment, namespace, deployment, map[string]interface{}{
+		"checks": checks,
+	})
+}
+
+func TestParseTrackTypes(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"vulnerability", []string{KindVulnerability}},
+		{" Secret , compliance,secret,", []string{KindSecret, KindCompliance}},
+		{"vulnerability,secret,compliance", []string{KindVulnerability, KindSecret, KindCompliance}},
+	}
+	for _, tt := range tests {
+		got, err := parseTrackTypes(tt.in)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseTrackTypes(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+	}
+	for in, want := range map[string]string{
+		"rbac":    `unknown type "rbac"`,
+		" , ":     "no types given",
+		"secrets": `unknown type "secrets"`,
+	} {
+		if _, err := parseTrackTypes(in); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("parseTrackTypes(%q) err = %v, want %q", in, err, want)
+		}
+	}
+}
+
+func TestTrackTypesConfig(t *testing.T) {
+	cfg := testConfig(t, nil)
+	if !reflect.DeepEqual(cfg.TrackTypes, []string{KindVulnerability}) || cfg.tracks(KindSecret) {
+		t.Errorf("default TrackTypes = %v, want vulnerabilities only", cfg.TrackTypes)
+	}
+
+	t.Setenv(ConfigFileEnv, "")
+	t.Setenv("TRIX_DATABASE_URL", "memory://")
+	t.Setenv("TRIX_TRACK_TYPES", "vulns")
+	if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "invalid TRIX_TRACK_TYPES") {
+		t.Errorf("TRIX_TRACK_TYPES=vulns: err = %v", err)
+	}
+	t.Setenv("TRIX_TRACK_TYPES", "secret")
+	t.Setenv("TRIX_WATCH", "true")
+	if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "TRIX_WATCH requires vulnerability") {
+		t.Errorf("TRIX_WATCH without vulnerabilities: err = %v", err)
+	}
+}
+
+// listedResources returns the resources the fake client listed, in order
+func listedResources(dyn interface {
+	Actions() []k8stesting.Action
+}) []string {
+	var listed []string
+	for _, a := range dyn.Actions() {
+		if a.GetVerb() == "list" {
+			listed = append(listed, a.GetResource().Resource)
+		}
+	}
+	return listed
+}
+
+// Vulnerability-only deployments don't list or store other reports
+func TestPollVulnerabilitiesOnly(t *testing.T) {
+	db := NewMemoryStore()
+	dyn := fakeDynamic(
+		vulnReport("payments", "api", "sha256:aaa", fixtureVuln{"CVE-2024-0001", "CRITICAL", "openssl", "3.0.1", "3.0.8"}),
+		secretReport("payments", "api", "aws-access-key-id"),
+		configAuditReport("payments", "api", "KSV014"),
+	)
+	events, err := testPoller(testConfig(t, nil), db, dyn).Poll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Kind != KindVulnerability || events[0].CVE != "CVE-2024-0001" {
+		t.Errorf("events = %v", eventKeys(events))
+	}
+	if listed := listedResources(dyn); !reflect.DeepEqual(listed, []string{"vulnerabilityreports", "clustervulnerabilityreports"}) {
+		t.Errorf("listed %v", listed)
+	}
+}
+
+func TestPollTracksKinds(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryStore()
+	cfg := testConfig(t, map[string]string{"TRIX_TRACK_TYPES": "vulnerability,secret,compliance"})
+	critical := fixtureVuln{"CVE-2024-0001", "CRITICAL", "openssl", "3.0.1", "3.0.8"}
+
+	events, err := testPoller(cfg, db, fakeDynamic(
+		vulnReport("payments", "api", "sha256:aaa", critical),
+		secretReport("payments", "api", "aws-access-key-id"),
+		configAuditReport("payments", "api", "KSV014"),
+	)).Poll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byKind := make(map[string]VulnerabilityEvent)
+	for _, e := range events {
+		if e.Type != "NEW" {
+			t.Errorf("unexpected %s event", e.Type)
+		}
+		byKind[e.Kind] = e
+	}
+	if len(events) != 3 || len(byKind) != 3 {
+		t.Fatalf("events = %v, want one NEW per kind", eventKeys(events))
+	}
+	secret := byKind[KindSecret]
+	if secret.CVE != "aws-access-key-id" || secret.Title != "AWS Access Key ID" || secret.Image != "/app/config.env" ||
+		secret.Workload != "payments/Deployment/api" || secret.Severity != "CRITICAL" {
+		t.Errorf("secret event = %+v", secret)
+	}
+	check := byKind[KindCompliance]
+	if check.CVE != "KSV014" || check.Title != "Root file system is not read-only" || check.Severity != "HIGH" {
+		t.Errorf("config audit event = %+v", check)
+	}
+	if secret.ID == byKind[KindVulnerability].ID || secret.ID == check.ID {
+		t.Error("finding IDs collide across kinds")
+	}
+
+	// The secret was removed: FIXED for it alone
+	events, err = testPoller(cfg, db, fakeDynamic(
+		vulnReport("payments", "api", "sha256:aaa", critical),
+		secretReport("payments", "api"),
+		configAuditReport("payments", "api", "KSV014"),
+	)).Poll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Type != "FIXED" || events[0].Kind != KindSecret || events[0].ID != secret.ID {
+		t.Errorf("events = %v, want the secret fixed", eventKeys(events))
+	}
+
+	// Dropping a kind from TRIX_TRACK_TYPES doesn't mark its findings fixed
+	events, err = testPoller(testConfig(t, map[string]string{"TRIX_TRACK_TYPES": "vulnerability"}), db, fakeDynamic(
+		vulnReport("payments", "api", "sha256:aaa", critical),
+	)).Poll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 0 {
+		t.Errorf("events = %v after untracking compliance", eventKeys(events))
+	}
+	if v := mustGet(t, db, check.ID); v.State != StateOpen || v.Kind != KindCompliance {
+		t.Errorf("untracked finding = %+v", v)
+	}
+}
+
+func TestFindingText(t *testing.T) {
+	tests := []struct {
+		event VulnerabilityEvent
+		want  string
+	}{
+		{VulnerabilityEvent{CVE: "CVE-2024-0001"}, "CVE-2024-0001"}, // Stored before kinds existed
+		{VulnerabilityEvent{Kind: KindVulnerability, CVE: "CVE-2024-0001", Title: "ignored"}, "CVE-2024-0001"},
+		{VulnerabilityEvent{Kind: KindSecret, CVE: "aws-access-key-id", Title: "AWS Access Key ID"}, "AWS Access Key ID (aws-access-key-id)"},
+		{VulnerabilityEvent{Kind: KindSecret, CVE: "aws-access-key-id"}, "aws-access-key-id"},
+		{VulnerabilityEvent{Kind: KindCompliance, CVE: "KSV014", Title: "Root file system is not read-only"}, "KSV014: Root file system is not read-only"},
+		{VulnerabilityEvent{Kind: KindCompliance, CVE: "KSV014"}, "KSV014"},
+	}
+	for _, tt := range tests {
+		if got := findingText(tt.event); got != tt.want {
+			t.Errorf("findingText(%+v) = %q, want %q", tt.event, got, tt.want)
+		}
+	}
+}
+
+func TestWording(t *testing.T) {
+	vuln := VulnerabilityEvent{Type: "NEW", Kind: KindVulnerability}
+	legacy := VulnerabilityEvent{Type: "NEW"}
+	secret := VulnerabilityEvent{Type: "NEW", Kind: KindSecret}
+	check := VulnerabilityEvent{Type: "FIXED", Kind: KindCompliance}
+
+	tests := []struct {
+		events []VulnerabilityEvent
+		want   string
+	}{
+		{nil, "vulnerabilities"},
+		{[]VulnerabilityEvent{vuln, legacy}, "vulnerabilities"},
+		{[]VulnerabilityEvent{secret, secret}, "exposed secrets"},
+		{[]VulnerabilityEvent{check}, "misconfigurations"},
+		{[]VulnerabilityEvent{vuln, secret}, "findings"},
+	}
+	for _, tt := range tests {
+		if got := wording(tt.events).plural; got != tt.want {
+			t.Errorf("wording(%v) = %q, want %q", tt.events, got, tt.want)
+		}
+	}
+}
+
+// Notifications name findings by kind
+func TestKindFormatting(t *testing.T) {
+	secret := VulnerabilityEvent{ID: "s1", Type: "NEW", Kind: KindSecret, CVE: "aws-access-key-id", Title: "AWS Access Key ID",
+		Workload: "payments/Deployment/api", Severity: "CRITICAL", Image: "/app/config.env"}
+	check := VulnerabilityEvent{ID: "c1", Type: "FIXED", Kind: KindCompliance, CVE: "KSV014", Title: "Root file system is not read-only",
+		Workload: "payments/Deployment/api", Severity: "HIGH"}
+
+	if got := eventsSubject([]VulnerabilityEvent{secret}); got != "1 new exposed secrets" {
+		t.Errorf("secret subject = %q", got)
+	}
+	if got := eventsSubject([]VulnerabilityEvent{secret, check}); got != "1 new, 1 fixed findings" {
+		t.Errorf("mixed subject = %q", got)
+	}
+
+	text, _ := emailEventsBody([]VulnerabilityEvent{secret, check})
+	for _, want := range []string{
+		"New exposed secrets (1)\n",
+		"    - CRITICAL AWS Access Key ID (aws-access-key-id) (/app/config.env)\n",
+		"Fixed misconfigurations (1)\n",
+		"  payments/Deployment/api: 1 checks\n",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("email lacks %q:\n%s", want, text)
+		}
+	}
+
+	card := string(teamsJSON(t, teamsPayload([]VulnerabilityEvent{secret})))
+	if !strings.Contains(card, "New Exposed Secrets (1)") {
+		t.Errorf("Teams card:\n%s", card)
+	}
+}
+
+func testKinds(t *testing.T, s Store) {
+	ctx := context.Background()
+	for _, kind := range []string{KindVulnerability, KindSecret, KindCompliance} {
+		v := storeRecord(kind, "payments", kind, "HIGH")
+		v.Title = "title of " + kind
+		mustUpsert(t, s, v)
+
+		got := mustGet(t, s, kind)
+		if got.Kind != kind || got.Title != v.Title || got.CVE != v.CVE {
+			t.Errorf("%s round trip = %+v", kind, got)
+		}
+	}
+
+	open, err := s.GetOpenVulnerabilities(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(open) != 3 {
+		t.Errorf("%d open findings, want one per kind", len(open))
+	}
+
+	// Each kind is reconciled on its own
+	fixed, err := s.MarkFixed(ctx, nil, []string{KindSecret, KindCompliance}, []string{KindCompliance})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := recordIDs(fixed); !reflect.DeepEqual(ids, []string{KindSecret}) || fixed[0].Kind != KindSecret {
+		t.Errorf("fixed = %v, want the secret", ids)
+	}
+	if v := mustGet(t, s, KindVulnerability); v.State != StateOpen {
+		t.Errorf("vulnerability state = %s after reconciling other kinds", v.State)
+	}
+}
+
+// Secrets are stored under Trivy's lowercase rule IDs; the cve filter
+// matches them, and CVEs, regardless of case
+func testFilterByFindingID(t *testing.T, s Store) {
+	ctx := context.Background()
+	secret := storeRecord("secret", "payments", KindSecret, "CRITICAL")
+	secret.CVE = "aws-access-key-id"
+	mustUpsert(t, s, secret)
+	mustUpsert(t, s, storeRecord("vuln", "payments", KindVulnerability, "HIGH"))
+
+	for _, tt := range []struct {
+		cve  string
+		want []string
+	}{
+		{"aws-access-key-id", []string{"secret"}},
+		{"AWS-ACCESS-KEY-ID", []string{"secret"}},
+		{"cve-2024-vuln", []string{"vuln"}},
+		{"CVE-2024-vuln", []string{"vuln"}},
+		{"github-pat", []string{}},
+	} {
+		vulns, total, err := s.ListVulnerabilities(ctx, VulnerabilityFilter{CVE: tt.cve})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ids := recordIDs(vulns); !reflect.DeepEqual(ids, tt.want) || total != len(tt.want) {
+			t.Errorf("cve=%s: %v (total %d), want %v", tt.cve, ids, total, tt.want)
+		}
+	}
+}
@@ -0,0 +1,481 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	githubMaxRetries   = 3
+	githubDefaultRetry = time.Minute // Wait when GitHub rate-limits without saying how long
+	githubLabel        = "trix"
+)
+
+// Colors of the labels trix creates when they are missing
+var githubLabelColors = map[string]string{
+	"CRITICAL": "b60205",
+	"HIGH":     "d93f0b",
+	"MEDIUM":   "fbca04",
+	"LOW":      "c5def5",
+}
+
+// githubIssueKey groups events filed as one issue
+type githubIssueKey struct {
+	CVE      string
+	Workload string
+}
+
+// notifyGitHub files an issue for each new vulnerability at or above
+// TRIX_GITHUB_SEVERITY and closes it once every row it covers is fixed.
+// Issues are keyed by CVE and workload, so several packages or containers
+// affected by the same CVE share one issue. It returns the events whose
+// issue could not be updated.
+func (n *Notifier) notifyGitHub(ctx context.Context, events []VulnerabilityEvent) ([]VulnerabilityEvent, error) {
+	minLevel := severityLevel(n.config.GitHubMinSeverity)
+
+	// Issues are filed per CVE; secrets and config checks are not
+	var vulns []VulnerabilityEvent
+	for _, e := range events {
+		if e.kind() == KindVulnerability {
+			vulns = append(vulns, e)
+		}
+	}
+	events = vulns
+
+	var failed []VulnerabilityEvent
+	var errs []error
+	for _, group := range groupByIssue(filterByType(events, "NEW")) {
+		if severityLevel(group[0].Severity) > minLevel {
+			continue
+		}
+		if err := n.openGitHubIssue(ctx, group); err != nil {
+			failed = append(failed, group...)
+			errs = append(errs, fmt.Errorf("%s in %s: %w", group[0].CVE, group[0].Workload, err))
+		}
+	}
+	// A rescored vulnerability gets an issue once it reaches the threshold
+	for _, group := range groupByIssue(filterByType(events, "SEVERITY_CHANGED")) {
+		e := group[0]
+		if severityLevel(e.Severity) > minLevel || severityLevel(e.OldSeverity) <= minLevel {
+			continue
+		}
+		number, err := n.store.GetGitHubIssue(ctx, e.CVE, e.Workload)
+		if err == nil && number == 0 {
+			err = n.openGitHubIssue(ctx, group)
+		}
+		if err != nil {
+			failed = append(failed, group...)
+			errs = append(errs, fmt.Errorf("%s in %s: %w", e.CVE, e.Workload, err))
+		}
+	}
+	for _, group := range groupByIssue(filterByType(events, "FIXED")) {
+		if err := n.closeGitHubIssue(ctx, group[0]); err != nil {
+			failed = append(failed, group...)
+			errs = append(errs, fmt.Errorf("%s in %s: %w", group[0].CVE, group[0].Workload, err))
+		}
+	}
+	return failed, errors.Join(errs...)
+}
+
+// groupByIssue groups events by CVE and workload, most severe event first in
+// each group, in a stable order.
+func groupByIssue(events []VulnerabilityEvent) [][]VulnerabilityEvent {
+	grouped := make(map[githubIssueKey][]VulnerabilityEvent)
+	var keys []githubIssueKey
+	for _, e := range events {
+		key := githubIssueKey{CVE: e.CVE, Workload: e.Workload}
+		if _, ok := grouped[key]; !ok {
+			keys = append(keys, key)
+		}
+		grouped[key] = append(grouped[key], e)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Workload != keys[j].Workload {
+			return keys[i].Workload < keys[j].Workload
+		}
+		return keys[i].CVE < keys[j].CVE
+	})
+
+	groups := make([][]VulnerabilityEvent, 0, len(keys))
+	for _, key := range keys {
+		group := grouped[key]
+		sort.SliceStable(group, func(i, j int) bool {
+			return severityLevel(group[i].Severity) < severityLevel(group[j].Severity)
+		})
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// openGitHubIssue creates the issue for a CVE in a workload, or reopens the
+// one filed earlier if the vulnerability came back.
+func (n *Notifier) openGitHubIssue(ctx context.Context, group []VulnerabilityEvent) error {
+	e := group[0]
+	number, err := n.store.GetGitHubIssue(ctx, e.CVE, e.Workload)
+	if err != nil {
+		return fmt.Errorf("lookup issue: %w", err)
+	}
+
+	if number > 0 {
+		// The issue is still open if rows outside this group are
+		_, open, err := n.store.ListVulnerabilities(ctx, VulnerabilityFilter{
+			State:    StateOpen,
+			CVE:      e.CVE,
+			Workload: e.Workload,
+			Limit:    1,
+		})
+		if err != nil {
+			return fmt.Errorf("check open vulnerabilities: %w", err)
+		}
+		if open > len(group) {
+			return nil
+		}
+
+		if err := n.githubComment(ctx, number, fmt.Sprintf("Reported again by Trivy at %s.", time.Now().UTC().Format(time.RFC3339))); err != nil {
+			return err
+		}
+		if err := n.githubRequest(ctx, http.MethodPatch, n.githubIssuePath(number), map[string]interface{}{"state": "open"}, nil); err != nil {
+			return fmt.Errorf("reopen issue #%d: %w", number, err)
+		}
+		n.logger.Info("reopened github issue", "issue", number, "cve", e.CVE, "workload", e.Workload)
+		return nil
+	}
+
+	labels, err := n.githubLabels(ctx, e)
+	if err != nil {
+		return err
+	}
+	var issue struct {
+		Number int `json:"number"`
+	}
+	if err := n.githubRequest(ctx, http.MethodPost, n.githubRepoPath("issues"), map[string]interface{}{
+		"title":  fmt.Sprintf("%s in %s", e.CVE, e.Workload),
+		"body":   n.githubIssueBody(group),
+		"labels": labels,
+	}, &issue); err != nil {
+		return fmt.Errorf("create issue: %w", err)
+	}
+
+	if err := n.store.SetGitHubIssue(ctx, e.CVE, e.Workload, issue.Number); err != nil {
+		return fmt.Errorf("record issue #%d: %w", issue.Number, err)
+	}
+	n.logger.Info("created github issue", "issue", issue.Number, "cve", e.CVE, "workload", e.Workload)
+	return nil
+}
+
+// closeGitHubIssue closes the issue for a CVE in a workload once none of its
+// rows are open any more.
+func (n *Notifier) closeGitHubIssue(ctx context.Context, e VulnerabilityEvent) error {
+	number, err := n.store.GetGitHubIssue(ctx, e.CVE, e.Workload)
+	if err != nil {
+		return fmt.Errorf("lookup issue: %w", err)
+	}
+	if number == 0 {
+		return nil
+	}
+
+	_, open, err := n.store.ListVulnerabilities(ctx, VulnerabilityFilter{
+		State:    StateOpen,
+		CVE:      e.CVE,
+		Workload: e.Workload,
+		Limit:    1,
+	})
+	if err != nil {
+		return fmt.Errorf("check open vulnerabilities: %w", err)
+	}
+	if open > 0 {
+		return nil
+	}
+
+	fixedAt := time.Now()
+	if e.FixedAt != nil {
+		fixedAt = *e.FixedAt
+	}
+	if err := n.githubComment(ctx, number, fmt.Sprintf("Fixed: no longer reported by Trivy as of %s.", fixedAt.UTC().Format(time.RFC3339))); err != nil {
+		return err
+	}
+	if err := n.githubRequest(ctx, http.MethodPatch, n.githubIssuePath(number), map[string]interface{}{
+		"state":        "closed",
+		"state_reason": "completed",
+	}, nil); err != nil {
+		return fmt.Errorf("close issue #%d: %w", number, err)
+	}
+	n.logger.Info("closed github issue", "issue", number, "cve", e.CVE, "workload", e.Workload)
+	return nil
+}
+
+func (n *Notifier) githubComment(ctx context.Context, number int, body string) error {
+	if err := n.githubRequest(ctx, http.MethodPost, n.githubIssuePath(number)+"/comments", map[string]interface{}{"body": body}, nil); err != nil {
+		return fmt.Errorf("comment on issue #%d: %w", number, err)
+	}
+	return nil
+}
+
+// githubIssueBody describes every affected package and container of the
+// group in a Markdown body.
+func (n *Notifier) githubIssueBody(group []VulnerabilityEvent) string {
+	e := group[0]
+
+	var b strings.Builder
+	cve := e.CVE
+	if strings.HasPrefix(cve, "CVE-") {
+		cve = fmt.Sprintf("[%s](https://nvd.nist.gov/vuln/detail/%s)", e.CVE, url.PathEscape(e.CVE))
+	}
+	fmt.Fprintf(&b, "**Vulnerability:** %s\n", cve)
+	fmt.Fprintf(&b, "**Severity:** %s\n", e.Severity)
+	fmt.Fprintf(&b, "**Workload:** `%s`\n", e.Workload)
+	if e.Exposure != "" {
+		fmt.Fprintf(&b, "**Exposure:** %s\n", e.Exposure)
+	}
+	if n.config.ClusterName != "" {
+		fmt.Fprintf(&b, "**Cluster:** %s\n", n.config.ClusterName)
+	}
+	fmt.Fprintf(&b, "**First seen:** %s\n\n", e.FirstSeen.UTC().Format(time.RFC3339))
+
+	b.WriteString("| Container | Image | Package | Installed | Fixed in |\n|---|---|---|---|---|\n")
+	for _, e := range group {
+		image := e.ImageRepository
+		if e.ImageTag != "" {
+			image += ":" + e.ImageTag
+		}
+		if e.ImageDigest != "" {
+			image += "@" + e.ImageDigest
+		}
+		pkg, version, _ := strings.Cut(e.Image, ":")
+		fmt.Fprintf(&b, "| %s | %s | %s | %s | %s |\n",
+			markdownCell(e.ContainerName), markdownCell(image), markdownCell(pkg), markdownCell(version), markdownCell(e.FixedVersion))
+	}
+
+	b.WriteString("\n_Filed by trix. This issue is closed automatically when the vulnerability is no longer reported._\n")
+	return b.String()
+}
+
+// markdownCell formats a value as a code span for a Markdown table cell
+func markdownCell(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return "`" + strings.ReplaceAll(s, "|", `\|`) + "`"
+}
+
+// githubLabels returns the labels for an issue, creating any that don't
+// exist in the repository yet.
+func (n *Notifier) githubLabels(ctx context.Context, e VulnerabilityEvent) ([]string, error) {
+	labels := map[string]string{
+		githubLabel: "5319e7",
+		"severity:" + strings.ToLower(e.Severity): githubLabelColors[strings.ToUpper(e.Severity)],
+	}
+	if namespace, _, _ := strings.Cut(e.Workload, "/"); namespace != "" {
+		labels["namespace:"+namespace] = "ededed"
+	}
+
+	names := make([]string, 0, len(labels))
+	for name, color := range labels {
+		if err := n.ensureGitHubLabel(ctx, name, color); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (n *Notifier) ensureGitHubLabel(ctx context.Context, name, color string) error {
+	n.githubMu.Lock()
+	known := n.githubKnownLabels[name]
+	n.githubMu.Unlock()
+	if known {
+		return nil
+	}
+
+	err := n.githubRequest(ctx, http.MethodGet, n.githubRepoPath("labels/"+url.PathEscape(name)), nil, nil)
+	var apiErr *githubError
+	if errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound {
+		if color == "" {
+			color = "ededed"
+		}
+		err = n.githubRequest(ctx, http.MethodPost, n.githubRepoPath("labels"), map[string]interface{}{
+			"name":  name,
+			"color": color,
+		}, nil)
+		// Another replica or poll may have created it in the meantime
+		if errors.As(err, &apiErr) && apiErr.Status == http.StatusUnprocessableEntity {
+			err = nil
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("label %q: %w", name, err)
+	}
+
+	n.githubMu.Lock()
+	n.githubKnownLabels[name] = true
+	n.githubMu.Unlock()
+	return nil
+}
+
+func (n *Notifier) githubRepoPath(path string) string {
+	return "/repos/" + n.config.GitHubRepo + "/" + path
+}
+
+func (n *Notifier) githubIssuePath(number int) string {
+	return n.githubRepoPath("issues/" + strconv.Itoa(number))
+}
+
+// githubError is a non-2xx response from the GitHub API
+type githubError struct {
+	Status  int
+	Message string
+}
+
+func (e *githubError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("status %d: %s", e.Status, e.Message)
+	}
+	return fmt.Sprintf("status %d", e.Status)
+}
+
+// githubRequest calls the GitHub REST API and decodes the response into out
+// (if not nil). Primary and secondary rate limits are retried after the wait
+// GitHub asks for, up to githubMaxRetries times.
+func (n *Notifier) githubRequest(ctx context.Context, method, path string, body, out interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return fmt.Errorf("marshal: %w", err)
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(n.config.GitHubAPIURL, "/")+path, bytes.NewReader(payload))
+		if err != nil {
+			return fmt.Errorf("create request: %w", err)
+		}
+		req.Header.Set("Accept", "application/vnd.github+json")
+		req.Header.Set("Authorization", "Bearer "+n.config.GitHubToken)
+		req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		resp, err := n.httpClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("request: %w", err)
+		}
+		data, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("read response: %w", err)
+		}
+
+		if resp.StatusCode < 300 {
+			if out != nil {
+				if err := json.Unmarshal(data, out); err != nil {
+					return fmt.Errorf("decode response: %w", err)
+				}
+			}
+			return nil
+		}
+
+		apiErr := &githubError{Status: resp.StatusCode}
+		var msg struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &msg) == nil {
+			apiErr.Message = msg.Message
+		}
+
+		wait, limited := githubRetryAfter(resp, apiErr.Message, attempt)
+		if !limited || attempt >= githubMaxRetries {
+			return apiErr
+		}
+		n.logger.Warn("github rate limit hit, backing off", "wait", wait, "attempt", attempt+1, "error", apiErr)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// githubRetryAfter reports whether a response is a rate limit and how long
+// to wait before retrying: Retry-After if given, else until X-RateLimit-Reset
+// when the primary limit is exhausted, else an exponential backoff starting
+// at one minute as GitHub recommends for secondary limits.
+func githubRetryAfter(resp *http.Response, message string, attempt int) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+
+	if v := resp.Header.Get("Retry-After"); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil {
+			return time.Duration(secs) * time.Second, true
+		}
+	}
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			return max(time.Until(time.Unix(reset, 0)), time.Second), true
+		}
+	}
+	// Any other 403 is a permission problem
+	if resp.StatusCode == http.StatusTooManyRequests || strings.Contains(strings.ToLower(message), "rate limit") {
+		return githubDefaultRetry << attempt, true
+	}
+	return 0, false
+}
+
+// GetGitHubIssue returns the GitHub issue filed for a CVE in a workload, or 0.
+func (db *DB) GetGitHubIssue(ctx context.Context, cve, workload string) (int, error) {
+	var number int
+	err := db.queryRow(ctx,
+		"SELECT COALESCE(MAX(github_issue), 0) FROM vulnerabilities WHERE cve = $1 AND workload = $2",
+		cve, workload,
+	).Scan(&number)
+	return number, err
+}
+
+// SetGitHubIssue records the GitHub issue on every row for a CVE in a workload.
+func (db *DB) SetGitHubIssue(ctx context.Context, cve, workload string, number int) error {
+	_, err := db.exec(ctx,
+		"UPDATE vulnerabilities SET github_issue = $1 WHERE cve = $2 AND workload = $3",
+		number, cve, workload,
+	)
+	return err
+}
+
+// GetGitHubIssue returns the GitHub issue filed for a CVE in a workload, or 0.
+func (m *MemoryStore) GetGitHubIssue(ctx context.Context, cve, workload string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	number := 0
+	for _, r := range m.vulns {
+		if r.CVE == cve && r.Workload == workload {
+			number = max(number, r.githubIssue)
+		}
+	}
+	return number, nil
+}
+
+// SetGitHubIssue records the GitHub issue on every row for a CVE in a workload.
+func (m *MemoryStore) SetGitHubIssue(ctx context.Context, cve, workload string, number int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, r := range m.vulns {
+		if r.CVE == cve && r.Workload == workload {
+			r.githubIssue = number
+		}
+	}
+	return nil
+}
@@ -0,0 +1,499 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// githubCall is a request received by the stub GitHub API
+type githubCall struct {
+	method string
+	path   string
+	header http.Header
+	body   map[string]interface{}
+}
+
+// githubStub serves the parts of the GitHub issues and labels API trix uses
+type githubStub struct {
+	mu      sync.Mutex
+	calls   []githubCall
+	labels  map[string]bool
+	issues  map[int]string // number -> state
+	next    int
+	failing int // Requests still to answer with fail
+	fail    func(w http.ResponseWriter)
+	deny    bool // Answer every request with a permission error
+}
+
+func newGitHubStub(t *testing.T) (*githubStub, *httptest.Server) {
+	t.Helper()
+	s := &githubStub{labels: map[string]bool{}, issues: map[int]string{}}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	return s, srv
+}
+
+func (s *githubStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	data, _ := io.ReadAll(r.Body)
+	var body map[string]interface{}
+	_ = json.Unmarshal(data, &body)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, githubCall{method: r.Method, path: r.URL.Path, header: r.Header.Clone(), body: body})
+
+	reply := func(status int, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(v)
+	}
+	if s.deny {
+		reply(http.StatusForbidden, map[string]string{"message": "Resource not accessible by integration"})
+		return
+	}
+	if s.failing > 0 {
+		s.failing--
+		s.fail(w)
+		return
+	}
+
+	const repo = "/repos/acme/app/"
+	path, ok := strings.CutPrefix(r.URL.Path, repo)
+	if !ok {
+		reply(http.StatusNotFound, map[string]string{"message": "Not Found"})
+		return
+	}
+	switch {
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "labels/"):
+		if !s.labels[strings.TrimPrefix(path, "labels/")] {
+			reply(http.StatusNotFound, map[string]string{"message": "Not Found"})
+			return
+		}
+		reply(http.StatusOK, map[string]string{"name": strings.TrimPrefix(path, "labels/")})
+	case r.Method == http.MethodPost && path == "labels":
+		name, _ := body["name"].(string)
+		if s.labels[name] {
+			reply(http.StatusUnprocessableEntity, map[string]string{"message": "Validation Failed"})
+			return
+		}
+		s.labels[name] = true
+		reply(http.StatusCreated, body)
+	case r.Method == http.MethodPost && path == "issues":
+		s.next++
+		s.issues[s.next] = "open"
+		reply(http.StatusCreated, map[string]int{"number": s.next})
+	case r.Method == http.MethodPost && strings.HasSuffix(path, "/comments"):
+		reply(http.StatusCreated, map[string]int{"id": 1})
+	case r.Method == http.MethodPatch && strings.HasPrefix(path, "issues/"):
+		number, _ := strconv.Atoi(strings.TrimPrefix(path, "issues/"))
+		if _, ok := s.issues[number]; !ok {
+			reply(http.StatusNotFound, map[string]string{"message": "Not Found"})
+			return
+		}
+		if state, ok := body["state"].(string); ok {
+			s.issues[number] = state
+		}
+		reply(http.StatusOK, map[string]int{"number": number})
+	default:
+		reply(http.StatusNotFound, map[string]string{"message": "Not Found"})
+	}
+}
+
+// take returns the calls received since the last take
+func (s *githubStub) take() []githubCall {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	calls := s.calls
+	s.calls = nil
+	return calls
+}
+
+func (s *githubStub) state(number int) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.issues[number]
+}
+
+// callsTo returns "METHOD path" for each call, in order
+func callsTo(calls []githubCall) []string {
+	out := make([]string, len(calls))
+	for i, c := range calls {
+		out[i] = c.method + " " + c.path
+	}
+	return out
+}
+
+// githubRecord is an open vulnerability row for the GitHub tests
+func githubRecord(id, cve, workload, severity, pkg string) *VulnerabilityRecord {
+	namespace, _, _ := strings.Cut(workload, "/")
+	return &VulnerabilityRecord{
+		ID:              id,
+		Kind:            KindVulnerability,
+		CVE:             cve,
+		Workload:        workload,
+		Namespace:       namespace,
+		Severity:        severity,
+		Image:           pkg,
+		ContainerName:   "app",
+		ImageRepository: "example/app",
+		ImageTag:        "1.0",
+		FixedVersion:    "9.9",
+	}
+}
+
+// githubNotifier returns a notifier filing issues in the stub, and its store
+func githubNotifier(t *testing.T, srv *httptest.Server) (*Notifier, *MemoryStore) {
+	t.Helper()
+	store := NewMemoryStore()
+	cfg := testConfig(t, map[string]string{
+		"TRIX_NOTIFY_GITHUB_REPO": "acme/app",
+		"TRIX_GITHUB_TOKEN":       "ghp_test",
+		"TRIX_GITHUB_API_URL":     srv.URL + "/",
+	})
+	return NewNotifier(cfg, store, testLogger()), store
+}
+
+// seed stores the records and returns their NEW events
+func seed(t *testing.T, store *MemoryStore, records ...*VulnerabilityRecord) []VulnerabilityEvent {
+	t.Helper()
+	var events []VulnerabilityEvent
+	for _, r := range records {
+		if _, err := store.UpsertVulnerability(context.Background(), r); err != nil {
+			t.Fatal(err)
+		}
+		stored, err := store.GetVulnerability(context.Background(), r.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, recordEvent("NEW", stored))
+	}
+	return events
+}
+
+func TestGitHubIssueLifecycle(t *testing.T) {
+	stub, srv := newGitHubStub(t)
+	n, store := githubNotifier(t, srv)
+	ctx := context.Background()
+
+	// Two packages hit by the same CVE in one workload share an issue
+	events := seed(t, store,
+		githubRecord("a1", "CVE-2024-0001", "prod/deployment/api", "CRITICAL", "openssl:3.0.1"),
+		githubRecord("a2", "CVE-2024-0001", "prod/deployment/api", "HIGH", "libssl:3.0.1"),
+		githubRecord("low", "CVE-2024-0002", "prod/deployment/api", "LOW", "zlib:1.2"),
+	)
+	if res := n.Deliver(ctx, channelGitHub, events); res.Err != nil {
+		t.Fatalf("Deliver: %v", res.Err)
+	}
+
+	calls := stub.take()
+	var create *githubCall
+	for i, c := range calls {
+		if got := c.header.Get("Authorization"); got != "Bearer ghp_test" {
+			t.Errorf("%s %s Authorization = %q", c.method, c.path, got)
+		}
+		if got := c.header.Get("Accept"); got != "application/vnd.github+json" {
+			t.Errorf("%s %s Accept = %q", c.method, c.path, got)
+		}
+		if c.method == http.MethodPost && c.path == "/repos/acme/app/issues" {
+			if create != nil {
+				t.Fatalf("created more than one issue: %v", callsTo(calls))
+			}
+			create = &calls[i]
+		}
+	}
+	if create == nil {
+		t.Fatalf("no issue created: %v", callsTo(calls))
+	}
+	if got := create.body["title"]; got != "CVE-2024-0001 in prod/deployment/api" {
+		t.Errorf("title = %v", got)
+	}
+	if got := fmt.Sprint(create.body["labels"]); got != "[namespace:prod severity:critical trix]" {
+		t.Errorf("labels = %s", got)
+	}
+	body, _ := create.body["body"].(string)
+	for _, want := range []string{
+		"[CVE-2024-0001](https://nvd.nist.gov/vuln/detail/CVE-2024-0001)",
+		"**Severity:** CRITICAL",
+		"| `app` | `example/app:1.0` | `openssl` | `3.0.1` | `9.9` |",
+		"| `app` | `example/app:1.0` | `libssl` | `3.0.1` | `9.9` |",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("issue body lacks %q:\n%s", want, body)
+		}
+	}
+	if number, _ := store.GetGitHubIssue(ctx, "CVE-2024-0001", "prod/deployment/api"); number != 1 {
+		t.Errorf("stored issue = %d, want 1", number)
+	}
+
+	// A new container with the same CVE in a later poll doesn't file another
+	more := seed(t, store, githubRecord("a3", "CVE-2024-0001", "prod/deployment/api", "CRITICAL", "openssl:3.0.1"))
+	if res := n.Deliver(ctx, channelGitHub, more); res.Err != nil {
+		t.Fatalf("Deliver: %v", res.Err)
+	}
+	if calls := stub.take(); len(calls) != 0 {
+		t.Errorf("duplicate NEW made requests: %v", callsTo(calls))
+	}
+
+	// The issue stays open while any of its rows are
+	fixed, err := store.MarkFixed(ctx, nil, nil, []string{"a2", "a3", "low"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res := n.Deliver(ctx, channelGitHub, fixedEvents(fixed)); res.Err != nil {
+		t.Fatalf("Deliver: %v", res.Err)
+	}
+	if calls := stub.take(); len(calls) != 0 {
+		t.Errorf("partial fix made requests: %v", callsTo(calls))
+	}
+
+	fixed, err = store.MarkFixed(ctx, nil, nil, []string{"low"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res := n.Deliver(ctx, channelGitHub, fixedEvents(fixed)); res.Err != nil {
+		t.Fatalf("Deliver: %v", res.Err)
+	}
+	calls = stub.take()
+	want := []string{"POST /repos/acme/app/issues/1/comments", "PATCH /repos/acme/app/issues/1"}
+	if got := callsTo(calls); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("close calls = %v, want %v", got, want)
+	}
+	if calls[1].body["state_reason"] != "completed" || stub.state(1) != "closed" {
+		t.Errorf("close = %v, issue state %q", calls[1].body, stub.state(1))
+	}
+
+	// The vulnerability comes back: reopen instead of filing again
+	again := seed(t, store, githubRecord("a1", "CVE-2024-0001", "prod/deployment/api", "CRITICAL", "openssl:3.0.1"))
+	if res := n.Deliver(ctx, channelGitHub, again); res.Err != nil {
+		t.Fatalf("Deliver: %v", res.Err)
+	}
+	if got := callsTo(stub.take()); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("reopen calls = %v, want %v", got, want)
+	}
+	if stub.state(1) != "open" {
+		t.Errorf("issue state = %q after reopen, want open", stub.state(1))
+	}
+}
+
+func fixedEvents(records []VulnerabilityRecord) []VulnerabilityEvent {
+	events := make([]VulnerabilityEvent, len(records))
+	for i := range records {
+		events[i] = recordEvent("FIXED", &records[i])
+	}
+	return events
+}
+
+func TestGitHubLabels(t *testing.T) {
+	stub, srv := newGitHubStub(t)
+	stub.labels["trix"] = true
+	n, store := githubNotifier(t, srv)
+	ctx := context.Background()
+
+	events := seed(t, store, githubRecord("a1", "CVE-2024-0001", "prod/deployment/api", "HIGH", "openssl:3.0.1"))
+	if res := n.Deliver(ctx, channelGitHub, events); res.Err != nil {
+		t.Fatalf("Deliver: %v", res.Err)
+	}
+	created := map[string]string{}
+	for _, c := range stub.take() {
+		if c.method == http.MethodPost && c.path == "/repos/acme/app/labels" {
+			created[c.body["name"].(string)] = c.body["color"].(string)
+		}
+	}
+	want := map[string]string{"severity:high": "d93f0b", "namespace:prod": "ededed"}
+	if fmt.Sprint(created) != fmt.Sprint(want) {
+		t.Errorf("created labels = %v, want %v", created, want)
+	}
+
+	// Known labels are not looked up again
+	events = seed(t, store, githubRecord("b1", "CVE-2024-0009", "prod/deployment/web", "HIGH", "curl:8.0"))
+	if res := n.Deliver(ctx, channelGitHub, events); res.Err != nil {
+		t.Fatalf("Deliver: %v", res.Err)
+	}
+	if got := callsTo(stub.take()); fmt.Sprint(got) != "[POST /repos/acme/app/issues]" {
+		t.Errorf("second issue calls = %v, want only the create", got)
+	}
+}
+
+// A label created by someone else between lookup and create is fine
+func TestGitHubLabelCreateConflict(t *testing.T) {
+	stub, srv := newGitHubStub(t)
+	n, store := githubNotifier(t, srv)
+
+	// Every lookup misses, every create conflicts
+	stub.labels = map[string]bool{"trix": true, "severity:critical": true, "namespace:prod": true}
+	stub.fail = func(w http.ResponseWriter) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = io.WriteString(w, `{"message":"Not Found"}`)
+	}
+	stub.failing = 1 // First lookup only
+	events := seed(t, store, githubRecord("a1", "CVE-2024-0001", "prod/deployment/api", "CRITICAL", "openssl:3.0.1"))
+	if res := n.Deliver(context.Background(), channelGitHub, events); res.Err != nil {
+		t.Fatalf("Deliver: %v", res.Err)
+	}
+	if number, _ := store.GetGitHubIssue(context.Background(), "CVE-2024-0001", "prod/deployment/api"); number != 1 {
+		t.Errorf("stored issue = %d, want 1", number)
+	}
+}
+
+func TestGitHubSeverityAndKinds(t *testing.T) {
+	stub, srv := newGitHubStub(t)
+	n, store := githubNotifier(t, srv)
+	ctx := context.Background()
+
+	secret := githubRecord("s1", "aws-access-key-id", "prod/deployment/api", "CRITICAL", "app/.env")
+	secret.Kind = KindSecret
+	events := seed(t, store,
+		githubRecord("m1", "CVE-2024-0003", "prod/deployment/api", "MEDIUM", "zlib:1.2"),
+		secret,
+	)
+	// Rescored below the threshold stays quiet, rescored to it files an issue
+	events = append(events,
+		VulnerabilityEvent{Type: "SEVERITY_CHANGED", Kind: KindVulnerability, CVE: "CVE-2024-0004", Workload: "prod/deployment/api", Severity: "MEDIUM", OldSeverity: "LOW"},
+		VulnerabilityEvent{Type: "SEVERITY_CHANGED", Kind: KindVulnerability, CVE: "CVE-2024-0003", Workload: "prod/deployment/api", Severity: "HIGH", OldSeverity: "MEDIUM"},
+	)
+	if res := n.Deliver(ctx, channelGitHub, events); res.Err != nil {
+		t.Fatalf("Deliver: %v", res.Err)
+	}
+
+	var titles []string
+	for _, c := range stub.take() {
+		if c.method == http.MethodPost && c.path == "/repos/acme/app/issues" {
+			titles = append(titles, c.body["title"].(string))
+		}
+	}
+	if fmt.Sprint(titles) != "[CVE-2024-0003 in prod/deployment/api]" {
+		t.Errorf("issues = %v, want only the one rescored to HIGH", titles)
+	}
+}
+
+func TestGitHubRateLimitRetry(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit func(w http.ResponseWriter)
+	}{
+		{"secondary", func(w http.ResponseWriter) {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = io.WriteString(w, `{"message":"You have exceeded a secondary rate limit"}`)
+		}},
+		{"too many requests", func(w http.ResponseWriter) {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}},
+		{"primary", func(w http.ResponseWriter) {
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Unix(), 10))
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = io.WriteString(w, `{"message":"API rate limit exceeded"}`)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub, srv := newGitHubStub(t)
+			stub.labels = map[string]bool{"trix": true, "severity:critical": true, "namespace:prod": true}
+			stub.fail = tt.limit
+			stub.failing = 2
+			n, store := githubNotifier(t, srv)
+
+			events := seed(t, store, githubRecord("a1", "CVE-2024-0001", "prod/deployment/api", "CRITICAL", "openssl:3.0.1"))
+			if res := n.Deliver(context.Background(), channelGitHub, events); res.Err != nil {
+				t.Fatalf("Deliver: %v", res.Err)
+			}
+			if got := len(stub.take()); got != 2+4 {
+				t.Errorf("requests = %d, want 2 limited + 3 label lookups + 1 create", got)
+			}
+		})
+	}
+}
+
+func TestGitHubRateLimitGivesUp(t *testing.T) {
+	stub, srv := newGitHubStub(t)
+	stub.fail = func(w http.ResponseWriter) {
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}
+	stub.failing = 100
+	n, store := githubNotifier(t, srv)
+
+	events := seed(t, store, githubRecord("a1", "CVE-2024-0001", "prod/deployment/api", "CRITICAL", "openssl:3.0.1"))
+	res := n.Deliver(context.Background(), channelGitHub, events)
+	if res.Err == nil || !strings.Contains(res.Err.Error(), "status 429") {
+		t.Errorf("err = %v, want status 429", res.Err)
+	}
+	if got := len(stub.take()); got != githubMaxRetries+1 {
+		t.Errorf("requests = %d, want %d", got, githubMaxRetries+1)
+	}
+	if len(res.Failed) != 1 {
+		t.Errorf("failed = %d events, want 1", len(res.Failed))
+	}
+}
+
+// A 403 that isn't a rate limit is a permission problem, not retried
+func TestGitHubForbiddenNotRetried(t *testing.T) {
+	stub, srv := newGitHubStub(t)
+	stub.deny = true
+	n, store := githubNotifier(t, srv)
+
+	events := seed(t, store, githubRecord("a1", "CVE-2024-0001", "prod/deployment/api", "CRITICAL", "openssl:3.0.1"))
+	res := n.Deliver(context.Background(), channelGitHub, events)
+	if res.Err == nil || !strings.Contains(res.Err.Error(), "Resource not accessible") {
+		t.Errorf("err = %v, want the permission error", res.Err)
+	}
+	if got := len(stub.take()); got != 1 {
+		t.Errorf("requests = %d, want 1", got)
+	}
+}
+
+func TestGitHubRetryAfter(t *testing.T) {
+	reset := time.Now().Add(30 * time.Second).Unix()
+	tests := []struct {
+		name    string
+		status  int
+		header  map[string]string
+		message string
+		attempt int
+		want    time.Duration // Upper bound when reset is used
+		limited bool
+	}{
+		{"retry after", http.StatusForbidden, map[string]string{"Retry-After": "7"}, "", 0, 7 * time.Second, true},
+		{"429 retry after", http.StatusTooManyRequests, map[string]string{"Retry-After": "3"}, "", 2, 3 * time.Second, true},
+		{"primary reset", http.StatusForbidden, map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": strconv.FormatInt(reset, 10)}, "", 0, 30 * time.Second, true},
+		{"primary reset passed", http.StatusForbidden, map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": "1"}, "", 0, time.Second, true},
+		{"secondary backoff", http.StatusForbidden, nil, "You have exceeded a secondary rate limit", 0, time.Minute, true},
+		{"secondary backoff doubles", http.StatusForbidden, nil, "secondary rate limit", 2, 4 * time.Minute, true},
+		{"429 without hints", http.StatusTooManyRequests, nil, "", 1, 2 * time.Minute, true},
+		{"permission", http.StatusForbidden, nil, "Resource not accessible by integration", 0, 0, false},
+		{"remaining left", http.StatusForbidden, map[string]string{"X-RateLimit-Remaining": "10"}, "", 0, 0, false},
+		{"server error", http.StatusInternalServerError, map[string]string{"Retry-After": "5"}, "", 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, Header: http.Header{}}
+			for k, v := range tt.header {
+				resp.Header.Set(k, v)
+			}
+			wait, limited := githubRetryAfter(resp, tt.message, tt.attempt)
+			if limited != tt.limited {
+				t.Fatalf("limited = %v, want %v", limited, tt.limited)
+			}
+			if tt.name == "primary reset" {
+				if wait <= 20*time.Second || wait > tt.want {
+					t.Errorf("wait = %s, want about %s", wait, tt.want)
+				}
+				return
+			}
+			if wait != tt.want {
+				t.Errorf("wait = %s, want %s", wait, tt.want)
+			}
+		})
+	}
+}
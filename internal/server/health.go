@@ -0,0 +1,161 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// healthTimeout bounds the database queries of the health endpoints
+const healthTimeout = 2 * time.Second
+
+// staleAfter is how many poll intervals may pass without a successful poll
+// before /readyz fails
+const staleAfter = 3
+
+// HealthStatus is the body of /healthz and /readyz for requests that accept
+// application/json. Others get the status as plain text.
+type HealthStatus struct {
+	Status              string     `json:"status"`
+	Database            string     `json:"database"`                  // ok, or why the ping failed
+	LastPoll            *time.Time `json:"lastPoll"`                  // Last successful poll, null before the first
+	LastPollError       string     `json:"lastPollError,omitempty"`   // Error of the last poll, if it failed
+	LastPollErrorAt     *time.Time `json:"lastPollErrorAt,omitempty"` // When the last poll failed
+	FailedPolls         int64      `json:"failedPolls"`               // Consecutive failed polls
+	OpenVulnerabilities int        `json:"openVulnerabilities"`
+	DeliveriesPending   int        `json:"deliveriesPending"` // Failed notifications waiting for a retry
+}
+
+// pollFailure is the error of the last poll
+type pollFailure struct {
+	at  time.Time
+	err string
+}
+
+// recordPoll tracks the outcome of a poll for the health endpoints.
+func (s *Server) recordPoll(err error) {
+	now := time.Now()
+	if err != nil {
+		s.pollErr.Store(&pollFailure{at: now, err: err.Error()})
+		s.failedPolls.Add(1)
+		return
+	}
+	s.lastPoll.Store(&now)
+	s.pollErr.Store(nil)
+	s.failedPolls.Store(0)
+}
+
+// handleHealthz reports whether the database answers a ping. Kubernetes
+// restarts the pod when it keeps failing.
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthTimeout)
+	defer cancel()
+
+	if wantsJSON(r) {
+		h := s.healthStatus(ctx, "ok")
+		code := http.StatusOK
+		if h.Database != "ok" {
+			h.Status, code = "database unreachable", http.StatusServiceUnavailable
+		}
+		writeJSON(w, code, h)
+		return
+	}
+
+	if err := s.db.Ping(ctx); err != nil {
+		s.logger.Warn("health check: database ping failed", "error", err)
+		writeText(w, http.StatusServiceUnavailable, "database unreachable")
+		return
+	}
+	writeText(w, http.StatusOK, "ok")
+}
+
+// handleReadyz reports whether the server is ready: polling and not behind,
+// or standing by for leadership.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	code, status := s.readiness(time.Now())
+	if !wantsJSON(r) {
+		writeText(w, code, status)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), healthTimeout)
+	defer cancel()
+	writeJSON(w, code, s.healthStatus(ctx, status))
+}
+
+// readiness returns the /readyz status code and text.
+func (s *Server) readiness(now time.Time) (int, string) {
+	switch {
+	case s.stopping.Load():
+		return http.StatusServiceUnavailable, "shutting down"
+	case s.config.LeaderElection && !s.leading.Load():
+		// Standby replicas serve the API, so they are ready too
+		return http.StatusOK, "standby"
+	case !s.ready.Load():
+		return http.StatusServiceUnavailable, "not ready"
+	case s.pollStale(now):
+		return http.StatusServiceUnavailable, "stale"
+	case s.config.LeaderElection:
+		return http.StatusOK, "leading"
+	default:
+		return http.StatusOK, "ok"
+	}
+}
+
+// pollStale reports whether no poll succeeded within staleAfter poll
+// intervals, counted from the start of the poll loop before the first.
+func (s *Server) pollStale(now time.Time) bool {
+	var since time.Time
+	if t := s.pollingSince.Load(); t != nil {
+		since = *t
+	}
+	if t := s.lastPoll.Load(); t != nil && t.After(since) {
+		since = *t
+	}
+	if since.IsZero() {
+		return false
+	}
+	return now.Sub(since) > staleAfter*s.config.pollInterval()
+}
+
+// healthStatus collects the JSON health body. Query failures are reported
+// in Database rather than failing the request.
+func (s *Server) healthStatus(ctx context.Context, status string) HealthStatus {
+	h := HealthStatus{
+		Status:      status,
+		Database:    "ok",
+		LastPoll:    s.lastPoll.Load(),
+		FailedPolls: s.failedPolls.Load(),
+	}
+	if f := s.pollErr.Load(); f != nil {
+		h.LastPollError = f.err
+		h.LastPollErrorAt = &f.at
+	}
+
+	if err := s.db.Ping(ctx); err != nil {
+		h.Database = err.Error()
+		return h
+	}
+	if stats, err := s.db.GetStats(ctx, 0); err != nil {
+		h.Database = err.Error()
+	} else {
+		h.OpenVulnerabilities = stats.TotalOpen
+	}
+	if deliveries, err := s.db.GetDeliveryStats(ctx, s.config.DeliveryMaxAttempts); err != nil {
+		h.Database = err.Error()
+	} else {
+		h.DeliveriesPending = deliveries.Pending
+	}
+	return h
+}
+
+// wantsJSON reports whether the request accepts a JSON response
+func wantsJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+func writeText(w http.ResponseWriter, status int, text string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(text))
+}
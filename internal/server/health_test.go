@@ -0,0 +1,202 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// downStore is a store whose database does not answer
+type downStore struct {
+	Store
+}
+
+func (downStore) Ping(context.Context) error {
+	return errors.New("dial tcp: connection refused")
+}
+
+// getHealth requests path from s, as JSON when json is set
+func getHealth(t *testing.T, s *Server, path string, json bool) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if json {
+		req.Header.Set("Accept", "application/json")
+	}
+	rec := httptest.NewRecorder()
+	s.handler().ServeHTTP(rec, req)
+	return rec
+}
+
+func decodeHealth(t *testing.T, rec *httptest.ResponseRecorder) HealthStatus {
+	t.Helper()
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Fatalf("Content-Type = %q, want JSON", ct)
+	}
+	var h HealthStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &h); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+	return h
+}
+
+func TestHealthz(t *testing.T) {
+	up := testServer(t, NewMemoryStore(), nil)
+	down := testServer(t, downStore{NewMemoryStore()}, nil)
+
+	tests := []struct {
+		name     string
+		s        *Server
+		wantCode int
+		wantBody string
+	}{
+		{"database up", up, http.StatusOK, "ok"},
+		{"database down", down, http.StatusServiceUnavailable, "database unreachable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := getHealth(t, tt.s, "/healthz", false)
+			if rec.Code != tt.wantCode || rec.Body.String() != tt.wantBody {
+				t.Errorf("/healthz = %d %q, want %d %q", rec.Code, rec.Body, tt.wantCode, tt.wantBody)
+			}
+			if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+				t.Errorf("Content-Type = %q, want plain text", ct)
+			}
+
+			rec = getHealth(t, tt.s, "/healthz", true)
+			if rec.Code != tt.wantCode {
+				t.Errorf("JSON /healthz = %d, want %d", rec.Code, tt.wantCode)
+			}
+			h := decodeHealth(t, rec)
+			if tt.wantCode == http.StatusOK && (h.Status != "ok" || h.Database != "ok") {
+				t.Errorf("JSON /healthz = %+v, want ok", h)
+			}
+			if tt.wantCode != http.StatusOK && (h.Status != "database unreachable" || !strings.Contains(h.Database, "connection refused")) {
+				t.Errorf("JSON /healthz = %+v, want the ping error", h)
+			}
+		})
+	}
+}
+
+func TestReadinessStale(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	ago := func(d time.Duration) *time.Time {
+		t := now.Add(-d)
+		return &t
+	}
+
+	tests := []struct {
+		name         string
+		pollingSince *time.Time
+		lastPoll     *time.Time
+		wantCode     int
+		wantStatus   string
+	}{
+		{"recent poll", ago(10 * time.Hour), ago(time.Hour), http.StatusOK, "ok"},
+		{"poll at the limit", ago(10 * time.Hour), ago(3 * time.Hour), http.StatusOK, "ok"},
+		{"poll too old", ago(10 * time.Hour), ago(3*time.Hour + time.Second), http.StatusServiceUnavailable, "stale"},
+		{"loop restarted recently", ago(time.Hour), ago(10 * time.Hour), http.StatusOK, "ok"},
+		{"no poll since the loop started", ago(4 * time.Hour), nil, http.StatusServiceUnavailable, "stale"},
+		{"loop not started", nil, nil, http.StatusOK, "ok"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := testServer(t, NewMemoryStore(), map[string]string{"TRIX_POLL_INTERVAL": "1h"})
+			s.ready.Store(true)
+			s.pollingSince.Store(tt.pollingSince)
+			s.lastPoll.Store(tt.lastPoll)
+			if code, status := s.readiness(now); code != tt.wantCode || status != tt.wantStatus {
+				t.Errorf("readiness = %d %s, want %d %s", code, status, tt.wantCode, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestReadyzJSON(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryStore()
+	mustUpsert(t, db, storeRecord("a", "team-a", KindVulnerability, "CRITICAL"))
+	mustUpsert(t, db, storeRecord("b", "team-a", KindVulnerability, "HIGH"))
+	if err := db.QueueDeliveries(ctx, channelSlack, testEvents(), "status 500", time.Now()); err != nil {
+		t.Fatalf("QueueDeliveries: %v", err)
+	}
+
+	s := testServer(t, db, map[string]string{"TRIX_POLL_INTERVAL": "1m"})
+	if rec := getHealth(t, s, "/readyz", false); rec.Code != http.StatusServiceUnavailable || rec.Body.String() != "not ready" {
+		t.Errorf("/readyz before the first poll = %d %q", rec.Code, rec.Body)
+	}
+
+	s.ready.Store(true)
+	s.recordPoll(nil)
+	s.recordPoll(errors.New("list vulnerabilityreports: forbidden"))
+	s.recordPoll(errors.New("list vulnerabilityreports: forbidden"))
+
+	// The last success is recent, so failed polls alone keep it ready
+	if rec := getHealth(t, s, "/readyz", false); rec.Code != http.StatusOK || rec.Body.String() != "ok" {
+		t.Errorf("plain /readyz = %d %q, want 200 ok", rec.Code, rec.Body)
+	}
+	rec := getHealth(t, s, "/readyz", true)
+	if rec.Code != http.StatusOK {
+		t.Errorf("JSON /readyz = %d, want 200", rec.Code)
+	}
+	h := decodeHealth(t, rec)
+	if h.Status != "ok" || h.Database != "ok" {
+		t.Errorf("status = %q, database = %q", h.Status, h.Database)
+	}
+	if h.LastPoll == nil || time.Since(*h.LastPoll) > time.Minute {
+		t.Errorf("lastPoll = %v, want just now", h.LastPoll)
+	}
+	if h.LastPollError != "list vulnerabilityreports: forbidden" || h.LastPollErrorAt == nil {
+		t.Errorf("lastPollError = %q at %v", h.LastPollError, h.LastPollErrorAt)
+	}
+	if h.FailedPolls != 2 {
+		t.Errorf("failedPolls = %d, want 2", h.FailedPolls)
+	}
+	if h.OpenVulnerabilities != 2 {
+		t.Errorf("openVulnerabilities = %d, want 2", h.OpenVulnerabilities)
+	}
+	if h.DeliveriesPending != len(testEvents()) {
+		t.Errorf("deliveriesPending = %d, want %d", h.DeliveriesPending, len(testEvents()))
+	}
+
+	// A success clears the error
+	s.recordPoll(nil)
+	h = decodeHealth(t, getHealth(t, s, "/readyz", true))
+	if h.LastPollError != "" || h.LastPollErrorAt != nil || h.FailedPolls != 0 {
+		t.Errorf("after a successful poll: %+v", h)
+	}
+
+	// A stale poll fails readiness in both formats
+	old := time.Now().Add(-5 * time.Minute)
+	s.lastPoll.Store(&old)
+	if rec := getHealth(t, s, "/readyz", false); rec.Code != http.StatusServiceUnavailable || rec.Body.String() != "stale" {
+		t.Errorf("stale plain /readyz = %d %q", rec.Code, rec.Body)
+	}
+	rec = getHealth(t, s, "/readyz", true)
+	if h := decodeHealth(t, rec); rec.Code != http.StatusServiceUnavailable || h.Status != "stale" {
+		t.Errorf("stale JSON /readyz = %d %q", rec.Code, h.Status)
+	}
+}
+
+func TestReadyzDatabaseDown(t *testing.T) {
+	s := testServer(t, downStore{NewMemoryStore()}, nil)
+	s.ready.Store(true)
+	s.recordPoll(nil)
+
+	// Readiness follows polling; the database error is reported in the body
+	rec := getHealth(t, s, "/readyz", true)
+	h := decodeHealth(t, rec)
+	if rec.Code != http.StatusOK || h.Status != "ok" {
+		t.Errorf("/readyz = %d %q", rec.Code, h.Status)
+	}
+	if !strings.Contains(h.Database, "connection refused") {
+		t.Errorf("database = %q, want the ping error", h.Database)
+	}
+	if h.OpenVulnerabilities != 0 || h.DeliveriesPending != 0 {
+		t.Errorf("counts = %d, %d without a database", h.OpenVulnerabilities, h.DeliveriesPending)
+	}
+}
@@ -0,0 +1,295 @@
+package server
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/trixsec-dev/trix/internal/tools/trivy"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// golden compares got with testdata/name, or rewrites the file with -update
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.MkdirAll("testdata", 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs from golden file:\n--- got\n%s\n--- want\n%s", name, got, want)
+	}
+}
+
+// testLogger discards log output
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// testConfig loads a Config for an in-memory store from env on top of the
+// defaults.
+func testConfig(t testing.TB, env map[string]string) *Config {
+	t.Helper()
+	t.Setenv(ConfigFileEnv, "")
+	t.Setenv("TRIX_DATABASE_URL", "memory://")
+	for k, v := range env {
+		t.Setenv(k, v)
+	}
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	return cfg
+}
+
+// syncBuffer collects log output written from several goroutines
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// fakeDynamic returns a fake dynamic client serving the given reports
+func fakeDynamic(objects ...runtime.Object) *dynamicfake.FakeDynamicClient {
+	listKinds := map[schema.GroupVersionResource]string{
+		trivy.VulnerabilityReportGVR:        "VulnerabilityReportList",
+		trivy.ClusterVulnerabilityReportGVR: "ClusterVulnerabilityReportList",
+		trivy.ExposedSecretReportGVR:        "ExposedSecretReportList",
+		trivy.ConfigAuditReportGVR:          "ConfigAuditReportList",
+	}
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds, objects...)
+}
+
+// testPoller returns a poller listing reports from dyn into db
+func testPoller(config *Config, db Store, dyn *dynamicfake.FakeDynamicClient) *Poller {
+	return &Poller{
+		trivyClient: trivy.NewClientForDynamic(dyn),
+		db:          db,
+		config:      config,
+		logger:      testLogger(),
+		tracer:      noopTracer,
+	}
+}
+
+// fixtureVuln is one vulnerability in a fixture report
+type fixtureVuln struct {
+	CVE, Severity, Package, Installed, Fixed string
+}
+
+// vulnReport builds a VulnerabilityReport for a deployment's container
+func vulnReport(namespace, deployment, digest string, vulns ...fixtureVuln) *unstructured.Unstructured {
+	var items []interface{}
+	for _, v := range vulns {
+		items = append(items, map[string]interface{}{
+			"vulnerabilityID":  v.CVE,
+			"resource":         v.Package,
+			"installedVersion": v.Installed,
+			"fixedVersion":     v.Fixed,
+			"severity":         v.Severity,
+			"title":            v.CVE + " in " + v.Package,
+		})
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "aquasecurity.github.io/v1alpha1",
+		"kind":       "VulnerabilityReport",
+		"metadata": map[string]interface{}{
+			"name":      fmt.Sprintf("replicaset-%s-app", deployment),
+			"namespace": namespace,
+			"labels": map[string]interface{}{
+				"trivy-operator.resource.kind":  "Deployment",
+				"trivy-operator.resource.name":  deployment,
+				"trivy-operator.container.name": "app",
+			},
+		},
+		"report": map[string]interface{}{
+			"artifact": map[string]interface{}{
+				"repository": "example/" + deployment,
+				"tag":        "latest",
+				"digest":     digest,
+			},
+			"vulnerabilities": items,
+		},
+	}}
+}
+
+// testServer returns a server on db that doesn't poll
+func testServer(t testing.TB, db Store, env map[string]string) *Server {
+	t.Helper()
+	return &Server{
+		config:  testConfig(t, env),
+		db:      db,
+		logger:  testLogger(),
+		stop:    make(chan struct{}),
+		pollNow: make(chan struct{}, 1),
+	}
+}
+
+// pollingServer returns a server on db that polls dyn and notifies as
+// configured by env
+func pollingServer(t testing.TB, db Store, dyn *dynamicfake.FakeDynamicClient, env map[string]string) *Server {
+	t.Helper()
+	s := testServer(t, db, env)
+	s.poller = testPoller(s.config, db, dyn)
+	s.notifier = NewNotifier(s.config, db, testLogger())
+	s.telemetry = &telemetry{tracer: noopTracer}
+	return s
+}
+
+// waitFor polls cond until it holds, failing the test after 10 seconds
+func waitFor(t testing.TB, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// testPKI is a throwaway CA that issues certificates for TLS tests
+type testPKI struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	dir  string
+	pool *x509.CertPool
+}
+
+// testCert is an issued certificate, also written to PEM files
+type testCert struct {
+	pair     tls.Certificate
+	certFile string
+	keyFile  string
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "trix test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &testPKI{cert: cert, key: key, dir: t.TempDir(), pool: x509.NewCertPool()}
+	p.pool.AddCert(cert)
+	writePEM(t, p.caFile(), "CERTIFICATE", der)
+	return p
+}
+
+// caFile is the path of the CA certificate
+func (p *testPKI) caFile() string {
+	return filepath.Join(p.dir, "ca.pem")
+}
+
+// issue signs a certificate for name, valid from notBefore to notAfter.
+// Server certificates cover 127.0.0.1 and localhost.
+func (p *testPKI) issue(t *testing.T, name string, client bool, notBefore, notAfter time.Time) testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:     []string{"localhost"},
+	}
+	if client {
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+		tmpl.IPAddresses, tmpl.DNSNames = nil, nil
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, p.cert, &key.PublicKey, p.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := testCert{
+		certFile: filepath.Join(p.dir, name+".pem"),
+		keyFile:  filepath.Join(p.dir, name+"-key.pem"),
+	}
+	writePEM(t, c.certFile, "CERTIFICATE", der)
+	writePEM(t, c.keyFile, "EC PRIVATE KEY", keyDER)
+	if c.pair, err = tls.LoadX509KeyPair(c.certFile, c.keyFile); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// issueValid signs a certificate valid for the next day
+func (p *testPKI) issueValid(t *testing.T, name string, client bool) testCert {
+	t.Helper()
+	return p.issue(t, name, client, time.Now().Add(-time.Hour), time.Now().Add(24*time.Hour))
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
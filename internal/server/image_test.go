@@ -0,0 +1,204 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// imageCVEs are the fixture vulnerabilities by CVE
+var imageCVEs = map[string]fixtureVuln{
+	"CVE-2024-0001": {"CVE-2024-0001", "CRITICAL", "openssl", "3.0.1", "3.0.8"},
+	"CVE-2024-0002": {"CVE-2024-0002", "CRITICAL", "curl", "8.0.0", "8.0.1"},
+	"CVE-2024-0003": {"CVE-2024-0003", "CRITICAL", "zlib", "1.2.11", "1.2.12"},
+	"CVE-2024-0004": {"CVE-2024-0004", "CRITICAL", "glibc", "2.36", "2.37"},
+	"CVE-2024-0005": {"CVE-2024-0005", "CRITICAL", "libxml2", "2.9.0", "2.9.1"},
+}
+
+// imageScan is a scan of payments/api running an image digest with cves
+type imageScan struct {
+	digest string
+	cves   []string
+}
+
+func imageReport(digest string, cves ...string) imageScan {
+	return imageScan{digest: digest, cves: cves}
+}
+
+// pollImages polls each scan in turn into one store and returns the
+// events of the last poll
+func pollImages(t *testing.T, db Store, scans ...imageScan) []VulnerabilityEvent {
+	t.Helper()
+	cfg := testConfig(t, nil)
+	var events []VulnerabilityEvent
+	for _, scan := range scans {
+		vulns := make([]fixtureVuln, len(scan.cves))
+		for i, cve := range scan.cves {
+			vulns[i] = imageCVEs[cve]
+		}
+		var err error
+		events, err = testPoller(cfg, db, fakeDynamic(vulnReport("payments", "api", scan.digest, vulns...))).Poll(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return events
+}
+
+// imageKeys renders events sorted as "TYPE CVE digest", IMAGE_CHANGED as
+// "IMAGE_CHANGED old→new +added -removed"
+func imageKeys(events []VulnerabilityEvent) []string {
+	keys := make([]string, 0, len(events))
+	for _, e := range events {
+		if e.Type == "IMAGE_CHANGED" {
+			keys = append(keys, fmt.Sprintf("%s %s→%s +%d -%d", e.Type, e.OldImageDigest, e.ImageDigest, e.Added, e.Removed))
+			continue
+		}
+		keys = append(keys, e.Type+" "+e.CVE+" "+e.ImageDigest)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestPollImageChanged(t *testing.T) {
+	tests := []struct {
+		name   string
+		before imageScan
+		after  imageScan
+		want   []string
+	}{
+		{
+			name:   "only the digest changed",
+			before: imageReport("sha256:aaa", "CVE-2024-0001", "CVE-2024-0002"),
+			after:  imageReport("sha256:bbb", "CVE-2024-0001", "CVE-2024-0002"),
+			want:   []string{"IMAGE_CHANGED sha256:aaa→sha256:bbb +0 -0"},
+		},
+		{
+			name:   "findings added and removed",
+			before: imageReport("sha256:aaa", "CVE-2024-0001", "CVE-2024-0002", "CVE-2024-0003"),
+			after:  imageReport("sha256:bbb", "CVE-2024-0001", "CVE-2024-0004", "CVE-2024-0005"),
+			want: []string{
+				"FIXED CVE-2024-0002 sha256:aaa",
+				"FIXED CVE-2024-0003 sha256:aaa",
+				"IMAGE_CHANGED sha256:aaa→sha256:bbb +2 -2",
+				"NEW CVE-2024-0004 sha256:bbb",
+				"NEW CVE-2024-0005 sha256:bbb",
+			},
+		},
+		{
+			// No finding carries over, so the change shows in the digests
+			// of the NEW and FIXED events alone
+			name:   "every finding replaced",
+			before: imageReport("sha256:aaa", "CVE-2024-0001", "CVE-2024-0002"),
+			after:  imageReport("sha256:bbb", "CVE-2024-0003"),
+			want: []string{
+				"FIXED CVE-2024-0001 sha256:aaa",
+				"FIXED CVE-2024-0002 sha256:aaa",
+				"IMAGE_CHANGED sha256:aaa→sha256:bbb +1 -2",
+				"NEW CVE-2024-0003 sha256:bbb",
+			},
+		},
+		{
+			name:   "same digest",
+			before: imageReport("sha256:aaa", "CVE-2024-0001", "CVE-2024-0002"),
+			after:  imageReport("sha256:aaa", "CVE-2024-0001", "CVE-2024-0003"),
+			want:   []string{"FIXED CVE-2024-0002 sha256:aaa", "NEW CVE-2024-0003 sha256:aaa"},
+		},
+		{
+			name:   "digest unknown",
+			before: imageReport("sha256:aaa", "CVE-2024-0001"),
+			after:  imageReport("", "CVE-2024-0001"),
+			want:   []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := NewMemoryStore()
+			events := pollImages(t, db, tt.before, tt.after)
+			if got := imageKeys(events); strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("events:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+			for _, e := range filterByType(events, "IMAGE_CHANGED") {
+				if e.Workload != "payments/Deployment/api" || e.ContainerName != "app" || e.ImageRepository != "example/api" {
+					t.Errorf("image change of %s (%s) in %s", e.Workload, e.ContainerName, e.ImageRepository)
+				}
+			}
+
+			// The stored digest follows the image, so the next scan is quiet
+			if tt.after.digest != "" {
+				if events := pollImages(t, db, tt.after); len(events) != 0 {
+					t.Errorf("rescan = %q", imageKeys(events))
+				}
+			}
+		})
+	}
+}
+
+func TestSummarizeImageChanges(t *testing.T) {
+	change := func(container string) VulnerabilityEvent {
+		return VulnerabilityEvent{Type: "IMAGE_CHANGED", Workload: "w", ContainerName: container, ImageDigest: "sha256:new", OldImageDigest: "sha256:old"}
+	}
+	finding := func(typ, container, digest string) VulnerabilityEvent {
+		return VulnerabilityEvent{Type: typ, Workload: "w", ContainerName: container, ImageDigest: digest}
+	}
+	events := summarizeImageChanges([]VulnerabilityEvent{
+		change("app"), change("app"), // One per surviving finding
+		finding("NEW", "app", "sha256:new"),
+		finding("NEW", "app", "sha256:new"),
+		finding("FIXED", "app", "sha256:old"),
+		finding("FIXED", "app", "sha256:other"), // Not from the old image
+		finding("NEW", "sidecar", "sha256:new"), // Another container
+	})
+
+	changes := filterByType(events, "IMAGE_CHANGED")
+	if len(changes) != 1 {
+		t.Fatalf("%d image changes, want the two merged", len(changes))
+	}
+	if c := changes[0]; c.ContainerName != "app" || c.Added != 2 || c.Removed != 1 {
+		t.Errorf("change = %s +%d -%d", c.ContainerName, c.Added, c.Removed)
+	}
+	if n := len(events) - len(changes); n != 5 {
+		t.Errorf("%d findings, want all 5 kept", n)
+	}
+}
+
+// Slack lists the findings an image change explains under its banner
+// instead of in the new and fixed sections
+func TestSlackImageBanner(t *testing.T) {
+	db := NewMemoryStore()
+	events := pollImages(t, db,
+		imageReport("sha256:aaa", "CVE-2024-0001", "CVE-2024-0002", "CVE-2024-0003"),
+		imageReport("sha256:bbb", "CVE-2024-0001", "CVE-2024-0004", "CVE-2024-0005"),
+	)
+	srv, received := stubReceiver(t, http.StatusOK)
+	n := testNotifier(t, map[string]string{"TRIX_NOTIFY_SLACK": srv.URL})
+	if err := n.sendSlack(context.Background(), events); err != nil {
+		t.Fatal(err)
+	}
+
+	var payload struct {
+		Blocks []map[string]interface{} `json:"blocks"`
+	}
+	if err := json.Unmarshal(received()[0].body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	texts := blockTexts(t, payload.Blocks)
+	if len(texts) == 0 || !strings.HasPrefix(texts[0], ":package: *Image changed* payments/Deployment/api (app): sha256:aaa → sha256:bbb, 2 new, 2 fixed") {
+		t.Fatalf("first block = %q, want the image change", texts)
+	}
+	banner := texts[0]
+	for _, want := range []string{"CVE-2024-0004", "CVE-2024-0005", ":white_check_mark: 2 CVEs fixed"} {
+		if !strings.Contains(banner, want) {
+			t.Errorf("banner lacks %q:\n%s", want, banner)
+		}
+	}
+	for _, text := range texts[1:] {
+		if strings.Contains(text, "CVE-2024-0004") || strings.Contains(text, "CVE-2024-0005") || strings.Contains(text, "Fixed") {
+			t.Errorf("findings of the image change listed again: %q", text)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// Lease timing, variables so tests can shorten them
+var (
+	leaseDuration = 15 * time.Second
+	renewDeadline = 10 * time.Second
+	retryPeriod   = 2 * time.Second
+)
+
+// runLeaderElection competes for the Lease and runs the poll loop while
+// holding it. When leadership is lost the poll loop is stopped, and the
+// replica rejoins the election as a standby. Returns when ctx is cancelled.
+func (s *Server) runLeaderElection(ctx context.Context) {
+	identity := s.identity
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      s.config.LeaseName,
+			Namespace: s.config.LeaseNamespace,
+		},
+		Client:     s.leases,
+		LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+	}
+
+	s.logger.Info("leader election enabled",
+		"lease", s.config.LeaseNamespace+"/"+s.config.LeaseName,
+		"identity", identity,
+	)
+
+	for ctx.Err() == nil {
+		var started atomic.Bool
+		done := make(chan struct{})
+		elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			LeaseDuration:   leaseDuration,
+			RenewDeadline:   renewDeadline,
+			RetryPeriod:     retryPeriod,
+			ReleaseOnCancel: true,
+			Name:            "trix",
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(leaderCtx context.Context) {
+					started.Store(true)
+					defer close(done)
+					s.logger.Info("acquired leadership, starting poll loop")
+					s.leading.Store(true)
+					s.runPollLoop(leaderCtx)
+				},
+				OnStoppedLeading: func() {
+					s.leading.Store(false)
+					s.ready.Store(false)
+				},
+				OnNewLeader: func(leader string) {
+					if leader != identity {
+						s.logger.Info("standing by", "leader", leader)
+					}
+				},
+			},
+		})
+		if err != nil {
+			s.logger.Error("invalid leader election config", "error", err)
+			return
+		}
+
+		elector.Run(ctx)
+
+		// Run returns once leadership is lost (or was never acquired before
+		// ctx ended). Wait for an in-flight poll to finish before competing
+		// again so two loops never overlap in this process.
+		if started.Load() {
+			<-done
+			if ctx.Err() == nil {
+				s.logger.Warn("lost leadership, poll loop stopped")
+			}
+		}
+	}
+}
+
+// leaderIdentity names this replica in the Lease: the pod name when set
+// through the downward API, otherwise the hostname (which is the pod name
+// in Kubernetes).
+func leaderIdentity() string {
+	if name := os.Getenv("POD_NAME"); name != "" {
+		return name
+	}
+	if host, err := os.Hostname(); err == nil {
+		return host
+	}
+	return "trix"
+}
+
+// inClusterNamespace returns the namespace of the service account the pod
+// runs as, or "" outside a cluster.
+func inClusterNamespace() string {
+	data, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/trixsec-dev/trix/internal/tools/trivy"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestLeaderIdentity(t *testing.T) {
+	t.Setenv("POD_NAME", "trix-7d9f-abcde")
+	if got := leaderIdentity(); got != "trix-7d9f-abcde" {
+		t.Errorf("leaderIdentity = %q, want POD_NAME", got)
+	}
+	t.Setenv("POD_NAME", "")
+	if got := leaderIdentity(); got == "" {
+		t.Error("no identity without POD_NAME")
+	}
+}
+
+func TestLeaderElectionConfig(t *testing.T) {
+	cfg := testConfig(t, map[string]string{"TRIX_LEADER_ELECTION": "true", "TRIX_LEADER_LEASE_NAMESPACE": "trix-system"})
+	if !cfg.LeaderElection || cfg.LeaseName != "trix-leader" || cfg.LeaseNamespace != "trix-system" {
+		t.Errorf("config = %v %s/%s", cfg.LeaderElection, cfg.LeaseNamespace, cfg.LeaseName)
+	}
+
+	t.Setenv(ConfigFileEnv, "")
+	t.Setenv("TRIX_DATABASE_URL", "memory://")
+	t.Setenv("TRIX_LEADER_LEASE_NAMESPACE", "")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("leader election outside a cluster without a lease namespace")
+	}
+}
+
+// shortLeases speeds up leader election for the rest of the test
+func shortLeases(t *testing.T) {
+	oldLease, oldRenew, oldRetry := leaseDuration, renewDeadline, retryPeriod
+	leaseDuration, renewDeadline, retryPeriod = time.Second, 500*time.Millisecond, 100*time.Millisecond
+	t.Cleanup(func() { leaseDuration, renewDeadline, retryPeriod = oldLease, oldRenew, oldRetry })
+}
+
+// Two replicas share a database and a Lease. Only the leader polls and
+// notifies; when it loses the Lease the standby takes over without
+// resending the initial summary.
+func TestLeaderElectionHandover(t *testing.T) {
+	shortLeases(t)
+	receiver, received := stubReceiver(t, http.StatusOK)
+	env := map[string]string{
+		"TRIX_NOTIFY_WEBHOOK":         receiver.URL,
+		"TRIX_POLL_INTERVAL":          "1h",
+		"TRIX_LEADER_ELECTION":        "true",
+		"TRIX_LEADER_LEASE_NAMESPACE": "trix-system",
+	}
+	store := NewMemoryStore()
+	dyn := fakeDynamic(vulnReport("payments", "api", "sha256:aaa",
+		fixtureVuln{"CVE-2024-0001", "CRITICAL", "openssl", "3.0.1", "3.0.8"}))
+
+	// The fake Lease rejects renewals by a partitioned replica
+	clientset := k8sfake.NewSimpleClientset()
+	var partitioned atomic.Value
+	partitioned.Store("")
+	clientset.PrependReactor("update", "leases", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		lease := action.(k8stesting.UpdateAction).GetObject().(*coordinationv1.Lease)
+		if holder := lease.Spec.HolderIdentity; holder != nil && *holder == partitioned.Load().(string) {
+			return true, nil, errors.New("connection refused")
+		}
+		return false, nil, nil
+	})
+
+	replicas := map[string]*Server{}
+	for _, name := range []string{"trix-a", "trix-b"} {
+		s := pollingServer(t, store, dyn, env)
+		s.leases = clientset.CoordinationV1()
+		s.identity = name
+		replicas[name] = s
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			s.runLeaderElection(ctx)
+		}()
+		t.Cleanup(func() {
+			cancel()
+			<-done
+		})
+	}
+
+	var leader, standby *Server
+	waitFor(t, "a leader", func() bool {
+		for name, s := range replicas {
+			if s.leading.Load() && s.ready.Load() {
+				leader = s
+				standby = replicas[map[string]string{"trix-a": "trix-b", "trix-b": "trix-a"}[name]]
+				return true
+			}
+		}
+		return false
+	})
+	if standby.leading.Load() {
+		t.Fatal("both replicas lead")
+	}
+	if code, status := leader.readiness(time.Now()); code != http.StatusOK || status != "leading" {
+		t.Errorf("leader readiness = %d %s", code, status)
+	}
+	if code, status := standby.readiness(time.Now()); code != http.StatusOK || status != "standby" {
+		t.Errorf("standby readiness = %d %s", code, status)
+	}
+	if reqs := received(); len(reqs) != 1 || !isSummary(t, reqs[0].body) {
+		t.Fatalf("%d webhook requests after the first poll, want the summary", len(reqs))
+	}
+
+	// A new CVE appears while the leader is cut off from the API server
+	if _, err := dyn.Resource(trivy.VulnerabilityReportGVR).Namespace("shop").Create(context.Background(),
+		vulnReport("shop", "web", "sha256:bbb", fixtureVuln{"CVE-2024-0002", "CRITICAL", "zlib", "1.2.11", "1.2.12"}),
+		metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	partitioned.Store(leader.identity)
+
+	waitFor(t, "the standby to take over", func() bool { return standby.leading.Load() && standby.ready.Load() })
+	waitFor(t, "the old leader to step down", func() bool { return !leader.leading.Load() })
+	if code, status := leader.readiness(time.Now()); code != http.StatusOK || status != "standby" {
+		t.Errorf("old leader readiness = %d %s", code, status)
+	}
+
+	reqs := received()
+	if len(reqs) != 2 {
+		t.Fatalf("%d webhook requests after the handover, want 2", len(reqs))
+	}
+	if isSummary(t, reqs[1].body) {
+		t.Errorf("new leader resent the initial summary: %s", reqs[1].body)
+	}
+}
+
+func isSummary(t *testing.T, body []byte) bool {
+	t.Helper()
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatalf("webhook body: %v", err)
+	}
+	return payload["type"] == "initialized"
+}
@@ -0,0 +1,249 @@
+package server
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps vulnerability state in memory. State is lost on restart,
+// so it is meant for trials and CI smoke tests (TRIX_DATABASE_URL=memory://).
+// It follows the same state transitions as the SQL store.
+type MemoryStore struct {
+	mu        sync.Mutex
+	vulns     map[string]*memoryRecord
+	snapshots []Snapshot
+	digest    []memoryDigestEvent
+	digestSeq int64
+
+	digestRuns map[string]DigestRun // Channel -> last digest
+
+	slackThreads map[string]string    // Workload -> message ts
+	notified     map[string]time.Time // Workload -> last notified
+
+	deliveries  []*Delivery
+	deliverySeq int64
+}
+
+type memoryRecord struct {
+	VulnerabilityRecord
+	saasSynced  bool
+	githubIssue int
+}
+
+// NewMemoryStore creates an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		vulns:        make(map[string]*memoryRecord),
+		slackThreads: make(map[string]string),
+		notified:     make(map[string]time.Time),
+		digestRuns:   make(map[string]DigestRun),
+	}
+}
+
+// Ping always succeeds.
+func (m *MemoryStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Close is a no-op.
+func (m *MemoryStore) Close() error {
+	return nil
+}
+
+// UpsertVulnerability inserts or updates a vulnerability record and reports
+// whether it is new or reopened, or had its severity changed.
+func (m *MemoryStore) UpsertVulnerability(ctx context.Context, v *VulnerabilityRecord) (VulnerabilityChange, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	existing, ok := m.vulns[v.ID]
+	if !ok {
+		r := &memoryRecord{VulnerabilityRecord: *v}
+		r.Kind = recordKind(v)
+		r.State = StateOpen
+		r.FirstSeen = now
+		r.LastSeen = now
+		r.FixedAt = nil
+		m.vulns[v.ID] = r
+		return VulnerabilityChange{New: true}, nil
+	}
+
+	reopened := existing.State == StateFixed
+	change := VulnerabilityChange{New: reopened, FirstSeen: existing.FirstSeen}
+	if !reopened {
+		if existing.Severity != v.Severity {
+			change.OldSeverity = existing.Severity
+		}
+		change.OldImageDigest = imageChange(existing.ImageDigest, v.ImageDigest)
+	}
+	existing.LastSeen = now
+	existing.Severity = v.Severity
+	existing.Title = v.Title
+	existing.Image = v.Image
+	existing.ContainerName = v.ContainerName
+	existing.ImageRepository = v.ImageRepository
+	existing.ImageTag = v.ImageTag
+	existing.ImageDigest = v.ImageDigest
+	existing.FixedVersion = v.FixedVersion
+	existing.Exposure = v.Exposure
+	existing.Namespace = v.Namespace
+	if reopened {
+		// Reset saas sync so the reopen event gets sent to SaaS
+		existing.State = StateOpen
+		existing.FixedAt = nil
+		existing.saasSynced = false
+	}
+	return change, nil
+}
+
+// MarkFixed marks open vulnerabilities in namespaces and of kinds (all if
+// empty) that are not in currentIDs as fixed.
+func (m *MemoryStore) MarkFixed(ctx context.Context, namespaces, kinds, currentIDs []string) ([]VulnerabilityRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current := make(map[string]bool, len(currentIDs))
+	for _, id := range currentIDs {
+		current[id] = true
+	}
+	scoped := make(map[string]bool, len(namespaces))
+	for _, ns := range namespaces {
+		scoped[ns] = true
+	}
+	tracked := make(map[string]bool, len(kinds))
+	for _, kind := range kinds {
+		tracked[kind] = true
+	}
+
+	now := time.Now()
+	var fixed []VulnerabilityRecord
+	for id, r := range m.vulns {
+		if r.State != StateOpen || current[id] {
+			continue
+		}
+		if len(scoped) > 0 && !scoped[r.Namespace] {
+			continue
+		}
+		if len(tracked) > 0 && !tracked[r.Kind] {
+			continue
+		}
+		r.State = StateFixed
+		fixedAt := now
+		r.FixedAt = &fixedAt
+		fixed = append(fixed, r.VulnerabilityRecord)
+	}
+	return fixed, nil
+}
+
+// PruneFixed deletes FIXED vulnerabilities fixed strictly before cutoff.
+func (m *MemoryStore) PruneFixed(ctx context.Context, cutoff time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var pruned int64
+	for id, r := range m.vulns {
+		if r.State == StateFixed && r.FixedAt != nil && r.FixedAt.Before(cutoff) {
+			delete(m.vulns, id)
+			pruned++
+		}
+	}
+	return pruned, nil
+}
+
+// GetOpenVulnerabilities returns all open vulnerabilities, most severe first.
+func (m *MemoryStore) GetOpenVulnerabilities(ctx context.Context) ([]VulnerabilityRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var vulns []VulnerabilityRecord
+	for _, r := range m.vulns {
+		if r.State == StateOpen {
+			vulns = append(vulns, r.VulnerabilityRecord)
+		}
+	}
+	sort.Slice(vulns, func(i, j int) bool {
+		si, sj := severityLevel(vulns[i].Severity), severityLevel(vulns[j].Severity)
+		if si != sj {
+			return si < sj
+		}
+		return vulns[i].FirstSeen.After(vulns[j].FirstSeen)
+	})
+	return vulns, nil
+}
+
+// GetStats returns vulnerability statistics. With mttrWindow > 0 it also
+// aggregates the time to fix of vulnerabilities fixed within that window.
+func (m *MemoryStore) GetStats(ctx context.Context, mttrWindow time.Duration) (*Stats, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := &Stats{BySeverity: make(map[string]int)}
+	if mttrWindow > 0 {
+		stats.MTTR = make(map[string]MTTR)
+	}
+	since := time.Now().Add(-mttrWindow)
+	total := make(map[string]time.Duration)
+	for _, r := range m.vulns {
+		switch r.State {
+		case StateOpen:
+			stats.TotalOpen++
+			stats.BySeverity[r.Severity]++
+		case StateFixed:
+			stats.TotalFixed++
+			if stats.MTTR != nil && r.FixedAt != nil && !r.FixedAt.Before(since) {
+				mttr := stats.MTTR[r.Severity]
+				mttr.Count++
+				stats.MTTR[r.Severity] = mttr
+				total[r.Severity] += r.FixedAt.Sub(r.FirstSeen)
+			}
+		}
+	}
+	for sev, mttr := range stats.MTTR {
+		mttr.Mean = total[sev] / time.Duration(mttr.Count)
+		stats.MTTR[sev] = mttr
+	}
+	return stats, nil
+}
+
+// GetUnsyncedVulnerabilities returns up to 500 vulnerabilities that haven't
+// been synced to SaaS, oldest first.
+func (m *MemoryStore) GetUnsyncedVulnerabilities(ctx context.Context) ([]VulnerabilityRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var vulns []VulnerabilityRecord
+	for _, r := range m.vulns {
+		if !r.saasSynced {
+			vulns = append(vulns, r.VulnerabilityRecord)
+		}
+	}
+	sort.Slice(vulns, func(i, j int) bool {
+		return vulns[i].FirstSeen.Before(vulns[j].FirstSeen)
+	})
+	if len(vulns) > 500 {
+		vulns = vulns[:500]
+	}
+	return vulns, nil
+}
+
+// MarkSaasSynced marks vulnerabilities as synced to SaaS.
+func (m *MemoryStore) MarkSaasSynced(ctx context.Context, ids []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, id := range ids {
+		if r, ok := m.vulns[id]; ok {
+			r.saasSynced = true
+		}
+	}
+	return nil
+}
+
+// isMemoryURL reports whether a database URL selects the in-memory store
+func isMemoryURL(databaseURL string) bool {
+	return strings.HasPrefix(databaseURL, "memory://")
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestNewStoreMemory(t *testing.T) {
+	cfg := testConfig(t, nil)
+	store, err := NewStore(context.Background(), cfg, testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.(*MemoryStore); !ok {
+		t.Fatalf("NewStore(memory://) = %T", store)
+	}
+	if err := store.Ping(context.Background()); err != nil {
+		t.Errorf("Ping: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+
+	for url, want := range map[string]bool{
+		"memory://":                   true,
+		"memory://trial":              true,
+		"postgres://localhost/trix":   false,
+		"mysql://trix@localhost/trix": false,
+		"host=localhost dbname=trix":  false,
+	} {
+		if got := isMemoryURL(url); got != want {
+			t.Errorf("isMemoryURL(%q) = %v", url, got)
+		}
+	}
+}
+
+// Callers get copies, not the stored records
+func TestMemoryStoreReturnsCopies(t *testing.T) {
+	s := NewMemoryStore()
+	mustUpsert(t, s, storeRecord("1", "payments", KindVulnerability, "HIGH"))
+
+	got := mustGet(t, s, "1")
+	got.Severity = "LOW"
+	open, err := s.GetOpenVulnerabilities(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	open[0].State = StateFixed
+
+	if v := mustGet(t, s, "1"); v.Severity != "HIGH" || v.State != StateOpen {
+		t.Errorf("stored record changed through a returned copy: %+v", v)
+	}
+}
+
+// runTestPollLoop runs s's poll loop until the test ends and waits for its
+// initial poll
+func runTestPollLoop(t *testing.T, s *Server) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	go s.runPollLoop(ctx)
+	t.Cleanup(func() {
+		cancel()
+		s.loops.Wait()
+	})
+
+	waitFor(t, "the initial poll", s.ready.Load)
+}
+
+// A memory store starts empty, so serve sends the initial summary and
+// becomes ready like it does on a new database. A leader taking over the
+// same store reports changes normally.
+func TestFirstPollMemoryStore(t *testing.T) {
+	receiver, received := stubReceiver(t, http.StatusOK)
+	env := map[string]string{"TRIX_NOTIFY_WEBHOOK": receiver.URL, "TRIX_POLL_INTERVAL": "1h"}
+	store := NewMemoryStore()
+	newServer := func(vulns ...fixtureVuln) *Server {
+		s := pollingServer(t, store, fakeDynamic(vulnReport("payments", "api", "sha256:aaa", vulns...)), env)
+		s.leading.Store(true)
+		return s
+	}
+
+	vulns := []fixtureVuln{
+		{"CVE-2024-0001", "CRITICAL", "openssl", "3.0.1", "3.0.8"},
+		{"CVE-2024-0002", "HIGH", "openssl", "3.0.1", "3.0.8"},
+	}
+	first := newServer(vulns...)
+	if code, status := first.readiness(time.Now()); code != http.StatusServiceUnavailable || status != "not ready" {
+		t.Errorf("readiness before the first poll = %d %s", code, status)
+	}
+	runTestPollLoop(t, first)
+	if code, status := first.readiness(time.Now()); code != http.StatusOK || status != "ok" {
+		t.Errorf("readiness after the first poll = %d %s", code, status)
+	}
+
+	reqs := received()
+	if len(reqs) != 1 {
+		t.Fatalf("%d webhook requests after the first poll, want the summary only", len(reqs))
+	}
+	var summary struct {
+		Type       string         `json:"type"`
+		Total      int            `json:"total"`
+		BySeverity map[string]int `json:"bySeverity"`
+	}
+	if err := json.Unmarshal(reqs[0].body, &summary); err != nil {
+		t.Fatal(err)
+	}
+	if summary.Type != "initialized" || summary.Total != 2 || summary.BySeverity["CRITICAL"] != 1 {
+		t.Errorf("summary = %+v", summary)
+	}
+
+	// Handover: the store has data, so a new CVE is a normal notification
+	vulns = append(vulns, fixtureVuln{"CVE-2024-0003", "CRITICAL", "zlib", "1.2.11", "1.2.12"})
+	second := newServer(vulns...)
+	runTestPollLoop(t, second)
+	if second.firstPoll {
+		t.Error("first poll assumed on a store with data")
+	}
+	reqs = received()
+	if len(reqs) != 2 {
+		t.Fatalf("%d webhook requests, want 2", len(reqs))
+	}
+	var event map[string]interface{}
+	if err := json.Unmarshal(reqs[1].body, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event["type"] == "initialized" {
+		t.Errorf("summary resent after a handover: %s", reqs[1].body)
+	}
+}
@@ -0,0 +1,244 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migrations are numbered SQL files, one directory per dialect:
+// migrations/<dialect>/NNNN_description.sql. Applied versions are recorded in
+// schema_migrations. Migrations only go forward.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+var schemaMigrationsDDL = map[dialect]string{
+	dialectPostgres: `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	dialectMySQL: `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INT NOT NULL PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		applied_at DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6)
+	)`,
+}
+
+// Replicas starting together would all apply the same pending migrations,
+// so migrate holds a lock named after the database (or PostgreSQL schema)
+// while it reads and applies them.
+var (
+	migrationLockSQL = map[dialect]string{
+		dialectPostgres: "SELECT pg_advisory_lock(hashtext('trix_schema_migrations.' || current_schema()))",
+		dialectMySQL:    "SELECT GET_LOCK(CONCAT('trix_schema_migrations.', DATABASE()), ?)",
+	}
+	migrationUnlockSQL = map[dialect]string{
+		dialectPostgres: "SELECT pg_advisory_unlock(hashtext('trix_schema_migrations.' || current_schema()))",
+		dialectMySQL:    "SELECT RELEASE_LOCK(CONCAT('trix_schema_migrations.', DATABASE()))",
+	}
+)
+
+// migrationLockTimeout bounds the wait for MySQL's GET_LOCK, which has no
+// context to cancel it. PostgreSQL waits until ctx is done.
+const migrationLockTimeout = 10 * time.Minute
+
+func (d dialect) String() string {
+	if d == dialectMySQL {
+		return "mysql"
+	}
+	return "postgres"
+}
+
+// loadMigrations returns the embedded migrations for a dialect, in order.
+func loadMigrations(d dialect) ([]migration, error) {
+	dir := path.Join("migrations", d.String())
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []migration
+	seen := make(map[int]string)
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".sql") {
+			continue
+		}
+		name := strings.TrimSuffix(e.Name(), ".sql")
+		num, _, ok := strings.Cut(name, "_")
+		version, err := strconv.Atoi(num)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration file name %s (want NNNN_description.sql)", e.Name())
+		}
+		if other, dup := seen[version]; dup {
+			return nil, fmt.Errorf("duplicate migration version %d: %s and %s", version, other, name)
+		}
+		seen[version] = name
+
+		data, err := fs.ReadFile(migrationFiles, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, migration{version: version, name: name, sql: string(data)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+	return migrations, nil
+}
+
+// migrate applies pending migrations. It fails if the database has
+// migrations this binary doesn't know about, since the schema may have
+// changed in ways older code can't handle.
+func (db *DB) migrate(ctx context.Context) error {
+	migrations, err := loadMigrations(db.dialect)
+	if err != nil {
+		return fmt.Errorf("failed to load migrations: %w", err)
+	}
+	latest := 0
+	if len(migrations) > 0 {
+		latest = migrations[len(migrations)-1].version
+	}
+
+	// Advisory locks belong to a session, so lock, migrate and unlock on
+	// one connection
+	conn, err := db.conn.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+	if err := db.lockMigrations(ctx, conn); err != nil {
+		return err
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), migrationUnlockSQL[db.dialect]); err != nil {
+			db.logger.Warn("failed to release migration lock", "error", err)
+		}
+	}()
+
+	// Read the applied versions only once the lock is held, after any
+	// other replica has finished
+	if _, err := conn.ExecContext(ctx, schemaMigrationsDDL[db.dialect]); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	applied := make(map[int]bool)
+	current := 0
+	rows, err := conn.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	for rows.Next() {
+		var v int
+		if err := rows.Scan(&v); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		applied[v] = true
+		current = max(current, v)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if current > latest {
+		return fmt.Errorf("database schema version %d is newer than this binary supports (%d): upgrade trix", current, latest)
+	}
+
+	for _, m := range migrations {
+		if applied[m.version] {
+			continue
+		}
+		db.logger.Info("applying database migration", "version", m.version, "name", m.name, "dialect", db.dialect.String())
+		if err := db.applyMigration(ctx, conn, m); err != nil {
+			return fmt.Errorf("migration %s failed: %w", m.name, err)
+		}
+	}
+	return nil
+}
+
+// lockMigrations takes the migration lock on conn, waiting for another
+// process that holds it.
+func (db *DB) lockMigrations(ctx context.Context, conn *sql.Conn) error {
+	if db.dialect != dialectMySQL {
+		if _, err := conn.ExecContext(ctx, migrationLockSQL[db.dialect]); err != nil {
+			return fmt.Errorf("failed to lock schema_migrations: %w", err)
+		}
+		return nil
+	}
+
+	// GET_LOCK returns 1 once locked, 0 on timeout and NULL on error
+	var locked sql.NullInt64
+	err := conn.QueryRowContext(ctx, migrationLockSQL[db.dialect], int(migrationLockTimeout.Seconds())).Scan(&locked)
+	if err != nil {
+		return fmt.Errorf("failed to lock schema_migrations: %w", err)
+	}
+	if !locked.Valid || locked.Int64 != 1 {
+		return fmt.Errorf("failed to lock schema_migrations: not acquired within %v", migrationLockTimeout)
+	}
+	return nil
+}
+
+// applyMigration runs one migration and records it in one transaction.
+// MySQL commits DDL implicitly, so there a schema change is committed before
+// it is recorded, and a failed migration can't be rolled back. Each MySQL
+// migration therefore holds a single statement, so a failure never leaves
+// one partly applied.
+func (db *DB) applyMigration(ctx context.Context, conn *sql.Conn, m migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, stmt := range splitStatements(m.sql) {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+
+	insert, args := db.rebind("INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", []interface{}{m.version, m.name})
+	if _, err := tx.ExecContext(ctx, insert, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// splitStatements splits a migration file into statements on lines ending
+// with ';' and drops full-line comments. Migrations must not contain ';'
+// at the end of a line inside a statement.
+func splitStatements(sql string) []string {
+	var stmts []string
+	var b strings.Builder
+	for _, line := range strings.Split(sql, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		b.WriteString(line + "\n")
+		if strings.HasSuffix(trimmed, ";") {
+			stmts = append(stmts, strings.TrimSpace(b.String()))
+			b.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(b.String()); rest != "" {
+		stmts = append(stmts, rest)
+	}
+	return stmts
+}
@@ -0,0 +1,481 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	for _, d := range []dialect{dialectPostgres, dialectMySQL} {
+		t.Run(d.String(), func(t *testing.T) {
+			migrations, err := loadMigrations(d)
+			if err != nil {
+				t.Fatalf("loadMigrations: %v", err)
+			}
+			if len(migrations) == 0 {
+				t.Fatal("no migrations")
+			}
+			for i, m := range migrations {
+				if m.version != i+1 {
+					t.Errorf("migration %s has version %d, want %d", m.name, m.version, i+1)
+				}
+				if len(splitStatements(m.sql)) == 0 {
+					t.Errorf("migration %s has no statements", m.name)
+				}
+			}
+		})
+	}
+}
+
+// A failed MySQL migration can't be rolled back, so each holds a single
+// statement
+func TestMySQLMigrationsSingleStatement(t *testing.T) {
+	migrations, err := loadMigrations(dialectMySQL)
+	if err != nil {
+		t.Fatalf("loadMigrations: %v", err)
+	}
+	for _, m := range migrations {
+		if n := len(splitStatements(m.sql)); n != 1 {
+			t.Errorf("migration %s has %d statements, want 1", m.name, n)
+		}
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want []string
+	}{
+		{"empty", "", nil},
+		{"comments only", "-- nothing here\n\n", nil},
+		{"single", "-- comment\nCREATE INDEX a ON t(c);\n", []string{"CREATE INDEX a ON t(c);"}},
+		{
+			name: "multi-line statement",
+			sql:  "CREATE TABLE t (\n\tid INT,\n\t-- inline note\n\tname TEXT\n);\nDROP INDEX b;\n",
+			want: []string{"CREATE TABLE t (\n\tid INT,\n\tname TEXT\n);", "DROP INDEX b;"},
+		},
+		{"no trailing semicolon", "UPDATE t SET a = 1", []string{"UPDATE t SET a = 1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitStatements(tt.sql); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitStatements() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// testDatabase is an empty database for one test, on a server named by an
+// environment variable.
+type testDatabase struct {
+	url     string
+	dialect dialect
+	admin   *sql.DB // Connection to the test database, for setup and assertions
+}
+
+// testDatabases returns an isolated database on each configured server:
+// a schema on TRIX_TEST_POSTGRES_URL and a database on TRIX_TEST_MYSQL_URL.
+// Tests are skipped when neither is set.
+func testDatabases(t *testing.T) []testDatabase {
+	t.Helper()
+	var dbs []testDatabase
+	if base := os.Getenv("TRIX_TEST_POSTGRES_URL"); base != "" {
+		dbs = append(dbs, testPostgres(t, base))
+	}
+	if base := os.Getenv("TRIX_TEST_MYSQL_URL"); base != "" {
+		dbs = append(dbs, testMySQL(t, base))
+	}
+	if len(dbs) == 0 {
+		t.Skip("set TRIX_TEST_POSTGRES_URL or TRIX_TEST_MYSQL_URL to run database tests")
+	}
+	return dbs
+}
+
+// testDatabaseName returns a unique name for a test schema or database
+func testDatabaseName() string {
+	return fmt.Sprintf("trix_test_%d", time.Now().UnixNano())
+}
+
+// testPostgres creates a schema on the PostgreSQL server at base, dropped
+// when the test ends
+func testPostgres(t *testing.T, base string) testDatabase {
+	t.Helper()
+	name := testDatabaseName()
+	u, err := url.Parse(base)
+	if err != nil {
+		t.Fatalf("TRIX_TEST_POSTGRES_URL: %v", err)
+	}
+	q := u.Query()
+	q.Set("search_path", name)
+	u.RawQuery = q.Encode()
+
+	server := openTestConn(t, "postgres", base)
+	execTest(t, server, "CREATE SCHEMA "+name)
+	t.Cleanup(func() { _, _ = server.Exec("DROP SCHEMA " + name + " CASCADE") })
+
+	return testDatabase{url: u.String(), dialect: dialectPostgres, admin: openTestConn(t, "postgres", u.String())}
+}
+
+// testMySQL creates a database on the MySQL server at base, dropped when the
+// test ends
+func testMySQL(t *testing.T, base string) testDatabase {
+	t.Helper()
+	name := testDatabaseName()
+	u, err := url.Parse(base)
+	if err != nil {
+		t.Fatalf("TRIX_TEST_MYSQL_URL: %v", err)
+	}
+	dsn, err := mysqlDSN(base)
+	if err != nil {
+		t.Fatalf("TRIX_TEST_MYSQL_URL: %v", err)
+	}
+	server := openTestConn(t, "mysql", dsn)
+	execTest(t, server, "CREATE DATABASE "+name)
+	t.Cleanup(func() { _, _ = server.Exec("DROP DATABASE " + name) })
+
+	u.Path = "/" + name
+	dsn, err = mysqlDSN(u.String())
+	if err != nil {
+		t.Fatalf("mysqlDSN: %v", err)
+	}
+	return testDatabase{url: u.String(), dialect: dialectMySQL, admin: openTestConn(t, "mysql", dsn)}
+}
+
+func openTestConn(t *testing.T, driver, dsn string) *sql.DB {
+	t.Helper()
+	conn, err := sql.Open(driver, dsn)
+	if err != nil {
+		t.Fatalf("open %s: %v", driver, err)
+	}
+	conn.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func execTest(t *testing.T, conn *sql.DB, query string, args ...interface{}) {
+	t.Helper()
+	if _, err := conn.Exec(query, args...); err != nil {
+		t.Fatalf("%s: %v", strings.SplitN(strings.TrimSpace(query), "\n", 2)[0], err)
+	}
+}
+
+// openTestDB runs NewDB against tdb
+func openTestDB(t *testing.T, tdb testDatabase) *DB {
+	t.Helper()
+	db, err := NewDB(context.Background(), testConfig(t, map[string]string{"TRIX_DATABASE_URL": tdb.url}), testLogger())
+	if err != nil {
+		t.Fatalf("NewDB: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+func schemaVersion(t *testing.T, conn *sql.DB) int {
+	t.Helper()
+	var v int
+	if err := conn.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&v); err != nil {
+		t.Fatalf("read schema version: %v", err)
+	}
+	return v
+}
+
+func latestMigration(t *testing.T, d dialect) int {
+	t.Helper()
+	migrations, err := loadMigrations(d)
+	if err != nil {
+		t.Fatalf("loadMigrations: %v", err)
+	}
+	return migrations[len(migrations)-1].version
+}
+
+func testRecord(id string) *VulnerabilityRecord {
+	return &VulnerabilityRecord{
+		ID:        id,
+		CVE:       "CVE-2024-" + id,
+		Workload:  "default/deployment/app",
+		Namespace: "default",
+		Severity:  "HIGH",
+		Image:     "example/app:latest",
+	}
+}
+
+func unsyncedIDs(t *testing.T, db *DB) []string {
+	t.Helper()
+	vulns, err := db.GetUnsyncedVulnerabilities(context.Background())
+	if err != nil {
+		t.Fatalf("GetUnsyncedVulnerabilities: %v", err)
+	}
+	var ids []string
+	for _, v := range vulns {
+		ids = append(ids, v.ID)
+	}
+	return ids
+}
+
+func TestMigrateFreshDatabase(t *testing.T) {
+	for _, tdb := range testDatabases(t) {
+		t.Run(tdb.dialect.String(), func(t *testing.T) {
+			ctx := context.Background()
+			db := openTestDB(t, tdb)
+			if got, want := schemaVersion(t, tdb.admin), latestMigration(t, tdb.dialect); got != want {
+				t.Fatalf("schema version = %d, want %d", got, want)
+			}
+
+			if _, err := db.UpsertVulnerability(ctx, testRecord("1")); err != nil {
+				t.Fatalf("UpsertVulnerability: %v", err)
+			}
+			if got := unsyncedIDs(t, db); !reflect.DeepEqual(got, []string{"1"}) {
+				t.Fatalf("unsynced = %v, want [1]", got)
+			}
+			if err := db.MarkSaasSynced(ctx, []string{"1"}); err != nil {
+				t.Fatalf("MarkSaasSynced: %v", err)
+			}
+			if got := unsyncedIDs(t, db); len(got) != 0 {
+				t.Fatalf("unsynced after MarkSaasSynced = %v, want none", got)
+			}
+
+			// Running again applies nothing
+			_ = openTestDB(t, tdb)
+			var n int
+			if err := tdb.admin.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&n); err != nil {
+				t.Fatal(err)
+			}
+			if want := latestMigration(t, tdb.dialect); n != want {
+				t.Fatalf("schema_migrations has %d rows, want %d", n, want)
+			}
+		})
+	}
+}
+
+// legacySchema is the schema the unversioned migrate() built before
+// migrations were numbered
+var legacySchema = []string{
+	`CREATE TABLE vulnerabilities (
+		id TEXT PRIMARY KEY,
+		cve TEXT NOT NULL,
+		workload TEXT NOT NULL,
+		severity TEXT NOT NULL,
+		image TEXT,
+		state TEXT NOT NULL DEFAULT 'OPEN',
+		first_seen TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		last_seen TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		fixed_at TIMESTAMPTZ
+	)`,
+	"CREATE INDEX idx_vuln_state ON vulnerabilities(state)",
+	"CREATE INDEX idx_vuln_severity ON vulnerabilities(severity)",
+	"CREATE INDEX idx_vuln_cve ON vulnerabilities(cve)",
+	"CREATE INDEX idx_vuln_workload ON vulnerabilities(workload)",
+	"ALTER TABLE vulnerabilities ADD COLUMN saas_synced BOOLEAN NOT NULL DEFAULT FALSE",
+	"CREATE INDEX idx_vuln_saas_synced ON vulnerabilities(saas_synced) WHERE NOT saas_synced",
+	"ALTER TABLE vulnerabilities ADD COLUMN container_name TEXT",
+	"ALTER TABLE vulnerabilities ADD COLUMN image_repository TEXT",
+	"ALTER TABLE vulnerabilities ADD COLUMN image_tag TEXT",
+	"ALTER TABLE vulnerabilities ADD COLUMN image_digest TEXT",
+	"CREATE INDEX idx_vuln_image_digest ON vulnerabilities(image_digest) WHERE image_digest IS NOT NULL",
+}
+
+// Databases created before versioned migrations are adopted as they are.
+// Synced rows get a synced_at, and rows still waiting for the SaaS stay
+// queued.
+func TestMigrateUpgradeFromLegacySchema(t *testing.T) {
+	for _, tdb := range testDatabases(t) {
+		if tdb.dialect != dialectPostgres {
+			continue // MySQL support started with versioned migrations
+		}
+		t.Run(tdb.dialect.String(), func(t *testing.T) {
+			ctx := context.Background()
+			for _, stmt := range legacySchema {
+				execTest(t, tdb.admin, stmt)
+			}
+			lastSeen := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+			for i, row := range []struct {
+				id     string
+				synced bool
+			}{{"synced", true}, {"pending", false}} {
+				execTest(t, tdb.admin,
+					`INSERT INTO vulnerabilities (id, cve, workload, severity, container_name, image_digest, saas_synced, first_seen, last_seen)
+					VALUES ($1, 'CVE-2023-1', 'default/deployment/app', 'HIGH', 'app', 'sha256:abc', $2, $3, $4)`,
+					row.id, row.synced, lastSeen.Add(-time.Duration(i+1)*time.Hour), lastSeen)
+			}
+
+			db := openTestDB(t, tdb)
+			if got, want := schemaVersion(t, tdb.admin), latestMigration(t, tdb.dialect); got != want {
+				t.Fatalf("schema version = %d, want %d", got, want)
+			}
+
+			want := map[string]bool{"synced": true, "pending": false}
+			rows, err := tdb.admin.Query("SELECT id, saas_synced, synced_at, container_name, image_digest FROM vulnerabilities ORDER BY id")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = rows.Close() }()
+			for rows.Next() {
+				var id, container, digest string
+				var synced bool
+				var syncedAt sql.NullTime
+				if err := rows.Scan(&id, &synced, &syncedAt, &container, &digest); err != nil {
+					t.Fatal(err)
+				}
+				if synced != want[id] {
+					t.Errorf("%s: saas_synced = %v, want %v", id, synced, want[id])
+				}
+				if synced && (!syncedAt.Valid || !syncedAt.Time.Equal(lastSeen)) {
+					t.Errorf("%s: synced_at = %v, want %v", id, syncedAt, lastSeen)
+				}
+				if !synced && syncedAt.Valid {
+					t.Errorf("%s: synced_at = %v, want NULL", id, syncedAt.Time)
+				}
+				if container != "app" || digest != "sha256:abc" {
+					t.Errorf("%s: container_name, image_digest = %q, %q, want app, sha256:abc", id, container, digest)
+				}
+			}
+			if err := rows.Err(); err != nil {
+				t.Fatal(err)
+			}
+
+			// Pending rows are sent first, then rows written after the upgrade
+			if _, err := db.UpsertVulnerability(ctx, testRecord("new")); err != nil {
+				t.Fatalf("UpsertVulnerability: %v", err)
+			}
+			if got := unsyncedIDs(t, db); !reflect.DeepEqual(got, []string{"pending", "new"}) {
+				t.Fatalf("unsynced = %v, want [pending new]", got)
+			}
+		})
+	}
+}
+
+func TestMigrateRejectsNewerSchema(t *testing.T) {
+	for _, tdb := range testDatabases(t) {
+		t.Run(tdb.dialect.String(), func(t *testing.T) {
+			_ = openTestDB(t, tdb)
+			future := latestMigration(t, tdb.dialect) + 1
+			insert := "INSERT INTO schema_migrations (version, name) VALUES ($1, 'future')"
+			if tdb.dialect == dialectMySQL {
+				insert = "INSERT INTO schema_migrations (version, name) VALUES (?, 'future')"
+			}
+			execTest(t, tdb.admin, insert, future)
+
+			_, err := NewDB(context.Background(), testConfig(t, map[string]string{"TRIX_DATABASE_URL": tdb.url}), testLogger())
+			if err == nil || !strings.Contains(err.Error(), "newer than this binary") {
+				t.Fatalf("NewDB error = %v, want schema version error", err)
+			}
+		})
+	}
+}
+
+// Replicas starting together apply each migration once, and none of them
+// fails on the others' tables
+func TestMigrateConcurrently(t *testing.T) {
+	for _, tdb := range testDatabases(t) {
+		t.Run(tdb.dialect.String(), func(t *testing.T) {
+			cfg := testConfig(t, map[string]string{"TRIX_DATABASE_URL": tdb.url})
+			errs := make(chan error, 4)
+			for i := 0; i < cap(errs); i++ {
+				go func() {
+					db, err := NewDB(context.Background(), cfg, testLogger())
+					if err == nil {
+						_ = db.Close()
+					}
+					errs <- err
+				}()
+			}
+			for i := 0; i < cap(errs); i++ {
+				if err := <-errs; err != nil {
+					t.Errorf("NewDB: %v", err)
+				}
+			}
+
+			var n int
+			if err := tdb.admin.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&n); err != nil {
+				t.Fatal(err)
+			}
+			if want := latestMigration(t, tdb.dialect); n != want {
+				t.Errorf("schema_migrations has %d rows, want %d", n, want)
+			}
+		})
+	}
+}
+
+// A database left at an older version by a previous release gets only the
+// migrations it lacks, each logged, and keeps its data.
+func TestMigrateFromOlderVersion(t *testing.T) {
+	for _, tdb := range testDatabases(t) {
+		t.Run(tdb.dialect.String(), func(t *testing.T) {
+			ctx := context.Background()
+			migrations, err := loadMigrations(tdb.dialect)
+			if err != nil {
+				t.Fatal(err)
+			}
+			old := len(migrations) / 2
+			legacy := &DB{conn: tdb.admin, dialect: tdb.dialect, logger: testLogger()}
+			execTest(t, tdb.admin, schemaMigrationsDDL[tdb.dialect])
+			conn, err := tdb.admin.Conn(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, m := range migrations[:old] {
+				if err := legacy.applyMigration(ctx, conn, m); err != nil {
+					t.Fatalf("apply %s: %v", m.name, err)
+				}
+			}
+			_ = conn.Close()
+			execTest(t, tdb.admin, "INSERT INTO vulnerabilities (id, cve, workload, severity, image) VALUES ('old', 'CVE-2023-1', 'default/deployment/app', 'HIGH', 'app:1')")
+
+			var logs strings.Builder
+			db, err := NewDB(ctx, testConfig(t, map[string]string{"TRIX_DATABASE_URL": tdb.url}),
+				slog.New(slog.NewTextHandler(&logs, nil)))
+			if err != nil {
+				t.Fatalf("NewDB: %v", err)
+			}
+			t.Cleanup(func() { _ = db.Close() })
+
+			if got, want := schemaVersion(t, tdb.admin), latestMigration(t, tdb.dialect); got != want {
+				t.Errorf("schema version = %d, want %d", got, want)
+			}
+			if n, want := strings.Count(logs.String(), "applying database migration"), len(migrations)-old; n != want {
+				t.Errorf("%d migrations logged, want %d:\n%s", n, want, logs.String())
+			}
+			if !strings.Contains(logs.String(), "name="+migrations[old].name) || strings.Contains(logs.String(), "name="+migrations[old-1].name) {
+				t.Errorf("migrations logged:\n%s", logs.String())
+			}
+
+			v, err := db.GetVulnerability(ctx, "old")
+			if err != nil || v == nil {
+				t.Fatalf("GetVulnerability(old) = %v, %v", v, err)
+			}
+			if v.CVE != "CVE-2023-1" || v.State != StateOpen || v.Kind != KindVulnerability {
+				t.Errorf("old row after the upgrade = %+v", v)
+			}
+		})
+	}
+}
+
+// A failing migration is not recorded, so the next start retries it
+func TestMigrateFailureNotRecorded(t *testing.T) {
+	for _, tdb := range testDatabases(t) {
+		t.Run(tdb.dialect.String(), func(t *testing.T) {
+			db := openTestDB(t, tdb)
+			conn, err := db.conn.Conn(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = conn.Close() }()
+			broken := migration{version: 9999, name: "9999_broken", sql: "SELECT missing FROM nowhere;\n"}
+			if err := db.applyMigration(context.Background(), conn, broken); err == nil {
+				t.Fatal("broken migration applied")
+			}
+			if got, want := schemaVersion(t, tdb.admin), latestMigration(t, tdb.dialect); got != want {
+				t.Errorf("schema version = %d after a failed migration, want %d", got, want)
+			}
+		})
+	}
+}
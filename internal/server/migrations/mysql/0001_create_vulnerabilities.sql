@@ -0,0 +1,24 @@
+-- Full schema for MySQL/MariaDB, including the saas_synced and container
+-- tracking columns that PostgreSQL gained in later migrations.
+CREATE TABLE IF NOT EXISTS vulnerabilities (
+	id VARCHAR(64) NOT NULL PRIMARY KEY,
+	cve VARCHAR(255) NOT NULL,
+	workload VARCHAR(512) NOT NULL,
+	severity VARCHAR(16) NOT NULL,
+	image TEXT,
+	state VARCHAR(16) NOT NULL DEFAULT 'OPEN',
+	first_seen DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+	last_seen DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+	fixed_at DATETIME(6) NULL,
+	saas_synced BOOLEAN NOT NULL DEFAULT FALSE,
+	container_name TEXT,
+	image_repository TEXT,
+	image_tag TEXT,
+	image_digest VARCHAR(255),
+	INDEX idx_vuln_state (state),
+	INDEX idx_vuln_severity (severity),
+	INDEX idx_vuln_cve (cve),
+	INDEX idx_vuln_workload (workload),
+	INDEX idx_vuln_saas_synced (saas_synced),
+	INDEX idx_vuln_image_digest (image_digest)
+) DEFAULT CHARSET = utf8mb4;
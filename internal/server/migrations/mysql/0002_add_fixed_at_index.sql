@@ -0,0 +1,2 @@
+-- Retention pruning deletes FIXED rows by fixed_at
+CREATE INDEX idx_vuln_fixed_at ON vulnerabilities(fixed_at);
@@ -0,0 +1,10 @@
+-- One row per poll with post-reconciliation counts, for trend reporting
+CREATE TABLE IF NOT EXISTS snapshots (
+	id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+	taken_at DATETIME(6) NOT NULL,
+	total_open INT NOT NULL,
+	total_fixed INT NOT NULL,
+	by_severity JSON NOT NULL,
+	by_namespace JSON NOT NULL,
+	INDEX idx_snapshots_taken_at (taken_at)
+) DEFAULT CHARSET = utf8mb4;
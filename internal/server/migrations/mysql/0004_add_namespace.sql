@@ -0,0 +1,3 @@
+-- Namespace of the workload, so reconciliation can be scoped to the watched
+-- namespaces. Cluster-scoped reports have an empty namespace.
+ALTER TABLE vulnerabilities ADD COLUMN namespace VARCHAR(253) NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+-- Existing rows take the namespace from their workload
+UPDATE vulnerabilities SET namespace = SUBSTRING_INDEX(workload, '/', 1) WHERE namespace = '';
@@ -0,0 +1,2 @@
+-- Scoped reconciliation reads open rows per namespace
+CREATE INDEX idx_vuln_namespace_state ON vulnerabilities(namespace, state);
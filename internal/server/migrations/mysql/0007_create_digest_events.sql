@@ -0,0 +1,9 @@
+-- Events held back for a scheduled digest, per notification channel.
+-- Rows are deleted once the digest containing them has been sent.
+CREATE TABLE IF NOT EXISTS digest_events (
+	id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+	channel VARCHAR(32) NOT NULL,
+	event JSON NOT NULL,
+	queued_at DATETIME(6) NOT NULL,
+	INDEX idx_digest_events_channel (channel, id)
+) DEFAULT CHARSET = utf8mb4;
@@ -0,0 +1,7 @@
+-- Timestamp of the last Slack message that reported new vulnerabilities in a
+-- workload, so FIXED messages can reply in its thread.
+CREATE TABLE IF NOT EXISTS slack_threads (
+	workload VARCHAR(512) NOT NULL PRIMARY KEY,
+	ts VARCHAR(32) NOT NULL,
+	updated_at DATETIME(6) NOT NULL
+) DEFAULT CHARSET = utf8mb4;
@@ -0,0 +1,16 @@
+-- Notifications a channel failed to deliver, retried with backoff by the
+-- poll loop. Rows keep the event as sent so retries don't depend on the
+-- vulnerability row, which may have changed or been pruned.
+CREATE TABLE IF NOT EXISTS deliveries (
+	id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+	event_id VARCHAR(64) NOT NULL,
+	channel VARCHAR(32) NOT NULL,
+	event JSON NOT NULL,
+	attempts INT NOT NULL DEFAULT 0,
+	last_error TEXT NOT NULL,
+	next_attempt_at DATETIME(6) NOT NULL,
+	delivered_at DATETIME(6) NULL,
+	created_at DATETIME(6) NOT NULL,
+	INDEX idx_deliveries_pending (delivered_at, next_attempt_at),
+	INDEX idx_deliveries_created_at (created_at)
+) DEFAULT CHARSET = utf8mb4;
@@ -0,0 +1,3 @@
+-- Why a delivery row was never sent (interval, overflow); empty for real
+-- deliveries. Suppressed rows are written as delivered so they aren't retried.
+ALTER TABLE deliveries ADD COLUMN suppressed VARCHAR(32) NOT NULL DEFAULT '';
@@ -0,0 +1,7 @@
+-- Last time each workload was listed in a Slack, Teams or email
+-- notification, for TRIX_NOTIFY_WORKLOAD_INTERVAL.
+CREATE TABLE IF NOT EXISTS workload_notifications (
+	workload VARCHAR(512) NOT NULL PRIMARY KEY,
+	notified_at DATETIME(6) NOT NULL,
+	INDEX idx_workload_notifications_notified_at (notified_at)
+) DEFAULT CHARSET = utf8mb4;
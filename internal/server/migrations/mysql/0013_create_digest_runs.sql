@@ -0,0 +1,8 @@
+-- What the last TRIX_DIGEST_SCHEDULE digest on each channel reported, so the
+-- next one can show the trend.
+CREATE TABLE IF NOT EXISTS digest_runs (
+	channel VARCHAR(32) NOT NULL PRIMARY KEY,
+	sent_at DATETIME(6) NOT NULL,
+	new_count INT NOT NULL,
+	fixed_count INT NOT NULL
+) DEFAULT CHARSET = utf8mb4;
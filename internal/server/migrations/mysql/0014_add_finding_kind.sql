@@ -0,0 +1,3 @@
+-- Exposed secrets and config audit findings share the vulnerabilities
+-- table. cve holds the secret rule or config check ID for those kinds.
+ALTER TABLE vulnerabilities ADD COLUMN kind VARCHAR(32) NOT NULL DEFAULT 'vulnerability';
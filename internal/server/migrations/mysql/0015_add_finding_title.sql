@@ -0,0 +1,2 @@
+-- Title of a secret or config audit finding
+ALTER TABLE vulnerabilities ADD COLUMN title TEXT NULL;
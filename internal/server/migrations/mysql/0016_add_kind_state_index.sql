@@ -0,0 +1,2 @@
+-- Tracked kinds are reconciled separately
+CREATE INDEX idx_vuln_kind_state ON vulnerabilities(kind, state);
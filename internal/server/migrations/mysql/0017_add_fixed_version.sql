@@ -0,0 +1,2 @@
+-- Version that fixes a vulnerability, from the report
+ALTER TABLE vulnerabilities ADD COLUMN fixed_version TEXT NULL;
@@ -0,0 +1,2 @@
+-- The workload's network exposure when TRIX_EXPOSURE_ENRICH is on
+ALTER TABLE vulnerabilities ADD COLUMN exposure VARCHAR(32) NULL;
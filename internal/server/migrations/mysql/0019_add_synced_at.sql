@@ -0,0 +1,2 @@
+-- When each vulnerability was last delivered to the SaaS endpoint
+ALTER TABLE vulnerabilities ADD COLUMN synced_at DATETIME(6) NULL;
@@ -0,0 +1,2 @@
+-- Rows synced before synced_at existed get their last_seen as an approximation
+UPDATE vulnerabilities SET synced_at = last_seen WHERE saas_synced AND synced_at IS NULL;
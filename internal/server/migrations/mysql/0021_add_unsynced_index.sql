@@ -0,0 +1,2 @@
+-- Unsynced rows are read oldest first
+CREATE INDEX idx_vuln_unsynced ON vulnerabilities(saas_synced, first_seen);
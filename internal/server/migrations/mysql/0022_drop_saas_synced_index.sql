@@ -0,0 +1,2 @@
+-- Superseded by idx_vuln_unsynced
+DROP INDEX idx_vuln_saas_synced ON vulnerabilities;
@@ -0,0 +1,18 @@
+-- Base vulnerability table. IF NOT EXISTS so databases created before
+-- versioned migrations are adopted as-is.
+CREATE TABLE IF NOT EXISTS vulnerabilities (
+	id TEXT PRIMARY KEY,
+	cve TEXT NOT NULL,
+	workload TEXT NOT NULL,
+	severity TEXT NOT NULL,
+	image TEXT,
+	state TEXT NOT NULL DEFAULT 'OPEN',
+	first_seen TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	last_seen TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	fixed_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_vuln_state ON vulnerabilities(state);
+CREATE INDEX IF NOT EXISTS idx_vuln_severity ON vulnerabilities(severity);
+CREATE INDEX IF NOT EXISTS idx_vuln_cve ON vulnerabilities(cve);
+CREATE INDEX IF NOT EXISTS idx_vuln_workload ON vulnerabilities(workload);
@@ -0,0 +1,7 @@
+-- Per-container image tracking
+ALTER TABLE vulnerabilities ADD COLUMN IF NOT EXISTS container_name TEXT;
+ALTER TABLE vulnerabilities ADD COLUMN IF NOT EXISTS image_repository TEXT;
+ALTER TABLE vulnerabilities ADD COLUMN IF NOT EXISTS image_tag TEXT;
+ALTER TABLE vulnerabilities ADD COLUMN IF NOT EXISTS image_digest TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_vuln_image_digest ON vulnerabilities(image_digest) WHERE image_digest IS NOT NULL;
@@ -0,0 +1,11 @@
+-- One row per poll with post-reconciliation counts, for trend reporting
+CREATE TABLE IF NOT EXISTS snapshots (
+	id BIGSERIAL PRIMARY KEY,
+	taken_at TIMESTAMPTZ NOT NULL,
+	total_open INTEGER NOT NULL,
+	total_fixed INTEGER NOT NULL,
+	by_severity JSONB NOT NULL,
+	by_namespace JSONB NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_snapshots_taken_at ON snapshots(taken_at);
@@ -0,0 +1,7 @@
+-- Namespace of the workload, so reconciliation can be scoped to the watched
+-- namespaces. Cluster-scoped reports have an empty namespace.
+ALTER TABLE vulnerabilities ADD COLUMN IF NOT EXISTS namespace TEXT NOT NULL DEFAULT '';
+
+UPDATE vulnerabilities SET namespace = split_part(workload, '/', 1) WHERE namespace = '';
+
+CREATE INDEX IF NOT EXISTS idx_vuln_namespace_state ON vulnerabilities(namespace, state);
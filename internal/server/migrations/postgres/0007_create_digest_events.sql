@@ -0,0 +1,10 @@
+-- Events held back for a scheduled digest, per notification channel.
+-- Rows are deleted once the digest containing them has been sent.
+CREATE TABLE IF NOT EXISTS digest_events (
+	id BIGSERIAL PRIMARY KEY,
+	channel VARCHAR(32) NOT NULL,
+	event JSONB NOT NULL,
+	queued_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_digest_events_channel ON digest_events(channel, id);
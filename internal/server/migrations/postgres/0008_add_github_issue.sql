@@ -0,0 +1,3 @@
+-- GitHub issue filed for the vulnerability, shared by all rows with the same
+-- CVE and workload. NULL when no issue was filed.
+ALTER TABLE vulnerabilities ADD COLUMN IF NOT EXISTS github_issue INTEGER;
@@ -0,0 +1,7 @@
+-- Timestamp of the last Slack message that reported new vulnerabilities in a
+-- workload, so FIXED messages can reply in its thread.
+CREATE TABLE IF NOT EXISTS slack_threads (
+	workload TEXT PRIMARY KEY,
+	ts TEXT NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,17 @@
+-- Notifications a channel failed to deliver, retried with backoff by the
+-- poll loop. Rows keep the event as sent so retries don't depend on the
+-- vulnerability row, which may have changed or been pruned.
+CREATE TABLE IF NOT EXISTS deliveries (
+	id BIGSERIAL PRIMARY KEY,
+	event_id TEXT NOT NULL,
+	channel VARCHAR(32) NOT NULL,
+	event JSONB NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT NOT NULL DEFAULT '',
+	next_attempt_at TIMESTAMPTZ NOT NULL,
+	delivered_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_deliveries_pending ON deliveries(delivered_at, next_attempt_at);
+CREATE INDEX IF NOT EXISTS idx_deliveries_created_at ON deliveries(created_at);
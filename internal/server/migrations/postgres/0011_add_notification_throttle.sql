@@ -0,0 +1,12 @@
+-- Why a delivery row was never sent (interval, overflow); empty for real
+-- deliveries. Suppressed rows are written as delivered so they aren't retried.
+ALTER TABLE deliveries ADD COLUMN IF NOT EXISTS suppressed VARCHAR(32) NOT NULL DEFAULT '';
+
+-- Last time each workload was listed in a Slack, Teams or email
+-- notification, for TRIX_NOTIFY_WORKLOAD_INTERVAL.
+CREATE TABLE IF NOT EXISTS workload_notifications (
+	workload TEXT PRIMARY KEY,
+	notified_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_workload_notifications_notified_at ON workload_notifications(notified_at);
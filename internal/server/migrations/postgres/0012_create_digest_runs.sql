@@ -0,0 +1,8 @@
+-- What the last TRIX_DIGEST_SCHEDULE digest on each channel reported, so the
+-- next one can show the trend.
+CREATE TABLE IF NOT EXISTS digest_runs (
+	channel VARCHAR(32) PRIMARY KEY,
+	sent_at TIMESTAMPTZ NOT NULL,
+	new_count INTEGER NOT NULL,
+	fixed_count INTEGER NOT NULL
+);
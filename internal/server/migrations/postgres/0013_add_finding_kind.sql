@@ -0,0 +1,6 @@
+-- Exposed secrets and config audit findings share the vulnerabilities
+-- table. cve holds the secret rule or config check ID for those kinds.
+ALTER TABLE vulnerabilities ADD COLUMN IF NOT EXISTS kind VARCHAR(32) NOT NULL DEFAULT 'vulnerability';
+ALTER TABLE vulnerabilities ADD COLUMN IF NOT EXISTS title TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_vuln_kind_state ON vulnerabilities(kind, state);
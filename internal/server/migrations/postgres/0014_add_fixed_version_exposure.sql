@@ -0,0 +1,4 @@
+-- Version that fixes a vulnerability, from the report, and the workload's
+-- network exposure when TRIX_EXPOSURE_ENRICH is on.
+ALTER TABLE vulnerabilities ADD COLUMN IF NOT EXISTS fixed_version TEXT;
+ALTER TABLE vulnerabilities ADD COLUMN IF NOT EXISTS exposure VARCHAR(32);
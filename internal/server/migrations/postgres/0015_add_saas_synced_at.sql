@@ -0,0 +1,8 @@
+-- When each vulnerability was last delivered to the SaaS endpoint. Rows
+-- synced before this migration get their last_seen as an approximation.
+ALTER TABLE vulnerabilities ADD COLUMN IF NOT EXISTS synced_at TIMESTAMPTZ;
+UPDATE vulnerabilities SET synced_at = last_seen WHERE saas_synced AND synced_at IS NULL;
+
+-- Unsynced rows are read oldest first
+CREATE INDEX IF NOT EXISTS idx_vuln_unsynced ON vulnerabilities(first_seen) WHERE NOT saas_synced;
+DROP INDEX IF EXISTS idx_vuln_saas_synced;
@@ -7,15 +7,23 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
-)
 
-const (
-	saasBatchSize  = 50 // Send events in batches to avoid timeouts
-	saasMaxRetries = 3  // Number of retries per batch
+	"github.com/trixsec-dev/trix/pkg/webhook"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+const saasMaxRetries = 3 // Number of retries per batch
+
+// saasBackoff is the wait before the first retry of a SaaS batch, doubling
+// after each further attempt. A variable so tests can shorten it.
+var saasBackoff = time.Second
+
 // SaasResult contains the result of a SaaS sync operation.
 type SaasResult struct {
 	SyncedIDs []string // IDs that were successfully synced
@@ -24,80 +32,176 @@ type SaasResult struct {
 }
 
 type Notifier struct {
-	config     *Config
-	httpClient *http.Client
-	logger     *slog.Logger
+	config      *Config
+	store       Store // Holds queued digest events
+	httpClient  *http.Client
+	webhookHTTP *http.Client // Generic webhook, with its own timeout
+	logger      *slog.Logger
+	tracer      trace.Tracer
+	cluster     *clusterInfo // Cluster block of SaaS and initialized payloads
+
+	githubMu          sync.Mutex
+	githubKnownLabels map[string]bool // Labels known to exist in the GitHub repo
 }
 
-func NewNotifier(config *Config, logger *slog.Logger) *Notifier {
+func NewNotifier(config *Config, store Store, logger *slog.Logger) *Notifier {
+	webhookTLS := config.WebhookTLS
+	if webhookTLS == nil {
+		webhookTLS = config.ClientTLS
+	}
 	return &Notifier{
-		config: config,
-		httpClient: &http.Client{
-			Timeout: 10 * time.Second,
-		},
-		logger: logger,
+		config:            config,
+		store:             store,
+		httpClient:        httpClient(config.ClientTLS, config.HTTPProxy, 10*time.Second),
+		webhookHTTP:       httpClient(webhookTLS, config.HTTPProxy, config.WebhookTimeout),
+		logger:            logger,
+		tracer:            noopTracer,
+		cluster:           newClusterInfo(config, nil, logger),
+		githubKnownLabels: make(map[string]bool),
 	}
 }
 
 // NotifyInitialized sends a summary notification on first poll.
-// Returns SaasResult for tracking which events were synced.
-func (n *Notifier) NotifyInitialized(ctx context.Context, events []VulnerabilityEvent) *SaasResult {
-	if n.config.SlackWebhook != "" {
-		if err := n.sendSlackSummary(ctx, events); err != nil {
+// Summaries are not tracked for redelivery; only SaaS results are returned.
+func (n *Notifier) NotifyInitialized(ctx context.Context, events []VulnerabilityEvent) *NotifyResult {
+	if n.config.slackEnabled() {
+		if err := n.traceSend(ctx, "trix.notify_summary", channelSlack, len(events), func(ctx context.Context) error {
+			return n.sendSlackSummary(ctx, events)
+		}); err != nil {
 			n.logger.Error("slack init notification failed", "error", err)
 		}
 	}
 
+	if n.config.TeamsWebhook != "" {
+		if err := n.traceSend(ctx, "trix.notify_summary", channelTeams, len(events), func(ctx context.Context) error {
+			return n.sendTeamsSummary(ctx, events)
+		}); err != nil {
+			n.logger.Error("teams init notification failed", "error", err)
+		}
+	}
+
+	if n.config.SMTPHost != "" {
+		if err := n.traceSend(ctx, "trix.notify_summary", channelEmail, len(events), func(ctx context.Context) error {
+			return n.sendEmailSummary(ctx, events)
+		}); err != nil {
+			n.logger.Error("email init notification failed", "error", err)
+		}
+	}
+
 	if n.config.GenericWebhook != "" {
-		if err := n.sendWebhookSummary(ctx, events); err != nil {
+		if err := n.traceSend(ctx, "trix.notify_summary", channelWebhook, len(events), func(ctx context.Context) error {
+			return n.sendWebhookSummary(ctx, events)
+		}); err != nil {
 			n.logger.Error("webhook init notification failed", "error", err)
 		}
 	}
 
 	// SaaS gets individual vulnerabilities with retry logic
-	return n.SendSaas(ctx, events)
+	return &NotifyResult{Saas: n.SendSaas(ctx, events)}
 }
 
-// Notify sends notifications for new/changed events.
-// Returns SaasResult for tracking which events were synced.
+// Notify sends notifications for new/changed events and returns which
+// events each channel delivered or failed, so failures can be retried.
 //
-// Note: Slack/Webhook get severity-filtered events, but SaaS receives ALL events
-// regardless of severity filter. This is intentional - the SaaS dashboard handles
-// its own filtering and needs complete data for accurate tracking.
-func (n *Notifier) Notify(ctx context.Context, events []VulnerabilityEvent) *SaasResult {
-	// Filter by severity for Slack/Webhook notifications only
-	filtered := n.filterBySeverity(events)
-
-	// Early return only affects Slack/Webhook - SaaS still gets all events below
-	if len(filtered) == 0 && n.config.SaasEndpoint == "" {
-		return &SaasResult{}
-	}
+// Each channel gets the events at or above its own threshold (see
+// Config.channelSeverity). SaaS receives ALL events unless TRIX_SAAS_SEVERITY
+// is set: the SaaS dashboard handles its own filtering and needs complete
+// data for accurate tracking. With TRIX_DIGEST_SCHEDULE, events below a
+// channel's threshold are queued for its digest.
+func (n *Notifier) Notify(ctx context.Context, events []VulnerabilityEvent) *NotifyResult {
+	result := &NotifyResult{}
+
+	if n.config.DigestSchedule != nil {
+		n.queueDigest(ctx, events)
+	}
+
+	// Slack, Teams and email are throttled per workload and capped per call.
+	// Throttling runs once over everything any of them would show, so a
+	// workload counts as notified across channels.
+	var t *throttled
+	var throttledChannels []string
+	for _, channel := range n.channels() {
+		minSeverity := n.config.channelSeverity(channel)
+		channelEvents := filterBySeverity(events, minSeverity)
+		if channel == channelGitHub {
+			// GitHub applies its threshold to new issues only and closes
+			// issues on FIXED events of any severity
+			channelEvents = events
+		}
+		if n.throttles(channel) && len(channelEvents) > 0 {
+			if t == nil {
+				split := n.throttle(ctx, filterBySeverity(events, n.throttledSeverity()))
+				t = &split
+			}
+			channelEvents = filterBySeverity(t.Shown, minSeverity)
+			throttledChannels = append(throttledChannels, channel)
+		}
+		if len(channelEvents) == 0 {
+			continue
+		}
 
-	if n.config.SlackWebhook != "" && len(filtered) > 0 {
-		if err := n.sendSlack(ctx, filtered); err != nil {
-			n.logger.Error("slack notification failed", "error", err)
+		delivery := n.Deliver(ctx, channel, channelEvents)
+		if delivery.Err != nil {
+			n.logger.Error("notification failed", "channel", channel, "failed", len(delivery.Failed), "error", delivery.Err)
 		}
+		result.Deliveries = append(result.Deliveries, delivery)
 	}
 
-	if n.config.GenericWebhook != "" && len(filtered) > 0 {
-		if err := n.sendWebhook(ctx, filtered); err != nil {
-			n.logger.Error("webhook notification failed", "error", err)
+	for _, channel := range throttledChannels {
+		if overflow := n.sendThrottled(ctx, channel, t.filter(n.config.channelSeverity(channel))); len(overflow.Failed) > 0 {
+			result.Deliveries = append(result.Deliveries, overflow)
 		}
 	}
 
-	// SaaS receives ALL events (unfiltered) for complete tracking
-	return n.SendSaas(ctx, events)
+	result.Saas = n.SendSaas(ctx, events)
+	return result
 }
 
-func (n *Notifier) filterBySeverity(events []VulnerabilityEvent) []VulnerabilityEvent {
-	minLevel := severityLevel(n.config.MinSeverity)
-	var filtered []VulnerabilityEvent
+// filterBySeverity returns events at or above minSeverity, or all of them
+// if it is empty. SEVERITY_CHANGED events are kept when the rescoring
+// crossed minSeverity, in either direction, and IMAGE_CHANGED events when
+// one of the events they account for is kept.
+func filterBySeverity(events []VulnerabilityEvent, minSeverity string) []VulnerabilityEvent {
+	if minSeverity == "" {
+		return events
+	}
+	minLevel := severityLevel(minSeverity)
+	var filtered, changes []VulnerabilityEvent
 	for _, e := range events {
-		if severityLevel(e.Severity) <= minLevel {
+		keep := severityLevel(e.Severity) <= minLevel
+		switch e.Type {
+		case "IMAGE_CHANGED":
+			changes = append(changes, e)
+			continue
+		case "SEVERITY_CHANGED":
+			// Exactly one of the old and new severity is at or above minSeverity
+			keep = keep != (severityLevel(e.OldSeverity) <= minLevel)
+		}
+		if keep {
 			filtered = append(filtered, e)
 		}
 	}
-	return filtered
+
+	var kept []VulnerabilityEvent
+	for _, change := range changes {
+		for _, e := range filtered {
+			if fromImageChange(change, e) {
+				kept = append(kept, change)
+				break
+			}
+		}
+	}
+	return append(kept, filtered...)
+}
+
+// fromImageChange reports whether e is a NEW or FIXED event accounted for
+// by the IMAGE_CHANGED event change
+func fromImageChange(change, e VulnerabilityEvent) bool {
+	if e.imageKey() != change.imageKey() {
+		return false
+	}
+	return e.Type == "NEW" && e.ImageDigest == change.ImageDigest ||
+		e.Type == "FIXED" && e.ImageDigest == change.OldImageDigest
 }
 
 func severityLevel(s string) int {
@@ -115,12 +219,30 @@ func severityLevel(s string) int {
 	}
 }
 
-func (n *Notifier) sendSlack(ctx context.Context, events []VulnerabilityEvent) error {
+// sendSlackLegacy posts counts per workload as legacy attachments, for
+// proxies and old integrations that don't accept Block Kit.
+func (n *Notifier) sendSlackLegacy(ctx context.Context, events []VulnerabilityEvent) error {
 	newEvents := filterByType(events, "NEW")
+	changedEvents := filterByType(events, "SEVERITY_CHANGED")
 	fixedEvents := filterByType(events, "FIXED")
 
 	var attachments []map[string]interface{}
 
+	// Image changes attachment (blue)
+	if imageEvents := filterByType(events, "IMAGE_CHANGED"); len(imageEvents) > 0 {
+		var lines []string
+		for _, e := range imageEvents {
+			lines = append(lines, imageChangeText(e))
+		}
+
+		attachments = append(attachments, map[string]interface{}{
+			"color":     "#439fe0", // blue
+			"title":     fmt.Sprintf("Images changed (%d)", len(imageEvents)),
+			"text":      strings.Join(lines, "\n"),
+			"mrkdwn_in": []string{"text"},
+		})
+	}
+
 	// New vulnerabilities attachment (red/orange based on severity)
 	if len(newEvents) > 0 {
 		grouped := groupByWorkload(newEvents)
@@ -134,26 +256,43 @@ func (n *Notifier) sendSlack(ctx context.Context, events []VulnerabilityEvent) e
 
 		var lines []string
 		for workload, group := range grouped {
-			severityCounts := countBySeverity(group)
-			var parts []string
-			if c := severityCounts["CRITICAL"]; c > 0 {
-				parts = append(parts, fmt.Sprintf("%d critical", c))
-			}
-			if c := severityCounts["HIGH"]; c > 0 {
-				parts = append(parts, fmt.Sprintf("%d high", c))
+			lines = append(lines, fmt.Sprintf("`%s`\n%s", workload, severitySummary(countBySeverity(group))))
+		}
+
+		attachments = append(attachments, map[string]interface{}{
+			"color":     color,
+			"title":     fmt.Sprintf("New %s (%d)", wording(newEvents).title, len(newEvents)),
+			"text":      strings.Join(lines, "\n\n"),
+			"mrkdwn_in": []string{"text"},
+		})
+	}
+
+	// Rescored vulnerabilities attachment (red/orange/yellow by new severity)
+	if len(changedEvents) > 0 {
+		grouped := groupByWorkload(changedEvents)
+		color := "#ffc107" // yellow
+		for _, e := range changedEvents {
+			if e.Severity == "CRITICAL" {
+				color = "#dc3545" // red
+				break
 			}
-			if c := severityCounts["MEDIUM"]; c > 0 {
-				parts = append(parts, fmt.Sprintf("%d medium", c))
+			if e.Severity == "HIGH" {
+				color = "#fd7e14" // orange
 			}
-			if c := severityCounts["LOW"]; c > 0 {
-				parts = append(parts, fmt.Sprintf("%d low", c))
+		}
+
+		var lines []string
+		for _, workload := range sortedWorkloads(grouped) {
+			var changes []string
+			for _, e := range grouped[workload] {
+				changes = append(changes, fmt.Sprintf("%s %s", findingText(e), severityChange(e)))
 			}
-			lines = append(lines, fmt.Sprintf("`%s`\n%s", workload, strings.Join(parts, ", ")))
+			lines = append(lines, fmt.Sprintf("`%s`\n%s", workload, strings.Join(changes, "\n")))
 		}
 
 		attachments = append(attachments, map[string]interface{}{
 			"color":     color,
-			"title":     fmt.Sprintf("New Vulnerabilities (%d)", len(newEvents)),
+			"title":     fmt.Sprintf("Severity changed (%d)", len(changedEvents)),
 			"text":      strings.Join(lines, "\n\n"),
 			"mrkdwn_in": []string{"text"},
 		})
@@ -165,12 +304,12 @@ func (n *Notifier) sendSlack(ctx context.Context, events []VulnerabilityEvent) e
 
 		var lines []string
 		for workload, group := range grouped {
-			lines = append(lines, fmt.Sprintf("`%s`: %d CVEs", workload, len(group)))
+			lines = append(lines, fmt.Sprintf("`%s`: %d %s", workload, len(group), wording(group).short))
 		}
 
 		attachments = append(attachments, map[string]interface{}{
 			"color":     "#36a64f", // green
-			"title":     fmt.Sprintf("Fixed Vulnerabilities (%d)", len(fixedEvents)),
+			"title":     fmt.Sprintf("Fixed %s (%d)", wording(fixedEvents).title, len(fixedEvents)),
 			"text":      strings.Join(lines, "\n"),
 			"mrkdwn_in": []string{"text"},
 		})
@@ -189,12 +328,151 @@ func groupByWorkload(events []VulnerabilityEvent) map[string][]VulnerabilityEven
 	return grouped
 }
 
-func (n *Notifier) sendWebhook(ctx context.Context, events []VulnerabilityEvent) error {
+// sortedWorkloads returns the keys of grouped in a stable order
+func sortedWorkloads(grouped map[string][]VulnerabilityEvent) []string {
+	workloads := make([]string, 0, len(grouped))
+	for workload := range grouped {
+		workloads = append(workloads, workload)
+	}
+	sort.Strings(workloads)
+	return workloads
+}
+
+// severitySummary renders counts as "2 critical, 1 high"
+func severitySummary(counts map[string]int) string {
+	var parts []string
+	for _, s := range []string{"CRITICAL", "HIGH", "MEDIUM", "LOW"} {
+		if c := counts[s]; c > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", c, strings.ToLower(s)))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// severityChange renders the rescoring of a SEVERITY_CHANGED event, e.g.
+// "medium → critical"
+func severityChange(e VulnerabilityEvent) string {
+	return strings.ToLower(e.OldSeverity) + " → " + strings.ToLower(e.Severity)
+}
+
+// imageChangeText renders an IMAGE_CHANGED event, e.g. "payments/Deployment/api
+// (api): sha256:1a2b3c4d5e6f → sha256:9f8e7d6c5b4a, 3 new, 5 fixed"
+func imageChangeText(e VulnerabilityEvent) string {
+	text := e.Workload
+	if e.ContainerName != "" {
+		text += fmt.Sprintf(" (%s)", e.ContainerName)
+	}
+	return fmt.Sprintf("%s: %s → %s, %d new, %d fixed", text, shortDigest(e.OldImageDigest), shortDigest(e.ImageDigest), e.Added, e.Removed)
+}
+
+// shortDigest abbreviates an image digest to 12 hex digits, like docker does
+func shortDigest(digest string) string {
+	algorithm, hex, ok := strings.Cut(digest, ":")
+	if !ok || len(hex) <= 12 {
+		return digest
+	}
+	return algorithm + ":" + hex[:12]
+}
+
+// formatDuration renders d in its two largest units, e.g. "4d 6h" or "3h 20m"
+func formatDuration(d time.Duration) string {
+	days := int(d / (24 * time.Hour))
+	hours := int(d % (24 * time.Hour) / time.Hour)
+	minutes := int(d % time.Hour / time.Minute)
+	switch {
+	case days > 0 && hours > 0:
+		return fmt.Sprintf("%dd %dh", days, hours)
+	case days > 0:
+		return fmt.Sprintf("%dd", days)
+	case hours > 0 && minutes > 0:
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	case hours > 0:
+		return fmt.Sprintf("%dh", hours)
+	case minutes > 0:
+		return fmt.Sprintf("%dm", minutes)
+	default:
+		return "<1m"
+	}
+}
+
+// sendWebhook posts events in batches of TRIX_EVENT_BATCH_SIZE. A failed
+// batch doesn't stop the others; the events of failed batches are returned
+// with the first error.
+func (n *Notifier) sendWebhook(ctx context.Context, events []VulnerabilityEvent) ([]VulnerabilityEvent, error) {
+	batches := eventBatches(events, n.config.EventBatchSize)
+	var failed []VulnerabilityEvent
+	var firstErr error
+	for i, batch := range batches {
+		err := n.sendWebhookBatch(ctx, batch, i+1, len(batches))
+		if err == nil {
+			continue
+		}
+		failed = append(failed, batch...)
+		if len(batches) > 1 {
+			n.logger.Warn("webhook batch failed", "batch", i+1, "batches", len(batches), "events", len(batch), "error", err)
+			err = fmt.Errorf("batch %d/%d: %w", i+1, len(batches), err)
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return failed, firstErr
+}
+
+func (n *Notifier) sendWebhookBatch(ctx context.Context, events []VulnerabilityEvent, batch, batches int) error {
+	if t := n.config.Templates; t != nil && t.Webhook != nil {
+		data := newTemplateData(n.config.ClusterName, events, time.Now())
+		data.Batch, data.Batches = batch, batches
+		body, err := t.renderWebhook(data)
+		if err != nil {
+			return err
+		}
+		return n.postWebhookBody(ctx, body)
+	}
+
 	payload := map[string]interface{}{
 		"timestamp": time.Now().UTC().Format(time.RFC3339),
 		"events":    events,
+		"batch":     map[string]int{"index": batch, "total": batches},
+	}
+	return n.postWebhook(ctx, payload)
+}
+
+// eventBatches splits events into consecutive batches of at most size events
+func eventBatches(events []VulnerabilityEvent, size int) [][]VulnerabilityEvent {
+	var batches [][]VulnerabilityEvent
+	for len(events) > size {
+		batches = append(batches, events[:size:size])
+		events = events[size:]
+	}
+	if len(events) > 0 {
+		batches = append(batches, events)
+	}
+	return batches
+}
+
+// postWebhook sends a payload to the generic webhook with the configured
+// headers, signed when TRIX_WEBHOOK_SECRET is set (see pkg/webhook).
+func (n *Notifier) postWebhook(ctx context.Context, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+	return n.postWebhookBody(ctx, body)
+}
+
+// postWebhookBody sends an already encoded JSON body to the generic webhook.
+func (n *Notifier) postWebhookBody(ctx context.Context, body []byte) error {
+	header := n.config.WebhookHeaders.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	if n.config.WebhookSecret != "" {
+		timestamp := time.Now().Unix()
+		header.Set(webhook.TimestampHeader, strconv.FormatInt(timestamp, 10))
+		header.Set(webhook.SignatureHeader, webhook.Sign(n.config.WebhookSecret, timestamp, body))
 	}
-	return n.postJSON(ctx, n.config.GenericWebhook, payload)
+	return n.post(ctx, n.webhookHTTP, n.config.GenericWebhook, body, header)
 }
 
 func (n *Notifier) postJSON(ctx context.Context, url string, payload interface{}) error {
@@ -202,14 +480,21 @@ func (n *Notifier) postJSON(ctx context.Context, url string, payload interface{}
 	if err != nil {
 		return fmt.Errorf("marshal: %w", err)
 	}
+	return n.post(ctx, n.httpClient, url, body, nil)
+}
 
+// post sends a JSON body with extra headers and fails on non-2xx responses.
+func (n *Notifier) post(ctx context.Context, client *http.Client, url string, body []byte, header http.Header) error {
 	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
 	if err != nil {
 		return fmt.Errorf("create request: %w", err)
 	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := n.httpClient.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
 		return fmt.Errorf("request: %w", err)
 	}
@@ -234,6 +519,10 @@ func filterByType(events []VulnerabilityEvent, eventType string) []Vulnerability
 }
 
 func (n *Notifier) sendSlackSummary(ctx context.Context, events []VulnerabilityEvent) error {
+	if !n.config.SlackLegacy {
+		return n.sendSlackSummaryBlocks(ctx, events)
+	}
+
 	counts := countBySeverity(events)
 	total := len(events)
 
@@ -265,7 +554,7 @@ func (n *Notifier) sendSlackSummary(ctx context.Context, events []VulnerabilityE
 	attachment := map[string]interface{}{
 		"color":       color,
 		"title":       "trix initialized",
-		"text":        fmt.Sprintf("Found *%d* vulnerabilities", total),
+		"text":        fmt.Sprintf("Found *%d* %s", total, wording(events).plural),
 		"fields":      fields,
 		"footer":      "Monitoring started",
 		"footer_icon": "https://raw.githubusercontent.com/aquasecurity/trivy/main/docs/imgs/logo.png",
@@ -284,8 +573,9 @@ func (n *Notifier) sendWebhookSummary(ctx context.Context, events []Vulnerabilit
 		"timestamp":  time.Now().UTC().Format(time.RFC3339),
 		"total":      len(events),
 		"bySeverity": counts,
+		"cluster":    n.cluster.block(ctx),
 	}
-	return n.postJSON(ctx, n.config.GenericWebhook, payload)
+	return n.postWebhook(ctx, payload)
 }
 
 func countBySeverity(events []VulnerabilityEvent) map[string]int {
@@ -305,16 +595,35 @@ func (n *Notifier) SendSaas(ctx context.Context, events []VulnerabilityEvent) *S
 		return &SaasResult{}
 	}
 
+	ctx, span := n.startSpan(ctx, "trix.notify", "saas", len(events))
+	result := n.sendSaas(ctx, events)
+	span.SetAttributes(attribute.Int("trix.failed", len(result.FailedIDs)))
+	endSpan(span, result.Err)
+	return result
+}
+
+func (n *Notifier) sendSaas(ctx context.Context, events []VulnerabilityEvent) *SaasResult {
 	result := &SaasResult{}
 	url := strings.TrimSuffix(n.config.SaasEndpoint, "/") + "/api/v1/events"
 
-	// Send events in batches
-	for i := 0; i < len(events); i += saasBatchSize {
-		end := i + saasBatchSize
-		if end > len(events) {
-			end = len(events)
+	// Events below TRIX_SAAS_SEVERITY count as synced, so they aren't retried
+	if n.config.SaasMinSeverity != "" {
+		minLevel := severityLevel(n.config.SaasMinSeverity)
+		var sent []VulnerabilityEvent
+		for _, e := range events {
+			if severityLevel(e.Severity) <= minLevel {
+				sent = append(sent, e)
+			} else if e.ID != "" {
+				result.SyncedIDs = append(result.SyncedIDs, e.ID)
+			}
 		}
-		batch := events[i:end]
+		events = sent
+	}
+
+	// Send events in batches, each marked synced on its own
+	cluster := n.cluster.block(ctx)
+	batches := eventBatches(events, n.config.EventBatchSize)
+	for i, batch := range batches {
 
 		// Collect IDs from this batch
 		batchIDs := make([]string, 0, len(batch))
@@ -327,15 +636,17 @@ func (n *Notifier) SendSaas(ctx context.Context, events []VulnerabilityEvent) *S
 		payload := map[string]interface{}{
 			"cluster_name": n.config.ClusterName,
 			"trix_version": n.config.Version,
+			"cluster":      cluster,
 			"timestamp":    time.Now().UTC().Format(time.RFC3339),
 			"events":       batch,
+			"batch":        map[string]int{"index": i + 1, "total": len(batches)},
 		}
 
 		// Retry with exponential backoff
 		var lastErr error
 		for attempt := 0; attempt < saasMaxRetries; attempt++ {
 			if attempt > 0 {
-				backoff := time.Duration(1<<uint(attempt-1)) * time.Second // 1s, 2s, 4s
+				backoff := time.Duration(1<<uint(attempt-1)) * saasBackoff // 1s, 2s, 4s
 				n.logger.Debug("retrying saas batch", "attempt", attempt+1, "backoff", backoff)
 				select {
 				case <-ctx.Done():
@@ -348,13 +659,13 @@ func (n *Notifier) SendSaas(ctx context.Context, events []VulnerabilityEvent) *S
 
 			if err := n.postJSONWithAuth(ctx, url, payload); err != nil {
 				lastErr = err
-				n.logger.Warn("saas batch failed", "batch", i/saasBatchSize+1, "attempt", attempt+1, "error", err)
+				n.logger.Warn("saas batch failed", "batch", i+1, "batches", len(batches), "attempt", attempt+1, "error", err)
 				continue
 			}
 
 			// Success
 			result.SyncedIDs = append(result.SyncedIDs, batchIDs...)
-			n.logger.Info("saas batch sent", "batch", i/saasBatchSize+1, "events", len(batch), "total", len(events))
+			n.logger.Info("saas batch sent", "batch", i+1, "batches", len(batches), "events", len(batch), "total", len(events))
 			lastErr = nil
 			break
 		}
@@ -363,10 +674,10 @@ func (n *Notifier) SendSaas(ctx context.Context, events []VulnerabilityEvent) *S
 			// All retries failed for this batch
 			result.FailedIDs = append(result.FailedIDs, batchIDs...)
 			if result.Err == nil {
-				result.Err = fmt.Errorf("batch %d-%d failed after %d retries: %w", i, end, saasMaxRetries, lastErr)
+				result.Err = fmt.Errorf("batch %d/%d failed after %d retries: %w", i+1, len(batches), saasMaxRetries, lastErr)
 			}
 			n.logger.Error("saas batch failed permanently",
-				"batch", i/saasBatchSize+1,
+				"batch", i+1, "batches", len(batches),
 				"events", len(batch),
 				"failed_ids", len(batchIDs),
 				"error", lastErr,
@@ -0,0 +1,461 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/trixsec-dev/trix/internal/proxy/proxytest"
+	"github.com/trixsec-dev/trix/pkg/webhook"
+)
+
+// receivedRequest is a request captured by a stub receiver
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+// stubReceiver records every request and answers with status
+func stubReceiver(t *testing.T, status int) (*httptest.Server, func() []receivedRequest) {
+	t.Helper()
+	var mu sync.Mutex
+	var got []receivedRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		got = append(got, receivedRequest{header: r.Header.Clone(), body: body})
+		mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []receivedRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]receivedRequest(nil), got...)
+	}
+}
+
+func testEvents() []VulnerabilityEvent {
+	return []VulnerabilityEvent{{
+		ID:        "v1",
+		Type:      "NEW",
+		Kind:      KindVulnerability,
+		CVE:       "CVE-2024-0001",
+		Workload:  "team-a/deployment/api",
+		Severity:  "CRITICAL",
+		Image:     "openssl:3.0.1",
+		FirstSeen: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}}
+}
+
+// testNotifier returns a notifier configured from env on a memory store
+func testNotifier(t *testing.T, env map[string]string) *Notifier {
+	t.Helper()
+	return NewNotifier(testConfig(t, env), NewMemoryStore(), testLogger())
+}
+
+func TestWebhookSignature(t *testing.T) {
+	srv, received := stubReceiver(t, http.StatusOK)
+	n := testNotifier(t, map[string]string{
+		"TRIX_NOTIFY_WEBHOOK": srv.URL,
+		"TRIX_WEBHOOK_SECRET": "s3cret",
+	})
+
+	if res := n.Deliver(context.Background(), channelWebhook, testEvents()); res.Err != nil {
+		t.Fatalf("Deliver: %v", res.Err)
+	}
+	reqs := received()
+	if len(reqs) != 1 {
+		t.Fatalf("received %d requests, want 1", len(reqs))
+	}
+	r := reqs[0]
+	if err := webhook.VerifySignature("s3cret", r.header, r.body, time.Minute); err != nil {
+		t.Errorf("VerifySignature: %v (headers %v)", err, r.header)
+	}
+	if err := webhook.VerifySignature("other", r.header, r.body, time.Minute); err == nil {
+		t.Error("signature verified with the wrong secret")
+	}
+}
+
+func TestWebhookUnsigned(t *testing.T) {
+	srv, received := stubReceiver(t, http.StatusOK)
+	n := testNotifier(t, map[string]string{"TRIX_NOTIFY_WEBHOOK": srv.URL})
+
+	if res := n.Deliver(context.Background(), channelWebhook, testEvents()); res.Err != nil {
+		t.Fatalf("Deliver: %v", res.Err)
+	}
+	for _, r := range received() {
+		for _, h := range []string{webhook.SignatureHeader, webhook.TimestampHeader} {
+			if v := r.header.Get(h); v != "" {
+				t.Errorf("%s = %q without TRIX_WEBHOOK_SECRET, want none", h, v)
+			}
+		}
+		if ct := r.header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q, want application/json", ct)
+		}
+	}
+}
+
+func TestWebhookHeaders(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	hook, hookReceived := stubReceiver(t, http.StatusOK)
+	teams, teamsReceived := stubReceiver(t, http.StatusOK)
+	n := testNotifier(t, map[string]string{
+		"TRIX_NOTIFY_WEBHOOK":     hook.URL,
+		"TRIX_NOTIFY_TEAMS":       teams.URL,
+		"TRIX_WEBHOOK_HEADERS":    "X-Api-Key=abc123, X-Token=@" + tokenFile + ",X-Multi=a=b",
+		"TRIX_WEBHOOK_BASIC_AUTH": "trix:p:ss",
+	})
+
+	ctx := context.Background()
+	if res := n.Deliver(ctx, channelWebhook, testEvents()); res.Err != nil {
+		t.Fatalf("Deliver webhook: %v", res.Err)
+	}
+	if res := n.Deliver(ctx, channelTeams, testEvents()); res.Err != nil {
+		t.Fatalf("Deliver teams: %v", res.Err)
+	}
+
+	reqs := hookReceived()
+	if len(reqs) != 1 {
+		t.Fatalf("webhook received %d requests, want 1", len(reqs))
+	}
+	want := map[string]string{
+		"X-Api-Key":     "abc123",
+		"X-Token":       "from-file",
+		"X-Multi":       "a=b",
+		"Authorization": "Basic dHJpeDpwOnNz", // trix:p:ss
+		"Content-Type":  "application/json",
+	}
+	for name, value := range want {
+		if got := reqs[0].header.Get(name); got != value {
+			t.Errorf("webhook %s = %q, want %q", name, got, value)
+		}
+	}
+
+	// The headers belong to the generic webhook only
+	for _, r := range teamsReceived() {
+		for _, name := range []string{"X-Api-Key", "X-Token", "Authorization"} {
+			if v := r.header.Get(name); v != "" {
+				t.Errorf("teams request has %s = %q", name, v)
+			}
+		}
+	}
+}
+
+func TestWebhookHeadersRejectedAtLoad(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing")
+	tests := []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{"no value", map[string]string{"TRIX_WEBHOOK_HEADERS": "X-Api-Key"}, "malformed entry"},
+		{"empty name", map[string]string{"TRIX_WEBHOOK_HEADERS": "=abc"}, "malformed entry"},
+		{"invalid name", map[string]string{"TRIX_WEBHOOK_HEADERS": "X Api Key=abc"}, "malformed entry"},
+		{"missing file", map[string]string{"TRIX_WEBHOOK_HEADERS": "X-Token=@" + missing}, "header X-Token"},
+		{"basic auth without password", map[string]string{"TRIX_WEBHOOK_BASIC_AUTH": "trix"}, "TRIX_WEBHOOK_BASIC_AUTH"},
+		{"basic auth without user", map[string]string{"TRIX_WEBHOOK_BASIC_AUTH": ":pass"}, "TRIX_WEBHOOK_BASIC_AUTH"},
+		{"bad timeout", map[string]string{"TRIX_WEBHOOK_TIMEOUT": "soon"}, "TRIX_WEBHOOK_TIMEOUT"},
+		{"zero timeout", map[string]string{"TRIX_WEBHOOK_TIMEOUT": "0s"}, "TRIX_WEBHOOK_TIMEOUT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(ConfigFileEnv, "")
+			t.Setenv("TRIX_DATABASE_URL", "memory://")
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			_, err := LoadConfig()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadConfig error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhookTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	n := testNotifier(t, map[string]string{
+		"TRIX_NOTIFY_WEBHOOK":  srv.URL,
+		"TRIX_WEBHOOK_TIMEOUT": "50ms",
+	})
+	start := time.Now()
+	res := n.Deliver(context.Background(), channelWebhook, testEvents())
+	if res.Err == nil {
+		t.Fatal("Deliver succeeded against a receiver that never answers")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Deliver took %s, want about the 50ms timeout", elapsed)
+	}
+	if len(res.Failed) != 1 {
+		t.Errorf("failed = %d events, want 1", len(res.Failed))
+	}
+}
+
+func TestNotifierProxy(t *testing.T) {
+	var mu sync.Mutex
+	var hosts []string
+	origin := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hosts = append(hosts, r.Host)
+		mu.Unlock()
+	})
+	target := httptest.NewTLSServer(origin)
+	defer target.Close()
+	p := proxytest.NewServer(origin, target.Listener.Addr().String())
+	defer p.Close()
+
+	// The TLS settings must not drop the proxy
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	writePEM(t, caFile, "CERTIFICATE", target.Certificate().Raw)
+
+	n := testNotifier(t, map[string]string{
+		"TRIX_HTTP_PROXY":     p.URLWithAuth("trix", "secret"),
+		"TRIX_NOTIFY_WEBHOOK": "http://hooks.test/trix",
+		"TRIX_NOTIFY_TEAMS":   "https://example.com/teams",
+		"TRIX_TLS_CA_FILE":    caFile,
+	})
+	ctx := context.Background()
+	for _, channel := range []string{channelWebhook, channelTeams} {
+		if res := n.Deliver(ctx, channel, testEvents()); res.Err != nil {
+			t.Fatalf("Deliver %s: %v", channel, res.Err)
+		}
+	}
+
+	auth := "Basic dHJpeDpzZWNyZXQ=" // trix:secret
+	want := []proxytest.Request{
+		{Method: http.MethodPost, Host: "hooks.test", Auth: auth},
+		{Method: http.MethodConnect, Host: "example.com:443", Auth: auth},
+	}
+	if got := p.Requests(); !reflect.DeepEqual(got, want) {
+		t.Errorf("proxy requests = %+v, want %+v", got, want)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if got := strings.Join(hosts, ","); got != "hooks.test,example.com" {
+		t.Errorf("origin hosts = %q", got)
+	}
+}
+
+func TestNotifierProxyRejectedAtLoad(t *testing.T) {
+	t.Setenv(ConfigFileEnv, "")
+	t.Setenv("TRIX_DATABASE_URL", "memory://")
+	t.Setenv("TRIX_HTTP_PROXY", "ftp://proxy:21")
+	if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "TRIX_HTTP_PROXY") {
+		t.Errorf("LoadConfig error = %v, want one naming TRIX_HTTP_PROXY", err)
+	}
+}
+
+func TestFilterBySeverity(t *testing.T) {
+	events := []VulnerabilityEvent{
+		{ID: "c", Type: "NEW", Severity: "CRITICAL"},
+		{ID: "h", Type: "NEW", Severity: "HIGH"},
+		{ID: "m", Type: "FIXED", Severity: "MEDIUM"},
+		{ID: "u", Type: "NEW", Severity: "UNKNOWN"},
+		{ID: "up", Type: "SEVERITY_CHANGED", Severity: "CRITICAL", OldSeverity: "MEDIUM"},
+		{ID: "down", Type: "SEVERITY_CHANGED", Severity: "LOW", OldSeverity: "HIGH"},
+		{ID: "same", Type: "SEVERITY_CHANGED", Severity: "CRITICAL", OldSeverity: "HIGH"},
+	}
+	tests := []struct {
+		minSeverity string
+		want        []string
+	}{
+		{"", []string{"c", "h", "m", "u", "up", "down", "same"}},
+		{"CRITICAL", []string{"c", "up", "same"}}, // HIGH to CRITICAL crosses a CRITICAL threshold
+		{"HIGH", []string{"c", "h", "up", "down"}},
+		{"LOW", []string{"c", "h", "m"}}, // Rescorings above the threshold both times are not news
+		{"UNKNOWN", []string{"c", "h", "m", "u"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, e := range filterBySeverity(events, tt.minSeverity) {
+			got = append(got, e.ID)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("filterBySeverity(%q) = %v, want %v", tt.minSeverity, got, tt.want)
+		}
+	}
+}
+
+// One Notify call sends each channel the events at or above its own threshold
+func TestNotifyChannelSeverities(t *testing.T) {
+	slack, slackReceived := stubReceiver(t, http.StatusOK)
+	teams, teamsReceived := stubReceiver(t, http.StatusOK)
+	webhook, webhookReceived := stubReceiver(t, http.StatusOK)
+	saas, saasReceived := stubReceiver(t, http.StatusOK)
+	n := testNotifier(t, map[string]string{
+		"TRIX_NOTIFY_SLACK":     slack.URL,
+		"TRIX_NOTIFY_TEAMS":     teams.URL,
+		"TRIX_NOTIFY_WEBHOOK":   webhook.URL,
+		"TRIX_SAAS_ENDPOINT":    saas.URL,
+		"TRIX_SAAS_API_KEY":     "key",
+		"TRIX_NOTIFY_SEVERITY":  "HIGH",
+		"TRIX_SLACK_SEVERITY":   "critical",
+		"TRIX_WEBHOOK_SEVERITY": "LOW",
+		"TRIX_SAAS_SEVERITY":    "MEDIUM",
+	})
+
+	var events []VulnerabilityEvent
+	for _, s := range []string{"CRITICAL", "HIGH", "MEDIUM", "LOW"} {
+		events = append(events, VulnerabilityEvent{
+			ID: strings.ToLower(s), Type: "NEW", Kind: KindVulnerability, CVE: "CVE-2024-" + s,
+			Workload: "prod/deployment/api", Severity: s, Image: "openssl:3.0.1",
+		})
+	}
+	result := n.Notify(context.Background(), events)
+
+	for _, tt := range []struct {
+		channel  string
+		received func() []receivedRequest
+		want     []string
+	}{
+		{channelSlack, slackReceived, []string{"CRITICAL"}},
+		{channelWebhook, webhookReceived, []string{"CRITICAL", "HIGH", "MEDIUM", "LOW"}},
+		{"saas", saasReceived, []string{"CRITICAL", "HIGH", "MEDIUM"}},
+	} {
+		var body string
+		for _, r := range tt.received() {
+			body += string(r.body)
+		}
+		for _, s := range []string{"CRITICAL", "HIGH", "MEDIUM", "LOW"} {
+			want := false
+			for _, w := range tt.want {
+				want = want || w == s
+			}
+			if got := strings.Contains(body, "CVE-2024-"+s); got != want {
+				t.Errorf("%s received CVE-2024-%s = %v, want %v", tt.channel, s, got, want)
+			}
+		}
+	}
+
+	// Teams falls back to TRIX_NOTIFY_SEVERITY; its card counts by severity
+	if reqs := teamsReceived(); len(reqs) != 1 || !strings.Contains(string(reqs[0].body), "1 critical, 1 high\"") {
+		t.Errorf("Teams received %d messages", len(reqs))
+	}
+
+	// Events below TRIX_SAAS_SEVERITY count as synced so they aren't retried
+	if result.Saas == nil || result.Saas.Err != nil || len(result.Saas.SyncedIDs) != 4 {
+		t.Errorf("SaaS result = %+v", result.Saas)
+	}
+}
+
+func TestSeverityConfig(t *testing.T) {
+	cfg := testConfig(t, nil)
+	if cfg.MinSeverity != "CRITICAL" || cfg.channelSeverity(channelSlack) != "CRITICAL" ||
+		cfg.channelSeverity(channelWebhook) != "CRITICAL" || cfg.SaasMinSeverity != "" {
+		t.Errorf("defaults = global %q, slack %q, webhook %q, saas %q",
+			cfg.MinSeverity, cfg.SlackMinSeverity, cfg.WebhookMinSeverity, cfg.SaasMinSeverity)
+	}
+
+	cfg = testConfig(t, map[string]string{"TRIX_NOTIFY_SEVERITY": "medium", "TRIX_EMAIL_SEVERITY": " low "})
+	for channel, want := range map[string]string{
+		channelSlack:   "MEDIUM",
+		channelTeams:   "MEDIUM",
+		channelEmail:   "LOW",
+		channelWebhook: "MEDIUM",
+	} {
+		if got := cfg.channelSeverity(channel); got != want {
+			t.Errorf("channelSeverity(%s) = %q, want %q", channel, got, want)
+		}
+	}
+
+	for _, name := range []string{"TRIX_NOTIFY_SEVERITY", "TRIX_SLACK_SEVERITY", "TRIX_TEAMS_SEVERITY",
+		"TRIX_EMAIL_SEVERITY", "TRIX_WEBHOOK_SEVERITY", "TRIX_SAAS_SEVERITY"} {
+		t.Setenv(ConfigFileEnv, "")
+		t.Setenv("TRIX_DATABASE_URL", "memory://")
+		t.Setenv(name, "SEVERE")
+		if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "invalid "+name+` "SEVERE"`) {
+			t.Errorf("%s=SEVERE: err = %v", name, err)
+		}
+		t.Setenv(name, "")
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "<1m"},
+		{59 * time.Second, "<1m"},
+		{time.Minute, "1m"},
+		{3*time.Hour + 20*time.Minute + 59*time.Second, "3h 20m"},
+		{5 * time.Hour, "5h"},
+		{24 * time.Hour, "1d"},
+		{4*24*time.Hour + 6*time.Hour + 30*time.Minute, "4d 6h"}, // Two largest units only
+		{400 * 24 * time.Hour, "400d"},
+	}
+	for _, tt := range tests {
+		if got := formatDuration(tt.d); got != tt.want {
+			t.Errorf("formatDuration(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestFixedAfter(t *testing.T) {
+	day := int64(24 * 60 * 60)
+	tests := []struct {
+		times []int64
+		want  string
+	}{
+		{nil, ""},
+		{[]int64{0, 0}, ""}, // No time to fix recorded
+		{[]int64{4*day + 6*3600}, "fixed after 4d 6h"},
+		{[]int64{day, day}, "fixed after 1d"},
+		{[]int64{day, 3 * day, 0}, "fixed after up to 3d"},
+	}
+	for _, tt := range tests {
+		var events []VulnerabilityEvent
+		for _, s := range tt.times {
+			events = append(events, VulnerabilityEvent{Type: "FIXED", TimeToFix: s})
+		}
+		if got := fixedAfter(events); got != tt.want {
+			t.Errorf("fixedAfter(%v) = %q, want %q", tt.times, got, tt.want)
+		}
+	}
+}
+
+// FIXED events carry the time to fix in the webhook payload
+func TestWebhookTimeToFix(t *testing.T) {
+	receiver, received := stubReceiver(t, http.StatusOK)
+	n := testNotifier(t, map[string]string{"TRIX_NOTIFY_WEBHOOK": receiver.URL, "TRIX_WEBHOOK_SEVERITY": "LOW"})
+
+	firstSeen := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	fixedAt := firstSeen.Add(102 * time.Hour)
+	n.Notify(context.Background(), []VulnerabilityEvent{{
+		ID: "f1", Type: "FIXED", CVE: "CVE-2024-0001", Workload: "prod/deployment/api", Severity: "HIGH",
+		FirstSeen: firstSeen, FixedAt: &fixedAt, TimeToFix: timeToFix(firstSeen, &fixedAt),
+	}})
+
+	reqs := received()
+	if len(reqs) != 1 {
+		t.Fatalf("%d webhook requests, want 1", len(reqs))
+	}
+	var payload struct {
+		Events []map[string]interface{} `json:"events"`
+	}
+	if err := json.Unmarshal(reqs[0].body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if len(payload.Events) != 1 || payload.Events[0]["TimeToFixSeconds"] != float64(102*3600) {
+		t.Errorf("events = %v", payload.Events)
+	}
+}
@@ -3,40 +3,92 @@ package server
 import (
 	"context"
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"log/slog"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/trixsec-dev/trix/internal/tools/kubectl"
 	"github.com/trixsec-dev/trix/internal/tools/trivy"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
 )
 
 // VulnerabilityEvent represents a change in vulnerability state.
 type VulnerabilityEvent struct {
 	ID              string     `json:"ID"`
-	Type            string     `json:"Type"` // NEW, FIXED
-	CVE             string     `json:"CVE"`
+	Type            string     `json:"Type"`           // IMAGE_CHANGED, NEW, SEVERITY_CHANGED, FIXED
+	Kind            string     `json:"Kind,omitempty"` // vulnerability, secret, compliance
+	CVE             string     `json:"CVE"`            // CVE, secret rule ID or config check ID
+	Title           string     `json:"Title,omitempty"`
 	Workload        string     `json:"Workload"`
 	Severity        string     `json:"Severity"`
-	Image           string     `json:"Image"` // package:version (legacy)
+	OldSeverity     string     `json:"OldSeverity,omitempty"` // SEVERITY_CHANGED only: the severity before rescoring
+	Image           string     `json:"Image"`                 // package:version (legacy); file path for secrets
 	ContainerName   string     `json:"ContainerName,omitempty"`
 	ImageRepository string     `json:"ImageRepository,omitempty"`
 	ImageTag        string     `json:"ImageTag,omitempty"`
 	ImageDigest     string     `json:"ImageDigest,omitempty"`
+	OldImageDigest  string     `json:"OldImageDigest,omitempty"` // IMAGE_CHANGED only: the digest before the change
+	Added           int        `json:"Added,omitempty"`          // IMAGE_CHANGED only: NEW events of the container's new image
+	Removed         int        `json:"Removed,omitempty"`        // IMAGE_CHANGED only: FIXED events of its old image
+	FixedVersion    string     `json:"FixedVersion,omitempty"`
+	Exposure        string     `json:"Exposure,omitempty"` // external, nodePort, clusterInternal or none
 	FirstSeen       time.Time  `json:"FirstSeen"`
 	FixedAt         *time.Time `json:"FixedAt,omitempty"`
+	TimeToFix       int64      `json:"TimeToFixSeconds,omitempty"` // FIXED only: seconds from FirstSeen to FixedAt
+}
+
+// recordEvent builds an event of eventType from a stored record.
+func recordEvent(eventType string, v *VulnerabilityRecord) VulnerabilityEvent {
+	return VulnerabilityEvent{
+		ID:              v.ID,
+		Type:            eventType,
+		Kind:            v.Kind,
+		CVE:             v.CVE,
+		Title:           v.Title,
+		Workload:        v.Workload,
+		Severity:        v.Severity,
+		Image:           v.Image,
+		ContainerName:   v.ContainerName,
+		ImageRepository: v.ImageRepository,
+		ImageTag:        v.ImageTag,
+		ImageDigest:     v.ImageDigest,
+		FixedVersion:    v.FixedVersion,
+		Exposure:        v.Exposure,
+		FirstSeen:       v.FirstSeen,
+		FixedAt:         v.FixedAt,
+		TimeToFix:       timeToFix(v.FirstSeen, v.FixedAt),
+	}
+}
+
+// timeToFix returns the seconds a vulnerability was open before fixedAt, or
+// 0 while it is still open.
+func timeToFix(firstSeen time.Time, fixedAt *time.Time) int64 {
+	if fixedAt == nil {
+		return 0
+	}
+	return int64(fixedAt.Sub(firstSeen) / time.Second)
 }
 
 // Poller periodically scans Trivy CRDs and detects changes.
 type Poller struct {
+	mu          sync.Mutex // Serializes full polls and watch updates
 	trivyClient *trivy.Client
-	db          *DB
+	db          Store
 	config      *Config
 	logger      *slog.Logger
+	exposure    *exposureCache // nil unless TRIX_EXPOSURE_ENRICH
+	tracer      trace.Tracer
+	clientset   kubernetes.Interface
 }
 
 // NewPoller creates a new Trivy CRD poller.
-func NewPoller(db *DB, config *Config, logger *slog.Logger) (*Poller, error) {
+func NewPoller(db Store, config *Config, logger *slog.Logger) (*Poller, error) {
 	k8sClient, err := kubectl.NewClient()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create k8s client: %w", err)
@@ -44,162 +96,454 @@ func NewPoller(db *DB, config *Config, logger *slog.Logger) (*Poller, error) {
 
 	trivyClient := trivy.NewClient(k8sClient)
 
-	return &Poller{
+	p := &Poller{
 		trivyClient: trivyClient,
 		db:          db,
 		config:      config,
 		logger:      logger,
-	}, nil
+		tracer:      noopTracer,
+		clientset:   k8sClient.Clientset(),
+	}
+	if config.ExposureEnrich {
+		p.exposure = newExposureCache(k8sClient.Clientset(), k8sClient.DynamicClient())
+	}
+	return p, nil
+}
+
+// reportPageSize is how many reports are fetched per list call
+const reportPageSize = 500
+
+// report is one listed report waiting to be processed
+type report struct {
+	object   map[string]interface{}
+	findings func(map[string]interface{}) []trivy.Finding // Parses the report's resource
 }
 
 // Poll performs a single poll of Trivy CRDs and returns events.
-func (p *Poller) Poll(ctx context.Context) ([]VulnerabilityEvent, error) {
-	p.logger.Info("starting poll")
+//
+// Reports are listed page by page into a channel and processed by
+// TRIX_POLL_CONCURRENCY workers, each parsing and upserting its reports.
+// Events are sorted afterwards so notifications don't depend on which
+// worker finished first.
+//
+// If ctx is cancelled, Poll returns the events of the upserts that went
+// through along with the error. Those changes are already recorded, so a
+// later poll won't report them again.
+func (p *Poller) Poll(ctx context.Context) (_ []VulnerabilityEvent, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
-	// Get all findings from Trivy
-	findings, err := p.getFindings(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get findings: %w", err)
+	ctx, span := p.tracer.Start(ctx, "trix.poll", trace.WithAttributes(attribute.Int("trix.concurrency", p.config.PollConcurrency)))
+	defer func() { endSpan(span, err) }()
+
+	p.logger.Info("starting poll", "concurrency", p.config.PollConcurrency)
+	if p.exposure != nil {
+		p.exposure.reset()
 	}
 
-	p.logger.Info("found vulnerabilities", "count", len(findings))
+	reports := make(chan report, p.config.PollConcurrency)
+	var listErrs map[string]error // Written before reports is closed
+	go func() {
+		defer close(reports)
+		listErrs = p.listReports(ctx, reports)
+	}()
 
-	var events []VulnerabilityEvent
-	var currentIDs []string
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		records []*VulnerabilityRecord
+		events  []VulnerabilityEvent
+	)
+	for i := 0; i < max(p.config.PollConcurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range reports {
+				found := p.reportRecords(ctx, r)
+				newEvents := p.upsert(ctx, found)
+
+				mu.Lock()
+				records = append(records, found...)
+				events = append(events, newEvents...)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		// A cancelled listing is incomplete; marking fixed against it would
+		// close vulnerabilities that are still present.
+		events = summarizeImageChanges(events)
+		sortEvents(events)
+		p.logger.Warn("poll cancelled, skipping reconciliation", "events", len(events))
+		return events, err
+	}
+
+	p.logger.Info("found vulnerabilities", "count", len(records))
+
+	// A kind whose listing failed part way, e.g. on an expired continue
+	// token, is not reconciled: its unlisted reports would be marked fixed
+	// and come back as NEW on the next poll. Its NEW events still go out.
+	var kinds []string
+	for _, kind := range p.config.TrackTypes {
+		if err, failed := listErrs[kind]; failed {
+			p.logger.Warn("skipping reconciliation after incomplete listing", "kind", kind, "error", err)
+			continue
+		}
+		kinds = append(kinds, kind)
+	}
+	if len(kinds) > 0 {
+		events = append(events, p.markFixed(ctx, kinds, records)...)
+	}
+	events = summarizeImageChanges(events)
+	sortEvents(events)
+
+	newCount, rescoredCount, fixedCount := countByType(events, "NEW"), countByType(events, "SEVERITY_CHANGED"), countByType(events, "FIXED")
+	imageCount := countByType(events, "IMAGE_CHANGED")
+	span.SetAttributes(
+		attribute.Int("trix.findings", len(records)),
+		attribute.Int("trix.image_changed", imageCount),
+		attribute.Int("trix.new", newCount),
+		attribute.Int("trix.severity_changed", rescoredCount),
+		attribute.Int("trix.fixed", fixedCount),
+	)
+	p.logger.Info("poll complete", "image_changed", imageCount, "new", newCount, "severity_changed", rescoredCount, "fixed", fixedCount)
 
-	// Process each finding
+	return events, nil
+}
+
+// listReports sends every report of the tracked kinds in scope to out. A
+// failed listing is logged and the resource skipped; the returned errors, by
+// kind, say which kinds were not listed completely.
+func (p *Poller) listReports(ctx context.Context, out chan<- report) map[string]error {
+	errs := make(map[string]error)
+	fail := func(kind string, err error) {
+		errs[kind] = errors.Join(errs[kind], err)
+	}
+
+	// list sends the reports of one resource in namespace, in a span
+	list := func(gvr schema.GroupVersionResource, namespace string, findings func(map[string]interface{}) []trivy.Finding) error {
+		ctx, span := p.tracer.Start(ctx, "trix.list_reports", trace.WithAttributes(
+			attribute.String("trix.resource", gvr.Resource),
+			attribute.String("k8s.namespace.name", namespace),
+		))
+		count := 0
+		err := p.trivyClient.ListReportPages(ctx, gvr, namespace, reportPageSize, func(page []map[string]interface{}) error {
+			for _, obj := range page {
+				select {
+				case out <- report{object: obj, findings: findings}:
+					count++
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			return nil
+		})
+		span.SetAttributes(attribute.Int("trix.reports", count))
+		endSpan(span, err)
+		return err
+	}
+
+	namespaces := p.config.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{""}
+	}
+	for _, r := range []struct {
+		kind     string
+		gvr      schema.GroupVersionResource
+		findings func(map[string]interface{}) []trivy.Finding
+	}{
+		{KindVulnerability, trivy.VulnerabilityReportGVR, p.trivyClient.VulnerabilityReportFindings},
+		{KindSecret, trivy.ExposedSecretReportGVR, p.trivyClient.ExposedSecretReportFindings},
+		{KindCompliance, trivy.ConfigAuditReportGVR, p.trivyClient.ConfigAuditReportFindings},
+	} {
+		if !p.config.tracks(r.kind) {
+			continue
+		}
+		for _, ns := range namespaces {
+			if err := list(r.gvr, ns, r.findings); err != nil {
+				p.logger.Warn("listing reports failed", "resource", r.gvr.Resource, "namespace", ns, "error", err)
+				fail(r.kind, err)
+			}
+		}
+	}
+	if p.config.tracks(KindVulnerability) {
+		if err := list(trivy.ClusterVulnerabilityReportGVR, "", p.trivyClient.ClusterVulnerabilityReportFindings); err != nil {
+			p.logger.Warn("listing cluster vulnerability reports failed", "error", err)
+			fail(KindVulnerability, err)
+		}
+	}
+	return errs
+}
+
+// reportRecords parses a report into records, with their exposure when
+// TRIX_EXPOSURE_ENRICH is on
+func (p *Poller) reportRecords(ctx context.Context, r report) []*VulnerabilityRecord {
+	findings := r.findings(r.object)
+	records := make([]*VulnerabilityRecord, 0, len(findings))
 	for _, f := range findings {
-		record := p.findingToRecord(f)
-		currentIDs = append(currentIDs, record.ID)
+		if record := p.findingToRecord(f); record != nil {
+			records = append(records, record)
+		}
+	}
+	p.enrichExposure(ctx, records)
+	return records
+}
 
-		isNew, err := p.db.UpsertVulnerability(ctx, record)
+// eventOrder ranks event types for sortEvents
+var eventOrder = map[string]int{"IMAGE_CHANGED": 0, "NEW": 1, "SEVERITY_CHANGED": 2, "FIXED": 3}
+
+// sortEvents orders events IMAGE_CHANGED, NEW, SEVERITY_CHANGED, FIXED, then
+// most severe first, then by workload, CVE and ID.
+func sortEvents(events []VulnerabilityEvent) {
+	sort.SliceStable(events, func(i, j int) bool {
+		a, b := events[i], events[j]
+		if a.Type != b.Type {
+			return eventOrder[a.Type] < eventOrder[b.Type]
+		}
+		if sa, sb := severityLevel(a.Severity), severityLevel(b.Severity); sa != sb {
+			return sa < sb
+		}
+		if a.Workload != b.Workload {
+			return a.Workload < b.Workload
+		}
+		if a.CVE != b.CVE {
+			return a.CVE < b.CVE
+		}
+		return a.ID < b.ID
+	})
+}
+
+// upsert stores records seen in a scan and returns NEW events for the ones
+// that are new or reopened, and SEVERITY_CHANGED events for open ones that
+// were rescored upwards (or downwards with TRIX_NOTIFY_DOWNGRADES). Open
+// records whose image digest changed add an IMAGE_CHANGED event, merged
+// per container by summarizeImageChanges.
+func (p *Poller) upsert(ctx context.Context, records []*VulnerabilityRecord) []VulnerabilityEvent {
+	var events []VulnerabilityEvent
+	for _, record := range records {
+		change, err := p.db.UpsertVulnerability(ctx, record)
 		if err != nil {
 			p.logger.Error("failed to upsert vulnerability", "id", record.ID, "error", err)
 			continue
 		}
 
-		if isNew {
-			events = append(events, VulnerabilityEvent{
-				ID:              record.ID,
-				Type:            "NEW",
-				CVE:             record.CVE,
-				Workload:        record.Workload,
-				Severity:        record.Severity,
-				Image:           record.Image,
-				ContainerName:   record.ContainerName,
-				ImageRepository: record.ImageRepository,
-				ImageTag:        record.ImageTag,
-				ImageDigest:     record.ImageDigest,
-				FirstSeen:       time.Now(),
-			})
+		if change.OldImageDigest != "" {
+			events = append(events, imageChangedEvent(recordEvent("IMAGE_CHANGED", record), change.OldImageDigest))
+		}
+
+		switch {
+		case change.New:
+			event := recordEvent("NEW", record)
+			event.FirstSeen = time.Now()
+			events = append(events, event)
+		case change.OldSeverity != "":
+			upgrade := severityLevel(record.Severity) < severityLevel(change.OldSeverity)
+			p.logger.Debug("severity changed", "id", record.ID, "cve", record.CVE, "from", change.OldSeverity, "to", record.Severity)
+			if !upgrade && !p.config.NotifyDowngrades {
+				continue
+			}
+			event := recordEvent("SEVERITY_CHANGED", record)
+			event.OldSeverity = change.OldSeverity
+			event.FirstSeen = change.FirstSeen
+			events = append(events, event)
 		}
 	}
+	return events
+}
 
-	// Mark vulnerabilities not in current scan as fixed
-	fixed, err := p.db.MarkFixed(ctx, currentIDs)
-	if err != nil {
-		p.logger.Error("failed to mark fixed vulnerabilities", "error", err)
-	} else {
-		for _, v := range fixed {
-			events = append(events, VulnerabilityEvent{
-				ID:              v.ID,
-				Type:            "FIXED",
-				CVE:             v.CVE,
-				Workload:        v.Workload,
-				Severity:        v.Severity,
-				Image:           v.Image,
-				ContainerName:   v.ContainerName,
-				ImageRepository: v.ImageRepository,
-				ImageTag:        v.ImageTag,
-				ImageDigest:     v.ImageDigest,
-				FirstSeen:       v.FirstSeen,
-				FixedAt:         v.FixedAt,
-			})
-		}
-	}
-
-	p.logger.Info("poll complete", "new", countByType(events, "NEW"), "fixed", countByType(events, "FIXED"))
+// imageKey identifies a container of a workload
+type imageKey struct{ workload, container string }
 
-	return events, nil
+func (e VulnerabilityEvent) imageKey() imageKey {
+	return imageKey{e.Workload, e.ContainerName}
 }
 
-// getFindings retrieves all vulnerability findings from Trivy CRDs.
-func (p *Poller) getFindings(ctx context.Context) ([]trivy.Finding, error) {
-	// Use the existing scanner infrastructure
-	scanners := []trivy.Scanner{
-		trivy.NewTrivyVulnScanner(p.trivyClient),
-		trivy.NewClusterVulnScanner(p.trivyClient),
+// imageChangedEvent builds the IMAGE_CHANGED event for the container of e,
+// whose image changed from oldDigest to e.ImageDigest.
+func imageChangedEvent(e VulnerabilityEvent, oldDigest string) VulnerabilityEvent {
+	idHash := sha256.Sum256([]byte("image" + e.Workload + e.ContainerName + e.ImageDigest))
+	return VulnerabilityEvent{
+		ID:              fmt.Sprintf("%x", idHash[:8]),
+		Type:            "IMAGE_CHANGED",
+		Kind:            KindVulnerability,
+		Workload:        e.Workload,
+		ContainerName:   e.ContainerName,
+		ImageRepository: e.ImageRepository,
+		ImageTag:        e.ImageTag,
+		ImageDigest:     e.ImageDigest,
+		OldImageDigest:  oldDigest,
+		FirstSeen:       time.Now(),
 	}
+}
 
-	var allFindings []trivy.Finding
+// summarizeImageChanges merges the IMAGE_CHANGED events of a scan into one
+// per container and counts the NEW and FIXED events each accounts for. A
+// container whose NEW and FIXED events carry different digests changed its
+// image too, even when none of its findings survived the change.
+func summarizeImageChanges(events []VulnerabilityEvent) []VulnerabilityEvent {
+	changes := make(map[imageKey]*VulnerabilityEvent)
+	added := make(map[imageKey]VulnerabilityEvent)   // A NEW event per container
+	removed := make(map[imageKey]VulnerabilityEvent) // A FIXED event per container
+	out := make([]VulnerabilityEvent, 0, len(events))
+	for _, e := range events {
+		k := e.imageKey()
+		switch e.Type {
+		case "IMAGE_CHANGED":
+			if changes[k] == nil {
+				change := e
+				changes[k] = &change
+			}
+			continue
+		case "NEW":
+			if e.ImageDigest != "" {
+				added[k] = e
+			}
+		case "FIXED":
+			if e.ImageDigest != "" {
+				removed[k] = e
+			}
+		}
+		out = append(out, e)
+	}
+	for k, fixed := range removed {
+		if n, ok := added[k]; ok && changes[k] == nil && n.ImageDigest != fixed.ImageDigest {
+			change := imageChangedEvent(n, fixed.ImageDigest)
+			changes[k] = &change
+		}
+	}
 
-	for _, scanner := range scanners {
-		if len(p.config.Namespaces) > 0 {
-			// Scan specific namespaces
-			for _, ns := range p.config.Namespaces {
-				findings, err := scanner.Scan(ctx, ns)
-				if err != nil {
-					p.logger.Warn("scanner failed", "scanner", scanner.Name(), "namespace", ns, "error", err)
-					continue
+	for _, change := range changes {
+		for _, e := range out {
+			if fromImageChange(*change, e) {
+				if e.Type == "NEW" {
+					change.Added++
+				} else {
+					change.Removed++
 				}
-				allFindings = append(allFindings, findings...)
-			}
-		} else {
-			// Scan all namespaces
-			findings, err := scanner.Scan(ctx, "")
-			if err != nil {
-				p.logger.Warn("scanner failed", "scanner", scanner.Name(), "error", err)
-				continue
 			}
-			allFindings = append(allFindings, findings...)
 		}
+		out = append(out, *change)
 	}
+	return out
+}
+
+// markFixed marks every open finding of kinds not in open as fixed, writes a
+// snapshot of the result, and returns FIXED events.
+func (p *Poller) markFixed(ctx context.Context, kinds []string, open []*VulnerabilityRecord) []VulnerabilityEvent {
+	ctx, span := p.tracer.Start(ctx, "trix.reconcile", trace.WithAttributes(
+		attribute.StringSlice("trix.kinds", kinds),
+		attribute.Int("trix.open", len(open)),
+	))
 
-	// Filter to only vulnerability type
-	var vulnFindings []trivy.Finding
-	for _, f := range allFindings {
-		if f.Type == trivy.FindingTypeVulnerability {
-			vulnFindings = append(vulnFindings, f)
+	currentIDs := make([]string, 0, len(open))
+	for _, record := range open {
+		currentIDs = append(currentIDs, record.ID)
+	}
+
+	var events []VulnerabilityEvent
+	fixed, err := p.db.MarkFixed(ctx, p.scope(), kinds, currentIDs)
+	if err != nil {
+		p.logger.Error("failed to mark fixed vulnerabilities", "error", err)
+	} else {
+		span.SetAttributes(attribute.Int("trix.fixed", len(fixed)))
+		for i := range fixed {
+			events = append(events, recordEvent("FIXED", &fixed[i]))
 		}
 	}
 
-	return vulnFindings, nil
+	p.writeSnapshot(ctx, open)
+	endSpan(span, err)
+	return events
 }
 
-// findingToRecord converts a Trivy finding to a database record.
-func (p *Poller) findingToRecord(f trivy.Finding) *VulnerabilityRecord {
-	workload := fmt.Sprintf("%s/%s/%s", f.Namespace, f.ResourceKind, f.ResourceName)
+// scope returns the namespaces reconciliation may touch: the configured
+// namespaces plus "" for cluster-scoped reports, or nil for all namespaces.
+// Vulnerabilities in namespaces that aren't watched are never marked fixed.
+func (p *Poller) scope() []string {
+	if len(p.config.Namespaces) == 0 {
+		return nil
+	}
+	return append([]string{""}, p.config.Namespaces...)
+}
 
-	// Extract package info from raw data
-	pkgName := ""
-	pkgVersion := ""
-	if raw, ok := f.RawData.(trivy.Vulnerability); ok {
-		pkgName = raw.PkgName
-		pkgVersion = raw.InstalledVersion
+// writeSnapshot records post-reconciliation counts for trend reporting.
+// Failures are logged; a missing snapshot only leaves a gap in the trend.
+func (p *Poller) writeSnapshot(ctx context.Context, open []*VulnerabilityRecord) {
+	stats, err := p.db.GetStats(ctx, 0)
+	if err != nil {
+		p.logger.Error("failed to get stats for snapshot", "error", err)
+		return
 	}
 
-	// Create unique ID from CVE + workload + package + container
-	// Including container ensures same CVE in different containers of same workload are tracked separately
-	idHash := sha256.Sum256([]byte(f.ID + workload + pkgName + f.ContainerName))
-	id := fmt.Sprintf("%x", idHash[:8])
+	byNamespace := make(map[string]int)
+	seen := make(map[string]bool, len(open))
+	for _, record := range open {
+		if seen[record.ID] {
+			continue
+		}
+		seen[record.ID] = true
+		byNamespace[record.Namespace]++
+	}
 
-	image := ""
-	if pkgName != "" {
-		image = fmt.Sprintf("%s:%s", pkgName, pkgVersion)
+	if err := p.db.WriteSnapshot(ctx, &Snapshot{
+		TakenAt:     time.Now(),
+		TotalOpen:   stats.TotalOpen,
+		TotalFixed:  stats.TotalFixed,
+		BySeverity:  stats.BySeverity,
+		ByNamespace: byNamespace,
+	}); err != nil {
+		p.logger.Error("failed to write snapshot", "error", err)
 	}
+}
+
+// findingToRecord converts a Trivy finding to a database record, or returns
+// nil for finding types the server doesn't track.
+func (p *Poller) findingToRecord(f trivy.Finding) *VulnerabilityRecord {
+	workload := fmt.Sprintf("%s/%s/%s", f.Namespace, f.ResourceKind, f.ResourceName)
 
-	return &VulnerabilityRecord{
-		ID:              id,
+	record := &VulnerabilityRecord{
+		Kind:            string(f.Type),
 		CVE:             f.ID,
 		Workload:        workload,
+		Namespace:       f.Namespace,
 		Severity:        string(f.Severity),
-		Image:           image,
 		ContainerName:   f.ContainerName,
 		ImageRepository: f.ImageRepository,
 		ImageTag:        f.ImageTag,
 		ImageDigest:     f.ImageDigest,
 		State:           StateOpen,
 	}
+
+	var idKey string
+	switch f.Type {
+	case trivy.FindingTypeVulnerability:
+		// Create unique ID from CVE + workload + package + container
+		// Including container ensures same CVE in different containers of same workload are tracked separately
+		raw, _ := f.RawData.(trivy.Vulnerability)
+		idKey = f.ID + workload + raw.PkgName + f.ContainerName
+		if raw.PkgName != "" {
+			record.Image = fmt.Sprintf("%s:%s", raw.PkgName, raw.InstalledVersion)
+		}
+		record.FixedVersion = raw.FixedVersion
+	case trivy.FindingTypeSecret:
+		// Kind-prefixed so IDs never collide with vulnerabilities; the same
+		// rule can match several files of one container
+		raw, _ := f.RawData.(trivy.ExposedSecret)
+		idKey = KindSecret + f.ID + workload + f.ContainerName + raw.Target
+		record.Title = f.Title
+		record.Image = raw.Target
+	case trivy.FindingTypeCompliance:
+		idKey = KindCompliance + f.ID + workload
+		record.Title = f.Title
+	default:
+		return nil
+	}
+
+	idHash := sha256.Sum256([]byte(idKey))
+	record.ID = fmt.Sprintf("%x", idHash[:8])
+	return record
 }
 
 func countByType(events []VulnerabilityEvent, eventType string) int {
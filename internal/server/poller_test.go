@@ -0,0 +1,251 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var fixtureSeverities = []string{"LOW", "CRITICAL", "MEDIUM", "HIGH"}
+
+// fixtureReports returns n reports spread over three namespaces, each with a
+// few vulnerabilities of mixed severity
+func fixtureReports(n int) []runtime.Object {
+	var objects []runtime.Object
+	for i := 0; i < n; i++ {
+		var vulns []fixtureVuln
+		for j := 0; j < 3; j++ {
+			vulns = append(vulns, fixtureVuln{
+				CVE:       fmt.Sprintf("CVE-2024-%04d", (i*7+j)%50),
+				Severity:  fixtureSeverities[(i+j)%len(fixtureSeverities)],
+				Package:   "pkg" + strconv.Itoa(j),
+				Installed: "1.0.0",
+				Fixed:     "1.0.1",
+			})
+		}
+		ns := fmt.Sprintf("ns-%d", i%3)
+		objects = append(objects, vulnReport(ns, fmt.Sprintf("app-%03d", i), "sha256:aaa", vulns...))
+	}
+	return objects
+}
+
+func TestPollConcurrentEventOrder(t *testing.T) {
+	reports := fixtureReports(200)
+
+	poll := func(concurrency int) []VulnerabilityEvent {
+		cfg := testConfig(t, map[string]string{"TRIX_POLL_CONCURRENCY": strconv.Itoa(concurrency)})
+		p := testPoller(cfg, NewMemoryStore(), fakeDynamic(reports...))
+		events, err := p.Poll(context.Background())
+		if err != nil {
+			t.Fatalf("Poll: %v", err)
+		}
+		return events
+	}
+
+	serial := poll(1)
+	if len(serial) != 600 {
+		t.Fatalf("got %d events, want 600", len(serial))
+	}
+	for i := 1; i < len(serial); i++ {
+		a, b := serial[i-1], serial[i]
+		sa, sb := severityLevel(a.Severity), severityLevel(b.Severity)
+		if sa > sb || (sa == sb && a.Workload > b.Workload) {
+			t.Fatalf("events %d and %d out of order: %s %s before %s %s", i-1, i, a.Severity, a.Workload, b.Severity, b.Workload)
+		}
+	}
+
+	for run := 0; run < 5; run++ {
+		if concurrent := poll(8); !reflect.DeepEqual(eventKeys(concurrent), eventKeys(serial)) {
+			t.Fatalf("run %d: concurrent poll ordered events differently from serial poll", run)
+		}
+	}
+}
+
+// eventKeys identifies events independent of timestamps
+func eventKeys(events []VulnerabilityEvent) []string {
+	keys := make([]string, 0, len(events))
+	for _, e := range events {
+		keys = append(keys, e.Type+" "+e.ID)
+	}
+	return keys
+}
+
+func TestPollIncompleteListingSkipsReconciliation(t *testing.T) {
+	cfg := testConfig(t, map[string]string{"TRIX_TRACK_TYPES": "vulnerability,secret"})
+	db := NewMemoryStore()
+	ctx := context.Background()
+
+	first := testPoller(cfg, db, fakeDynamic(fixtureReports(3)...))
+	if _, err := first.Poll(ctx); err != nil {
+		t.Fatalf("first Poll: %v", err)
+	}
+
+	// The second listing fails part way, as with an expired continue token
+	dyn := fakeDynamic(fixtureReports(1)...)
+	dyn.PrependReactor("list", "vulnerabilityreports", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewResourceExpired("continue token expired")
+	})
+	events, err := testPoller(cfg, db, dyn).Poll(ctx)
+	if err != nil {
+		t.Fatalf("second Poll: %v", err)
+	}
+	if n := countByType(events, "FIXED"); n != 0 {
+		t.Errorf("got %d FIXED events after an incomplete listing, want 0", n)
+	}
+	open, err := db.GetOpenVulnerabilities(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(open) != 9 {
+		t.Errorf("got %d open vulnerabilities, want all 9 still open", len(open))
+	}
+
+	// Once listing works again, the removed reports are reconciled
+	events, err = testPoller(cfg, db, fakeDynamic(fixtureReports(1)...)).Poll(ctx)
+	if err != nil {
+		t.Fatalf("third Poll: %v", err)
+	}
+	if n := countByType(events, "FIXED"); n != 6 {
+		t.Errorf("got %d FIXED events, want 6", n)
+	}
+}
+
+// cancellingStore cancels the poll once its first upsert has gone through
+type cancellingStore struct {
+	Store
+	cancel context.CancelFunc
+}
+
+func (s *cancellingStore) UpsertVulnerability(ctx context.Context, v *VulnerabilityRecord) (VulnerabilityChange, error) {
+	if err := ctx.Err(); err != nil {
+		return VulnerabilityChange{}, err
+	}
+	defer s.cancel()
+	return s.Store.UpsertVulnerability(ctx, v)
+}
+
+// A cancelled poll returns the events of its upserts and is not reconciled
+func TestPollCancelledReturnsEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	db := &cancellingStore{Store: NewMemoryStore(), cancel: cancel}
+	mustUpsert(t, db.Store, storeRecord("old", "payments", KindVulnerability, "CRITICAL"))
+
+	cfg := testConfig(t, map[string]string{"TRIX_POLL_CONCURRENCY": "1"})
+	events, err := testPoller(cfg, db, fakeDynamic(fixtureReports(3)...)).Poll(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Poll err = %v, want context.Canceled", err)
+	}
+	if len(events) != 1 || events[0].Type != "NEW" {
+		t.Fatalf("events = %v, want the one upserted NEW", eventKeys(events))
+	}
+	if v := mustGet(t, db.Store, "old"); v.State != StateOpen {
+		t.Error("cancelled poll marked vulnerabilities fixed")
+	}
+}
+
+// slowStore adds a fixed latency to each upsert, like a database round trip
+type slowStore struct {
+	Store
+	latency time.Duration
+}
+
+func (s *slowStore) UpsertVulnerability(ctx context.Context, v *VulnerabilityRecord) (VulnerabilityChange, error) {
+	time.Sleep(s.latency)
+	return s.Store.UpsertVulnerability(ctx, v)
+}
+
+// BenchmarkPoll shows the speedup of TRIX_POLL_CONCURRENCY when upserts
+// wait on the database.
+func BenchmarkPoll(b *testing.B) {
+	reports := fixtureReports(100)
+	for _, concurrency := range []int{1, 8} {
+		b.Run(fmt.Sprintf("concurrency=%d", concurrency), func(b *testing.B) {
+			cfg := testConfig(b, map[string]string{"TRIX_POLL_CONCURRENCY": strconv.Itoa(concurrency)})
+			for i := 0; i < b.N; i++ {
+				db := &slowStore{Store: NewMemoryStore(), latency: 200 * time.Microsecond}
+				p := testPoller(cfg, db, fakeDynamic(reports...))
+				if _, err := p.Poll(context.Background()); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// Only the configured namespaces are listed and reconciled; vulnerabilities
+// recorded in other namespaces, e.g. before TRIX_NAMESPACES was set, are
+// left alone.
+func TestPollNamespaces(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryStore()
+	critical := fixtureVuln{"CVE-2024-0001", "CRITICAL", "openssl", "3.0.1", "3.0.8"}
+	high := fixtureVuln{"CVE-2024-0002", "HIGH", "zlib", "1.2.11", "1.2.12"}
+
+	all := testConfig(t, nil)
+	if _, err := testPoller(all, db, fakeDynamic(
+		vulnReport("payments", "api", "sha256:aaa", critical),
+		vulnReport("shop", "web", "sha256:bbb", high),
+	)).Poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// payments fixed its CVE; shop is not watched any more
+	scoped := testConfig(t, map[string]string{"TRIX_NAMESPACES": "payments"})
+	dyn := fakeDynamic(
+		vulnReport("payments", "api", "sha256:aaa"),
+		vulnReport("shop", "web", "sha256:bbb"),
+	)
+	events, err := testPoller(scoped, db, dyn).Poll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Type != "FIXED" || events[0].CVE != critical.CVE {
+		t.Errorf("events = %v, want payments' CVE fixed", eventKeys(events))
+	}
+
+	open, err := db.GetOpenVulnerabilities(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(open) != 1 || open[0].Namespace != "shop" || open[0].CVE != high.CVE {
+		t.Errorf("open = %+v, want the unwatched shop vulnerability", open)
+	}
+
+	var listed []string
+	for _, a := range dyn.Actions() {
+		if a.GetVerb() == "list" {
+			listed = append(listed, a.GetResource().Resource+"@"+a.GetNamespace())
+		}
+	}
+	want := []string{"vulnerabilityreports@payments", "clustervulnerabilityreports@"}
+	if !reflect.DeepEqual(listed, want) {
+		t.Errorf("listed %v, want %v", listed, want)
+	}
+}
+
+func TestTimeToFix(t *testing.T) {
+	firstSeen := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	fixedAt := firstSeen.Add(4*24*time.Hour + 6*time.Hour + 1500*time.Millisecond)
+	if got := timeToFix(firstSeen, &fixedAt); got != 4*86400+6*3600+1 {
+		t.Errorf("timeToFix = %d", got)
+	}
+	if got := timeToFix(firstSeen, nil); got != 0 {
+		t.Errorf("timeToFix(open) = %d", got)
+	}
+	fixed := recordEvent("FIXED", &VulnerabilityRecord{ID: "1", State: StateFixed, FirstSeen: firstSeen, FixedAt: &fixedAt})
+	if fixed.TimeToFix != 4*86400+6*3600+1 {
+		t.Errorf("FIXED event TimeToFix = %d", fixed.TimeToFix)
+	}
+	if e := recordEvent("NEW", &VulnerabilityRecord{ID: "1", FirstSeen: firstSeen}); e.TimeToFix != 0 {
+		t.Errorf("NEW event has a time to fix: %d", e.TimeToFix)
+	}
+}
@@ -0,0 +1,192 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// VulnerabilityFilter selects vulnerabilities for ListVulnerabilities.
+// Empty fields match everything.
+type VulnerabilityFilter struct {
+	Kind            string
+	State           VulnerabilityState
+	Severity        string
+	Workload        string // Exact namespace/kind/name
+	NamespacePrefix string // Matches workloads whose namespace starts with this
+	CVE             string
+	Limit           int // 0 = no limit
+	Offset          int // Only applies with a Limit
+}
+
+// matches reports whether a record passes the filter (ignoring pagination)
+func (f VulnerabilityFilter) matches(v *VulnerabilityRecord) bool {
+	if f.Kind != "" && v.Kind != f.Kind {
+		return false
+	}
+	if f.State != "" && v.State != f.State {
+		return false
+	}
+	if f.Severity != "" && !strings.EqualFold(v.Severity, f.Severity) {
+		return false
+	}
+	if f.Workload != "" && v.Workload != f.Workload {
+		return false
+	}
+	if f.NamespacePrefix != "" && !strings.HasPrefix(v.Workload, f.NamespacePrefix) {
+		return false
+	}
+	if f.CVE != "" && !strings.EqualFold(v.CVE, f.CVE) {
+		return false
+	}
+	return true
+}
+
+// severityOrderSQL orders rows most severe first
+const severityOrderSQL = `CASE severity
+				WHEN 'CRITICAL' THEN 1
+				WHEN 'HIGH' THEN 2
+				WHEN 'MEDIUM' THEN 3
+				WHEN 'LOW' THEN 4
+				ELSE 5
+			END`
+
+// ListVulnerabilities returns one page of matching vulnerabilities, most
+// severe first, and the total number of matches.
+func (db *DB) ListVulnerabilities(ctx context.Context, f VulnerabilityFilter) ([]VulnerabilityRecord, int, error) {
+	var conds []string
+	var args []interface{}
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	if f.Kind != "" {
+		add("kind = $%d", f.Kind)
+	}
+	if f.State != "" {
+		add("state = $%d", f.State)
+	}
+	if f.Severity != "" {
+		add("severity = $%d", strings.ToUpper(f.Severity))
+	}
+	if f.Workload != "" {
+		add("workload = $%d", f.Workload)
+	}
+	if f.NamespacePrefix != "" {
+		add("workload LIKE $%d", escapeLike(f.NamespacePrefix)+"%")
+	}
+	if f.CVE != "" {
+		add("UPPER(cve) = UPPER($%d)", f.CVE)
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = "WHERE " + strings.Join(conds, " AND ")
+	}
+
+	var total int
+	if err := db.queryRow(ctx, "SELECT COUNT(*) FROM vulnerabilities "+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+		SELECT id, kind, cve, COALESCE(title, ''), COALESCE(fixed_version, ''), COALESCE(exposure, ''), workload, severity, image,
+		       COALESCE(container_name, ''), COALESCE(image_repository, ''), COALESCE(image_tag, ''), COALESCE(image_digest, ''),
+		       state, first_seen, last_seen, fixed_at
+		FROM vulnerabilities ` + where + `
+		ORDER BY ` + severityOrderSQL + `, first_seen DESC, id`
+	if f.Limit > 0 {
+		args = append(args, f.Limit, f.Offset)
+		query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+	}
+
+	rows, err := db.query(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	vulns := []VulnerabilityRecord{}
+	for rows.Next() {
+		var v VulnerabilityRecord
+		if err := rows.Scan(&v.ID, &v.Kind, &v.CVE, &v.Title, &v.FixedVersion, &v.Exposure, &v.Workload, &v.Severity, &v.Image,
+			&v.ContainerName, &v.ImageRepository, &v.ImageTag, &v.ImageDigest,
+			&v.State, &v.FirstSeen, &v.LastSeen, &v.FixedAt); err != nil {
+			return nil, 0, err
+		}
+		vulns = append(vulns, v)
+	}
+
+	return vulns, total, rows.Err()
+}
+
+// GetVulnerability returns a single vulnerability, or nil if it doesn't exist.
+func (db *DB) GetVulnerability(ctx context.Context, id string) (*VulnerabilityRecord, error) {
+	var v VulnerabilityRecord
+	err := db.queryRow(ctx, `
+		SELECT id, kind, cve, COALESCE(title, ''), COALESCE(fixed_version, ''), COALESCE(exposure, ''), workload, severity, image,
+		       COALESCE(container_name, ''), COALESCE(image_repository, ''), COALESCE(image_tag, ''), COALESCE(image_digest, ''),
+		       state, first_seen, last_seen, fixed_at
+		FROM vulnerabilities WHERE id = $1
+	`, id).Scan(&v.ID, &v.Kind, &v.CVE, &v.Title, &v.FixedVersion, &v.Exposure, &v.Workload, &v.Severity, &v.Image,
+		&v.ContainerName, &v.ImageRepository, &v.ImageTag, &v.ImageDigest,
+		&v.State, &v.FirstSeen, &v.LastSeen, &v.FixedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// escapeLike escapes LIKE wildcards so s matches literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// ListVulnerabilities returns one page of matching vulnerabilities, most
+// severe first, and the total number of matches.
+func (m *MemoryStore) ListVulnerabilities(ctx context.Context, f VulnerabilityFilter) ([]VulnerabilityRecord, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	vulns := []VulnerabilityRecord{}
+	for _, r := range m.vulns {
+		if f.matches(&r.VulnerabilityRecord) {
+			vulns = append(vulns, r.VulnerabilityRecord)
+		}
+	}
+	sort.Slice(vulns, func(i, j int) bool {
+		si, sj := severityLevel(vulns[i].Severity), severityLevel(vulns[j].Severity)
+		if si != sj {
+			return si < sj
+		}
+		if !vulns[i].FirstSeen.Equal(vulns[j].FirstSeen) {
+			return vulns[i].FirstSeen.After(vulns[j].FirstSeen)
+		}
+		return vulns[i].ID < vulns[j].ID
+	})
+
+	total := len(vulns)
+	if f.Limit > 0 {
+		start := min(f.Offset, total)
+		vulns = vulns[start:min(start+f.Limit, total)]
+	}
+	return vulns, total, nil
+}
+
+// GetVulnerability returns a single vulnerability, or nil if it doesn't exist.
+func (m *MemoryStore) GetVulnerability(ctx context.Context, id string) (*VulnerabilityRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r, ok := m.vulns[id]
+	if !ok {
+		return nil, nil
+	}
+	v := r.VulnerabilityRecord
+	return &v, nil
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// DigestSchedule is when digests are sent: every day, or on one day of the
+// week, at a wall-clock time in TRIX_TZ.
+type DigestSchedule struct {
+	Weekly  bool
+	Weekday time.Weekday // Only with Weekly
+	Hour    int
+	Minute  int
+}
+
+// ParseDigestSchedule accepts daily@HH:MM, weekly@DAY@HH:MM (DAY is mon..sun)
+// or a cron expression "M H * * D" whose day of month and month are *.
+func ParseDigestSchedule(s string) (*DigestSchedule, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+
+	if fields := strings.Fields(s); len(fields) == 5 {
+		return parseCronSchedule(fields)
+	}
+
+	parts := strings.Split(s, "@")
+	var sched DigestSchedule
+	var clock string
+	switch {
+	case len(parts) == 2 && parts[0] == "daily":
+		clock = parts[1]
+	case len(parts) == 3 && parts[0] == "weekly":
+		day, ok := weekdays[parts[1]]
+		if !ok {
+			return nil, fmt.Errorf("invalid day %q (use mon..sun)", parts[1])
+		}
+		sched.Weekly, sched.Weekday = true, day
+		clock = parts[2]
+	default:
+		return nil, fmt.Errorf("invalid schedule %q (e.g. daily@08:00, weekly@mon@08:00, \"0 8 * * 1\")", s)
+	}
+
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time %q (use HH:MM)", clock)
+	}
+	sched.Hour, sched.Minute = t.Hour(), t.Minute()
+	return &sched, nil
+}
+
+// parseCronSchedule handles the cron subset that maps onto a DigestSchedule
+func parseCronSchedule(fields []string) (*DigestSchedule, error) {
+	minute, err := strconv.Atoi(fields[0])
+	if err != nil || minute < 0 || minute > 59 {
+		return nil, fmt.Errorf("invalid cron minute %q (0-59)", fields[0])
+	}
+	hour, err := strconv.Atoi(fields[1])
+	if err != nil || hour < 0 || hour > 23 {
+		return nil, fmt.Errorf("invalid cron hour %q (0-23)", fields[1])
+	}
+	if fields[2] != "*" || fields[3] != "*" {
+		return nil, fmt.Errorf("cron day of month and month must be *")
+	}
+
+	sched := &DigestSchedule{Hour: hour, Minute: minute}
+	if dow := fields[4]; dow != "*" {
+		day, ok := weekdays[dow]
+		if !ok {
+			n, err := strconv.Atoi(dow)
+			if err != nil || n < 0 || n > 7 {
+				return nil, fmt.Errorf("invalid cron day of week %q (0-7 or mon..sun)", dow)
+			}
+			day = time.Weekday(n % 7)
+		}
+		sched.Weekly, sched.Weekday = true, day
+	}
+	return sched, nil
+}
+
+// Next returns the first scheduled time strictly after after, in after's
+// location.
+func (s *DigestSchedule) Next(after time.Time) time.Time {
+	next := time.Date(after.Year(), after.Month(), after.Day(), s.Hour, s.Minute, 0, 0, after.Location())
+	for !next.After(after) || (s.Weekly && next.Weekday() != s.Weekday) {
+		next = time.Date(next.Year(), next.Month(), next.Day()+1, s.Hour, s.Minute, 0, 0, after.Location())
+	}
+	return next
+}
+
+func (s *DigestSchedule) String() string {
+	if s.Weekly {
+		return fmt.Sprintf("weekly on %s at %02d:%02d", s.Weekday, s.Hour, s.Minute)
+	}
+	return fmt.Sprintf("daily at %02d:%02d", s.Hour, s.Minute)
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDigestSchedule(t *testing.T) {
+	tests := []struct {
+		in   string
+		want DigestSchedule
+	}{
+		{"daily@08:00", DigestSchedule{Hour: 8}},
+		{" Daily@23:45 ", DigestSchedule{Hour: 23, Minute: 45}},
+		{"weekly@mon@07:30", DigestSchedule{Weekly: true, Weekday: time.Monday, Hour: 7, Minute: 30}},
+		{"0 8 * * *", DigestSchedule{Hour: 8}},
+		{"15 6 * * 1", DigestSchedule{Weekly: true, Weekday: time.Monday, Hour: 6, Minute: 15}},
+		{"0 9 * * 7", DigestSchedule{Weekly: true, Weekday: time.Sunday, Hour: 9}}, // 7 is Sunday too
+		{"0 9 * * fri", DigestSchedule{Weekly: true, Weekday: time.Friday, Hour: 9}},
+	}
+	for _, tt := range tests {
+		got, err := ParseDigestSchedule(tt.in)
+		if err != nil {
+			t.Errorf("ParseDigestSchedule(%q): %v", tt.in, err)
+			continue
+		}
+		if *got != tt.want {
+			t.Errorf("ParseDigestSchedule(%q) = %+v, want %+v", tt.in, *got, tt.want)
+		}
+	}
+
+	for in, want := range map[string]string{
+		"hourly":               "invalid schedule",
+		"daily@8am":            "invalid time",
+		"daily@24:00":          "invalid time",
+		"weekly@someday@08:00": "invalid day",
+		"60 8 * * *":           "invalid cron minute",
+		"0 24 * * *":           "invalid cron hour",
+		"0 8 1 * *":            "day of month and month must be *",
+		"0 8 * * 8":            "invalid cron day of week",
+	} {
+		if _, err := ParseDigestSchedule(in); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("ParseDigestSchedule(%q) err = %v, want %q", in, err, want)
+		}
+	}
+}
+
+func TestDigestScheduleNext(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("no time zone data: %v", err)
+	}
+	daily := &DigestSchedule{Hour: 8}
+	monday := &DigestSchedule{Weekly: true, Weekday: time.Monday, Hour: 8}
+
+	tests := []struct {
+		name  string
+		sched *DigestSchedule
+		after time.Time
+		want  time.Time
+	}{
+		{"before today's time", daily, time.Date(2024, 5, 1, 7, 59, 0, 0, berlin), time.Date(2024, 5, 1, 8, 0, 0, 0, berlin)},
+		{"at the boundary", daily, time.Date(2024, 5, 1, 8, 0, 0, 0, berlin), time.Date(2024, 5, 2, 8, 0, 0, 0, berlin)},
+		{"just after", daily, time.Date(2024, 5, 1, 8, 0, 1, 0, berlin), time.Date(2024, 5, 2, 8, 0, 0, 0, berlin)},
+		{"new year", daily, time.Date(2024, 12, 31, 9, 0, 0, 0, berlin), time.Date(2025, 1, 1, 8, 0, 0, 0, berlin)},
+		{"over the DST switch", daily, time.Date(2024, 3, 30, 12, 0, 0, 0, berlin), time.Date(2024, 3, 31, 8, 0, 0, 0, berlin)},
+		{"weekly on a Wednesday", monday, time.Date(2024, 5, 1, 12, 0, 0, 0, berlin), time.Date(2024, 5, 6, 8, 0, 0, 0, berlin)},
+		{"weekly on the day, before", monday, time.Date(2024, 5, 6, 7, 0, 0, 0, berlin), time.Date(2024, 5, 6, 8, 0, 0, 0, berlin)},
+		{"weekly at the boundary", monday, time.Date(2024, 5, 6, 8, 0, 0, 0, berlin), time.Date(2024, 5, 13, 8, 0, 0, 0, berlin)},
+	}
+	for _, tt := range tests {
+		got := tt.sched.Next(tt.after)
+		if !got.Equal(tt.want) || got.Location() != berlin {
+			t.Errorf("%s: Next(%s) = %s, want %s", tt.name, tt.after, got, tt.want)
+		}
+	}
+
+	// The wall-clock time is in TRIX_TZ: 08:00 in Berlin is 06:00 UTC in summer
+	utc := time.Date(2024, 7, 1, 5, 0, 0, 0, time.UTC)
+	if got := daily.Next(utc.In(berlin)); !got.Equal(time.Date(2024, 7, 1, 6, 0, 0, 0, time.UTC)) {
+		t.Errorf("Next in Berlin = %s", got.UTC())
+	}
+}
+
+func TestDigestScheduleString(t *testing.T) {
+	if got := (&DigestSchedule{Hour: 8, Minute: 5}).String(); got != "daily at 08:05" {
+		t.Errorf("String = %q", got)
+	}
+	if got := (&DigestSchedule{Weekly: true, Weekday: time.Friday, Hour: 17}).String(); got != "weekly on Friday at 17:00" {
+		t.Errorf("String = %q", got)
+	}
+}
+
+func TestDigestConfig(t *testing.T) {
+	if cfg := testConfig(t, nil); cfg.DigestSchedule != nil {
+		t.Errorf("default schedule = %+v, want none", cfg.DigestSchedule)
+	}
+	cfg := testConfig(t, map[string]string{"TRIX_DIGEST_SCHEDULE": "weekly@mon@08:00", "TRIX_TZ": "UTC"})
+	if cfg.DigestSchedule == nil || !cfg.DigestSchedule.Weekly || cfg.Location != time.UTC {
+		t.Errorf("digest config = %+v in %v", cfg.DigestSchedule, cfg.Location)
+	}
+
+	for name, value := range map[string]string{
+		"TRIX_DIGEST_SCHEDULE": "sometimes",
+		"TRIX_TZ":              "Mars/Olympus_Mons",
+	} {
+		t.Setenv(ConfigFileEnv, "")
+		t.Setenv("TRIX_DATABASE_URL", "memory://")
+		t.Setenv(name, value)
+		if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "invalid "+name) {
+			t.Errorf("%s=%s: err = %v", name, value, err)
+		}
+		t.Setenv(name, "")
+	}
+}
@@ -2,32 +2,63 @@ package server
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
+	"math/rand/v2"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"sync/atomic"
 	"syscall"
 	"time"
+
+	"github.com/trixsec-dev/trix/internal/tools/kubectl"
+	coordinationv1 "k8s.io/client-go/kubernetes/typed/coordination/v1"
 )
 
 type Server struct {
 	config    *Config
-	db        *DB
+	db        Store
 	poller    *Poller
 	notifier  *Notifier
+	telemetry *telemetry
 	logger    *slog.Logger
 	ready     atomic.Bool
-	firstPoll bool
+	leading   atomic.Bool               // Holds the lease (always true without leader election)
+	lastPoll  atomic.Pointer[time.Time] // Last successful poll
+	firstPoll bool                      // Next poll is the first against an empty database
+
+	// Poll health, see readiness
+	pollErr      atomic.Pointer[pollFailure] // Last poll's error, nil when it succeeded
+	failedPolls  atomic.Int64                // Consecutive failed polls
+	pollingSince atomic.Pointer[time.Time]   // Start of the current poll loop
+
+	polling atomic.Bool   // A poll is running
+	pollNow chan struct{} // Requests from POST /api/v1/poll, holds at most one
+
+	// Leader election: the Lease client and this replica's name in the Lease
+	leases   coordinationv1.LeasesGetter
+	identity string
+
+	// Shutdown: stop is closed when it begins, after which no poll loop
+	// starts and running ones return once their current work is done.
+	stop     chan struct{}
+	stopMu   sync.Mutex // Orders loops.Add against stopping
+	stopping atomic.Bool
+	loops    sync.WaitGroup // Running poll loops
 }
 
 func New(config *Config, logger *slog.Logger) (*Server, error) {
 	ctx := context.Background()
 
-	db, err := NewDB(ctx, config.DatabaseURL)
+	db, err := NewStore(ctx, config, logger)
 	if err != nil {
 		return nil, err
 	}
+	if isMemoryURL(config.DatabaseURL) {
+		logger.Warn("using in-memory store, state will be lost on restart")
+	}
 
 	poller, err := NewPoller(db, config, logger)
 	if err != nil {
@@ -35,16 +66,40 @@ func New(config *Config, logger *slog.Logger) (*Server, error) {
 		return nil, err
 	}
 
-	notifier := NewNotifier(config, logger)
+	notifier := NewNotifier(config, db, logger)
+	notifier.cluster = newClusterInfo(config, poller.clientset, logger)
 
-	return &Server{
+	tel, err := newTelemetry(ctx, config)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	poller.tracer = tel.tracer
+	notifier.tracer = tel.tracer
+
+	srv := &Server{
 		config:    config,
 		db:        db,
 		poller:    poller,
 		notifier:  notifier,
+		telemetry: tel,
 		logger:    logger,
-		firstPoll: true,
-	}, nil
+		stop:      make(chan struct{}),
+		pollNow:   make(chan struct{}, 1),
+	}
+
+	if config.LeaderElection {
+		elector, err := kubectl.NewClient()
+		if err != nil {
+			_ = tel.close(ctx)
+			_ = db.Close()
+			return nil, fmt.Errorf("failed to create k8s client for leader election: %w", err)
+		}
+		srv.leases = elector.Clientset().CoordinationV1()
+		srv.identity = leaderIdentity()
+	}
+
+	return srv, nil
 }
 
 func (s *Server) Run(ctx context.Context) error {
@@ -55,40 +110,100 @@ func (s *Server) Run(ctx context.Context) error {
 	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT)
 
 	go s.runHealthServer(ctx)
-	go s.runPollLoop(ctx)
+	go watchClientTLS(ctx, s.logger, s.config.ClientTLS, s.config.WebhookTLS)
+	if s.config.LeaderElection {
+		go s.runLeaderElection(ctx)
+	} else {
+		s.leading.Store(true)
+		go s.runPollLoop(ctx)
+	}
 
 	select {
 	case sig := <-sigCh:
-		s.logger.Info("received signal, shutting down", "signal", sig)
+		s.logger.Info("received signal, shutting down", "signal", sig, "grace", s.config.ShutdownGrace)
 	case <-ctx.Done():
 	}
 
+	// Finish the in-flight poll and notifications before cancelling, so a
+	// poll is never cut off between upserts and reconciliation and recorded
+	// events are not left unnotified. The lease is only released after.
+	s.beginShutdown()
+	if !s.waitLoops(s.config.ShutdownGrace) {
+		s.logger.Warn("shutdown grace period expired, cancelling in-flight work", "grace", s.config.ShutdownGrace)
+		cancel()
+		s.loops.Wait()
+	}
 	cancel()
+
+	// Flush spans and events still buffered for the collector
+	flushCtx, flushCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer flushCancel()
+	if err := s.telemetry.close(flushCtx); err != nil {
+		s.logger.Warn("failed to flush telemetry", "error", err)
+	}
+
 	_ = s.db.Close()
 	return nil
 }
 
-func (s *Server) runHealthServer(ctx context.Context) {
+// beginShutdown marks the server not ready and stops the poll loops from
+// scheduling more work.
+func (s *Server) beginShutdown() {
+	s.stopMu.Lock()
+	defer s.stopMu.Unlock()
+	if s.stopping.Load() {
+		return
+	}
+	s.stopping.Store(true)
+	s.ready.Store(false)
+	close(s.stop)
+}
+
+// startLoop registers a poll loop, or returns false once shutdown has begun.
+func (s *Server) startLoop() bool {
+	s.stopMu.Lock()
+	defer s.stopMu.Unlock()
+	if s.stopping.Load() {
+		return false
+	}
+	s.loops.Add(1)
+	return true
+}
+
+// waitLoops waits up to grace for the poll loops to return and reports
+// whether they did.
+func (s *Server) waitLoops(grace time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		s.loops.Wait()
+		close(done)
+	}()
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// handler routes the health probes and the API
+func (s *Server) handler() http.Handler {
 	mux := http.NewServeMux()
 
-	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte("ok"))
-	})
-
-	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
-		if s.ready.Load() {
-			w.WriteHeader(http.StatusOK)
-			_, _ = w.Write([]byte("ok"))
-		} else {
-			w.WriteHeader(http.StatusServiceUnavailable)
-			_, _ = w.Write([]byte("not ready"))
-		}
-	})
+	mux.HandleFunc("/healthz", s.handleHealthz)
+	mux.HandleFunc("/readyz", s.handleReadyz)
+
+	s.registerAPI(mux)
 
+	return requireToken(s.config.APIToken, mux)
+}
+
+func (s *Server) runHealthServer(ctx context.Context) {
 	srv := &http.Server{
 		Addr:    s.config.HealthAddr,
-		Handler: mux,
+		Handler: s.handler(),
 	}
 
 	go func() {
@@ -98,66 +213,238 @@ func (s *Server) runHealthServer(ctx context.Context) {
 		_ = srv.Shutdown(shutdownCtx)
 	}()
 
-	s.logger.Info("health server starting", "addr", s.config.HealthAddr)
-	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+	s.logger.Info("http server starting",
+		"addr", s.config.HealthAddr,
+		"tls", s.config.TLSCert != "",
+		"api_auth", s.config.APIToken != "",
+	)
+	var err error
+	if s.config.TLSCert != "" {
+		err = srv.ListenAndServeTLS(s.config.TLSCert, s.config.TLSKey)
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
 		s.logger.Error("health server error", "error", err)
 	}
 }
 
+// runPollLoop polls until ctx is cancelled or shutdown begins. With leader
+// election it runs once per leadership term.
 func (s *Server) runPollLoop(ctx context.Context) {
+	if !s.startLoop() {
+		return
+	}
+	defer s.loops.Done()
+
 	s.logger.Info("starting poll loop", "interval", s.config.PollInterval)
+	started := time.Now()
+	s.pollingSince.Store(&started)
+
+	// Decide from the database, not process state, whether this is a fresh
+	// start: a restarted process or a new leader must not resend the
+	// initial summary.
+	stats, err := s.db.GetStats(ctx, 0)
+	if err != nil {
+		s.logger.Error("failed to read database state", "error", err)
+	}
+	s.firstPoll = err == nil && stats.TotalOpen == 0 && stats.TotalFixed == 0
+	if err == nil && !s.firstPoll {
+		s.logger.Info("resumed monitoring, database has existing data")
+	}
 
 	// Initial poll
 	s.poll(ctx)
 	s.ready.Store(true)
 
-	ticker := time.NewTicker(s.config.PollInterval)
-	defer ticker.Stop()
+	// In watch mode, changes arrive through the watch and full polls only
+	// heal drift, so they run at the (longer) resync interval.
+	interval := s.config.PollInterval
+	var batches <-chan []VulnerabilityEvent
+	if s.config.Watch {
+		interval = s.config.WatchResync
+		batches = s.poller.Watch(ctx, s.stop, s.config.WatchDebounce)
+	}
+
+	timer := time.NewTimer(jitter(interval, s.config.PollJitter))
+	defer timer.Stop()
+
+	// Digests are sent from the poll loop so only the leader sends them
+	var emailDigest, digest <-chan time.Time
+	if s.config.SMTPHost != "" && s.config.EmailDigest != "" {
+		emailDigest = s.scheduleEmailDigest()
+	}
+	if s.config.DigestSchedule != nil {
+		digest = s.scheduleDigest()
+	}
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
+		case <-s.stop:
+			// The watch flushes what it has recorded and closes batches
+			if batches != nil {
+				for events := range batches {
+					s.notify(ctx, events)
+				}
+			}
+			s.logger.Info("poll loop stopped")
+			return
+		case <-timer.C:
+			// select may pick the timer over a stop closed meanwhile
+			if s.stopping.Load() {
+				continue
+			}
 			s.poll(ctx)
+			timer.Reset(jitter(interval, s.config.PollJitter))
+		case <-s.pollNow:
+			if s.stopping.Load() {
+				continue
+			}
+			s.logger.Info("poll requested through the API")
+			s.poll(ctx)
+			timer.Reset(jitter(interval, s.config.PollJitter))
+		case events := <-batches:
+			s.notify(ctx, events)
+		case <-emailDigest:
+			if err := s.notifier.SendEmailDigest(ctx); err != nil {
+				s.logger.Error("email digest failed", "error", err)
+			}
+			emailDigest = s.scheduleEmailDigest()
+		case <-digest:
+			if err := s.notifier.SendDigests(ctx); err != nil {
+				s.logger.Error("digest failed", "error", err)
+			}
+			digest = s.scheduleDigest()
 		}
 	}
 }
 
+// scheduleEmailDigest returns a channel that fires at the next email digest hour.
+func (s *Server) scheduleEmailDigest() <-chan time.Time {
+	next := nextDigestAt(time.Now().In(s.config.Location), s.config.EmailDigestHour)
+	s.logger.Info("next email digest scheduled", "at", next)
+	return time.After(time.Until(next))
+}
+
+// scheduleDigest returns a channel that fires at the next TRIX_DIGEST_SCHEDULE time.
+func (s *Server) scheduleDigest() <-chan time.Time {
+	next := s.config.DigestSchedule.Next(time.Now().In(s.config.Location))
+	s.logger.Info("next digest scheduled", "at", next, "schedule", s.config.DigestSchedule.String())
+	return time.After(time.Until(next))
+}
+
+// jitter returns interval moved by a random amount of at most ±spread, so
+// instances started together don't poll the API server in lockstep.
+func jitter(interval, spread time.Duration) time.Duration {
+	if spread <= 0 {
+		return interval
+	}
+	return interval - spread + rand.N(2*spread+1)
+}
+
+// cancelledPollNotifyTimeout bounds the notifications of a cancelled poll
+const cancelledPollNotifyTimeout = 30 * time.Second
+
 func (s *Server) poll(ctx context.Context) {
+	if !s.polling.CompareAndSwap(false, true) {
+		s.logger.Warn("poll already running, skipped")
+		return
+	}
+	defer s.polling.Store(false)
+
+	// Check the connection first: a broken one is replaced here, and an
+	// unreachable database fails the poll with one clear error
+	if err := s.db.Ping(ctx); err != nil {
+		s.recordPoll(fmt.Errorf("database unreachable: %w", err))
+		s.logger.Error("database unreachable, skipping poll", "error", err)
+		return
+	}
+
 	// Retry previously failed SaaS syncs BEFORE polling for new events.
 	// This prevents double-sending: new events from Poll() would otherwise
 	// be picked up by both retrySaasSync() AND Notify().
 	if s.config.SaasEndpoint != "" {
 		s.retrySaasSync(ctx)
 	}
+	s.retryDeliveries(ctx)
 
 	events, err := s.poller.Poll(ctx)
+	s.recordPoll(err)
 	if err != nil {
 		s.logger.Error("poll failed", "error", err)
+		if len(events) > 0 {
+			// A cancelled poll's upserts are recorded and won't be found
+			// again, so their events go out on a context of their own
+			notifyCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cancelledPollNotifyTimeout)
+			defer cancel()
+			s.notify(notifyCtx, events)
+		}
 		return
 	}
 
+	s.prune(ctx)
+	s.notify(ctx, events)
+}
+
+// notify sends notifications for events from a poll or a watch update.
+func (s *Server) notify(ctx context.Context, events []VulnerabilityEvent) {
+	s.telemetry.emitEvents(ctx, events)
+
 	if !s.config.HasNotifications() {
 		return
 	}
 
 	if s.firstPoll {
 		s.firstPoll = false
-		// Only send init notification on fresh start (new vulnerabilities found)
-		// Skip if this is a restart with existing database
+		// Only send the init notification when the database was empty.
+		// Changes found on restart or leader handover are reported normally.
 		if len(events) > 0 {
 			result := s.notifier.NotifyInitialized(ctx, events)
-			s.handleSaasResult(ctx, result)
-		} else {
-			s.logger.Info("resumed monitoring, database has existing data")
+			s.handleSaasResult(ctx, result.Saas)
 		}
 		return
 	}
 
 	if len(events) > 0 {
 		result := s.notifier.Notify(ctx, events)
-		s.handleSaasResult(ctx, result)
+		s.handleDeliveries(ctx, result.Deliveries)
+		s.handleSaasResult(ctx, result.Saas)
+	}
+}
+
+// prune deletes FIXED vulnerabilities, snapshots and finished notification
+// retries older than their retention windows.
+func (s *Server) prune(ctx context.Context) {
+	if s.config.RetentionFixed > 0 {
+		pruned, err := s.db.PruneFixed(ctx, time.Now().Add(-s.config.RetentionFixed))
+		if err != nil {
+			s.logger.Error("failed to prune fixed vulnerabilities", "error", err)
+		} else if pruned > 0 {
+			s.logger.Info("pruned fixed vulnerabilities", "count", pruned, "retention", s.config.RetentionFixed)
+			s.telemetry.addPrunedFixed(ctx, pruned)
+		}
+	}
+
+	if s.config.RetentionSnapshots > 0 {
+		pruned, err := s.db.PruneSnapshots(ctx, time.Now().Add(-s.config.RetentionSnapshots))
+		if err != nil {
+			s.logger.Error("failed to prune snapshots", "error", err)
+		} else if pruned > 0 {
+			s.logger.Info("pruned snapshots", "count", pruned, "retention", s.config.RetentionSnapshots)
+		}
+	}
+
+	pruned, err := s.db.PruneDeliveries(ctx, time.Now().Add(-deliveryRetention), s.config.DeliveryMaxAttempts)
+	if err != nil {
+		s.logger.Error("failed to prune notification deliveries", "error", err)
+	} else if pruned > 0 {
+		s.logger.Info("pruned notification deliveries", "count", pruned)
+	}
+
+	if _, err := s.db.PruneNotified(ctx, time.Now().Add(-s.config.NotifyWorkloadInterval)); err != nil {
+		s.logger.Error("failed to prune notified workloads", "error", err)
 	}
 }
 
@@ -200,25 +487,12 @@ func (s *Server) retrySaasSync(ctx context.Context) {
 
 	// Convert records to events
 	events := make([]VulnerabilityEvent, 0, len(unsynced))
-	for _, v := range unsynced {
+	for i := range unsynced {
 		eventType := "NEW"
-		if v.State == StateFixed {
+		if unsynced[i].State == StateFixed {
 			eventType = "FIXED"
 		}
-		events = append(events, VulnerabilityEvent{
-			ID:              v.ID,
-			Type:            eventType,
-			CVE:             v.CVE,
-			Workload:        v.Workload,
-			Severity:        v.Severity,
-			Image:           v.Image,
-			ContainerName:   v.ContainerName,
-			ImageRepository: v.ImageRepository,
-			ImageTag:        v.ImageTag,
-			ImageDigest:     v.ImageDigest,
-			FirstSeen:       v.FirstSeen,
-			FixedAt:         v.FixedAt,
-		})
+		events = append(events, recordEvent(eventType, &unsynced[i]))
 	}
 
 	result := s.notifier.SendSaas(ctx, events)
@@ -0,0 +1,439 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/trixsec-dev/trix/internal/tools/trivy"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// backdateFixed moves a fixed vulnerability's fixed_at into the past
+func backdateFixed(t *testing.T, m *MemoryStore, id string, fixedAt time.Time) {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.vulns[id]
+	if !ok || r.State != StateFixed {
+		t.Fatalf("%s is not fixed", id)
+	}
+	r.FixedAt = &fixedAt
+}
+
+func TestPruneRetention(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	for _, id := range []string{"old", "recent", "open"} {
+		mustUpsert(t, store, storeRecord(id, "payments", KindVulnerability, "HIGH"))
+	}
+	if _, err := store.MarkFixed(ctx, nil, nil, []string{"open"}); err != nil {
+		t.Fatal(err)
+	}
+	backdateFixed(t, store, "old", time.Now().Add(-31*24*time.Hour))
+	backdateFixed(t, store, "recent", time.Now().Add(-29*24*time.Hour))
+
+	s := testServer(t, store, map[string]string{"TRIX_RETENTION_FIXED": "30d"})
+	var logs strings.Builder
+	s.logger = slog.New(slog.NewTextHandler(&logs, nil))
+	tel, reader := meteredTelemetry(t)
+	s.telemetry = tel
+	s.prune(ctx)
+
+	if v, _ := store.GetVulnerability(ctx, "old"); v != nil {
+		t.Error("vulnerability fixed 31 days ago not pruned")
+	}
+	for _, id := range []string{"recent", "open"} {
+		if v, _ := store.GetVulnerability(ctx, id); v == nil {
+			t.Errorf("%s pruned", id)
+		}
+	}
+	if !strings.Contains(logs.String(), `msg="pruned fixed vulnerabilities" count=1 retention=720h0m0s`) {
+		t.Errorf("prune not logged:\n%s", logs.String())
+	}
+	if n := counterValue(t, reader, "trix.pruned.fixed"); n != 1 {
+		t.Errorf("trix.pruned.fixed = %d, want 1", n)
+	}
+
+	// Nothing left to prune: nothing logged or counted
+	logs.Reset()
+	s.prune(ctx)
+	if strings.Contains(logs.String(), "pruned fixed") {
+		t.Errorf("empty prune logged:\n%s", logs.String())
+	}
+	if n := counterValue(t, reader, "trix.pruned.fixed"); n != 1 {
+		t.Errorf("trix.pruned.fixed = %d after an empty prune, want 1", n)
+	}
+}
+
+func TestPruneRetentionDisabled(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	mustUpsert(t, store, storeRecord("ancient", "payments", KindVulnerability, "HIGH"))
+	if _, err := store.MarkFixed(ctx, nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	backdateFixed(t, store, "ancient", time.Now().Add(-10*365*24*time.Hour))
+
+	testServer(t, store, map[string]string{"TRIX_RETENTION_FIXED": "0"}).prune(ctx)
+	if v, _ := store.GetVulnerability(ctx, "ancient"); v == nil {
+		t.Error("pruned with TRIX_RETENTION_FIXED=0")
+	}
+}
+
+// blockingStore holds every upsert until release is closed, or until the
+// poll's context is cancelled if release is nil
+type blockingStore struct {
+	Store
+	started chan struct{} // Closed on the first upsert
+	once    chan struct{}
+	release chan struct{}
+}
+
+func newBlockingStore(release chan struct{}) *blockingStore {
+	return &blockingStore{Store: NewMemoryStore(), started: make(chan struct{}), once: make(chan struct{}, 1), release: release}
+}
+
+func (s *blockingStore) UpsertVulnerability(ctx context.Context, v *VulnerabilityRecord) (VulnerabilityChange, error) {
+	select {
+	case s.once <- struct{}{}:
+		close(s.started)
+	default:
+	}
+	select {
+	case <-s.release:
+	case <-ctx.Done():
+		return VulnerabilityChange{}, ctx.Err()
+	}
+	return s.Store.UpsertVulnerability(ctx, v)
+}
+
+// shutdownServer returns a server whose first poll blocks in db, on a store
+// that already has data (so the poll notifies) and an old vulnerability
+// the poll will mark fixed
+func shutdownServer(t *testing.T, db *blockingStore, env map[string]string) *Server {
+	t.Helper()
+	mustUpsert(t, db.Store, storeRecord("old", "payments", KindVulnerability, "CRITICAL"))
+	env["TRIX_HEALTH_ADDR"] = "127.0.0.1:0"
+	env["TRIX_POLL_INTERVAL"] = "1h"
+	return pollingServer(t, db, fakeDynamic(
+		vulnReport("payments", "api", "sha256:aaa", fixtureVuln{"CVE-2024-0001", "CRITICAL", "openssl", "3.0.1", "3.0.8"}),
+	), env)
+}
+
+// runUntilSIGTERM starts s, sends SIGTERM once its first poll is in flight
+// and returns Run's result channel
+func runUntilSIGTERM(t *testing.T, s *Server, db *blockingStore) <-chan error {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() { done <- s.Run(context.Background()) }()
+
+	select {
+	case <-db.started:
+	case <-time.After(10 * time.Second):
+		t.Fatal("poll did not start")
+	}
+	// Run registered for SIGTERM before starting the poll loop
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "shutdown to begin", s.stopping.Load)
+	return done
+}
+
+// SIGTERM mid-poll lets the poll finish, reconcile and notify before Run
+// returns
+func TestShutdownFinishesPoll(t *testing.T) {
+	receiver, received := stubReceiver(t, http.StatusOK)
+	release := make(chan struct{})
+	db := newBlockingStore(release)
+	s := shutdownServer(t, db, map[string]string{"TRIX_NOTIFY_WEBHOOK": receiver.URL})
+	done := runUntilSIGTERM(t, s, db)
+
+	if code, status := s.readiness(time.Now()); code != http.StatusServiceUnavailable || status != "shutting down" {
+		t.Errorf("readiness during shutdown = %d %s", code, status)
+	}
+	select {
+	case <-done:
+		t.Fatal("Run returned with a poll in flight")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run = %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run did not return after the poll finished")
+	}
+
+	if v := mustGet(t, db.Store, "old"); v.State != StateFixed {
+		t.Error("poll was not reconciled before shutdown")
+	}
+	open, err := db.GetOpenVulnerabilities(context.Background())
+	if err != nil || len(open) != 1 || open[0].CVE != "CVE-2024-0001" {
+		t.Errorf("open = %+v, %v", open, err)
+	}
+	reqs := received()
+	if len(reqs) != 1 || !strings.Contains(string(reqs[0].body), "CVE-2024-0001") || !strings.Contains(string(reqs[0].body), "FIXED") {
+		t.Errorf("%d notifications sent before shutdown, want the poll's", len(reqs))
+	}
+
+	// No poll starts once shutdown has begun
+	s.runPollLoop(context.Background())
+	if len(received()) != 1 {
+		t.Error("poll loop ran after shutdown")
+	}
+}
+
+// pingCountingStore counts polls by their database check, blocking the
+// first until release is closed
+type pingCountingStore struct {
+	Store
+	started chan struct{}
+	release chan struct{}
+	pings   atomic.Int32
+}
+
+func (s *pingCountingStore) Ping(ctx context.Context) error {
+	if s.pings.Add(1) == 1 {
+		close(s.started)
+		<-s.release
+	}
+	return s.Store.Ping(ctx)
+}
+
+// A due timer or poll request that is ready alongside the stop does not
+// start another poll
+func TestShutdownSkipsDuePolls(t *testing.T) {
+	// select picks among ready cases at random, so try a few times
+	for i := 0; i < 20; i++ {
+		db := &pingCountingStore{Store: NewMemoryStore(), started: make(chan struct{}), release: make(chan struct{})}
+		s := pollingServer(t, db, fakeDynamic(), map[string]string{"TRIX_POLL_INTERVAL": "1ms", "TRIX_POLL_JITTER": "0"})
+		done := make(chan struct{})
+		go func() {
+			s.runPollLoop(context.Background())
+			close(done)
+		}()
+
+		// While the initial poll runs, the timer expires, a poll is
+		// requested and shutdown begins
+		<-db.started
+		time.Sleep(5 * time.Millisecond)
+		s.pollNow <- struct{}{}
+		s.beginShutdown()
+		close(db.release)
+
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			t.Fatal("poll loop did not stop")
+		}
+		if n := db.pings.Load(); n != 1 {
+			t.Fatalf("%d polls ran, want only the initial one", n)
+		}
+	}
+}
+
+// A poll outlasting TRIX_SHUTDOWN_GRACE is cancelled, and its incomplete
+// listing is not reconciled
+func TestShutdownGraceExpires(t *testing.T) {
+	db := newBlockingStore(nil)
+	s := shutdownServer(t, db, map[string]string{"TRIX_SHUTDOWN_GRACE": "100ms"})
+	logs := &syncBuffer{}
+	s.logger = slog.New(slog.NewTextHandler(logs, nil))
+	started := time.Now()
+	done := runUntilSIGTERM(t, s, db)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run = %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run did not return after the grace period")
+	}
+	if elapsed := time.Since(started); elapsed < 100*time.Millisecond {
+		t.Errorf("Run returned after %v, before the grace period", elapsed)
+	}
+	if !strings.Contains(logs.String(), "shutdown grace period expired") {
+		t.Errorf("logs:\n%s", logs.String())
+	}
+	if v := mustGet(t, db.Store, "old"); v.State != StateOpen {
+		t.Error("cancelled poll marked vulnerabilities fixed")
+	}
+}
+
+// The events of a cancelled poll are still notified
+func TestCancelledPollNotifies(t *testing.T) {
+	receiver, received := stubReceiver(t, http.StatusOK)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	db := &cancellingStore{Store: NewMemoryStore(), cancel: cancel}
+	mustUpsert(t, db.Store, storeRecord("old", "payments", KindVulnerability, "CRITICAL"))
+	s := pollingServer(t, db, fakeDynamic(
+		vulnReport("payments", "api", "sha256:aaa", fixtureVuln{"CVE-2024-0001", "CRITICAL", "openssl", "3.0.1", "3.0.8"}),
+	), map[string]string{"TRIX_NOTIFY_WEBHOOK": receiver.URL})
+
+	s.poll(ctx)
+	if ctx.Err() == nil {
+		t.Fatal("poll was not cancelled")
+	}
+	reqs := received()
+	if len(reqs) != 1 || !strings.Contains(string(reqs[0].body), "CVE-2024-0001") {
+		t.Fatalf("%d notifications sent, want the cancelled poll's NEW event", len(reqs))
+	}
+	if strings.Contains(string(reqs[0].body), "FIXED") {
+		t.Error("cancelled poll notified FIXED events")
+	}
+}
+
+func TestShutdownGraceConfig(t *testing.T) {
+	if cfg := testConfig(t, nil); cfg.ShutdownGrace != 30*time.Second {
+		t.Errorf("default grace = %v", cfg.ShutdownGrace)
+	}
+	if cfg := testConfig(t, map[string]string{"TRIX_SHUTDOWN_GRACE": "2m"}); cfg.ShutdownGrace != 2*time.Minute {
+		t.Errorf("grace = %v", cfg.ShutdownGrace)
+	}
+	t.Setenv("TRIX_SHUTDOWN_GRACE", "-1s")
+	if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "invalid TRIX_SHUTDOWN_GRACE") {
+		t.Errorf("negative grace: err = %v", err)
+	}
+}
+
+func TestJitter(t *testing.T) {
+	if got := jitter(time.Minute, 0); got != time.Minute {
+		t.Errorf("without spread: %v", got)
+	}
+	if got := jitter(time.Minute, -time.Second); got != time.Minute {
+		t.Errorf("negative spread: %v", got)
+	}
+
+	const interval, spread = 5 * time.Minute, 30 * time.Second
+	var below, above bool
+	for range 1000 {
+		d := jitter(interval, spread)
+		if d < interval-spread || d > interval+spread {
+			t.Fatalf("jitter = %v, want within %v ± %v", d, interval, spread)
+		}
+		below = below || d < interval
+		above = above || d > interval
+	}
+	if !below || !above {
+		t.Errorf("1000 jittered intervals were all on one side (below %v, above %v)", below, above)
+	}
+}
+
+func TestPollJitterConfig(t *testing.T) {
+	if cfg := testConfig(t, nil); cfg.PollJitter != 30*time.Second {
+		t.Errorf("default jitter = %v, want 10%% of 5m", cfg.PollJitter)
+	}
+	if cfg := testConfig(t, map[string]string{"TRIX_POLL_INTERVAL": "1h"}); cfg.PollJitter != 6*time.Minute {
+		t.Errorf("jitter = %v, want 10%% of 1h", cfg.PollJitter)
+	}
+	if cfg := testConfig(t, map[string]string{"TRIX_POLL_JITTER": "0"}); cfg.PollJitter != 0 {
+		t.Errorf("disabled jitter = %v", cfg.PollJitter)
+	}
+	if cfg := testConfig(t, map[string]string{"TRIX_POLL_JITTER": "10m"}); cfg.PollJitter != 10*time.Minute {
+		t.Errorf("jitter = %v", cfg.PollJitter)
+	}
+	for _, value := range []string{"1h", "2h", "-1s", "often"} {
+		t.Setenv("TRIX_POLL_JITTER", value)
+		if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "invalid TRIX_POLL_JITTER") {
+			t.Errorf("TRIX_POLL_JITTER=%s with a 1h interval: err = %v", value, err)
+		}
+	}
+}
+
+// A poll started while another runs is skipped rather than run twice
+func TestPollSkipsWhileRunning(t *testing.T) {
+	release := make(chan struct{})
+	db := newBlockingStore(release)
+	s := shutdownServer(t, db, map[string]string{})
+	logs := &syncBuffer{}
+	s.logger = slog.New(slog.NewTextHandler(logs, nil))
+
+	done := make(chan struct{})
+	go func() {
+		s.poll(context.Background())
+		close(done)
+	}()
+	<-db.started
+	if !s.polling.Load() {
+		t.Error("polling flag not set during a poll")
+	}
+
+	s.poll(context.Background())
+	if !strings.Contains(logs.String(), "poll already running, skipped") {
+		t.Errorf("second poll was not skipped:\n%s", logs.String())
+	}
+
+	close(release)
+	<-done
+	if s.polling.Load() {
+		t.Error("polling flag still set after the poll")
+	}
+	if s.lastPoll.Load() == nil {
+		t.Error("the first poll did not finish")
+	}
+}
+
+// POST /api/v1/poll runs a poll long before the next tick
+func TestTriggerPollRunsPoll(t *testing.T) {
+	ctx := context.Background()
+	dyn := fakeDynamic(vulnReport("payments", "api", "sha256:aaa", fixtureVuln{"CVE-2024-0001", "CRITICAL", "openssl", "3.0.1", "3.0.8"}))
+	db := NewMemoryStore()
+	s := pollingServer(t, db, dyn, map[string]string{"TRIX_API_TOKEN": "secret", "TRIX_POLL_INTERVAL": "1h"})
+	runTestPollLoop(t, s)
+
+	open := func() int {
+		_, total, err := db.ListVulnerabilities(ctx, VulnerabilityFilter{State: StateOpen})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return total
+	}
+	if n := open(); n != 1 {
+		t.Fatalf("open after the initial poll = %d, want 1", n)
+	}
+
+	report := vulnReport("shop", "web", "sha256:bbb", fixtureVuln{"CVE-2024-0002", "HIGH", "curl", "8.0.0", "8.0.1"})
+	if _, err := dyn.Resource(trivy.VulnerabilityReportGVR).Namespace("shop").Create(ctx, report, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/poll", nil)
+	rec := httptest.NewRecorder()
+	s.handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("without a token: status = %d, want 401", rec.Code)
+	}
+
+	var status APIStatus
+	if rec := apiGet(t, s.handler(), http.MethodPost, "/api/v1/poll", &status); rec.Code != http.StatusAccepted {
+		t.Fatalf("trigger: status = %d", rec.Code)
+	}
+	waitFor(t, "the triggered poll", func() bool { return open() == 2 })
+}
+
+func TestTriggerPollStandby(t *testing.T) {
+	s := testServer(t, NewMemoryStore(), map[string]string{"TRIX_API_TOKEN": "secret", "TRIX_LEADER_ELECTION": "true", "TRIX_LEADER_LEASE_NAMESPACE": "trix"})
+	var body APIError
+	rec := apiGet(t, s.handler(), http.MethodPost, "/api/v1/poll", &body)
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(body.Error, "standby") {
+		t.Errorf("standby: got %d %q, want 503", rec.Code, body.Error)
+	}
+
+	s.leading.Store(true)
+	if rec := apiGet(t, s.handler(), http.MethodPost, "/api/v1/poll", &body); rec.Code != http.StatusAccepted {
+		t.Errorf("leader: status = %d, want 202", rec.Code)
+	}
+}
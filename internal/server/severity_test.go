@@ -0,0 +1,195 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rescoreKeys renders events as "TYPE CVE old→new"
+func rescoreKeys(events []VulnerabilityEvent) []string {
+	keys := make([]string, 0, len(events))
+	for _, e := range events {
+		keys = append(keys, e.Type+" "+e.CVE+" "+e.OldSeverity+"→"+e.Severity)
+	}
+	return keys
+}
+
+func testSeverityTransitions(t *testing.T, s Store) {
+	ctx := context.Background()
+	mustUpsert(t, s, storeRecord("1", "payments", KindVulnerability, "MEDIUM"))
+
+	for _, step := range []struct {
+		severity string
+		want     string // OldSeverity reported
+	}{
+		{"CRITICAL", "MEDIUM"}, // Upgrade
+		{"CRITICAL", ""},       // Unchanged
+		{"LOW", "CRITICAL"},    // Downgrade
+	} {
+		change := mustUpsert(t, s, storeRecord("1", "payments", KindVulnerability, step.severity))
+		if change.New || change.OldSeverity != step.want {
+			t.Errorf("rescored to %s: change = %+v, want old severity %q", step.severity, change, step.want)
+		}
+		if got := mustGet(t, s, "1").Severity; got != step.severity {
+			t.Errorf("stored severity = %s, want %s", got, step.severity)
+		}
+	}
+
+	// A FIXED vulnerability coming back with another severity is new, not
+	// rescored
+	if _, err := s.MarkFixed(ctx, nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if change := mustUpsert(t, s, storeRecord("1", "payments", KindVulnerability, "HIGH")); !change.New || change.OldSeverity != "" {
+		t.Errorf("reopened with a new severity: change = %+v", change)
+	}
+}
+
+func TestPollSeverityChanged(t *testing.T) {
+	before := vulnReport("payments", "api", "sha256:aaa",
+		fixtureVuln{"CVE-2024-0001", "MEDIUM", "openssl", "3.0.1", "3.0.8"},
+		fixtureVuln{"CVE-2024-0002", "HIGH", "curl", "8.0.0", "8.0.1"},
+	)
+	after := vulnReport("payments", "api", "sha256:aaa",
+		fixtureVuln{"CVE-2024-0001", "CRITICAL", "openssl", "3.0.1", "3.0.8"},
+		fixtureVuln{"CVE-2024-0002", "LOW", "curl", "8.0.0", "8.0.1"},
+	)
+
+	tests := []struct {
+		name      string
+		downgrade string
+		want      []string
+	}{
+		{"upgrades only", "", []string{"SEVERITY_CHANGED CVE-2024-0001 MEDIUM→CRITICAL"}},
+		{"with downgrades", "true", []string{"SEVERITY_CHANGED CVE-2024-0001 MEDIUM→CRITICAL", "SEVERITY_CHANGED CVE-2024-0002 HIGH→LOW"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := testConfig(t, map[string]string{"TRIX_NOTIFY_DOWNGRADES": tt.downgrade})
+			db := NewMemoryStore()
+			if _, err := testPoller(cfg, db, fakeDynamic(before)).Poll(ctx); err != nil {
+				t.Fatal(err)
+			}
+			open, err := db.GetOpenVulnerabilities(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			firstSeen := make(map[string]time.Time)
+			for _, v := range open {
+				firstSeen[v.CVE] = v.FirstSeen
+			}
+
+			events, err := testPoller(cfg, db, fakeDynamic(after)).Poll(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := rescoreKeys(events); strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("events = %q, want %q", got, tt.want)
+			}
+			for _, e := range events {
+				if !e.FirstSeen.Equal(firstSeen[e.CVE]) {
+					t.Errorf("%s first seen = %v, want the original %v", e.CVE, e.FirstSeen, firstSeen[e.CVE])
+				}
+			}
+
+			// The new severities are stored either way, so a rescan is quiet
+			events, err = testPoller(cfg, db, fakeDynamic(after)).Poll(ctx)
+			if err != nil || len(events) != 0 {
+				t.Errorf("rescan = %q, %v", rescoreKeys(events), err)
+			}
+		})
+	}
+}
+
+// Only rescorings that cross TRIX_NOTIFY_SEVERITY upwards are notified
+func TestNotifyRescored(t *testing.T) {
+	ctx := context.Background()
+	receiver, received := stubReceiver(t, http.StatusOK)
+	db := NewMemoryStore()
+	s := pollingServer(t, db, fakeDynamic(), map[string]string{"TRIX_NOTIFY_WEBHOOK": receiver.URL})
+	scan := func(severity string) {
+		s.poller = testPoller(s.config, db, fakeDynamic(vulnReport("payments", "api", "sha256:aaa",
+			fixtureVuln{"CVE-2024-0001", severity, "openssl", "3.0.1", "3.0.8"})))
+		s.poll(ctx)
+	}
+
+	scan("MEDIUM") // NEW below the threshold
+	scan("HIGH")   // Rescored, still below
+	if n := len(received()); n != 0 {
+		t.Fatalf("%d notifications below the threshold", n)
+	}
+
+	scan("CRITICAL")
+	reqs := received()
+	if len(reqs) != 1 {
+		t.Fatalf("%d notifications for the rescoring to CRITICAL, want 1", len(reqs))
+	}
+	var payload struct {
+		Events []VulnerabilityEvent `json:"events"`
+	}
+	if err := json.Unmarshal(reqs[0].body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if got := rescoreKeys(payload.Events); len(got) != 1 || got[0] != "SEVERITY_CHANGED CVE-2024-0001 HIGH→CRITICAL" {
+		t.Errorf("events = %q", got)
+	}
+
+	scan("MEDIUM") // Downgrades are silent by default
+	if n := len(received()); n != 1 {
+		t.Errorf("%d notifications after a downgrade, want none new", n-1)
+	}
+}
+
+func TestSlackLegacyRescored(t *testing.T) {
+	srv, received := stubReceiver(t, http.StatusOK)
+	n := testNotifier(t, map[string]string{"TRIX_NOTIFY_SLACK": srv.URL, "TRIX_SLACK_LEGACY": "true"})
+	if err := n.sendSlack(context.Background(), slackEvents()); err != nil {
+		t.Fatal(err)
+	}
+	var payload struct {
+		Attachments []struct {
+			Color string `json:"color"`
+			Title string `json:"title"`
+			Text  string `json:"text"`
+		} `json:"attachments"`
+	}
+	if err := json.Unmarshal(received()[0].body, &payload); err != nil {
+		t.Fatal(err)
+	}
+
+	var titles []string
+	for _, a := range payload.Attachments {
+		titles = append(titles, a.Title)
+		if a.Title != "Severity changed (1)" {
+			continue
+		}
+		if a.Color != "#fd7e14" {
+			t.Errorf("rescored to HIGH: color = %s, want orange", a.Color)
+		}
+		if !strings.Contains(a.Text, "`prod/deployment/db`") || !strings.Contains(a.Text, "CVE-2023-0009") || !strings.Contains(a.Text, "medium → high") {
+			t.Errorf("rescored text = %q", a.Text)
+		}
+	}
+	want := "Images changed (1)|New Vulnerabilities (3)|Severity changed (1)|Fixed Vulnerabilities (2)"
+	if strings.Join(titles, "|") != want {
+		t.Errorf("attachments = %q, want %q", titles, want)
+	}
+}
+
+func TestNotifyDowngradesConfig(t *testing.T) {
+	if testConfig(t, nil).NotifyDowngrades {
+		t.Error("downgrades notified by default")
+	}
+	if !testConfig(t, map[string]string{"TRIX_NOTIFY_DOWNGRADES": "true"}).NotifyDowngrades {
+		t.Error("TRIX_NOTIFY_DOWNGRADES=true ignored")
+	}
+	t.Setenv("TRIX_NOTIFY_DOWNGRADES", "sometimes")
+	if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "invalid TRIX_NOTIFY_DOWNGRADES") {
+		t.Errorf("err = %v", err)
+	}
+}
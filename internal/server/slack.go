@@ -0,0 +1,529 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Block Kit limits
+const (
+	slackMaxBlocks          = 50
+	slackMaxHeaderText      = 150
+	slackMaxSectionText     = 3000
+	slackMaxCVEsPerWorkload = 10
+)
+
+// slackPostMessageURL is a variable so tests can point it at a stub
+var slackPostMessageURL = "https://slack.com/api/chat.postMessage"
+
+var slackSeverityEmoji = map[string]string{
+	"CRITICAL": ":red_circle:",
+	"HIGH":     ":large_orange_circle:",
+	"MEDIUM":   ":large_yellow_circle:",
+	"LOW":      ":white_circle:",
+}
+
+// slackEnabled reports whether Slack is configured through a webhook or a bot token
+func (c *Config) slackEnabled() bool {
+	return c.SlackWebhook != "" || c.SlackBotToken != ""
+}
+
+// sendSlack posts new, rescored and fixed vulnerabilities as Block Kit
+// messages.
+//
+// Image changes come first, each followed by the new and fixed findings of
+// its container.
+//
+// With a bot token, messages go through chat.postMessage, which returns the
+// message ts: it is stored per workload, and FIXED events for a workload are
+// posted as a reply in the thread of the message that reported it as new.
+// Rescored vulnerabilities and image changes are posted with the new ones. Incoming webhooks
+// don't return a ts, so they get one unthreaded message.
+func (n *Notifier) sendSlack(ctx context.Context, events []VulnerabilityEvent) error {
+	if t := n.config.Templates; t != nil && t.Slack != nil {
+		return n.sendSlackTemplate(ctx, t, events)
+	}
+	if n.config.SlackLegacy {
+		return n.sendSlackLegacy(ctx, events)
+	}
+
+	// Events explained by an image change are listed under its banner
+	imageBlocks, rest := slackImageBlocks(events)
+	newEvents := filterByType(rest, "NEW")
+	changedEvents := filterByType(rest, "SEVERITY_CHANGED")
+	fixedEvents := filterByType(rest, "FIXED")
+
+	if n.config.SlackBotToken == "" {
+		blocks := append(imageBlocks, slackNewBlocks(newEvents)...)
+		blocks = append(blocks, slackChangedBlocks(changedEvents)...)
+		blocks = append(blocks, slackFixedBlocks(fixedEvents)...)
+		_, err := n.postSlack(ctx, "", slackFallbackText(events), n.slackFooter(blocks))
+		return err
+	}
+
+	if top := excludeEvents(events, fixedEvents); len(top) > 0 {
+		blocks := append(imageBlocks, slackNewBlocks(newEvents)...)
+		blocks = append(blocks, slackChangedBlocks(changedEvents)...)
+		ts, err := n.postSlack(ctx, "", slackFallbackText(top), n.slackFooter(blocks))
+		if err != nil {
+			return err
+		}
+		if newEvents := filterByType(events, "NEW"); len(newEvents) > 0 {
+			if err := n.store.SetSlackThread(ctx, sortedWorkloads(groupByWorkload(newEvents)), ts); err != nil {
+				n.logger.Warn("failed to store slack thread", "error", err)
+			}
+		}
+	}
+
+	if len(fixedEvents) == 0 {
+		return nil
+	}
+
+	// Reply in each workload's thread; workloads without one share a new message
+	byThread := make(map[string][]VulnerabilityEvent)
+	for workload, group := range groupByWorkload(fixedEvents) {
+		ts, err := n.store.GetSlackThread(ctx, workload)
+		if err != nil {
+			n.logger.Warn("failed to load slack thread", "workload", workload, "error", err)
+		}
+		byThread[ts] = append(byThread[ts], group...)
+	}
+	threads := make([]string, 0, len(byThread))
+	for ts := range byThread {
+		threads = append(threads, ts)
+	}
+	sort.Strings(threads)
+
+	for _, ts := range threads {
+		group := byThread[ts]
+		if _, err := n.postSlack(ctx, ts, slackFallbackText(group), n.slackFooter(slackFixedBlocks(group))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendSlackTemplate posts the output of slack.tmpl as one plain message.
+// With a bot token, it becomes the thread for the workloads it reports new.
+func (n *Notifier) sendSlackTemplate(ctx context.Context, t *Templates, events []VulnerabilityEvent) error {
+	text, err := t.renderSlack(newTemplateData(n.config.ClusterName, events, time.Now()))
+	if err != nil {
+		return err
+	}
+	if text == "" {
+		return nil
+	}
+	ts, err := n.postSlack(ctx, "", text, nil)
+	if err != nil {
+		return err
+	}
+	if newEvents := filterByType(events, "NEW"); ts != "" && len(newEvents) > 0 {
+		if err := n.store.SetSlackThread(ctx, sortedWorkloads(groupByWorkload(newEvents)), ts); err != nil {
+			n.logger.Warn("failed to store slack thread", "error", err)
+		}
+	}
+	return nil
+}
+
+// sendSlackSummaryBlocks posts the initialization summary as Block Kit.
+func (n *Notifier) sendSlackSummaryBlocks(ctx context.Context, events []VulnerabilityEvent) error {
+	counts := countBySeverity(events)
+
+	var fields []map[string]interface{}
+	for _, s := range []string{"CRITICAL", "HIGH", "MEDIUM", "LOW"} {
+		if c := counts[s]; c > 0 {
+			fields = append(fields, slackText(fmt.Sprintf("%s *%s*\n%d", slackSeverityEmoji[s], strings.ToLower(s), c)))
+		}
+	}
+
+	blocks := []map[string]interface{}{
+		slackHeader("trix initialized"),
+		{"type": "section", "text": slackText(fmt.Sprintf("Found *%d* %s. Monitoring started.", len(events), wording(events).plural))},
+	}
+	if len(fields) > 0 {
+		blocks = append(blocks, map[string]interface{}{"type": "section", "fields": fields})
+	}
+
+	_, err := n.postSlack(ctx, "", fmt.Sprintf("trix initialized: %d %s", len(events), wording(events).plural), n.slackFooter(blocks))
+	return err
+}
+
+// slackImageBlocks renders a banner per IMAGE_CHANGED event listing the
+// new and fixed findings it accounts for, and returns the other events.
+// Image changes beyond the block budget leave their events in the rest.
+func slackImageBlocks(events []VulnerabilityEvent) ([]map[string]interface{}, []VulnerabilityEvent) {
+	changes := filterByType(events, "IMAGE_CHANGED")
+	if len(changes) == 0 {
+		return nil, events
+	}
+
+	var blocks []map[string]interface{}
+	rest := excludeEvents(events, changes)
+	// Leave room for the other sections
+	budget := slackMaxBlocks / 5
+	for i, change := range changes {
+		if i == budget {
+			blocks = append(blocks, slackContext(fmt.Sprintf("…and %d more image changes", len(changes)-i)))
+			break
+		}
+
+		var covered []VulnerabilityEvent
+		for _, e := range rest {
+			if fromImageChange(change, e) {
+				covered = append(covered, e)
+			}
+		}
+		rest = excludeEvents(rest, covered)
+
+		var b strings.Builder
+		fmt.Fprintf(&b, ":package: *Image changed* %s", imageChangeText(change))
+		for j, e := range filterByType(covered, "NEW") {
+			if j == slackMaxCVEsPerWorkload {
+				fmt.Fprintf(&b, "\n_…and %d more new_", len(filterByType(covered, "NEW"))-j)
+				break
+			}
+			fmt.Fprintf(&b, "\n%s %s", severityEmoji(e.Severity), slackFinding(e))
+			if e.Image != "" {
+				fmt.Fprintf(&b, " `%s`", e.Image)
+			}
+		}
+		if fixed := filterByType(covered, "FIXED"); len(fixed) > 0 {
+			fmt.Fprintf(&b, "\n:white_check_mark: %d %s fixed", len(fixed), wording(fixed).short)
+		}
+		blocks = append(blocks, map[string]interface{}{"type": "section", "text": slackText(b.String())})
+	}
+	return blocks, rest
+}
+
+// slackNewBlocks lists new vulnerabilities per workload, most severe first,
+// with up to slackMaxCVEsPerWorkload CVEs each linked to NVD and the version
+// that fixes them. Workloads show their exposure when it was analyzed.
+func slackNewBlocks(events []VulnerabilityEvent) []map[string]interface{} {
+	if len(events) == 0 {
+		return nil
+	}
+
+	grouped := groupByWorkload(events)
+	workloads := sortedWorkloads(grouped)
+	blocks := []map[string]interface{}{
+		slackHeader(fmt.Sprintf(":rotating_light: New %s (%d)", wording(events).plural, len(events))),
+	}
+
+	// Leave room for the overflow line, the fixed header and the footer
+	budget := slackMaxBlocks - len(blocks) - 4
+	for i, workload := range workloads {
+		if i == budget {
+			blocks = append(blocks, slackContext(fmt.Sprintf("…and %d more workloads", len(workloads)-i)))
+			break
+		}
+
+		group := grouped[workload]
+		sort.SliceStable(group, func(i, j int) bool {
+			return severityLevel(group[i].Severity) < severityLevel(group[j].Severity)
+		})
+
+		var b strings.Builder
+		fmt.Fprintf(&b, "*`%s`*  %s", workload, severitySummary(countBySeverity(group)))
+		if exposure := group[0].Exposure; exposure != "" {
+			fmt.Fprintf(&b, "  ·  exposure: %s", exposure)
+		}
+		for j, e := range group {
+			if j == slackMaxCVEsPerWorkload {
+				fmt.Fprintf(&b, "\n_…and %d more_", len(group)-j)
+				break
+			}
+			fmt.Fprintf(&b, "\n%s %s", severityEmoji(e.Severity), slackFinding(e))
+			if e.Image != "" {
+				fmt.Fprintf(&b, " `%s`", e.Image)
+			}
+			if e.FixedVersion != "" {
+				fmt.Fprintf(&b, " fix: `%s`", e.FixedVersion)
+			}
+		}
+		blocks = append(blocks, map[string]interface{}{"type": "section", "text": slackText(b.String())})
+	}
+	return blocks
+}
+
+// slackChangedBlocks lists rescored vulnerabilities per workload with their
+// previous and new severity.
+func slackChangedBlocks(events []VulnerabilityEvent) []map[string]interface{} {
+	if len(events) == 0 {
+		return nil
+	}
+
+	grouped := groupByWorkload(events)
+	workloads := sortedWorkloads(grouped)
+	blocks := []map[string]interface{}{
+		slackHeader(fmt.Sprintf(":arrows_counterclockwise: Severity changed (%d)", len(events))),
+	}
+
+	budget := slackMaxBlocks - len(blocks) - 4
+	for i, workload := range workloads {
+		if i == budget {
+			blocks = append(blocks, slackContext(fmt.Sprintf("…and %d more workloads", len(workloads)-i)))
+			break
+		}
+
+		group := grouped[workload]
+		var b strings.Builder
+		fmt.Fprintf(&b, "*`%s`*", workload)
+		for j, e := range group {
+			if j == slackMaxCVEsPerWorkload {
+				fmt.Fprintf(&b, "\n_…and %d more_", len(group)-j)
+				break
+			}
+			fmt.Fprintf(&b, "\n%s %s %s", severityEmoji(e.Severity), slackFinding(e), severityChange(e))
+		}
+		blocks = append(blocks, map[string]interface{}{"type": "section", "text": slackText(b.String())})
+	}
+	return blocks
+}
+
+// slackFixedBlocks lists fixed CVE counts per workload, packing workloads
+// into as few sections as the text limit allows.
+func slackFixedBlocks(events []VulnerabilityEvent) []map[string]interface{} {
+	if len(events) == 0 {
+		return nil
+	}
+
+	grouped := groupByWorkload(events)
+	blocks := []map[string]interface{}{
+		slackHeader(fmt.Sprintf(":white_check_mark: Fixed %s (%d)", wording(events).plural, len(events))),
+	}
+
+	var lines []string
+	flush := func() {
+		if len(lines) > 0 {
+			blocks = append(blocks, map[string]interface{}{"type": "section", "text": slackText(strings.Join(lines, "\n"))})
+			lines = nil
+		}
+	}
+	size := 0
+	workloads := sortedWorkloads(grouped)
+	for i, workload := range workloads {
+		group := grouped[workload]
+		line := fmt.Sprintf("`%s`: %d %s", workload, len(group), wording(group).short)
+		if after := fixedAfter(group); after != "" {
+			line += ", " + after
+		}
+		if size+len(line)+1 > slackMaxSectionText {
+			flush()
+			size = 0
+			if len(blocks) >= slackMaxBlocks-2 {
+				blocks = append(blocks, slackContext(fmt.Sprintf("…and %d more workloads", len(workloads)-i)))
+				return blocks
+			}
+		}
+		lines = append(lines, line)
+		size += len(line) + 1
+	}
+	flush()
+	return blocks
+}
+
+// fixedAfter describes how long events stayed open, e.g. "fixed after 4d 6h",
+// or "fixed after up to 4d 6h" when their times differ. It is empty when no
+// event carries a time to fix.
+func fixedAfter(events []VulnerabilityEvent) string {
+	var longest int64
+	same := true
+	for i, e := range events {
+		if i > 0 && e.TimeToFix != events[0].TimeToFix {
+			same = false
+		}
+		longest = max(longest, e.TimeToFix)
+	}
+	if longest <= 0 {
+		return ""
+	}
+	text := formatDuration(time.Duration(longest) * time.Second)
+	if !same {
+		return "fixed after up to " + text
+	}
+	return "fixed after " + text
+}
+
+// slackFooter appends the cluster name, if any, and trims blocks to the
+// per-message limit.
+func (n *Notifier) slackFooter(blocks []map[string]interface{}) []map[string]interface{} {
+	if n.config.ClusterName != "" {
+		blocks = append(blocks, slackContext("Cluster: *"+n.config.ClusterName+"*"))
+	}
+	if len(blocks) > slackMaxBlocks {
+		blocks = blocks[:slackMaxBlocks]
+	}
+	return blocks
+}
+
+// slackFallbackText is the plain text shown in notifications and by clients
+// that can't render blocks.
+func slackFallbackText(events []VulnerabilityEvent) string {
+	return "trix: " + eventsSubject(events)
+}
+
+func slackHeader(text string) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "header",
+		"text": map[string]interface{}{"type": "plain_text", "text": truncateRunes(text, slackMaxHeaderText), "emoji": true},
+	}
+}
+
+func slackText(text string) map[string]interface{} {
+	return map[string]interface{}{"type": "mrkdwn", "text": truncateRunes(text, slackMaxSectionText)}
+}
+
+// truncateRunes shortens s to at most n characters, ending in an ellipsis
+func truncateRunes(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
+
+func slackContext(text string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":     "context",
+		"elements": []map[string]interface{}{slackText(text)},
+	}
+}
+
+// slackFinding names the finding of e, linking CVEs to NVD
+func slackFinding(e VulnerabilityEvent) string {
+	if e.kind() == KindVulnerability {
+		return slackCVELink(e.CVE)
+	}
+	return findingText(e)
+}
+
+func slackCVELink(cve string) string {
+	if !strings.HasPrefix(cve, "CVE-") {
+		return cve
+	}
+	return fmt.Sprintf("<https://nvd.nist.gov/vuln/detail/%s|%s>", url.PathEscape(cve), cve)
+}
+
+func severityEmoji(severity string) string {
+	if emoji, ok := slackSeverityEmoji[strings.ToUpper(severity)]; ok {
+		return emoji
+	}
+	return ":black_circle:"
+}
+
+// postSlack sends one Block Kit message, through chat.postMessage when a bot
+// token is configured (optionally as a reply to threadTS) or the incoming
+// webhook otherwise. It returns the message ts, which is empty for webhooks.
+func (n *Notifier) postSlack(ctx context.Context, threadTS, text string, blocks []map[string]interface{}) (string, error) {
+	payload := map[string]interface{}{
+		"text": text,
+	}
+	if blocks != nil {
+		payload["blocks"] = blocks
+	}
+
+	if n.config.SlackBotToken == "" {
+		return "", n.postJSON(ctx, n.config.SlackWebhook, payload)
+	}
+
+	payload["channel"] = n.config.SlackChannel
+	if threadTS != "" {
+		payload["thread_ts"] = threadTS
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("marshal: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, slackPostMessageURL, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Authorization", "Bearer "+n.config.SlackBotToken)
+
+	resp, err := n.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	// The Web API reports failures in the body with a 200 status
+	var result struct {
+		OK    bool   `json:"ok"`
+		TS    string `json:"ts"`
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("decode response: %w", err)
+	}
+	if !result.OK {
+		return "", fmt.Errorf("chat.postMessage: %s", result.Error)
+	}
+
+	n.logger.Debug("slack message posted", "ts", result.TS, "thread", threadTS)
+	return result.TS, nil
+}
+
+// GetSlackThread returns the ts of the message that last reported new
+// vulnerabilities in workload, or "".
+func (db *DB) GetSlackThread(ctx context.Context, workload string) (string, error) {
+	var ts string
+	err := db.queryRow(ctx, "SELECT ts FROM slack_threads WHERE workload = $1", workload).Scan(&ts)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return ts, err
+}
+
+// SetSlackThread records ts as the thread for each workload.
+func (db *DB) SetSlackThread(ctx context.Context, workloads []string, ts string) error {
+	upsert := `
+		INSERT INTO slack_threads (workload, ts, updated_at) VALUES ($1, $2, $3)
+		ON CONFLICT (workload) DO UPDATE SET ts = EXCLUDED.ts, updated_at = EXCLUDED.updated_at`
+	if db.dialect == dialectMySQL {
+		upsert = `
+		INSERT INTO slack_threads (workload, ts, updated_at) VALUES ($1, $2, $3)
+		ON DUPLICATE KEY UPDATE ts = VALUES(ts), updated_at = VALUES(updated_at)`
+	}
+
+	now := time.Now()
+	for _, workload := range workloads {
+		if _, err := db.exec(ctx, upsert, workload, ts, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetSlackThread returns the ts of the message that last reported new
+// vulnerabilities in workload, or "".
+func (m *MemoryStore) GetSlackThread(ctx context.Context, workload string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.slackThreads[workload], nil
+}
+
+// SetSlackThread records ts as the thread for each workload.
+func (m *MemoryStore) SetSlackThread(ctx context.Context, workloads []string, ts string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, workload := range workloads {
+		m.slackThreads[workload] = ts
+	}
+	return nil
+}
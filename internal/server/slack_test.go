@@ -0,0 +1,244 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf8"
+)
+
+// slackEvents covers every event type with the details Block Kit shows
+func slackEvents() []VulnerabilityEvent {
+	events := teamsEvents()
+	events[1].FixedVersion, events[1].Exposure = "3.0.8", "external"
+	events[2].Exposure = "external"
+	events[5].TimeToFix, events[6].TimeToFix = 3*86400, 3*86400
+	return events
+}
+
+func slackJSON(t *testing.T, body []byte) []byte {
+	t.Helper()
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatalf("slack payload: %v\n%s", err, body)
+	}
+	return teamsJSON(t, payload)
+}
+
+func TestSlackBlocksGolden(t *testing.T) {
+	srv, received := stubReceiver(t, http.StatusOK)
+	n := testNotifier(t, map[string]string{"TRIX_NOTIFY_SLACK": srv.URL, "TRIX_CLUSTER_NAME": "prod-eu"})
+
+	if err := n.sendSlack(context.Background(), slackEvents()); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.sendSlackSummaryBlocks(context.Background(), filterByType(slackEvents(), "NEW")); err != nil {
+		t.Fatal(err)
+	}
+	reqs := received()
+	if len(reqs) != 2 {
+		t.Fatalf("%d requests, want 2", len(reqs))
+	}
+	golden(t, "slack_poll.json", slackJSON(t, reqs[0].body))
+	golden(t, "slack_summary.json", slackJSON(t, reqs[1].body))
+}
+
+// blockTexts returns the text of every block in a Block Kit payload
+func blockTexts(t *testing.T, blocks []map[string]interface{}) []string {
+	t.Helper()
+	var texts []string
+	for _, b := range blocks {
+		switch b["type"] {
+		case "header", "section":
+			texts = append(texts, b["text"].(map[string]interface{})["text"].(string))
+		case "context":
+			texts = append(texts, b["elements"].([]map[string]interface{})[0]["text"].(string))
+		}
+	}
+	return texts
+}
+
+func TestSlackNewBlocksLimits(t *testing.T) {
+	var events []VulnerabilityEvent
+	for w := 0; w < 60; w++ {
+		for c := 0; c < 15; c++ {
+			events = append(events, VulnerabilityEvent{
+				ID: fmt.Sprintf("%d-%d", w, c), Type: "NEW", Kind: KindVulnerability,
+				CVE: fmt.Sprintf("CVE-2024-%04d", c), Severity: "HIGH",
+				Workload: fmt.Sprintf("ns/deployment/app-%02d", w), Image: "openssl:3.0.1",
+			})
+		}
+	}
+
+	blocks := slackNewBlocks(events)
+	if len(blocks) > slackMaxBlocks-3 {
+		t.Errorf("%d blocks leave no room for the footer", len(blocks))
+	}
+	texts := blockTexts(t, blocks)
+	if texts[0] != ":rotating_light: New vulnerabilities (900)" {
+		t.Errorf("header = %q", texts[0])
+	}
+	if last := texts[len(texts)-1]; last != fmt.Sprintf("…and %d more workloads", 60-(len(blocks)-2)) {
+		t.Errorf("overflow line = %q", last)
+	}
+	first := texts[1]
+	if n := strings.Count(first, "nvd.nist.gov"); n != slackMaxCVEsPerWorkload {
+		t.Errorf("%d CVEs listed per workload, want %d", n, slackMaxCVEsPerWorkload)
+	}
+	if !strings.HasSuffix(first, "\n_…and 5 more_") {
+		t.Errorf("truncated workload = %q", first)
+	}
+
+	// Oversized text is cut to the Block Kit limits
+	long := []VulnerabilityEvent{{Type: "NEW", Kind: KindVulnerability, CVE: "CVE-2024-0001", Severity: "LOW",
+		Workload: "ns/deployment/" + strings.Repeat("x", 4000)}}
+	for _, text := range blockTexts(t, slackNewBlocks(long)) {
+		if n := utf8.RuneCountInString(text); n > slackMaxSectionText {
+			t.Errorf("text of %d characters", n)
+		}
+	}
+	if h := slackHeader(strings.Repeat("é", 200))["text"].(map[string]interface{})["text"].(string); utf8.RuneCountInString(h) != slackMaxHeaderText || !strings.HasSuffix(h, "…") {
+		t.Errorf("header of %d characters", utf8.RuneCountInString(h))
+	}
+}
+
+// Fixed workloads are packed into sections up to the text limit
+func TestSlackFixedBlocksPacking(t *testing.T) {
+	var events []VulnerabilityEvent
+	for w := 0; w < 5000; w++ {
+		events = append(events, VulnerabilityEvent{ID: fmt.Sprint(w), Type: "FIXED", Kind: KindVulnerability,
+			CVE: "CVE-2024-0001", Severity: "LOW", Workload: fmt.Sprintf("namespace/deployment/workload-%04d", w)})
+	}
+	blocks := slackFixedBlocks(events)
+	if len(blocks) > slackMaxBlocks-1 {
+		t.Errorf("%d blocks", len(blocks))
+	}
+	texts := blockTexts(t, blocks)
+	for _, text := range texts[1 : len(texts)-1] {
+		if len(text) > slackMaxSectionText {
+			t.Errorf("section of %d bytes", len(text))
+		}
+	}
+	if !strings.HasPrefix(texts[len(texts)-1], "…and ") {
+		t.Errorf("no overflow line, last block = %q", texts[len(texts)-1])
+	}
+
+	few := blockTexts(t, slackFixedBlocks(events[:3]))
+	if len(few) != 2 || strings.Count(few[1], "\n") != 2 {
+		t.Errorf("3 workloads = %q, want one section", few)
+	}
+}
+
+// stubSlackAPI serves chat.postMessage, answering each post with the next ts
+func stubSlackAPI(t *testing.T) func() []map[string]interface{} {
+	t.Helper()
+	var mu sync.Mutex
+	var posts []map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]interface{}
+		if r.Header.Get("Authorization") != "Bearer xoxb-test" || json.NewDecoder(r.Body).Decode(&payload) != nil {
+			_, _ = w.Write([]byte(`{"ok":false,"error":"invalid_auth"}`))
+			return
+		}
+		mu.Lock()
+		posts = append(posts, payload)
+		ts := fmt.Sprintf("1700000000.%06d", len(posts))
+		mu.Unlock()
+		_, _ = fmt.Fprintf(w, `{"ok":true,"ts":%q}`, ts)
+	}))
+	t.Cleanup(srv.Close)
+
+	old := slackPostMessageURL
+	slackPostMessageURL = srv.URL
+	t.Cleanup(func() { slackPostMessageURL = old })
+
+	return func() []map[string]interface{} {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]map[string]interface{}(nil), posts...)
+	}
+}
+
+// FIXED events reply in the thread of the message that reported the
+// workload's vulnerabilities as new
+func TestSlackThreads(t *testing.T) {
+	posts := stubSlackAPI(t)
+	n := testNotifier(t, map[string]string{"TRIX_SLACK_BOT_TOKEN": "xoxb-test", "TRIX_SLACK_CHANNEL": "#security"})
+	ctx := context.Background()
+
+	events := slackEvents()
+	newEvents := filterByType(events, "NEW")
+	if err := n.sendSlack(ctx, newEvents); err != nil {
+		t.Fatal(err)
+	}
+	for _, workload := range []string{"prod/deployment/api", "dev/deployment/web"} {
+		if ts, _ := n.store.GetSlackThread(ctx, workload); ts != "1700000000.000001" {
+			t.Errorf("thread of %s = %q", workload, ts)
+		}
+	}
+
+	fixed := append(filterByType(events, "FIXED"), VulnerabilityEvent{ID: "f3", Type: "FIXED", Kind: KindVulnerability,
+		CVE: "CVE-2023-0003", Workload: "prod/deployment/unthreaded", Severity: "LOW"})
+	if err := n.sendSlack(ctx, fixed); err != nil {
+		t.Fatal(err)
+	}
+
+	got := posts()
+	if len(got) != 3 {
+		t.Fatalf("%d posts, want the new message and two fixed", len(got))
+	}
+	if got[0]["channel"] != "#security" || got[0]["thread_ts"] != nil {
+		t.Errorf("new message = %v", got[0])
+	}
+	// Workloads without a thread come first (ts "" sorts first)
+	if got[1]["thread_ts"] != nil || !strings.Contains(fmt.Sprint(got[1]["blocks"]), "prod/deployment/unthreaded") {
+		t.Errorf("unthreaded fixed message = %v", got[1])
+	}
+	if got[2]["thread_ts"] != "1700000000.000001" || !strings.Contains(fmt.Sprint(got[2]["blocks"]), "prod/deployment/api") {
+		t.Errorf("threaded fixed message = %v", got[2])
+	}
+}
+
+func TestSlackAPIError(t *testing.T) {
+	stubSlackAPI(t)
+	n := testNotifier(t, map[string]string{"TRIX_SLACK_BOT_TOKEN": "xoxb-wrong", "TRIX_SLACK_CHANNEL": "#security"})
+	if err := n.sendSlack(context.Background(), testEvents()); err == nil || err.Error() != "chat.postMessage: invalid_auth" {
+		t.Errorf("err = %v", err)
+	}
+}
+
+// TRIX_SLACK_LEGACY keeps the attachment format for old proxies
+func TestSlackLegacy(t *testing.T) {
+	srv, received := stubReceiver(t, http.StatusOK)
+	n := testNotifier(t, map[string]string{"TRIX_NOTIFY_SLACK": srv.URL, "TRIX_SLACK_LEGACY": "true"})
+	if err := n.sendSlack(context.Background(), slackEvents()); err != nil {
+		t.Fatal(err)
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(received()[0].body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := payload["blocks"]; ok {
+		t.Error("legacy payload has blocks")
+	}
+	if attachments, _ := payload["attachments"].([]interface{}); len(attachments) == 0 {
+		t.Errorf("legacy payload = %v", payload)
+	}
+}
+
+func TestSlackCVELink(t *testing.T) {
+	if got := slackCVELink("CVE-2024-0001"); got != "<https://nvd.nist.gov/vuln/detail/CVE-2024-0001|CVE-2024-0001>" {
+		t.Errorf("slackCVELink = %q", got)
+	}
+	if got := slackCVELink("GHSA-xxxx-yyyy"); got != "GHSA-xxxx-yyyy" {
+		t.Errorf("non-CVE link = %q", got)
+	}
+	if severityEmoji("critical") != ":red_circle:" || severityEmoji("UNKNOWN") != ":black_circle:" {
+		t.Error("severity emoji")
+	}
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// Snapshot records vulnerability counts at the end of one poll.
+type Snapshot struct {
+	TakenAt     time.Time
+	TotalOpen   int
+	TotalFixed  int
+	BySeverity  map[string]int // Open vulnerabilities only
+	ByNamespace map[string]int // Open vulnerabilities only
+}
+
+// TrendPoint is the last snapshot taken in a bucket of time.
+type TrendPoint struct {
+	Time        time.Time      `json:"time"` // Start of the bucket (UTC)
+	TakenAt     time.Time      `json:"takenAt"`
+	TotalOpen   int            `json:"totalOpen"`
+	TotalFixed  int            `json:"totalFixed"`
+	BySeverity  map[string]int `json:"bySeverity"`
+	ByNamespace map[string]int `json:"byNamespace"`
+}
+
+// Trend reduces snapshots to one point per bucket, oldest first. Counts are
+// levels rather than flows, so each bucket reports its latest snapshot
+// instead of a sum. Empty buckets are skipped.
+func Trend(snapshots []Snapshot, bucket time.Duration) []TrendPoint {
+	latest := make(map[time.Time]Snapshot)
+	for _, s := range snapshots {
+		start := s.TakenAt.UTC().Truncate(bucket)
+		if cur, ok := latest[start]; !ok || s.TakenAt.After(cur.TakenAt) {
+			latest[start] = s
+		}
+	}
+
+	points := make([]TrendPoint, 0, len(latest))
+	for start, s := range latest {
+		points = append(points, TrendPoint{
+			Time:        start,
+			TakenAt:     s.TakenAt,
+			TotalOpen:   s.TotalOpen,
+			TotalFixed:  s.TotalFixed,
+			BySeverity:  s.BySeverity,
+			ByNamespace: s.ByNamespace,
+		})
+	}
+	sort.Slice(points, func(i, j int) bool {
+		return points[i].Time.Before(points[j].Time)
+	})
+	return points
+}
+
+// WriteSnapshot stores a snapshot.
+func (db *DB) WriteSnapshot(ctx context.Context, s *Snapshot) error {
+	bySeverity, err := json.Marshal(s.BySeverity)
+	if err != nil {
+		return err
+	}
+	byNamespace, err := json.Marshal(s.ByNamespace)
+	if err != nil {
+		return err
+	}
+	_, err = db.exec(ctx, `
+		INSERT INTO snapshots (taken_at, total_open, total_fixed, by_severity, by_namespace)
+		VALUES ($1, $2, $3, $4, $5)
+	`, s.TakenAt, s.TotalOpen, s.TotalFixed, string(bySeverity), string(byNamespace))
+	return err
+}
+
+// GetSnapshots returns snapshots taken at or after since, oldest first.
+func (db *DB) GetSnapshots(ctx context.Context, since time.Time) ([]Snapshot, error) {
+	rows, err := db.query(ctx, `
+		SELECT taken_at, total_open, total_fixed, by_severity, by_namespace
+		FROM snapshots WHERE taken_at >= $1
+		ORDER BY taken_at
+	`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var snapshots []Snapshot
+	for rows.Next() {
+		var s Snapshot
+		var bySeverity, byNamespace []byte
+		if err := rows.Scan(&s.TakenAt, &s.TotalOpen, &s.TotalFixed, &bySeverity, &byNamespace); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(bySeverity, &s.BySeverity); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(byNamespace, &s.ByNamespace); err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, s)
+	}
+
+	return snapshots, rows.Err()
+}
+
+// PruneSnapshots deletes snapshots taken strictly before cutoff.
+func (db *DB) PruneSnapshots(ctx context.Context, cutoff time.Time) (int64, error) {
+	res, err := db.exec(ctx, "DELETE FROM snapshots WHERE taken_at < $1", cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// WriteSnapshot stores a snapshot.
+func (m *MemoryStore) WriteSnapshot(ctx context.Context, s *Snapshot) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.snapshots = append(m.snapshots, *s)
+	return nil
+}
+
+// GetSnapshots returns snapshots taken at or after since, oldest first.
+func (m *MemoryStore) GetSnapshots(ctx context.Context, since time.Time) ([]Snapshot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var snapshots []Snapshot
+	for _, s := range m.snapshots {
+		if !s.TakenAt.Before(since) {
+			snapshots = append(snapshots, s)
+		}
+	}
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[i].TakenAt.Before(snapshots[j].TakenAt)
+	})
+	return snapshots, nil
+}
+
+// PruneSnapshots deletes snapshots taken strictly before cutoff.
+func (m *MemoryStore) PruneSnapshots(ctx context.Context, cutoff time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.snapshots[:0]
+	for _, s := range m.snapshots {
+		if !s.TakenAt.Before(cutoff) {
+			kept = append(kept, s)
+		}
+	}
+	pruned := int64(len(m.snapshots) - len(kept))
+	m.snapshots = kept
+	return pruned, nil
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTrend(t *testing.T) {
+	day := func(d, h int) time.Time { return time.Date(2024, 3, d, h, 0, 0, 0, time.UTC) }
+	snapshots := []Snapshot{
+		{TakenAt: day(2, 18), TotalOpen: 7, BySeverity: map[string]int{"CRITICAL": 2}},
+		{TakenAt: day(1, 6), TotalOpen: 3},
+		{TakenAt: day(1, 23), TotalOpen: 5, TotalFixed: 1, ByNamespace: map[string]int{"payments": 5}},
+		{TakenAt: day(1, 12), TotalOpen: 4},
+		{TakenAt: day(2, 0), TotalOpen: 6}, // Starts the next bucket
+		// No snapshot on the 3rd
+		{TakenAt: day(4, 1).In(time.FixedZone("CET", 3600)), TotalOpen: 1}, // Bucketed in UTC
+	}
+
+	got := Trend(snapshots, 24*time.Hour)
+	want := []TrendPoint{
+		{Time: day(1, 0), TakenAt: day(1, 23), TotalOpen: 5, TotalFixed: 1, ByNamespace: map[string]int{"payments": 5}},
+		{Time: day(2, 0), TakenAt: day(2, 18), TotalOpen: 7, BySeverity: map[string]int{"CRITICAL": 2}},
+		{Time: day(4, 0), TakenAt: snapshots[5].TakenAt, TotalOpen: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Trend =\n%+v\nwant\n%+v", got, want)
+	}
+
+	// Counts are levels: hourly buckets keep every snapshot, never summed
+	if got := Trend(snapshots[1:4], time.Hour); len(got) != 3 || got[0].TotalOpen != 3 || got[2].TotalOpen != 5 {
+		t.Errorf("hourly Trend = %+v", got)
+	}
+	if got := Trend(nil, time.Hour); len(got) != 0 {
+		t.Errorf("Trend(nil) = %+v", got)
+	}
+}
+
+func testSnapshots(t *testing.T, s Store) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	for _, snap := range []*Snapshot{
+		{TakenAt: now.Add(-48 * time.Hour), TotalOpen: 1, BySeverity: map[string]int{}, ByNamespace: map[string]int{}},
+		{TakenAt: now, TotalOpen: 3, TotalFixed: 2,
+			BySeverity:  map[string]int{"CRITICAL": 1, "HIGH": 2},
+			ByNamespace: map[string]int{"payments": 2, "": 1}},
+		{TakenAt: now.Add(-time.Hour), TotalOpen: 2, BySeverity: map[string]int{"HIGH": 2}, ByNamespace: map[string]int{"shop": 2}},
+	} {
+		if err := s.WriteSnapshot(ctx, snap); err != nil {
+			t.Fatalf("WriteSnapshot: %v", err)
+		}
+	}
+
+	got, err := s.GetSnapshots(ctx, now.Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("%d snapshots since an hour ago, want 2 (inclusive)", len(got))
+	}
+	if !got[0].TakenAt.Equal(now.Add(-time.Hour)) || !got[1].TakenAt.Equal(now) {
+		t.Errorf("snapshots at %v, %v, want oldest first", got[0].TakenAt, got[1].TakenAt)
+	}
+	latest := got[1]
+	if latest.TotalOpen != 3 || latest.TotalFixed != 2 ||
+		!reflect.DeepEqual(latest.BySeverity, map[string]int{"CRITICAL": 1, "HIGH": 2}) ||
+		!reflect.DeepEqual(latest.ByNamespace, map[string]int{"payments": 2, "": 1}) {
+		t.Errorf("snapshot round trip = %+v", latest)
+	}
+
+	// Strictly before the cutoff
+	if n, err := s.PruneSnapshots(ctx, now.Add(-time.Hour)); err != nil || n != 1 {
+		t.Errorf("PruneSnapshots = %d, %v, want 1", n, err)
+	}
+	if all, err := s.GetSnapshots(ctx, time.Time{}); err != nil || len(all) != 2 {
+		t.Errorf("%d snapshots left, %v, want 2", len(all), err)
+	}
+}
+
+// The snapshot is written after reconciliation, so a poll that fixes
+// vulnerabilities records them as fixed
+func TestPollWritesSnapshot(t *testing.T) {
+	cfg := testConfig(t, nil)
+	db := NewMemoryStore()
+	ctx := context.Background()
+	critical := fixtureVuln{"CVE-2024-0001", "CRITICAL", "openssl", "3.0.1", "3.0.8"}
+	high := fixtureVuln{"CVE-2024-0002", "HIGH", "zlib", "1.2.11", "1.2.12"}
+
+	if _, err := testPoller(cfg, db, fakeDynamic(
+		vulnReport("payments", "api", "sha256:aaa", critical, high),
+		vulnReport("shop", "web", "sha256:bbb", high),
+	)).Poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testPoller(cfg, db, fakeDynamic(
+		vulnReport("payments", "api", "sha256:aaa", high),
+	)).Poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshots, err := db.GetSnapshots(ctx, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 2 {
+		t.Fatalf("%d snapshots after 2 polls, want 2", len(snapshots))
+	}
+	first, second := snapshots[0], snapshots[1]
+	if first.TotalOpen != 3 || first.TotalFixed != 0 || !reflect.DeepEqual(first.ByNamespace, map[string]int{"payments": 2, "shop": 1}) {
+		t.Errorf("first snapshot = %+v", first)
+	}
+	if second.TotalOpen != 1 || second.TotalFixed != 2 ||
+		!reflect.DeepEqual(second.BySeverity, map[string]int{"HIGH": 1}) ||
+		!reflect.DeepEqual(second.ByNamespace, map[string]int{"payments": 1}) {
+		t.Errorf("second snapshot = %+v, want the post-reconciliation counts", second)
+	}
+}
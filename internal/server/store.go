@@ -0,0 +1,145 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Store persists vulnerability state between polls.
+//
+// Vulnerabilities move from OPEN to FIXED when a scan no longer reports them,
+// and back to OPEN (reported as new) when they reappear.
+type Store interface {
+	// UpsertVulnerability records a vulnerability seen in the current scan
+	// and returns what changed.
+	UpsertVulnerability(ctx context.Context, v *VulnerabilityRecord) (VulnerabilityChange, error)
+
+	// MarkFixed marks open vulnerabilities missing from currentIDs as fixed
+	// and returns them. Only vulnerabilities in namespaces and of kinds are
+	// considered; an empty list means all of them.
+	MarkFixed(ctx context.Context, namespaces, kinds, currentIDs []string) ([]VulnerabilityRecord, error)
+
+	// PruneFixed deletes FIXED vulnerabilities with fixed_at strictly before
+	// cutoff and returns how many were deleted.
+	PruneFixed(ctx context.Context, cutoff time.Time) (int64, error)
+
+	// GetOpenVulnerabilities returns open vulnerabilities, most severe first.
+	GetOpenVulnerabilities(ctx context.Context) ([]VulnerabilityRecord, error)
+
+	// ListVulnerabilities returns one page of vulnerabilities matching the
+	// filter, most severe first, and the total number of matches.
+	ListVulnerabilities(ctx context.Context, f VulnerabilityFilter) ([]VulnerabilityRecord, int, error)
+
+	// GetVulnerability returns a vulnerability by ID, or nil if it doesn't exist.
+	GetVulnerability(ctx context.Context, id string) (*VulnerabilityRecord, error)
+
+	// GetStats returns counts of vulnerabilities by state and severity, and
+	// the mean time to fix by severity over mttrWindow (skipped when 0).
+	GetStats(ctx context.Context, mttrWindow time.Duration) (*Stats, error)
+
+	// GetUnsyncedVulnerabilities returns vulnerabilities not yet sent to SaaS.
+	GetUnsyncedVulnerabilities(ctx context.Context) ([]VulnerabilityRecord, error)
+
+	// MarkSaasSynced marks vulnerabilities as sent to SaaS.
+	MarkSaasSynced(ctx context.Context, ids []string) error
+
+	// WriteSnapshot stores the counts at the end of a poll.
+	WriteSnapshot(ctx context.Context, s *Snapshot) error
+
+	// GetSnapshots returns snapshots taken at or after since, oldest first.
+	GetSnapshots(ctx context.Context, since time.Time) ([]Snapshot, error)
+
+	// PruneSnapshots deletes snapshots taken strictly before cutoff.
+	PruneSnapshots(ctx context.Context, cutoff time.Time) (int64, error)
+
+	// QueueDigest stores events for the next digest sent on channel.
+	QueueDigest(ctx context.Context, channel string, events []VulnerabilityEvent) error
+
+	// PendingDigest returns the events queued for channel, oldest first,
+	// and the ID of the last one.
+	PendingDigest(ctx context.Context, channel string) ([]VulnerabilityEvent, int64, error)
+
+	// ClearDigest deletes the events queued for channel up to and including lastID.
+	ClearDigest(ctx context.Context, channel string, lastID int64) error
+
+	// GetDigestRun returns the last digest sent on channel, or nil.
+	GetDigestRun(ctx context.Context, channel string) (*DigestRun, error)
+
+	// SetDigestRun records the digest just sent on channel.
+	SetDigestRun(ctx context.Context, channel string, run *DigestRun) error
+
+	// GetGitHubIssue returns the GitHub issue filed for a CVE in a workload,
+	// or 0 if there is none.
+	GetGitHubIssue(ctx context.Context, cve, workload string) (int, error)
+
+	// SetGitHubIssue records the GitHub issue filed for a CVE in a workload.
+	SetGitHubIssue(ctx context.Context, cve, workload string, number int) error
+
+	// GetSlackThread returns the ts of the Slack message that last reported
+	// new vulnerabilities in workload, or "" if there is none.
+	GetSlackThread(ctx context.Context, workload string) (string, error)
+
+	// SetSlackThread records ts as the Slack thread for each workload.
+	SetSlackThread(ctx context.Context, workloads []string, ts string) error
+
+	// QueueDeliveries stores events a channel failed to deliver, with the
+	// error and when to try again.
+	QueueDeliveries(ctx context.Context, channel string, events []VulnerabilityEvent, lastError string, next time.Time) error
+
+	// DueDeliveries returns undelivered notifications due at now with fewer
+	// than maxAttempts attempts, oldest first.
+	DueDeliveries(ctx context.Context, now time.Time, maxAttempts int) ([]Delivery, error)
+
+	// MarkDelivered records that queued notifications were delivered.
+	MarkDelivered(ctx context.Context, ids []int64) error
+
+	// RecordDeliveryAttempt counts another failed attempt.
+	RecordDeliveryAttempt(ctx context.Context, ids []int64, lastError string, next time.Time) error
+
+	// GetDeliveryStats counts undelivered notifications.
+	GetDeliveryStats(ctx context.Context, maxAttempts int) (*DeliveryStats, error)
+
+	// PruneDeliveries deletes delivered and abandoned notifications
+	// created strictly before cutoff.
+	PruneDeliveries(ctx context.Context, cutoff time.Time, maxAttempts int) (int64, error)
+
+	// RecordSuppressed stores events deliberately not sent to channel as
+	// delivered, with the reason.
+	RecordSuppressed(ctx context.Context, channel string, events []VulnerabilityEvent, reason string) error
+
+	// RecentlyNotified returns the workloads notified at or after since.
+	RecentlyNotified(ctx context.Context, since time.Time) (map[string]bool, error)
+
+	// SetNotified records workloads as notified at at.
+	SetNotified(ctx context.Context, workloads []string, at time.Time) error
+
+	// PruneNotified forgets workloads last notified strictly before cutoff.
+	PruneNotified(ctx context.Context, cutoff time.Time) (int64, error)
+
+	// Ping checks that the store is reachable.
+	Ping(ctx context.Context) error
+
+	Close() error
+}
+
+// VulnerabilityChange is what an upsert changed about a vulnerability.
+type VulnerabilityChange struct {
+	New         bool      // Inserted, or reopened after being FIXED
+	OldSeverity string    // Severity of an OPEN vulnerability before it was rescored, "" if unchanged
+	FirstSeen   time.Time // Of an existing vulnerability
+
+	// Image digest of an OPEN vulnerability before this scan when its
+	// container's image changed, "" if it didn't or either digest is unknown
+	OldImageDigest string
+}
+
+// NewStore opens the store for a database URL. postgres:// (or any other
+// lib/pq connection string) and mysql:// URLs are supported, as well as
+// memory:// for an ephemeral in-memory store.
+func NewStore(ctx context.Context, config *Config, logger *slog.Logger) (Store, error) {
+	if isMemoryURL(config.DatabaseURL) {
+		return NewMemoryStore(), nil
+	}
+	return NewDB(ctx, config, logger)
+}
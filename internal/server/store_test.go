@@ -0,0 +1,587 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testStores returns a constructor for an empty store of each kind under
+// test: always the memory store, plus PostgreSQL and MySQL when
+// TRIX_TEST_POSTGRES_URL or TRIX_TEST_MYSQL_URL is set.
+func testStores(t *testing.T) map[string]func(t *testing.T) Store {
+	t.Helper()
+	stores := map[string]func(t *testing.T) Store{
+		"memory": func(t *testing.T) Store { return NewMemoryStore() },
+	}
+	if base := os.Getenv("TRIX_TEST_POSTGRES_URL"); base != "" {
+		stores["postgres"] = func(t *testing.T) Store { return openTestDB(t, testPostgres(t, base)) }
+	}
+	if base := os.Getenv("TRIX_TEST_MYSQL_URL"); base != "" {
+		stores["mysql"] = func(t *testing.T) Store { return openTestDB(t, testMySQL(t, base)) }
+	}
+	return stores
+}
+
+// storeConformance is the behavior every Store implementation must share
+var storeConformance = []struct {
+	name string
+	run  func(t *testing.T, s Store)
+}{
+	{"UpsertNew", testUpsertNew},
+	{"UpsertExisting", testUpsertExisting},
+	{"UpsertReopens", testUpsertReopens},
+	{"UpsertConcurrent", testUpsertConcurrent},
+	{"MarkFixed", testMarkFixed},
+	{"MarkFixedScoped", testMarkFixedScoped},
+	{"MarkFixedBatches", testMarkFixedBatches},
+	{"TimestampPrecision", testTimestampPrecision},
+	{"PruneFixed", testPruneFixed},
+	{"Snapshots", testSnapshots},
+	{"Deliveries", testDeliveries},
+	{"DeliveryBatches", testDeliveryBatches},
+	{"Notified", testNotified},
+	{"DigestQueue", testDigestQueue},
+	{"SaasSync", testSaasSync},
+	{"Stats", testStats},
+	{"MTTR", testMTTR},
+	{"Kinds", testKinds},
+	{"FilterByFindingID", testFilterByFindingID},
+	{"SeverityTransitions", testSeverityTransitions},
+}
+
+func TestStoreConformance(t *testing.T) {
+	for name, open := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			for _, c := range storeConformance {
+				t.Run(c.name, func(t *testing.T) { c.run(t, open(t)) })
+			}
+		})
+	}
+}
+
+// storeRecord is a vulnerability in namespace ns of the given kind
+func storeRecord(id, ns, kind, severity string) *VulnerabilityRecord {
+	return &VulnerabilityRecord{
+		ID:              id,
+		Kind:            kind,
+		CVE:             "CVE-2024-" + id,
+		Workload:        ns + "/deployment/app",
+		Namespace:       ns,
+		Severity:        severity,
+		Image:           "openssl:3.0.1",
+		ContainerName:   "app",
+		ImageRepository: "ghcr.io/acme/app",
+		ImageTag:        "1.0",
+		ImageDigest:     "sha256:aaa",
+		FixedVersion:    "3.0.8",
+		Exposure:        "external",
+	}
+}
+
+func mustUpsert(t *testing.T, s Store, v *VulnerabilityRecord) VulnerabilityChange {
+	t.Helper()
+	change, err := s.UpsertVulnerability(context.Background(), v)
+	if err != nil {
+		t.Fatalf("UpsertVulnerability(%s): %v", v.ID, err)
+	}
+	return change
+}
+
+func mustGet(t *testing.T, s Store, id string) *VulnerabilityRecord {
+	t.Helper()
+	v, err := s.GetVulnerability(context.Background(), id)
+	if err != nil {
+		t.Fatalf("GetVulnerability(%s): %v", id, err)
+	}
+	if v == nil {
+		t.Fatalf("GetVulnerability(%s): not found", id)
+	}
+	return v
+}
+
+func recordIDs(vulns []VulnerabilityRecord) []string {
+	ids := make([]string, 0, len(vulns))
+	for _, v := range vulns {
+		ids = append(ids, v.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func testUpsertNew(t *testing.T, s Store) {
+	in := storeRecord("1", "payments", KindVulnerability, "HIGH")
+	if change := mustUpsert(t, s, in); !change.New || !change.FirstSeen.IsZero() {
+		t.Errorf("change = %+v, want new", change)
+	}
+
+	got := mustGet(t, s, "1")
+	if got.State != StateOpen || got.FixedAt != nil || got.FirstSeen.IsZero() || !got.LastSeen.Equal(got.FirstSeen) {
+		t.Errorf("stored state = %s, fixed %v, first %v, last %v", got.State, got.FixedAt, got.FirstSeen, got.LastSeen)
+	}
+	// Namespace is write-only; compare everything else
+	want := *in
+	want.Namespace, want.State, want.FirstSeen, want.LastSeen, want.FixedAt = "", got.State, got.FirstSeen, got.LastSeen, nil
+	got.Namespace = ""
+	if !reflect.DeepEqual(*got, want) {
+		t.Errorf("stored %+v, want %+v", *got, want)
+	}
+
+	// Records without a kind are vulnerabilities
+	mustUpsert(t, s, storeRecord("2", "payments", "", "LOW"))
+	if kind := mustGet(t, s, "2").Kind; kind != KindVulnerability {
+		t.Errorf("default kind = %q", kind)
+	}
+	if v, err := s.GetVulnerability(context.Background(), "missing"); err != nil || v != nil {
+		t.Errorf("GetVulnerability(missing) = %v, %v", v, err)
+	}
+}
+
+func testUpsertExisting(t *testing.T, s Store) {
+	mustUpsert(t, s, storeRecord("1", "payments", KindVulnerability, "HIGH"))
+	first := mustGet(t, s, "1")
+	time.Sleep(5 * time.Millisecond)
+
+	// Same severity and image: nothing to report
+	if change := mustUpsert(t, s, storeRecord("1", "payments", KindVulnerability, "HIGH")); change.New ||
+		change.OldSeverity != "" || change.OldImageDigest != "" || !change.FirstSeen.Equal(first.FirstSeen) {
+		t.Errorf("unchanged upsert = %+v", change)
+	}
+
+	// Rescored and rebuilt
+	v := storeRecord("1", "payments", KindVulnerability, "CRITICAL")
+	v.ImageDigest, v.ImageTag, v.FixedVersion = "sha256:bbb", "1.1", "3.0.9"
+	change := mustUpsert(t, s, v)
+	if change.New || change.OldSeverity != "HIGH" || change.OldImageDigest != "sha256:aaa" {
+		t.Errorf("change = %+v, want severity HIGH and digest sha256:aaa before", change)
+	}
+	got := mustGet(t, s, "1")
+	if got.Severity != "CRITICAL" || got.ImageDigest != "sha256:bbb" || got.ImageTag != "1.1" || got.FixedVersion != "3.0.9" {
+		t.Errorf("stored = %+v", got)
+	}
+	if !got.FirstSeen.Equal(first.FirstSeen) || !got.LastSeen.After(first.LastSeen) {
+		t.Errorf("first/last seen = %v/%v, was %v/%v", got.FirstSeen, got.LastSeen, first.FirstSeen, first.LastSeen)
+	}
+
+	// An unknown digest is not an image change
+	v.ImageDigest = ""
+	if change := mustUpsert(t, s, v); change.OldImageDigest != "" {
+		t.Errorf("digest change reported for an unknown digest: %+v", change)
+	}
+}
+
+func testUpsertReopens(t *testing.T, s Store) {
+	ctx := context.Background()
+	mustUpsert(t, s, storeRecord("1", "payments", KindVulnerability, "HIGH"))
+	first := mustGet(t, s, "1").FirstSeen
+	if err := s.MarkSaasSynced(ctx, []string{"1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.MarkFixed(ctx, nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	change := mustUpsert(t, s, storeRecord("1", "payments", KindVulnerability, "CRITICAL"))
+	if !change.New || !change.FirstSeen.Equal(first) || change.OldSeverity != "" {
+		t.Errorf("reopen change = %+v, want new with the original first seen", change)
+	}
+	got := mustGet(t, s, "1")
+	if got.State != StateOpen || got.FixedAt != nil || got.Severity != "CRITICAL" {
+		t.Errorf("reopened = %s, fixed %v, %s", got.State, got.FixedAt, got.Severity)
+	}
+	// The reopen has to reach SaaS again
+	unsynced, err := s.GetUnsyncedVulnerabilities(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := recordIDs(unsynced); !reflect.DeepEqual(ids, []string{"1"}) {
+		t.Errorf("unsynced after reopen = %v", ids)
+	}
+}
+
+// Poll workers and replicas may insert the same vulnerability at once
+func testUpsertConcurrent(t *testing.T, s Store) {
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.UpsertVulnerability(context.Background(), storeRecord("1", "payments", KindVulnerability, "HIGH")); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("concurrent upsert: %v", err)
+	}
+	open, err := s.GetOpenVulnerabilities(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(open) != 1 {
+		t.Errorf("%d rows after concurrent upserts, want 1", len(open))
+	}
+}
+
+func testMarkFixed(t *testing.T, s Store) {
+	ctx := context.Background()
+	for _, id := range []string{"1", "2", "3"} {
+		mustUpsert(t, s, storeRecord(id, "payments", KindVulnerability, "HIGH"))
+	}
+	before := time.Now()
+
+	fixed, err := s.MarkFixed(ctx, nil, nil, []string{"2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := recordIDs(fixed); !reflect.DeepEqual(ids, []string{"1", "3"}) {
+		t.Fatalf("fixed = %v, want 1 and 3", ids)
+	}
+	for _, v := range fixed {
+		if v.State != StateFixed || v.FixedAt == nil || v.FixedAt.Before(before.Add(-time.Second)) || v.FirstSeen.IsZero() {
+			t.Errorf("fixed record %s = %s at %v, first seen %v", v.ID, v.State, v.FixedAt, v.FirstSeen)
+		}
+		if v.CVE != "CVE-2024-"+v.ID || v.Workload != "payments/deployment/app" || v.FixedVersion != "3.0.8" ||
+			v.ImageDigest != "sha256:aaa" || v.Exposure != "external" || v.Kind != KindVulnerability {
+			t.Errorf("fixed record %s lacks its details: %+v", v.ID, v)
+		}
+	}
+
+	if got := mustGet(t, s, "1"); got.State != StateFixed || got.FixedAt == nil {
+		t.Errorf("stored state = %s, fixed at %v", got.State, got.FixedAt)
+	}
+	open, err := s.GetOpenVulnerabilities(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := recordIDs(open); !reflect.DeepEqual(ids, []string{"2"}) {
+		t.Errorf("open = %v, want 2", ids)
+	}
+
+	// Already fixed: not reported again
+	if fixed, err := s.MarkFixed(ctx, nil, nil, []string{"2"}); err != nil || len(fixed) != 0 {
+		t.Errorf("second MarkFixed = %v, %v", recordIDs(fixed), err)
+	}
+}
+
+func testMarkFixedScoped(t *testing.T, s Store) {
+	ctx := context.Background()
+	mustUpsert(t, s, storeRecord("pay-vuln", "payments", KindVulnerability, "HIGH"))
+	mustUpsert(t, s, storeRecord("pay-secret", "payments", KindSecret, "HIGH"))
+	mustUpsert(t, s, storeRecord("shop-vuln", "shop", KindVulnerability, "HIGH"))
+	mustUpsert(t, s, storeRecord("cluster-vuln", "", KindVulnerability, "HIGH"))
+
+	// Only vulnerabilities in payments were scanned
+	fixed, err := s.MarkFixed(ctx, []string{"payments"}, []string{KindVulnerability}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := recordIDs(fixed); !reflect.DeepEqual(ids, []string{"pay-vuln"}) {
+		t.Errorf("scoped MarkFixed = %v, want pay-vuln", ids)
+	}
+
+	fixed, err = s.MarkFixed(ctx, []string{"payments", "shop"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := recordIDs(fixed); !reflect.DeepEqual(ids, []string{"pay-secret", "shop-vuln"}) {
+		t.Errorf("namespaces MarkFixed = %v", ids)
+	}
+
+	fixed, err = s.MarkFixed(ctx, nil, []string{KindVulnerability}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := recordIDs(fixed); !reflect.DeepEqual(ids, []string{"cluster-vuln"}) {
+		t.Errorf("unscoped MarkFixed = %v, want the cluster-scoped row", ids)
+	}
+}
+
+// More rows than fit in one MySQL IN list
+func testMarkFixedBatches(t *testing.T, s Store) {
+	ctx := context.Background()
+	n := mysqlBatchSize*2 + 10
+	var keep []string
+	for i := 0; i < n; i++ {
+		id := fmt.Sprintf("%04d", i)
+		mustUpsert(t, s, storeRecord(id, "payments", KindVulnerability, "HIGH"))
+		if i%100 == 0 {
+			keep = append(keep, id)
+		}
+	}
+
+	fixed, err := s.MarkFixed(ctx, nil, nil, keep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixed) != n-len(keep) {
+		t.Errorf("fixed %d, want %d", len(fixed), n-len(keep))
+	}
+	stats, err := s.GetStats(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.TotalOpen != len(keep) || stats.TotalFixed != n-len(keep) {
+		t.Errorf("stats = %d open, %d fixed", stats.TotalOpen, stats.TotalFixed)
+	}
+
+	// Sync in batches too
+	var ids []string
+	for i := 0; i < n; i++ {
+		ids = append(ids, fmt.Sprintf("%04d", i))
+	}
+	if err := s.MarkSaasSynced(ctx, ids); err != nil {
+		t.Fatal(err)
+	}
+	if unsynced, err := s.GetUnsyncedVulnerabilities(ctx); err != nil || len(unsynced) != 0 {
+		t.Errorf("unsynced after syncing all = %d, %v", len(unsynced), err)
+	}
+}
+
+// Timestamps keep sub-second precision, so time to fix of fast fixes and
+// the order of vulnerabilities found in one poll survive a round trip
+func testTimestampPrecision(t *testing.T, s Store) {
+	mustUpsert(t, s, storeRecord("1", "payments", KindVulnerability, "HIGH"))
+	fixed, err := s.MarkFixed(context.Background(), nil, nil, nil)
+	if err != nil || len(fixed) != 1 {
+		t.Fatalf("MarkFixed = %v, %v", recordIDs(fixed), err)
+	}
+
+	got := mustGet(t, s, "1")
+	if got.FixedAt == nil {
+		t.Fatal("fixed_at not stored")
+	}
+	if d := got.FixedAt.Sub(*fixed[0].FixedAt); d < -time.Microsecond || d > time.Microsecond {
+		t.Errorf("stored fixed_at %v differs from the returned %v by %v", got.FixedAt, fixed[0].FixedAt, d)
+	}
+	if got.FixedAt.Sub(got.FirstSeen) < 0 {
+		t.Errorf("fixed_at %v before first_seen %v", got.FixedAt, got.FirstSeen)
+	}
+}
+
+// Rows fixed exactly at the cutoff are kept; only older ones are pruned
+func testPruneFixed(t *testing.T, s Store) {
+	ctx := context.Background()
+	mustUpsert(t, s, storeRecord("fixed", "payments", KindVulnerability, "HIGH"))
+	if _, err := s.MarkFixed(ctx, nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	mustUpsert(t, s, storeRecord("open", "payments", KindVulnerability, "HIGH"))
+	fixedAt := *mustGet(t, s, "fixed").FixedAt
+
+	for _, cutoff := range []time.Time{fixedAt.Add(-time.Hour), fixedAt} {
+		if n, err := s.PruneFixed(ctx, cutoff); err != nil || n != 0 {
+			t.Errorf("PruneFixed(fixed_at%+v) = %d, %v, want nothing pruned", cutoff.Sub(fixedAt), n, err)
+		}
+	}
+	if n, err := s.PruneFixed(ctx, fixedAt.Add(time.Microsecond)); err != nil || n != 1 {
+		t.Errorf("PruneFixed(just after fixed_at) = %d, %v, want 1", n, err)
+	}
+	if v, err := s.GetVulnerability(ctx, "fixed"); err != nil || v != nil {
+		t.Errorf("pruned row = %v, %v", v, err)
+	}
+
+	// Open rows are never pruned, however old
+	if n, err := s.PruneFixed(ctx, time.Now().Add(24*time.Hour)); err != nil || n != 0 {
+		t.Errorf("PruneFixed(tomorrow) = %d, %v", n, err)
+	}
+	mustGet(t, s, "open")
+}
+
+// setTimes moves a fixed vulnerability's first_seen and fixed_at, which the
+// stores otherwise set to the current time
+func setTimes(t *testing.T, s Store, id string, firstSeen, fixedAt time.Time) {
+	t.Helper()
+	switch s := s.(type) {
+	case *MemoryStore:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		r := s.vulns[id]
+		r.FirstSeen, r.FixedAt = firstSeen, &fixedAt
+	case *DB:
+		if _, err := s.exec(context.Background(), "UPDATE vulnerabilities SET first_seen = $1, fixed_at = $2 WHERE id = $3", firstSeen, fixedAt, id); err != nil {
+			t.Fatal(err)
+		}
+	default:
+		t.Fatalf("setTimes: unsupported store %T", s)
+	}
+}
+
+func testMTTR(t *testing.T, s Store) {
+	ctx := context.Background()
+	for id, sev := range map[string]string{"c1": "CRITICAL", "c2": "CRITICAL", "h1": "HIGH", "open": "LOW"} {
+		mustUpsert(t, s, storeRecord(id, "payments", KindVulnerability, sev))
+	}
+	if _, err := s.MarkFixed(ctx, nil, nil, []string{"open"}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	day := 24 * time.Hour
+	setTimes(t, s, "c1", now.Add(-4*day-6*time.Hour), now.Add(-time.Hour)) // 4d 5h
+	setTimes(t, s, "c2", now.Add(-2*day), now.Add(-2*time.Hour))           // 1d 22h
+	setTimes(t, s, "h1", now.Add(-40*day), now.Add(-35*day))               // Outside the window
+
+	stats, err := s.GetStats(ctx, 30*day)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats.MTTR) != 1 {
+		t.Fatalf("MTTR = %v, want CRITICAL only", stats.MTTR)
+	}
+	m := stats.MTTR["CRITICAL"]
+	if want := 73*time.Hour + 30*time.Minute; m.Count != 2 || (m.Mean-want).Abs() > time.Second {
+		t.Errorf("MTTR[CRITICAL] = %d, %v, want 2, %v", m.Count, m.Mean, want)
+	}
+
+	// The window starts at fixed_at, not first_seen
+	stats, err = s.GetStats(ctx, 90*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := stats.MTTR["CRITICAL"]; m.Count != 1 || (m.Mean-101*time.Hour).Abs() > time.Second {
+		t.Errorf("MTTR[CRITICAL] over 90m = %d, %v, want 1, 101h", m.Count, m.Mean)
+	}
+	if stats.TotalOpen != 1 || stats.TotalFixed != 3 {
+		t.Errorf("totals = %d open, %d fixed", stats.TotalOpen, stats.TotalFixed)
+	}
+}
+
+func testSaasSync(t *testing.T, s Store) {
+	ctx := context.Background()
+	for _, id := range []string{"1", "2", "3"} {
+		mustUpsert(t, s, storeRecord(id, "payments", KindVulnerability, "HIGH"))
+		time.Sleep(2 * time.Millisecond) // Distinct first_seen for the order
+	}
+
+	unsynced, err := s.GetUnsyncedVulnerabilities(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var order []string
+	for _, v := range unsynced {
+		order = append(order, v.ID)
+	}
+	if strings.Join(order, ",") != "1,2,3" {
+		t.Errorf("unsynced = %v, want oldest first", order)
+	}
+
+	if err := s.MarkSaasSynced(ctx, []string{"1", "3", "missing"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.MarkSaasSynced(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	unsynced, err = s.GetUnsyncedVulnerabilities(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := recordIDs(unsynced); !reflect.DeepEqual(ids, []string{"2"}) {
+		t.Errorf("unsynced = %v, want 2", ids)
+	}
+}
+
+func testStats(t *testing.T, s Store) {
+	ctx := context.Background()
+	mustUpsert(t, s, storeRecord("1", "payments", KindVulnerability, "CRITICAL"))
+	mustUpsert(t, s, storeRecord("2", "payments", KindVulnerability, "HIGH"))
+	mustUpsert(t, s, storeRecord("3", "payments", KindVulnerability, "HIGH"))
+	mustUpsert(t, s, storeRecord("4", "payments", KindVulnerability, "LOW"))
+	if _, err := s.MarkFixed(ctx, nil, nil, []string{"1", "2", "3"}); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := s.GetStats(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.TotalOpen != 3 || stats.TotalFixed != 1 {
+		t.Errorf("totals = %d open, %d fixed", stats.TotalOpen, stats.TotalFixed)
+	}
+	if want := map[string]int{"CRITICAL": 1, "HIGH": 2}; !reflect.DeepEqual(stats.BySeverity, want) {
+		t.Errorf("BySeverity = %v, want %v", stats.BySeverity, want)
+	}
+	if len(stats.MTTR) != 0 {
+		t.Errorf("MTTR without a window = %v", stats.MTTR)
+	}
+
+	// Open vulnerabilities come most severe first
+	open, err := s.GetOpenVulnerabilities(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var severities []string
+	for _, v := range open {
+		severities = append(severities, v.Severity)
+	}
+	if strings.Join(severities, ",") != "CRITICAL,HIGH,HIGH" {
+		t.Errorf("open severities = %v", severities)
+	}
+}
+
+func TestMySQLDSN(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		// UTC is the driver default, so loc is left out
+		{"mysql://trix:s3cret@db:3306/trix", "trix:s3cret@tcp(db:3306)/trix?parseTime=true"},
+		{"mysql://trix@db/trix", "trix@tcp(db:3306)/trix?parseTime=true"},
+		{"mysql://trix:pw@db/trix?tls=true&charset=utf8mb4", "trix:pw@tcp(db:3306)/trix?parseTime=true&tls=true&charset=utf8mb4"},
+	}
+	for _, tt := range tests {
+		got, err := mysqlDSN(tt.url)
+		if err != nil {
+			t.Errorf("mysqlDSN(%s): %v", tt.url, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("mysqlDSN(%s) = %s, want %s", tt.url, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"mysql://trix@db", "mysql://trix@db/", "mysql://%zz"} {
+		if _, err := mysqlDSN(bad); err == nil || !strings.HasPrefix(err.Error(), "invalid MySQL URL") {
+			t.Errorf("mysqlDSN(%s) err = %v", bad, err)
+		}
+	}
+}
+
+func TestRebind(t *testing.T) {
+	query := "UPDATE v SET state = $1, fixed_at = $2, last_seen = $2 WHERE id = $3 AND price > $10"
+	args := []interface{}{"FIXED", "now", "id", 4, 5, 6, 7, 8, 9, "ten"}
+
+	postgres := &DB{dialect: dialectPostgres}
+	if q, a := postgres.rebind(query, args); q != query || !reflect.DeepEqual(a, args) {
+		t.Errorf("postgres rebind changed the query: %s %v", q, a)
+	}
+
+	mysql := &DB{dialect: dialectMySQL}
+	q, a := mysql.rebind(query, args)
+	if want := "UPDATE v SET state = ?, fixed_at = ?, last_seen = ? WHERE id = ? AND price > ?"; q != want {
+		t.Errorf("mysql query = %s, want %s", q, want)
+	}
+	if want := []interface{}{"FIXED", "now", "now", "id", "ten"}; !reflect.DeepEqual(a, want) {
+		t.Errorf("mysql args = %v, want %v", a, want)
+	}
+
+	// Dollars that are not placeholders are kept
+	if q, _ := mysql.rebind("SELECT '$' || $1, $0, $99", []interface{}{"x"}); q != "SELECT '$' || ?, $0, $99" {
+		t.Errorf("mysql query = %s", q)
+	}
+}
+
+func TestInList(t *testing.T) {
+	placeholders, args := inList([]string{"a", "b", "c"})
+	if placeholders != "?, ?, ?" || !reflect.DeepEqual(args, []interface{}{"a", "b", "c"}) {
+		t.Errorf("inList = %q, %v", placeholders, args)
+	}
+}
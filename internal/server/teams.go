@@ -0,0 +1,176 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Adaptive Card container styles used as severity accents
+const (
+	teamsStyleAttention = "attention" // red
+	teamsStyleWarning   = "warning"   // orange/yellow
+	teamsStyleGood      = "good"      // green
+	teamsStyleDefault   = "default"
+)
+
+// teamsSeverityStyle picks a container style for the highest severity present
+func teamsSeverityStyle(counts map[string]int) string {
+	switch {
+	case counts["CRITICAL"] > 0:
+		return teamsStyleAttention
+	case counts["HIGH"] > 0, counts["MEDIUM"] > 0:
+		return teamsStyleWarning
+	default:
+		return teamsStyleDefault
+	}
+}
+
+// teamsMessage wraps Adaptive Card body elements in the message envelope
+// expected by Teams incoming webhooks and Workflows.
+func teamsMessage(body []map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "message",
+		"attachments": []map[string]interface{}{
+			{
+				"contentType": "application/vnd.microsoft.card.adaptive",
+				"content": map[string]interface{}{
+					"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+					"type":    "AdaptiveCard",
+					"version": "1.4",
+					"msteams": map[string]interface{}{"width": "Full"},
+					"body":    body,
+				},
+			},
+		},
+	}
+}
+
+// teamsSection is a styled container with a title and text blocks
+func teamsSection(style, title string, lines []string) map[string]interface{} {
+	items := []map[string]interface{}{
+		{"type": "TextBlock", "text": title, "weight": "Bolder", "size": "Medium", "wrap": true},
+	}
+	for _, line := range lines {
+		items = append(items, map[string]interface{}{"type": "TextBlock", "text": line, "wrap": true, "spacing": "Small"})
+	}
+	return map[string]interface{}{
+		"type":  "Container",
+		"style": style,
+		"bleed": true,
+		"items": items,
+	}
+}
+
+// teamsPayload builds the per-poll card: image changes, then new
+// vulnerabilities grouped by workload, accented by the highest severity,
+// followed by rescored and fixed ones.
+func teamsPayload(events []VulnerabilityEvent) map[string]interface{} {
+	imageEvents := filterByType(events, "IMAGE_CHANGED")
+	newEvents := filterByType(events, "NEW")
+	changedEvents := filterByType(events, "SEVERITY_CHANGED")
+	fixedEvents := filterByType(events, "FIXED")
+
+	var body []map[string]interface{}
+
+	if len(imageEvents) > 0 {
+		var lines []string
+		for _, e := range imageEvents {
+			lines = append(lines, imageChangeText(e))
+		}
+		body = append(body, teamsSection(
+			teamsStyleDefault,
+			fmt.Sprintf("Images changed (%d)", len(imageEvents)),
+			lines,
+		))
+	}
+
+	if len(newEvents) > 0 {
+		grouped := groupByWorkload(newEvents)
+		var lines []string
+		for _, workload := range sortedWorkloads(grouped) {
+			lines = append(lines, fmt.Sprintf("**%s**  \n%s", workload, severitySummary(countBySeverity(grouped[workload]))))
+		}
+		body = append(body, teamsSection(
+			teamsSeverityStyle(countBySeverity(newEvents)),
+			fmt.Sprintf("New %s (%d)", wording(newEvents).title, len(newEvents)),
+			lines,
+		))
+	}
+
+	if len(changedEvents) > 0 {
+		grouped := groupByWorkload(changedEvents)
+		var lines []string
+		for _, workload := range sortedWorkloads(grouped) {
+			var changes []string
+			for _, e := range grouped[workload] {
+				changes = append(changes, fmt.Sprintf("%s %s", findingText(e), severityChange(e)))
+			}
+			lines = append(lines, fmt.Sprintf("**%s**  \n%s", workload, strings.Join(changes, "  \n")))
+		}
+		body = append(body, teamsSection(
+			teamsSeverityStyle(countBySeverity(changedEvents)),
+			fmt.Sprintf("Severity changed (%d)", len(changedEvents)),
+			lines,
+		))
+	}
+
+	if len(fixedEvents) > 0 {
+		grouped := groupByWorkload(fixedEvents)
+		var lines []string
+		for _, workload := range sortedWorkloads(grouped) {
+			group := grouped[workload]
+			lines = append(lines, fmt.Sprintf("**%s**: %d %s", workload, len(group), wording(group).short))
+		}
+		body = append(body, teamsSection(
+			teamsStyleGood,
+			fmt.Sprintf("Fixed %s (%d)", wording(fixedEvents).title, len(fixedEvents)),
+			lines,
+		))
+	}
+
+	return teamsMessage(body)
+}
+
+// teamsSummaryPayload builds the card sent after the first poll.
+func teamsSummaryPayload(events []VulnerabilityEvent) map[string]interface{} {
+	counts := countBySeverity(events)
+
+	style := teamsSeverityStyle(counts)
+	if len(events) == 0 {
+		style = teamsStyleGood
+	}
+
+	facts := []map[string]interface{}{}
+	for _, s := range []struct{ key, title string }{
+		{"CRITICAL", "Critical"},
+		{"HIGH", "High"},
+		{"MEDIUM", "Medium"},
+		{"LOW", "Low"},
+	} {
+		if c := counts[s.key]; c > 0 {
+			facts = append(facts, map[string]interface{}{"title": s.title, "value": fmt.Sprintf("%d", c)})
+		}
+	}
+
+	section := teamsSection(style, "trix initialized", []string{
+		fmt.Sprintf("Found **%d** %s", len(events), wording(events).plural),
+	})
+	body := []map[string]interface{}{section}
+	if len(facts) > 0 {
+		body = append(body, map[string]interface{}{"type": "FactSet", "facts": facts})
+	}
+	body = append(body, map[string]interface{}{
+		"type": "TextBlock", "text": "Monitoring started", "isSubtle": true, "size": "Small", "wrap": true,
+	})
+
+	return teamsMessage(body)
+}
+
+func (n *Notifier) sendTeams(ctx context.Context, events []VulnerabilityEvent) error {
+	return n.postJSON(ctx, n.config.TeamsWebhook, teamsPayload(events))
+}
+
+func (n *Notifier) sendTeamsSummary(ctx context.Context, events []VulnerabilityEvent) error {
+	return n.postJSON(ctx, n.config.TeamsWebhook, teamsSummaryPayload(events))
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// teamsEvents covers every event type Teams shows
+func teamsEvents() []VulnerabilityEvent {
+	seen := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	fixedAt := seen.Add(72 * time.Hour)
+	return []VulnerabilityEvent{
+		{ID: "i1", Type: "IMAGE_CHANGED", Workload: "prod/deployment/api", ContainerName: "api",
+			ImageRepository: "example/api", ImageTag: "v2", ImageDigest: "sha256:bbbbbbbbbbbbbbbb", OldImageDigest: "sha256:aaaaaaaaaaaaaaaa", Added: 1, Removed: 2},
+		{ID: "n1", Type: "NEW", Kind: KindVulnerability, CVE: "CVE-2024-0001", Workload: "prod/deployment/api", Severity: "CRITICAL", Image: "openssl:3.0.1", FirstSeen: seen},
+		{ID: "n2", Type: "NEW", Kind: KindVulnerability, CVE: "CVE-2024-0002", Workload: "prod/deployment/api", Severity: "HIGH", Image: "zlib:1.2", FirstSeen: seen},
+		{ID: "n3", Type: "NEW", Kind: KindVulnerability, CVE: "CVE-2024-0003", Workload: "dev/deployment/web", Severity: "LOW", Image: "curl:8.0", FirstSeen: seen},
+		{ID: "s1", Type: "SEVERITY_CHANGED", Kind: KindVulnerability, CVE: "CVE-2023-0009", Workload: "prod/deployment/db", Severity: "HIGH", OldSeverity: "MEDIUM", Image: "glibc:2.36", FirstSeen: seen},
+		{ID: "f1", Type: "FIXED", Kind: KindVulnerability, CVE: "CVE-2023-0001", Workload: "prod/deployment/api", Severity: "MEDIUM", Image: "libxml2:2.9", FirstSeen: seen, FixedAt: &fixedAt},
+		{ID: "f2", Type: "FIXED", Kind: KindVulnerability, CVE: "CVE-2023-0002", Workload: "prod/deployment/api", Severity: "LOW", Image: "libxml2:2.9", FirstSeen: seen, FixedAt: &fixedAt},
+	}
+}
+
+func teamsJSON(t *testing.T, payload map[string]interface{}) []byte {
+	t.Helper()
+	data, err := json.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(data, '\n')
+}
+
+func TestTeamsPayloadGolden(t *testing.T) {
+	events := teamsEvents()
+	tests := []struct {
+		name   string
+		events []VulnerabilityEvent
+	}{
+		{"teams_poll.json", events},
+		{"teams_poll_fixed_only.json", filterByType(events, "FIXED")},
+		{"teams_poll_low_only.json", filterByType(events, "NEW")[2:]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			golden(t, tt.name, teamsJSON(t, teamsPayload(tt.events)))
+		})
+	}
+}
+
+func TestTeamsSummaryPayloadGolden(t *testing.T) {
+	golden(t, "teams_summary.json", teamsJSON(t, teamsSummaryPayload(filterByType(teamsEvents(), "NEW"))))
+	golden(t, "teams_summary_empty.json", teamsJSON(t, teamsSummaryPayload(nil)))
+}
+
+func TestTeamsSeverityStyle(t *testing.T) {
+	tests := []struct {
+		counts map[string]int
+		want   string
+	}{
+		{map[string]int{"CRITICAL": 1, "LOW": 3}, teamsStyleAttention},
+		{map[string]int{"HIGH": 1}, teamsStyleWarning},
+		{map[string]int{"MEDIUM": 2}, teamsStyleWarning},
+		{map[string]int{"LOW": 5, "UNKNOWN": 1}, teamsStyleDefault},
+		{map[string]int{}, teamsStyleDefault},
+	}
+	for _, tt := range tests {
+		if got := teamsSeverityStyle(tt.counts); got != tt.want {
+			t.Errorf("teamsSeverityStyle(%v) = %q, want %q", tt.counts, got, tt.want)
+		}
+	}
+}
+
+// Notify applies TRIX_TEAMS_SEVERITY before building the card
+func TestTeamsNotifySeverity(t *testing.T) {
+	srv, received := stubReceiver(t, http.StatusOK)
+	n := testNotifier(t, map[string]string{
+		"TRIX_NOTIFY_TEAMS":   srv.URL,
+		"TRIX_TEAMS_SEVERITY": "HIGH",
+	})
+
+	res := n.Notify(context.Background(), filterByType(teamsEvents(), "NEW"))
+	if len(res.Deliveries) != 1 || res.Deliveries[0].Channel != channelTeams {
+		t.Fatalf("deliveries = %+v, want one for teams", res.Deliveries)
+	}
+	if d := res.Deliveries[0]; d.Err != nil || len(d.Delivered) != 2 {
+		t.Fatalf("teams delivered %d events (err %v), want the 2 HIGH or above", len(d.Delivered), d.Err)
+	}
+	reqs := received()
+	if len(reqs) != 1 {
+		t.Fatalf("received %d requests, want 1", len(reqs))
+	}
+	body := string(reqs[0].body)
+	if !strings.Contains(body, "prod/deployment/api") || strings.Contains(body, "dev/deployment/web") {
+		t.Errorf("card does not match the severity filter: %s", body)
+	}
+
+	// Only LOW events: nothing to send
+	res = n.Notify(context.Background(), filterByType(teamsEvents(), "NEW")[2:])
+	if len(res.Deliveries) != 0 || len(received()) != 1 {
+		t.Errorf("LOW events were sent to teams: %+v", res.Deliveries)
+	}
+}
+
+func TestTeamsDeliveryError(t *testing.T) {
+	srv, _ := stubReceiver(t, http.StatusBadGateway)
+	n := testNotifier(t, map[string]string{"TRIX_NOTIFY_TEAMS": srv.URL})
+
+	events := filterByType(teamsEvents(), "NEW")
+	res := n.Deliver(context.Background(), channelTeams, events)
+	if res.Err == nil || !strings.Contains(res.Err.Error(), "status 502") {
+		t.Errorf("err = %v, want status 502", res.Err)
+	}
+	if len(res.Failed) != len(events) || len(res.Delivered) != 0 {
+		t.Errorf("failed/delivered = %d/%d, want %d/0", len(res.Failed), len(res.Delivered), len(events))
+	}
+}
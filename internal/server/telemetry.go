@@ -0,0 +1,238 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/metric"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+)
+
+// instrumentationName identifies trix's spans, log records and metrics
+const instrumentationName = "github.com/trixsec-dev/trix/internal/server"
+
+// noopTracer is used when TRIX_OTEL_ENDPOINT is unset; its spans record nothing
+var noopTracer trace.Tracer = tracenoop.NewTracerProvider().Tracer(instrumentationName)
+
+// telemetry holds the OpenTelemetry providers exporting to TRIX_OTEL_ENDPOINT.
+type telemetry struct {
+	tracer   trace.Tracer
+	events   otellog.Logger // Emits VulnerabilityEvents as log records, nil = disabled
+	shutdown []func(context.Context) error
+
+	// Counters, nil = disabled
+	prunedFixed         metric.Int64Counter
+	deliveriesAbandoned metric.Int64Counter
+}
+
+// parseOTelEndpoint validates TRIX_OTEL_ENDPOINT, the base URL of an OTLP/HTTP
+// receiver such as http://otel-collector:4318.
+func parseOTelEndpoint(v string) (*url.URL, error) {
+	u, err := url.Parse(v)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%q is not an http(s) URL", v)
+	}
+	return u, nil
+}
+
+// newTelemetry sets up trace, log and metric export, or returns a no-op telemetry
+// when no endpoint is configured.
+func newTelemetry(ctx context.Context, config *Config) (*telemetry, error) {
+	if config.OTelEndpoint == nil {
+		return &telemetry{tracer: noopTracer}, nil
+	}
+
+	attrs := []attribute.KeyValue{attribute.String("service.name", "trix")}
+	if config.ClusterName != "" {
+		attrs = append(attrs, attribute.String("k8s.cluster.name", config.ClusterName))
+	}
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override the defaults
+	res, err := resource.New(ctx, resource.WithAttributes(attrs...), resource.WithFromEnv(), resource.WithTelemetrySDK())
+	if err != nil {
+		return nil, fmt.Errorf("otel resource: %w", err)
+	}
+
+	base := strings.TrimSuffix(config.OTelEndpoint.String(), "/")
+	traceExporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(base+"/v1/traces"))
+	if err != nil {
+		return nil, fmt.Errorf("otel trace exporter: %w", err)
+	}
+	logExporter, err := otlploghttp.New(ctx, otlploghttp.WithEndpointURL(base+"/v1/logs"))
+	if err != nil {
+		_ = traceExporter.Shutdown(ctx)
+		return nil, fmt.Errorf("otel log exporter: %w", err)
+	}
+	metricExporter, err := otlpmetrichttp.New(ctx, otlpmetrichttp.WithEndpointURL(base+"/v1/metrics"))
+	if err != nil {
+		_ = traceExporter.Shutdown(ctx)
+		_ = logExporter.Shutdown(ctx)
+		return nil, fmt.Errorf("otel metric exporter: %w", err)
+	}
+
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(traceExporter), sdktrace.WithResource(res))
+	loggerProvider := sdklog.NewLoggerProvider(sdklog.WithProcessor(sdklog.NewBatchProcessor(logExporter)), sdklog.WithResource(res))
+	meterProvider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter)), sdkmetric.WithResource(res))
+	t := &telemetry{
+		tracer:   tracerProvider.Tracer(instrumentationName),
+		events:   loggerProvider.Logger(instrumentationName),
+		shutdown: []func(context.Context) error{tracerProvider.Shutdown, loggerProvider.Shutdown, meterProvider.Shutdown},
+	}
+	if err := t.initMetrics(meterProvider.Meter(instrumentationName)); err != nil {
+		_ = t.close(ctx)
+		return nil, fmt.Errorf("otel metrics: %w", err)
+	}
+	return t, nil
+}
+
+// initMetrics creates trix's counters on meter.
+func (t *telemetry) initMetrics(meter metric.Meter) error {
+	var err error
+	t.prunedFixed, err = meter.Int64Counter("trix.pruned.fixed",
+		metric.WithDescription("FIXED vulnerabilities deleted after TRIX_RETENTION_FIXED"),
+		metric.WithUnit("{vulnerability}"))
+	if err != nil {
+		return err
+	}
+	t.deliveriesAbandoned, err = meter.Int64Counter("trix.deliveries.abandoned",
+		metric.WithDescription("Notifications given up on after TRIX_DELIVERY_MAX_ATTEMPTS"),
+		metric.WithUnit("{notification}"))
+	return err
+}
+
+// addPrunedFixed counts FIXED vulnerabilities deleted by retention pruning.
+func (t *telemetry) addPrunedFixed(ctx context.Context, n int64) {
+	if t.prunedFixed != nil {
+		t.prunedFixed.Add(ctx, n)
+	}
+}
+
+// addDeliveriesAbandoned counts notifications to channel that ran out of attempts.
+func (t *telemetry) addDeliveriesAbandoned(ctx context.Context, channel string, n int64) {
+	if t.deliveriesAbandoned != nil {
+		t.deliveriesAbandoned.Add(ctx, n, metric.WithAttributes(attribute.String("trix.channel", channel)))
+	}
+}
+
+// close flushes pending spans and log records.
+func (t *telemetry) close(ctx context.Context) error {
+	var errs []error
+	for _, shutdown := range t.shutdown {
+		errs = append(errs, shutdown(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+// emitEvents exports each event as an OTLP log record.
+func (t *telemetry) emitEvents(ctx context.Context, events []VulnerabilityEvent) {
+	if t.events == nil {
+		return
+	}
+	now := time.Now()
+	for _, e := range events {
+		var r otellog.Record
+		r.SetEventName("trix.finding." + strings.ToLower(e.Type))
+		r.SetTimestamp(now)
+		r.SetObservedTimestamp(now)
+		r.SetSeverity(otelSeverity(e.Severity))
+		r.SetSeverityText(e.Severity)
+		body := fmt.Sprintf("%s %s in %s", e.Type, findingText(e), e.Workload)
+		if e.Type == "IMAGE_CHANGED" {
+			body = "IMAGE_CHANGED " + imageChangeText(e)
+		}
+		r.SetBody(otellog.StringValue(body))
+
+		namespace, _, _ := strings.Cut(e.Workload, "/")
+		r.AddAttributes(
+			otellog.String("trix.event.id", e.ID),
+			otellog.String("trix.event.type", e.Type),
+			otellog.String("trix.finding.kind", e.kind()),
+			otellog.String("trix.finding.id", e.CVE),
+			otellog.String("trix.workload", e.Workload),
+			otellog.String("k8s.namespace.name", namespace),
+			otellog.Int64("trix.first_seen", e.FirstSeen.Unix()),
+		)
+		for _, kv := range []struct{ key, value string }{
+			{"trix.finding.title", e.Title},
+			{"trix.finding.old_severity", e.OldSeverity},
+			{"trix.package", e.Image},
+			{"trix.fixed_version", e.FixedVersion},
+			{"trix.exposure", e.Exposure},
+			{"k8s.container.name", e.ContainerName},
+			{"container.image.name", e.ImageRepository},
+			{"container.image.tag", e.ImageTag},
+			{"container.image.id", e.ImageDigest},
+			{"trix.old_image_digest", e.OldImageDigest},
+		} {
+			if kv.value != "" {
+				r.AddAttributes(otellog.String(kv.key, kv.value))
+			}
+		}
+		if e.FixedAt != nil {
+			r.AddAttributes(otellog.Int64("trix.fixed_at", e.FixedAt.Unix()))
+		}
+		if e.TimeToFix > 0 {
+			r.AddAttributes(otellog.Int64("trix.time_to_fix_seconds", e.TimeToFix))
+		}
+		if e.Type == "IMAGE_CHANGED" {
+			r.AddAttributes(otellog.Int("trix.image.added", e.Added), otellog.Int("trix.image.removed", e.Removed))
+		}
+		t.events.Emit(ctx, r)
+	}
+}
+
+// otelSeverity maps a Trivy severity onto the OTel log severity scale
+func otelSeverity(severity string) otellog.Severity {
+	switch strings.ToUpper(severity) {
+	case "CRITICAL":
+		return otellog.SeverityFatal
+	case "HIGH":
+		return otellog.SeverityError
+	case "MEDIUM":
+		return otellog.SeverityWarn
+	default: // LOW, UNKNOWN
+		return otellog.SeverityInfo
+	}
+}
+
+// startSpan starts a span for a send of events to channel
+func (n *Notifier) startSpan(ctx context.Context, name, channel string, events int) (context.Context, trace.Span) {
+	return n.tracer.Start(ctx, name, trace.WithAttributes(
+		attribute.String("trix.channel", channel),
+		attribute.Int("trix.events", events),
+	))
+}
+
+// traceSend runs send in a span, recording its error
+func (n *Notifier) traceSend(ctx context.Context, name, channel string, events int, send func(context.Context) error) error {
+	ctx, span := n.startSpan(ctx, name, channel, events)
+	err := send(ctx)
+	endSpan(span, err)
+	return err
+}
+
+// endSpan records err on span, if any, and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
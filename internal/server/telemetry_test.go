@@ -0,0 +1,369 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8stesting "k8s.io/client-go/testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	otellog "go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// spanRecorder returns a tracer whose ended spans are kept in memory
+func spanRecorder() (trace.Tracer, *tracetest.SpanRecorder) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	return tp.Tracer(instrumentationName), sr
+}
+
+// meteredTelemetry returns a telemetry whose counters are read by reader
+func meteredTelemetry(t *testing.T) (*telemetry, *sdkmetric.ManualReader) {
+	t.Helper()
+	reader := sdkmetric.NewManualReader()
+	tel := &telemetry{tracer: noopTracer}
+	if err := tel.initMetrics(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter(instrumentationName)); err != nil {
+		t.Fatal(err)
+	}
+	return tel, reader
+}
+
+// counterValue sums the data points of the counter name, 0 if it has none
+func counterValue(t *testing.T, reader *sdkmetric.ManualReader, name string) int64 {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	var total int64
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if sum, ok := m.Data.(metricdata.Sum[int64]); ok && m.Name == name {
+				for _, dp := range sum.DataPoints {
+					total += dp.Value
+				}
+			}
+		}
+	}
+	return total
+}
+
+// spanAttrs returns a span's attributes by key
+func spanAttrs(s sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range s.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+// spansNamed returns the ended spans with name
+func spansNamed(sr *tracetest.SpanRecorder, name string) []sdktrace.ReadOnlySpan {
+	var out []sdktrace.ReadOnlySpan
+	for _, s := range sr.Ended() {
+		if s.Name() == name {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func TestPollSpans(t *testing.T) {
+	tracer, sr := spanRecorder()
+	cfg := testConfig(t, map[string]string{"TRIX_POLL_CONCURRENCY": "2"})
+	p := testPoller(cfg, NewMemoryStore(), fakeDynamic(fixtureReports(3)...))
+	p.tracer = tracer
+
+	if _, err := p.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll: %v", err)
+	}
+
+	polls := spansNamed(sr, "trix.poll")
+	if len(polls) != 1 {
+		t.Fatalf("got %d trix.poll spans, want 1", len(polls))
+	}
+	poll := polls[0]
+	if poll.Parent().IsValid() {
+		t.Error("trix.poll is not a root span")
+	}
+	if got := spanAttrs(poll)["trix.concurrency"].AsInt64(); got != 2 {
+		t.Errorf("trix.concurrency = %d, want 2", got)
+	}
+	if poll.Status().Code == codes.Error {
+		t.Errorf("trix.poll status = %v", poll.Status())
+	}
+
+	lists := spansNamed(sr, "trix.list_reports")
+	if len(lists) == 0 {
+		t.Fatal("no trix.list_reports spans")
+	}
+	reports := 0
+	for _, s := range lists {
+		if s.Parent().SpanID() != poll.SpanContext().SpanID() {
+			t.Errorf("trix.list_reports %v is not a child of trix.poll", spanAttrs(s)["trix.resource"])
+		}
+		if attrs := spanAttrs(s); attrs["trix.resource"].AsString() == "vulnerabilityreports" {
+			reports += int(attrs["trix.reports"].AsInt64())
+		}
+	}
+	if reports != 3 {
+		t.Errorf("trix.reports for vulnerabilityreports = %d, want 3", reports)
+	}
+
+	reconciles := spansNamed(sr, "trix.reconcile")
+	if len(reconciles) != 1 {
+		t.Fatalf("got %d trix.reconcile spans, want 1", len(reconciles))
+	}
+	r := reconciles[0]
+	if r.Parent().SpanID() != poll.SpanContext().SpanID() {
+		t.Error("trix.reconcile is not a child of trix.poll")
+	}
+	if got := spanAttrs(r)["trix.open"].AsInt64(); got != 9 {
+		t.Errorf("trix.open = %d, want 9", got)
+	}
+}
+
+func TestPollListSpanError(t *testing.T) {
+	tracer, sr := spanRecorder()
+	dyn := fakeDynamic(fixtureReports(1)...)
+	dyn.PrependReactor("list", "vulnerabilityreports", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "vulnerabilityreports"}, "", nil)
+	})
+	p := testPoller(testConfig(t, nil), NewMemoryStore(), dyn)
+	p.tracer = tracer
+
+	if _, err := p.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll: %v", err)
+	}
+	var failed int
+	for _, s := range spansNamed(sr, "trix.list_reports") {
+		if spanAttrs(s)["trix.resource"].AsString() != "vulnerabilityreports" {
+			continue
+		}
+		if s.Status().Code != codes.Error || !strings.Contains(s.Status().Description, "forbidden") {
+			t.Errorf("status = %+v, want the forbidden error", s.Status())
+		}
+		if len(s.Events()) == 0 || s.Events()[0].Name != "exception" {
+			t.Errorf("events = %+v, want the recorded error", s.Events())
+		}
+		failed++
+	}
+	if failed == 0 {
+		t.Error("no trix.list_reports span for vulnerabilityreports")
+	}
+}
+
+func TestNotifySpans(t *testing.T) {
+	tracer, sr := spanRecorder()
+	hook, _ := stubReceiver(t, http.StatusOK)
+	teams, _ := stubReceiver(t, http.StatusBadGateway)
+	n := testNotifier(t, map[string]string{
+		"TRIX_NOTIFY_WEBHOOK": hook.URL,
+		"TRIX_NOTIFY_TEAMS":   teams.URL,
+	})
+	n.tracer = tracer
+
+	ctx, parent := tracer.Start(context.Background(), "parent")
+	n.Notify(ctx, testEvents())
+	parent.End()
+
+	spans := spansNamed(sr, "trix.notify")
+	byChannel := make(map[string]sdktrace.ReadOnlySpan)
+	for _, s := range spans {
+		byChannel[spanAttrs(s)["trix.channel"].AsString()] = s
+		if s.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("%s span is not a child of the caller's span", s.Name())
+		}
+		if got := spanAttrs(s)["trix.events"].AsInt64(); got != 1 {
+			t.Errorf("trix.events = %d, want 1", got)
+		}
+	}
+	if len(spans) != 2 || byChannel[channelWebhook] == nil || byChannel[channelTeams] == nil {
+		t.Fatalf("trix.notify spans = %d (%v), want one per channel", len(spans), byChannel)
+	}
+	if s := byChannel[channelWebhook]; s.Status().Code == codes.Error {
+		t.Errorf("webhook span status = %+v, want no error", s.Status())
+	}
+	if s := byChannel[channelTeams]; s.Status().Code != codes.Error || !strings.Contains(s.Status().Description, "status 502") {
+		t.Errorf("teams span status = %+v, want the 502 error", s.Status())
+	}
+}
+
+// logRecorder is an in-memory log exporter
+type logRecorder struct {
+	mu      sync.Mutex
+	records []sdklog.Record
+}
+
+func (r *logRecorder) Export(ctx context.Context, records []sdklog.Record) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, rec := range records {
+		r.records = append(r.records, rec.Clone())
+	}
+	return nil
+}
+
+func (r *logRecorder) Shutdown(context.Context) error   { return nil }
+func (r *logRecorder) ForceFlush(context.Context) error { return nil }
+
+// logAttrs returns a record's attributes by key
+func logAttrs(r sdklog.Record) map[string]otellog.Value {
+	attrs := make(map[string]otellog.Value)
+	r.WalkAttributes(func(kv otellog.KeyValue) bool {
+		attrs[kv.Key] = kv.Value
+		return true
+	})
+	return attrs
+}
+
+func TestEmitEvents(t *testing.T) {
+	exporter := &logRecorder{}
+	provider := sdklog.NewLoggerProvider(sdklog.WithProcessor(sdklog.NewSimpleProcessor(exporter)))
+	tel := &telemetry{tracer: noopTracer, events: provider.Logger(instrumentationName)}
+
+	events := teamsEvents()
+	for i := range events {
+		if events[i].ID == "f1" {
+			events[i].TimeToFix = timeToFix(events[i].FirstSeen, events[i].FixedAt)
+		}
+	}
+	tel.emitEvents(context.Background(), events)
+	if len(exporter.records) != len(events) {
+		t.Fatalf("got %d log records, want %d", len(exporter.records), len(events))
+	}
+
+	byID := make(map[string]sdklog.Record)
+	for _, r := range exporter.records {
+		byID[logAttrs(r)["trix.event.id"].AsString()] = r
+	}
+
+	n1 := byID["n1"]
+	if n1.EventName() != "trix.finding.new" {
+		t.Errorf("event name = %q, want trix.finding.new", n1.EventName())
+	}
+	if n1.Severity() != otellog.SeverityFatal || n1.SeverityText() != "CRITICAL" {
+		t.Errorf("severity = %v %q, want FATAL CRITICAL", n1.Severity(), n1.SeverityText())
+	}
+	if body := n1.Body().AsString(); !strings.HasPrefix(body, "NEW CVE-2024-0001") || !strings.HasSuffix(body, " in prod/deployment/api") {
+		t.Errorf("body = %q", body)
+	}
+	attrs := logAttrs(n1)
+	for key, want := range map[string]string{
+		"trix.event.type":    "NEW",
+		"trix.finding.kind":  KindVulnerability,
+		"trix.finding.id":    "CVE-2024-0001",
+		"trix.workload":      "prod/deployment/api",
+		"k8s.namespace.name": "prod",
+		"trix.package":       "openssl:3.0.1",
+	} {
+		if got := attrs[key].AsString(); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+	for _, key := range []string{"trix.exposure", "trix.fixed_at", "trix.finding.old_severity", "trix.image.added"} {
+		if _, ok := attrs[key]; ok {
+			t.Errorf("NEW record has %s", key)
+		}
+	}
+
+	if got := logAttrs(byID["s1"])["trix.finding.old_severity"].AsString(); got != "MEDIUM" {
+		t.Errorf("SEVERITY_CHANGED old severity = %q, want MEDIUM", got)
+	}
+	if r := byID["n3"]; r.Severity() != otellog.SeverityInfo {
+		t.Errorf("LOW severity = %v, want INFO", r.Severity())
+	}
+
+	fixed := logAttrs(byID["f1"])
+	if fixed["trix.fixed_at"].AsInt64() == 0 || fixed["trix.time_to_fix_seconds"].AsInt64() != 72*3600 {
+		t.Errorf("FIXED attributes = %v", fixed)
+	}
+
+	image := byID["i1"]
+	if image.EventName() != "trix.finding.image_changed" || !strings.HasPrefix(image.Body().AsString(), "IMAGE_CHANGED ") {
+		t.Errorf("image change = %q %q", image.EventName(), image.Body().AsString())
+	}
+	if a := logAttrs(image); a["trix.image.added"].AsInt64() != 1 || a["trix.image.removed"].AsInt64() != 2 {
+		t.Errorf("image change counts = %v", a)
+	}
+}
+
+// Without TRIX_OTEL_ENDPOINT nothing is recorded or exported
+func TestTelemetryDisabled(t *testing.T) {
+	tel, err := newTelemetry(context.Background(), testConfig(t, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tel.tracer != noopTracer || tel.events != nil {
+		t.Fatalf("telemetry = %+v, want the no-op tracer and no event logger", tel)
+	}
+	tel.emitEvents(context.Background(), teamsEvents())
+	if err := tel.close(context.Background()); err != nil {
+		t.Errorf("close: %v", err)
+	}
+
+	n := testNotifier(t, nil)
+	if _, span := n.startSpan(context.Background(), "trix.notify", channelSlack, 1); span.IsRecording() {
+		t.Error("span is recording without telemetry")
+	}
+}
+
+// Spans and events reach an OTLP/HTTP receiver when telemetry is closed
+func TestTelemetryExport(t *testing.T) {
+	var mu sync.Mutex
+	received := make(map[string]int)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		received[r.URL.Path+" "+r.Header.Get("Content-Type")]++
+		mu.Unlock()
+	}))
+	defer collector.Close()
+
+	cfg := testConfig(t, map[string]string{"TRIX_OTEL_ENDPOINT": collector.URL + "/"})
+	ctx := context.Background()
+	tel, err := newTelemetry(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, span := tel.tracer.Start(ctx, "trix.poll")
+	span.End()
+	tel.emitEvents(ctx, testEvents())
+	if err := tel.close(ctx); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, want := range []string{"/v1/traces application/x-protobuf", "/v1/logs application/x-protobuf"} {
+		if received[want] == 0 {
+			t.Errorf("collector received %v, want %s", received, want)
+		}
+	}
+}
+
+func TestOTelEndpointRejectedAtLoad(t *testing.T) {
+	for _, v := range []string{"otel-collector:4318", "grpc://collector:4317", "http://"} {
+		t.Run(v, func(t *testing.T) {
+			t.Setenv(ConfigFileEnv, "")
+			t.Setenv("TRIX_DATABASE_URL", "memory://")
+			t.Setenv("TRIX_OTEL_ENDPOINT", v)
+			if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "invalid TRIX_OTEL_ENDPOINT") {
+				t.Errorf("LoadConfig error = %v, want invalid TRIX_OTEL_ENDPOINT", err)
+			}
+		})
+	}
+}
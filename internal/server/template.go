@@ -0,0 +1,265 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Template files looked up in TRIX_TEMPLATE_DIR. Missing files keep the
+// built-in format for that channel.
+const (
+	slackTemplateFile   = "slack.tmpl"
+	webhookTemplateFile = "webhook.tmpl"
+	emailTemplateFile   = "email.tmpl"
+)
+
+// TemplateData is the context passed to notification templates.
+type TemplateData struct {
+	ClusterName  string
+	Timestamp    time.Time            // When the notification was rendered (UTC)
+	Events       []VulnerabilityEvent // All events, IMAGE_CHANGED, NEW, SEVERITY_CHANGED, FIXED, most severe first
+	ImageChanges []VulnerabilityEvent // IMAGE_CHANGED events, with their Added and Removed counts
+	New          []WorkloadEvents     // NEW events grouped by workload, sorted by workload
+	Changed      []WorkloadEvents     // SEVERITY_CHANGED events grouped by workload, sorted by workload
+	Fixed        []WorkloadEvents     // FIXED events grouped by workload, sorted by workload
+	NewCount     int
+	ChangedCount int
+	FixedCount   int
+	BySeverity   map[string]int // NEW events by severity
+	Batch        int            // Position of this request when events are split, from 1
+	Batches      int            // Number of requests the events were split into
+}
+
+// WorkloadEvents are the events of one workload.
+type WorkloadEvents struct {
+	Workload   string // namespace/kind/name
+	Namespace  string
+	Events     []VulnerabilityEvent // Most severe first
+	BySeverity map[string]int
+}
+
+// Templates holds the user-supplied notification templates. A nil field
+// means the channel uses its built-in format.
+type Templates struct {
+	Slack   *template.Template // Renders the Slack message text (mrkdwn)
+	Webhook *template.Template // Renders the webhook request body, which must be JSON
+	Email   *template.Template // Defines "subject", "text" and optionally "html"
+}
+
+// templateFuncs are available in every template
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"lower":   strings.ToLower,
+	"upper":   strings.ToUpper,
+	"join":    strings.Join,
+	"summary": severitySummary,
+	"duration": func(seconds int64) string {
+		return formatDuration(time.Duration(seconds) * time.Second)
+	},
+}
+
+// LoadTemplates parses the templates in dir and renders each with sample
+// data, so mistakes surface at startup instead of at notification time.
+func LoadTemplates(dir string) (*Templates, error) {
+	t := &Templates{}
+	for _, f := range []struct {
+		name string
+		dst  **template.Template
+	}{
+		{slackTemplateFile, &t.Slack},
+		{webhookTemplateFile, &t.Webhook},
+		{emailTemplateFile, &t.Email},
+	} {
+		path := filepath.Join(dir, f.name)
+		data, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		tmpl, err := template.New(f.name).Funcs(templateFuncs).Option("missingkey=error").Parse(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+		*f.dst = tmpl
+	}
+
+	if t.Email != nil && (t.Email.Lookup("subject") == nil || t.Email.Lookup("text") == nil) {
+		return nil, fmt.Errorf("%s must define the \"subject\" and \"text\" templates", filepath.Join(dir, emailTemplateFile))
+	}
+	if err := t.RenderSamples(io.Discard); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// newTemplateData groups events for templates.
+func newTemplateData(clusterName string, events []VulnerabilityEvent, now time.Time) TemplateData {
+	sorted := append([]VulnerabilityEvent(nil), events...)
+	sortEvents(sorted)
+
+	newEvents := filterByType(sorted, "NEW")
+	changedEvents := filterByType(sorted, "SEVERITY_CHANGED")
+	fixedEvents := filterByType(sorted, "FIXED")
+	return TemplateData{
+		ClusterName:  clusterName,
+		Timestamp:    now.UTC(),
+		Events:       sorted,
+		ImageChanges: filterByType(sorted, "IMAGE_CHANGED"),
+		New:          workloadEvents(newEvents),
+		Changed:      workloadEvents(changedEvents),
+		Fixed:        workloadEvents(fixedEvents),
+		NewCount:     len(newEvents),
+		ChangedCount: len(changedEvents),
+		FixedCount:   len(fixedEvents),
+		BySeverity:   countBySeverity(newEvents),
+		Batch:        1,
+		Batches:      1,
+	}
+}
+
+func workloadEvents(events []VulnerabilityEvent) []WorkloadEvents {
+	grouped := groupByWorkload(events)
+	result := make([]WorkloadEvents, 0, len(grouped))
+	for _, workload := range sortedWorkloads(grouped) {
+		group := grouped[workload]
+		sort.SliceStable(group, func(i, j int) bool {
+			return severityLevel(group[i].Severity) < severityLevel(group[j].Severity)
+		})
+		namespace, _, _ := strings.Cut(workload, "/")
+		result = append(result, WorkloadEvents{
+			Workload:   workload,
+			Namespace:  namespace,
+			Events:     group,
+			BySeverity: countBySeverity(group),
+		})
+	}
+	return result
+}
+
+func renderTemplate(t *template.Template, name string, data TemplateData) (string, error) {
+	var b bytes.Buffer
+	if err := t.ExecuteTemplate(&b, name, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// renderSlack returns the Slack message text.
+func (t *Templates) renderSlack(data TemplateData) (string, error) {
+	text, err := renderTemplate(t.Slack, slackTemplateFile, data)
+	if err != nil {
+		return "", fmt.Errorf("render %s: %w", slackTemplateFile, err)
+	}
+	return strings.TrimSpace(text), nil
+}
+
+// renderWebhook returns the webhook request body.
+func (t *Templates) renderWebhook(data TemplateData) ([]byte, error) {
+	body, err := renderTemplate(t.Webhook, webhookTemplateFile, data)
+	if err != nil {
+		return nil, fmt.Errorf("render %s: %w", webhookTemplateFile, err)
+	}
+	if !json.Valid([]byte(body)) {
+		return nil, fmt.Errorf("render %s: output is not valid JSON", webhookTemplateFile)
+	}
+	return []byte(body), nil
+}
+
+// renderEmail returns the subject and bodies of an email. Without an "html"
+// template, the HTML part is the text body in a <pre> block.
+func (t *Templates) renderEmail(data TemplateData) (subject, text, htmlBody string, err error) {
+	if subject, err = renderTemplate(t.Email, "subject", data); err != nil {
+		return "", "", "", fmt.Errorf("render %s: %w", emailTemplateFile, err)
+	}
+	if text, err = renderTemplate(t.Email, "text", data); err != nil {
+		return "", "", "", fmt.Errorf("render %s: %w", emailTemplateFile, err)
+	}
+	// Subjects are a single line
+	subject = strings.Join(strings.Fields(subject), " ")
+
+	if t.Email.Lookup("html") == nil {
+		return subject, text, emailHTML("<pre>" + template.HTMLEscapeString(text) + "</pre>\n"), nil
+	}
+	if htmlBody, err = renderTemplate(t.Email, "html", data); err != nil {
+		return "", "", "", fmt.Errorf("render %s: %w", emailTemplateFile, err)
+	}
+	return subject, text, htmlBody, nil
+}
+
+// RenderSamples renders every loaded template with sample data to w.
+func (t *Templates) RenderSamples(w io.Writer) error {
+	data := newTemplateData("sample-cluster", sampleEvents(), time.Now())
+
+	if t.Slack == nil {
+		_, _ = fmt.Fprintf(w, "== %s: not found, using built-in format\n\n", slackTemplateFile)
+	} else {
+		text, err := t.renderSlack(data)
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(w, "== %s\n%s\n\n", slackTemplateFile, text)
+	}
+
+	if t.Webhook == nil {
+		_, _ = fmt.Fprintf(w, "== %s: not found, using built-in format\n\n", webhookTemplateFile)
+	} else {
+		body, err := t.renderWebhook(data)
+		if err != nil {
+			return err
+		}
+		var indented bytes.Buffer
+		_ = json.Indent(&indented, body, "", "  ")
+		_, _ = fmt.Fprintf(w, "== %s\n%s\n\n", webhookTemplateFile, indented.String())
+	}
+
+	if t.Email == nil {
+		_, _ = fmt.Fprintf(w, "== %s: not found, using built-in format\n", emailTemplateFile)
+	} else {
+		subject, text, htmlBody, err := t.renderEmail(data)
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(w, "== %s\nSubject: %s\n\n%s\n-- html --\n%s\n", emailTemplateFile, subject, text, htmlBody)
+	}
+	return nil
+}
+
+// sampleEvents are the events templates are validated with.
+func sampleEvents() []VulnerabilityEvent {
+	now := time.Now().UTC().Truncate(time.Second)
+	fixedAt := now
+	return []VulnerabilityEvent{
+		{ID: "sample-6", Type: "IMAGE_CHANGED", Kind: KindVulnerability, Workload: "payments/Deployment/api", ContainerName: "api",
+			ImageRepository: "ghcr.io/example/api", ImageTag: "1.4.2", ImageDigest: "sha256:9f8e7d6c5b4a3928", OldImageDigest: "sha256:1a2b3c4d5e6f7081",
+			Added: 2, FirstSeen: now},
+		{ID: "sample-1", Type: "NEW", Kind: KindVulnerability, CVE: "CVE-2024-0001", Workload: "payments/Deployment/api", Severity: "CRITICAL",
+			Image: "openssl:3.0.1", ContainerName: "api", ImageRepository: "ghcr.io/example/api", ImageTag: "1.4.2",
+			FixedVersion: "3.0.7", Exposure: "external", FirstSeen: now},
+		{ID: "sample-2", Type: "NEW", Kind: KindVulnerability, CVE: "CVE-2024-0002", Workload: "payments/Deployment/api", Severity: "HIGH",
+			Image: "curl:8.4.0", ContainerName: "api", ImageRepository: "ghcr.io/example/api", ImageTag: "1.4.2",
+			FixedVersion: "8.5.0", Exposure: "external", FirstSeen: now},
+		{ID: "sample-3", Type: "NEW", Kind: KindVulnerability, CVE: "CVE-2024-0003", Workload: "web/StatefulSet/cache", Severity: "MEDIUM",
+			Image: "redis:7.2.3", ContainerName: "redis", ImageRepository: "docker.io/library/redis", ImageTag: "7.2.3", FirstSeen: now},
+		{ID: "sample-5", Type: "SEVERITY_CHANGED", Kind: KindVulnerability, CVE: "CVE-2023-0005", Workload: "web/StatefulSet/cache", Severity: "CRITICAL",
+			OldSeverity: "MEDIUM", Image: "libxml2:2.11.5", ContainerName: "redis", ImageRepository: "docker.io/library/redis", ImageTag: "7.2.3",
+			FixedVersion: "2.11.6", FirstSeen: now.Add(-240 * time.Hour)},
+		{ID: "sample-4", Type: "FIXED", Kind: KindVulnerability, CVE: "CVE-2023-0004", Workload: "web/Deployment/frontend", Severity: "HIGH",
+			Image: "nginx:1.25.2", ContainerName: "nginx", ImageRepository: "docker.io/library/nginx", ImageTag: "1.25.3",
+			FirstSeen: now.Add(-78 * time.Hour), FixedAt: &fixedAt, TimeToFix: int64(78 * time.Hour / time.Second)},
+	}
+}
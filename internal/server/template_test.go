@@ -0,0 +1,194 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// templateData is fixed template input for golden files
+func templateData() TemplateData {
+	return newTemplateData("prod-eu", teamsEvents(), time.Date(2024, 3, 4, 9, 30, 0, 0, time.UTC))
+}
+
+func loadTestTemplates(t *testing.T) *Templates {
+	t.Helper()
+	templates, err := LoadTemplates(filepath.Join("testdata", "templates"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if templates.Slack == nil || templates.Webhook == nil || templates.Email == nil {
+		t.Fatalf("templates not loaded: %+v", templates)
+	}
+	return templates
+}
+
+func TestTemplatesGolden(t *testing.T) {
+	templates := loadTestTemplates(t)
+	data := templateData()
+
+	text, err := templates.renderSlack(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "template_slack.txt", []byte(text+"\n"))
+
+	body, err := templates.renderWebhook(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, body, "", "  "); err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "template_webhook.json", append(indented.Bytes(), '\n'))
+
+	subject, text, htmlBody, err := templates.renderEmail(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject != "[PROD-EU] 3 new vulnerabilities" {
+		t.Errorf("subject = %q", subject)
+	}
+	golden(t, "template_email.txt", []byte(text))
+	// Without an "html" template the text is the HTML part
+	if !strings.Contains(htmlBody, "<pre>Cluster prod-eu at 2024-03-04 09:30 UTC\n") {
+		t.Errorf("HTML part:\n%s", htmlBody)
+	}
+}
+
+// The built-in formats, used when a template is absent
+func TestBuiltinEmailGolden(t *testing.T) {
+	if got := eventsSubject(teamsEvents()); got != "3 new, 1 rescored, 2 fixed vulnerabilities" {
+		t.Errorf("subject = %q", got)
+	}
+	text, htmlBody := emailEventsBody(teamsEvents())
+	golden(t, "email_poll.txt", []byte(text))
+	golden(t, "email_poll.html", []byte(htmlBody))
+}
+
+func TestTemplateData(t *testing.T) {
+	data := templateData()
+	if data.NewCount != 3 || data.ChangedCount != 1 || data.FixedCount != 2 || len(data.ImageChanges) != 1 {
+		t.Errorf("counts = %d new, %d changed, %d fixed, %d image changes",
+			data.NewCount, data.ChangedCount, data.FixedCount, len(data.ImageChanges))
+	}
+	if len(data.New) != 2 || data.New[0].Workload != "dev/deployment/web" || data.New[1].Namespace != "prod" ||
+		data.New[1].Events[0].Severity != "CRITICAL" || data.New[1].BySeverity["HIGH"] != 1 {
+		t.Errorf("new by workload = %+v", data.New)
+	}
+	if data.Events[0].Type != "IMAGE_CHANGED" || data.Events[1].Severity != "CRITICAL" {
+		t.Errorf("events not sorted: %+v", data.Events[:2])
+	}
+	if data.Batch != 1 || data.Batches != 1 || data.Timestamp.Location() != time.UTC {
+		t.Errorf("batch %d/%d at %v", data.Batch, data.Batches, data.Timestamp)
+	}
+}
+
+func TestLoadTemplatesMissing(t *testing.T) {
+	templates, err := LoadTemplates(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if templates.Slack != nil || templates.Webhook != nil || templates.Email != nil {
+		t.Errorf("templates loaded from an empty directory: %+v", templates)
+	}
+	var out strings.Builder
+	if err := templates.RenderSamples(&out); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{slackTemplateFile, webhookTemplateFile, emailTemplateFile} {
+		if !strings.Contains(out.String(), "== "+name+": not found, using built-in format\n") {
+			t.Errorf("samples lack the %s fallback:\n%s", name, out.String())
+		}
+	}
+}
+
+// Broken templates fail when they are loaded, not when a notification is sent
+func TestLoadTemplatesErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    string
+	}{
+		{"syntax", slackTemplateFile, "{{.NewCount", "parse "},
+		{"unknown function", slackTemplateFile, "{{shout .NewCount}}", `function "shout" not defined`},
+		{"unknown field", slackTemplateFile, "{{.Cluster}}", "render slack.tmpl"},
+		{"unknown map key", slackTemplateFile, "{{.BySeverity.SEVERE}}", "render slack.tmpl"},
+		{"invalid JSON", webhookTemplateFile, `{"count": {{.NewCount}},}`, "render webhook.tmpl: output is not valid JSON"},
+		{"no subject", emailTemplateFile, `{{define "text"}}hi{{end}}`, `must define the "subject" and "text" templates`},
+		{"broken html", emailTemplateFile, `{{define "subject"}}s{{end}}{{define "text"}}t{{end}}{{define "html"}}{{.Nope}}{{end}}`, "render email.tmpl"},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, tt.file), []byte(tt.content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadTemplates(dir); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+
+	t.Setenv(ConfigFileEnv, "")
+	t.Setenv("TRIX_DATABASE_URL", "memory://")
+	t.Setenv("TRIX_TEMPLATE_DIR", filepath.Join("testdata", "templates", slackTemplateFile))
+	if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "not a directory") {
+		t.Errorf("TRIX_TEMPLATE_DIR on a file: err = %v", err)
+	}
+}
+
+func TestNotifyWithTemplates(t *testing.T) {
+	slack, slackReceived := stubReceiver(t, http.StatusOK)
+	webhook, webhookReceived := stubReceiver(t, http.StatusOK)
+	n := testNotifier(t, map[string]string{
+		"TRIX_NOTIFY_SLACK":    slack.URL,
+		"TRIX_NOTIFY_WEBHOOK":  webhook.URL,
+		"TRIX_NOTIFY_SEVERITY": "LOW",
+		"TRIX_CLUSTER_NAME":    "prod-eu",
+		"TRIX_TEMPLATE_DIR":    filepath.Join("testdata", "templates"),
+	})
+	n.Notify(context.Background(), teamsEvents())
+
+	reqs := slackReceived()
+	if len(reqs) != 1 {
+		t.Fatalf("%d Slack requests, want 1", len(reqs))
+	}
+	var message struct {
+		Text   string        `json:"text"`
+		Blocks []interface{} `json:"blocks"`
+	}
+	if err := json.Unmarshal(reqs[0].body, &message); err != nil {
+		t.Fatal(err)
+	}
+	// The rescoring stays above TRIX_NOTIFY_SEVERITY, so it is left out
+	want, err := n.config.Templates.renderSlack(newTemplateData("prod-eu", filterBySeverity(teamsEvents(), "LOW"), time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message.Text != want || message.Blocks != nil {
+		t.Errorf("Slack message = %s", reqs[0].body)
+	}
+
+	reqs = webhookReceived()
+	if len(reqs) != 1 {
+		t.Fatalf("%d webhook requests, want 1", len(reqs))
+	}
+	var payload struct {
+		Cluster string         `json:"cluster"`
+		Batch   string         `json:"batch"`
+		Counts  map[string]int `json:"counts"`
+	}
+	if err := json.Unmarshal(reqs[0].body, &payload); err != nil {
+		t.Fatalf("webhook body: %v\n%s", err, reqs[0].body)
+	}
+	if payload.Cluster != "prod-eu" || payload.Batch != "1/1" || payload.Counts["new"] != 3 || payload.Counts["fixed"] != 2 {
+		t.Errorf("webhook payload = %+v", payload)
+	}
+}
@@ -0,0 +1,309 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+)
+
+// Reasons recorded on deliveries that were suppressed instead of sent
+const (
+	suppressedInterval = "interval" // Workload notified within TRIX_NOTIFY_WORKLOAD_INTERVAL
+	suppressedOverflow = "overflow" // Beyond TRIX_NOTIFY_MAX_WORKLOADS, counted in the overflow summary
+)
+
+// throttled splits events for the human-facing channels.
+type throttled struct {
+	Shown      []VulnerabilityEvent // Listed individually
+	Suppressed []VulnerabilityEvent // Workload was notified too recently
+	Overflow   []VulnerabilityEvent // Rolled into one "and N more workloads" summary
+}
+
+// filter keeps the events at or above minSeverity
+func (t throttled) filter(minSeverity string) throttled {
+	return throttled{
+		Shown:      filterBySeverity(t.Shown, minSeverity),
+		Suppressed: filterBySeverity(t.Suppressed, minSeverity),
+		Overflow:   filterBySeverity(t.Overflow, minSeverity),
+	}
+}
+
+// splitThrottled drops events of workloads in recent and lists at most
+// maxWorkloads workloads (0 = no cap), in the order they first appear in
+// events. Events are sorted most severe first, so the cap keeps the most
+// severe workloads.
+func splitThrottled(events []VulnerabilityEvent, recent map[string]bool, maxWorkloads int) throttled {
+	var t throttled
+	shown := make(map[string]bool)
+	for _, e := range events {
+		switch {
+		case recent[e.Workload]:
+			t.Suppressed = append(t.Suppressed, e)
+		case shown[e.Workload]:
+			t.Shown = append(t.Shown, e)
+		case maxWorkloads > 0 && len(shown) >= maxWorkloads:
+			t.Overflow = append(t.Overflow, e)
+		default:
+			shown[e.Workload] = true
+			t.Shown = append(t.Shown, e)
+		}
+	}
+	return t
+}
+
+// throttles reports whether channel is subject to throttling. The webhook
+// and GitHub feed other systems and get every event; the email digest is
+// already one message a day.
+func (n *Notifier) throttles(channel string) bool {
+	switch channel {
+	case channelSlack, channelTeams:
+		return true
+	case channelEmail:
+		return n.config.EmailDigest == ""
+	default:
+		return false
+	}
+}
+
+// throttledSeverity returns the lowest threshold of the throttled channels
+func (n *Notifier) throttledSeverity() string {
+	lowest := "CRITICAL"
+	for _, channel := range n.channels() {
+		if !n.throttles(channel) {
+			continue
+		}
+		s := n.config.channelSeverity(channel)
+		if s == "" {
+			return ""
+		}
+		if severityLevel(s) > severityLevel(lowest) {
+			lowest = s
+		}
+	}
+	return lowest
+}
+
+// throttle applies TRIX_NOTIFY_WORKLOAD_INTERVAL and TRIX_NOTIFY_MAX_WORKLOADS
+// to events and records the shown workloads as notified.
+func (n *Notifier) throttle(ctx context.Context, events []VulnerabilityEvent) throttled {
+	var recent map[string]bool
+	now := time.Now()
+	if n.config.NotifyWorkloadInterval > 0 {
+		var err error
+		recent, err = n.store.RecentlyNotified(ctx, now.Add(-n.config.NotifyWorkloadInterval))
+		if err != nil {
+			// Better a noisy poll than a silently dropped one
+			n.logger.Warn("failed to load notified workloads, not throttling", "error", err)
+		}
+	}
+
+	t := splitThrottled(events, recent, n.config.NotifyMaxWorkloads)
+
+	if n.config.NotifyWorkloadInterval > 0 && len(t.Shown) > 0 {
+		if err := n.store.SetNotified(ctx, sortedWorkloads(groupByWorkload(t.Shown)), now); err != nil {
+			n.logger.Warn("failed to record notified workloads", "error", err)
+		}
+	}
+	if len(t.Suppressed) > 0 || len(t.Overflow) > 0 {
+		n.logger.Info("notifications throttled",
+			"shown", len(t.Shown),
+			"suppressed", len(t.Suppressed),
+			"overflow", len(t.Overflow),
+			"overflow_workloads", len(groupByWorkload(t.Overflow)),
+		)
+	}
+	return t
+}
+
+// sendThrottled posts the overflow summary to channel and records
+// suppressed events, and overflowed ones once the summary is sent, as
+// delivered so they are never retried. When the summary fails the overflowed
+// events are returned as failed, to be queued for retry.
+func (n *Notifier) sendThrottled(ctx context.Context, channel string, t throttled) DeliveryResult {
+	result := DeliveryResult{Channel: channel}
+	if err := n.store.RecordSuppressed(ctx, channel, t.Suppressed, suppressedInterval); err != nil {
+		n.logger.Warn("failed to record suppressed notifications", "channel", channel, "error", err)
+	}
+	if len(t.Overflow) == 0 {
+		return result
+	}
+	if err := n.sendOverflow(ctx, channel, t.Overflow); err != nil {
+		n.logger.Error("overflow notification failed", "channel", channel, "failed", len(t.Overflow), "error", err)
+		result.Failed, result.Err = t.Overflow, err
+		return result
+	}
+	if err := n.store.RecordSuppressed(ctx, channel, t.Overflow, suppressedOverflow); err != nil {
+		n.logger.Warn("failed to record suppressed notifications", "channel", channel, "error", err)
+	}
+	result.Delivered = t.Overflow
+	return result
+}
+
+// overflowText summarizes events left out by the per-poll cap, e.g.
+// "…and 37 more workloads: 120 new (5 critical, 115 high), 3 fixed".
+func overflowText(events []VulnerabilityEvent) string {
+	var parts []string
+	if newEvents := filterByType(events, "NEW"); len(newEvents) > 0 {
+		parts = append(parts, fmt.Sprintf("%d new (%s)", len(newEvents), severitySummary(countBySeverity(newEvents))))
+	}
+	if rescored := countByType(events, "SEVERITY_CHANGED"); rescored > 0 {
+		parts = append(parts, fmt.Sprintf("%d rescored", rescored))
+	}
+	if fixed := countByType(events, "FIXED"); fixed > 0 {
+		parts = append(parts, fmt.Sprintf("%d fixed", fixed))
+	}
+	return fmt.Sprintf("…and %d more workloads: %s", len(groupByWorkload(events)), strings.Join(parts, ", "))
+}
+
+// sendOverflow posts one summary message for events left out by the
+// per-poll cap. It is not tracked for redelivery.
+func (n *Notifier) sendOverflow(ctx context.Context, channel string, events []VulnerabilityEvent) error {
+	text := overflowText(events)
+	detail := "See GET /api/v1/vulnerabilities for the full list."
+
+	switch channel {
+	case channelSlack:
+		if n.config.SlackLegacy {
+			return n.postJSON(ctx, n.config.SlackWebhook, map[string]interface{}{"text": text})
+		}
+		blocks := []map[string]interface{}{
+			{"type": "section", "text": slackText(text)},
+			slackContext(detail),
+		}
+		_, err := n.postSlack(ctx, "", text, n.slackFooter(blocks))
+		return err
+	case channelTeams:
+		style := teamsSeverityStyle(countBySeverity(filterByType(events, "NEW")))
+		return n.postJSON(ctx, n.config.TeamsWebhook, teamsMessage([]map[string]interface{}{
+			teamsSection(style, text, []string{detail}),
+		}))
+	case channelEmail:
+		htmlBody := emailHTML(fmt.Sprintf("<p>%s</p>\n<p><small>%s</small></p>\n", html.EscapeString(text), html.EscapeString(detail)))
+		return n.sendEmail(ctx, n.emailSubject(fmt.Sprintf("%d more workloads changed", len(groupByWorkload(events)))), text+"\n\n"+detail+"\n", htmlBody)
+	default:
+		return fmt.Errorf("unknown channel %q", channel)
+	}
+}
+
+// RecentlyNotified returns the workloads notified at or after since.
+func (db *DB) RecentlyNotified(ctx context.Context, since time.Time) (map[string]bool, error) {
+	rows, err := db.query(ctx, "SELECT workload FROM workload_notifications WHERE notified_at >= $1", since)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	recent := make(map[string]bool)
+	for rows.Next() {
+		var workload string
+		if err := rows.Scan(&workload); err != nil {
+			return nil, err
+		}
+		recent[workload] = true
+	}
+	return recent, rows.Err()
+}
+
+// SetNotified records workloads as notified at at.
+func (db *DB) SetNotified(ctx context.Context, workloads []string, at time.Time) error {
+	upsert := `
+		INSERT INTO workload_notifications (workload, notified_at) VALUES ($1, $2)
+		ON CONFLICT (workload) DO UPDATE SET notified_at = EXCLUDED.notified_at`
+	if db.dialect == dialectMySQL {
+		upsert = `
+		INSERT INTO workload_notifications (workload, notified_at) VALUES ($1, $2)
+		ON DUPLICATE KEY UPDATE notified_at = VALUES(notified_at)`
+	}
+
+	for _, workload := range workloads {
+		if _, err := db.exec(ctx, upsert, workload, at); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PruneNotified forgets workloads last notified strictly before cutoff.
+func (db *DB) PruneNotified(ctx context.Context, cutoff time.Time) (int64, error) {
+	res, err := db.exec(ctx, "DELETE FROM workload_notifications WHERE notified_at < $1", cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// RecordSuppressed stores events that were deliberately not sent to channel
+// as delivered, with the reason.
+func (db *DB) RecordSuppressed(ctx context.Context, channel string, events []VulnerabilityEvent, reason string) error {
+	now := time.Now()
+	return db.insertDeliveries(ctx, channel, events, Delivery{
+		NextAttemptAt: now,
+		DeliveredAt:   &now,
+		Suppressed:    reason,
+		CreatedAt:     now,
+	})
+}
+
+// RecentlyNotified returns the workloads notified at or after since.
+func (m *MemoryStore) RecentlyNotified(ctx context.Context, since time.Time) (map[string]bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	recent := make(map[string]bool)
+	for workload, at := range m.notified {
+		if !at.Before(since) {
+			recent[workload] = true
+		}
+	}
+	return recent, nil
+}
+
+// SetNotified records workloads as notified at at.
+func (m *MemoryStore) SetNotified(ctx context.Context, workloads []string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, workload := range workloads {
+		m.notified[workload] = at
+	}
+	return nil
+}
+
+// PruneNotified forgets workloads last notified strictly before cutoff.
+func (m *MemoryStore) PruneNotified(ctx context.Context, cutoff time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var pruned int64
+	for workload, at := range m.notified {
+		if at.Before(cutoff) {
+			delete(m.notified, workload)
+			pruned++
+		}
+	}
+	return pruned, nil
+}
+
+// RecordSuppressed stores events that were deliberately not sent to channel
+// as delivered, with the reason.
+func (m *MemoryStore) RecordSuppressed(ctx context.Context, channel string, events []VulnerabilityEvent, reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for _, e := range events {
+		m.deliverySeq++
+		m.deliveries = append(m.deliveries, &Delivery{
+			ID:            m.deliverySeq,
+			Channel:       channel,
+			Event:         e,
+			NextAttemptAt: now,
+			DeliveredAt:   &now,
+			Suppressed:    reason,
+			CreatedAt:     now,
+		})
+	}
+	return nil
+}
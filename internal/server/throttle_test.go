@@ -0,0 +1,276 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// criticalEvents returns one CRITICAL NEW event per workload
+func criticalEvents(workloads ...string) []VulnerabilityEvent {
+	var events []VulnerabilityEvent
+	for i, w := range workloads {
+		events = append(events, VulnerabilityEvent{
+			ID: fmt.Sprintf("e%d", i), Type: "NEW", Kind: KindVulnerability, CVE: "CVE-2024-0001",
+			Workload: w, Severity: "CRITICAL", Image: "openssl:3.0.1",
+		})
+	}
+	return events
+}
+
+func eventIDs(events []VulnerabilityEvent) []string {
+	var ids []string
+	for _, e := range events {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
+
+func TestSplitThrottled(t *testing.T) {
+	events := criticalEvents("a", "b", "a", "c", "d", "b")
+
+	all := splitThrottled(events, nil, 0)
+	if len(all.Shown) != 6 || all.Suppressed != nil || all.Overflow != nil {
+		t.Errorf("no throttling = %+v", all)
+	}
+
+	// The cap counts workloads, not events, and keeps the first ones
+	capped := splitThrottled(events, nil, 2)
+	if got := eventIDs(capped.Shown); !reflect.DeepEqual(got, []string{"e0", "e1", "e2", "e5"}) {
+		t.Errorf("shown = %v", got)
+	}
+	if got := eventIDs(capped.Overflow); !reflect.DeepEqual(got, []string{"e3", "e4"}) {
+		t.Errorf("overflow = %v", got)
+	}
+
+	// Recently notified workloads don't count towards the cap
+	recent := splitThrottled(events, map[string]bool{"a": true}, 2)
+	if got := eventIDs(recent.Suppressed); !reflect.DeepEqual(got, []string{"e0", "e2"}) {
+		t.Errorf("suppressed = %v", got)
+	}
+	if got := eventIDs(recent.Shown); !reflect.DeepEqual(got, []string{"e1", "e3", "e5"}) {
+		t.Errorf("shown with a recent workload = %v", got)
+	}
+	if got := eventIDs(recent.Overflow); !reflect.DeepEqual(got, []string{"e4"}) {
+		t.Errorf("overflow with a recent workload = %v", got)
+	}
+}
+
+func TestOverflowText(t *testing.T) {
+	events := criticalEvents("a", "b", "b")
+	events[1].Severity = "HIGH"
+	events = append(events,
+		VulnerabilityEvent{ID: "s", Type: "SEVERITY_CHANGED", Workload: "c", Severity: "HIGH", OldSeverity: "LOW"},
+		VulnerabilityEvent{ID: "f1", Type: "FIXED", Workload: "c", Severity: "LOW"},
+		VulnerabilityEvent{ID: "f2", Type: "FIXED", Workload: "d", Severity: "LOW"},
+	)
+	want := "…and 4 more workloads: 3 new (2 critical, 1 high), 1 rescored, 2 fixed"
+	if got := overflowText(events); got != want {
+		t.Errorf("overflowText = %q, want %q", got, want)
+	}
+}
+
+func TestNotifyThrottles(t *testing.T) {
+	ctx := context.Background()
+	teams, teamsReceived := stubReceiver(t, http.StatusOK)
+	webhook, webhookReceived := stubReceiver(t, http.StatusOK)
+	store := NewMemoryStore()
+	cfg := testConfig(t, map[string]string{
+		"TRIX_NOTIFY_TEAMS":         teams.URL,
+		"TRIX_NOTIFY_WEBHOOK":       webhook.URL,
+		"TRIX_NOTIFY_MAX_WORKLOADS": "2",
+	})
+	n := NewNotifier(cfg, store, testLogger())
+
+	// Three workloads: two listed, one rolled into the overflow summary
+	n.Notify(ctx, criticalEvents("prod/deployment/api", "prod/deployment/web", "prod/deployment/db"))
+	reqs := teamsReceived()
+	if len(reqs) != 2 {
+		t.Fatalf("%d Teams messages, want the changes and the overflow summary", len(reqs))
+	}
+	if body := string(reqs[0].body); !strings.Contains(body, "prod/deployment/api") || strings.Contains(body, "prod/deployment/db") {
+		t.Errorf("first message:\n%s", body)
+	}
+	if body := string(reqs[1].body); !strings.Contains(body, "…and 1 more workloads: 1 new (1 critical)") {
+		t.Errorf("overflow message:\n%s", body)
+	}
+	// The webhook feeds other systems and gets every event
+	if n := len(webhookReceived()); n != 1 {
+		t.Errorf("%d webhook requests, want 1", n)
+	}
+
+	// Within the interval the listed workloads are suppressed; the one that
+	// overflowed was never shown, so it is
+	n.Notify(ctx, criticalEvents("prod/deployment/api", "prod/deployment/web", "prod/deployment/db"))
+	reqs = teamsReceived()
+	if len(reqs) != 3 {
+		t.Fatalf("%d Teams messages after the second notify, want 3", len(reqs))
+	}
+	if body := string(reqs[2].body); !strings.Contains(body, "prod/deployment/db") || strings.Contains(body, "prod/deployment/api") {
+		t.Errorf("second notify:\n%s", body)
+	}
+
+	// Suppressed events count as delivered so they are never retried
+	reasons := make(map[string]int)
+	store.mu.Lock()
+	for _, d := range store.deliveries {
+		if d.DeliveredAt == nil || d.Channel != channelTeams {
+			t.Errorf("suppressed delivery = %+v", d)
+		}
+		reasons[d.Suppressed]++
+	}
+	store.mu.Unlock()
+	if !reflect.DeepEqual(reasons, map[string]int{suppressedOverflow: 1, suppressedInterval: 2}) {
+		t.Errorf("suppression reasons = %v", reasons)
+	}
+	if stats, _ := store.GetDeliveryStats(ctx, cfg.DeliveryMaxAttempts); stats.Pending != 0 || stats.Failed != 0 {
+		t.Errorf("stats = %+v", stats)
+	}
+	if due, _ := store.DueDeliveries(ctx, time.Now().Add(time.Hour), cfg.DeliveryMaxAttempts); len(due) != 0 {
+		t.Errorf("suppressed events due for retry: %+v", due)
+	}
+
+	// After the interval the workloads are notified again
+	if err := store.SetNotified(ctx, []string{"prod/deployment/api", "prod/deployment/web", "prod/deployment/db"}, time.Now().Add(-2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	n.Notify(ctx, criticalEvents("prod/deployment/api"))
+	if reqs := teamsReceived(); len(reqs) != 4 || !strings.Contains(string(reqs[3].body), "prod/deployment/api") {
+		t.Errorf("%d Teams messages after the interval, want 4", len(reqs))
+	}
+}
+
+// A failed overflow summary leaves its events to the retry queue instead of
+// recording them as delivered
+func TestNotifyOverflowFailure(t *testing.T) {
+	ctx := context.Background()
+	var calls atomic.Int32
+	teams := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) > 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(teams.Close)
+	store := NewMemoryStore()
+	n := NewNotifier(testConfig(t, map[string]string{
+		"TRIX_NOTIFY_TEAMS":         teams.URL,
+		"TRIX_NOTIFY_MAX_WORKLOADS": "2",
+	}), store, testLogger())
+
+	result := n.Notify(ctx, criticalEvents("prod/deployment/api", "prod/deployment/web", "prod/deployment/db"))
+	var failed []string
+	for _, d := range result.Deliveries {
+		if d.Channel != channelTeams {
+			t.Errorf("delivery on %s", d.Channel)
+		}
+		for _, e := range d.Failed {
+			failed = append(failed, e.Workload)
+		}
+		if len(d.Failed) > 0 && d.Err == nil {
+			t.Error("failed delivery without an error")
+		}
+	}
+	if !reflect.DeepEqual(failed, []string{"prod/deployment/db"}) {
+		t.Errorf("failed workloads = %v, want the overflowed one", failed)
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	for _, d := range store.deliveries {
+		if d.Suppressed == suppressedOverflow {
+			t.Errorf("overflow recorded as delivered after the summary failed: %+v", d)
+		}
+	}
+}
+
+func TestNotifyThrottlingDisabled(t *testing.T) {
+	teams, teamsReceived := stubReceiver(t, http.StatusOK)
+	n := testNotifier(t, map[string]string{
+		"TRIX_NOTIFY_TEAMS":             teams.URL,
+		"TRIX_NOTIFY_WORKLOAD_INTERVAL": "0",
+		"TRIX_NOTIFY_MAX_WORKLOADS":     "0",
+	})
+	var workloads []string
+	for i := 0; i < 30; i++ {
+		workloads = append(workloads, fmt.Sprintf("prod/deployment/w%d", i))
+	}
+	for i := 0; i < 2; i++ {
+		n.Notify(context.Background(), criticalEvents(workloads...))
+	}
+	reqs := teamsReceived()
+	if len(reqs) != 2 {
+		t.Fatalf("%d Teams messages, want 2", len(reqs))
+	}
+	for _, r := range reqs {
+		if !strings.Contains(string(r.body), "prod/deployment/w29") || strings.Contains(string(r.body), "more workloads") {
+			t.Errorf("message without throttling:\n%s", r.body)
+		}
+	}
+}
+
+func TestThrottleConfig(t *testing.T) {
+	if cfg := testConfig(t, nil); cfg.NotifyWorkloadInterval != time.Hour || cfg.NotifyMaxWorkloads != 20 {
+		t.Errorf("defaults = %v interval, %d workloads", cfg.NotifyWorkloadInterval, cfg.NotifyMaxWorkloads)
+	}
+	cfg := testConfig(t, map[string]string{"TRIX_NOTIFY_WORKLOAD_INTERVAL": "15m", "TRIX_NOTIFY_MAX_WORKLOADS": "5"})
+	if cfg.NotifyWorkloadInterval != 15*time.Minute || cfg.NotifyMaxWorkloads != 5 {
+		t.Errorf("configured = %v interval, %d workloads", cfg.NotifyWorkloadInterval, cfg.NotifyMaxWorkloads)
+	}
+
+	for name, value := range map[string]string{
+		"TRIX_NOTIFY_WORKLOAD_INTERVAL": "-1h",
+		"TRIX_NOTIFY_MAX_WORKLOADS":     "-1",
+	} {
+		t.Setenv(ConfigFileEnv, "")
+		t.Setenv("TRIX_DATABASE_URL", "memory://")
+		t.Setenv(name, value)
+		if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "invalid "+name) {
+			t.Errorf("%s=%s: err = %v", name, value, err)
+		}
+		t.Setenv(name, "")
+	}
+}
+
+func testNotified(t *testing.T, s Store) {
+	ctx := context.Background()
+	now := time.Now()
+	if err := s.SetNotified(ctx, []string{"a", "b"}, now.Add(-2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetNotified(ctx, []string{"b", "c"}, now); err != nil {
+		t.Fatal(err)
+	}
+
+	recent, err := s.RecentlyNotified(ctx, now.Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(recent, map[string]bool{"b": true, "c": true}) {
+		t.Errorf("RecentlyNotified = %v", recent)
+	}
+
+	if n, err := s.PruneNotified(ctx, now.Add(-time.Hour)); err != nil || n != 1 {
+		t.Errorf("PruneNotified = %d, %v, want 1", n, err)
+	}
+	if recent, _ := s.RecentlyNotified(ctx, now.Add(-24*time.Hour)); len(recent) != 2 || recent["a"] {
+		t.Errorf("RecentlyNotified after pruning = %v", recent)
+	}
+
+	if err := s.RecordSuppressed(ctx, channelSlack, criticalEvents("a", "b"), suppressedInterval); err != nil {
+		t.Fatal(err)
+	}
+	if due, err := s.DueDeliveries(ctx, now.Add(time.Hour), 3); err != nil || len(due) != 0 {
+		t.Errorf("suppressed deliveries due: %+v, %v", due, err)
+	}
+	if stats, err := s.GetDeliveryStats(ctx, 3); err != nil || stats.Pending != 0 || stats.Failed != 0 {
+		t.Errorf("stats = %+v, %v", stats, err)
+	}
+}
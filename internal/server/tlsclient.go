@@ -0,0 +1,223 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/trixsec-dev/trix/internal/proxy"
+)
+
+// tlsReloadCheckInterval is how often certificate files are checked for changes
+const tlsReloadCheckInterval = 30 * time.Second
+
+// ClientTLS is the TLS setup for outgoing notification requests: an extra
+// CA trusted on top of the system roots and an optional client certificate
+// for mutual TLS. Files are reloaded on SIGHUP or when they change, see
+// watchClientTLS.
+type ClientTLS struct {
+	name     string // Env var prefix, for messages
+	caFile   string
+	certFile string
+	keyFile  string
+	proxyURL *url.URL // nil = proxy from the environment
+
+	mu        sync.Mutex // Serializes reloads
+	stamp     string     // Size and mtime of the files at the last load attempt
+	transport atomic.Pointer[http.Transport]
+}
+
+// newClientTLS reads the CA and client certificate files. name is the env
+// var prefix used in errors, e.g. TRIX_TLS. Expired certificates and a
+// certificate without its key are rejected. Requests go through proxyURL,
+// or the environment's proxy when it is nil.
+func newClientTLS(name, caFile, certFile, keyFile string, proxyURL *url.URL) (*ClientTLS, error) {
+	if (certFile == "") != (keyFile == "") {
+		return nil, fmt.Errorf("%s_CLIENT_CERT and %s_CLIENT_KEY must be set together", name, name)
+	}
+	c := &ClientTLS{name: name, caFile: caFile, certFile: certFile, keyFile: keyFile, proxyURL: proxyURL}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// load builds a transport from the files and swaps it in. On error the
+// previous transport stays in use; the files are retried once they change
+// again or on SIGHUP.
+func (c *ClientTLS) load() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stamp = c.fileStamp()
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	now := time.Now()
+
+	if c.caFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		certs, err := readCertificates(c.caFile)
+		if err != nil {
+			return fmt.Errorf("invalid %s_CA_FILE: %w", c.name, err)
+		}
+		for _, cert := range certs {
+			if err := checkValidity(cert, now); err != nil {
+				return fmt.Errorf("invalid %s_CA_FILE %s: %w", c.name, c.caFile, err)
+			}
+			pool.AddCert(cert)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if c.certFile != "" {
+		pair, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+		if err != nil {
+			return fmt.Errorf("invalid %s_CLIENT_CERT/%s_CLIENT_KEY: %w", c.name, c.name, err)
+		}
+		if err := checkValidity(pair.Leaf, now); err != nil {
+			return fmt.Errorf("invalid %s_CLIENT_CERT %s: %w", c.name, c.certFile, err)
+		}
+		cfg.Certificates = []tls.Certificate{pair}
+	}
+
+	transport := proxy.Transport(c.proxyURL)
+	transport.TLSClientConfig = cfg
+	if old := c.transport.Swap(transport); old != nil {
+		old.CloseIdleConnections()
+	}
+	return nil
+}
+
+// readCertificates parses every certificate in a PEM file
+func readCertificates(path string) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("%s: no PEM certificates found", path)
+	}
+	return certs, nil
+}
+
+func checkValidity(cert *x509.Certificate, now time.Time) error {
+	if now.After(cert.NotAfter) {
+		return fmt.Errorf("certificate %q expired at %s", cert.Subject.CommonName, cert.NotAfter.UTC().Format(time.RFC3339))
+	}
+	if now.Before(cert.NotBefore) {
+		return fmt.Errorf("certificate %q is not valid before %s", cert.Subject.CommonName, cert.NotBefore.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// fileStamp summarizes the size and mtime of the files; it changes whenever
+// one of them is rewritten or replaced (including Kubernetes secret updates,
+// which swap a symlink).
+func (c *ClientTLS) fileStamp() string {
+	var b strings.Builder
+	for _, path := range []string{c.caFile, c.certFile, c.keyFile} {
+		if path == "" {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil {
+			fmt.Fprintf(&b, "%s:%d:%d;", path, info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	return b.String()
+}
+
+// changed reports whether the files differ from the last load attempt
+func (c *ClientTLS) changed() bool {
+	stamp := c.fileStamp()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return stamp != c.stamp
+}
+
+// RoundTrip sends req with the current transport, so reloads apply to
+// clients that were created before them.
+func (c *ClientTLS) RoundTrip(req *http.Request) (*http.Response, error) {
+	return c.transport.Load().RoundTrip(req)
+}
+
+// httpClient returns a client using tlsConfig, or a transport with default
+// TLS settings and proxyURL when it is nil.
+func httpClient(tlsConfig *ClientTLS, proxyURL *url.URL, timeout time.Duration) *http.Client {
+	if tlsConfig != nil {
+		return &http.Client{Timeout: timeout, Transport: tlsConfig}
+	}
+	return &http.Client{Timeout: timeout, Transport: proxy.Transport(proxyURL)}
+}
+
+// watchClientTLS reloads the certificates on SIGHUP and when their files
+// change, until ctx is done. A failed reload is logged and the previous
+// certificates are kept.
+func watchClientTLS(ctx context.Context, logger *slog.Logger, configs ...*ClientTLS) {
+	var active []*ClientTLS
+	for _, c := range configs {
+		if c != nil {
+			active = append(active, c)
+		}
+	}
+	if len(active) == 0 {
+		return
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(tlsReloadCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		force := false
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			force = true
+		case <-ticker.C:
+		}
+		for _, c := range active {
+			if !force && !c.changed() {
+				continue
+			}
+			if err := c.load(); err != nil {
+				logger.Error("failed to reload client TLS certificates, keeping the previous ones", "config", c.name, "error", err)
+				continue
+			}
+			logger.Info("reloaded client TLS certificates", "config", c.name)
+		}
+	}
+}
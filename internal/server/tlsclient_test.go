@@ -0,0 +1,270 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mtlsServer is an HTTPS server requiring a client certificate signed by
+// the test CA. clients returns the common names of the certificates it saw.
+func mtlsServer(t *testing.T, pki *testPKI) (*httptest.Server, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var names []string
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		names = append(names, r.TLS.PeerCertificates[0].Subject.CommonName)
+		mu.Unlock()
+	}))
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{pki.issueValid(t, "server", false).pair},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pki.pool,
+	}
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0) // Rejected handshakes are expected
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), names...)
+	}
+}
+
+func TestClientTLSMutualAuth(t *testing.T) {
+	pki := newTestPKI(t)
+	srv, clients := mtlsServer(t, pki)
+	client := pki.issueValid(t, "trix", true)
+
+	n := testNotifier(t, map[string]string{
+		"TRIX_NOTIFY_WEBHOOK":  srv.URL,
+		"TRIX_SAAS_ENDPOINT":   srv.URL,
+		"TRIX_TLS_CA_FILE":     pki.caFile(),
+		"TRIX_TLS_CLIENT_CERT": client.certFile,
+		"TRIX_TLS_CLIENT_KEY":  client.keyFile,
+		"TRIX_SAAS_API_KEY":    "key",
+	})
+	ctx := context.Background()
+	if res := n.Deliver(ctx, channelWebhook, testEvents()); res.Err != nil {
+		t.Fatalf("webhook: %v", res.Err)
+	}
+	if res := n.SendSaas(ctx, testEvents()); res.Err != nil {
+		t.Fatalf("saas: %v", res.Err)
+	}
+	if got := strings.Join(clients(), ","); got != "trix,trix" {
+		t.Errorf("client certificates = %q, want trix for both requests", got)
+	}
+}
+
+func TestClientTLSHandshakeFailures(t *testing.T) {
+	pki := newTestPKI(t)
+	srv, clients := mtlsServer(t, pki)
+	other := newTestPKI(t)
+	foreign := other.issueValid(t, "foreign", true)
+	client := pki.issueValid(t, "trix", true)
+
+	tests := []struct {
+		name string
+		env  map[string]string
+	}{
+		{"no client certificate", map[string]string{"TRIX_TLS_CA_FILE": pki.caFile()}},
+		{"client certificate from another CA", map[string]string{
+			"TRIX_TLS_CA_FILE":     pki.caFile(),
+			"TRIX_TLS_CLIENT_CERT": foreign.certFile,
+			"TRIX_TLS_CLIENT_KEY":  foreign.keyFile,
+		}},
+		{"server CA not trusted", map[string]string{
+			"TRIX_TLS_CLIENT_CERT": client.certFile,
+			"TRIX_TLS_CLIENT_KEY":  client.keyFile,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{"TRIX_NOTIFY_WEBHOOK": srv.URL, "TRIX_WEBHOOK_TIMEOUT": "5s"}
+			for k, v := range tt.env {
+				env[k] = v
+			}
+			res := testNotifier(t, env).Deliver(context.Background(), channelWebhook, testEvents())
+			if res.Err == nil {
+				t.Fatal("webhook delivered without a valid TLS setup")
+			}
+		})
+	}
+	if got := clients(); len(got) != 0 {
+		t.Errorf("server accepted requests from %v", got)
+	}
+}
+
+// TRIX_WEBHOOK_TLS_* applies to the generic webhook only
+func TestClientTLSWebhookOverride(t *testing.T) {
+	pki := newTestPKI(t)
+	srv, clients := mtlsServer(t, pki)
+	shared := pki.issueValid(t, "shared", true)
+	hook := pki.issueValid(t, "webhook", true)
+
+	n := testNotifier(t, map[string]string{
+		"TRIX_NOTIFY_WEBHOOK":          srv.URL,
+		"TRIX_NOTIFY_TEAMS":            srv.URL,
+		"TRIX_TLS_CA_FILE":             pki.caFile(),
+		"TRIX_TLS_CLIENT_CERT":         shared.certFile,
+		"TRIX_TLS_CLIENT_KEY":          shared.keyFile,
+		"TRIX_WEBHOOK_TLS_CA_FILE":     pki.caFile(),
+		"TRIX_WEBHOOK_TLS_CLIENT_CERT": hook.certFile,
+		"TRIX_WEBHOOK_TLS_CLIENT_KEY":  hook.keyFile,
+	})
+	ctx := context.Background()
+	if res := n.Deliver(ctx, channelWebhook, testEvents()); res.Err != nil {
+		t.Fatalf("webhook: %v", res.Err)
+	}
+	if res := n.Deliver(ctx, channelTeams, testEvents()); res.Err != nil {
+		t.Fatalf("teams: %v", res.Err)
+	}
+	if got := strings.Join(clients(), ","); got != "webhook,shared" {
+		t.Errorf("client certificates = %q, want webhook then shared", got)
+	}
+}
+
+func TestClientTLSRejectedAtLoad(t *testing.T) {
+	pki := newTestPKI(t)
+	now := time.Now()
+	valid := pki.issueValid(t, "valid", true)
+	expired := pki.issue(t, "expired", true, now.Add(-48*time.Hour), now.Add(-time.Hour))
+	future := pki.issue(t, "future", true, now.Add(time.Hour), now.Add(48*time.Hour))
+	garbage := filepath.Join(t.TempDir(), "garbage.pem")
+	if err := os.WriteFile(garbage, []byte("not a certificate\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{"expired client certificate", map[string]string{
+			"TRIX_TLS_CLIENT_CERT": expired.certFile,
+			"TRIX_TLS_CLIENT_KEY":  expired.keyFile,
+		}, `invalid TRIX_TLS_CLIENT_CERT ` + expired.certFile + `: certificate "expired" expired at`},
+		{"client certificate not valid yet", map[string]string{
+			"TRIX_TLS_CLIENT_CERT": future.certFile,
+			"TRIX_TLS_CLIENT_KEY":  future.keyFile,
+		}, `certificate "future" is not valid before`},
+		{"certificate without key", map[string]string{
+			"TRIX_TLS_CLIENT_CERT": valid.certFile,
+		}, "TRIX_TLS_CLIENT_CERT and TRIX_TLS_CLIENT_KEY must be set together"},
+		{"key without certificate", map[string]string{
+			"TRIX_WEBHOOK_TLS_CLIENT_KEY": valid.keyFile,
+		}, "TRIX_WEBHOOK_TLS_CLIENT_CERT and TRIX_WEBHOOK_TLS_CLIENT_KEY must be set together"},
+		{"mismatched key", map[string]string{
+			"TRIX_TLS_CLIENT_CERT": valid.certFile,
+			"TRIX_TLS_CLIENT_KEY":  expired.keyFile,
+		}, "invalid TRIX_TLS_CLIENT_CERT/TRIX_TLS_CLIENT_KEY"},
+		{"missing CA file", map[string]string{
+			"TRIX_TLS_CA_FILE": filepath.Join(t.TempDir(), "missing.pem"),
+		}, "invalid TRIX_TLS_CA_FILE"},
+		{"CA file without certificates", map[string]string{
+			"TRIX_WEBHOOK_TLS_CA_FILE": garbage,
+		}, "invalid TRIX_WEBHOOK_TLS_CA_FILE: " + garbage + ": no PEM certificates found"},
+		{"expired certificate in CA file", map[string]string{
+			"TRIX_TLS_CA_FILE": expired.certFile,
+		}, `invalid TRIX_TLS_CA_FILE ` + expired.certFile + `: certificate "expired" expired at`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(ConfigFileEnv, "")
+			t.Setenv("TRIX_DATABASE_URL", "memory://")
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			_, err := LoadConfig()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadConfig error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientTLSReload(t *testing.T) {
+	pki := newTestPKI(t)
+	srv, clients := mtlsServer(t, pki)
+	first := pki.issueValid(t, "first", true)
+	second := pki.issueValid(t, "second", true)
+
+	// The files the config points at, rewritten below
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	install := func(c testCert, mtime time.Time) {
+		t.Helper()
+		for src, dst := range map[string]string{c.certFile: certFile, c.keyFile: keyFile} {
+			data, err := os.ReadFile(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(dst, data, 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(dst, mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	install(first, time.Now().Add(-time.Minute))
+
+	c, err := newClientTLS("TRIX_TLS", pki.caFile(), certFile, keyFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := httpClient(c, nil, 5*time.Second)
+	get := func() error {
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+
+	if err := get(); err != nil {
+		t.Fatal(err)
+	}
+	if c.changed() {
+		t.Error("changed() before the files were touched")
+	}
+
+	install(second, time.Now())
+	if !c.changed() {
+		t.Fatal("changed() = false after the certificate was replaced")
+	}
+	if err := c.load(); err != nil {
+		t.Fatal(err)
+	}
+	if c.changed() {
+		t.Error("changed() still true after reloading")
+	}
+	if err := get(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A broken update keeps the previous certificate in use
+	if err := os.WriteFile(keyFile, []byte("truncated"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.load(); err == nil {
+		t.Fatal("load() accepted a broken key")
+	}
+	if err := get(); err != nil {
+		t.Fatalf("request after a failed reload: %v", err)
+	}
+
+	if got := strings.Join(clients(), ","); got != "first,second,second" {
+		t.Errorf("client certificates = %q, want first,second,second", got)
+	}
+}
@@ -0,0 +1,216 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/trixsec-dev/trix/internal/tools/trivy"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+)
+
+// watcher applies VulnerabilityReport watch events to the store as they
+// arrive and batches the resulting notifications. Upserts happen per event,
+// so findings that only exist briefly are still recorded; marking fixed and
+// emitting events waits until the stream has been quiet for the debounce
+// period (or maxWait has passed), so an operator rescan that replaces many
+// reports produces one batch instead of a flood.
+type watcher struct {
+	poller   *Poller
+	debounce time.Duration
+	maxWait  time.Duration
+
+	mu      sync.Mutex
+	reports map[string][]*VulnerabilityRecord // Report key -> records it currently reports
+	pending []VulnerabilityEvent              // NEW events since the last flush
+	kick    chan struct{}
+}
+
+// Watch starts informers on VulnerabilityReports and ClusterVulnerabilityReports
+// and returns a channel of debounced event batches. When stop is closed it
+// stops the informers, sends what they recorded since the last batch without
+// waiting for the debounce, and closes the channel; when ctx is done it
+// closes the channel right away.
+func (p *Poller) Watch(ctx context.Context, stop <-chan struct{}, debounce time.Duration) <-chan []VulnerabilityEvent {
+	w := &watcher{
+		poller:   p,
+		debounce: debounce,
+		maxWait:  10 * debounce,
+		reports:  make(map[string][]*VulnerabilityRecord),
+		kick:     make(chan struct{}, 1),
+	}
+	batches := make(chan []VulnerabilityEvent)
+	go w.run(ctx, stop, batches)
+	return batches
+}
+
+func (w *watcher) run(ctx context.Context, stop <-chan struct{}, batches chan<- []VulnerabilityEvent) {
+	defer close(batches)
+	logger := w.poller.logger
+
+	// Informers stop at shutdown; upserts they attempt afterwards fail
+	// instead of recording findings no batch will report.
+	informCtx, cancelInform := context.WithCancel(ctx)
+	defer cancelInform()
+	go func() {
+		select {
+		case <-stop:
+			cancelInform()
+		case <-informCtx.Done():
+		}
+	}()
+	client := w.poller.trivyClient.DynamicClient()
+
+	namespaces := w.poller.config.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+
+	var synced []cache.InformerSynced
+	for _, ns := range namespaces {
+		factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(client, 0, ns, nil)
+		synced = append(synced, w.inform(informCtx, factory, trivy.VulnerabilityReportGVR, w.poller.trivyClient.VulnerabilityReportFindings))
+		factory.Start(informCtx.Done())
+	}
+	clusterFactory := dynamicinformer.NewDynamicSharedInformerFactory(client, 0)
+	synced = append(synced, w.inform(informCtx, clusterFactory, trivy.ClusterVulnerabilityReportGVR, w.poller.trivyClient.ClusterVulnerabilityReportFindings))
+	clusterFactory.Start(informCtx.Done())
+
+	logger.Info("starting watch", "namespaces", w.poller.config.Namespaces, "debounce", w.debounce)
+
+	// Marking fixed against a partial cache would close everything not yet
+	// listed, so nothing is flushed until every informer has synced.
+	if !cache.WaitForCacheSync(informCtx.Done(), synced...) {
+		return
+	}
+	logger.Info("watch caches synced")
+
+	var quiet, deadline <-chan time.Time
+	for {
+		stopping := false
+		select {
+		case <-ctx.Done():
+			return
+		case <-stop:
+			stopping = true
+		case <-w.kick:
+			quiet = time.After(w.debounce)
+			if deadline == nil {
+				deadline = time.After(w.maxWait)
+			}
+			continue
+		case <-quiet:
+		case <-deadline:
+		}
+		quiet, deadline = nil, nil
+
+		events := w.flush(ctx)
+		if len(events) > 0 {
+			select {
+			case batches <- events:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if stopping {
+			logger.Info("watch stopped")
+			return
+		}
+	}
+}
+
+// inform registers event handlers for one GVR and returns its sync check.
+func (w *watcher) inform(ctx context.Context, factory dynamicinformer.DynamicSharedInformerFactory, gvr schema.GroupVersionResource, findings func(map[string]interface{}) []trivy.Finding) cache.InformerSynced {
+	informer := factory.ForResource(gvr).Informer()
+
+	update := func(obj interface{}) {
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			return
+		}
+		key, err := cache.MetaNamespaceKeyFunc(u)
+		if err != nil {
+			return
+		}
+		var records []*VulnerabilityRecord
+		for _, f := range findings(u.Object) {
+			if f.Type == trivy.FindingTypeVulnerability {
+				records = append(records, w.poller.findingToRecord(f))
+			}
+		}
+		w.poller.enrichExposure(ctx, records)
+		w.set(ctx, gvr.Resource+"/"+key, records)
+	}
+
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    update,
+		UpdateFunc: func(_, obj interface{}) { update(obj) },
+		DeleteFunc: func(obj interface{}) {
+			key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+			if err != nil {
+				return
+			}
+			w.set(ctx, gvr.Resource+"/"+key, nil)
+		},
+	})
+	if err != nil {
+		w.poller.logger.Error("failed to add watch handler", "resource", gvr.Resource, "error", err)
+	}
+	return informer.HasSynced
+}
+
+// set replaces the records a report contributes (nil for a deleted report)
+// and upserts them right away.
+func (w *watcher) set(ctx context.Context, key string, records []*VulnerabilityRecord) {
+	// Hold the poller lock across the upsert and the map update so a flush
+	// never sees a record in the store that is missing from reports.
+	w.poller.mu.Lock()
+	events := w.poller.upsert(ctx, records)
+	w.mu.Lock()
+	if records == nil {
+		delete(w.reports, key)
+	} else {
+		w.reports[key] = records
+	}
+	w.pending = append(w.pending, events...)
+	w.mu.Unlock()
+	w.poller.mu.Unlock()
+
+	select {
+	case w.kick <- struct{}{}:
+	default:
+	}
+}
+
+// flush marks vulnerabilities no report mentions any more as fixed and
+// returns everything that changed since the last flush.
+func (w *watcher) flush(ctx context.Context) []VulnerabilityEvent {
+	w.poller.mu.Lock()
+	defer w.poller.mu.Unlock()
+
+	w.mu.Lock()
+	var open []*VulnerabilityRecord
+	for _, records := range w.reports {
+		open = append(open, records...)
+	}
+	events := w.pending
+	w.pending = nil
+	w.mu.Unlock()
+
+	// Only vulnerabilities are watched; other kinds are reconciled by the
+	// full polls at TRIX_WATCH_RESYNC.
+	events = append(events, w.poller.markFixed(ctx, []string{KindVulnerability}, open)...)
+	events = summarizeImageChanges(events)
+	if len(events) > 0 {
+		sortEvents(events)
+		w.poller.logger.Info("watch update", "image_changed", countByType(events, "IMAGE_CHANGED"), "new", countByType(events, "NEW"), "severity_changed", countByType(events, "SEVERITY_CHANGED"), "fixed", countByType(events, "FIXED"))
+	}
+	if w.poller.exposure != nil {
+		w.poller.exposure.reset()
+	}
+	return events
+}
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/trixsec-dev/trix/internal/tools/trivy"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+var (
+	watchCritical = fixtureVuln{"CVE-2024-0001", "CRITICAL", "openssl", "3.0.1", "3.0.8"}
+	watchHigh     = fixtureVuln{"CVE-2024-0002", "HIGH", "zlib", "1.2.11", "1.2.12"}
+	watchMedium   = fixtureVuln{"CVE-2024-0003", "MEDIUM", "curl", "8.0", "8.1"}
+)
+
+// testWatch starts a watch on dyn with a short debounce and stops it when
+// the test ends
+func testWatch(t *testing.T, cfg *Config, db Store, dyn *dynamicfake.FakeDynamicClient, debounce time.Duration) (<-chan []VulnerabilityEvent, chan struct{}) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	stop := make(chan struct{})
+	batches := testPoller(cfg, db, dyn).Watch(ctx, stop, debounce)
+	t.Cleanup(cancel)
+	return batches, stop
+}
+
+// nextBatch waits for the next batch of events and returns "TYPE CVE" keys
+func nextBatch(t *testing.T, batches <-chan []VulnerabilityEvent) []string {
+	t.Helper()
+	select {
+	case events, ok := <-batches:
+		if !ok {
+			t.Fatal("watch stopped")
+		}
+		var keys []string
+		for _, e := range events {
+			keys = append(keys, e.Type+" "+e.CVE)
+		}
+		sort.Strings(keys)
+		return keys
+	case <-time.After(10 * time.Second):
+		t.Fatal("no batch from the watch")
+		return nil
+	}
+}
+
+// reports changes the VulnerabilityReports of a namespace in dyn
+func reports(dyn *dynamicfake.FakeDynamicClient, ns string) dynamic.ResourceInterface {
+	return dyn.Resource(trivy.VulnerabilityReportGVR).Namespace(ns)
+}
+
+func TestWatchIncremental(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryStore()
+	dyn := fakeDynamic(vulnReport("payments", "api", "sha256:aaa", watchCritical, watchHigh))
+	batches, _ := testWatch(t, testConfig(t, nil), db, dyn, 20*time.Millisecond)
+
+	// The initial list is one batch
+	if got := fmt.Sprint(nextBatch(t, batches)); got != "[NEW CVE-2024-0001 NEW CVE-2024-0002]" {
+		t.Errorf("initial batch = %s", got)
+	}
+
+	// A rescan adds one CVE and drops another
+	if _, err := reports(dyn, "payments").Update(ctx, vulnReport("payments", "api", "sha256:aaa", watchCritical, watchMedium), metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(nextBatch(t, batches)); got != "[FIXED CVE-2024-0002 NEW CVE-2024-0003]" {
+		t.Errorf("update batch = %s", got)
+	}
+
+	// A new report in another namespace
+	if _, err := reports(dyn, "shop").Create(ctx, vulnReport("shop", "web", "sha256:bbb", watchHigh), metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(nextBatch(t, batches)); got != "[NEW CVE-2024-0002]" {
+		t.Errorf("create batch = %s", got)
+	}
+
+	// Deleting a report fixes what only it reported
+	if err := reports(dyn, "payments").Delete(ctx, "replicaset-api-app", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(nextBatch(t, batches)); got != "[FIXED CVE-2024-0001 FIXED CVE-2024-0003]" {
+		t.Errorf("delete batch = %s", got)
+	}
+
+	open, err := db.GetOpenVulnerabilities(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(open) != 1 || open[0].Workload != "shop/Deployment/web" {
+		t.Errorf("open after the watch = %+v", open)
+	}
+}
+
+// An operator rescan replacing many reports at once notifies once
+func TestWatchDebounce(t *testing.T) {
+	ctx := context.Background()
+	dyn := fakeDynamic(vulnReport("payments", "api", "sha256:aaa", watchHigh))
+	batches, _ := testWatch(t, testConfig(t, nil), NewMemoryStore(), dyn, 200*time.Millisecond)
+	nextBatch(t, batches) // Synced
+
+	for i := 0; i < 20; i++ {
+		report := vulnReport("payments", fmt.Sprintf("app-%02d", i), "sha256:aaa", watchCritical)
+		if _, err := reports(dyn, "payments").Create(ctx, report, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if got := nextBatch(t, batches); len(got) != 20 {
+		t.Errorf("rescan batch has %d events, want all 20", len(got))
+	}
+	select {
+	case events := <-batches:
+		t.Errorf("second batch of %d events for one rescan", len(events))
+	case <-time.After(400 * time.Millisecond):
+	}
+}
+
+// Stopping sends what was recorded without waiting for the debounce
+func TestWatchStopFlushes(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryStore()
+	dyn := fakeDynamic(vulnReport("payments", "api", "sha256:aaa", watchHigh))
+	debounce := 500 * time.Millisecond
+	batches, stop := testWatch(t, testConfig(t, nil), db, dyn, debounce)
+	nextBatch(t, batches) // Synced
+
+	if _, err := reports(dyn, "shop").Create(ctx, vulnReport("shop", "web", "sha256:bbb", watchCritical), metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the upsert", func() bool {
+		open, err := db.GetOpenVulnerabilities(ctx)
+		return err == nil && len(open) == 2
+	})
+	close(stop)
+
+	select {
+	case events := <-batches:
+		if len(events) != 1 || events[0].Type != "NEW" || events[0].CVE != watchCritical.CVE {
+			t.Errorf("batch at stop = %+v", events)
+		}
+	case <-time.After(debounce / 2):
+		t.Fatal("stop waited for the debounce")
+	}
+	select {
+	case _, ok := <-batches:
+		if ok {
+			t.Error("batch after the final flush")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("batches not closed after stop")
+	}
+}
+
+// With TRIX_NAMESPACES only those namespaces are watched and reconciled
+func TestWatchNamespaces(t *testing.T) {
+	db := NewMemoryStore()
+	// Open before the watch, in a namespace it doesn't cover
+	mustUpsert(t, db, storeRecord("other", "kube-system", KindVulnerability, "HIGH"))
+
+	dyn := fakeDynamic(
+		vulnReport("payments", "api", "sha256:aaa", watchCritical),
+		vulnReport("shop", "web", "sha256:bbb", watchHigh),
+	)
+	batches, _ := testWatch(t, testConfig(t, map[string]string{"TRIX_NAMESPACES": "payments"}), db, dyn, 20*time.Millisecond)
+
+	if got := fmt.Sprint(nextBatch(t, batches)); got != "[NEW CVE-2024-0001]" {
+		t.Errorf("initial batch = %s, want payments only", got)
+	}
+	if v := mustGet(t, db, "other"); v.State != StateOpen {
+		t.Error("vulnerability outside the watched namespaces marked fixed")
+	}
+}
@@ -34,9 +34,26 @@ const (
 	ExposureLevelNone ExposureLevel = "none"
 )
 
+// Rank orders exposure levels from most to least exposed (external = 1).
+// Unknown levels rank last.
+func (l ExposureLevel) Rank() int {
+	switch l {
+	case ExposureLevelExternal:
+		return 1
+	case ExposureLevelNodePort:
+		return 2
+	case ExposureLevelClusterInternal:
+		return 3
+	case ExposureLevelNone:
+		return 4
+	default:
+		return 5
+	}
+}
+
 // Workload identifies a kubernetes workload to analyze
 type Workload struct {
-	Kind      string            `json:"kind"` // Deployment, DaemonSet, StatefulSet, Pod
+	Kind      string            `json:"kind"` // Deployment, ReplicaSet, DaemonSet, StatefulSet, Pod
 	Name      string            `json:"name"`
 	Namespace string            `json:"namespace"`
 	Labels    map[string]string `json:"labels"`
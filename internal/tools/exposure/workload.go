@@ -0,0 +1,78 @@
+package exposure
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// NewDefaultAnalyzer creates an analyzer with all built-in checkers
+func NewDefaultAnalyzer(clientset kubernetes.Interface, dynamicClient dynamic.Interface) *Analyzer {
+	return NewAnalyzer(
+		NewServiceChecker(clientset),
+		NewIngressChecker(clientset),
+		NewGatewayChecker(clientset, dynamicClient),
+	)
+}
+
+// ResolveWorkload looks up a workload and returns it with the labels its pods
+// carry, which is what Service selectors match against.
+func ResolveWorkload(ctx context.Context, clientset kubernetes.Interface, kind, name, namespace string) (Workload, error) {
+	labels, err := workloadLabels(ctx, clientset, kind, name, namespace)
+	if err != nil {
+		return Workload{}, err
+	}
+	return Workload{
+		Kind:      kind,
+		Name:      name,
+		Namespace: namespace,
+		Labels:    labels,
+	}, nil
+}
+
+// workloadLabels fetches the pod template labels for a workload
+func workloadLabels(ctx context.Context, clientset kubernetes.Interface, kind, name, namespace string) (map[string]string, error) {
+	switch kind {
+	case "Deployment":
+		deploy, err := clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return deploy.Spec.Selector.MatchLabels, nil
+
+	case "ReplicaSet":
+		// Trivy Operator reports Deployment pods under their ReplicaSet
+		rs, err := clientset.AppsV1().ReplicaSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return rs.Spec.Selector.MatchLabels, nil
+
+	case "DaemonSet":
+		ds, err := clientset.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return ds.Spec.Selector.MatchLabels, nil
+
+	case "StatefulSet":
+		sts, err := clientset.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return sts.Spec.Selector.MatchLabels, nil
+
+	case "Pod":
+		pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return pod.Labels, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported workload kind: %s (use Deployment, ReplicaSet, DaemonSet, StatefulSet, or Pod)", kind)
+	}
+}
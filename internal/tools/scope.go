@@ -0,0 +1,236 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/trixsec-dev/trix/internal/tools/kubectl"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// clusterScopedResources are kubectl resource names that are not namespaced.
+// kubectl silently ignores -n for these, so scoped registries reject them.
+// Discovery is authoritative; this list is the fallback when the API server
+// can't be asked.
+var clusterScopedResources = map[string]bool{
+	"node": true, "nodes": true, "no": true,
+	"namespace": true, "namespaces": true, "ns": true,
+	"clusterrole": true, "clusterroles": true,
+	"clusterrolebinding": true, "clusterrolebindings": true,
+	"persistentvolume": true, "persistentvolumes": true, "pv": true,
+	"storageclass": true, "storageclasses": true, "sc": true,
+	"customresourcedefinition": true, "customresourcedefinitions": true, "crd": true, "crds": true,
+	"priorityclass": true, "priorityclasses": true,
+	"validatingwebhookconfiguration": true, "validatingwebhookconfigurations": true,
+	"mutatingwebhookconfiguration": true, "mutatingwebhookconfigurations": true,
+	"ingressclass": true, "ingressclasses": true,
+	"gatewayclass": true, "gatewayclasses": true,
+}
+
+// fanOutTools query all namespaces when called without one. Scoped to
+// several namespaces, they run once per allowed namespace and merge the
+// results; the other tools need the model to pick a namespace.
+var fanOutTools = map[string]bool{
+	"kubectl_list":        true,
+	"trix_findings":       true,
+	"trix_finding_detail": true,
+	"trix_summary":        true,
+	"trix_sbom_summary":   true,
+	"trix_sbom_search":    true,
+	"trix_sbom_image":     true,
+}
+
+// RestrictNamespaces limits every tool call to the given namespaces.
+// Model-supplied namespaces outside the list are rejected, missing namespaces
+// are filled in when only one is allowed, and all-namespace queries are
+// narrowed to the allowed namespaces. Passing no namespaces removes the
+// restriction.
+func (r *Registry) RestrictNamespaces(namespaces ...string) {
+	r.scope = nil
+	for _, ns := range namespaces {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			r.scope = append(r.scope, ns)
+		}
+	}
+}
+
+// Namespaces returns the allowed namespaces, or nil if unrestricted
+func (r *Registry) Namespaces() []string {
+	return r.scope
+}
+
+// argvParams are tool params passed to kubectl as arguments. A value that
+// starts with - would be parsed as a flag, e.g. a name of -A overrides -n.
+var argvParams = []string{"resource", "name", "pod", "selector"}
+
+// applyScope returns a copy of params with the namespace enforced
+func (r *Registry) applyScope(tool string, params map[string]interface{}) (map[string]interface{}, error) {
+	scoped := make(map[string]interface{}, len(params)+1)
+	for k, v := range params {
+		scoped[k] = v
+	}
+
+	for _, key := range argvParams {
+		if v, _ := scoped[key].(string); strings.HasPrefix(strings.TrimSpace(v), "-") {
+			return nil, fmt.Errorf("%s %q is not allowed: this session is restricted to namespace(s) %s",
+				key, v, strings.Join(r.scope, ", "))
+		}
+	}
+
+	// Narrow all-namespace listings to the scope
+	delete(scoped, "all_namespaces")
+
+	if resource, _ := scoped["resource"].(string); resource != "" {
+		if err := r.checkResources(resource); err != nil {
+			return nil, err
+		}
+	}
+
+	ns, _ := scoped["namespace"].(string)
+	switch {
+	case ns == "" && len(r.scope) == 1:
+		scoped["namespace"] = r.scope[0]
+	case ns == "" && fanOutTools[tool]:
+		// Run per allowed namespace, see fanOutNamespaces
+	case ns == "":
+		return nil, fmt.Errorf("%s requires a namespace: this session is restricted to namespace(s) %s",
+			tool, strings.Join(r.scope, ", "))
+	case !r.namespaceAllowed(ns):
+		return nil, fmt.Errorf("namespace %q is not allowed: this session is restricted to namespace(s) %s",
+			ns, strings.Join(r.scope, ", "))
+	}
+
+	return scoped, nil
+}
+
+// checkResources rejects a kubectl resource argument that names a
+// cluster-scoped type. kubectl accepts comma-separated types, TYPE/NAME and
+// group-qualified types such as clusterroles.rbac.authorization.k8s.io.
+func (r *Registry) checkResources(resource string) error {
+	for _, item := range strings.Split(resource, ",") {
+		typ, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(item)), "/")
+		name, _, _ := strings.Cut(typ, ".")
+		if name == "" {
+			continue
+		}
+		namespaced, err := r.resourceNamespaced(name)
+		if err != nil {
+			return err
+		}
+		if !namespaced {
+			return fmt.Errorf("%s is cluster-scoped and not available: this session is restricted to namespace(s) %s",
+				strings.TrimSpace(item), strings.Join(r.scope, ", "))
+		}
+	}
+	return nil
+}
+
+// resourceNamespaced reports whether a resource type is namespaced. name
+// matches the plural, singular, kind, a short name or a category such as
+// all. A name that also matches a cluster-scoped type counts as
+// cluster-scoped.
+func (r *Registry) resourceNamespaced(name string) (bool, error) {
+	lists := r.apiResourceLists()
+	if len(lists) == 0 {
+		return !clusterScopedResources[name], nil
+	}
+	found := false
+	for _, list := range lists {
+		for _, res := range list.APIResources {
+			if strings.Contains(res.Name, "/") || !resourceMatches(res, name) {
+				continue // Subresource or another type
+			}
+			if !res.Namespaced {
+				return false, nil
+			}
+			found = true
+		}
+	}
+	if !found {
+		return false, fmt.Errorf("unknown resource type %q: this session is restricted to namespace(s) %s",
+			name, strings.Join(r.scope, ", "))
+	}
+	return true, nil
+}
+
+func resourceMatches(res metav1.APIResource, name string) bool {
+	if res.Name == name || res.SingularName == name || strings.ToLower(res.Kind) == name {
+		return true
+	}
+	for _, aliases := range [][]string{res.ShortNames, res.Categories} {
+		for _, alias := range aliases {
+			if alias == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// apiResourceLists returns the resource types the API server serves, or nil
+// if it can't be reached. A successful lookup is cached.
+func (r *Registry) apiResourceLists() []*metav1.APIResourceList {
+	if r.apiResources != nil {
+		return r.apiResources
+	}
+	if r.discovery == nil {
+		client, err := kubectl.NewClient()
+		if err != nil {
+			return nil
+		}
+		r.discovery = client.Clientset().Discovery()
+	}
+	// Groups that fail discovery are left out; their types count as unknown
+	_, lists, _ := r.discovery.ServerGroupsAndResources()
+	r.apiResources = lists
+	return lists
+}
+
+// namespaceAllowed reports whether ns is within scope (always true when unrestricted)
+func (r *Registry) namespaceAllowed(ns string) bool {
+	if len(r.scope) == 0 {
+		return true
+	}
+	for _, allowed := range r.scope {
+		if ns == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// inScope reports whether a finding (as decoded JSON) belongs to an allowed
+// namespace. Cluster-scoped findings have no namespace and are excluded when
+// the registry is restricted.
+func (r *Registry) inScope(finding map[string]interface{}) bool {
+	ns, _ := finding["namespace"].(string)
+	return r.namespaceAllowed(ns)
+}
+
+// fanOutNamespaces returns the namespaces an all-namespace tool call has to
+// be run in one at a time: every allowed namespace when scoped to several and
+// the call names none, otherwise nil.
+func (r *Registry) fanOutNamespaces(params map[string]interface{}) []string {
+	if ns, _ := params["namespace"].(string); ns != "" || len(r.scope) < 2 {
+		return nil
+	}
+	return r.scope
+}
+
+// withNamespace returns a copy of params for namespace ns
+func withNamespace(params map[string]interface{}, ns string) map[string]interface{} {
+	p := make(map[string]interface{}, len(params)+1)
+	for k, v := range params {
+		p[k] = v
+	}
+	p["namespace"] = ns
+	return p
+}
+
+// appendNamespaceArgs adds -n <namespace> when the tool call has one, otherwise -A
+func appendNamespaceArgs(args []string, params map[string]interface{}) []string {
+	if ns, _ := params["namespace"].(string); ns != "" {
+		return append(args, "-n", ns)
+	}
+	return append(args, "-A")
+}
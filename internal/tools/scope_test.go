@@ -0,0 +1,367 @@
+package tools
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/trixsec-dev/trix/internal/llm"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// recordingRegistry returns a registry whose tools record the parameters
+// their executor was called with instead of running kubectl or trix.
+func recordingRegistry(names ...string) (*Registry, map[string]map[string]interface{}) {
+	r := &Registry{
+		tools:     make(map[string]llm.Tool),
+		executors: make(map[string]Executor),
+		disabled:  make(map[string]bool),
+		discovery: fakeDiscovery(),
+	}
+	got := make(map[string]map[string]interface{})
+	for _, name := range names {
+		name := name
+		r.register(llm.Tool{Name: name}, func(ctx context.Context, params map[string]interface{}) (string, error) {
+			got[name] = params
+			return "ok", nil
+		})
+	}
+	return r, got
+}
+
+// fakeDiscovery serves a few core, apps and RBAC resource types
+func fakeDiscovery() *fakediscovery.FakeDiscovery {
+	return &fakediscovery.FakeDiscovery{
+		Fake: &k8stesting.Fake{
+			Resources: []*metav1.APIResourceList{
+				{GroupVersion: "v1", APIResources: []metav1.APIResource{
+					{Name: "pods", SingularName: "pod", Kind: "Pod", Namespaced: true, ShortNames: []string{"po"}, Categories: []string{"all"}},
+					{Name: "pods/log", Kind: "Pod", Namespaced: true},
+					{Name: "services", SingularName: "service", Kind: "Service", Namespaced: true, ShortNames: []string{"svc"}, Categories: []string{"all"}},
+					{Name: "nodes", SingularName: "node", Kind: "Node", ShortNames: []string{"no"}},
+					{Name: "namespaces", SingularName: "namespace", Kind: "Namespace", ShortNames: []string{"ns"}},
+				}},
+				{GroupVersion: "apps/v1", APIResources: []metav1.APIResource{
+					{Name: "deployments", SingularName: "deployment", Kind: "Deployment", Namespaced: true, ShortNames: []string{"deploy"}, Categories: []string{"all"}},
+				}},
+				{GroupVersion: "rbac.authorization.k8s.io/v1", APIResources: []metav1.APIResource{
+					{Name: "roles", SingularName: "role", Kind: "Role", Namespaced: true},
+					{Name: "clusterroles", SingularName: "clusterrole", Kind: "ClusterRole"},
+					{Name: "clusterrolebindings", SingularName: "clusterrolebinding", Kind: "ClusterRoleBinding"},
+				}},
+			},
+		},
+	}
+}
+
+func TestRestrictNamespaces(t *testing.T) {
+	r, _ := recordingRegistry()
+	if r.Namespaces() != nil {
+		t.Errorf("new registry is scoped to %v", r.Namespaces())
+	}
+	r.RestrictNamespaces(" payments ", "", "billing")
+	if want := []string{"payments", "billing"}; !reflect.DeepEqual(r.Namespaces(), want) {
+		t.Errorf("Namespaces() = %v, want %v", r.Namespaces(), want)
+	}
+	r.RestrictNamespaces()
+	if r.Namespaces() != nil {
+		t.Errorf("scope not removed: %v", r.Namespaces())
+	}
+}
+
+func TestScopeInjectsNamespace(t *testing.T) {
+	r, got := recordingRegistry("trix_findings", "kubectl_list", "check_exposure")
+	r.RestrictNamespaces("payments")
+	ctx := context.Background()
+
+	for _, tool := range []string{"trix_findings", "kubectl_list", "check_exposure"} {
+		if _, err := r.Execute(ctx, tool, map[string]interface{}{"severity": "CRITICAL"}); err != nil {
+			t.Fatalf("%s: %v", tool, err)
+		}
+		want := map[string]interface{}{"severity": "CRITICAL", "namespace": "payments"}
+		if !reflect.DeepEqual(got[tool], want) {
+			t.Errorf("%s got %v, want %v", tool, got[tool], want)
+		}
+	}
+
+	// The caller's params are left alone
+	params := map[string]interface{}{"resource": "pods"}
+	if _, err := r.Execute(ctx, "kubectl_list", params); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := params["namespace"]; ok {
+		t.Error("Execute modified the caller's params")
+	}
+}
+
+func TestScopeRejectsOtherNamespaces(t *testing.T) {
+	r, got := recordingRegistry("kubectl_list", "check_exposure")
+	r.RestrictNamespaces("payments", "billing")
+	ctx := context.Background()
+
+	_, err := r.Execute(ctx, "check_exposure", map[string]interface{}{"namespace": "kube-system", "name": "api"})
+	if err == nil || err.Error() != `namespace "kube-system" is not allowed: this session is restricted to namespace(s) payments, billing` {
+		t.Errorf("foreign namespace err = %v", err)
+	}
+	if _, ran := got["check_exposure"]; ran {
+		t.Error("executor ran for a foreign namespace")
+	}
+
+	// With several namespaces allowed, single-namespace tools need one picked
+	_, err = r.Execute(ctx, "check_exposure", map[string]interface{}{"name": "api"})
+	if err == nil || !strings.HasPrefix(err.Error(), "check_exposure requires a namespace") {
+		t.Errorf("missing namespace err = %v", err)
+	}
+
+	if _, err := r.Execute(ctx, "kubectl_list", map[string]interface{}{"resource": "pods", "namespace": "billing"}); err != nil {
+		t.Errorf("allowed namespace: %v", err)
+	}
+	if got["kubectl_list"]["namespace"] != "billing" {
+		t.Errorf("namespace = %v, want billing", got["kubectl_list"]["namespace"])
+	}
+}
+
+func TestScopeNarrowsAllNamespaces(t *testing.T) {
+	r, got := recordingRegistry("kubectl_list")
+	r.RestrictNamespaces("payments")
+
+	params := map[string]interface{}{"resource": "pods", "all_namespaces": true}
+	if _, err := r.Execute(context.Background(), "kubectl_list", params); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"resource": "pods", "namespace": "payments"}
+	if !reflect.DeepEqual(got["kubectl_list"], want) {
+		t.Errorf("params = %v, want %v", got["kubectl_list"], want)
+	}
+	if args := appendNamespaceArgs(nil, got["kubectl_list"]); !reflect.DeepEqual(args, []string{"-n", "payments"}) {
+		t.Errorf("kubectl args = %v, want -n payments", args)
+	}
+	if args := appendNamespaceArgs(nil, map[string]interface{}{}); !reflect.DeepEqual(args, []string{"-A"}) {
+		t.Errorf("unscoped kubectl args = %v, want -A", args)
+	}
+}
+
+func TestScopeRejectsClusterScopedResources(t *testing.T) {
+	r, got := recordingRegistry("kubectl_list")
+	r.RestrictNamespaces("payments")
+
+	for _, resource := range []string{
+		"nodes", "ClusterRoleBindings", "ns", " NO ", "Node",
+		"pods,nodes", "node/worker-1", "clusterroles.rbac.authorization.k8s.io", "nodes.v1.",
+	} {
+		_, err := r.Execute(context.Background(), "kubectl_list", map[string]interface{}{"resource": resource})
+		if err == nil || !strings.Contains(err.Error(), "is cluster-scoped and not available") {
+			t.Errorf("%s err = %v", resource, err)
+		}
+	}
+	if _, ran := got["kubectl_list"]; ran {
+		t.Error("executor ran for a cluster-scoped resource")
+	}
+}
+
+func TestScopeAllowsNamespacedResources(t *testing.T) {
+	r, _ := recordingRegistry("kubectl_list")
+	r.RestrictNamespaces("payments")
+
+	for _, resource := range []string{"pods", "Deployment", "deployments.apps", "po/api-0", "pods,svc", "all"} {
+		if _, err := r.Execute(context.Background(), "kubectl_list", map[string]interface{}{"resource": resource}); err != nil {
+			t.Errorf("%s: %v", resource, err)
+		}
+	}
+}
+
+func TestScopeRejectsUnknownResources(t *testing.T) {
+	r, got := recordingRegistry("kubectl_list")
+	r.RestrictNamespaces("payments")
+
+	_, err := r.Execute(context.Background(), "kubectl_list", map[string]interface{}{"resource": "pods,widgets"})
+	if err == nil || !strings.Contains(err.Error(), `unknown resource type "widgets"`) {
+		t.Errorf("err = %v", err)
+	}
+	if _, ran := got["kubectl_list"]; ran {
+		t.Error("executor ran for an unknown resource")
+	}
+}
+
+// Without discovery the static list of cluster-scoped types applies
+func TestScopeResourcesWithoutDiscovery(t *testing.T) {
+	r, _ := recordingRegistry("kubectl_list")
+	r.discovery = &fakediscovery.FakeDiscovery{Fake: &k8stesting.Fake{}}
+	r.RestrictNamespaces("payments")
+
+	for resource, allowed := range map[string]bool{"pods": true, "widgets": true, "nodes.v1.": false, "pods,pv": false, "crd/foo": false} {
+		_, err := r.Execute(context.Background(), "kubectl_list", map[string]interface{}{"resource": resource})
+		if (err == nil) != allowed {
+			t.Errorf("%s err = %v, want allowed=%v", resource, err, allowed)
+		}
+	}
+}
+
+func TestUnscopedRegistryPassesParams(t *testing.T) {
+	r, got := recordingRegistry("kubectl_list")
+	params := map[string]interface{}{"resource": "nodes", "all_namespaces": true}
+	if _, err := r.Execute(context.Background(), "kubectl_list", params); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got["kubectl_list"], params) {
+		t.Errorf("params = %v, want %v", got["kubectl_list"], params)
+	}
+}
+
+func TestScopeFiltersFindings(t *testing.T) {
+	findings := `[
+		{"id": "vuln:payments/api/CVE-1", "severity": "CRITICAL", "type": "vulnerability", "namespace": "payments", "resourceName": "api", "title": "openssl"},
+		{"id": "vuln:shop/web/CVE-2", "severity": "CRITICAL", "type": "vulnerability", "namespace": "shop", "resourceName": "web", "title": "curl"},
+		{"id": "rbac:cluster-admin", "severity": "HIGH", "type": "rbac", "resourceName": "cluster-admin", "title": "wildcard"}
+	]`
+
+	r, _ := recordingRegistry()
+	page, err := r.pageFindings(findings, "", "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 3 {
+		t.Errorf("unscoped total = %d, want 3", page.Total)
+	}
+
+	r.RestrictNamespaces("payments")
+	page, err = r.pageFindings(findings, "", "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 1 || len(page.Rows) != 1 || !strings.HasPrefix(page.Rows[0], "vuln:payments/api/CVE-1 |") {
+		t.Errorf("scoped page = %+v, want only the payments finding", page)
+	}
+}
+
+// SBOM tools and the summary leave out cluster-scoped data when scoped
+func TestScopeFiltersSBOMsAndSummary(t *testing.T) {
+	sboms := `[
+		{"name": "api", "namespace": "payments", "image": "example/api:1.0", "components": [{"name": "openssl", "version": "3.0.1", "type": "library"}]},
+		{"name": "node-agent", "image": "example/node-agent:2.0", "components": [{"name": "openssl", "version": "1.1.1", "type": "library"}]}
+	]`
+	ctx := context.Background()
+	r := NewRegistry()
+
+	fakeCommands(t, sboms)
+	out, err := r.Execute(ctx, "trix_sbom_search", map[string]interface{}{"package": "openssl"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "example/node-agent:2.0 |  | openssl | 1.1.1 | library") {
+		t.Errorf("unscoped search left out the cluster-scoped image:\n%s", out)
+	}
+
+	r.RestrictNamespaces("payments")
+	for _, tool := range []string{"trix_sbom_search", "trix_sbom_summary", "trix_sbom_image"} {
+		calls := fakeCommands(t, sboms)
+		out, err := r.Execute(ctx, tool, map[string]interface{}{"package": "openssl", "image": "node-agent"})
+		if err != nil {
+			t.Fatalf("%s: %v", tool, err)
+		}
+		if strings.Contains(out, "node-agent:2.0 |") || strings.Contains(out, "SBOM for: example/node-agent") || strings.Contains(out, "Total images scanned: 2") {
+			t.Errorf("%s returned the cluster-scoped image:\n%s", tool, out)
+		}
+		if got := calls(); len(got) != 1 || !strings.Contains(got[0], " -n payments") {
+			t.Errorf("%s ran %q", tool, got)
+		}
+	}
+
+	calls := fakeCommands(t, "summary")
+	if _, err := r.Execute(ctx, "trix_summary", nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := calls(); len(got) != 1 || got[0] != "trix query summary -n payments --namespaced-only" {
+		t.Errorf("trix_summary ran %q", got)
+	}
+}
+
+// Flag-like values would let kubectl override -n, e.g. get secrets -A
+func TestScopeRejectsFlagParams(t *testing.T) {
+	r, got := recordingRegistry("kubectl_get", "kubectl_logs", "kubectl_list")
+	r.RestrictNamespaces("payments")
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		tool   string
+		params map[string]interface{}
+	}{
+		{"kubectl_get", map[string]interface{}{"resource": "secrets", "name": "-A"}},
+		{"kubectl_get", map[string]interface{}{"resource": "secrets", "name": "--all-namespaces"}},
+		{"kubectl_get", map[string]interface{}{"resource": "-A", "name": "db"}},
+		{"kubectl_logs", map[string]interface{}{"pod": " -A", "namespace": "payments"}},
+		{"kubectl_list", map[string]interface{}{"resource": "pods", "selector": "--all-namespaces"}},
+	} {
+		if _, err := r.Execute(ctx, tc.tool, tc.params); err == nil || !strings.Contains(err.Error(), "is not allowed") {
+			t.Errorf("%s %v err = %v", tc.tool, tc.params, err)
+		}
+	}
+	if len(got) != 0 {
+		t.Errorf("executors ran for flag-like params: %v", got)
+	}
+
+	if _, err := r.Execute(ctx, "kubectl_get", map[string]interface{}{"resource": "pods", "name": "api-0"}); err != nil {
+		t.Errorf("plain name: %v", err)
+	}
+}
+
+// All-namespace tools run once per allowed namespace when scoped to several
+func TestScopeFansOutOverNamespaces(t *testing.T) {
+	r := NewRegistry()
+	r.discovery = fakeDiscovery()
+	r.RestrictNamespaces("payments", "billing")
+	ctx := context.Background()
+
+	calls := fakeCommands(t, "[]")
+	fakeNamespaceOutput(t, "payments", `[
+		{"id": "vuln:payments/api/CVE-1", "severity": "CRITICAL", "type": "vulnerability", "namespace": "payments", "resourceName": "api", "title": "openssl"},
+		{"id": "rbac:cluster-admin", "severity": "HIGH", "type": "rbac", "resourceName": "cluster-admin", "title": "wildcard"}
+	]`)
+	fakeNamespaceOutput(t, "billing", `[
+		{"id": "vuln:billing/db/CVE-2", "severity": "HIGH", "type": "vulnerability", "namespace": "billing", "resourceName": "db", "title": "curl"},
+		{"id": "rbac:cluster-admin", "severity": "HIGH", "type": "rbac", "resourceName": "cluster-admin", "title": "wildcard"}
+	]`)
+	out, err := r.Execute(ctx, "trix_findings", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "vuln:payments/api/CVE-1 |") || !strings.Contains(out, "vuln:billing/db/CVE-2 |") ||
+		strings.Contains(out, "rbac:cluster-admin") || !strings.Contains(out, "(2 matching, 2 total)") {
+		t.Errorf("trix_findings output:\n%s", out)
+	}
+	want := []string{"trix query findings -o json -n payments", "trix query findings -o json -n billing"}
+	if got := calls(); !reflect.DeepEqual(got, want) {
+		t.Errorf("trix_findings ran %q, want %q", got, want)
+	}
+
+	calls = fakeCommands(t, "")
+	fakeNamespaceOutput(t, "payments", `{"bySeverity": {"CRITICAL": 2}, "byType": {"vulnerability": 2}, "topResources": [{"resource": "payments/api", "count": 2}], "totalFindings": 2}`)
+	fakeNamespaceOutput(t, "billing", `{"bySeverity": {"CRITICAL": 1, "HIGH": 3}, "byType": {"vulnerability": 4}, "topResources": [{"resource": "billing/db", "count": 4}], "totalFindings": 4}`)
+	out, err = r.Execute(ctx, "trix_summary", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"Total Findings: 6", "  CRITICAL: 3", "  HIGH: 3", "  vulnerability: 6", "  billing/db: 4\n  payments/api: 2"} {
+		if !strings.Contains(out, line) {
+			t.Errorf("trix_summary output missing %q:\n%s", line, out)
+		}
+	}
+	if got := calls(); len(got) != 2 || got[1] != "trix query summary -o json -n billing --namespaced-only" {
+		t.Errorf("trix_summary ran %q", got)
+	}
+
+	calls = fakeCommands(t, "NAME   READY\napi-0  1/1\n")
+	out, err = r.Execute(ctx, "kubectl_list", map[string]interface{}{"resource": "pods", "all_namespaces": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "Namespace payments:\nFound 1 pods") || !strings.Contains(out, "Namespace billing:\nFound 1 pods") {
+		t.Errorf("kubectl_list output:\n%s", out)
+	}
+	if got := calls(); len(got) != 2 || got[0] != "kubectl get pods -n payments -o wide" {
+		t.Errorf("kubectl_list ran %q", got)
+	}
+}
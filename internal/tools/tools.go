@@ -4,14 +4,19 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math"
 	"os"
 	"os/exec"
+	"sort"
+	"strconv"
 	"strings"
 
+	"github.com/trixsec-dev/trix/internal/counts"
 	"github.com/trixsec-dev/trix/internal/llm"
 	"github.com/trixsec-dev/trix/internal/tools/exposure"
 	"github.com/trixsec-dev/trix/internal/tools/kubectl"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/discovery"
 )
 
 // Executor runs a tools and returns the result
@@ -21,6 +26,19 @@ type Executor func(ctx context.Context, params map[string]interface{}) (string,
 type Registry struct {
 	tools     map[string]llm.Tool
 	executors map[string]Executor
+	disabled  map[string]bool
+	scope     []string // Allowed namespaces; empty = unrestricted
+
+	// Resource types for scope checks, looked up on first use
+	discovery    discovery.DiscoveryInterface
+	apiResources []*metav1.APIResourceList
+}
+
+// ToolStatus describes a registered tool and whether the LLM may use it
+type ToolStatus struct {
+	Name        string
+	Description string
+	Enabled     bool
 }
 
 // NewRegistry creates a registry with default tools
@@ -28,26 +46,64 @@ func NewRegistry() *Registry {
 	r := &Registry{
 		tools:     make(map[string]llm.Tool),
 		executors: make(map[string]Executor),
+		disabled:  make(map[string]bool),
 	}
 	r.RegisterDefaults()
 	return r
 }
 
-// Tools returns all tool definitions for the LLM
+// Tools returns all enabled tool definitions for the LLM
 func (r *Registry) Tools() []llm.Tool {
 	var tools []llm.Tool
-	for _, t := range r.tools {
+	for name, t := range r.tools {
+		if r.disabled[name] {
+			continue
+		}
 		tools = append(tools, t)
 	}
 	return tools
 }
 
+// List returns all registered tools sorted by name, including disabled ones
+func (r *Registry) List() []ToolStatus {
+	var list []ToolStatus
+	for name, t := range r.tools {
+		list = append(list, ToolStatus{Name: name, Description: t.Description, Enabled: !r.disabled[name]})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// SetEnabled enables or disables a tool. Disabled tools are hidden from the
+// LLM and rejected by Execute.
+func (r *Registry) SetEnabled(name string, enabled bool) error {
+	if _, ok := r.tools[name]; !ok {
+		return fmt.Errorf("unknown tool: %s", name)
+	}
+	if enabled {
+		delete(r.disabled, name)
+	} else {
+		r.disabled[name] = true
+	}
+	return nil
+}
+
 // Execute runs a tool by name
 func (r *Registry) Execute(ctx context.Context, name string, params map[string]interface{}) (string, error) {
 	executor, ok := r.executors[name]
 	if !ok {
 		return "", fmt.Errorf("unknown tool: %s", name)
 	}
+	if r.disabled[name] {
+		return "", fmt.Errorf("tool %s is disabled in this session", name)
+	}
+	if len(r.scope) > 0 {
+		scoped, err := r.applyScope(name, params)
+		if err != nil {
+			return "", err
+		}
+		params = scoped
+	}
 	return executor(ctx, params)
 }
 
@@ -59,10 +115,10 @@ func (r *Registry) RegisterDefaults() {
 		Parameters: map[string]interface{}{
 			"type": "object",
 			"properties": map[string]interface{}{
-				"resource":       map[string]string{"type": "string", "description": "Resource type (pods, deployments, services, clusterrolebindings, etc.)"},
-				"namespace":      map[string]string{"type": "string", "description": "Namespace (optional, omit for current namespace)"},
-				"all_namespaces": map[string]string{"type": "boolean", "description": "List across all namespaces"},
-				"selector":       map[string]string{"type": "string", "description": "Label selector to filter (optional, e.g., 'app=nginx')"},
+				"resource":       map[string]interface{}{"type": "string", "description": "Resource type (pods, deployments, services, clusterrolebindings, etc.)"},
+				"namespace":      map[string]interface{}{"type": "string", "description": "Namespace (optional, omit for current namespace)"},
+				"all_namespaces": map[string]interface{}{"type": "boolean", "description": "List across all namespaces"},
+				"selector":       map[string]interface{}{"type": "string", "description": "Label selector to filter (optional, e.g., 'app=nginx')"},
 			},
 			"required": []string{"resource"},
 		},
@@ -75,9 +131,9 @@ func (r *Registry) RegisterDefaults() {
 		Parameters: map[string]interface{}{
 			"type": "object",
 			"properties": map[string]interface{}{
-				"resource":  map[string]string{"type": "string", "description": "Resource type (pod, deployment, service, etc.)"},
-				"name":      map[string]string{"type": "string", "description": "Resource name (REQUIRED - use kubectl_list to find names first)"},
-				"namespace": map[string]string{"type": "string", "description": "Namespace (required for namespaced resources)"},
+				"resource":  map[string]interface{}{"type": "string", "description": "Resource type (pod, deployment, service, etc.)"},
+				"name":      map[string]interface{}{"type": "string", "description": "Resource name (REQUIRED - use kubectl_list to find names first)"},
+				"namespace": map[string]interface{}{"type": "string", "description": "Namespace (required for namespaced resources)"},
 			},
 			"required": []string{"resource", "name"},
 		},
@@ -90,9 +146,9 @@ func (r *Registry) RegisterDefaults() {
 		Parameters: map[string]interface{}{
 			"type": "object",
 			"properties": map[string]interface{}{
-				"pod":       map[string]string{"type": "string", "description": "Pod name"},
-				"namespace": map[string]string{"type": "string", "description": "Namespace"},
-				"tail":      map[string]string{"type": "integer", "description": "Number of lines (default 50)"},
+				"pod":       map[string]interface{}{"type": "string", "description": "Pod name"},
+				"namespace": map[string]interface{}{"type": "string", "description": "Namespace"},
+				"tail":      map[string]interface{}{"type": "integer", "description": "Number of lines (default 50)"},
 			},
 			"required": []string{"pod", "namespace"},
 		},
@@ -105,10 +161,10 @@ func (r *Registry) RegisterDefaults() {
 		Parameters: map[string]interface{}{
 			"type": "object",
 			"properties": map[string]interface{}{
-				"namespace": map[string]string{"type": "string", "description": "Namespace to query (optional, omit for all)"},
-				"type":      map[string]string{"type": "string", "description": "Finding type: vulnerability, compliance, rbac, secret, infra (optional)"},
-				"severity":  map[string]string{"type": "string", "description": "Filter by severity: CRITICAL, HIGH, MEDIUM, LOW (optional, recommended)"},
-				"limit":     map[string]string{"type": "integer", "description": "Max findings to return (default 20)"},
+				"namespace": map[string]interface{}{"type": "string", "description": "Namespace to query (optional, omit for all)"},
+				"type":      map[string]interface{}{"type": "string", "description": "Finding type: vulnerability, compliance, rbac, secret, infra (optional)"},
+				"severity":  map[string]interface{}{"type": "string", "description": "Filter by severity: CRITICAL, HIGH, MEDIUM, LOW (optional, recommended)"},
+				"limit":     map[string]interface{}{"type": "integer", "description": "Max findings to return (default 20)"},
 			},
 		},
 	}, r.trixFindings)
@@ -116,11 +172,13 @@ func (r *Registry) RegisterDefaults() {
 	// trix_finding_detail - get full details for a specific finding
 	r.register(llm.Tool{
 		Name:        "trix_finding_detail",
-		Description: "Get full details for a specific finding by ID. Use this after trix_findings to get description, remediation steps, and raw data.",
+		Description: "Get full details for a specific finding by ID. Use this after trix_findings to get description and remediation steps. Set full to also get the raw Trivy data (package versions, failing check messages, secret match).",
 		Parameters: map[string]interface{}{
 			"type": "object",
 			"properties": map[string]interface{}{
-				"id": map[string]string{"type": "string", "description": "Finding ID from trix_findings output"},
+				"id":        map[string]interface{}{"type": "string", "description": "Finding ID from trix_findings output"},
+				"namespace": map[string]interface{}{"type": "string", "description": "Namespace of the finding (optional, speeds up the lookup)"},
+				"full":      map[string]interface{}{"type": "boolean", "description": "Include the raw Trivy data (default false, costs more tokens)"},
 			},
 			"required": []string{"id"},
 		},
@@ -133,7 +191,7 @@ func (r *Registry) RegisterDefaults() {
 		Parameters: map[string]interface{}{
 			"type": "object",
 			"properties": map[string]interface{}{
-				"namespace": map[string]string{"type": "string", "description": "Namespace to query (optional, omit for all)"},
+				"namespace": map[string]interface{}{"type": "string", "description": "Namespace to query (optional, omit for all)"},
 			},
 		},
 	}, r.trixSummary)
@@ -143,8 +201,10 @@ func (r *Registry) RegisterDefaults() {
 		Name:        "trix_sbom_summary",
 		Description: "Get SBOM summary: total images, component counts by type, top 10 most common packages. Use this FIRST before searching for specific packages.",
 		Parameters: map[string]interface{}{
-			"type":       "object",
-			"properties": map[string]interface{}{},
+			"type": "object",
+			"properties": map[string]interface{}{
+				"namespace": map[string]interface{}{"type": "string", "description": "Namespace to summarize (optional, omit for all)"},
+			},
 		},
 	}, r.trixSbomSummary)
 
@@ -155,7 +215,8 @@ func (r *Registry) RegisterDefaults() {
 		Parameters: map[string]interface{}{
 			"type": "object",
 			"properties": map[string]interface{}{
-				"package": map[string]string{"type": "string", "description": "Package name to search for (case-insensitive, partial match)"},
+				"package":   map[string]interface{}{"type": "string", "description": "Package name to search for (case-insensitive, partial match)"},
+				"namespace": map[string]interface{}{"type": "string", "description": "Namespace to search (optional, omit for all)"},
 			},
 			"required": []string{"package"},
 		},
@@ -168,7 +229,8 @@ func (r *Registry) RegisterDefaults() {
 		Parameters: map[string]interface{}{
 			"type": "object",
 			"properties": map[string]interface{}{
-				"image": map[string]string{"type": "string", "description": "Image name (partial match, e.g., 'nginx' or 'backend-api')"},
+				"image":     map[string]interface{}{"type": "string", "description": "Image name (partial match, e.g., 'nginx' or 'backend-api')"},
+				"namespace": map[string]interface{}{"type": "string", "description": "Namespace of the image (optional)"},
 			},
 			"required": []string{"image"},
 		},
@@ -181,9 +243,9 @@ func (r *Registry) RegisterDefaults() {
 		Parameters: map[string]interface{}{
 			"type": "object",
 			"properties": map[string]interface{}{
-				"name":      map[string]string{"type": "string", "description": "Workload name (e.g., 'nginx-deployment')"},
-				"namespace": map[string]string{"type": "string", "description": "Namespace"},
-				"kind":      map[string]string{"type": "string", "description": "Workload kind: Deployment, DaemonSet, StatefulSet, Pod (default: Deployment)"},
+				"name":      map[string]interface{}{"type": "string", "description": "Workload name (e.g., 'nginx-deployment')"},
+				"namespace": map[string]interface{}{"type": "string", "description": "Namespace"},
+				"kind":      map[string]interface{}{"type": "string", "description": "Workload kind: Deployment, ReplicaSet, DaemonSet, StatefulSet, Pod (default: Deployment)"},
 			},
 			"required": []string{"name", "namespace"},
 		},
@@ -195,6 +257,41 @@ func (r *Registry) register(tool llm.Tool, executor Executor) {
 	r.executors[tool.Name] = executor
 }
 
+// intParam returns the integer parameter key, or def when it is absent.
+// Models don't always honor the schema's integer type, so whole floats,
+// json.Number and numeric strings are accepted too.
+func intParam(params map[string]interface{}, key string, def int) (int, error) {
+	var f float64
+	switch v := params[key].(type) {
+	case nil:
+		return def, nil
+	case int:
+		return v, nil
+	case int64:
+		return int(v), nil
+	case float64:
+		f = v
+	case json.Number:
+		n, err := v.Float64()
+		if err != nil {
+			return 0, fmt.Errorf("%s must be an integer, got %q", key, v)
+		}
+		f = n
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return 0, fmt.Errorf("%s must be an integer, got %q", key, v)
+		}
+		f = n
+	default:
+		return 0, fmt.Errorf("%s must be an integer, got %T", key, v)
+	}
+	if f != math.Trunc(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("%s must be an integer, got %v", key, f)
+	}
+	return int(f), nil
+}
+
 // Tool implementations
 
 func (r *Registry) kubectlList(ctx context.Context, params map[string]interface{}) (string, error) {
@@ -203,6 +300,18 @@ func (r *Registry) kubectlList(ctx context.Context, params map[string]interface{
 	allNamespaces, _ := params["all_namespaces"].(bool)
 	selector, _ := params["selector"].(string)
 
+	if namespaces := r.fanOutNamespaces(params); namespaces != nil {
+		var sections []string
+		for _, ns := range namespaces {
+			output, err := r.kubectlList(ctx, withNamespace(params, ns))
+			if err != nil {
+				return output, err
+			}
+			sections = append(sections, fmt.Sprintf("Namespace %s:\n%s", ns, strings.TrimSpace(output)))
+		}
+		return strings.Join(sections, "\n\n"), nil
+	}
+
 	args := []string{"get", resource}
 	if allNamespaces {
 		args = append(args, "-A")
@@ -251,21 +360,23 @@ func (r *Registry) kubectlGet(ctx context.Context, params map[string]interface{}
 func (r *Registry) kubectlLogs(ctx context.Context, params map[string]interface{}) (string, error) {
 	pod, _ := params["pod"].(string)
 	namespace, _ := params["namespace"].(string)
-	tail := 50
-	if t, ok := params["tail"].(float64); ok {
-		tail = int(t)
+	tail, err := intParam(params, "tail", 50)
+	if err != nil {
+		return "", err
 	}
 	args := []string{"logs", pod, "-n", namespace, "--tail", fmt.Sprintf("%d", tail)}
 	return r.runCommand(ctx, "kubectl", args...)
 }
 
 func (r *Registry) trixFindings(ctx context.Context, params map[string]interface{}) (string, error) {
-	namespace, _ := params["namespace"].(string)
 	findingType, _ := params["type"].(string)
 	severity, _ := params["severity"].(string)
-	limit := 20
-	if l, ok := params["limit"].(float64); ok {
-		limit = int(l)
+	limit, err := intParam(params, "limit", 20)
+	if err != nil {
+		return "", err
+	}
+	if limit <= 0 {
+		return "", fmt.Errorf("limit must be positive, got %d", limit)
 	}
 
 	// Get path to current executable
@@ -274,14 +385,7 @@ func (r *Registry) trixFindings(ctx context.Context, params map[string]interface
 		return "", fmt.Errorf("failed to find executable: %w", err)
 	}
 
-	args := []string{"query", "findings", "-o", "json"}
-	if namespace != "" {
-		args = append(args, "-n", namespace)
-	} else {
-		args = append(args, "-A")
-	}
-
-	output, err := r.runCommand(ctx, exe, args...)
+	output, err := r.runQuery(ctx, exe, []string{"query", "findings", "-o", "json"}, params)
 	if err != nil {
 		return "", err
 	}
@@ -301,8 +405,13 @@ func (r *Registry) trixFindingDetail(ctx context.Context, params map[string]inte
 		return "", fmt.Errorf("failed to find executable: %w", err)
 	}
 
-	args := []string{"query", "findings", "-o", "json", "-A"}
-	output, err := r.runCommand(ctx, exe, args...)
+	// Same rawData as `trix query findings --full`, only fetched when asked for
+	full, _ := params["full"].(bool)
+	args := []string{"query", "findings", "-o", "json"}
+	if full {
+		args = append(args, "--full")
+	}
+	output, err := r.runQuery(ctx, exe, args, params)
 	if err != nil {
 		return "", err
 	}
@@ -314,9 +423,17 @@ func (r *Registry) trixFindingDetail(ctx context.Context, params map[string]inte
 	}
 
 	for _, f := range findings {
+		if !r.inScope(f) {
+			continue
+		}
 		if fid, ok := f["id"].(string); ok && strings.EqualFold(fid, id) {
-			// Return full details without rawData to save tokens
-			delete(f, "rawData")
+			if full {
+				if raw, ok := f["rawData"]; ok {
+					f["rawData"] = expandJSONStrings(raw)
+				}
+			} else {
+				delete(f, "rawData")
+			}
 			result, _ := json.MarshalIndent(f, "", "  ")
 			return string(result), nil
 		}
@@ -325,6 +442,30 @@ func (r *Registry) trixFindingDetail(ctx context.Context, params map[string]inte
 	return "", fmt.Errorf("finding not found: %s", id)
 }
 
+// expandJSONStrings replaces string values holding a JSON object or array
+// with the decoded value, so they are indented rather than escaped.
+func expandJSONStrings(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = expandJSONStrings(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = expandJSONStrings(e)
+		}
+	case string:
+		s := strings.TrimSpace(v)
+		if strings.HasPrefix(s, "{") || strings.HasPrefix(s, "[") {
+			var decoded interface{}
+			if json.Unmarshal([]byte(s), &decoded) == nil {
+				return expandJSONStrings(decoded)
+			}
+		}
+	}
+	return v
+}
+
 func (r *Registry) trixSummary(ctx context.Context, params map[string]interface{}) (string, error) {
 	namespace, _ := params["namespace"].(string)
 
@@ -333,28 +474,118 @@ func (r *Registry) trixSummary(ctx context.Context, params map[string]interface{
 		return "", fmt.Errorf("failed to find executable: %w", err)
 	}
 
+	if namespaces := r.fanOutNamespaces(params); namespaces != nil {
+		return r.mergeSummaries(ctx, exe, namespaces)
+	}
+
 	args := []string{"query", "summary"}
 	if namespace != "" {
 		args = append(args, "-n", namespace)
 	} else {
 		args = append(args, "-A")
 	}
+	// Cluster-scoped findings are counted under any namespace; drop them when scoped
+	if len(r.scope) > 0 {
+		args = append(args, "--namespaced-only")
+	}
 
 	return r.runCommand(ctx, exe, args...)
 }
 
+// findingsSummary is the summary printed by `trix query summary -o json`
+type findingsSummary struct {
+	BySeverity   map[string]int `json:"bySeverity"`
+	ByType       map[string]int `json:"byType"`
+	TopResources []struct {
+		Resource string `json:"resource"`
+		Count    int    `json:"count"`
+	} `json:"topResources"`
+	TotalFindings int `json:"totalFindings"`
+}
+
+// mergeSummaries summarizes each namespace on its own and adds up the counts.
+// Resource keys include the namespace, so the top 10 overall are among the
+// top 10 of each namespace.
+func (r *Registry) mergeSummaries(ctx context.Context, exe string, namespaces []string) (string, error) {
+	total := 0
+	bySeverity := make(map[string]int)
+	byType := make(map[string]int)
+	resources := make(map[string]int)
+	for _, ns := range namespaces {
+		output, err := r.runCommand(ctx, exe, "query", "summary", "-o", "json", "-n", ns, "--namespaced-only")
+		if err != nil {
+			return "", err
+		}
+		var summary findingsSummary
+		if err := json.Unmarshal([]byte(output), &summary); err != nil {
+			return "", fmt.Errorf("failed to parse summary for namespace %s: %w", ns, err)
+		}
+		total += summary.TotalFindings
+		for k, v := range summary.BySeverity {
+			bySeverity[k] += v
+		}
+		for k, v := range summary.ByType {
+			byType[k] += v
+		}
+		for _, rc := range summary.TopResources {
+			resources[rc.Resource] += rc.Count
+		}
+	}
+
+	lines := []string{
+		fmt.Sprintf("Security Findings Summary (namespaces: %s)", strings.Join(namespaces, ", ")),
+		fmt.Sprintf("Total Findings: %d", total),
+		"",
+		"By Severity:",
+	}
+	for _, sev := range []string{"CRITICAL", "HIGH", "MEDIUM", "LOW", "UNKNOWN"} {
+		if count, ok := bySeverity[sev]; ok {
+			lines = append(lines, fmt.Sprintf("  %s: %d", sev, count))
+		}
+	}
+	lines = append(lines, "", "By Type:")
+	for _, e := range counts.Top(byType, 0) {
+		lines = append(lines, fmt.Sprintf("  %s: %d", e.Name, e.Count))
+	}
+	if len(resources) > 0 {
+		lines = append(lines, "", "Top Affected Resources:")
+		for _, e := range counts.Top(resources, 10) {
+			lines = append(lines, fmt.Sprintf("  %s: %d", e.Name, e.Count))
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// findingsPage is one page of the compact findings table
+type findingsPage struct {
+	Rows     []string // Table rows, at most limit
+	Matching int      // Findings that pass the type and severity filters
+	Total    int      // Findings in scope, before filtering
+}
+
 func (r *Registry) formatFindingsCompact(jsonOutput, findingType, severity string, limit int) (string, error) {
-	var findings []map[string]interface{}
-	if err := json.Unmarshal([]byte(jsonOutput), &findings); err != nil {
+	page, err := r.pageFindings(jsonOutput, findingType, severity, limit)
+	if err != nil {
 		return jsonOutput, nil // Return as-is if not JSON
 	}
+	return page.String(), nil
+}
 
-	var lines []string
-	lines = append(lines, "ID | Severity | Type | Resource | Title")
-	lines = append(lines, "---|----------|------|----------|------")
+// pageFindings filters the findings JSON of `trix query findings` and formats
+// the first limit matches as table rows.
+func (r *Registry) pageFindings(jsonOutput, findingType, severity string, limit int) (*findingsPage, error) {
+	var findings []map[string]interface{}
+	if err := json.Unmarshal([]byte(jsonOutput), &findings); err != nil {
+		return nil, err
+	}
 
-	count := 0
+	page := &findingsPage{}
 	for _, f := range findings {
+		// Drop cluster-scoped and foreign findings when scoped
+		if !r.inScope(f) {
+			continue
+		}
+		page.Total++
 		// Check type filter
 		if findingType != "" {
 			if t, ok := f["type"].(string); !ok || !strings.EqualFold(t, findingType) {
@@ -368,6 +599,11 @@ func (r *Registry) formatFindingsCompact(jsonOutput, findingType, severity strin
 			}
 		}
 
+		page.Matching++
+		if len(page.Rows) >= limit {
+			continue // Keep counting matches
+		}
+
 		// Extract fields
 		id, _ := f["id"].(string)
 		sev, _ := f["severity"].(string)
@@ -386,20 +622,28 @@ func (r *Registry) formatFindingsCompact(jsonOutput, findingType, severity strin
 			resource = ns + "/" + name
 		}
 
-		lines = append(lines, fmt.Sprintf("%s | %s | %s | %s | %s", id, sev, typ, resource, title))
-
-		count++
-		if count >= limit {
-			lines = append(lines, fmt.Sprintf("... (showing %d of %d findings, use limit parameter for more)", limit, len(findings)))
-			break
-		}
+		page.Rows = append(page.Rows, fmt.Sprintf("%s | %s | %s | %s | %s", id, sev, typ, resource, title))
 	}
+	return page, nil
+}
 
-	if count == 0 {
-		return "No findings match the specified filters.", nil
+// String renders the page as a table followed by the match counts
+func (p *findingsPage) String() string {
+	if p.Matching == 0 {
+		return fmt.Sprintf("No findings match the specified filters (%d total).", p.Total)
 	}
 
-	return strings.Join(lines, "\n"), nil
+	lines := []string{
+		"ID | Severity | Type | Resource | Title",
+		"---|----------|------|----------|------",
+	}
+	lines = append(lines, p.Rows...)
+	if len(p.Rows) < p.Matching {
+		lines = append(lines, fmt.Sprintf("... (showing %d of %d matching (%d total), use limit parameter for more)", len(p.Rows), p.Matching, p.Total))
+	} else {
+		lines = append(lines, fmt.Sprintf("(%d matching, %d total)", p.Matching, p.Total))
+	}
+	return strings.Join(lines, "\n")
 }
 
 func (r *Registry) runCommand(ctx context.Context, name string, args ...string) (string, error) {
@@ -411,8 +655,68 @@ func (r *Registry) runCommand(ctx context.Context, name string, args ...string)
 	return string(output), nil
 }
 
+// runQuery runs a `trix query ... -o json` command for the call's namespace.
+// Scoped to several namespaces without one named, it runs once per allowed
+// namespace and concatenates the JSON arrays.
+func (r *Registry) runQuery(ctx context.Context, exe string, args []string, params map[string]interface{}) (string, error) {
+	namespaces := r.fanOutNamespaces(params)
+	if namespaces == nil {
+		return r.runCommand(ctx, exe, appendNamespaceArgs(args, params)...)
+	}
+
+	merged := []json.RawMessage{}
+	for _, ns := range namespaces {
+		nsArgs := append(append([]string(nil), args...), "-n", ns)
+		output, err := r.runCommand(ctx, exe, nsArgs...)
+		if err != nil {
+			return "", err
+		}
+		var items []json.RawMessage
+		if err := json.Unmarshal([]byte(output), &items); err != nil {
+			return "", fmt.Errorf("failed to parse output for namespace %s: %w", ns, err)
+		}
+		merged = append(merged, items...)
+	}
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
 // SBOM tool implementations
 
+// sbomReport is one image's SBOM as printed by `trix query sbom -o json`
+type sbomReport struct {
+	Name       string `json:"name"`
+	Namespace  string `json:"namespace"`
+	Image      string `json:"image"`
+	Components []struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+		Type    string `json:"type"`
+	} `json:"components"`
+}
+
+// parseSBOMs decodes `trix query sbom -o json` output. Cluster-scoped SBOMs
+// are always included by the query, so they are dropped when scoped.
+func (r *Registry) parseSBOMs(output string) ([]sbomReport, error) {
+	var sboms []sbomReport
+	if err := json.Unmarshal([]byte(output), &sboms); err != nil {
+		return nil, fmt.Errorf("failed to parse SBOM data: %w", err)
+	}
+	if len(r.scope) == 0 {
+		return sboms, nil
+	}
+	inScope := sboms[:0]
+	for _, sbom := range sboms {
+		if r.namespaceAllowed(sbom.Namespace) {
+			inScope = append(inScope, sbom)
+		}
+	}
+	return inScope, nil
+}
+
 func (r *Registry) trixSbomSummary(ctx context.Context, params map[string]interface{}) (string, error) {
 	exe, err := os.Executable()
 	if err != nil {
@@ -420,26 +724,15 @@ func (r *Registry) trixSbomSummary(ctx context.Context, params map[string]interf
 	}
 
 	// Get SBOM data as JSON
-	args := []string{"query", "sbom", "-A", "-o", "json"}
-	output, err := r.runCommand(ctx, exe, args...)
+	output, err := r.runQuery(ctx, exe, []string{"query", "sbom", "-o", "json"}, params)
 	if err != nil {
 		return "", err
 	}
 
 	// Parse and summarize
-	var sboms []struct {
-		Name       string `json:"name"`
-		Namespace  string `json:"namespace"`
-		Image      string `json:"image"`
-		Components []struct {
-			Name    string `json:"name"`
-			Version string `json:"version"`
-			Type    string `json:"type"`
-		} `json:"components"`
-	}
-
-	if err := json.Unmarshal([]byte(output), &sboms); err != nil {
-		return "", fmt.Errorf("failed to parse SBOM data: %w", err)
+	sboms, err := r.parseSBOMs(output)
+	if err != nil {
+		return "", err
 	}
 
 	// Aggregate stats
@@ -464,31 +757,15 @@ func (r *Registry) trixSbomSummary(ctx context.Context, params map[string]interf
 	lines = append(lines, fmt.Sprintf("Total components: %d", totalComponents))
 	lines = append(lines, "")
 	lines = append(lines, "Components by type:")
-	for t, count := range typeCount {
-		lines = append(lines, fmt.Sprintf("  %s: %d", t, count))
+	for _, e := range counts.Top(typeCount, 0) {
+		lines = append(lines, fmt.Sprintf("  %s: %d", e.Name, e.Count))
 	}
 
 	// Top 10 most common packages
 	lines = append(lines, "")
 	lines = append(lines, "Top 10 most common packages:")
-	type pkgCount struct {
-		name  string
-		count int
-	}
-	var sorted []pkgCount
-	for name, count := range packageCount {
-		sorted = append(sorted, pkgCount{name, count})
-	}
-	// Simple sort (bubble sort for small data)
-	for i := 0; i < len(sorted); i++ {
-		for j := i + 1; j < len(sorted); j++ {
-			if sorted[j].count > sorted[i].count {
-				sorted[i], sorted[j] = sorted[j], sorted[i]
-			}
-		}
-	}
-	for i := 0; i < 10 && i < len(sorted); i++ {
-		lines = append(lines, fmt.Sprintf("  %d. %s (in %d images)", i+1, sorted[i].name, sorted[i].count))
+	for i, e := range counts.Top(packageCount, 10) {
+		lines = append(lines, fmt.Sprintf("  %d. %s (in %d images)", i+1, e.Name, e.Count))
 	}
 
 	return strings.Join(lines, "\n"), nil
@@ -506,23 +783,34 @@ func (r *Registry) trixSbomSearch(ctx context.Context, params map[string]interfa
 	}
 
 	// Use the existing --package filter
-	args := []string{"query", "sbom", "-A", "--package", pkg}
-	output, err := r.runCommand(ctx, exe, args...)
+	output, err := r.runQuery(ctx, exe, []string{"query", "sbom", "-o", "json", "--package", pkg}, params)
+	if err != nil {
+		return "", err
+	}
+
+	sboms, err := r.parseSBOMs(output)
 	if err != nil {
 		return "", err
 	}
 
-	if strings.TrimSpace(output) == "" {
+	var rows []string
+	for _, sbom := range sboms {
+		for _, comp := range sbom.Components {
+			rows = append(rows, fmt.Sprintf("%s | %s | %s | %s | %s", sbom.Image, sbom.Namespace, comp.Name, comp.Version, comp.Type))
+		}
+	}
+	if len(rows) == 0 {
 		return fmt.Sprintf("No packages matching '%s' found in any image.", pkg), nil
 	}
 
 	// Add header
-	result := fmt.Sprintf("Packages matching '%s':\n", pkg)
-	result += "Image | Package | Version | Type\n"
-	result += "------|---------|---------|-----\n"
-	result += output
-
-	return result, nil
+	lines := []string{
+		fmt.Sprintf("Packages matching '%s':", pkg),
+		"Image | Namespace | Package | Version | Type",
+		"------|-----------|---------|---------|-----",
+	}
+	lines = append(lines, rows...)
+	return strings.Join(lines, "\n"), nil
 }
 
 func (r *Registry) trixSbomImage(ctx context.Context, params map[string]interface{}) (string, error) {
@@ -537,25 +825,14 @@ func (r *Registry) trixSbomImage(ctx context.Context, params map[string]interfac
 	}
 
 	// Get all SBOM data
-	args := []string{"query", "sbom", "-A", "-o", "json"}
-	output, err := r.runCommand(ctx, exe, args...)
+	output, err := r.runQuery(ctx, exe, []string{"query", "sbom", "-o", "json"}, params)
 	if err != nil {
 		return "", err
 	}
 
-	var sboms []struct {
-		Name       string `json:"name"`
-		Namespace  string `json:"namespace"`
-		Image      string `json:"image"`
-		Components []struct {
-			Name    string `json:"name"`
-			Version string `json:"version"`
-			Type    string `json:"type"`
-		} `json:"components"`
-	}
-
-	if err := json.Unmarshal([]byte(output), &sboms); err != nil {
-		return "", fmt.Errorf("failed to parse SBOM data: %w", err)
+	sboms, err := r.parseSBOMs(output)
+	if err != nil {
+		return "", err
 	}
 
 	// Find matching image
@@ -584,16 +861,7 @@ func (r *Registry) trixSbomImage(ctx context.Context, params map[string]interfac
 		image, r.listImageNames(sboms)), nil
 }
 
-func (r *Registry) listImageNames(sboms []struct {
-	Name       string `json:"name"`
-	Namespace  string `json:"namespace"`
-	Image      string `json:"image"`
-	Components []struct {
-		Name    string `json:"name"`
-		Version string `json:"version"`
-		Type    string `json:"type"`
-	} `json:"components"`
-}) string {
+func (r *Registry) listImageNames(sboms []sbomReport) string {
 	var names []string
 	for _, sbom := range sboms {
 		names = append(names, fmt.Sprintf("  - %s (%s)", sbom.Image, sbom.Namespace))
@@ -624,26 +892,12 @@ func (r *Registry) checkExposure(ctx context.Context, params map[string]interfac
 		return "", fmt.Errorf("failed to create k8s client: %w", err)
 	}
 
-	// Get workload labels based on kind
-	labels, err := r.getWorkloadLabels(ctx, client, kind, name, namespace)
+	workload, err := exposure.ResolveWorkload(ctx, client.Clientset(), kind, name, namespace)
 	if err != nil {
 		return "", fmt.Errorf("failed to get workload: %w", err)
 	}
 
-	// Create workload struct
-	workload := exposure.Workload{
-		Kind:      kind,
-		Name:      name,
-		Namespace: namespace,
-		Labels:    labels,
-	}
-
-	// Create analyzer with all checkers
-	analyzer := exposure.NewAnalyzer(
-		exposure.NewServiceChecker(client.Clientset()),
-		exposure.NewIngressChecker(client.Clientset()),
-		exposure.NewGatewayChecker(client.Clientset(), client.DynamicClient()),
-	)
+	analyzer := exposure.NewDefaultAnalyzer(client.Clientset(), client.DynamicClient())
 
 	// Run analysis
 	result, err := analyzer.Analyze(ctx, workload)
@@ -654,41 +908,3 @@ func (r *Registry) checkExposure(ctx context.Context, params map[string]interfac
 	// Return compact output for token efficiency
 	return result.CompactString(), nil
 }
-
-// getWorkloadLabels fetches the pod template labels for a workload
-func (r *Registry) getWorkloadLabels(ctx context.Context, client *kubectl.Client, kind, name, namespace string) (map[string]string, error) {
-	clientset := client.Clientset()
-
-	switch kind {
-	case "Deployment":
-		deploy, err := clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
-		if err != nil {
-			return nil, err
-		}
-		return deploy.Spec.Selector.MatchLabels, nil
-
-	case "DaemonSet":
-		ds, err := clientset.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
-		if err != nil {
-			return nil, err
-		}
-		return ds.Spec.Selector.MatchLabels, nil
-
-	case "StatefulSet":
-		sts, err := clientset.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
-		if err != nil {
-			return nil, err
-		}
-		return sts.Spec.Selector.MatchLabels, nil
-
-	case "Pod":
-		pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
-		if err != nil {
-			return nil, err
-		}
-		return pod.Labels, nil
-
-	default:
-		return nil, fmt.Errorf("unsupported workload kind: %s (use Deployment, DaemonSet, StatefulSet, or Pod)", kind)
-	}
-}
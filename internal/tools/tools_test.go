@@ -0,0 +1,438 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMain stands in for kubectl and trix when the test binary is run by a
+// tool executor: it records its arguments and prints TRIX_FAKE_OUTPUT, or
+// TRIX_FAKE_OUTPUT.<namespace> when run with -n and that file exists.
+func TestMain(m *testing.M) {
+	if calls := os.Getenv("TRIX_FAKE_CALLS"); calls != "" {
+		f, err := os.OpenFile(calls, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			os.Exit(2)
+		}
+		args, _ := json.Marshal(append([]string{filepath.Base(os.Args[0])}, os.Args[1:]...))
+		_, _ = fmt.Fprintf(f, "%s\n", args)
+		_ = f.Close()
+		output := os.Getenv("TRIX_FAKE_OUTPUT")
+		for i, arg := range os.Args[:len(os.Args)-1] {
+			if arg == "-n" {
+				if _, err := os.Stat(output + "." + os.Args[i+1]); err == nil {
+					output += "." + os.Args[i+1]
+				}
+			}
+		}
+		data, _ := os.ReadFile(output)
+		_, _ = os.Stdout.Write(data)
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// fakeCommands makes kubectl and trix (os.Executable) print output for the
+// rest of the test, and returns the command lines they were run with.
+func fakeCommands(t *testing.T, output string) func() []string {
+	t.Helper()
+	dir := t.TempDir()
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(exe, filepath.Join(dir, "kubectl")); err != nil {
+		t.Fatal(err)
+	}
+	outputFile := filepath.Join(dir, "output")
+	if err := os.WriteFile(outputFile, []byte(output), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	calls := filepath.Join(dir, "calls")
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("TRIX_FAKE_OUTPUT", outputFile)
+	t.Setenv("TRIX_FAKE_CALLS", calls)
+
+	trix := filepath.Base(exe)
+	return func() []string {
+		f, err := os.Open(calls)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = f.Close() }()
+		var lines []string
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var args []string
+			if err := json.Unmarshal(scanner.Bytes(), &args); err != nil {
+				t.Fatal(err)
+			}
+			if args[0] == trix {
+				args[0] = "trix"
+			}
+			lines = append(lines, strings.Join(args, " "))
+		}
+		return lines
+	}
+}
+
+// fakeNamespaceOutput makes the commands faked by fakeCommands print output
+// when run with -n ns
+func fakeNamespaceOutput(t *testing.T, ns, output string) {
+	t.Helper()
+	if err := os.WriteFile(os.Getenv("TRIX_FAKE_OUTPUT")+"."+ns, []byte(output), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// findingsJSON returns n CRITICAL vulnerability findings in payments, as
+// printed by trix query findings -o json
+func findingsJSON(n int) string {
+	findings := make([]map[string]interface{}, n)
+	for i := range findings {
+		findings[i] = map[string]interface{}{
+			"id":           fmt.Sprintf("CVE-2024-%04d", i+1),
+			"severity":     "CRITICAL",
+			"type":         "vulnerability",
+			"namespace":    "payments",
+			"resourceName": "api",
+			"title":        "openssl",
+		}
+	}
+	data, _ := json.Marshal(findings)
+	return string(data)
+}
+
+func TestIntParam(t *testing.T) {
+	tests := []struct {
+		value   interface{}
+		want    int
+		wantErr string
+	}{
+		{nil, 50, ""},
+		{100, 100, ""},
+		{int64(100), 100, ""},
+		{float64(100), 100, ""},
+		{json.Number("100"), 100, ""},
+		{"100", 100, ""},
+		{" 100 ", 100, ""},
+		{"1e2", 100, ""},
+		{"-5", -5, ""},
+		{1.5, 0, "tail must be an integer, got 1.5"},
+		{"1.5", 0, "tail must be an integer, got 1.5"},
+		{"many", 0, `tail must be an integer, got "many"`},
+		{json.Number("x"), 0, `tail must be an integer, got "x"`},
+		{true, 0, "tail must be an integer, got bool"},
+		{"Inf", 0, "tail must be an integer, got +Inf"},
+	}
+	for _, tt := range tests {
+		params := map[string]interface{}{}
+		if tt.value != nil {
+			params["tail"] = tt.value
+		}
+		got, err := intParam(params, "tail", 50)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("intParam(%#v) error = %v, want %q", tt.value, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("intParam(%#v) = %d, %v, want %d", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+// Integer params reach the command in every numeric form a model sends
+func TestExecuteIntParams(t *testing.T) {
+	ctx := context.Background()
+	r := NewRegistry()
+
+	for _, tail := range []interface{}{float64(100), 100, json.Number("100"), "100"} {
+		calls := fakeCommands(t, "log line\n")
+		out, err := r.Execute(ctx, "kubectl_logs", map[string]interface{}{"pod": "api-0", "namespace": "payments", "tail": tail})
+		if err != nil || out != "log line\n" {
+			t.Fatalf("tail %#v: %q, %v", tail, out, err)
+		}
+		if got := calls(); len(got) != 1 || got[0] != "kubectl logs api-0 -n payments --tail 100" {
+			t.Errorf("tail %#v ran %q", tail, got)
+		}
+	}
+
+	for _, limit := range []interface{}{float64(2), 2, json.Number("2"), "2"} {
+		fakeCommands(t, findingsJSON(5))
+		out, err := r.Execute(ctx, "trix_findings", map[string]interface{}{"namespace": "payments", "limit": limit})
+		if err != nil {
+			t.Fatalf("limit %#v: %v", limit, err)
+		}
+		if rows := strings.Count(out, "| CRITICAL |"); rows != 2 {
+			t.Errorf("limit %#v: %d rows:\n%s", limit, rows, out)
+		}
+	}
+}
+
+// A malformed integer is reported to the model instead of replaced by the
+// default, and the command is not run
+func TestExecuteIntParamErrors(t *testing.T) {
+	ctx := context.Background()
+	r := NewRegistry()
+	calls := fakeCommands(t, findingsJSON(5))
+
+	tests := []struct {
+		tool    string
+		params  map[string]interface{}
+		wantErr string
+	}{
+		{"kubectl_logs", map[string]interface{}{"pod": "api-0", "tail": "lots"}, `tail must be an integer, got "lots"`},
+		{"kubectl_logs", map[string]interface{}{"pod": "api-0", "tail": 10.5}, "tail must be an integer, got 10.5"},
+		{"trix_findings", map[string]interface{}{"limit": "all"}, `limit must be an integer, got "all"`},
+		{"trix_findings", map[string]interface{}{"limit": 0}, "limit must be positive, got 0"},
+		{"trix_findings", map[string]interface{}{"limit": "-3"}, "limit must be positive, got -3"},
+	}
+	for _, tt := range tests {
+		if _, err := r.Execute(ctx, tt.tool, tt.params); err == nil || err.Error() != tt.wantErr {
+			t.Errorf("%s %v: err = %v, want %q", tt.tool, tt.params, err, tt.wantErr)
+		}
+	}
+	if got := calls(); len(got) != 0 {
+		t.Errorf("commands run despite invalid params: %q", got)
+	}
+}
+
+// Property schemas are nested objects, so their types survive serialization
+func TestToolSchemas(t *testing.T) {
+	for _, tool := range NewRegistry().Tools() {
+		data, err := json.Marshal(tool.Parameters)
+		if err != nil {
+			t.Fatalf("%s: %v", tool.Name, err)
+		}
+		var schema struct {
+			Properties map[string]struct {
+				Type string `json:"type"`
+			} `json:"properties"`
+		}
+		if err := json.Unmarshal(data, &schema); err != nil {
+			t.Fatalf("%s schema %s: %v", tool.Name, data, err)
+		}
+		for name, prop := range schema.Properties {
+			if prop.Type == "" {
+				t.Errorf("%s.%s has no type: %s", tool.Name, name, data)
+			}
+		}
+	}
+
+	var tail, limit string
+	for _, tool := range NewRegistry().Tools() {
+		props, _ := tool.Parameters["properties"].(map[string]interface{})
+		if p, ok := props["tail"].(map[string]interface{}); ok && tool.Name == "kubectl_logs" {
+			tail, _ = p["type"].(string)
+		}
+		if p, ok := props["limit"].(map[string]interface{}); ok && tool.Name == "trix_findings" {
+			limit, _ = p["type"].(string)
+		}
+	}
+	if tail != "integer" || limit != "integer" {
+		t.Errorf("tail is %q and limit %q, want integer", tail, limit)
+	}
+}
+
+// mixedFindings has 3 CRITICAL and 2 LOW vulnerabilities in payments, 2
+// HIGH misconfigurations in billing and a cluster-scoped rbac finding
+const mixedFindings = `[
+	{"id": "CVE-1", "severity": "CRITICAL", "type": "vulnerability", "namespace": "payments", "resourceName": "api", "title": "openssl"},
+	{"id": "CVE-2", "severity": "LOW", "type": "vulnerability", "namespace": "payments", "resourceName": "api", "title": "curl"},
+	{"id": "CVE-3", "severity": "CRITICAL", "type": "vulnerability", "namespace": "payments", "resourceName": "worker", "title": "zlib"},
+	{"id": "KSV-1", "severity": "HIGH", "type": "misconfiguration", "namespace": "billing", "resourceName": "db", "title": "Runs as root"},
+	{"id": "CVE-4", "severity": "LOW", "type": "vulnerability", "namespace": "payments", "resourceName": "worker", "title": "glibc"},
+	{"id": "KSV-2", "severity": "HIGH", "type": "misconfiguration", "namespace": "billing", "resourceName": "db", "title": "Privileged container with a title long enough to be truncated in the table"},
+	{"id": "KSV-3", "severity": "CRITICAL", "type": "rbac", "namespace": "", "resourceName": "cluster-admin", "title": "Wildcard verbs"},
+	{"id": "CVE-5", "severity": "CRITICAL", "type": "vulnerability", "namespace": "payments", "resourceName": "api", "title": "libxml2"}
+]`
+
+func TestPageFindings(t *testing.T) {
+	tests := []struct {
+		name     string
+		scope    []string
+		typ      string
+		severity string
+		limit    int
+		rows     []string // IDs
+		matching int
+		total    int
+	}{
+		{"no filters", nil, "", "", 20, []string{"CVE-1", "CVE-2", "CVE-3", "KSV-1", "CVE-4", "KSV-2", "KSV-3", "CVE-5"}, 8, 8},
+		{"limit hit", nil, "", "", 3, []string{"CVE-1", "CVE-2", "CVE-3"}, 8, 8},
+		{"severity", nil, "", "critical", 20, []string{"CVE-1", "CVE-3", "KSV-3", "CVE-5"}, 4, 8},
+		{"severity over limit", nil, "", "CRITICAL", 2, []string{"CVE-1", "CVE-3"}, 4, 8},
+		{"type", nil, "Misconfiguration", "", 20, []string{"KSV-1", "KSV-2"}, 2, 8},
+		{"type and severity", nil, "vulnerability", "LOW", 1, []string{"CVE-2"}, 2, 8},
+		{"no match", nil, "secret", "", 20, nil, 0, 8},
+		{"scoped", []string{"payments"}, "", "CRITICAL", 20, []string{"CVE-1", "CVE-3", "CVE-5"}, 3, 5},
+		{"scoped elsewhere", []string{"staging"}, "", "", 20, nil, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := recordingRegistry()
+			r.RestrictNamespaces(tt.scope...)
+			page, err := r.pageFindings(mixedFindings, tt.typ, tt.severity, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, row := range page.Rows {
+				ids = append(ids, strings.SplitN(row, " | ", 2)[0])
+			}
+			if strings.Join(ids, ",") != strings.Join(tt.rows, ",") || page.Matching != tt.matching || page.Total != tt.total {
+				t.Errorf("rows %v, %d matching, %d total; want %v, %d, %d", ids, page.Matching, page.Total, tt.rows, tt.matching, tt.total)
+			}
+		})
+	}
+
+	if _, err := NewRegistry().pageFindings("no reports found", "", "", 20); err == nil {
+		t.Error("non-JSON output paged without an error")
+	}
+}
+
+func TestFindingsPageString(t *testing.T) {
+	r := NewRegistry()
+	format := func(typ, severity string, limit int) string {
+		out, err := r.formatFindingsCompact(mixedFindings, typ, severity, limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	out := format("", "CRITICAL", 2)
+	want := `ID | Severity | Type | Resource | Title
+---|----------|------|----------|------
+CVE-1 | CRITICAL | vulnerability | payments/api | openssl
+CVE-3 | CRITICAL | vulnerability | payments/worker | zlib
+... (showing 2 of 4 matching (8 total), use limit parameter for more)`
+	if out != want {
+		t.Errorf("limit hit:\n%s\nwant:\n%s", out, want)
+	}
+
+	out = format("misconfiguration", "", 20)
+	if !strings.HasSuffix(out, "\n(2 matching, 8 total)") || strings.Contains(out, "showing") {
+		t.Errorf("all matches shown:\n%s", out)
+	}
+	if !strings.Contains(out, "KSV-2 | HIGH | misconfiguration | billing/db | Privileged container with a title long enough to be trunc...") {
+		t.Errorf("long title not truncated:\n%s", out)
+	}
+	if !strings.Contains(format("rbac", "", 20), "KSV-3 | CRITICAL | rbac | cluster-admin | Wildcard verbs") {
+		t.Error("cluster-scoped resource shown with a namespace")
+	}
+
+	if out := format("secret", "", 20); out != "No findings match the specified filters (8 total)." {
+		t.Errorf("no match: %q", out)
+	}
+	if out, err := r.formatFindingsCompact("no reports found", "", "", 20); err != nil || out != "no reports found" {
+		t.Errorf("non-JSON output = %q, %v, want it unchanged", out, err)
+	}
+}
+
+// detailFindings is query findings --full output with a misconfiguration
+// whose rawData holds a JSON string, as Trivy reports some check details
+const detailFindings = `[
+	{"id": "CVE-1", "severity": "LOW", "type": "vulnerability", "namespace": "payments", "resourceName": "api"},
+	{"id": "KSV-0017", "severity": "HIGH", "type": "misconfiguration", "namespace": "payments", "resourceName": "api",
+	 "rawData": {"checkID": "KSV017", "messages": ["Container 'app' should set 'securityContext.privileged' to false"],
+	             "details": "{\"path\": \"spec.template.spec.containers[0]\", \"lines\": [12, 14]}",
+	             "references": "see [the docs]"}}
+]`
+
+func TestFindingDetail(t *testing.T) {
+	ctx := context.Background()
+	r := NewRegistry()
+
+	calls := fakeCommands(t, detailFindings)
+	out, err := r.Execute(ctx, "trix_finding_detail", map[string]interface{}{"id": "ksv-0017", "namespace": "payments"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := calls(); len(got) != 1 || got[0] != "trix query findings -o json -n payments" {
+		t.Errorf("ran %q", got)
+	}
+	var finding map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &finding); err != nil {
+		t.Fatalf("%s: %v", out, err)
+	}
+	if finding["id"] != "KSV-0017" || finding["rawData"] != nil {
+		t.Errorf("detail without full = %s, want KSV-0017 without rawData", out)
+	}
+
+	calls = fakeCommands(t, detailFindings)
+	out, err = r.Execute(ctx, "trix_finding_detail", map[string]interface{}{"id": "KSV-0017", "full": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := calls(); len(got) != 1 || got[0] != "trix query findings -o json --full -A" {
+		t.Errorf("ran %q", got)
+	}
+	var full struct {
+		RawData struct {
+			CheckID  string   `json:"checkID"`
+			Messages []string `json:"messages"`
+			Details  struct {
+				Path  string `json:"path"`
+				Lines []int  `json:"lines"`
+			} `json:"details"`
+			References string `json:"references"`
+		} `json:"rawData"`
+	}
+	if err := json.Unmarshal([]byte(out), &full); err != nil {
+		t.Fatalf("%s: %v", out, err)
+	}
+	raw := full.RawData
+	if raw.CheckID != "KSV017" || len(raw.Messages) != 1 || raw.Details.Path != "spec.template.spec.containers[0]" ||
+		len(raw.Details.Lines) != 2 || raw.References != "see [the docs]" {
+		t.Errorf("rawData = %+v", raw)
+	}
+	// Nested JSON is indented with the rest, not escaped
+	if strings.Contains(out, `\"`) || !strings.Contains(out, "\n      \"path\": \"spec.template.spec.containers[0]\"") {
+		t.Errorf("rawData not pretty-printed:\n%s", out)
+	}
+}
+
+func TestFindingDetailErrors(t *testing.T) {
+	ctx := context.Background()
+	fakeCommands(t, detailFindings)
+
+	r := NewRegistry()
+	if _, err := r.Execute(ctx, "trix_finding_detail", map[string]interface{}{}); err == nil || err.Error() != "id parameter is required" {
+		t.Errorf("no id: err = %v", err)
+	}
+	if _, err := r.Execute(ctx, "trix_finding_detail", map[string]interface{}{"id": "CVE-404"}); err == nil || err.Error() != "finding not found: CVE-404" {
+		t.Errorf("unknown id: err = %v", err)
+	}
+
+	r.RestrictNamespaces("billing")
+	if _, err := r.Execute(ctx, "trix_finding_detail", map[string]interface{}{"id": "KSV-0017", "full": true}); err == nil || err.Error() != "finding not found: KSV-0017" {
+		t.Errorf("out of scope: err = %v", err)
+	}
+}
+
+func TestExpandJSONStrings(t *testing.T) {
+	in := map[string]interface{}{
+		"object":   `{"a": "[1, 2]"}`,
+		"list":     []interface{}{" [true] ", "plain"},
+		"invalid":  "{not json",
+		"brackets": "[see docs]",
+		"number":   float64(3),
+	}
+	got, _ := json.Marshal(expandJSONStrings(in))
+	want := `{"brackets":"[see docs]","invalid":"{not json","list":[[true],"plain"],"number":3,"object":{"a":[1,2]}}`
+	if string(got) != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
@@ -23,6 +23,17 @@ func NewClient(k8sClient *kubectl.Client) *Client {
 	}
 }
 
+// NewClientForDynamic creates a Trivy client that only lists reports
+// through dyn, e.g. a fake dynamic client in tests. K8sClient returns nil.
+func NewClientForDynamic(dyn dynamic.Interface) *Client {
+	return &Client{dynamicClient: dyn}
+}
+
+// DynamicClient returns the client reports are listed and watched through
+func (c *Client) DynamicClient() dynamic.Interface {
+	return c.dynamicClient
+}
+
 // K8sClient returns the underlying kubectl client
 func (c *Client) K8sClient() *kubectl.Client {
 	return c.k8sClient
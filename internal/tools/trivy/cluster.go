@@ -8,15 +8,16 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
+// ClusterVulnerabilityReportGVR identifies cluster-scoped vulnerability reports
+var ClusterVulnerabilityReportGVR = schema.GroupVersionResource{
+	Group:    "aquasecurity.github.io",
+	Version:  "v1alpha1",
+	Resource: "clustervulnerabilityreports",
+}
+
 // ListClusterVulnerabilityReports queries cluster-scoped vulnerability reports
 func (c *Client) ListClusterVulnerabilityReports(ctx context.Context) ([]map[string]interface{}, error) {
-	gvr := schema.GroupVersionResource{
-		Group:    "aquasecurity.github.io",
-		Version:  "v1alpha1",
-		Resource: "clustervulnerabilityreports",
-	}
-
-	list, err := c.dynamicClient.Resource(gvr).List(ctx, metav1.ListOptions{})
+	list, err := c.dynamicClient.Resource(ClusterVulnerabilityReportGVR).List(ctx, metav1.ListOptions{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to list cluster vulnerability reports: %w", err)
 	}
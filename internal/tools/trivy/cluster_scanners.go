@@ -26,26 +26,32 @@ func (s *ClusterVulnScanner) Scan(ctx context.Context, _ string) ([]Finding, err
 
 	var findings []Finding
 	for _, report := range reports {
-		metadata, ok := report["metadata"].(map[string]interface{})
-		if !ok {
-			continue
-		}
-		name, _ := metadata["name"].(string)
+		findings = append(findings, s.client.ClusterVulnerabilityReportFindings(report)...)
+	}
+	return findings, nil
+}
 
-		// Extract artifact info for cluster-scoped reports
-		artifact := extractClusterArtifactInfo(report)
+// ClusterVulnerabilityReportFindings converts one ClusterVulnerabilityReport into findings
+func (c *Client) ClusterVulnerabilityReportFindings(report map[string]interface{}) []Finding {
+	metadata, ok := report["metadata"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	name, _ := metadata["name"].(string)
 
-		vulns, err := s.client.ParseVulnerabilities(report)
-		if err != nil {
-			continue
-		}
+	// Extract artifact info for cluster-scoped reports
+	artifact := extractClusterArtifactInfo(report)
 
-		for _, v := range vulns {
-			finding := VulnerabilityToFinding(v, "", "Cluster", name, artifact)
-			findings = append(findings, finding)
-		}
+	vulns, err := c.ParseVulnerabilities(report)
+	if err != nil {
+		return nil
 	}
-	return findings, nil
+
+	findings := make([]Finding, 0, len(vulns))
+	for _, v := range vulns {
+		findings = append(findings, VulnerabilityToFinding(v, "", "Cluster", name, artifact))
+	}
+	return findings
 }
 
 // extractClusterArtifactInfo extracts artifact info from cluster vulnerability reports
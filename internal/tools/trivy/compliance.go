@@ -8,17 +8,17 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
+// ConfigAuditReportGVR identifies Trivy ConfigAuditReport CRDs
+var ConfigAuditReportGVR = schema.GroupVersionResource{
+	Group:    "aquasecurity.github.io",
+	Version:  "v1alpha1",
+	Resource: "configauditreports",
+}
+
 // ListConfigAuditReports queries Trivy ConfigAuditReport CRDs
 func (c *Client) ListConfigAuditReports(ctx context.Context, namespace string) ([]map[string]interface{}, error) {
-	// Define the GVR (GroupVersionResource) for ConfigAuditReports
-	gvr := schema.GroupVersionResource{
-		Group:    "aquasecurity.github.io",
-		Version:  "v1alpha1",
-		Resource: "configauditreports",
-	}
-
 	// Query the resources
-	list, err := c.dynamicClient.Resource(gvr).Namespace(namespace).List(ctx, metav1.ListOptions{})
+	list, err := c.dynamicClient.Resource(ConfigAuditReportGVR).Namespace(namespace).List(ctx, metav1.ListOptions{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to list config audit reports: %w", err)
 	}
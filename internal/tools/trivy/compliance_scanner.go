@@ -56,3 +56,28 @@ func (s *TrivyComplianceScanner) Scan(ctx context.Context, namespace string) ([]
 
 	return findings, nil
 }
+
+// ConfigAuditReportFindings converts the failed checks of one
+// ConfigAuditReport into findings located at the workload it audits.
+func (c *Client) ConfigAuditReportFindings(report map[string]interface{}) []Finding {
+	resource, ok := extractReportResource(report)
+	if !ok {
+		return nil
+	}
+
+	checks, err := c.ParseComplianceChecks(report)
+	if err != nil {
+		return nil
+	}
+
+	var findings []Finding
+	for _, check := range checks {
+		if check.Success {
+			continue // Only report failures
+		}
+		f := ComplianceCheckToFinding(check, resource.Namespace, resource.Name)
+		f.ResourceKind = resource.Kind
+		findings = append(findings, f)
+	}
+	return findings
+}
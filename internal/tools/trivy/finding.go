@@ -1,6 +1,9 @@
 package trivy
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 type Severity string
 
@@ -12,6 +15,22 @@ const (
 	SeverityUnknown  Severity = "UNKNOWN"
 )
 
+// Rank orders severities from most to least severe (CRITICAL = 1)
+func (s Severity) Rank() int {
+	switch Severity(strings.ToUpper(string(s))) {
+	case SeverityCritical:
+		return 1
+	case SeverityHigh:
+		return 2
+	case SeverityMedium:
+		return 3
+	case SeverityLow:
+		return 4
+	default:
+		return 5
+	}
+}
+
 type FindingType string
 
 const (
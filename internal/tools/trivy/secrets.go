@@ -8,15 +8,16 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
+// ExposedSecretReportGVR identifies Trivy ExposedSecretReport CRDs
+var ExposedSecretReportGVR = schema.GroupVersionResource{
+	Group:    "aquasecurity.github.io",
+	Version:  "v1alpha1",
+	Resource: "exposedsecretreports",
+}
+
 // ListExposedSecretsReports queries Trivy ExposedSecretReports CRDs
 func (c *Client) ListExposedSecretReports(ctx context.Context, namespace string) ([]map[string]interface{}, error) {
-	gvr := schema.GroupVersionResource{
-		Group:    "aquasecurity.github.io",
-		Version:  "v1alpha1",
-		Resource: "exposedsecretreports",
-	}
-
-	list, err := c.dynamicClient.Resource(gvr).Namespace(namespace).List(ctx, metav1.ListOptions{})
+	list, err := c.dynamicClient.Resource(ExposedSecretReportGVR).Namespace(namespace).List(ctx, metav1.ListOptions{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to list exposed secrets reports: %w", err)
 	}
@@ -50,3 +50,30 @@ func (s *TrivySecretScanner) Scan(ctx context.Context, namespace string) ([]Find
 
 	return findings, nil
 }
+
+// ExposedSecretReportFindings converts one ExposedSecretReport into findings
+// located at the workload (and container) the report belongs to.
+func (c *Client) ExposedSecretReportFindings(report map[string]interface{}) []Finding {
+	resource, ok := extractReportResource(report)
+	if !ok {
+		return nil
+	}
+	artifact := extractArtifactInfo(report)
+
+	secrets, err := c.ParseExposedSecrets(report)
+	if err != nil {
+		return nil
+	}
+
+	findings := make([]Finding, 0, len(secrets))
+	for _, secret := range secrets {
+		f := ExposedSecretToFinding(secret, resource.Namespace, resource.Name)
+		f.ResourceKind = resource.Kind
+		f.ContainerName = resource.ContainerName
+		f.ImageRepository = artifact.Repository
+		f.ImageTag = artifact.Tag
+		f.ImageDigest = artifact.Digest
+		findings = append(findings, f)
+	}
+	return findings
+}
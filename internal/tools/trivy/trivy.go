@@ -8,17 +8,17 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
+// VulnerabilityReportGVR identifies Trivy VulnerabilityReport CRDs
+var VulnerabilityReportGVR = schema.GroupVersionResource{
+	Group:    "aquasecurity.github.io",
+	Version:  "v1alpha1",
+	Resource: "vulnerabilityreports",
+}
+
 // ListVulnerabilityReports queries Trivy VulnerabilityReport CRDs
 func (c *Client) ListVulnerabilityReports(ctx context.Context, namespace string) ([]map[string]interface{}, error) {
-	// Define the GVR (GroupVersionResource) for VulnerabilityReports
-	gvr := schema.GroupVersionResource{
-		Group:    "aquasecurity.github.io",
-		Version:  "v1alpha1",
-		Resource: "vulnerabilityreports",
-	}
-
 	// Query the resources
-	list, err := c.dynamicClient.Resource(gvr).Namespace(namespace).List(ctx, metav1.ListOptions{})
+	list, err := c.dynamicClient.Resource(VulnerabilityReportGVR).Namespace(namespace).List(ctx, metav1.ListOptions{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to list vulnerability reports: %w", err)
 	}
@@ -130,3 +130,29 @@ func (c *Client) CheckTrivyOperator(ctx context.Context) (bool, string) {
 	// Found reports but no deployment info
 	return true, "unknown"
 }
+
+// ListReportPages lists a report resource page by page, calling fn with
+// each page. Pass an empty namespace for all namespaces or for
+// cluster-scoped resources. Paging keeps memory flat on large clusters.
+func (c *Client) ListReportPages(ctx context.Context, gvr schema.GroupVersionResource, namespace string, pageSize int64, fn func([]map[string]interface{}) error) error {
+	opts := metav1.ListOptions{Limit: pageSize}
+	for {
+		list, err := c.dynamicClient.Resource(gvr).Namespace(namespace).List(ctx, opts)
+		if err != nil {
+			return fmt.Errorf("failed to list %s: %w", gvr.Resource, err)
+		}
+
+		page := make([]map[string]interface{}, 0, len(list.Items))
+		for _, item := range list.Items {
+			page = append(page, item.Object)
+		}
+		if err := fn(page); err != nil {
+			return err
+		}
+
+		if list.GetContinue() == "" {
+			return nil
+		}
+		opts.Continue = list.GetContinue()
+	}
+}
@@ -29,43 +29,66 @@ func (s *TrivyVulnScanner) Scan(ctx context.Context, namespace string) ([]Findin
 
 	var findings []Finding
 	for _, report := range reports {
-		// Extract Metadata
-		metadata, ok := report["metadata"].(map[string]interface{})
-		if !ok {
-			continue
-		}
-		ns, _ := metadata["namespace"].(string)
-
-		// Extract labels for workload and container info
-		labels, _ := metadata["labels"].(map[string]interface{})
-		resourceKind, _ := labels["trivy-operator.resource.kind"].(string)
-		resourceName, _ := labels["trivy-operator.resource.name"].(string)
-		containerName, _ := labels["trivy-operator.container.name"].(string)
-
-		// Default to Pod if no kind specified
-		if resourceKind == "" {
-			resourceKind = "Pod"
-		}
-
-		// Extract artifact info (image details)
-		artifact := extractArtifactInfo(report)
-		artifact.ContainerName = containerName
-
-		// Parse vulnerabilities
-		vulns, err := s.client.ParseVulnerabilities(report)
-		if err != nil {
-			continue
-		}
-
-		// Convert each vulnerability to a Finding
-		for _, v := range vulns {
-			finding := VulnerabilityToFinding(v, ns, resourceKind, resourceName, artifact)
-			findings = append(findings, finding)
-		}
+		findings = append(findings, s.client.VulnerabilityReportFindings(report)...)
 	}
 	return findings, nil
 }
 
+// reportResource is the workload a namespaced report describes
+type reportResource struct {
+	Namespace     string
+	Kind          string
+	Name          string
+	ContainerName string
+}
+
+// extractReportResource reads the workload from a report's trivy-operator
+// labels. ok is false if the report has no metadata.
+func extractReportResource(report map[string]interface{}) (r reportResource, ok bool) {
+	metadata, ok := report["metadata"].(map[string]interface{})
+	if !ok {
+		return r, false
+	}
+	r.Namespace, _ = metadata["namespace"].(string)
+
+	labels, _ := metadata["labels"].(map[string]interface{})
+	r.Kind, _ = labels["trivy-operator.resource.kind"].(string)
+	r.Name, _ = labels["trivy-operator.resource.name"].(string)
+	r.ContainerName, _ = labels["trivy-operator.container.name"].(string)
+
+	// Default to Pod if no kind specified
+	if r.Kind == "" {
+		r.Kind = "Pod"
+	}
+	return r, true
+}
+
+// VulnerabilityReportFindings converts one VulnerabilityReport into findings
+func (c *Client) VulnerabilityReportFindings(report map[string]interface{}) []Finding {
+	resource, ok := extractReportResource(report)
+	if !ok {
+		return nil
+	}
+	ns, resourceKind, resourceName := resource.Namespace, resource.Kind, resource.Name
+
+	// Extract artifact info (image details)
+	artifact := extractArtifactInfo(report)
+	artifact.ContainerName = resource.ContainerName
+
+	// Parse vulnerabilities
+	vulns, err := c.ParseVulnerabilities(report)
+	if err != nil {
+		return nil
+	}
+
+	// Convert each vulnerability to a Finding
+	findings := make([]Finding, 0, len(vulns))
+	for _, v := range vulns {
+		findings = append(findings, VulnerabilityToFinding(v, ns, resourceKind, resourceName, artifact))
+	}
+	return findings
+}
+
 // extractArtifactInfo extracts image repository, tag, and digest from a report
 func extractArtifactInfo(report map[string]interface{}) ArtifactInfo {
 	artifact := ArtifactInfo{}
@@ -0,0 +1,231 @@
+// Package triage turns findings into a ranked list of remediation actions.
+//
+// Ranking is deterministic so it can be relied on in CI: every finding gets
+// a score of severity weight × exposure weight × fixability weight, and an
+// action's score is the sum over the findings it resolves. Fixing one package
+// that closes several CVEs on an internet-facing workload therefore ranks
+// above a single unfixable CVE on an internal one.
+package triage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/trixsec-dev/trix/internal/tools/exposure"
+	"github.com/trixsec-dev/trix/internal/tools/trivy"
+)
+
+// ActionKind says what kind of change resolves an action
+type ActionKind string
+
+const (
+	ActionUpgrade ActionKind = "upgrade" // Upgrade a package in an image
+	ActionConfig  ActionKind = "config"  // Change a workload's configuration
+	ActionSecret  ActionKind = "secret"  // Remove a secret from an image
+)
+
+// Action is one remediation step and everything it resolves
+type Action struct {
+	Kind  ActionKind `json:"kind"`
+	Title string     `json:"title"`
+
+	// Upgrade actions
+	Image            string `json:"image,omitempty"`
+	Package          string `json:"package,omitempty"`
+	InstalledVersion string `json:"installedVersion,omitempty"`
+	FixedVersion     string `json:"fixedVersion,omitempty"`
+
+	// Config and secret actions
+	CheckID     string `json:"checkId,omitempty"`
+	Remediation string `json:"remediation,omitempty"`
+
+	Fixable  bool                   `json:"fixable"`
+	Severity trivy.Severity         `json:"severity"` // Highest severity resolved
+	Exposure exposure.ExposureLevel `json:"exposure"` // Most exposed affected workload
+	Findings []string               `json:"findings"` // Finding IDs resolved
+	// Blast radius: affected workloads (namespace/kind/name)
+	Workloads []string `json:"workloads"`
+	Score     float64  `json:"score"`
+}
+
+// WorkloadKey identifies a workload in the exposure map passed to Rank
+func WorkloadKey(namespace, kind, name string) string {
+	return namespace + "/" + kind + "/" + name
+}
+
+// SeverityWeight returns the ranking weight for a severity
+func SeverityWeight(s trivy.Severity) float64 {
+	switch s.Rank() {
+	case 1:
+		return 10
+	case 2:
+		return 5
+	case 3:
+		return 2
+	case 4:
+		return 1
+	default:
+		return 0.5
+	}
+}
+
+// ExposureWeight returns the ranking weight for an exposure level.
+// Workloads whose exposure could not be determined count as internal.
+func ExposureWeight(level exposure.ExposureLevel) float64 {
+	switch level {
+	case exposure.ExposureLevelExternal:
+		return 3
+	case exposure.ExposureLevelNodePort:
+		return 2
+	case exposure.ExposureLevelNone:
+		return 0.5
+	default:
+		return 1
+	}
+}
+
+// FixabilityWeight favors findings that can be resolved right now
+func FixabilityWeight(fixable bool) float64 {
+	if fixable {
+		return 1
+	}
+	return 0.3
+}
+
+// Score ranks a single finding
+func Score(severity trivy.Severity, level exposure.ExposureLevel, fixable bool) float64 {
+	return SeverityWeight(severity) * ExposureWeight(level) * FixabilityWeight(fixable)
+}
+
+// Rank groups findings into actions and returns the top n by score (all
+// actions if n <= 0). Exposure levels are looked up by WorkloadKey; missing
+// workloads count as unknown. Findings of other types (RBAC, benchmarks) are
+// ignored since they don't map to a single workload change.
+func Rank(findings []trivy.Finding, exposures map[string]exposure.ExposureLevel, n int) []Action {
+	actions := make(map[string]*Action)
+	var order []string
+	counted := make(map[string]bool) // action|finding|workload already scored
+
+	for _, f := range findings {
+		key, action := newAction(f)
+		if action == nil {
+			continue
+		}
+		a, ok := actions[key]
+		if !ok {
+			a = action
+			actions[key] = a
+			order = append(order, key)
+		}
+
+		workload := WorkloadKey(f.Namespace, f.ResourceKind, f.ResourceName)
+		level := exposures[workload]
+		if f.Severity.Rank() < a.Severity.Rank() {
+			a.Severity = f.Severity
+		}
+		if a.Exposure == "" || level.Rank() < a.Exposure.Rank() {
+			a.Exposure = level
+		}
+		a.Findings = appendUnique(a.Findings, f.ID)
+		a.Workloads = appendUnique(a.Workloads, workload)
+
+		// The same CVE in several containers of one workload counts once
+		if id := key + "|" + f.ID + "|" + workload; !counted[id] {
+			counted[id] = true
+			a.Score += Score(f.Severity, level, a.Fixable)
+		}
+	}
+
+	ranked := make([]Action, 0, len(order))
+	for _, key := range order {
+		a := actions[key]
+		sort.Strings(a.Findings)
+		sort.Strings(a.Workloads)
+		if a.Exposure == "" {
+			a.Exposure = "unknown"
+		}
+		ranked = append(ranked, *a)
+	}
+
+	// Ties are broken by blast radius, then title, so the order is stable
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		if len(ranked[i].Workloads) != len(ranked[j].Workloads) {
+			return len(ranked[i].Workloads) > len(ranked[j].Workloads)
+		}
+		return ranked[i].Title < ranked[j].Title
+	})
+
+	if n > 0 && len(ranked) > n {
+		ranked = ranked[:n]
+	}
+	return ranked
+}
+
+// newAction returns the grouping key and an empty action for a finding,
+// or nil if the finding type is not triaged
+func newAction(f trivy.Finding) (string, *Action) {
+	switch f.Type {
+	case trivy.FindingTypeVulnerability:
+		a := &Action{Kind: ActionUpgrade, Image: imageRef(f), Severity: trivy.SeverityUnknown}
+		if v, ok := f.RawData.(trivy.Vulnerability); ok {
+			a.Package = v.PkgName
+			a.InstalledVersion = v.InstalledVersion
+			a.FixedVersion = v.FixedVersion
+		}
+		a.Fixable = a.FixedVersion != ""
+		if a.Fixable {
+			a.Title = fmt.Sprintf("Upgrade %s to %s in %s", a.Package, a.FixedVersion, a.Image)
+		} else {
+			a.Title = fmt.Sprintf("No fix yet for %s %s in %s", a.Package, a.InstalledVersion, a.Image)
+		}
+		key := strings.Join([]string{"upgrade", a.Image, a.Package, a.InstalledVersion, a.FixedVersion}, "|")
+		return key, a
+
+	case trivy.FindingTypeCompliance, trivy.FindingTypeInfra:
+		a := &Action{
+			Kind:        ActionConfig,
+			Title:       fmt.Sprintf("%s: %s", f.ID, f.Title),
+			CheckID:     f.ID,
+			Remediation: f.Remediation,
+			Fixable:     true,
+			Severity:    trivy.SeverityUnknown,
+		}
+		return "config|" + f.ID, a
+
+	case trivy.FindingTypeSecret:
+		a := &Action{
+			Kind:        ActionSecret,
+			Title:       fmt.Sprintf("Remove %s from %s", f.Title, imageRef(f)),
+			CheckID:     f.ID,
+			Remediation: "Remove the secret from the image, rotate it, and inject it at runtime instead",
+			Fixable:     true,
+			Severity:    trivy.SeverityUnknown,
+		}
+		return "secret|" + f.ID + "|" + imageRef(f) + "|" + f.Namespace + "/" + f.ResourceName, a
+	}
+	return "", nil
+}
+
+func imageRef(f trivy.Finding) string {
+	switch {
+	case f.ImageRepository == "":
+		return f.Namespace + "/" + f.ResourceName
+	case f.ImageTag == "":
+		return f.ImageRepository
+	default:
+		return f.ImageRepository + ":" + f.ImageTag
+	}
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, v := range list {
+		if v == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
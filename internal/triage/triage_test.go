@@ -0,0 +1,167 @@
+package triage
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/trixsec-dev/trix/internal/tools/exposure"
+	"github.com/trixsec-dev/trix/internal/tools/trivy"
+)
+
+func vuln(id string, sev trivy.Severity, ns, name, pkg, installed, fixed string) trivy.Finding {
+	return trivy.Finding{
+		ID: id, Type: trivy.FindingTypeVulnerability, Severity: sev,
+		Namespace: ns, ResourceKind: "Deployment", ResourceName: name,
+		ContainerName: "app", ImageRepository: "ghcr.io/acme/" + name, ImageTag: "1.0",
+		RawData: trivy.Vulnerability{VulnerabilityID: id, PkgName: pkg, InstalledVersion: installed, FixedVersion: fixed},
+	}
+}
+
+func misconfig(id string, sev trivy.Severity, ns, name string) trivy.Finding {
+	return trivy.Finding{
+		ID: id, Type: trivy.FindingTypeCompliance, Severity: sev,
+		Namespace: ns, ResourceKind: "Deployment", ResourceName: name,
+		Title: "Root file system is not read-only", Remediation: "Set readOnlyRootFilesystem to true",
+	}
+}
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		severity trivy.Severity
+		level    exposure.ExposureLevel
+		fixable  bool
+		want     float64
+	}{
+		{trivy.SeverityCritical, exposure.ExposureLevelExternal, true, 30},
+		{trivy.SeverityCritical, exposure.ExposureLevelExternal, false, 9},
+		{trivy.SeverityHigh, exposure.ExposureLevelNodePort, true, 10},
+		{trivy.SeverityHigh, exposure.ExposureLevelClusterInternal, true, 5},
+		{trivy.SeverityMedium, exposure.ExposureLevelNone, true, 1},
+		{trivy.SeverityLow, "", true, 1}, // Unknown exposure counts as internal
+		{trivy.SeverityUnknown, exposure.ExposureLevelExternal, true, 1.5},
+	}
+	for _, tt := range tests {
+		if got := Score(tt.severity, tt.level, tt.fixable); got != tt.want {
+			t.Errorf("Score(%s, %q, %v) = %v, want %v", tt.severity, tt.level, tt.fixable, got, tt.want)
+		}
+	}
+
+	// An unfixable critical on an exposed workload still beats a fixable high on an internal one
+	if Score(trivy.SeverityCritical, exposure.ExposureLevelExternal, false) <= Score(trivy.SeverityHigh, exposure.ExposureLevelClusterInternal, true) {
+		t.Error("exposure x severity does not outweigh fixability")
+	}
+}
+
+func TestRank(t *testing.T) {
+	sidecar := vuln("CVE-A", trivy.SeverityCritical, "payments", "api", "openssl", "3.0.1", "3.0.8")
+	sidecar.ContainerName = "sidecar"
+	secret := trivy.Finding{
+		ID: "aws-access-key-id", Type: trivy.FindingTypeSecret, Severity: trivy.SeverityHigh,
+		Namespace: "batch", ResourceKind: "Pod", ResourceName: "report",
+		ImageRepository: "ghcr.io/acme/report", ImageTag: "2.0", Title: "AWS Access Key ID",
+	}
+	findings := []trivy.Finding{
+		vuln("CVE-A", trivy.SeverityCritical, "payments", "api", "openssl", "3.0.1", "3.0.8"),
+		vuln("CVE-B", trivy.SeverityHigh, "payments", "api", "openssl", "3.0.1", "3.0.8"),
+		sidecar, // Same CVE in another container of the same workload
+		vuln("CVE-C", trivy.SeverityCritical, "shop", "web", "zlib", "1.2.11", ""),
+		misconfig("KSV014", trivy.SeverityHigh, "payments", "api"),
+		misconfig("KSV014", trivy.SeverityHigh, "shop", "web"),
+		secret,
+		vuln("CVE-D", trivy.SeverityHigh, "jobs", "worker", "glibc", "2.31", "2.32"),
+		{ID: "RBAC-1", Type: trivy.FindingTypeRBAC, Severity: trivy.SeverityCritical, ResourceKind: "ClusterRole", ResourceName: "admin"},
+	}
+	exposures := map[string]exposure.ExposureLevel{
+		WorkloadKey("payments", "Deployment", "api"): exposure.ExposureLevelExternal,
+		WorkloadKey("shop", "Deployment", "web"):     exposure.ExposureLevelNodePort,
+		WorkloadKey("batch", "Pod", "report"):        exposure.ExposureLevelNone,
+		// jobs/worker could not be analyzed
+	}
+
+	ranked := Rank(findings, exposures, 0)
+
+	type summary struct {
+		Title     string
+		Score     float64
+		Severity  trivy.Severity
+		Exposure  exposure.ExposureLevel
+		Findings  []string
+		Workloads []string
+	}
+	var got []summary
+	for _, a := range ranked {
+		got = append(got, summary{a.Title, a.Score, a.Severity, a.Exposure, a.Findings, a.Workloads})
+	}
+	want := []summary{
+		{"Upgrade openssl to 3.0.8 in ghcr.io/acme/api:1.0", 45, trivy.SeverityCritical, exposure.ExposureLevelExternal,
+			[]string{"CVE-A", "CVE-B"}, []string{"payments/Deployment/api"}},
+		{"KSV014: Root file system is not read-only", 25, trivy.SeverityHigh, exposure.ExposureLevelExternal,
+			[]string{"KSV014"}, []string{"payments/Deployment/api", "shop/Deployment/web"}},
+		{"No fix yet for zlib 1.2.11 in ghcr.io/acme/web:1.0", 6, trivy.SeverityCritical, exposure.ExposureLevelNodePort,
+			[]string{"CVE-C"}, []string{"shop/Deployment/web"}},
+		{"Upgrade glibc to 2.32 in ghcr.io/acme/worker:1.0", 5, trivy.SeverityHigh, "unknown",
+			[]string{"CVE-D"}, []string{"jobs/Deployment/worker"}},
+		{"Remove AWS Access Key ID from ghcr.io/acme/report:2.0", 2.5, trivy.SeverityHigh, exposure.ExposureLevelNone,
+			[]string{"aws-access-key-id"}, []string{"batch/Pod/report"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Rank =\n%+v\nwant\n%+v", got, want)
+	}
+
+	upgrade := ranked[0]
+	if upgrade.Kind != ActionUpgrade || !upgrade.Fixable || upgrade.Package != "openssl" ||
+		upgrade.InstalledVersion != "3.0.1" || upgrade.FixedVersion != "3.0.8" || upgrade.Image != "ghcr.io/acme/api:1.0" {
+		t.Errorf("upgrade action = %+v", upgrade)
+	}
+	if config := ranked[1]; config.Kind != ActionConfig || config.CheckID != "KSV014" || config.Remediation != "Set readOnlyRootFilesystem to true" {
+		t.Errorf("config action = %+v", config)
+	}
+	if unfixed := ranked[2]; unfixed.Fixable {
+		t.Error("action without a fixed version is fixable")
+	}
+	if s := ranked[4]; s.Kind != ActionSecret || s.Remediation == "" {
+		t.Errorf("secret action = %+v", s)
+	}
+
+	// Top n
+	if top := Rank(findings, exposures, 2); len(top) != 2 || top[1].Title != ranked[1].Title {
+		t.Errorf("Rank(n=2) = %+v", top)
+	}
+}
+
+// Equal scores are ordered by blast radius, then title, whatever the input order
+func TestRankTies(t *testing.T) {
+	findings := []trivy.Finding{
+		vuln("CVE-1", trivy.SeverityHigh, "a", "zeta", "pkg", "1", "2"),
+		vuln("CVE-2", trivy.SeverityHigh, "a", "alpha", "pkg", "1", "2"),
+		misconfig("KSV001", trivy.SeverityLow, "a", "one"),
+		misconfig("KSV001", trivy.SeverityLow, "a", "two"),
+		misconfig("KSV001", trivy.SeverityLow, "a", "three"),
+		misconfig("KSV001", trivy.SeverityLow, "a", "four"),
+		misconfig("KSV001", trivy.SeverityLow, "a", "five"),
+	}
+	want := []string{
+		"KSV001: Root file system is not read-only", // 1 on each of five workloads ties with 5 on one
+		"Upgrade pkg to 2 in ghcr.io/acme/alpha:1.0",
+		"Upgrade pkg to 2 in ghcr.io/acme/zeta:1.0",
+	}
+	for _, order := range [][]int{{0, 1, 2, 3, 4, 5, 6}, {6, 5, 4, 3, 2, 1, 0}} {
+		var input []trivy.Finding
+		for _, i := range order {
+			input = append(input, findings[i])
+		}
+		var got []string
+		for _, a := range Rank(input, nil, 0) {
+			got = append(got, a.Title)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Rank(%v) = %v, want %v", order, got, want)
+		}
+	}
+}
+
+func TestRankEmpty(t *testing.T) {
+	if got := Rank(nil, nil, 10); len(got) != 0 {
+		t.Errorf("Rank(nil) = %v", got)
+	}
+}
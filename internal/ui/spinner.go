@@ -0,0 +1,170 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// Spinner draws a single status line with elapsed time, redrawn in place.
+//
+// It is meant for a terminal (stderr), so callers should only create one
+// when the writer is a TTY. A nil *Spinner is valid and does nothing, which
+// keeps call sites free of "is the spinner enabled?" checks.
+type Spinner struct {
+	w        io.Writer
+	interval time.Duration
+	muted    lipgloss.Style
+
+	mu      sync.Mutex
+	message string
+	start   time.Time
+	frame   int
+	running bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewSpinner creates a spinner that draws to w.
+func NewSpinner(w io.Writer) *Spinner {
+	return &Spinner{
+		w:        w,
+		interval: 100 * time.Millisecond,
+		muted:    NewRenderer(w).NewStyle().Foreground(ColorMuted),
+	}
+}
+
+// Start shows the spinner with the given message and resets the timer.
+func (s *Spinner) Start(message string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.message = message
+	if s.running {
+		return
+	}
+	s.start = time.Now()
+	s.running = true
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	s.draw()
+	go s.loop(s.stop, s.done)
+}
+
+// Update changes the message without resetting the timer.
+func (s *Spinner) Update(message string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.message = message
+	if s.running {
+		s.draw()
+	}
+}
+
+// Println prints a line to w without garbling the spinner: the status line
+// is cleared first and redrawn afterwards.
+func (s *Spinner) Println(w io.Writer, line string) {
+	_, _ = fmt.Fprintln(s.Writer(w), line)
+}
+
+// Writer wraps w so that writes go through the same clear/redraw cycle as
+// Println. Writes should be whole lines.
+func (s *Spinner) Writer(w io.Writer) io.Writer {
+	if s == nil {
+		return w
+	}
+	return &spinnerWriter{s: s, w: w}
+}
+
+type spinnerWriter struct {
+	s *Spinner
+	w io.Writer
+}
+
+func (sw *spinnerWriter) Write(p []byte) (int, error) {
+	sw.s.mu.Lock()
+	defer sw.s.mu.Unlock()
+	if sw.s.running {
+		sw.s.clear()
+	}
+	n, err := sw.w.Write(p)
+	if sw.s.running {
+		sw.s.draw()
+	}
+	return n, err
+}
+
+// Stop clears the status line. It is safe to call more than once.
+func (s *Spinner) Stop() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if !s.running {
+		s.mu.Unlock()
+		return
+	}
+	s.running = false
+	close(s.stop)
+	done := s.done
+	s.mu.Unlock()
+
+	<-done
+
+	s.mu.Lock()
+	s.clear()
+	s.mu.Unlock()
+}
+
+func (s *Spinner) loop(stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			if s.running {
+				s.frame = (s.frame + 1) % len(spinnerFrames)
+				s.draw()
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// draw must be called with s.mu held.
+func (s *Spinner) draw() {
+	elapsed := time.Since(s.start).Round(100 * time.Millisecond)
+	_, _ = fmt.Fprintf(s.w, "\r\033[K%s %s %s",
+		spinnerFrames[s.frame], s.message, s.muted.Render(fmt.Sprintf("(%s)", elapsed)))
+}
+
+// clear must be called with s.mu held.
+func (s *Spinner) clear() {
+	_, _ = fmt.Fprint(s.w, "\r\033[K")
+}
+
+// FormatTokens renders a token count compactly, e.g. 950, 12.4k, 1.2M.
+func FormatTokens(n int) string {
+	switch {
+	case n >= 1_000_000:
+		return fmt.Sprintf("%.1fM", float64(n)/1_000_000)
+	case n >= 1_000:
+		return fmt.Sprintf("%.1fk", float64(n)/1_000)
+	default:
+		return fmt.Sprintf("%d", n)
+	}
+}
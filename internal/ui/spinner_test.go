@@ -0,0 +1,119 @@
+package ui
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer safe for the spinner's redraw goroutine
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestSpinner(t *testing.T) {
+	var out syncBuffer
+	s := NewSpinner(&out)
+	s.interval = time.Millisecond
+
+	s.Start("waiting for model")
+	s.Update("running kubectl get pods -n prod")
+	time.Sleep(20 * time.Millisecond) // Let the ticker redraw a few frames
+	var lines bytes.Buffer
+	s.Println(&lines, "  → kubectl get pods -n prod")
+	s.Stop()
+	s.Stop()
+
+	got := out.String()
+	for _, want := range []string{"waiting for model", "running kubectl get pods -n prod", "(0s)"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("spinner output lacks %q: %q", want, got)
+		}
+	}
+	if !strings.HasSuffix(got, "\r\033[K") {
+		t.Errorf("Stop did not clear the status line: %q", got)
+	}
+	if lines.String() != "  → kubectl get pods -n prod\n" {
+		t.Errorf("Println wrote %q", lines.String())
+	}
+
+	// Stopped: updates and lines don't redraw the spinner
+	before := out.String()
+	s.Update("ignored")
+	s.Println(&lines, "after")
+	if out.String() != before {
+		t.Errorf("stopped spinner drew %q", strings.TrimPrefix(out.String(), before))
+	}
+}
+
+// Lines printed while the spinner runs clear the status line first and
+// redraw it afterwards
+func TestSpinnerWriter(t *testing.T) {
+	var out syncBuffer
+	s := NewSpinner(&out)
+	s.interval = time.Hour
+	s.Start("working")
+	w := s.Writer(&out)
+	_, _ = w.Write([]byte("trace line\n"))
+	s.Stop()
+
+	got := out.String()
+	i := strings.Index(got, "trace line\n")
+	if i < 0 {
+		t.Fatalf("output lacks the line: %q", got)
+	}
+	if !strings.HasSuffix(got[:i], "\r\033[K") {
+		t.Errorf("status line not cleared before the write: %q", got[:i])
+	}
+	if !strings.Contains(got[i:], "working") {
+		t.Errorf("status line not redrawn after the write: %q", got[i:])
+	}
+}
+
+func TestNilSpinner(t *testing.T) {
+	var s *Spinner
+	s.Start("x")
+	s.Update("y")
+	s.Stop()
+	var out bytes.Buffer
+	s.Println(&out, "line")
+	if w := s.Writer(&out); w != &out {
+		t.Error("nil spinner wrapped the writer")
+	}
+	if out.String() != "line\n" {
+		t.Errorf("nil spinner Println wrote %q", out.String())
+	}
+}
+
+func TestFormatTokens(t *testing.T) {
+	tests := []struct {
+		n    int
+		want string
+	}{
+		{0, "0"},
+		{950, "950"},
+		{1000, "1.0k"},
+		{12400, "12.4k"},
+		{1_200_000, "1.2M"},
+	}
+	for _, tt := range tests {
+		if got := FormatTokens(tt.n); got != tt.want {
+			t.Errorf("FormatTokens(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
@@ -1,6 +1,11 @@
 package ui
 
-import "github.com/charmbracelet/lipgloss"
+import (
+	"io"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
 
 // ANSI 256 color codes: https://www.ditig.com/256-colors-cheat-sheet
 // Using subtle colors that work on both light and dark terminals.
@@ -46,3 +51,27 @@ func Severity(sev string) lipgloss.Style {
 		return Unknown
 	}
 }
+
+// noColor is set by DisableColor and applies to renderers created afterwards.
+var noColor bool
+
+// DisableColor turns off ANSI colors for all ui output (--no-color).
+func DisableColor() {
+	noColor = true
+	lipgloss.SetColorProfile(termenv.Ascii)
+}
+
+// ColorDisabled reports whether DisableColor has been called.
+func ColorDisabled() bool {
+	return noColor
+}
+
+// NewRenderer returns a lipgloss renderer that detects color support for w
+// (e.g. stderr) instead of stdout, and honors DisableColor.
+func NewRenderer(w io.Writer) *lipgloss.Renderer {
+	r := lipgloss.NewRenderer(w)
+	if noColor {
+		r.SetColorProfile(termenv.Ascii)
+	}
+	return r
+}
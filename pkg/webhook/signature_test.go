@@ -0,0 +1,104 @@
+package webhook
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	// echo -n '1700000000.{"a":1}' | openssl dgst -sha256 -hmac secret
+	const want = "sha256=49f24e537407743fa4a0242bb63b94b9a47ee99cbbe071ccd8a22550ae411686"
+	got := Sign("secret", 1700000000, []byte(`{"a":1}`))
+	if got != want {
+		t.Fatalf("Sign() = %q, want %q", got, want)
+	}
+	if Sign("secret", 1700000001, []byte(`{"a":1}`)) == got {
+		t.Error("signature does not cover the timestamp")
+	}
+	if Sign("other", 1700000000, []byte(`{"a":1}`)) == got {
+		t.Error("signature does not depend on the secret")
+	}
+	if Sign("secret", 1700000000, []byte(`{"a":2}`)) == got {
+		t.Error("signature does not cover the body")
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	const secret = "s3cret"
+	body := []byte(`{"events":[]}`)
+	now := time.Now().Unix()
+
+	signed := func(ts int64, b []byte) http.Header {
+		h := http.Header{}
+		h.Set(TimestampHeader, strconv.FormatInt(ts, 10))
+		h.Set(SignatureHeader, Sign(secret, ts, b))
+		return h
+	}
+
+	tests := []struct {
+		name      string
+		header    http.Header
+		body      []byte
+		tolerance time.Duration
+		wantErr   error  // Checked with errors.Is when set
+		wantMsg   string // Substring of the error otherwise
+	}{
+		{name: "valid", header: signed(now, body), body: body, tolerance: 5 * time.Minute},
+		{name: "valid without tolerance", header: signed(now-86400, body), body: body},
+		{name: "tampered body", header: signed(now, body), body: []byte(`{"events":[1]}`), tolerance: 5 * time.Minute, wantErr: ErrInvalidSignature},
+		{name: "wrong secret", header: func() http.Header {
+			h := signed(now, body)
+			h.Set(SignatureHeader, Sign("other", now, body))
+			return h
+		}(), body: body, wantErr: ErrInvalidSignature},
+		{name: "timestamp changed", header: func() http.Header {
+			h := signed(now, body)
+			h.Set(TimestampHeader, strconv.FormatInt(now+1, 10))
+			return h
+		}(), body: body, tolerance: 5 * time.Minute, wantErr: ErrInvalidSignature},
+		{name: "missing prefix", header: func() http.Header {
+			h := signed(now, body)
+			h.Set(SignatureHeader, strings.TrimPrefix(h.Get(SignatureHeader), "sha256="))
+			return h
+		}(), body: body, wantErr: ErrInvalidSignature},
+		{name: "missing signature", header: func() http.Header {
+			h := signed(now, body)
+			h.Del(SignatureHeader)
+			return h
+		}(), body: body, wantErr: ErrInvalidSignature},
+		{name: "malformed timestamp", header: func() http.Header {
+			h := signed(now, body)
+			h.Set(TimestampHeader, "yesterday")
+			return h
+		}(), body: body, wantMsg: "invalid X-Trix-Timestamp header"},
+		{name: "missing timestamp", header: func() http.Header {
+			h := signed(now, body)
+			h.Del(TimestampHeader)
+			return h
+		}(), body: body, wantMsg: "invalid X-Trix-Timestamp header"},
+		{name: "too old", header: signed(now-600, body), body: body, tolerance: 5 * time.Minute, wantMsg: "outside tolerance"},
+		{name: "too far in the future", header: signed(now+600, body), body: body, tolerance: 5 * time.Minute, wantMsg: "outside tolerance"},
+		{name: "just inside tolerance", header: signed(now-240, body), body: body, tolerance: 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifySignature(secret, tt.header, tt.body, tt.tolerance)
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("err = %v, want %v", err, tt.wantErr)
+				}
+			case tt.wantMsg != "":
+				if err == nil || !strings.Contains(err.Error(), tt.wantMsg) {
+					t.Errorf("err = %v, want one containing %q", err, tt.wantMsg)
+				}
+			case err != nil:
+				t.Errorf("err = %v, want nil", err)
+			}
+		})
+	}
+}